@@ -14,5 +14,31 @@
     "000006_add_writer_column.up.sql": importstr "defaultdb/000006_add_writer_column.up.sql",
     "000007_add_index_by_time_subscriptions.down.sql": importstr "defaultdb/000007_add_index_by_time_subscriptions.down.sql",
     "000007_add_index_by_time_subscriptions.up.sql": importstr "defaultdb/000007_add_index_by_time_subscriptions.up.sql",
+    "000008_add_region_column.down.sql": importstr "defaultdb/000008_add_region_column.down.sql",
+    "000008_add_region_column.up.sql": importstr "defaultdb/000008_add_region_column.up.sql",
+    "000009_add_audit_tables.down.sql": importstr "defaultdb/000009_add_audit_tables.down.sql",
+    "000009_add_audit_tables.up.sql": importstr "defaultdb/000009_add_audit_tables.up.sql",
+    "000010_add_feature_flags.down.sql": importstr "defaultdb/000010_add_feature_flags.down.sql",
+    "000010_add_feature_flags.up.sql": importstr "defaultdb/000010_add_feature_flags.up.sql",
+    "000011_add_idempotency_keys.down.sql": importstr "defaultdb/000011_add_idempotency_keys.down.sql",
+    "000011_add_idempotency_keys.up.sql": importstr "defaultdb/000011_add_idempotency_keys.up.sql",
+    "000012_add_id_format_checks.down.sql": importstr "defaultdb/000012_add_id_format_checks.down.sql",
+    "000012_add_id_format_checks.up.sql": importstr "defaultdb/000012_add_id_format_checks.up.sql",
+    "000013_add_request_journal.down.sql": importstr "defaultdb/000013_add_request_journal.down.sql",
+    "000013_add_request_journal.up.sql": importstr "defaultdb/000013_add_request_journal.up.sql",
+    "000014_widen_notification_indices.down.sql": importstr "defaultdb/000014_widen_notification_indices.down.sql",
+    "000014_widen_notification_indices.up.sql": importstr "defaultdb/000014_widen_notification_indices.up.sql",
+    "000015_add_write_restrictions.down.sql": importstr "defaultdb/000015_add_write_restrictions.down.sql",
+    "000015_add_write_restrictions.up.sql": importstr "defaultdb/000015_add_write_restrictions.up.sql",
+    "000016_index_dss_reports.down.sql": importstr "defaultdb/000016_index_dss_reports.down.sql",
+    "000016_index_dss_reports.up.sql": importstr "defaultdb/000016_index_dss_reports.up.sql",
+    "000017_add_id_reservations.down.sql": importstr "defaultdb/000017_add_id_reservations.down.sql",
+    "000017_add_id_reservations.up.sql": importstr "defaultdb/000017_add_id_reservations.up.sql",
+    "000018_index_dss_report_entities.down.sql": importstr "defaultdb/000018_index_dss_report_entities.down.sql",
+    "000018_index_dss_report_entities.up.sql": importstr "defaultdb/000018_index_dss_report_entities.up.sql",
+    "000019_add_event_publishers.down.sql": importstr "defaultdb/000019_add_event_publishers.down.sql",
+    "000019_add_event_publishers.up.sql": importstr "defaultdb/000019_add_event_publishers.up.sql",
+    "000020_add_jurisdiction_column.down.sql": importstr "defaultdb/000020_add_jurisdiction_column.down.sql",
+    "000020_add_jurisdiction_column.up.sql": importstr "defaultdb/000020_add_jurisdiction_column.up.sql",
   },
 }
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE identification_service_areas DROP COLUMN IF EXISTS region;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS region;
+UPDATE schema_versions set schema_version = 'v3.1.1' WHERE onerow_enforcer = TRUE;
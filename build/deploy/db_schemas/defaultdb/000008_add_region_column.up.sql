@@ -0,0 +1,13 @@
+-- /* Partition entities by the S2 face of their cells; see pkg/geo/region.go */
+ALTER TABLE identification_service_areas ADD COLUMN IF NOT EXISTS region INT2 NOT NULL DEFAULT 6;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS region INT2 NOT NULL DEFAULT 6;
+
+-- /* The face of an S2 cell is held in its 3 most significant bits */
+UPDATE identification_service_areas SET region = (
+  SELECT IF(count(DISTINCT (c >> 61) & 7) = 1, max((c >> 61) & 7), 6) FROM unnest(cells) AS c
+);
+UPDATE subscriptions SET region = (
+  SELECT IF(count(DISTINCT (c >> 61) & 7) = 1, max((c >> 61) & 7), 6) FROM unnest(cells) AS c
+);
+
+UPDATE schema_versions set schema_version = 'v3.2.0' WHERE onerow_enforcer = TRUE;
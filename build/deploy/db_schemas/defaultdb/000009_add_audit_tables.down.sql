@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS dss_reports;
+DROP TABLE IF EXISTS audit_log;
+UPDATE schema_versions set schema_version = 'v3.2.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,27 @@
+-- /* Audit log of the calls changing the state of the DSS; see pkg/audit */
+CREATE TABLE IF NOT EXISTS audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    occurred_at TIMESTAMPTZ NOT NULL,
+    method STRING NOT NULL,
+    manager STRING NOT NULL,
+    entity_id STRING,
+    code STRING NOT NULL,
+    details STRING,
+    INDEX audit_log_by_time (occurred_at),
+    INDEX audit_log_by_manager (manager, occurred_at),
+    INDEX audit_log_by_entity (entity_id, occurred_at),
+    INDEX audit_log_by_code (code, occurred_at)
+);
+
+-- /* DSS reports filed by USSs */
+CREATE TABLE IF NOT EXISTS dss_reports (
+    id UUID PRIMARY KEY,
+    reported_at TIMESTAMPTZ NOT NULL,
+    manager STRING NOT NULL,
+    response_code INT4 NOT NULL,
+    report JSONB NOT NULL,
+    INDEX dss_reports_by_time (reported_at),
+    INDEX dss_reports_by_manager (manager, reported_at)
+);
+
+UPDATE schema_versions set schema_version = 'v3.3.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS feature_flags;
+UPDATE schema_versions set schema_version = 'v3.3.0' WHERE onerow_enforcer = TRUE;
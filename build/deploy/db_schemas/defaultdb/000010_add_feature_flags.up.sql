@@ -0,0 +1,8 @@
+-- /* Runtime overrides of the feature gates of the DSS; see pkg/flags */
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name STRING PRIMARY KEY,
+    enabled BOOL NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+UPDATE schema_versions set schema_version = 'v3.4.0' WHERE onerow_enforcer = TRUE;
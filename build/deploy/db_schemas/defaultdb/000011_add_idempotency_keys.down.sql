@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS idempotency_keys;
+UPDATE schema_versions set schema_version = 'v3.4.0' WHERE onerow_enforcer = TRUE;
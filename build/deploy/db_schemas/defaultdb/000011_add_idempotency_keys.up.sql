@@ -0,0 +1,14 @@
+-- /* Responses replayed to the calls retried with the same Idempotency-Key
+--    header; see pkg/idempotency */
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    manager STRING NOT NULL,
+    idempotency_key STRING NOT NULL,
+    method STRING NOT NULL,
+    request_hash BYTES NOT NULL,
+    response BYTES,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (manager, idempotency_key),
+    INDEX expires_at_idx (expires_at)
+);
+
+UPDATE schema_versions set schema_version = 'v3.5.0' WHERE onerow_enforcer = TRUE;
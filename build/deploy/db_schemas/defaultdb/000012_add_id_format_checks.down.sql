@@ -0,0 +1,3 @@
+ALTER TABLE identification_service_areas DROP CONSTRAINT IF EXISTS id_format;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS id_format;
+UPDATE schema_versions set schema_version = 'v3.5.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,7 @@
+-- /* Require the IDs of new entities to be RFC 4122 UUIDs of a defined
+--    version; entities written before the migration are not checked until
+--    the constraints are validated, see README.md */
+ALTER TABLE identification_service_areas ADD CONSTRAINT id_format CHECK (substring(id::STRING, 15, 1) IN ('1', '2', '3', '4', '5', '6', '7', '8') AND substring(id::STRING, 20, 1) IN ('8', '9', 'a', 'b')) NOT VALID;
+ALTER TABLE subscriptions ADD CONSTRAINT id_format CHECK (substring(id::STRING, 15, 1) IN ('1', '2', '3', '4', '5', '6', '7', '8') AND substring(id::STRING, 20, 1) IN ('8', '9', 'a', 'b')) NOT VALID;
+
+UPDATE schema_versions set schema_version = 'v3.6.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS request_journal;
+UPDATE schema_versions set schema_version = 'v3.6.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,19 @@
+-- /* Signed, hash-chained journal of the calls changing the state of the
+--    DSS, one chain per DSS instance; see pkg/journal */
+CREATE TABLE IF NOT EXISTS request_journal (
+    chain STRING NOT NULL,
+    seq INT8 NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    method STRING NOT NULL,
+    subject STRING NOT NULL,
+    payload_digest STRING NOT NULL,
+    code STRING NOT NULL,
+    result_digest STRING NOT NULL DEFAULT '',
+    prev_hash STRING NOT NULL,
+    hash STRING NOT NULL,
+    signature STRING NOT NULL,
+    PRIMARY KEY (chain, seq),
+    INDEX request_journal_by_time (recorded_at)
+);
+
+UPDATE schema_versions set schema_version = 'v3.7.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,5 @@
+-- /* Narrowing requires the general column type changes of CockroachDB, and
+--    fails if a notification index exceeds INT4; reset those first. */
+SET enable_experimental_alter_column_type_general = true;
+ALTER TABLE subscriptions ALTER COLUMN notification_index TYPE INT4;
+UPDATE schema_versions set schema_version = 'v3.7.0' WHERE onerow_enforcer = TRUE;
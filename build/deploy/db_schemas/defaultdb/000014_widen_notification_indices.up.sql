@@ -0,0 +1,6 @@
+-- /* Widen the notification indices of subscriptions, which overflowed INT4
+--    in busy areas for long-lived subscriptions; they are served modulo
+--    2^31 instead. */
+ALTER TABLE subscriptions ALTER COLUMN notification_index TYPE INT8;
+
+UPDATE schema_versions set schema_version = 'v3.8.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS write_restrictions;
+UPDATE schema_versions set schema_version = 'v3.8.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,12 @@
+-- /* Areas whose entities only some managers may write, e.g. the authority
+--    managing a temporary flight restriction; see pkg/restrictions */
+CREATE TABLE IF NOT EXISTS write_restrictions (
+    name STRING PRIMARY KEY,
+    cells INT64[] NOT NULL,
+    managers STRING[] NOT NULL,
+    kinds STRING[] NOT NULL DEFAULT ARRAY[]:::STRING[],
+    reason STRING NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+UPDATE schema_versions set schema_version = 'v3.9.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS dss_reports@dss_reports_by_code;
+DROP INDEX IF EXISTS dss_reports@dss_reports_by_participant;
+ALTER TABLE dss_reports DROP COLUMN IF EXISTS participant;
+UPDATE schema_versions set schema_version = 'v3.9.0' WHERE onerow_enforcer = TRUE;
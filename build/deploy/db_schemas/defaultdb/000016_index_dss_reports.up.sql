@@ -0,0 +1,10 @@
+-- /* Index the DSS reports by the host of the URL of the exchange reported, its
+--    participant besides the reporting manager, and by response code, so that
+--    interoperability problems can be searched and trended; see pkg/audit */
+ALTER TABLE dss_reports ADD COLUMN IF NOT EXISTS participant STRING NOT NULL AS (
+  lower(COALESCE(substring(report->'exchange'->>'url' FROM '^[[:alpha:]][[:alnum:]+.-]*://(?:[^/?#]*@)?([^/:?#]+)'), ''))
+) STORED;
+CREATE INDEX IF NOT EXISTS dss_reports_by_participant ON dss_reports (participant, reported_at);
+CREATE INDEX IF NOT EXISTS dss_reports_by_code ON dss_reports (response_code, reported_at);
+
+UPDATE schema_versions set schema_version = 'v3.10.0' WHERE onerow_enforcer = TRUE;
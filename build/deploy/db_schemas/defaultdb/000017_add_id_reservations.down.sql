@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS id_reservations;
+UPDATE schema_versions set schema_version = 'v3.10.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,11 @@
+-- /* IDs minted by the DSS and reserved to the client they were minted for;
+--    see pkg/ids */
+CREATE TABLE IF NOT EXISTS id_reservations (
+    id UUID PRIMARY KEY,
+    owner STRING NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    INDEX owner_idx (owner, expires_at),
+    INDEX expires_at_idx (expires_at)
+);
+
+UPDATE schema_versions set schema_version = 'v3.11.0' WHERE onerow_enforcer = TRUE;
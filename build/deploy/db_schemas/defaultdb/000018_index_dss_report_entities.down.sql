@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS dss_reports@dss_reports_by_entity;
+ALTER TABLE dss_reports DROP COLUMN IF EXISTS entity_id;
+UPDATE schema_versions set schema_version = 'v3.11.0' WHERE onerow_enforcer = TRUE;
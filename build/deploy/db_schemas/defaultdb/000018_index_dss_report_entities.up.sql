@@ -0,0 +1,8 @@
+-- /* Index the DSS reports by the entity whose URL was exchanged, so that
+--    reports can be searched by entity without scanning them; see pkg/audit */
+ALTER TABLE dss_reports ADD COLUMN IF NOT EXISTS entity_id STRING AS (
+  lower(substring(report->'exchange'->>'url' FROM '[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}'))
+) STORED;
+CREATE INDEX IF NOT EXISTS dss_reports_by_entity ON dss_reports (entity_id, reported_at);
+
+UPDATE schema_versions set schema_version = 'v3.12.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS event_publishers;
+UPDATE schema_versions set schema_version = 'v3.12.0' WHERE onerow_enforcer = TRUE;
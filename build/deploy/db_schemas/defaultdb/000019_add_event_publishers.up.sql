@@ -0,0 +1,10 @@
+-- /* Lease of the one instance of the pool publishing each changefeed, and
+--    the resolved timestamp it resumes from; see pkg/events */
+CREATE TABLE IF NOT EXISTS event_publishers (
+    feed STRING PRIMARY KEY,
+    holder STRING NOT NULL,
+    lease_expires_at TIMESTAMPTZ NOT NULL,
+    cursor STRING NOT NULL DEFAULT ''
+);
+
+UPDATE schema_versions set schema_version = 'v3.13.0' WHERE onerow_enforcer = TRUE;
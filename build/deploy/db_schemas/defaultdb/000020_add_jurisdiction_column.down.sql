@@ -0,0 +1,5 @@
+-- /* Tables partitioned by jurisdiction must first be unpartitioned with
+--    the partition subcommand of the db-manager and an empty --jurisdictions */
+ALTER TABLE identification_service_areas DROP COLUMN IF EXISTS jurisdiction;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS jurisdiction;
+UPDATE schema_versions set schema_version = 'v3.13.0' WHERE onerow_enforcer = TRUE;
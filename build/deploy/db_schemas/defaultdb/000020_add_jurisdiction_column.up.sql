@@ -0,0 +1,6 @@
+-- /* Jurisdiction of entities, which the tables may be partitioned by with the
+--    partition subcommand of the db-manager; see pkg/geo/jurisdiction.go */
+ALTER TABLE identification_service_areas ADD COLUMN IF NOT EXISTS jurisdiction STRING NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS jurisdiction STRING NOT NULL DEFAULT '';
+
+UPDATE schema_versions set schema_version = 'v3.14.0' WHERE onerow_enforcer = TRUE;
@@ -6,5 +6,35 @@
     "000002_support_api_1_0_0.up.sql": importstr "scd/000002_support_api_1_0_0.up.sql",
     "000003_scd_inverted_indices.down.sql": importstr "scd/000003_scd_inverted_indices.down.sql",
     "000003_scd_inverted_indices.up.sql": importstr "scd/000003_scd_inverted_indices.up.sql",
+    "000004_add_region_column.down.sql": importstr "scd/000004_add_region_column.down.sql",
+    "000004_add_region_column.up.sql": importstr "scd/000004_add_region_column.up.sql",
+    "000005_add_operation_versions.down.sql": importstr "scd/000005_add_operation_versions.down.sql",
+    "000005_add_operation_versions.up.sql": importstr "scd/000005_add_operation_versions.up.sql",
+    "000006_add_quarantined_operations.down.sql": importstr "scd/000006_add_quarantined_operations.down.sql",
+    "000006_add_quarantined_operations.up.sql": importstr "scd/000006_add_quarantined_operations.up.sql",
+    "000007_add_cells_operations.down.sql": importstr "scd/000007_add_cells_operations.down.sql",
+    "000007_add_cells_operations.up.sql": importstr "scd/000007_add_cells_operations.up.sql",
+    "000008_add_time_indices.down.sql": importstr "scd/000008_add_time_indices.down.sql",
+    "000008_add_time_indices.up.sql": importstr "scd/000008_add_time_indices.up.sql",
+    "000009_add_footprints.down.sql": importstr "scd/000009_add_footprints.down.sql",
+    "000009_add_footprints.up.sql": importstr "scd/000009_add_footprints.up.sql",
+    "000010_add_id_format_checks.down.sql": importstr "scd/000010_add_id_format_checks.down.sql",
+    "000010_add_id_format_checks.up.sql": importstr "scd/000010_add_id_format_checks.up.sql",
+    "000011_add_constraint_types.down.sql": importstr "scd/000011_add_constraint_types.down.sql",
+    "000011_add_constraint_types.up.sql": importstr "scd/000011_add_constraint_types.up.sql",
+    "000012_add_entity_history.down.sql": importstr "scd/000012_add_entity_history.down.sql",
+    "000012_add_entity_history.up.sql": importstr "scd/000012_add_entity_history.up.sql",
+    "000013_add_sequenced_ovns.down.sql": importstr "scd/000013_add_sequenced_ovns.down.sql",
+    "000013_add_sequenced_ovns.up.sql": importstr "scd/000013_add_sequenced_ovns.up.sql",
+    "000014_widen_notification_indices.down.sql": importstr "scd/000014_widen_notification_indices.down.sql",
+    "000014_widen_notification_indices.up.sql": importstr "scd/000014_widen_notification_indices.up.sql",
+    "000015_add_operation_volumes.down.sql": importstr "scd/000015_add_operation_volumes.down.sql",
+    "000015_add_operation_volumes.up.sql": importstr "scd/000015_add_operation_volumes.up.sql",
+    "000016_add_altitude_references.down.sql": importstr "scd/000016_add_altitude_references.down.sql",
+    "000016_add_altitude_references.up.sql": importstr "scd/000016_add_altitude_references.up.sql",
+    "000017_add_expiry_scans.down.sql": importstr "scd/000017_add_expiry_scans.down.sql",
+    "000017_add_expiry_scans.up.sql": importstr "scd/000017_add_expiry_scans.up.sql",
+    "000018_add_jurisdiction_column.down.sql": importstr "scd/000018_add_jurisdiction_column.down.sql",
+    "000018_add_jurisdiction_column.up.sql": importstr "scd/000018_add_jurisdiction_column.up.sql",
   },
 }
@@ -0,0 +1,4 @@
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS region;
+ALTER TABLE scd_subscriptions DROP COLUMN IF EXISTS region;
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS region;
+UPDATE schema_versions set schema_version = 'v3.0.0' WHERE onerow_enforcer = TRUE;
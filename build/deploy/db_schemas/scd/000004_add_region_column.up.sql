@@ -0,0 +1,17 @@
+-- /* Partition entities by the S2 face of their cells; see pkg/geo/region.go */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS region INT2 NOT NULL DEFAULT 6;
+ALTER TABLE scd_subscriptions ADD COLUMN IF NOT EXISTS region INT2 NOT NULL DEFAULT 6;
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS region INT2 NOT NULL DEFAULT 6;
+
+-- /* The face of an S2 cell is held in its 3 most significant bits */
+UPDATE scd_operations SET region = (
+  SELECT IF(count(DISTINCT (c >> 61) & 7) = 1, max((c >> 61) & 7), 6) FROM unnest(cells) AS c
+);
+UPDATE scd_subscriptions SET region = (
+  SELECT IF(count(DISTINCT (c >> 61) & 7) = 1, max((c >> 61) & 7), 6) FROM unnest(cells) AS c
+);
+UPDATE scd_constraints SET region = (
+  SELECT IF(count(DISTINCT (c >> 61) & 7) = 1, max((c >> 61) & 7), 6) FROM unnest(cells) AS c
+);
+
+UPDATE schema_versions set schema_version = 'v3.1.0' WHERE onerow_enforcer = TRUE;
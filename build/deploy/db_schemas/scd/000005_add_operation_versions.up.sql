@@ -0,0 +1,22 @@
+-- /* Keep the version of an operational intent identified by each of its OVNs,
+--    so that the airspace keys provided by USSs can be resolved to the
+--    operational intent versions they reference. Since OVNs derive from an
+--    irreversible hash of updated_at, they cannot be resolved otherwise. */
+CREATE TABLE IF NOT EXISTS scd_operation_versions (
+  ovn STRING PRIMARY KEY,
+  id UUID NOT NULL REFERENCES scd_operations (id) ON DELETE CASCADE,
+  owner STRING NOT NULL,
+  version INT4 NOT NULL DEFAULT 0,
+  url STRING NOT NULL,
+  altitude_lower REAL,
+  altitude_upper REAL,
+  starts_at TIMESTAMPTZ,
+  ends_at TIMESTAMPTZ,
+  subscription_id UUID,
+  updated_at TIMESTAMPTZ NOT NULL,
+  state operational_intent_state NOT NULL DEFAULT 'Unknown',
+  cells INT64[] NOT NULL,
+  INDEX id_idx (id)
+);
+
+UPDATE schema_versions set schema_version = 'v3.2.0' WHERE onerow_enforcer = TRUE;
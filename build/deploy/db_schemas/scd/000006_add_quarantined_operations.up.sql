@@ -0,0 +1,10 @@
+-- /* Operational intents set aside by the integrity checker of the DSS, as
+--    they were when quarantined; see pkg/scd/store/cockroach/integrity.go */
+CREATE TABLE IF NOT EXISTS scd_quarantined_operations (
+  id UUID PRIMARY KEY,
+  quarantined_at TIMESTAMPTZ NOT NULL,
+  violation STRING NOT NULL,
+  operation JSONB NOT NULL
+);
+
+UPDATE schema_versions set schema_version = 'v3.3.0' WHERE onerow_enforcer = TRUE;
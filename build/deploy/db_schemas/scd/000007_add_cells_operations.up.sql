@@ -0,0 +1,15 @@
+-- /* Index operational intents by cell in a dedicated table, as an
+--    alternative to the inverted index of scd_operations.cells selectable
+--    with --scd_spatial_index=cells_table. */
+CREATE TABLE IF NOT EXISTS cells_scd_operations (
+  cell_id INT64 NOT NULL,
+  operation_id UUID NOT NULL REFERENCES scd_operations (id) ON DELETE CASCADE,
+  PRIMARY KEY (cell_id, operation_id),
+  INDEX operation_id_idx (operation_id)
+);
+
+INSERT INTO cells_scd_operations (cell_id, operation_id)
+SELECT unnest(cells), id FROM scd_operations
+ON CONFLICT DO NOTHING;
+
+UPDATE schema_versions set schema_version = 'v3.4.0' WHERE onerow_enforcer = TRUE;
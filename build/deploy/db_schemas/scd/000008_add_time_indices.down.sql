@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS scd_operations@ends_at_starts_at_idx;
+DROP INDEX IF EXISTS scd_constraints@ends_at_starts_at_idx;
+DROP INDEX IF EXISTS scd_subscriptions@ends_at_starts_at_idx;
+UPDATE schema_versions set schema_version = 'v3.4.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,8 @@
+-- /* Index entities by time range, storing their cells, so that searches
+--    pre-filter them by time before comparing their cells instead of
+--    scanning the inverted index of every long-lived entity in the area. */
+CREATE INDEX IF NOT EXISTS ends_at_starts_at_idx ON scd_operations (ends_at, starts_at) STORING (cells);
+CREATE INDEX IF NOT EXISTS ends_at_starts_at_idx ON scd_constraints (ends_at, starts_at) STORING (cells);
+CREATE INDEX IF NOT EXISTS ends_at_starts_at_idx ON scd_subscriptions (ends_at, starts_at) STORING (cells);
+
+UPDATE schema_versions set schema_version = 'v3.5.0' WHERE onerow_enforcer = TRUE;
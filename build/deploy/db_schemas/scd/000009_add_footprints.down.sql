@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS scd_operations@footprint_idx;
+DROP INDEX IF EXISTS scd_constraints@footprint_idx;
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS footprint;
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS footprint;
+UPDATE schema_versions set schema_version = 'v3.5.0' WHERE onerow_enforcer = TRUE;
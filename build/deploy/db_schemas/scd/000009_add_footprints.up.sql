@@ -0,0 +1,9 @@
+-- /* Store the exact footprints of operational intents and constraints as
+--    geographies alongside their cells, so that operational intents may be
+--    looked up with ST_Intersects with --scd_spatial_index=geography. */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS footprint GEOGRAPHY;
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS footprint GEOGRAPHY;
+CREATE INVERTED INDEX IF NOT EXISTS footprint_idx ON scd_operations (footprint);
+CREATE INVERTED INDEX IF NOT EXISTS footprint_idx ON scd_constraints (footprint);
+
+UPDATE schema_versions set schema_version = 'v3.6.0' WHERE onerow_enforcer = TRUE;
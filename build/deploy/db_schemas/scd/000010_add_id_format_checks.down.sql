@@ -0,0 +1,4 @@
+ALTER TABLE scd_operations DROP CONSTRAINT IF EXISTS id_format;
+ALTER TABLE scd_constraints DROP CONSTRAINT IF EXISTS id_format;
+ALTER TABLE scd_subscriptions DROP CONSTRAINT IF EXISTS id_format;
+UPDATE schema_versions set schema_version = 'v3.6.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS type;
+UPDATE schema_versions set schema_version = 'v3.7.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,6 @@
+-- /* Keep the type of constraints (restriction or advisory), by which USSs
+--    prioritize the constraint providers to query; existing constraints are
+--    restrictions. */
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS type STRING NOT NULL DEFAULT 'restriction';
+
+UPDATE schema_versions set schema_version = 'v3.8.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS scd_operation_versions@updated_at_idx;
+DELETE FROM scd_operation_versions WHERE id NOT IN (SELECT id FROM scd_operations);
+ALTER TABLE scd_operation_versions ADD CONSTRAINT fk_id_ref_scd_operations FOREIGN KEY (id) REFERENCES scd_operations (id) ON DELETE CASCADE;
+DROP TABLE IF EXISTS scd_constraint_versions;
+UPDATE schema_versions set schema_version = 'v3.8.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,28 @@
+-- /* Keep the versions of constraints identified by each of their OVNs like
+--    those of operational intents, and keep the versions of both after the
+--    deletion of the entities, for incident investigations. Superseded
+--    versions are purged after --scd_history_retention. */
+CREATE TABLE IF NOT EXISTS scd_constraint_versions (
+  ovn STRING PRIMARY KEY,
+  id UUID NOT NULL,
+  owner STRING NOT NULL,
+  version INT4 NOT NULL DEFAULT 0,
+  url STRING NOT NULL,
+  altitude_lower REAL,
+  altitude_upper REAL,
+  starts_at TIMESTAMPTZ,
+  ends_at TIMESTAMPTZ,
+  cells INT64[] NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  type STRING NOT NULL DEFAULT 'restriction',
+  INDEX id_idx (id),
+  INDEX updated_at_idx (updated_at)
+);
+
+-- The name of the foreign key created along with scd_operation_versions
+-- depends on the version of CockroachDB which created it.
+ALTER TABLE scd_operation_versions DROP CONSTRAINT IF EXISTS fk_id_ref_scd_operations;
+ALTER TABLE scd_operation_versions DROP CONSTRAINT IF EXISTS scd_operation_versions_id_fkey;
+CREATE INDEX IF NOT EXISTS updated_at_idx ON scd_operation_versions (updated_at);
+
+UPDATE schema_versions set schema_version = 'v3.9.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,4 @@
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS ovn;
+ALTER TABLE scd_subscriptions DROP COLUMN IF EXISTS ovn;
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS ovn;
+UPDATE schema_versions set schema_version = 'v3.9.0' WHERE onerow_enforcer = TRUE;
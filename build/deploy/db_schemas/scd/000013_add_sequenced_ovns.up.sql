@@ -0,0 +1,11 @@
+-- /* Keep the OVN of each entity in its own column, generated by the
+--    transaction writing it from the logical timestamp of the cluster, since
+--    OVNs derived from updated_at collide between writes within the same
+--    second and are skewed along with the clocks of the instances. The OVNs
+--    of the rows written before are still derived from updated_at until
+--    their next write. */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS ovn STRING;
+ALTER TABLE scd_subscriptions ADD COLUMN IF NOT EXISTS ovn STRING;
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS ovn STRING;
+
+UPDATE schema_versions set schema_version = 'v3.10.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS scd_operation_volumes;
+ALTER TABLE scd_operation_versions DROP COLUMN IF EXISTS volumes;
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS volumes;
+UPDATE schema_versions set schema_version = 'v3.11.0' WHERE onerow_enforcer = TRUE;
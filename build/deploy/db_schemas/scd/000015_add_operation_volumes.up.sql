@@ -0,0 +1,22 @@
+-- /* Keep the volumes of operational intents as submitted, in the wire
+--    format of their details, rather than only their union. */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS volumes JSONB;
+ALTER TABLE scd_operation_versions ADD COLUMN IF NOT EXISTS volumes JSONB;
+
+-- /* Index every volume of every operational intent, so that searches
+--    select the operational intents one of whose volumes intersects the
+--    area and time searched rather than their union. */
+CREATE TABLE IF NOT EXISTS scd_operation_volumes (
+  operation_id UUID NOT NULL REFERENCES scd_operations (id) ON DELETE CASCADE,
+  volume_index INT4 NOT NULL,
+  off_nominal BOOL NOT NULL,
+  altitude_lower REAL,
+  altitude_upper REAL,
+  starts_at TIMESTAMPTZ,
+  ends_at TIMESTAMPTZ,
+  cells INT64[] NOT NULL,
+  PRIMARY KEY (operation_id, volume_index),
+  INVERTED INDEX cells_idx (cells)
+);
+
+UPDATE schema_versions set schema_version = 'v3.12.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,5 @@
+ALTER TABLE scd_constraint_versions DROP COLUMN IF EXISTS altitude_reference;
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS altitude_reference;
+ALTER TABLE scd_operation_versions DROP COLUMN IF EXISTS altitude_reference;
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS altitude_reference;
+UPDATE schema_versions set schema_version = 'v3.12.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,9 @@
+-- /* Keep the vertical datum the altitudes of operational intents and
+--    constraints were submitted in, before being normalized to WGS84; empty
+--    if they were submitted in WGS84. */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS altitude_reference STRING NOT NULL DEFAULT '';
+ALTER TABLE scd_operation_versions ADD COLUMN IF NOT EXISTS altitude_reference STRING NOT NULL DEFAULT '';
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS altitude_reference STRING NOT NULL DEFAULT '';
+ALTER TABLE scd_constraint_versions ADD COLUMN IF NOT EXISTS altitude_reference STRING NOT NULL DEFAULT '';
+
+UPDATE schema_versions set schema_version = 'v3.13.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scd_expiry_scans;
+UPDATE schema_versions set schema_version = 'v3.13.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,10 @@
+-- /* Progress of the scans for subscriptions about to expire, and lease of the
+--    one instance of the pool scanning at a time; see pkg/scd */
+CREATE TABLE IF NOT EXISTS scd_expiry_scans (
+  onerow_enforcer BOOL PRIMARY KEY DEFAULT TRUE CHECK (onerow_enforcer),
+  scanned_until TIMESTAMPTZ NOT NULL,
+  holder STRING NOT NULL,
+  lease_expires_at TIMESTAMPTZ NOT NULL
+);
+
+UPDATE schema_versions set schema_version = 'v3.14.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,6 @@
+-- /* Tables partitioned by jurisdiction must first be unpartitioned with
+--    the partition subcommand of the db-manager and an empty --jurisdictions */
+ALTER TABLE scd_operations DROP COLUMN IF EXISTS jurisdiction;
+ALTER TABLE scd_subscriptions DROP COLUMN IF EXISTS jurisdiction;
+ALTER TABLE scd_constraints DROP COLUMN IF EXISTS jurisdiction;
+UPDATE schema_versions set schema_version = 'v3.14.0' WHERE onerow_enforcer = TRUE;
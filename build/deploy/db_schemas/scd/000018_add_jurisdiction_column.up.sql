@@ -0,0 +1,7 @@
+-- /* Jurisdiction of entities, which the tables may be partitioned by with the
+--    partition subcommand of the db-manager; see pkg/geo/jurisdiction.go */
+ALTER TABLE scd_operations ADD COLUMN IF NOT EXISTS jurisdiction STRING NOT NULL DEFAULT '';
+ALTER TABLE scd_subscriptions ADD COLUMN IF NOT EXISTS jurisdiction STRING NOT NULL DEFAULT '';
+ALTER TABLE scd_constraints ADD COLUMN IF NOT EXISTS jurisdiction STRING NOT NULL DEFAULT '';
+
+UPDATE schema_versions set schema_version = 'v3.15.0' WHERE onerow_enforcer = TRUE;
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+)
+
+// checkReport is the structured output of the check subcommand.
+type checkReport struct {
+	Database      string                  `json:"database"`
+	TargetVersion string                  `json:"target_version"`
+	Version       string                  `json:"version"`
+	Healthy       bool                    `json:"healthy"`
+	Drift         []cockroach.SchemaDrift `json:"drift"`
+}
+
+// check compares the schema of database with the schema obtained by
+// migrating an empty scratch database to desiredVersion, or to the latest
+// version if nil, using the migrations in schemasDir. It prints a
+// checkReport to stdout and returns an error if the schemas differ, e.g.
+// because of a missing index or of a failed migration.
+func check(schemasDir string, crdbURI string, database string, desiredVersion *semver.Version) error {
+	ctx := context.Background()
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to check schema: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	expected, err := referenceSchema(ctx, crdb, schemasDir, crdbURI, database, desiredVersion)
+	if err != nil {
+		return err
+	}
+	actual, err := crdb.DescribeSchema(ctx, database)
+	if err != nil {
+		return fmt.Errorf("Failed to describe schema: %v", err)
+	}
+
+	report := checkReport{
+		Database:      database,
+		TargetVersion: expected.Version,
+		Version:       actual.Version,
+		Drift:         cockroach.DiffSchemas(expected, actual),
+	}
+	if report.Drift == nil {
+		report.Drift = []cockroach.SchemaDrift{}
+	}
+	report.Healthy = len(report.Drift) == 0
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("Failed to encode check report: %v", err)
+	}
+	if !report.Healthy {
+		return fmt.Errorf("Schema of %s drifted from version %s in %d way(s)", database, expected.Version, len(report.Drift))
+	}
+	log.Printf("Schema of %s matches version %s", database, expected.Version)
+	return nil
+}
+
+// referenceSchema returns the description of the schema of database at
+// desiredVersion, or at the latest version if nil, as created by the
+// migrations in schemasDir in a scratch database dropped afterwards.
+func referenceSchema(ctx context.Context, crdb *cockroach.DB, schemasDir string, crdbURI string, database string, desiredVersion *semver.Version) (*cockroach.SchemaDescription, error) {
+	scratch := fmt.Sprintf("%s_check_%d", database, time.Now().Unix())
+	scratchURI := strings.Replace(crdbURI, fmt.Sprintf("/%s", database), fmt.Sprintf("/%s", scratch), 1)
+	defer func() {
+		if _, err := crdb.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", scratch)); err != nil {
+			log.Printf("Failed to drop scratch database %s: %v", scratch, err)
+		}
+	}()
+
+	migrater, err := New(schemasDir, scratchURI, scratch)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create scratch database %s: %v", scratch, err)
+	}
+	if desiredVersion == nil {
+		err = migrater.Up()
+	} else {
+		err = migrater.DoMigrate(*desiredVersion, 0)
+	}
+	if _, closeErr := migrater.Close(); closeErr != nil {
+		log.Println(closeErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to migrate scratch database %s: %v", scratch, err)
+	}
+
+	expected, err := crdb.DescribeSchema(ctx, scratch)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to describe the schema of scratch database %s: %v", scratch, err)
+	}
+	return expected, nil
+}
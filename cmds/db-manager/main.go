@@ -4,8 +4,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math"
 	"os"
@@ -13,17 +15,54 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
+	"github.com/golang-jwt/jwt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/interuss/dss/pkg/cockroach"
 	"github.com/interuss/dss/pkg/cockroach/flags"
+	"github.com/interuss/dss/pkg/journal"
 	"go.uber.org/zap"
 
 	_ "github.com/golang-migrate/migrate/v4/database/cockroachdb" // Force registration of cockroachdb backend
 	_ "github.com/golang-migrate/migrate/v4/source/file"          // Force registration of file source
 )
 
+// secretDir holds the TLS material fetched by schemaManagerParameters, if
+// any.
+var secretDir string
+
+// schemaManagerParameters returns the parameters connecting to the database
+// of schemas_dir, with the secret of the credentials provider set through
+// flags, if any, fetched once.
+func schemaManagerParameters() cockroach.ConnectParameters {
+	params := flags.ConnectParameters()
+	params.ApplicationName = "SchemaManager"
+	params.DBName = filepath.Base(*path)
+
+	provider, err := flags.CredentialsProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if provider == nil {
+		return params
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	secret, err := provider.Secret(ctx)
+	if err != nil {
+		log.Fatalf("Failed to fetch crdb secret: %v", err)
+	}
+	if secretDir, err = ioutil.TempDir("", "crdb-secret-"); err != nil {
+		log.Fatal(err)
+	}
+	if params, err = cockroach.ApplySecret(params, secret, secretDir); err != nil {
+		log.Fatal(err)
+	}
+	return params
+}
+
 // MyMigrate is an alias for extending migrate.Migrate
 type MyMigrate struct {
 	*migrate.Migrate
@@ -44,9 +83,33 @@ func (d Direction) String() string {
 }
 
 var (
-	path      = flag.String("schemas_dir", "", "path to db migration files directory. the migrations found there will be applied to the database whose name matches the folder name.")
+	path      = flag.String("schemas_dir", "", "path to db migration files directory. the migrations found there will be applied to the database whose name matches the folder name, prefixed by cockroach_db_name_prefix if set.")
 	dbVersion = flag.String("db_version", "", "the db version to migrate to (ex: 1.0.0) or use \"latest\" to automatically upgrade to the latest version")
 	step      = flag.Int("migration_step", 0, "the db migration step to go to")
+
+	describeSchema = flag.Bool("describe_schema", false, "instead of migrating, print a JSON description of the schema of the database identified by schemas_dir (tables, columns, indexes, constraints and version)")
+	compareSchema  = flag.String("compare_schema", "", "with describe_schema, path to a JSON schema description (e.g. produced by describe_schema against another DSS instance) to compare the database schema with; exits with an error if they differ")
+
+	journalPublicKeyFile = flag.String("journal_public_key_file", "", "with the verify-journal subcommand, path to the PEM-encoded public key of the key signing the request journal")
+
+	repairBatchSize = flag.Int("repair_batch_size", 500, "with the repair subcommand, the number of rows scanned, and repaired in a single transaction, at once")
+	repairDryRun    = flag.Bool("repair_dry_run", false, "with the repair subcommand, only reports the rows needing repair")
+	quarantineFile  = flag.String("quarantine_file", "", "with the repair subcommand, path to the file the rows that cannot be fixed are moved to, as a dump importable with the import subcommand once fixed; required unless repair_dry_run")
+
+	shardBuckets = flag.Int("shard_buckets", 8, "with the shard subcommand, the number of buckets the primary keys of the entity tables are hash-sharded in, or 0 to restore plain primary keys")
+
+	jurisdictions           = flag.String("jurisdictions", "", "with the partition subcommand, the jurisdictions the entity tables are partitioned by, as the --jurisdictions of the grpc-backend, or empty to unpartition them")
+	jurisdictionConstraints = flag.String("jurisdiction_constraints", "", "with the partition subcommand, the semicolon-separated replica constraints of the partition of each jurisdiction, a name followed by a colon and comma-separated constraints (e.g. eu:+region=europe-west1)")
+
+	force = flag.Bool("force", false, "migrates or imports even if the database is in a dirty migration state or its schema is newer than the latest version of schemas_dir, as after a partial upgrade")
+
+	// entityTables lists the tables exported and imported by the export and
+	// import subcommands, by database, in an order satisfying their foreign
+	// keys.
+	entityTables = map[string][]string{
+		"defaultdb": {"identification_service_areas", "subscriptions"},
+		"scd":       {"scd_subscriptions", "scd_operations", "scd_constraints"},
+	}
 )
 
 func main() {
@@ -54,6 +117,131 @@ func main() {
 	if *path == "" {
 		log.Panic("Must specify schemas_dir path")
 	}
+	defer func() {
+		if secretDir != "" {
+			_ = os.RemoveAll(secretDir)
+		}
+	}()
+	if *describeSchema {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), false); err != nil {
+			log.Fatal(err)
+		}
+		if err := describe(postgresURI, params.QualifiedDBName(), *compareSchema); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if command := flag.Arg(0); command == "export" || command == "import" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		tables, ok := entityTables[params.DBName]
+		if !ok {
+			log.Fatalf("No entity tables known for database %s", params.DBName)
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), command == "import"); err != nil {
+			log.Fatal(err)
+		}
+		if err := dump(command, postgresURI, params.QualifiedDBName(), tables, flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "check" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		var target *semver.Version
+		if *dbVersion != "" && strings.ToLower(*dbVersion) != "latest" {
+			if target, err = semver.NewVersion(*dbVersion); err != nil {
+				log.Panic("db_version must be in a valid format ex: 1.2.3", err)
+			}
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), false); err != nil {
+			log.Fatal(err)
+		}
+		if err := check(*path, postgresURI, params.QualifiedDBName(), target); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "repair" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		tables, ok := entityTables[params.DBName]
+		if !ok {
+			log.Fatalf("No entity tables known for database %s", params.DBName)
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), !*repairDryRun); err != nil {
+			log.Fatal(err)
+		}
+		if err := repair(postgresURI, params.QualifiedDBName(), tables); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "shard" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		tables, ok := entityTables[params.DBName]
+		if !ok {
+			log.Fatalf("No entity tables known for database %s", params.DBName)
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), true); err != nil {
+			log.Fatal(err)
+		}
+		if err := shard(postgresURI, params.QualifiedDBName(), tables); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "partition" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		tables, ok := entityTables[params.DBName]
+		if !ok {
+			log.Fatalf("No entity tables known for database %s", params.DBName)
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), true); err != nil {
+			log.Fatal(err)
+		}
+		if err := partition(postgresURI, params.QualifiedDBName(), tables); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "verify-journal" {
+		params := schemaManagerParameters()
+		postgresURI, err := params.BuildURI()
+		if err != nil {
+			log.Panic("Failed to build URI", zap.Error(err))
+		}
+		if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), false); err != nil {
+			log.Fatal(err)
+		}
+		if err := verifyJournal(postgresURI, *journalPublicKeyFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if (*dbVersion == "" && *step == 0) || (*dbVersion != "" && *step != 0) {
 		log.Panic("Must specify one of [db_version, migration_step] to goto, use --help to see options")
 	}
@@ -71,14 +259,12 @@ func main() {
 		}
 	}
 
-	params := flags.ConnectParameters()
-	params.ApplicationName = "SchemaManager"
-	params.DBName = filepath.Base(*path)
+	params := schemaManagerParameters()
 	postgresURI, err := params.BuildURI()
 	if err != nil {
 		log.Panic("Failed to build URI", zap.Error(err))
 	}
-	myMigrater, err := New(*path, postgresURI, params.DBName)
+	myMigrater, err := New(*path, postgresURI, params.QualifiedDBName())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -87,10 +273,19 @@ func main() {
 			log.Println(err)
 		}
 	}()
-	preMigrationStep, _, err := myMigrater.Version()
+	preMigrationStep, preMigrationDirty, err := myMigrater.Version()
 	if err != migrate.ErrNilVersion && err != nil {
 		log.Panic(err)
 	}
+	if preMigrationDirty {
+		if !*force {
+			log.Fatalf("DB in dirty state at migration step %d, as after a failed or partial migration; fix it before migrating, or override with --force", preMigrationStep)
+		}
+		log.Printf("Migrating DB in dirty state at migration step %d with --force", preMigrationStep)
+	}
+	if err := checkSchemaVersion(postgresURI, params.QualifiedDBName(), true); err != nil {
+		log.Fatal(err)
+	}
 	if latest {
 		if err := myMigrater.Up(); err != nil {
 			log.Panic(err)
@@ -111,13 +306,41 @@ func main() {
 		log.Printf("Moved %d step(s) in total from Step %d to Step %d", intAbs(totalMoves), preMigrationStep, postMigrationStep)
 	}
 
-	currentDBVersion, err := getCurrentDBVersion(postgresURI, params.DBName)
+	currentDBVersion, err := getCurrentDBVersion(postgresURI, params.QualifiedDBName())
 	if err != nil {
 		log.Fatal("Failed to get Current DB version for confirmation")
 	}
 	log.Printf("DB Version: %s, Migration Step # %d, Dirty: %v", currentDBVersion, postMigrationStep, dirty)
 }
 
+// checkSchemaVersion returns an error if the schema of database is newer
+// than the latest version of the migrations in schemas_dir, which this
+// binary was presumably released with, and writes, i.e. migrating or
+// importing, are intended, unless --force is set. Reading such a schema is
+// only warned about.
+func checkSchemaVersion(crdbURI string, database string, writes bool) error {
+	latest, err := cockroach.LatestSchemaVersion(*path)
+	if err != nil {
+		return err
+	}
+	current, err := getCurrentDBVersion(crdbURI, database)
+	if err != nil {
+		return fmt.Errorf("Failed to get current DB version: %v", err)
+	}
+	if !latest.LessThan(*current) {
+		return nil
+	}
+	switch {
+	case !writes:
+		log.Printf("Warning: schema version %s of %s is newer than %s, the latest of %s; reading it regardless", current, database, latest, *path)
+	case *force:
+		log.Printf("Warning: schema version %s of %s is newer than %s, the latest of %s; writing it with --force", current, database, latest, *path)
+	default:
+		return fmt.Errorf("Schema version %s of %s is newer than %s, the latest of %s, as after a partial upgrade; upgrade db-manager and its schemas, or override with --force", current, database, latest, *path)
+	}
+	return nil
+}
+
 // DoMigrate performs the migration given the desired state we want to reach
 func (m *MyMigrate) DoMigrate(desiredDBVersion semver.Version, desiredStep int) error {
 	migrateDirection, err := m.MigrationDirection(desiredDBVersion, desiredStep)
@@ -170,7 +393,7 @@ func intAbs(x int) int {
 }
 
 func createDatabaseIfNotExists(crdbURI string, database string) error {
-	crdb, err := cockroach.Dial(crdbURI)
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
 	if err != nil {
 		return fmt.Errorf("Failed to dial CRDB to check DB exists: %v", err)
 	}
@@ -203,7 +426,7 @@ func createDatabaseIfNotExists(crdbURI string, database string) error {
 }
 
 func getCurrentDBVersion(crdbURI string, database string) (*semver.Version, error) {
-	crdb, err := cockroach.Dial(crdbURI)
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to dial CRDB while getting DB version: %v", err)
 	}
@@ -214,6 +437,132 @@ func getCurrentDBVersion(crdbURI string, database string) (*semver.Version, erro
 	return crdb.GetVersion(context.Background(), database)
 }
 
+// describe prints the description of the schema of database to stdout and,
+// if comparePath is not empty, fails if it differs from the description
+// stored in comparePath.
+func describe(crdbURI string, database string, comparePath string) error {
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB while describing schema: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	schema, err := crdb.DescribeSchema(context.Background(), database)
+	if err != nil {
+		return fmt.Errorf("Failed to describe schema: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(schema); err != nil {
+		return fmt.Errorf("Failed to encode schema description: %v", err)
+	}
+
+	if comparePath == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(comparePath)
+	if err != nil {
+		return fmt.Errorf("Failed to read schema description to compare with: %v", err)
+	}
+	other := &cockroach.SchemaDescription{}
+	if err := json.Unmarshal(content, other); err != nil {
+		return fmt.Errorf("Failed to parse schema description to compare with: %v", err)
+	}
+	differences := cockroach.CompareSchemas(schema, other)
+	for _, difference := range differences {
+		log.Println(difference)
+	}
+	if len(differences) > 0 {
+		return fmt.Errorf("Schema differs from %s in %d way(s)", comparePath, len(differences))
+	}
+	log.Printf("Schema is identical to %s", comparePath)
+	return nil
+}
+
+// verifyJournal checks that the request journal of the database at crdbURI
+// is unbroken and signed with the private key of the public key at keyPath,
+// printing the number of entries of each chain.
+func verifyJournal(crdbURI string, keyPath string) error {
+	if keyPath == "" {
+		return fmt.Errorf("Must specify journal_public_key_file to verify the request journal")
+	}
+	bytes, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read journal public key: %v", err)
+	}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(bytes)
+	if err != nil {
+		return fmt.Errorf("Failed to parse journal public key: %v", err)
+	}
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to verify the request journal: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	verifier := &journal.Verifier{Key: key}
+	if err := journal.Scan(context.Background(), crdb, verifier.Check); err != nil {
+		return fmt.Errorf("Request journal is broken: %v", err)
+	}
+	for chain, last := range verifier.Last {
+		log.Printf("Chain %s: %d entries verified", chain, last.Seq)
+	}
+	log.Printf("Request journal verified (%d chain(s))", len(verifier.Last))
+	return nil
+}
+
+// dump exports the entity tables of database to the JSONL file at
+// dumpPath, or imports them from it, according to command. Standard output
+// or input is used if dumpPath is empty.
+func dump(command string, crdbURI string, database string, tables []string, dumpPath string) error {
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to %s entities: %v", command, err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	ctx := context.Background()
+	if command == "export" {
+		w := os.Stdout
+		if dumpPath != "" {
+			f, err := os.Create(dumpPath)
+			if err != nil {
+				return fmt.Errorf("Failed to create dump file: %v", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		count, err := crdb.Export(ctx, database, tables, w)
+		if err != nil {
+			return fmt.Errorf("Failed to export entities after %d row(s): %v", count, err)
+		}
+		log.Printf("Exported %d row(s) from %s", count, database)
+		return nil
+	}
+
+	r := os.Stdin
+	if dumpPath != "" {
+		f, err := os.Open(dumpPath)
+		if err != nil {
+			return fmt.Errorf("Failed to open dump file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	count, err := crdb.Import(ctx, database, tables, r)
+	if err != nil {
+		return fmt.Errorf("Failed to import entities after %d row(s): %v", count, err)
+	}
+	log.Printf("Imported %d row(s) into %s", count, database)
+	return nil
+}
+
 // MigrationDirection reads our custom DB version string as well as the Migration Steps from the framework
 // and returns a signed integer value of the Direction and count to migrate the db
 func (m *MyMigrate) MigrationDirection(desiredVersion semver.Version, desiredStep int) (Direction, error) {
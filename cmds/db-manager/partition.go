@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/dss/pkg/geo"
+)
+
+// partition partitions the entity tables of database by the jurisdictions
+// of --jurisdictions, pinned to the nodes of --jurisdiction_constraints, or
+// unpartitions them if none, and prints the progress of each table to
+// stdout as JSON once done.
+func partition(crdbURI string, database string, tables []string) error {
+	js, err := geo.ParseJurisdictions(*jurisdictions)
+	if err != nil {
+		return fmt.Errorf("Invalid jurisdictions: %v", err)
+	}
+	constraints, err := cockroach.ParseZoneConstraints(*jurisdictionConstraints)
+	if err != nil {
+		return fmt.Errorf("Invalid jurisdiction_constraints: %v", err)
+	}
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to partition entities: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	results, err := crdb.PartitionByJurisdiction(context.Background(), database, tables, cockroach.PartitionOptions{
+		Jurisdictions: js,
+		Constraints:   constraints,
+		Progress: func(p cockroach.PartitionProgress) {
+			log.Printf("%s: %d row(s) scanned, %d relabelled", p.Table, p.Scanned, p.Relabelled)
+		},
+	})
+	if results == nil {
+		results = []cockroach.PartitionProgress{}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(results); encodeErr != nil {
+		log.Println(encodeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to partition entities: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/interuss/dss/pkg/cockroach"
+)
+
+// repair scans the entity tables of database for rows with a NULL
+// updated_at, empty cells or invalid cells, fixing them or moving them to
+// --quarantine_file, unless --repair_dry_run, and prints the progress of
+// each table to stdout as JSON once done.
+func repair(crdbURI string, database string, tables []string) error {
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to repair entities: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	opts := cockroach.RepairOptions{
+		BatchSize: *repairBatchSize,
+		DryRun:    *repairDryRun,
+		Progress: func(p cockroach.RepairProgress) {
+			log.Printf("%s: %d row(s) scanned, %s; %d fixed, %d quarantined, %d skipped",
+				p.Table, p.Scanned, describeIssues(p.Issues), p.Fixed, p.Quarantined, p.Skipped)
+		},
+	}
+	if !*repairDryRun {
+		if *quarantineFile == "" {
+			return fmt.Errorf("Must specify quarantine_file to repair entities, or repair_dry_run")
+		}
+		f, err := os.OpenFile(*quarantineFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to create quarantine file: %v", err)
+		}
+		defer f.Close()
+		opts.Quarantine = f
+	}
+
+	results, err := crdb.Repair(context.Background(), database, tables, opts)
+	if encodeErr := encodeRepairResults(os.Stdout, results); encodeErr != nil {
+		log.Println(encodeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to repair entities: %v", err)
+	}
+	quarantined := 0
+	for _, p := range results {
+		quarantined += p.Quarantined
+	}
+	if quarantined > 0 {
+		log.Printf("Moved %d row(s) that could not be fixed to %s", quarantined, *quarantineFile)
+	}
+	return nil
+}
+
+func encodeRepairResults(w io.Writer, results []cockroach.RepairProgress) error {
+	if results == nil {
+		results = []cockroach.RepairProgress{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return fmt.Errorf("Failed to encode repair results: %v", err)
+	}
+	return nil
+}
+
+// describeIssues formats the counts of issues for the progress log.
+func describeIssues(issues map[string]int) string {
+	if len(issues) == 0 {
+		return "no issue"
+	}
+	names := make([]string, 0, len(issues))
+	for name := range issues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d %s", issues[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
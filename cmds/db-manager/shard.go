@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/interuss/dss/pkg/cockroach"
+)
+
+// shard alters the primary keys of the entity tables of database to be
+// hash-sharded in --shard_buckets buckets, or plain if 0, logging the tables
+// altered.
+func shard(crdbURI string, database string, tables []string) error {
+	crdb, err := cockroach.Dial(crdbURI, cockroach.PoolParameters{})
+	if err != nil {
+		return fmt.Errorf("Failed to dial CRDB to shard primary keys: %v", err)
+	}
+	defer func() {
+		crdb.Close()
+	}()
+
+	for _, table := range tables {
+		altered, err := crdb.ShardPrimaryKey(context.Background(), database, table, *shardBuckets)
+		if err != nil {
+			return fmt.Errorf("Failed to shard primary key of %s: %v", table, err)
+		}
+		if altered {
+			log.Printf("%s: primary key altered to %d shard bucket(s)", table, *shardBuckets)
+		} else {
+			log.Printf("%s: primary key already has %d shard bucket(s)", table, *shardBuckets)
+		}
+	}
+	return nil
+}
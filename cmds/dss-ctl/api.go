@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+)
+
+// apiClient is a client reading and deleting the entities through the API
+// of a DSS instance, subject to its authorization and checks.
+type apiClient struct {
+	baseURL string
+	token   string
+	// http sends the requests; http.DefaultClient if nil.
+	http *http.Client
+}
+
+func (c *apiClient) Close() error {
+	return nil
+}
+
+// call sends a request with body, if not nil, encoded as JSON to path and
+// decodes the response into an entity, or returns nil if the API found
+// nothing.
+func (c *apiClient) call(ctx context.Context, method, path string, body interface{}) (entity, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	client := c.http
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response of %s %s: %v", method, path, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, respBody)
+	}
+	e := entity{}
+	if err := json.Unmarshal(respBody, &e); err != nil {
+		return nil, fmt.Errorf("Failed to decode response of %s %s: %v", method, path, err)
+	}
+	return e, nil
+}
+
+func (c *apiClient) get(ctx context.Context, k *kind, id string) (entity, error) {
+	resp, err := c.call(ctx, http.MethodGet, k.path+"/"+url.PathEscape(id), nil)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	e, ok := resp[k.single].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Missing %s in response", k.single)
+	}
+	return e, nil
+}
+
+func (c *apiClient) search(ctx context.Context, k *kind, q *query) ([]entity, error) {
+	var (
+		resp entity
+		err  error
+	)
+	if k.scd {
+		vertices := make([]map[string]float64, len(q.vertices))
+		for i, vertex := range q.vertices {
+			vertices[i] = map[string]float64{"lat": vertex.Lat.Degrees(), "lng": vertex.Lng.Degrees()}
+		}
+		volume := map[string]interface{}{
+			"volume": map[string]interface{}{"outline_polygon": map[string]interface{}{"vertices": vertices}},
+		}
+		if q.start != nil {
+			volume["time_start"] = map[string]string{"value": dssmodels.FormatTime(*q.start), "format": dssmodels.TimeFormatRFC3339}
+		}
+		if q.end != nil {
+			volume["time_end"] = map[string]string{"value": dssmodels.FormatTime(*q.end), "format": dssmodels.TimeFormatRFC3339}
+		}
+		resp, err = c.call(ctx, http.MethodPost, k.path+"/query", map[string]interface{}{"area_of_interest": volume})
+	} else {
+		params := url.Values{"area": {q.area}}
+		if k.name == "isa" {
+			if q.start != nil {
+				params.Set("earliest_time", dssmodels.FormatTime(*q.start))
+			}
+			if q.end != nil {
+				params.Set("latest_time", dssmodels.FormatTime(*q.end))
+			}
+		}
+		resp, err = c.call(ctx, http.MethodGet, k.path+"?"+params.Encode(), nil)
+	}
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	items, _ := resp[k.plural].([]interface{})
+	entities := make([]entity, 0, len(items))
+	for _, item := range items {
+		if e, ok := item.(map[string]interface{}); ok {
+			entities = append(entities, e)
+		}
+	}
+	return entities, nil
+}
+
+func (c *apiClient) delete(ctx context.Context, k *kind, id string) (entity, error) {
+	e, err := c.get(ctx, k, id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, fmt.Errorf("No %s %s", k.name, id)
+	}
+	version, _ := e[k.version].(string)
+	resp, err := c.call(ctx, http.MethodDelete, k.path+"/"+url.PathEscape(id)+"/"+url.PathEscape(version), nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("No %s %s", k.name, id)
+	}
+	if deleted, ok := resp[k.single].(map[string]interface{}); ok {
+		return deleted, nil
+	}
+	return e, nil
+}
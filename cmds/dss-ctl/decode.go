@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+)
+
+const earthRadiusKm = 6371.01
+
+// decode runs the decode command with args.
+func decode(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Expected ovn, version or cells to decode")
+	}
+	switch args[0] {
+	case "ovn":
+		if len(args) != 3 {
+			return errors.New("Expected the ID of the entity and the OVN to decode")
+		}
+		return decodeOVN(args[1], scdmodels.OVN(args[2]))
+	case "version":
+		if len(args) != 2 {
+			return errors.New("Expected the version to decode")
+		}
+		v, err := dssmodels.VersionFromString(args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid version %s: %v", args[1], err)
+		}
+		return printTime("written", *v.ToTimestamp())
+	case "cells":
+		cells, err := parseCells(strings.Join(args[1:], ","))
+		if err != nil {
+			return err
+		}
+		return printCells(cells)
+	}
+	return fmt.Errorf("Cannot decode %s", args[0])
+}
+
+// decodeOVN prints when ovn, an OVN of the entity id, was written, provided
+// that it was within --window of --around. Only the OVNs written before
+// schema 3.10.0 of the SCD database encode their time.
+func decodeOVN(id string, ovn scdmodels.OVN) error {
+	t := time.Now()
+	if *around != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, *around); err != nil {
+			return fmt.Errorf("Invalid --around: %v", err)
+		}
+	}
+	written, ok := scdmodels.TimeOfOVN(ovn, id, t.Add(-*window), t.Add(*window))
+	if !ok {
+		return fmt.Errorf("OVN %s was not written for %s within %s of %s", ovn, id, *window, dssmodels.FormatTime(t))
+	}
+	return printTime("written", written)
+}
+
+func printTime(name string, t time.Time) error {
+	if *output == "json" {
+		return json.NewEncoder(os.Stdout).Encode(map[string]string{name: dssmodels.FormatTime(t)})
+	}
+	fmt.Printf("%s %s (%s ago)\n", name, dssmodels.FormatTime(t), time.Since(t).Round(time.Second))
+	return nil
+}
+
+// parseCells parses s, S2 cells as tokens or decimal IDs separated by
+// commas or spaces.
+func parseCells(s string) (s2.CellUnion, error) {
+	var cells s2.CellUnion
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		cell := s2.CellIDFromToken(field)
+		// Tokens have at most 16 hexadecimal digits, decimal IDs of cells of
+		// the levels of the DSS more. The databases store IDs as signed
+		// integers.
+		if len(strings.TrimPrefix(field, "-")) > 16 {
+			if n, err := strconv.ParseUint(field, 10, 64); err == nil {
+				cell = s2.CellID(n)
+			} else if n, err := strconv.ParseInt(field, 10, 64); err == nil {
+				cell = s2.CellID(uint64(n))
+			}
+		}
+		if !cell.IsValid() {
+			return nil, fmt.Errorf("Invalid cell %s", field)
+		}
+		cells = append(cells, cell)
+	}
+	if len(cells) == 0 {
+		return nil, errors.New("Expected cells to decode")
+	}
+	return cells, nil
+}
+
+// cellDescription describes an S2 cell.
+type cellDescription struct {
+	Token   string  `json:"token"`
+	ID      int64   `json:"id"`
+	Level   int     `json:"level"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+	AreaKm2 float64 `json:"area_km2"`
+}
+
+// printCells describes cells, their bounds and the region they cover.
+func printCells(cells s2.CellUnion) error {
+	var (
+		descriptions = make([]cellDescription, len(cells))
+		bounds       = s2.EmptyRect()
+		total        float64
+	)
+	for i, id := range cells {
+		cell := s2.CellFromCellID(id)
+		center := id.LatLng()
+		descriptions[i] = cellDescription{
+			Token:   id.ToToken(),
+			ID:      int64(id),
+			Level:   id.Level(),
+			Lat:     center.Lat.Degrees(),
+			Lng:     center.Lng.Degrees(),
+			AreaKm2: cell.ApproxArea() * earthRadiusKm * earthRadiusKm,
+		}
+		total += descriptions[i].AreaKm2
+		bounds = bounds.Union(cell.RectBound())
+	}
+	lo, hi := bounds.Lo(), bounds.Hi()
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{
+			"cells":    descriptions,
+			"area_km2": total,
+			// GeoJSON bounding box: west, south, east, north.
+			"bbox":   []float64{lo.Lng.Degrees(), lo.Lat.Degrees(), hi.Lng.Degrees(), hi.Lat.Degrees()},
+			"region": geo.CellsMultiPolygon(cells),
+		})
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOKEN\tID\tLEVEL\tCENTER\tAREA_KM2")
+	for _, d := range descriptions {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.6f,%.6f\t%.4f\n", d.Token, d.ID, d.Level, d.Lat, d.Lng, d.AreaKm2)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d cells covering %.4f km² within %.6f,%.6f (south-west) and %.6f,%.6f (north-east)\n",
+		len(cells), total, lo.Lat.Degrees(), lo.Lng.Degrees(), hi.Lat.Degrees(), hi.Lng.Degrees())
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/geo/s2"
+)
+
+// entity is the JSON representation of an entity in the API.
+type entity map[string]interface{}
+
+// kind describes a kind of entity of the DSS.
+type kind struct {
+	name string
+	// scd is true for the strategic conflict detection entities, false for
+	// the remote ID ones.
+	scd bool
+	// path is the API path of the entities.
+	path string
+	// single and plural are the fields of the API responses holding one or
+	// several entities.
+	single, plural string
+	// version is the field of the entities whose value the API requires to
+	// delete them.
+	version string
+	// columns are the fields of the entities printed as tables.
+	columns []string
+}
+
+var kinds = map[string]*kind{
+	"isa": {
+		name:    "isa",
+		path:    "/v1/dss/identification_service_areas",
+		single:  "service_area",
+		plural:  "service_areas",
+		version: "version",
+		columns: []string{"id", "owner", "version", "time_start", "time_end", "flights_url"},
+	},
+	"rid_subscription": {
+		name:    "rid_subscription",
+		path:    "/v1/dss/subscriptions",
+		single:  "subscription",
+		plural:  "subscriptions",
+		version: "version",
+		columns: []string{"id", "owner", "version", "notification_index", "time_start", "time_end"},
+	},
+	"operational_intent": {
+		name:    "operational_intent",
+		scd:     true,
+		path:    "/dss/v1/operational_intent_references",
+		single:  "operational_intent_reference",
+		plural:  "operational_intent_references",
+		version: "ovn",
+		columns: []string{"id", "manager", "version", "ovn", "state", "time_start", "time_end", "uss_base_url"},
+	},
+	"constraint": {
+		name:    "constraint",
+		scd:     true,
+		path:    "/dss/v1/constraint_references",
+		single:  "constraint_reference",
+		plural:  "constraint_references",
+		version: "ovn",
+		columns: []string{"id", "manager", "version", "ovn", "time_start", "time_end", "uss_base_url"},
+	},
+	"scd_subscription": {
+		name:    "scd_subscription",
+		scd:     true,
+		path:    "/dss/v1/subscriptions",
+		single:  "subscription",
+		plural:  "subscriptions",
+		version: "version",
+		columns: []string{"id", "version", "notification_index", "implicit_subscription", "time_start", "time_end", "uss_base_url"},
+	},
+}
+
+// entityOf returns the entity of m, a model encoded in the wire format of the
+// APIs, with the tokens of its cells if known.
+func entityOf(m json.Marshaler, cells s2.CellUnion) (entity, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode entity: %v", err)
+	}
+	e := entity{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("Failed to decode entity: %v", err)
+	}
+	if cells != nil {
+		tokens := make([]interface{}, len(cells))
+		for i, cell := range cells {
+			tokens[i] = cell.ToToken()
+		}
+		e["cells"] = tokens
+	}
+	return e, nil
+}
+
+// printEntities prints entities of kind k to w as a table, or as JSON: an
+// array if list, the single entity otherwise.
+func printEntities(w io.Writer, k *kind, entities []entity, list bool) error {
+	if *output == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if list {
+			if entities == nil {
+				entities = []entity{}
+			}
+			return encoder.Encode(entities)
+		}
+		return encoder.Encode(entities[0])
+	}
+
+	columns := k.columns
+	if len(entities) > 0 {
+		if _, ok := entities[0]["cells"]; ok {
+			columns = append(columns[:len(columns):len(columns)], "cells")
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, e := range entities {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = cellValue(e[column])
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// cellValue formats v, a JSON value, as a cell of a table.
+func cellValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		return fmt.Sprintf("%d", len(v))
+	case map[string]interface{}:
+		// Times of the strategic conflict detection API.
+		if value, ok := v["value"]; ok {
+			return cellValue(value)
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ",") + "}"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,206 @@
+// dss-ctl inspects and deletes the entities of a DSS instance, either
+// directly in its CockroachDB databases or through its API, and decodes
+// their versions and cells, for on-call debugging.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+)
+
+const usage = `Usage: dss-ctl [flags] <command> [arguments]
+
+Commands:
+  get <kind> <id>           prints an entity
+  search <kind>             prints the entities intersecting --area between --start and --end
+  delete <kind> <id>        deletes an entity, confirmed with --yes
+  decode ovn <id> <ovn>     prints when an OVN of the strategic conflict detection entity id was written
+  decode version <version>  prints when a version of a remote ID entity was written
+  decode cells <cells>      describes the region covered by S2 cells, as tokens or IDs separated by commas
+
+Kinds: isa, rid_subscription, operational_intent, constraint, scd_subscription
+
+Flags:
+`
+
+var (
+	apiURL    = flag.String("api_url", "", "base URL of the DSS API (e.g., https://dss.example.com) to go through instead of the databases reached with the cockroach_* flags")
+	tokenFile = flag.String("token_file", "", "with api_url, path to a file holding the access token to call the API with; read from the DSS_TOKEN environment variable if empty")
+	output    = flag.String("output", "table", "output format: table or json")
+	timeout   = flag.Duration("timeout", 30*time.Second, "how long a command may take")
+
+	area  = flag.String("area", "", "with search, the polygon to search as lat,lng,lat,lng,... like the area parameter of the remote ID API")
+	start = flag.String("start", "", "with search, the RFC3339 start of the time range to search; unbounded if empty")
+	end   = flag.String("end", "", "with search, the RFC3339 end of the time range to search; unbounded if empty")
+
+	yes = flag.Bool("yes", false, "with delete, confirms the deletion; deleting through the databases neither notifies subscribers nor removes implicit subscriptions")
+
+	around = flag.String("around", "", "with decode ovn, the RFC3339 time around which the OVN was written; now if empty")
+	window = flag.Duration("window", 30*24*time.Hour, "with decode ovn, how long before and after around the OVN is looked for")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *output != "table" && *output != "json" {
+		log.Fatalf("Invalid output %s; expected table or json", *output)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := run(ctx, flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return errors.New("Missing command")
+	}
+	command, args := args[0], args[1:]
+	if command == "decode" {
+		return decode(args)
+	}
+	if command != "get" && command != "search" && command != "delete" {
+		return fmt.Errorf("Unknown command %s", command)
+	}
+	if len(args) == 0 {
+		return errors.New("Missing kind")
+	}
+	k, ok := kinds[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown kind %s", args[0])
+	}
+	args = args[1:]
+	if command != "search" && len(args) != 1 {
+		return fmt.Errorf("Expected the ID of the %s to %s", k.name, command)
+	}
+
+	c, err := newClient(ctx, k)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	switch command {
+	case "get":
+		e, err := c.get(ctx, k, args[0])
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return fmt.Errorf("No %s %s", k.name, args[0])
+		}
+		return printEntities(os.Stdout, k, []entity{e}, false)
+
+	case "search":
+		q, err := parseQuery()
+		if err != nil {
+			return err
+		}
+		entities, err := c.search(ctx, k, q)
+		if err != nil {
+			return err
+		}
+		return printEntities(os.Stdout, k, entities, true)
+
+	default:
+		if !*yes {
+			return fmt.Errorf("Deleting %s %s requires --yes", k.name, args[0])
+		}
+		e, err := c.delete(ctx, k, args[0])
+		if err != nil {
+			return err
+		}
+		log.Printf("Deleted %s %s", k.name, args[0])
+		return printEntities(os.Stdout, k, []entity{e}, false)
+	}
+}
+
+// query is the volume searched by the search command.
+type query struct {
+	// area is the polygon of --area, as passed to the remote ID API.
+	area  string
+	cells s2.CellUnion
+	// vertices are the vertices of area, as passed to the strategic
+	// conflict detection API.
+	vertices   []s2.LatLng
+	start, end *time.Time
+}
+
+func parseQuery() (*query, error) {
+	if *area == "" {
+		return nil, errors.New("Missing --area to search")
+	}
+	q := &query{area: *area}
+	cells, err := geo.AreaToCellIDs(*area)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --area: %v", err)
+	}
+	q.cells = cells
+	// The coordinates were validated by AreaToCellIDs.
+	coordinates := strings.Split(*area, ",")
+	for i := 0; i+1 < len(coordinates); i += 2 {
+		lat, _ := strconv.ParseFloat(strings.TrimSpace(coordinates[i]), 64)
+		lng, _ := strconv.ParseFloat(strings.TrimSpace(coordinates[i+1]), 64)
+		q.vertices = append(q.vertices, s2.LatLngFromDegrees(lat, lng))
+	}
+	for _, bound := range []struct {
+		flag   string
+		value  string
+		target **time.Time
+	}{{"start", *start, &q.start}, {"end", *end, &q.end}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid --%s: %v", bound.flag, err)
+		}
+		*bound.target = &t
+	}
+	return q, nil
+}
+
+// client reads and deletes the entities of a DSS instance.
+type client interface {
+	// get returns the entity of kind k identified by id, or nil if there is
+	// none.
+	get(ctx context.Context, k *kind, id string) (entity, error)
+	search(ctx context.Context, k *kind, q *query) ([]entity, error)
+	// delete deletes the entity of kind k identified by id and returns it.
+	delete(ctx context.Context, k *kind, id string) (entity, error)
+	Close() error
+}
+
+// newClient returns the client of the API at --api_url, or of the database
+// of the entities of kind k otherwise.
+func newClient(ctx context.Context, k *kind) (client, error) {
+	if *apiURL == "" {
+		return newStoreClient(ctx, k)
+	}
+	token := os.Getenv("DSS_TOKEN")
+	if *tokenFile != "" {
+		content, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read --token_file: %v", err)
+		}
+		token = string(content)
+	}
+	return &apiClient{baseURL: strings.TrimSuffix(*apiURL, "/"), token: strings.TrimSpace(token)}, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/dss/pkg/cockroach/flags"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridrepos "github.com/interuss/dss/pkg/rid/repos"
+	ridc "github.com/interuss/dss/pkg/rid/store/cockroach"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	scdrepos "github.com/interuss/dss/pkg/scd/repos"
+	scdc "github.com/interuss/dss/pkg/scd/store/cockroach"
+	"github.com/interuss/dss/pkg/summary"
+)
+
+// storeClient is a client reading and deleting the entities directly in
+// the database of their kind, bypassing the checks and notifications of the
+// API.
+type storeClient struct {
+	rid *ridc.Store
+	scd *scdc.Store
+}
+
+// connect returns a connection to the database dbName configured with the
+// cockroach_* flags.
+func connect(ctx context.Context, dbName string) (*cockroach.DB, error) {
+	params := flags.ConnectParameters()
+	params.ApplicationName = "dss-ctl"
+	params.DBName = dbName
+
+	provider, err := flags.CredentialsProvider()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CockroachDB credentials configuration: %v", err)
+	}
+	var db *cockroach.DB
+	if provider != nil {
+		db, err = cockroach.DialWithProvider(ctx, params, provider, flags.CredentialsRefresh(), cockroach.PoolParameters{})
+	} else {
+		var uri string
+		if uri, err = params.BuildURI(); err == nil {
+			db, err = cockroach.Dial(uri, cockroach.PoolParameters{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dial CockroachDB database %s: %v", dbName, err)
+	}
+	db.NamePrefix = params.DBNamePrefix
+	return db, nil
+}
+
+func newStoreClient(ctx context.Context, k *kind) (*storeClient, error) {
+	if k.scd {
+		db, err := connect(ctx, scdc.DatabaseName)
+		if err != nil {
+			return nil, err
+		}
+		store, err := scdc.NewStore(ctx, db, logging.Logger, summary.Default)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Failed to open strategic conflict detection store: %v", err)
+		}
+		return &storeClient{scd: store}, nil
+	}
+	db, err := connect(ctx, ridc.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	store, err := ridc.NewStore(ctx, db, logging.Logger, summary.Default)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to open remote ID store: %v", err)
+	}
+	return &storeClient{rid: store}, nil
+}
+
+func (c *storeClient) Close() error {
+	if c.scd != nil {
+		return c.scd.Close()
+	}
+	return c.rid.Close()
+}
+
+func (c *storeClient) get(ctx context.Context, k *kind, id string) (entity, error) {
+	if k.scd {
+		repo, err := c.scd.Interact(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return getSCD(ctx, repo, k, dssmodels.ID(id))
+	}
+	repo, err := c.rid.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch k.name {
+	case "isa":
+		isa, err := repo.GetISA(ctx, dssmodels.ID(id))
+		if err != nil || isa == nil {
+			return nil, err
+		}
+		return entityOf(isa, isa.Cells)
+	default:
+		sub, err := repo.GetSubscription(ctx, dssmodels.ID(id))
+		if err != nil || sub == nil {
+			return nil, err
+		}
+		return entityOf(sub, sub.Cells)
+	}
+}
+
+func (c *storeClient) search(ctx context.Context, k *kind, q *query) ([]entity, error) {
+	var entities []entity
+	if !k.scd {
+		repo, err := c.rid.Interact(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if k.name == "isa" {
+			isas, err := repo.SearchISAs(ctx, q.cells, q.start, q.end, true)
+			if err != nil {
+				return nil, err
+			}
+			for _, isa := range isas {
+				e, err := entityOf(isa, isa.Cells)
+				if err != nil {
+					return nil, err
+				}
+				entities = append(entities, e)
+			}
+			return entities, nil
+		}
+		subs, err := repo.SearchSubscriptions(ctx, q.cells)
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			e, err := entityOf(sub, sub.Cells)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, e)
+		}
+		return entities, nil
+	}
+
+	repo, err := c.scd.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vol4 := &dssmodels.Volume4D{
+		StartTime: q.start,
+		EndTime:   q.end,
+		SpatialVolume: &dssmodels.Volume3D{
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return q.cells, nil
+			}),
+		},
+	}
+	switch k.name {
+	case "operational_intent":
+		ops, err := repo.SearchOperationalIntents(ctx, vol4, true, scdmodels.OperationalIntentFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range ops {
+			e, err := entityOf(op, op.Cells)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, e)
+		}
+	case "constraint":
+		constraints, err := repo.SearchConstraints(ctx, vol4, scdmodels.ConstraintFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, constraint := range constraints {
+			e, err := entityOf(constraint, constraint.Cells)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, e)
+		}
+	default:
+		subs, err := repo.SearchSubscriptions(ctx, vol4, scdmodels.SubscriptionFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			e, err := scdSubscriptionEntity(ctx, repo, sub)
+			if err != nil {
+				return nil, err
+			}
+			entities = append(entities, e)
+		}
+	}
+	return entities, nil
+}
+
+func (c *storeClient) delete(ctx context.Context, k *kind, id string) (entity, error) {
+	var deleted entity
+	if k.scd {
+		err := c.scd.Transact(ctx, func(ctx context.Context, repo scdrepos.Repository) error {
+			e, err := getSCD(ctx, repo, k, dssmodels.ID(id))
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				return fmt.Errorf("No %s %s", k.name, id)
+			}
+			switch k.name {
+			case "operational_intent":
+				err = repo.DeleteOperationalIntent(ctx, dssmodels.ID(id))
+			case "constraint":
+				err = repo.DeleteConstraint(ctx, dssmodels.ID(id))
+			default:
+				var dependents []dssmodels.ID
+				if dependents, err = repo.GetDependentOperationalIntents(ctx, dssmodels.ID(id)); err != nil {
+					return err
+				}
+				if len(dependents) > 0 {
+					return fmt.Errorf("Subscription %s has %d dependent operational intents", id, len(dependents))
+				}
+				err = repo.DeleteSubscription(ctx, dssmodels.ID(id))
+			}
+			deleted = e
+			return err
+		})
+		return deleted, err
+	}
+
+	err := c.rid.Transact(ctx, func(repo ridrepos.Repository) error {
+		if k.name == "isa" {
+			isa, err := repo.GetISA(ctx, dssmodels.ID(id))
+			if err != nil {
+				return err
+			}
+			if isa == nil {
+				return fmt.Errorf("No isa %s", id)
+			}
+			if isa, err = repo.DeleteISA(ctx, isa); err != nil {
+				return err
+			}
+			deleted, err = entityOf(isa, isa.Cells)
+			return err
+		}
+		sub, err := repo.GetSubscription(ctx, dssmodels.ID(id))
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			return fmt.Errorf("No rid_subscription %s", id)
+		}
+		if sub, err = repo.DeleteSubscription(ctx, sub); err != nil {
+			return err
+		}
+		deleted, err = entityOf(sub, sub.Cells)
+		return err
+	})
+	return deleted, err
+}
+
+// getSCD returns the strategic conflict detection entity of kind k
+// identified by id, or nil if there is none.
+func getSCD(ctx context.Context, repo scdrepos.Repository, k *kind, id dssmodels.ID) (entity, error) {
+	switch k.name {
+	case "operational_intent":
+		op, err := repo.GetOperationalIntent(ctx, id)
+		if err != nil || op == nil {
+			return nil, err
+		}
+		return entityOf(op, op.Cells)
+	case "constraint":
+		constraint, err := repo.GetConstraint(ctx, id)
+		if err != nil || constraint == nil {
+			return nil, err
+		}
+		return entityOf(constraint, constraint.Cells)
+	default:
+		sub, err := repo.GetSubscription(ctx, id)
+		if err != nil || sub == nil {
+			return nil, err
+		}
+		return scdSubscriptionEntity(ctx, repo, sub)
+	}
+}
+
+func scdSubscriptionEntity(ctx context.Context, repo scdrepos.Repository, sub *scdmodels.Subscription) (entity, error) {
+	dependents, err := repo.GetDependentOperationalIntents(ctx, sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := entityOf(sub, sub.Cells)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]interface{}, len(dependents))
+	for i, id := range dependents {
+		ids[i] = id.String()
+	}
+	e["dependent_operational_intents"] = ids
+	return e, nil
+}
@@ -6,34 +6,64 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"cloud.google.com/go/profiler"
+	"github.com/google/uuid"
 	"github.com/interuss/dss/pkg/api/v1/auxpb"
 	"github.com/interuss/dss/pkg/api/v1/ridpb"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/audit"
 	"github.com/interuss/dss/pkg/auth"
 	aux "github.com/interuss/dss/pkg/aux_"
+	"github.com/interuss/dss/pkg/backend"
 	"github.com/interuss/dss/pkg/build"
 	"github.com/interuss/dss/pkg/cockroach"
 	"github.com/interuss/dss/pkg/cockroach/flags" // Force command line flag registration
+	"github.com/interuss/dss/pkg/compression"
+	"github.com/interuss/dss/pkg/deprecation"
 	uss_errors "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	features "github.com/interuss/dss/pkg/flags"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/hotspot"
+	"github.com/interuss/dss/pkg/idempotency"
+	"github.com/interuss/dss/pkg/ids"
+	"github.com/interuss/dss/pkg/interceptors"
+	"github.com/interuss/dss/pkg/journal"
+	"github.com/interuss/dss/pkg/loadshed"
 	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/pool"
+	"github.com/interuss/dss/pkg/probe"
+	"github.com/interuss/dss/pkg/readonly"
+	"github.com/interuss/dss/pkg/restrictions"
 	application "github.com/interuss/dss/pkg/rid/application"
+	"github.com/interuss/dss/pkg/rid/notifications"
 	rid "github.com/interuss/dss/pkg/rid/server"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
 	ridc "github.com/interuss/dss/pkg/rid/store/cockroach"
 	"github.com/interuss/dss/pkg/scd"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
 	scdc "github.com/interuss/dss/pkg/scd/store/cockroach"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/dss/pkg/telemetry"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/dss/pkg/validations"
 	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
 	"github.com/robfig/cron/v3"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -46,39 +76,254 @@ var (
 	jwksKeyIDs        = flag.String("jwks_key_ids", "", "IDs of a set of key in a JWKS, separated by commas")
 	keyRefreshTimeout = flag.Duration("key_refresh_timeout", 1*time.Minute, "Timeout for refreshing keys for JWT verification")
 	timeout           = flag.Duration("server timeout", 10*time.Second, "Default timeout for server calls")
-	reflectAPI        = flag.Bool("reflect_api", false, "Whether to reflect the API.")
+	reflectAPI        = flag.Bool("reflect_api", false, "Whether to serve the gRPC server reflection service describing the API.")
 	logFormat         = flag.String("log_format", logging.DefaultFormat, "The log format in {json, console}")
 	logLevel          = flag.String("log_level", logging.DefaultLevel.String(), "The log level")
 	dumpRequests      = flag.Bool("dump_requests", false, "Log request and response protos")
+	accessLogBodies   = flag.Bool("access_log_request_bodies", false, "whether the access log records the requests, which hold personal data, rather than their metadata only")
+	accessLogRedact   = flag.String("access_log_redacted_fields", "", "comma-separated request field names whose values are redacted from the requests recorded by the access log")
+	accessLogSampling = flag.Float64("access_log_sample_rate", 1.0, "fraction of successful API calls in [0, 1] recorded in the access log; failed calls are always recorded")
 	profServiceName   = flag.String("gcp_prof_service_name", "", "Service name for the Go profiler")
 	enableSCD         = flag.Bool("enable_scd", false, "Enables the Strategic Conflict Detection API")
 	enableHTTP        = flag.Bool("enable_http", false, "Enables http scheme for Strategic Conflict Detection API")
 	locality          = flag.String("locality", "", "self-identification string used as CRDB table writer column")
+	auxHTTPAddress    = flag.String("aux_http_addr", "", "address serving operator-facing auxiliary HTTP endpoints, authenticating pool operators with access tokens granting the "+string(aux.OperatorScope)+" scope; disabled if empty")
+	summarySchedule   = flag.String("summary_schedule", "@daily", "cron schedule at which the activity summary is produced and logged")
+	region            = flag.String("region", "", "region of this DSS instance; monitoring API keys are only accepted if issued for this region")
+	apiKeysFile       = flag.String("monitoring_api_keys_file", "", "JSON file listing the API keys (id, sha256, region) granting access to the monitoring endpoints of aux_http_addr; monitoring endpoints are unauthenticated if empty")
+	idReservationTTL  = flag.Duration("id_reservation_ttl", 0, "duration for which IDs minted by the ID minting endpoint of aux_http_addr are reserved to the client they were minted for; ID minting is disabled if zero; reservations are shared by the pool through the remote ID database with the cockroach store backend")
+	idVersion         = flag.String("id_version", "v4", "version of the UUIDs generated by the DSS itself, such as those of implicit subscriptions: v4 (random) or v7 (time-ordered); see build/deploy/db_schemas/README.md before using v7")
+	idVersions        = flag.String("id_required_versions", "", "comma-separated UUID versions, such as 4, of which the IDs of the entities created by clients must be, others being rejected with INVALID_ID; any UUID is accepted if empty")
+	idPrefix          = flag.String("id_required_prefix", "", "hexadecimal prefix, such as 4d5e, with which the IDs of the entities created by clients must start, others being rejected with INVALID_ID; not applied to the IDs generated by the DSS itself; any UUID is accepted if empty")
+	enableAuditLog    = flag.Bool("enable_audit_log", false, "Enables persisting an audit log of the API calls changing the state of the DSS and the DSS reports filed by USSs, searchable through aux_http_addr; requires remote ID schema 3.3.0")
+	enableJournal     = flag.Bool("enable_request_journal", false, "Enables persisting a signed, hash-chained journal of the API calls changing the state of the DSS, named after locality, for nonrepudiation; verified with the verify-journal command of db-manager; requires remote ID schema 3.7.0")
+	journalKeyFile    = flag.String("request_journal_private_key_file", "", "PEM-encoded RSA private key signing the entries of the request journal, whose public key verifies them")
+	deprecationsFile  = flag.String("deprecations_file", "", "JSON file listing the deprecated API methods (method, deprecation, sunset, link), whose responses then carry Deprecation, Sunset and Link headers and whose calls are counted by manager in the activity summary")
+	eventsSink        = flag.String("events_sink", "", "destination of the change events of ISAs, operational intents and constraints tailed from CockroachDB changefeeds (which require kv.rangefeed.enabled), published by one instance of the pool at a time: log, the http(s) URL of a webhook, the nats:// or tls:// URL of a NATS server and subject, or the kafka+http(s):// URL of a Kafka REST proxy and topic; requires remote ID schema 3.13.0; disabled if empty")
+	maxCells          = flag.Int("max_entity_cells", 0, "largest number of S2 cells covered by an ISA, subscription, operational intent or constraint accepted; unbounded if zero")
+	maxDuration       = flag.Duration("max_entity_duration", 0, "largest duration of an ISA, subscription, operational intent or constraint accepted; unbounded if zero")
+	maxSubDuration    = flag.Duration("max_subscription_duration", dssmodels.DefaultMaxSubscriptionDuration, "largest duration of a remote ID or strategic conflict detection subscription")
+	truncateSubs      = flag.Bool("truncate_subscriptions", false, "Makes subscriptions longer than max_subscription_duration end at the limit, reporting their effective end time, instead of rejecting them")
+	minAltitude       = flag.String("min_entity_altitude", "", "lowest altitude in meters of an ISA, subscription, operational intent or constraint accepted; unbounded if empty")
+	maxAltitude       = flag.String("max_entity_altitude", "", "highest altitude in meters of an ISA, subscription, operational intent or constraint accepted; unbounded if empty")
+	otlpEndpoint      = flag.String("otlp_endpoint", "", "host:port of an OTLP/gRPC collector to export traces to; tracing is disabled if empty")
+	integritySchedule = flag.String("integrity_check_schedule", "@every 1h", "cron schedule at which the operational intents are checked for corruption, such as missing subscriptions or missing or excessive cells; disabled if empty")
+	quarantine        = flag.Bool("quarantine_corrupt_operational_intents", false, "Moves the operational intents failing the integrity check to scd_quarantined_operations; requires strategic conflict detection schema 3.3.0")
+	scdSpatialIndex   = flag.String("scd_spatial_index", "inverted", "layout used to look operational intents up: inverted, the inverted index of scd_operations.cells, cells_table, the cells_scd_operations table, which requires strategic conflict detection schema 3.4.0, or geography, the exact footprints of scd_operations intersected with ST_Intersects, which requires strategic conflict detection schema 3.6.0")
+	jurisdictions     = flag.String("jurisdictions", "", "semicolon-separated jurisdictions written with the entities, which the tables may be partitioned by for data residency, each a name and the rectangle lat_lo,lng_lo,lat_hi,lng_hi (e.g. eu:34,-25,72,45); must be the same for all the instances of the pool; requires remote ID schema 3.14.0 and strategic conflict detection schema 3.15.0; see build/deploy/db_schemas/README.md")
+	scdDualWrites     = flag.String("scd_dual_writes", "all", "secondary layouts written along with the strategic conflict detection entity tables, to restructure them without downtime: all, every layout held by the schema, or a comma-separated, possibly empty, list of cells_scd_operations, scd_operations.footprint and scd_constraints.footprint; the layout read by --scd_spatial_index must be written")
+	expiryNotice      = flag.Duration("subscription_expiry_notice", 0, "how long before their end time the USSs managing strategic conflict detection subscriptions are notified that they are about to expire; disabled if 0")
+	expiryNotifier    = flag.String("subscription_expiry_notifier", "log", "how subscription expiry notices are delivered: callback, POSTed to the USSs opted into them by --subscription_expiry_callbacks, log, or the http(s) URL of a webhook receiving them as change events")
+	expiryCallbacks   = flag.String("subscription_expiry_callbacks", "", "JSON file of the USSs opted into expiry notices, the URLs receiving them and the key signing their access tokens, with --subscription_expiry_notifier=callback; see build/README.md")
+	idempotencyTTL    = flag.Duration("idempotency_key_ttl", 0, "how long the responses to the creation and update calls carrying an Idempotency-Key header are replayed to their retries; disabled if 0; requires remote ID schema 3.5.0 with the cockroach backend")
+	historyRetention  = flag.Duration("scd_history_retention", 30*24*time.Hour, "how long the superseded versions of operational intents and constraints, and those of deleted ones, are kept for incident investigations before being purged hourly; kept indefinitely if 0; requires strategic conflict detection schema 3.9.0 for constraints and deleted entities")
+	constraintCache   = flag.Duration("constraint_cache_ttl", 0, "how long the results of the read-only searches for strategic conflict detection constraints are cached, bounding their staleness with respect to the writes of other DSS instances; disabled if 0")
+	cacheChangefeed   = flag.Bool("constraint_cache_changefeed", true, "whether the constraint cache is invalidated by the writes of other DSS instances through a changefeed, which requires kv.rangefeed.enabled, with the cockroach backend")
+	shutdownGrace     = flag.Duration("shutdown_grace_period", 20*time.Second, "how long in-flight requests are waited for when shutting down before they are canceled and their transactions rolled back")
+	egm96GridFile     = flag.String("egm96_grid_file", "", "EGM96 geoid grid in the format of NGA's WW15MGH.GRD, used to normalize strategic conflict detection altitudes submitted relative to EGM96 to WGS84; such altitudes are rejected if empty")
+	searchTimeout     = flag.Duration("repo_search_timeout", 0, "how long a single database call reading entities may take on behalf of an API call before it fails with DEADLINE_EXCEEDED; bounded by the call only if 0")
+	upsertTimeout     = flag.Duration("repo_upsert_timeout", 0, "how long a single database call creating or updating entities may take on behalf of an API call before it fails with DEADLINE_EXCEEDED; bounded by the call only if 0")
+	deleteTimeout     = flag.Duration("repo_delete_timeout", 0, "how long a single database call deleting entities may take on behalf of an API call before it fails with DEADLINE_EXCEEDED; bounded by the call only if 0")
+	enableSLAProbe    = flag.Bool("enable_sla_probe", false, "whether this instance periodically creates, searches and deletes an ISA through its own API as "+probe.Manager+", serving the latency percentiles of the calls at /aux/v1/sla_probe of aux_http_addr")
+	slaProbePeriod    = flag.Duration("sla_probe_period", 10*time.Second, "period of the SLA probe cycles")
+	slaProbeKeyFile   = flag.String("sla_probe_private_key_file", "", "PEM-encoded RSA private key signing the access tokens of the SLA probe, whose public key must be among --public_key_files")
+	poolPeers         = flag.String("pool_peers", "", "comma-separated base URLs of the DSS instances of the pool, including this one, such as https://dss.uss1.example.com, through each of which canary ISAs and subscriptions are periodically written as "+pool.Manager+" and read back through the others, alerting on divergence and serving the latest report at /aux/v1/pool_check of aux_http_addr; disabled if empty")
+	poolCheckPeriod   = flag.Duration("pool_check_period", time.Minute, "period of the checks of the convergence of pool_peers")
+	poolCheckKeyFile  = flag.String("pool_check_private_key_file", "", "PEM-encoded RSA private key signing the access tokens of the pool checker, whose public key must be accepted by every instance of pool_peers for the host name of its base URL as audience")
+	ridNotifications  = flag.Bool("enable_rid_push_notifications", false, "Makes this instance POST the changes of ISAs to the callback URLs of the subscriptions they affect, for pools whose USSs rely on the DSS to notify subscribers centrally, serving delivery statistics at /aux/v1/rid_notifications of aux_http_addr")
+	notifyAttempts    = flag.Int("rid_notification_max_attempts", 3, "how many times an ISA notification is POSTed before it is given up")
+	notifyThreshold   = flag.Int("rid_notification_breaker_threshold", 5, "number of consecutive failed deliveries to a host after which ISA notifications to it are not attempted for rid_notification_breaker_cooldown; never if 0")
+	notifyCooldown    = flag.Duration("rid_notification_breaker_cooldown", time.Minute, "how long ISA notifications to a host are not attempted once it reached rid_notification_breaker_threshold")
+	notifyKeyFile     = flag.String("rid_notification_private_key_file", "", "PEM-encoded RSA private key signing the access tokens of the ISA notifications, for the host name of their callback URL as audience; notifications are unauthenticated if empty")
+	grpcCompression   = flag.Bool("enable_grpc_compression", true, "Accepts gzip and deflate compressed gRPC calls and compresses their responses likewise, counting them in the activity summary")
+	forceSchema       = flag.Bool("force_schema_compatibility", false, "Serves reads and writes even if the schema version of a database is outside of the range this binary supports, as checked at startup; schemas newer than supported otherwise restrict the instance to reads, and others stop it")
+	readOnly          = flag.Bool("read_only", false, "Starts this instance read-only, refusing the calls which create, update or delete entities as unavailable while serving searches, e.g. during database maintenance; toggled at /aux/v1/read_only of aux_http_addr")
+	readOnlyRetry     = flag.Duration("read_only_retry_after", 5*time.Minute, "how long the callers refused by read_only are told to wait before retrying; not told if 0")
+	timePrecision     = flag.Duration("time_precision", dssmodels.DefaultTimePrecision, "finest resolution of the timestamps accepted in requests, which are rejected if more precise rather than silently truncated by the database; at least 1µs")
+	simulatedTime     = flag.Bool("simulated_time", false, "Makes the clock of this instance start at the current time and only advance when POSTed to /aux/v1/clock of aux_http_addr by an access token granting "+string(aux.SimulatedTimeScope)+", for integration tests of expiry and garbage collection; never enable in production")
 
 	jwtAudiences = flag.String("accepted_jwt_audiences", "", "comma-separated acceptable JWT `aud` claims")
+
+	featureConfig     features.Config
+	restrictionConfig restrictions.Config
+	shedConfig        loadshed.Config
+	hotspotConfig     hotspot.Config
+	backendConfig     backend.Config
+
+	// interceptorChain is the chain of the interceptors of the gRPC calls,
+	// by default those built into the DSS, outermost first.
+	interceptorChain = interceptors.Chain{
+		Default:  "tracing,access_log,summary,deprecation,audit,journal,errors,read_only,load_shedding,auth,validation,telemetry,idempotency,dump_requests",
+		Required: []string{"errors", "auth", "validation"},
+	}
+
+	// databases holds the connections established by connectTo, by database name.
+	databases = map[string]*cockroach.DB{}
+
+	// clock is the clock of this instance, simulated with --simulated_time.
+	clock = clockwork.NewRealClock()
+
+	// storeBackend opens the stores of the entities, as selected by
+	// backendConfig.
+	storeBackend *backend.Backend
+
+	// hotspots counts the writes to entities by cell, if enabled by
+	// hotspotConfig.
+	hotspots *hotspot.Tracker
 )
 
 func connectTo(dbName string) (*cockroach.DB, error) {
 	connectParameters := flags.ConnectParameters()
 	connectParameters.DBName = dbName
 
+	provider, err := flags.CredentialsProvider()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid CockroachDB credentials configuration")
+	}
+	var db *cockroach.DB
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		db, err = cockroach.DialWithProvider(ctx, connectParameters, provider, flags.CredentialsRefresh(), flags.PoolParameters())
+	} else {
+		db, err = dialWithFlagCredentials(connectParameters)
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error dialing CockroachDB database at %s:%d", connectParameters.Host, connectParameters.Port)
+	}
+	db.NamePrefix = connectParameters.DBNamePrefix
+	db.RetryPolicy = flags.RetryPolicy()
+	db.FollowerReadStaleness = flags.FollowerReadStaleness()
+	if db.Locality, err = databaseLocality(db); err != nil {
+		return nil, stacktrace.Propagate(err, "Error determining the locality of CockroachDB database at %s:%d", connectParameters.Host, connectParameters.Port)
+	}
+	databases[dbName] = db
+	return db, nil
+}
+
+// dialWithFlagCredentials connects to the database of connectParameters
+// with the credentials set through flags, falling back to the secondary ones
+// while the primary ones are rotated.
+func dialWithFlagCredentials(connectParameters cockroach.ConnectParameters) (*cockroach.DB, error) {
 	uri, err := connectParameters.BuildURI()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error building URI")
 	}
-	db, err := cockroach.Dial(uri)
+	uris := []string{uri}
+	if connectParameters.SecondaryCredentials.Username != "" {
+		secondary := connectParameters
+		secondary.Credentials = connectParameters.SecondaryCredentials
+		secondaryURI, err := secondary.BuildURI()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error building URI for secondary credentials")
+		}
+		uris = append(uris, secondaryURI)
+	}
+	return cockroach.DialWithFailover(uris, flags.PoolParameters())
+}
+
+// databaseLocality returns the locality set by --cockroach_locality or, if
+// empty, that of the node db is connected to. Nodes failing to report their
+// locality are assumed to have none.
+func databaseLocality(db *cockroach.DB) (cockroach.Locality, error) {
+	if flags.Locality() != "" {
+		return cockroach.ParseLocality(flags.Locality())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	locality, err := db.QueryLocality(ctx)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Error dialing CockroachDB database at %s", uri)
+		logging.Logger.Warn("Failed to query the locality of the CockroachDB node", zap.Error(err))
+		return nil, nil
 	}
-	return db, nil
+	return locality, nil
 }
 
-func pingDB(ctx context.Context, db *cockroach.DB, databaseName string) {
-	logger := logging.WithValuesFromContext(ctx, logging.Logger)
-	if err := db.PingContext(ctx); err != nil {
-		logger.Panic("Failed periodic DB Ping, panic to force restart", zap.String("Database", databaseName))
-	} else {
-		logger.Info("Successful periodic DB Ping ", zap.String("Database", databaseName))
+// databaseRegion returns the region of the databases connected to, or the
+// empty string if they are in none.
+func databaseRegion() string {
+	for _, db := range databases {
+		if region := db.Locality.Region(); region != "" {
+			return region
+		}
+	}
+	return ""
+}
+
+// entityLimits returns the limits of the entities accepted by the DSS, as
+// configured by the max_entity_* and min_entity_* flags.
+func entityLimits() (dssmodels.Limits, error) {
+	limits := dssmodels.Limits{
+		MaxCells:                *maxCells,
+		MaxDuration:             *maxDuration,
+		MaxSubscriptionDuration: *maxSubDuration,
+		TruncateSubscriptions:   *truncateSubs,
+	}
+	for _, altitude := range []struct {
+		flag   string
+		value  string
+		target **float32
+	}{
+		{"min_entity_altitude", *minAltitude, &limits.MinAltitude},
+		{"max_entity_altitude", *maxAltitude, &limits.MaxAltitude},
+	} {
+		if altitude.value == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(altitude.value, 32)
+		if err != nil {
+			return dssmodels.Limits{}, stacktrace.Propagate(err, "Invalid --%s", altitude.flag)
+		}
+		v := float32(f)
+		*altitude.target = &v
+	}
+	return limits, nil
+}
+
+// idValidators returns the checks of the IDs of the entities created by
+// clients, as configured by the id_required_* flags.
+func idValidators() ([]validations.IDValidator, error) {
+	var validators []validations.IDValidator
+	if *idVersions != "" {
+		var versions []uuid.Version
+		for _, s := range strings.Split(*idVersions, ",") {
+			v, err := strconv.ParseUint(s, 10, 4)
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Invalid --id_required_versions")
+			}
+			versions = append(versions, uuid.Version(v))
+		}
+		// The IDs generated by the DSS itself should pass the checks too.
+		version, err := ids.VersionFromString(*idVersion)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid --id_version")
+		}
+		minted, err := ids.New(version, time.Now())
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error generating ID")
+		}
+		validate := validations.RequireVersions(versions...)
+		if err := validate(minted); err != nil {
+			return nil, stacktrace.Propagate(err, "--id_version is not among --id_required_versions")
+		}
+		validators = append(validators, validate)
+	}
+	if *idPrefix != "" {
+		if strings.Trim(*idPrefix, "0123456789abcdefABCDEF-") != "" || len(*idPrefix) > 36 {
+			return nil, stacktrace.NewError("Invalid --id_required_prefix %s", *idPrefix)
+		}
+		validators = append(validators, validations.RequirePrefix(*idPrefix))
+	}
+	return validators, nil
+}
+
+// repoTimeouts returns the timeouts of the repository calls made on behalf
+// of API calls, as configured by the repo_*_timeout flags.
+func repoTimeouts() dssmodels.Timeouts {
+	return dssmodels.Timeouts{
+		Search: *searchTimeout,
+		Upsert: *upsertTimeout,
+		Delete: *deleteTimeout,
 	}
 }
 
@@ -103,71 +348,331 @@ func createKeyResolver() (auth.KeyResolver, error) {
 	}
 }
 
-func createRIDServer(ctx context.Context, locality string, logger *zap.Logger) (*rid.Server, error) {
-	ridCrdb, err := connectTo(ridc.DatabaseName)
+func createRIDServer(ctx context.Context, locality string, logger *zap.Logger) (*rid.Server, ridstore.Store, error) {
+	ridStore, err := storeBackend.RIDStore(ctx)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to connect to remote ID database; verify your database configuration is current with https://github.com/interuss/dss/tree/master/build#upgrading-database-schemas")
+		return nil, nil, err
 	}
-
-	ridStore, err := ridc.NewStore(ctx, ridCrdb, logger)
-	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to create remote ID store")
+	if store, ok := ridStore.(*ridc.Store); ok {
+		js, err := geo.ParseJurisdictions(*jurisdictions)
+		if err == nil {
+			err = store.SetJurisdictions(js)
+		}
+		if err != nil {
+			return nil, nil, stacktrace.Propagate(err, "Invalid --jurisdictions")
+		}
 	}
 
 	repo, err := ridStore.Interact(ctx)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Unable to interact with store")
+		return nil, nil, stacktrace.Propagate(err, "Unable to interact with store")
 	}
-	gc := ridc.NewGarbageCollector(repo, locality)
+	gc := ridc.NewGarbageCollector(repo, locality, summary.Default)
 
 	// schedule period tasks for RID Server
 	ridCron := cron.New()
-	// schedule pinging every minute for the underlying storage for RID Server
-	if _, err := ridCron.AddFunc("@every 1m", func() { pingDB(ctx, ridCrdb, ridc.DatabaseName) }); err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to schedule periodic ping to %s", ridc.DatabaseName)
-	}
 
 	cronLogger := cron.VerbosePrintfLogger(log.New(os.Stdout, "RIDGarbageCollectorJob: ", log.LstdFlags))
 	// TODO(supicha): make the 30m configurable
 	if _, err = ridCron.AddJob("@every 30m", cron.NewChain(cron.SkipIfStillRunning(cronLogger)).Then(RIDGarbageCollectorJob{"delete rid expired records", *gc, ctx})); err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to schedule periodic delete rid expired records to %s", ridc.DatabaseName)
+		return nil, nil, stacktrace.Propagate(err, "Failed to schedule periodic delete rid expired records to %s", ridc.DatabaseName)
 	}
 	ridCron.Start()
 
+	limits, err := entityLimits()
+	if err != nil {
+		return nil, nil, err
+	}
 	return &rid.Server{
-		App:        application.NewFromTransactor(ridStore, logger),
+		App:        application.NewFromTransactor(application.NewHotspotStore(ridStore, hotspots), logger, limits, repoTimeouts()),
 		Timeout:    *timeout,
 		Locality:   locality,
 		EnableHTTP: *enableHTTP,
-	}, nil
+	}, ridStore, nil
 }
 
 func createSCDServer(ctx context.Context, logger *zap.Logger) (*scd.Server, error) {
-	scdCrdb, err := connectTo(scdc.DatabaseName)
+	scdStore, err := storeBackend.SCDStore(ctx)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to connect to strategic conflict detection database; verify your database configuration is current with https://github.com/interuss/dss/tree/master/build#upgrading-database-schemas")
-	}
-	// schedule period tasks for SCD Server
-	scdCron := cron.New()
-	// schedule pinging every minute for the underlying storage for SCD Server
-	if _, err := scdCron.AddFunc("@every 1m", func() { pingDB(ctx, scdCrdb, scdc.DatabaseName) }); err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to schedule periodic ping to %s", scdc.DatabaseName)
+		return nil, err
 	}
+	if store, ok := scdStore.(*scdc.Store); ok {
+		// schedule period tasks for SCD Server
+		scdCron := cron.New()
+		scdCron.Start()
 
-	scdCron.Start()
+		if *scdDualWrites != "all" {
+			layouts, err := scdc.ParseLayouts(*scdDualWrites)
+			if err == nil {
+				err = store.SetDualWrites(layouts)
+			}
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Invalid --scd_dual_writes")
+			}
+		}
+		logger.Info("Writing strategic conflict detection layouts", zap.Any("layouts", store.DualWrites()))
+		if err := store.UseSpatialIndex(*scdSpatialIndex); err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid --scd_spatial_index")
+		}
+		js, err := geo.ParseJurisdictions(*jurisdictions)
+		if err == nil {
+			err = store.SetJurisdictions(js)
+		}
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid --jurisdictions")
+		}
 
-	scdStore, err := scdc.NewStore(ctx, scdCrdb, logger)
+		if *integritySchedule != "" {
+			if !store.Capabilities().FollowerReads {
+				logger.Warn("Integrity checks are not served by follower reads and contend with writes; set --cockroach_follower_read_staleness to avoid it")
+			}
+			cronLogger := cron.VerbosePrintfLogger(log.New(os.Stdout, "SCDIntegrityJob: ", log.LstdFlags))
+			job := SCDIntegrityJob{store: store, maxCells: *maxCells, quarantine: *quarantine, recorder: summary.Default, ctx: ctx}
+			if _, err := scdCron.AddJob(*integritySchedule, cron.NewChain(cron.SkipIfStillRunning(cronLogger)).Then(job)); err != nil {
+				return nil, stacktrace.Propagate(err, "Failed to schedule integrity check of %s", scdc.DatabaseName)
+			}
+		}
+		if *historyRetention > 0 {
+			cronLogger := cron.VerbosePrintfLogger(log.New(os.Stdout, "SCDHistoryPurgeJob: ", log.LstdFlags))
+			job := SCDHistoryPurgeJob{store: store, retention: *historyRetention, ctx: ctx}
+			if _, err := scdCron.AddJob("@every 1h", cron.NewChain(cron.SkipIfStillRunning(cronLogger)).Then(job)); err != nil {
+				return nil, stacktrace.Propagate(err, "Failed to schedule purge of entity history of %s", scdc.DatabaseName)
+			}
+		}
+	}
+	if *expiryNotice > 0 {
+		if err := scheduleExpiryScans(ctx, scdStore, logger); err != nil {
+			return nil, err
+		}
+	}
+	version, err := ids.VersionFromString(*idVersion)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to create strategic conflict detection store")
+		return nil, stacktrace.Propagate(err, "Invalid --id_version")
+	}
+	limits, err := entityLimits()
+	if err != nil {
+		return nil, err
+	}
+	if *egm96GridFile != "" {
+		f, err := os.Open(*egm96GridFile)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to open --egm96_grid_file")
+		}
+		defer f.Close()
+		grid, err := geo.ReadGeoidGrid(f)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to read --egm96_grid_file")
+		}
+		dssmodels.EGM96 = grid
 	}
 
 	return &scd.Server{
 		Store:      scdStore,
 		Timeout:    *timeout,
 		EnableHTTP: *enableHTTP,
+		IDVersion:  version,
+		Limits:     limits,
 	}, nil
 }
 
+// checkSchemas checks that the schemas of the databases of the APIs of
+// schemas are within the range this binary supports. It returns why the
+// instance may only serve reads, if a schema is newer than supported, or an
+// error if one is otherwise unsupported, unless --force_schema_compatibility
+// is set.
+func checkSchemas(ctx context.Context, schemas map[string]aux.SchemaVersioner, logger *zap.Logger) (string, error) {
+	if !storeBackend.Persistent() {
+		return "", nil
+	}
+	ranges := map[string]cockroach.SchemaRange{
+		aux.RIDAPI.Name: ridc.SupportedSchemas,
+		aux.SCDAPI.Name: scdc.SupportedSchemas,
+	}
+	var reasons []string
+	for api, versioner := range schemas {
+		r, ok := ranges[api]
+		if !ok {
+			continue
+		}
+		vs, err := versioner.GetVersion(ctx)
+		if err != nil {
+			return "", stacktrace.Propagate(err, "Failed to get database schema version of %s", api)
+		}
+		c, err := cockroach.CheckSchema(api, vs, r)
+		switch {
+		case c == cockroach.Compatible:
+			continue
+		case *forceSchema:
+			logger.Warn("Ignoring schema incompatibility with --force_schema_compatibility", zap.String("api", api), zap.Stringer("compatibility", c), zap.Error(err))
+		case c == cockroach.ReadOnly:
+			logger.Warn("Serving reads only", zap.String("api", api), zap.Error(err))
+			reasons = append(reasons, fmt.Sprintf("schema %s of the %s database is newer than supported", vs, api))
+		default:
+			return "", stacktrace.Propagate(err, "Unsupported schema; see https://github.com/interuss/dss/tree/master/build#upgrading-database-schemas, or override with --force_schema_compatibility")
+		}
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, "; "), nil
+}
+
+// scheduleExpiryScans notifies the USSs managing the subscriptions of store
+// about to expire, through the notifier selected by
+// --subscription_expiry_notifier. The instances of the pool scan in turn,
+// through the lease of the expiry scans of store.
+func scheduleExpiryScans(ctx context.Context, store scdstore.Store, logger *zap.Logger) error {
+	ledger, ok := store.(scdstore.ExpiryScanLedger)
+	if !ok || !store.Capabilities().ExpiryScans {
+		return stacktrace.NewError("--subscription_expiry_notice requires strategic conflict detection schema 3.14.0")
+	}
+	holder, err := instanceName()
+	if err != nil {
+		return err
+	}
+
+	var notifier scd.ExpiryNotifier
+	switch *expiryNotifier {
+	case "callback":
+		if *expiryCallbacks == "" {
+			return stacktrace.NewError("--subscription_expiry_notifier=callback requires --subscription_expiry_callbacks")
+		}
+		callbacks, err := scd.LoadExpiryCallbacks(*expiryCallbacks, &http.Client{Timeout: 10 * time.Second}, clock)
+		if err != nil {
+			return stacktrace.Propagate(err, "Invalid --subscription_expiry_callbacks")
+		}
+		notifier = callbacks
+	case "log":
+		notifier = &scd.EventExpiryNotifier{Sink: &events.LogSink{Logger: logger}}
+	default:
+		webhook, err := events.NewWebhookSink(*expiryNotifier)
+		if err != nil {
+			return stacktrace.Propagate(err, "Invalid --subscription_expiry_notifier")
+		}
+		notifier = &scd.EventExpiryNotifier{Sink: webhook}
+	}
+
+	job := SCDExpiryJob{
+		scanner: &scd.ExpiryScanner{
+			Store:    store,
+			Ledger:   ledger,
+			Notifier: notifier,
+			Notice:   *expiryNotice,
+			Holder:   holder,
+			Clock:    clock,
+			Logger:   logger,
+		},
+		ctx: ctx,
+	}
+	cronLogger := cron.VerbosePrintfLogger(log.New(os.Stdout, "SCDExpiryJob: ", log.LstdFlags))
+	expiryCron := cron.New()
+	if _, err := expiryCron.AddJob("@every 1m", cron.NewChain(cron.SkipIfStillRunning(cronLogger)).Then(job)); err != nil {
+		return stacktrace.Propagate(err, "Failed to schedule subscription expiry scans")
+	}
+	expiryCron.Start()
+	return nil
+}
+
+// startChangefeeds publishes the changes of the entities of the databases
+// connected to to the sink selected by --events_sink. The instances of the
+// pool publish each changefeed in turn, through the leases of the remote ID
+// database.
+func startChangefeeds(ctx context.Context, logger *zap.Logger) error {
+	if !storeBackend.Persistent() {
+		return stacktrace.NewError("--events_sink requires --store_backend=cockroach")
+	}
+	sink, err := events.NewSink(*eventsSink, logger)
+	if err != nil {
+		return stacktrace.Propagate(err, "Invalid --events_sink")
+	}
+	ledger, err := events.NewDBLedger(ctx, databases[ridc.DatabaseName], ridc.DatabaseName)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to create event publishers ledger")
+	}
+	holder, err := instanceName()
+	if err != nil {
+		return err
+	}
+
+	tables := map[string][]string{
+		ridc.DatabaseName: {"identification_service_areas"},
+		scdc.DatabaseName: {"scd_operations", "scd_constraints"},
+	}
+	for name, db := range databases {
+		if len(tables[name]) == 0 {
+			continue
+		}
+		consumer := &events.Consumer{
+			DB:     db,
+			Tables: tables[name],
+			Sink:   sink,
+			Logger: logger.With(zap.String("database", name)),
+			Ledger: ledger,
+			Feed:   name,
+			Holder: holder,
+		}
+		go consumer.Run(ctx)
+	}
+	return nil
+}
+
+// instanceName identifies this instance among those of the pool, by
+// --locality or else by its host name.
+func instanceName() (string, error) {
+	if *locality != "" {
+		return *locality, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Failed to identify this instance; set --locality")
+	}
+	return hostname, nil
+}
+
+// createIdempotencyStore returns the store of the idempotency keys of the
+// backend selected by --store_backend. With the cockroach backend, expired
+// keys are purged periodically.
+func createIdempotencyStore(ctx context.Context) (idempotency.Store, error) {
+	if !storeBackend.Persistent() {
+		return idempotency.NewMemoryStore(), nil
+	}
+	store, err := idempotency.NewDBStore(ctx, databases[ridc.DatabaseName], ridc.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	purgeCron := cron.New()
+	if _, err := purgeCron.AddFunc("@every 10m", func() {
+		if err := store.DeleteExpired(ctx); err != nil {
+			logging.WithValuesFromContext(ctx, logging.Logger).Warn("Failed to delete expired idempotency keys", zap.Error(err))
+		}
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to schedule purge of expired idempotency keys")
+	}
+	purgeCron.Start()
+	return store, nil
+}
+
+// createIDStore returns the store of the ID reservations of the backend
+// selected by --store_backend. With the cockroach backend, expired
+// reservations are purged periodically.
+func createIDStore(ctx context.Context, clock clockwork.Clock) (ids.Store, error) {
+	if !storeBackend.Persistent() {
+		return ids.NewMemoryStore(), nil
+	}
+	store, err := ids.NewDBStore(ctx, databases[ridc.DatabaseName], ridc.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	purgeCron := cron.New()
+	if _, err := purgeCron.AddFunc("@every 10m", func() {
+		if err := store.DeleteExpired(ctx, clock.Now()); err != nil {
+			logging.WithValuesFromContext(ctx, logging.Logger).Warn("Failed to delete expired ID reservations", zap.Error(err))
+		}
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to schedule purge of expired ID reservations")
+	}
+	purgeCron.Start()
+	return store, nil
+}
+
 // RunGRPCServer starts the example gRPC service.
 // "network" and "address" are passed to net.Listen.
 func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, locality string) error {
@@ -179,6 +684,12 @@ func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, loca
 		logger.Warn("missing required --accepted_jwt_audiences")
 	}
 
+	validators, err := idValidators()
+	if err != nil {
+		return err
+	}
+	validations.IDValidators = validators
+
 	l, err := net.Listen("tcp", address)
 	if err != nil {
 		return stacktrace.Propagate(err, "Error attempting to listen at %s", address)
@@ -189,15 +700,107 @@ func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, loca
 	var (
 		ridServer *rid.Server
 		scdServer *scd.Server
-		auxServer = &aux.Server{}
+		auxServer = &aux.Server{
+			Summary:        summary.Default,
+			Databases:      databases,
+			Footprints:     map[string]aux.StorageFootprinter{},
+			Densities:      map[string]aux.DensityReporter{},
+			Locality:       locality,
+			APIs:           []aux.API{aux.RIDAPI},
+			Schemas:        map[string]aux.SchemaVersioner{},
+			ReadOnly:       &readonly.Mode{},
+			SchemaReadOnly: &readonly.Mode{},
+			Hotspots:       hotspots,
+		}
 	)
+	if *readOnly {
+		auxServer.ReadOnly.Enable("maintenance", *readOnlyRetry)
+	}
 
 	// Initialize remote ID
-	server, err := createRIDServer(ctx, locality, logger)
+	server, ridStore, err := createRIDServer(ctx, locality, logger)
 	if err != nil {
 		return stacktrace.Propagate(err, "Failed to create remote ID server")
 	}
 	ridServer = server
+	auxServer.Schemas[aux.RIDAPI.Name] = ridStore
+	auxServer.RID = ridStore
+	if auxServer.Limits, err = entityLimits(); err != nil {
+		return err
+	}
+	if h, ok := ridStore.(ridstore.HistoricalInteractor); ok && ridStore.Capabilities().History {
+		auxServer.RIDHistory = h
+	}
+	if *apiKeysFile != "" {
+		if *region == "" {
+			return stacktrace.NewError("--monitoring_api_keys_file requires --region, as API keys are only accepted for the region of this instance")
+		}
+		keys, err := auth.LoadAPIKeys(*apiKeysFile)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to load monitoring API keys")
+		}
+		auxServer.APIKeys = keys
+		auxServer.Region = *region
+	}
+	if f, ok := ridStore.(aux.StorageFootprinter); ok {
+		auxServer.Footprints[ridc.DatabaseName] = f
+	}
+	if d, ok := ridStore.(aux.DensityReporter); ok {
+		auxServer.Densities[ridc.DatabaseName] = d
+	}
+	var (
+		auditStore *audit.Store
+		auditQueue *audit.Queue
+	)
+	if *enableAuditLog {
+		if !storeBackend.Persistent() {
+			return stacktrace.NewError("--enable_audit_log requires --store_backend=cockroach")
+		}
+		auditStore, err = audit.NewStore(ctx, databases[ridc.DatabaseName], ridc.DatabaseName)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to create audit store")
+		}
+		auxServer.Audit = auditStore
+		auditQueue = audit.NewQueue(auditStore, logger)
+		auxServer.AuditLog = auditQueue
+	}
+	var journalStore *journal.Store
+	if *enableJournal {
+		if !storeBackend.Persistent() {
+			return stacktrace.NewError("--enable_request_journal requires --store_backend=cockroach")
+		}
+		if locality == "" {
+			return stacktrace.NewError("--enable_request_journal requires --locality to name the chain of this instance")
+		}
+		key, err := probe.ReadPrivateKey(*journalKeyFile)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to read request journal key")
+		}
+		journalStore, err = journal.NewStore(ctx, databases[ridc.DatabaseName], ridc.DatabaseName, locality, key)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to create request journal store")
+		}
+		auxServer.Journal = journalStore
+	}
+	var idempotencyStore idempotency.Store
+	if *idempotencyTTL > 0 {
+		idempotencyStore, err = createIdempotencyStore(ctx)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to create idempotency key store")
+		}
+	}
+	flagSet, err := features.Start(ctx, featureConfig, databases[ridc.DatabaseName], ridc.DatabaseName, logger)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to set up feature flags")
+	}
+	features.Default = flagSet
+	auxServer.Flags = flagSet
+	restrictionSet, err := restrictions.Start(ctx, restrictionConfig, databases[ridc.DatabaseName], ridc.DatabaseName, logger)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to set up write restrictions")
+	}
+	restrictions.Default = restrictionSet
+	auxServer.Restrictions = restrictionSet
 
 	scopesValidators := auth.MergeOperationsAndScopesValidators(
 		ridServer.AuthScopes(), auxServer.AuthScopes(),
@@ -211,12 +814,60 @@ func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, loca
 			return stacktrace.Propagate(err, "Failed to create strategic conflict detection server")
 		}
 		scdServer = server
+		auxServer.SCD = scdServer.Store
+		auxServer.APIs = append(auxServer.APIs, aux.SCDAPI)
+		if v, ok := scdServer.Store.(aux.SchemaVersioner); ok {
+			auxServer.Schemas[aux.SCDAPI.Name] = v
+		}
+		if h, ok := scdServer.Store.(scdstore.HistoricalInteractor); ok {
+			auxServer.SCDHistory = h
+		}
+		if f, ok := scdServer.Store.(aux.StorageFootprinter); ok {
+			auxServer.Footprints[scdc.DatabaseName] = f
+		}
+		if d, ok := scdServer.Store.(aux.DensityReporter); ok {
+			auxServer.Densities[scdc.DatabaseName] = d
+		}
+		if *constraintCache > 0 {
+			cache := scdstore.NewConstraintCache(scdServer.Store, *constraintCache)
+			if *cacheChangefeed && storeBackend.Persistent() {
+				consumer := &events.Consumer{
+					DB:     databases[scdc.DatabaseName],
+					Tables: []string{"scd_constraints"},
+					Sink:   cache,
+					Logger: logger.With(zap.String("database", scdc.DatabaseName)),
+				}
+				go consumer.Run(ctx)
+			}
+			scdServer.Store = cache
+		}
+		if timeouts := repoTimeouts(); timeouts != (dssmodels.Timeouts{}) {
+			scdServer.Store = scd.NewTimeoutStore(scdServer.Store, timeouts)
+		}
+		scdServer.Store = scd.NewHotspotStore(scdServer.Store, hotspots)
+		if auditStore != nil {
+			scdServer.Reports = auditStore
+		}
 
 		scopesValidators = auth.MergeOperationsAndScopesValidators(
 			scopesValidators, scdServer.AuthScopes(),
 		)
 	}
 
+	readOnlyReason, err := checkSchemas(ctx, auxServer.Schemas, logger)
+	if err != nil {
+		return err
+	}
+	if readOnlyReason != "" {
+		auxServer.SchemaReadOnly.Enable(readOnlyReason, 0)
+	}
+
+	if *eventsSink != "" {
+		if err := startChangefeeds(ctx, logger); err != nil {
+			return stacktrace.Propagate(err, "Failed to start entity change stream")
+		}
+	}
+
 	// Initialize access token validation
 	keyResolver, err := createKeyResolver()
 	switch {
@@ -238,18 +889,92 @@ func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, loca
 		return stacktrace.Propagate(err, "Error creating RSA authorizer")
 	}
 
+	auxServer.Authorizer = authorizer
+	if fake, ok := clock.(clockwork.FakeClock); ok {
+		auxServer.Clock = fake
+	}
+	if *idReservationTTL > 0 {
+		idStore, err := createIDStore(ctx, clock)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to create the store of ID reservations")
+		}
+		reserver := ids.NewReserver(idStore, clock, *idReservationTTL)
+		auxServer.IDs = reserver
+		ridServer.IDs = reserver
+		if scdServer != nil {
+			scdServer.IDs = reserver
+		}
+	}
+
+	dbRegion := databaseRegion()
+	if dbRegion != "" {
+		logger = logger.With(zap.String("db_region", dbRegion))
+		summary.Default.SetRegion(dbRegion)
+	}
+
 	// Set up server functionality
-	interceptors := []grpc.UnaryServerInterceptor{
-		uss_errors.Interceptor(logger),
-		logging.Interceptor(logger),
-		authorizer.AuthInterceptor,
-		validations.ValidationInterceptor,
+	pools := make(map[string]loadshed.StatsSource, len(databases))
+	for name, db := range databases {
+		pools[name] = db
+	}
+	accessLog := logging.AccessLogConfig{
+		RequestBodies:  *accessLogBodies,
+		RedactedFields: strings.Split(*accessLogRedact, ","),
+		SampleRate:     *accessLogSampling,
+	}
+	builtins := map[string]interceptors.Factory{
+		"access_log":    interceptors.Of(logging.AccessLogInterceptor(logger, accessLog), logging.AccessLogStreamInterceptor(logger, accessLog)),
+		"summary":       interceptors.Of(summary.Interceptor(summary.Default), summary.StreamInterceptor(summary.Default)),
+		"errors":        interceptors.Of(uss_errors.Interceptor(logger), uss_errors.StreamInterceptor(logger)),
+		"read_only":     readonly.Factory(auxServer.ReadOnly, auxServer.SchemaReadOnly),
+		"load_shedding": loadshed.Factory(shedConfig, pools, summary.Default),
+		"auth":          interceptors.Of(authorizer.AuthInterceptor, authorizer.AuthStreamInterceptor),
+		"validation":    interceptors.Of(validations.ValidationInterceptor, validations.StreamValidationInterceptor),
+		"telemetry":     interceptors.Of(telemetry.Interceptor(summary.Default), telemetry.StreamInterceptor(summary.Default)),
+	}
+	if *otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Configure(ctx, *otlpEndpoint, "dss-grpc-backend", dbRegion)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error configuring tracing")
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				logger.Warn("Failed to flush traces", zap.Error(err))
+			}
+		}()
+		builtins["tracing"] = interceptors.Of(otelgrpc.UnaryServerInterceptor(), otelgrpc.StreamServerInterceptor())
+	}
+	if *deprecationsFile != "" {
+		deprecations, err := deprecation.Load(*deprecationsFile)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to load deprecations")
+		}
+		builtins["deprecation"] = interceptors.Unary(deprecation.Interceptor(deprecations, summary.Default))
+	}
+	if auditQueue != nil {
+		builtins["audit"] = interceptors.Unary(audit.Interceptor(auditQueue, logger))
+	}
+	if journalStore != nil {
+		builtins["journal"] = interceptors.Unary(journal.Interceptor(journalStore, logger))
+	}
+	if idempotencyStore != nil {
+		builtins["idempotency"] = interceptors.Unary(idempotency.Interceptor(idempotencyStore, *idempotencyTTL, logger))
 	}
 	if *dumpRequests {
-		interceptors = append(interceptors, logging.DumpRequestResponseInterceptor(logger))
+		builtins["dump_requests"] = interceptors.Unary(logging.DumpRequestResponseInterceptor(logger))
+	}
+	unaryChain, streamChain, err := interceptorChain.Build(ctx, builtins, logger)
+	if err != nil {
+		return err
 	}
 
-	s := grpc.NewServer(grpc_middleware.WithUnaryServerChain(interceptors...))
+	if *grpcCompression {
+		compression.RegisterGRPC(summary.Default)
+	}
+	s := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(unaryChain...),
+		grpc_middleware.WithStreamServerChain(streamChain...),
+	)
 	if err != nil {
 		return stacktrace.Propagate(err, "Error creating new gRPC server")
 	}
@@ -259,34 +984,213 @@ func RunGRPCServer(ctx context.Context, ctxCanceler func(), address string, loca
 
 	logger.Info("build", zap.Any("description", build.Describe()))
 
+	summaryCron := cron.New()
+	if _, err := summaryCron.AddJob(*summarySchedule, SummaryJob{summary.Default, ctx}); err != nil {
+		return stacktrace.Propagate(err, "Failed to schedule activity summary")
+	}
+	summaryCron.Start()
+	defer summaryCron.Stop()
+
+	if *enableSLAProbe {
+		p, err := startSLAProbe(ctx, l.Addr(), logger)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to start SLA probe")
+		}
+		auxServer.Probe = p
+	}
+
+	if *ridNotifications {
+		d, err := startRIDNotifications(ctx, logger)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to start RID push notifications")
+		}
+		ridServer.Notifier = d
+		auxServer.Notifications = d
+	}
+
+	if *poolPeers != "" {
+		c, err := startPoolChecker(ctx, logger)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to start pool checker")
+		}
+		auxServer.Pool = c
+	}
+
+	if *auxHTTPAddress != "" {
+		auxHTTPServer := &http.Server{
+			Addr:    *auxHTTPAddress,
+			Handler: auxServer.HTTPHandler(),
+		}
+		go func() {
+			if err := auxHTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Failed to serve auxiliary HTTP endpoints", zap.Error(err))
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			if err := auxHTTPServer.Shutdown(context.Background()); err != nil {
+				logger.Warn("Failed to shut down auxiliary HTTP server", zap.Error(err))
+			}
+		}()
+	}
+
 	ridpb.RegisterDiscoveryAndSynchronizationServiceServer(s, ridServer)
+	s.RegisterService(&rid.StreamingServiceDesc, ridServer)
 	auxpb.RegisterDSSAuxServiceServer(s, auxServer)
+	logger.Info("config", zap.Any("rid_store_capabilities", ridStore.Capabilities()))
+	if !ridStore.Capabilities().Pagination {
+		logger.Warn("The remote ID store does not paginate; streamed ISA searches are read all at once")
+	}
 	if *enableSCD {
 		logger.Info("config", zap.Any("scd", "enabled"))
+		logger.Info("config", zap.Any("scd_store_capabilities", scdServer.Store.Capabilities()))
 		scdpb.RegisterUTMAPIUSSDSSAndUSSUSSServiceServer(s, scdServer)
+		s.RegisterService(&scd.StreamingServiceDesc, scdServer)
 	} else {
 		logger.Info("config", zap.Any("scd", "disabled"))
 	}
 
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(signals)
 
+	stopped := make(chan struct{})
 	go func() {
-		defer s.GracefulStop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("stopping server due to context having been canceled")
-				return
-			case s := <-signals:
-				logger.Info("received OS signal", zap.Stringer("signal", s))
-				ctxCanceler()
-			}
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping server due to context having been canceled")
+		case s := <-signals:
+			logger.Info("received OS signal", zap.Stringer("signal", s))
+			ctxCanceler()
+		}
+		stopServer(s, *shutdownGrace, logger)
+	}()
+	err = s.Serve(l)
+
+	// Serve returns as soon as the server stops accepting connections; the
+	// in-flight requests must be drained before the connections they use are
+	// closed.
+	ctxCanceler()
+	<-stopped
+	if auditQueue != nil {
+		auditQueue.Close()
+	}
+	closeDatabases(logger)
+	return err
+}
+
+// startSLAProbe starts probing the API served at address, as configured by
+// the sla_probe_* flags, until ctx is done.
+func startSLAProbe(ctx context.Context, address net.Addr, logger *zap.Logger) (*probe.Probe, error) {
+	key, err := probe.ReadPrivateKey(*slaProbeKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid listening address %s", address)
+	}
+	client, err := probe.NewClient(ctx, net.JoinHostPort("localhost", port))
+	if err != nil {
+		return nil, err
+	}
+	p := &probe.Probe{
+		Client: client,
+		Token:  probe.TokenSource(key, strings.Split(*jwtAudiences, ",")[0], probe.Manager, clock),
+		Clock:  clock,
+		Logger: logger.With(zap.String("manager", probe.Manager)),
+	}
+	go p.Run(ctx, *slaProbePeriod)
+	return p, nil
+}
+
+// startRIDNotifications starts delivering the ISA notifications, as
+// configured by the rid_notification_* flags, until ctx is done.
+func startRIDNotifications(ctx context.Context, logger *zap.Logger) (*notifications.Dispatcher, error) {
+	d := &notifications.Dispatcher{
+		Client: &http.Client{Timeout: *timeout},
+		Retry: notifications.RetryPolicy{
+			MaxAttempts:    *notifyAttempts,
+			InitialBackoff: time.Second,
+			MaxBackoff:     30 * time.Second,
+		},
+		Breaker: notifications.BreakerPolicy{
+			Threshold: *notifyThreshold,
+			Cooldown:  *notifyCooldown,
+		},
+		Clock:  clock,
+		Logger: logger.With(zap.String("manager", notifications.Manager)),
+	}
+	if *notifyKeyFile != "" {
+		key, err := probe.ReadPrivateKey(*notifyKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		d.Token = func(audience string) (string, error) {
+			return probe.TokenSource(key, audience, notifications.Manager, clock)()
 		}
+	}
+	// Deliveries mostly wait on subscribers, so that a few workers keep up
+	// with the write rate of a DSS instance.
+	d.Start(ctx, 8)
+	return d, nil
+}
+
+// startPoolChecker starts checking the convergence of the DSS instances of
+// pool_peers, as configured by the pool_check_* flags, until ctx is done.
+func startPoolChecker(ctx context.Context, logger *zap.Logger) (*pool.Checker, error) {
+	key, err := probe.ReadPrivateKey(*poolCheckKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	for _, peer := range strings.Split(*poolPeers, ",") {
+		if _, err := url.ParseRequestURI(peer); err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid pool peer %s", peer)
+		}
+		peers = append(peers, strings.TrimSuffix(peer, "/"))
+	}
+	c := &pool.Checker{
+		Peers:  peers,
+		Client: &http.Client{Timeout: *timeout},
+		Token: func(audience string) (string, error) {
+			return probe.TokenSource(key, audience, pool.Manager, clock)()
+		},
+		Clock:    clock,
+		Logger:   logger.With(zap.String("manager", pool.Manager)),
+		Recorder: summary.Default,
+	}
+	go c.Run(ctx, *poolCheckPeriod)
+	return c, nil
+}
+
+// stopServer stops s from accepting new requests and waits for the
+// in-flight ones to complete for up to grace. Past grace, the contexts of the
+// remaining requests are canceled, which rolls back their transactions.
+func stopServer(s *grpc.Server, grace time.Duration, logger *zap.Logger) {
+	drained := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(drained)
 	}()
-	return s.Serve(l)
+	select {
+	case <-drained:
+	case <-time.After(grace):
+		logger.Warn("Shutdown grace period elapsed, canceling in-flight requests", zap.Duration("grace", grace))
+		s.Stop()
+		<-drained
+	}
+}
+
+// closeDatabases closes the connection pools established by connectTo.
+func closeDatabases(logger *zap.Logger) {
+	for name, db := range databases {
+		if err := db.Close(); err != nil {
+			logger.Warn("Failed to close database connection pool", zap.String("database", name), zap.Error(err))
+		}
+	}
 }
 
 type RIDGarbageCollectorJob struct {
@@ -305,6 +1209,103 @@ func (gcj RIDGarbageCollectorJob) Run() {
 	}
 }
 
+// SCDIntegrityJob alerts on, and optionally quarantines, the operational
+// intents of store failing its integrity check.
+type SCDIntegrityJob struct {
+	store      *scdc.Store
+	maxCells   int
+	quarantine bool
+	recorder   *summary.Recorder
+	ctx        context.Context
+}
+
+func (j SCDIntegrityJob) Run() {
+	logger := logging.WithValuesFromContext(j.ctx, logging.Logger)
+	violations, err := j.store.CheckIntegrity(j.ctx, j.maxCells)
+	if err != nil {
+		logger.Warn("Failed to check the integrity of operational intents", zap.Error(err))
+		return
+	}
+	counts := map[string]int{}
+	for _, v := range violations {
+		counts[v.Violation]++
+		logger.Error("Corrupt operational intent",
+			zap.String("alert", "scd_integrity"),
+			zap.String("id", v.ID.String()),
+			zap.String("manager", v.Manager.String()),
+			zap.String("violation", v.Violation),
+			zap.Int("cells", v.Cells))
+		if !j.quarantine {
+			continue
+		}
+		quarantined, err := j.store.Quarantine(j.ctx, v)
+		switch {
+		case err != nil:
+			logger.Warn("Failed to quarantine operational intent", zap.String("id", v.ID.String()), zap.Error(err))
+		case quarantined:
+			logger.Info("Quarantined operational intent", zap.String("id", v.ID.String()))
+		default:
+			logger.Info("Operational intent no longer corrupt, not quarantined", zap.String("id", v.ID.String()))
+		}
+	}
+	for violation, n := range counts {
+		j.recorder.RecordIntegrityViolations(violation, n)
+	}
+}
+
+// SCDHistoryPurgeJob purges the versions of the operational intents and
+// constraints of store written more than retention ago, but for the current
+// ones.
+type SCDHistoryPurgeJob struct {
+	store     *scdc.Store
+	retention time.Duration
+	ctx       context.Context
+}
+
+func (j SCDHistoryPurgeJob) Run() {
+	logger := logging.WithValuesFromContext(j.ctx, logging.Logger)
+	purged, err := j.store.PurgeVersions(j.ctx, clock.Now().Add(-j.retention))
+	if err != nil {
+		logger.Warn("Failed to purge entity history", zap.Error(err))
+		return
+	}
+	logger.Info("Purged entity history", zap.Int64("versions", purged))
+}
+
+// SCDExpiryJob notifies the USSs managing subscriptions about to expire.
+type SCDExpiryJob struct {
+	scanner *scd.ExpiryScanner
+	ctx     context.Context
+}
+
+func (j SCDExpiryJob) Run() {
+	if err := j.scanner.Scan(j.ctx); err != nil {
+		logger := logging.WithValuesFromContext(j.ctx, logging.Logger)
+		logger.Warn("Failed to scan expiring subscriptions", zap.Error(err))
+	}
+}
+
+// SummaryJob closes the current reporting period of recorder and logs the
+// resulting summary.
+type SummaryJob struct {
+	recorder *summary.Recorder
+	ctx      context.Context
+}
+
+func (sj SummaryJob) Run() {
+	logger := logging.WithValuesFromContext(sj.ctx, logging.Logger)
+	logger.Info("Activity summary", zap.Any("summary", sj.recorder.Rotate()))
+}
+
+func init() {
+	featureConfig.RegisterFlags(flag.CommandLine)
+	restrictionConfig.RegisterFlags(flag.CommandLine)
+	shedConfig.RegisterFlags(flag.CommandLine)
+	hotspotConfig.RegisterFlags(flag.CommandLine)
+	backendConfig.RegisterFlags(flag.CommandLine)
+	interceptorChain.RegisterFlags(flag.CommandLine)
+}
+
 func main() {
 	flag.Parse()
 
@@ -318,6 +1319,28 @@ func main() {
 	)
 	defer cancel()
 
+	if *timePrecision < dssmodels.DefaultTimePrecision {
+		logger.Panic("--time_precision is finer than the timestamps stored", zap.Duration("time_precision", *timePrecision))
+	}
+	dssmodels.RequestTimes.Precision = *timePrecision
+
+	if *simulatedTime {
+		fake := clockwork.NewFakeClockAt(time.Now())
+		clock = fake
+		application.DefaultClock = fake
+		ridc.DefaultClock = fake
+		scdc.DefaultClock = fake
+		scd.DefaultClock = fake
+		logger.Warn("Time is simulated and only advances through the aux clock endpoint", zap.Time("now", fake.Now()))
+	}
+
+	var err error
+	if storeBackend, err = backend.New(backendConfig, connectTo, clock, logger, summary.Default); err != nil {
+		logger.Panic("Failed to select the store backend", zap.Error(err))
+	}
+	hotspots = hotspot.New(clock, hotspotConfig)
+	summary.Default.SetHotspots(hotspots)
+
 	if *profServiceName != "" {
 		if err := profiler.Start(profiler.Config{
 			Service: *profServiceName,
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startBlockingServer serves health checks which each block until release
+// is closed or their context is canceled, reporting the error of the latter
+// on canceled.
+func startBlockingServer(t *testing.T, release <-chan struct{}, canceled chan<- error) (*grpc.Server, grpc_health_v1.HealthClient) {
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		select {
+		case <-release:
+			return handler(ctx, req)
+		case <-ctx.Done():
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		}
+	}))
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return s, grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestStopServerDrainsRequests(t *testing.T) {
+	var (
+		release  = make(chan struct{})
+		canceled = make(chan error, 1)
+		s, c     = startBlockingServer(t, release, canceled)
+		result   = make(chan error, 1)
+	)
+	go func() {
+		_, err := c.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		result <- err
+	}()
+	// Let the request reach the server before stopping it.
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		stopServer(s, time.Minute, zap.NewNop())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Server stopped with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-result)
+	<-stopped
+	require.Empty(t, canceled)
+}
+
+func TestStopServerCancelsRequestsPastGrace(t *testing.T) {
+	var (
+		canceled = make(chan error, 1)
+		s, c     = startBlockingServer(t, make(chan struct{}), canceled)
+		result   = make(chan error, 1)
+	)
+	go func() {
+		_, err := c.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		result <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	stopServer(s, 100*time.Millisecond, zap.NewNop())
+	require.Equal(t, context.Canceled, <-canceled)
+	require.Error(t, <-result)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,12 +19,23 @@ import (
 	"github.com/interuss/dss/pkg/api/v1/ridpb"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	"github.com/interuss/dss/pkg/build"
+	"github.com/interuss/dss/pkg/compression"
+	"github.com/interuss/dss/pkg/deprecation"
 	"github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/httpheaders"
+	"github.com/interuss/dss/pkg/idempotency"
 	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/openapi"
+	"github.com/interuss/dss/pkg/readonly"
+	"github.com/interuss/dss/pkg/rid/adapter"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/summary"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/interuss/stacktrace"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
@@ -36,8 +48,33 @@ var (
 	grpcBackend     = flag.String("grpc-backend", "", "Endpoint for grpc backend. Only to be set if run in proxy mode")
 	profServiceName = flag.String("gcp_prof_service_name", "", "Service name for the Go profiler")
 	enableSCD       = flag.Bool("enable_scd", false, "Enables the Strategic Conflict Detection API")
+	openAPIDir      = flag.String("openapi_dir", "", "Directory containing the <api>.swagger.json specifications to serve under /openapi/; disabled if empty")
+	strictJSON      = flag.Bool("strict_json", false, "Rejects JSON request payloads containing unknown fields instead of ignoring them")
+	enableRIDV2     = flag.Bool("enable_rid_v2", false, "Additionally serves the F3411-22a remote ID API under /rid/v2/dss/ from the same data as the F3411-19 API")
+	shutdownGrace   = flag.Duration("shutdown_grace_period", 20*time.Second, "How long in-flight requests are waited for when shutting down before their connections are closed")
+	compressAbove   = flag.Int("compression_threshold", 8192, "size in bytes from which responses are compressed with gzip or deflate, as accepted by clients; disabled if negative")
+	summaryPeriod   = flag.Duration("summary_period", 24*time.Hour, "period at which the activity summary of the gateway, such as the compression of responses, is produced and logged")
+	publicURL       = flag.String("public_url", "", "Base URL at which clients reach this instance, used as server URL in served OpenAPI specifications; derived from requests if empty")
+	corsOrigins     = flag.String("cors_allowed_origins", "", "Comma-separated origins (e.g., https://dashboard.example.com), or *, from which browsers may call the gateway; CORS is disabled if empty")
+	corsHeaders     = flag.String("cors_allowed_headers", strings.Join(defaultCORSHeaders, ","), "Comma-separated request headers which cross-origin requests may carry")
+	corsMaxAge      = flag.Duration("cors_max_age", 10*time.Minute, "How long browsers may cache the response to a CORS preflight request")
+	securityHeaders = flag.Bool("security_headers", true, "Adds headers keeping browsers from sniffing, framing or leaking the URLs of responses")
+	hstsMaxAge      = flag.Duration("hsts_max_age", 0, "With security_headers, how long browsers must reach the gateway over HTTPS only, through Strict-Transport-Security; disabled if zero")
+	timePrecision   = flag.Duration("time_precision", dssmodels.DefaultTimePrecision, "Finest resolution of the timestamps accepted in requests, which are rejected if more precise")
+	allowOffsets    = flag.Bool("allow_time_offsets", false, "Accepts timestamps with a UTC offset other than Z, as F3411 and F3548 disallow, converting them to UTC")
 )
 
+// dssHeaders are the DSS-specific request headers.
+var dssHeaders = []string{dssmodels.SearchOrderHeader, dssmodels.IncludeExpiredHeader, scdmodels.StatesHeader, scdmodels.ManagersHeader, scdmodels.ConstraintTypeHeader, scdmodels.ConstraintTypesHeader, idempotency.Header}
+
+// standardHeaders are the response headers set by the backend as gRPC
+// header metadata which are forwarded as standard HTTP headers.
+var standardHeaders = append([]string{readonly.RetryAfterHeader}, deprecation.Headers...)
+
+// defaultCORSHeaders are the request headers of the APIs served by the
+// gateway.
+var defaultCORSHeaders = append([]string{"Authorization", "Content-Type"}, dssHeaders...)
+
 // RunHTTPProxy starts the HTTP proxy for the DSS gRPC service on ctx, listening
 // on address, proxying to endpoint.
 func RunHTTPProxy(ctx context.Context, ctxCanceler func(), address, endpoint string) error {
@@ -45,19 +82,26 @@ func RunHTTPProxy(ctx context.Context, ctxCanceler func(), address, endpoint str
 		zap.String("address", address), zap.String("endpoint", endpoint),
 	)
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	// The connections to the gRPC backend outlive ctx so that the requests
+	// in flight when shutting down may complete.
+	connCtx, closeConns := context.WithCancel(context.Background())
+	defer closeConns()
 
 	runtime.HTTPError = myHTTPError
 
 	// Register gRPC server endpoint
 	// Note: Make sure the gRPC server is running properly and accessible
+	var marshaler runtime.Marshaler = &runtime.JSONPb{
+		OrigName:     true,
+		EmitDefaults: true, // Include empty JSON arrays.
+		Indent:       "  ",
+	}
+	marshaler = &strictJSONPb{JSONPb: marshaler.(*runtime.JSONPb), rejectUnknown: *strictJSON}
+	marshaler = &telemetryMarshaler{Marshaler: marshaler}
 	grpcMux := runtime.NewServeMux(
-		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
-			OrigName:     true,
-			EmitDefaults: true, // Include empty JSON arrays.
-			Indent:       "  ",
-		}),
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
 	)
 
 	opts := []grpc.DialOption{
@@ -67,28 +111,60 @@ func RunHTTPProxy(ctx context.Context, ctxCanceler func(), address, endpoint str
 		grpc.WithTimeout(10 * time.Second),
 	}
 
-	if err := ridpb.RegisterDiscoveryAndSynchronizationServiceHandlerFromEndpoint(ctx, grpcMux, endpoint, opts); err != nil {
+	if err := ridpb.RegisterDiscoveryAndSynchronizationServiceHandlerFromEndpoint(connCtx, grpcMux, endpoint, opts); err != nil {
 		return err
 	}
 
-	if err := auxpb.RegisterDSSAuxServiceHandlerFromEndpoint(ctx, grpcMux, endpoint, opts); err != nil {
+	if err := auxpb.RegisterDSSAuxServiceHandlerFromEndpoint(connCtx, grpcMux, endpoint, opts); err != nil {
 		return err
 	}
+	apis := []string{"aux_service", "rid"}
 
 	if *enableSCD {
-		if err := scdpb.RegisterUTMAPIUSSDSSAndUSSUSSServiceHandlerFromEndpoint(ctx, grpcMux, endpoint, opts); err != nil {
+		if err := scdpb.RegisterUTMAPIUSSDSSAndUSSUSSServiceHandlerFromEndpoint(connCtx, grpcMux, endpoint, opts); err != nil {
 			return err
 		}
+		apis = append(apis, "scd")
 		logger.Info("config", zap.Any("scd", "enabled"))
 	} else {
 		logger.Info("config", zap.Any("scd", "disabled"))
 	}
 
+	var ridV2Handler http.Handler
+	if *enableRIDV2 {
+		conn, err := grpc.DialContext(connCtx, endpoint, opts...)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error dialing gRPC backend for remote ID v2")
+		}
+		defer conn.Close()
+		ridV2Handler = adapter.NewV2Handler(
+			ridpb.NewDiscoveryAndSynchronizationServiceClient(conn),
+			func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+				myHTTPError(ctx, grpcMux, marshaler, w, r, err)
+			},
+			dssmodels.SearchOrderHeader, dssmodels.IncludeExpiredHeader,
+		)
+		logger.Info("config", zap.Any("rid_v2", "enabled"))
+	}
+
+	var openAPIHandler http.Handler
+	if *openAPIDir != "" {
+		h, err := openapi.NewHandler(*openAPIDir, *publicURL, apis)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error loading OpenAPI specifications")
+		}
+		openAPIHandler = h
+	}
+
 	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/healthy" {
 			if _, err := w.Write([]byte("ok")); err != nil {
 				logger.Error("Error writing to /healthy")
 			}
+		} else if openAPIHandler != nil && strings.HasPrefix(r.URL.Path, openapi.PathPrefix) {
+			openAPIHandler.ServeHTTP(w, r)
+		} else if ridV2Handler != nil && strings.HasPrefix(r.URL.Path, adapter.V2PathPrefix) {
+			ridV2Handler.ServeHTTP(w, r)
 		} else {
 			grpcMux.ServeHTTP(w, r)
 		}
@@ -97,10 +173,38 @@ func RunHTTPProxy(ctx context.Context, ctxCanceler func(), address, endpoint str
 	if *traceRequests {
 		handler = logging.HTTPMiddleware(logger, handler)
 	}
+	if *compressAbove >= 0 {
+		handler = compression.Handler(handler, *compressAbove, summary.Default)
+	}
+	if origins := httpheaders.SplitList(*corsOrigins); len(origins) > 0 {
+		handler = httpheaders.CORS(handler, httpheaders.CORSPolicy{
+			AllowedOrigins: origins,
+			AllowedHeaders: httpheaders.SplitList(*corsHeaders),
+			ExposedHeaders: standardHeaders,
+			MaxAge:         *corsMaxAge,
+		})
+		logger.Info("config", zap.Strings("cors_allowed_origins", origins))
+	}
+	if *securityHeaders {
+		handler = httpheaders.Security(handler, *hstsMaxAge)
+	}
 
 	logger.Info("build", zap.Any("description", build.Describe()))
 
-	signals := make(chan os.Signal)
+	go func() {
+		ticker := time.NewTicker(*summaryPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				logger.Info("Activity summary", zap.Any("summary", summary.Default.Rotate()))
+			}
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(signals)
 
@@ -109,27 +213,37 @@ func RunHTTPProxy(ctx context.Context, ctxCanceler func(), address, endpoint str
 		Handler: handler,
 	}
 
+	stopped := make(chan struct{})
 	go func() {
-		defer func() {
-			if err := server.Shutdown(context.Background()); err != nil {
-				logger.Warn("failed to shut down http server", zap.Error(err))
-			}
-		}()
+		defer close(stopped)
 
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("stopping server due to context having been canceled")
-				return
-			case s := <-signals:
-				logger.Info("received OS signal", zap.Stringer("signal", s))
-				ctxCanceler()
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping server due to context having been canceled")
+		case s := <-signals:
+			logger.Info("received OS signal", zap.Stringer("signal", s))
+		}
+		// Stop accepting requests and wait for the in-flight ones for up to
+		// the grace period, past which their connections are closed, which
+		// cancels their calls to the gRPC backend.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Shutdown grace period elapsed, closing in-flight requests", zap.Duration("grace", *shutdownGrace), zap.Error(err))
+			if err := server.Close(); err != nil {
+				logger.Warn("failed to close http server", zap.Error(err))
 			}
 		}
+		ctxCanceler()
 	}()
 
 	// Start HTTP server (and proxy calls to gRPC server endpoint)
-	return server.ListenAndServe()
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		// ListenAndServe returns as soon as Shutdown is called.
+		<-stopped
+	}
+	return err
 }
 
 func myCodeToHTTPStatus(code codes.Code) int {
@@ -173,6 +287,8 @@ func myCodeToHTTPStatus(code codes.Code) int {
 		return http.StatusRequestEntityTooLarge
 	case codes.Code(uint16(errors.MissingOVNs)):
 		return http.StatusConflict
+	case codes.Code(uint16(errors.InvalidID)):
+		return http.StatusBadRequest
 	}
 
 	grpclog.Warningf("Unknown gRPC error code: %v", code)
@@ -208,6 +324,16 @@ func myHTTPError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.M
 	}
 	w.Header().Set("Content-Type", contentType)
 
+	// The backend serves the messages of errors in the language negotiated
+	// with Accept-Language, if not the default one.
+	message := s.Message()
+	for _, detail := range s.Details() {
+		if localized, ok := detail.(*errdetails.LocalizedMessage); ok {
+			w.Header().Set("Content-Language", localized.Locale)
+			message = localized.Message
+		}
+	}
+
 	// Marshal error content into buf
 	var buf []byte
 	var marshalingErr error
@@ -226,8 +352,9 @@ func myHTTPError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.M
 			}
 		}
 		handled = true
-	} else if len(s.Details()) == 1 {
-		// Handle explicit error responses
+	} else if len(s.Details()) >= 1 {
+		// Handle explicit error responses; further details are only of use
+		// to gRPC clients.
 		result, ok := s.Details()[0].(*auxpb.StandardErrorResponse)
 		if ok {
 			buf, marshalingErr = marshaler.Marshal(result)
@@ -236,10 +363,16 @@ func myHTTPError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.M
 		}
 	}
 	if !handled {
-		// Default error-handling schema
+		// Default error-handling schema, identified by the ID of the error in
+		// the backend if it has one.
+		for _, detail := range s.Details() {
+			if info, ok := detail.(*errdetails.RequestInfo); ok {
+				errID = info.RequestId
+			}
+		}
 		body := &auxpb.StandardErrorResponse{
 			Error:   s.Message(),
-			Message: s.Message(),
+			Message: message,
 			Code:    int32(s.Code()),
 			ErrorId: errID,
 		}
@@ -277,9 +410,45 @@ func myHTTPError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.M
 	handleForwardResponseTrailer(w, md)
 }
 
+// incomingHeaderMatcher forwards the DSS-specific request headers to the
+// backend in addition to the ones forwarded by default.
+func incomingHeaderMatcher(key string) (string, bool) {
+	for _, h := range dssHeaders {
+		if strings.EqualFold(key, h) {
+			return h, true
+		}
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher forwards the headers signaling the deprecation of
+// the called method or when to retry it as standard HTTP headers, and the
+// other response metadata prefixed as by default.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if h, ok := standardHeader(key); ok {
+		return h, true
+	}
+	return fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, key), true
+}
+
+// standardHeader returns the HTTP header carrying the response metadata key
+// if it is one of standardHeaders.
+func standardHeader(key string) (string, bool) {
+	for _, h := range standardHeaders {
+		if strings.EqualFold(key, h) {
+			return textproto.CanonicalMIMEHeaderKey(h), true
+		}
+	}
+	return "", false
+}
+
 func handleForwardResponseServerMetadata(w http.ResponseWriter, mux *runtime.ServeMux, md runtime.ServerMetadata) {
 	for k, vs := range md.HeaderMD {
-		if h, ok := runtime.DefaultHeaderMatcher(k); ok {
+		h, ok := standardHeader(k)
+		if !ok {
+			h, ok = runtime.DefaultHeaderMatcher(k)
+		}
+		if ok {
 			for _, v := range vs {
 				w.Header().Add(h, v)
 			}
@@ -310,6 +479,7 @@ func main() {
 		logger      = logging.WithValuesFromContext(ctx, logging.Logger)
 	)
 	defer cancel()
+	dssmodels.RequestTimes = dssmodels.TimeChecks{Precision: *timePrecision, AllowOffsets: *allowOffsets}
 
 	if *profServiceName != "" {
 		err := profiler.Start(
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var unknownFieldRegexp = regexp.MustCompile(`unknown field "([^"]+)" in ([\w.]+)`)
+
+// strictJSONPb is a runtime.Marshaler that rejects request payloads
+// containing timestamps not accepted by dssmodels.RequestTimes and, if
+// rejectUnknown, fields unknown to the target message.
+type strictJSONPb struct {
+	*runtime.JSONPb
+	rejectUnknown bool
+}
+
+// NewDecoder returns a runtime.Decoder failing on unknown fields with an
+// error naming the offending field and, if any, the closest known field, and
+// on timestamps not accepted with an error naming the offending timestamp.
+func (m *strictJSONPb) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		msg, ok := v.(proto.Message)
+		if !ok {
+			// Bodies mapped to a message field are decoded into a pointer to
+			// that field.
+			rv := reflect.ValueOf(v)
+			if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+				if rv.Elem().IsNil() {
+					rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+				}
+				msg, ok = rv.Elem().Interface().(proto.Message)
+			}
+		}
+		if !ok {
+			return m.JSONPb.NewDecoder(r).Decode(v)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		unmarshaler := &jsonpb.Unmarshaler{AllowUnknownFields: !m.rejectUnknown, AnyResolver: m.AnyResolver}
+		if err := unmarshaler.Unmarshal(bytes.NewReader(body), msg); err != nil {
+			return describeUnknownField(err)
+		}
+		// jsonpb accepts any UTC offset and converts timestamps to protos
+		// without their offset, so the timestamps are checked as sent.
+		var raw interface{}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return err
+		}
+		return checkTimestamps(raw, proto.MessageReflect(msg).Descriptor())
+	})
+}
+
+// describeUnknownField turns an unknown field error from jsonpb into an
+// error suggesting the closest known field. The gateway reports decoding
+// errors as InvalidArgument.
+func describeUnknownField(err error) error {
+	match := unknownFieldRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	field, msgName := match[1], match[2]
+	message := fmt.Sprintf("Unknown field %q in %s", field, msgName)
+	if suggestion := closestField(field, protoreflect.FullName(msgName)); suggestion != "" {
+		message += fmt.Sprintf("; did you mean %q?", suggestion)
+	}
+	return errors.New(message)
+}
+
+// closestField returns the field of message msgName whose name is closest
+// to field, or the empty string if no field is reasonably close.
+func closestField(field string, msgName protoreflect.FullName) string {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(msgName)
+	if err != nil {
+		return ""
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return ""
+	}
+	var (
+		best     string
+		bestDist = len(field)/2 + 1
+	)
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		name := string(fields.Get(i).Name())
+		if dist := editDistance(field, name); dist < bestDist {
+			best, bestDist = name, dist
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(rejectUnknown bool, body string, v interface{}) error {
+	m := &strictJSONPb{JSONPb: &runtime.JSONPb{OrigName: true}, rejectUnknown: rejectUnknown}
+	return m.NewDecoder(strings.NewReader(body)).Decode(v)
+}
+
+func TestStrictJSONPbUnknownFields(t *testing.T) {
+	body := `{"uss_base_ur": "https://uss1.example.com"}`
+
+	params := &scdpb.PutSubscriptionParameters{}
+	err := decode(true, body, params)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `Unknown field "uss_base_ur"`)
+	require.Contains(t, err.Error(), `did you mean "uss_base_url"?`)
+
+	// Fields far from any known field get no suggestion.
+	err = decode(true, `{"flights": true}`, params)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "did you mean")
+
+	require.NoError(t, decode(false, body, params))
+}
+
+func TestStrictJSONPbTimestamps(t *testing.T) {
+	body := func(value string) string {
+		return `{"extents": {"time_start": {"format": "RFC3339", "value": "` + value + `"}}, "uss_base_url": "https://uss1.example.com"}`
+	}
+
+	params := &scdpb.PutSubscriptionParameters{}
+	require.NoError(t, decode(true, body("2021-03-04T05:06:07.123456Z"), params))
+	require.Equal(t, "https://uss1.example.com", params.UssBaseUrl)
+	require.Equal(t, int32(123456000), params.Extents.TimeStart.Value.Nanos)
+
+	err := decode(true, body("2021-03-04T05:06:07+01:00"), &scdpb.PutSubscriptionParameters{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `Invalid value "2021-03-04T05:06:07+01:00"`)
+
+	err = decode(true, body("2021-03-04T05:06:07.1234567Z"), &scdpb.PutSubscriptionParameters{})
+	require.Error(t, err)
+}
+
+func TestStrictJSONPbBodyField(t *testing.T) {
+	// Bodies mapped to a message field are decoded into a pointer to that
+	// field, which is allocated if needed.
+	var params *scdpb.PutSubscriptionParameters
+	require.NoError(t, decode(true, `{"uss_base_url": "https://uss1.example.com"}`, &params))
+	require.NotNil(t, params)
+	require.Equal(t, "https://uss1.example.com", params.UssBaseUrl)
+
+	err := decode(true, `{"uss_base_urls": "https://uss1.example.com"}`, &params)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `did you mean "uss_base_url"?`)
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("extents", "extents"))
+	require.Equal(t, 1, editDistance("extent", "extents"))
+	require.Equal(t, 1, editDistance("extants", "extents"))
+	require.Equal(t, 3, editDistance("", "abc"))
+	require.Equal(t, 3, editDistance("kitten", "sitting"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/interuss/dss/pkg/telemetry"
+)
+
+// telemetryMarshaler is a runtime.Marshaler rejecting request payloads with
+// fields resembling telemetry, which would otherwise be silently dropped
+// as unknown to the API before reaching the backend.
+type telemetryMarshaler struct {
+	runtime.Marshaler
+}
+
+// NewDecoder returns a runtime.Decoder failing on fields resembling
+// telemetry with an error naming the offending field.
+func (m *telemetryMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var payload interface{}
+		if err := json.Unmarshal(body, &payload); err == nil {
+			if field := telemetryField(payload); field != "" {
+				return fmt.Errorf("Field %q resembles telemetry, which the DSS does not accept", field)
+			}
+		}
+		return m.Marshaler.NewDecoder(bytes.NewReader(body)).Decode(v)
+	})
+}
+
+// telemetryField returns the first key of the JSON value v resembling
+// telemetry, or the empty string if there is none.
+func telemetryField(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if telemetry.IsTelemetryField(key) {
+				return key
+			}
+			if field := telemetryField(value); field != "" {
+				return field
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if field := telemetryField(value); field != "" {
+				return field
+			}
+		}
+	}
+	return ""
+}
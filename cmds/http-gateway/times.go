@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+// checkTimestamps returns an error naming the first timestamp of v, the
+// JSON payload of a message md, not accepted by dssmodels.RequestTimes.
+func checkTimestamps(v interface{}, md protoreflect.MessageDescriptor) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fields := md.Fields()
+	for name, value := range obj {
+		fd := fields.ByJSONName(name)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(name))
+		}
+		if fd == nil || fd.Message() == nil || fd.IsMap() {
+			continue
+		}
+		values := []interface{}{value}
+		if fd.IsList() {
+			values, _ = value.([]interface{})
+		}
+		for _, value := range values {
+			if fd.Message().FullName() != timestampName {
+				if err := checkTimestamps(value, fd.Message()); err != nil {
+					return err
+				}
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if _, err := dssmodels.RequestTimes.Parse(s); err != nil {
+				expected := "RFC3339 time in UTC (Z)"
+				if dssmodels.RequestTimes.AllowOffsets {
+					expected = "RFC3339 time"
+				}
+				return fmt.Errorf("Invalid %s %q: %s no more precise than %s expected",
+					fd.Name(), s, expected, *timePrecision)
+			}
+		}
+	}
+	return nil
+}
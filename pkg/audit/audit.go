@@ -0,0 +1,136 @@
+// Package audit persists a trail of the changes requested through the API
+// and of the DSS reports filed by USSs, and searches them on behalf of pool
+// operators so that investigations do not require direct access to the
+// database.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+)
+
+const (
+	// DefaultLimit is the number of results returned by a search that does
+	// not specify a limit.
+	DefaultLimit = 100
+	// MaxLimit is the maximum number of results returned by a search.
+	MaxLimit = 1000
+)
+
+// Record is an entry of the audit log: a call to a method of the API
+// changing the state of the DSS.
+type Record struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Manager  string    `json:"manager"`
+	EntityID string    `json:"entity_id,omitempty"`
+	// Code is the gRPC status code returned to the caller.
+	Code string `json:"code"`
+	// Details is the error message returned to the caller, if any.
+	Details string `json:"details,omitempty"`
+}
+
+// Report is a DSS report filed by Manager about an exchange with the DSS.
+type Report struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Manager string    `json:"manager"`
+	// ResponseCode is the HTTP status code of the reported exchange.
+	ResponseCode int32 `json:"response_code"`
+	// Details is the report as filed, in JSON.
+	Details json.RawMessage `json:"details"`
+}
+
+// ReportCount is the number of DSS reports with ResponseCode filed during the
+// interval starting at Start.
+type ReportCount struct {
+	Start        time.Time `json:"start"`
+	ResponseCode int32     `json:"response_code"`
+	Count        int64     `json:"count"`
+}
+
+// Query selects the records or reports matching all its non-zero fields.
+// Every field is compared for equality with an indexed column.
+type Query struct {
+	Manager string
+	// EntityID matches the entity of a Record, or the first UUID, in lower
+	// case, of the URL of the exchange reported by a Report.
+	EntityID string
+	// Code matches the gRPC status code of a Record, e.g. "NotFound".
+	Code string
+	// ResponseCode matches the HTTP response code of a Report.
+	ResponseCode int32
+	// Participant matches the host of the URL of the exchange reported by a
+	// Report.
+	Participant string
+	// From and To bound the time of the results, inclusively.
+	From time.Time
+	To   time.Time
+	// Limit is the maximum number of results, DefaultLimit if zero.
+	Limit int
+}
+
+// limit returns the number of results q is limited to.
+func (q *Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// columns name the columns of a table Query conditions apply to, empty if
+// the table has no such column.
+type columns struct {
+	time, manager, entityID, code, responseCode, participant string
+}
+
+// where returns the WHERE clause and its arguments selecting the rows of a
+// table with columns c matching q, or an error if q matches a column c does
+// not have.
+func (q *Query) where(c columns) (string, []interface{}, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, match := range []struct {
+		set           bool
+		column, field string
+		arg           interface{}
+	}{
+		{q.Manager != "", c.manager, "manager", q.Manager},
+		{q.EntityID != "", c.entityID, "entity", q.EntityID},
+		{q.Code != "", c.code, "code", q.Code},
+		{q.ResponseCode != 0, c.responseCode, "response code", q.ResponseCode},
+		{q.Participant != "", c.participant, "participant", strings.ToLower(q.Participant)},
+	} {
+		if !match.set {
+			continue
+		}
+		if match.column == "" {
+			return "", nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Searching by %s requires a newer database schema", match.field)
+		}
+		args = append(args, match.arg)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", match.column, len(args)))
+	}
+	if !q.From.IsZero() {
+		args = append(args, q.From)
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", c.time, len(args)))
+	}
+	if !q.To.IsZero() {
+		args = append(args, q.To)
+		conditions = append(conditions, fmt.Sprintf("%s <= $%d", c.time, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type recorder []*Record
+
+func (r *recorder) InsertRecord(ctx context.Context, record *Record) error {
+	*r = append(*r, record)
+	return nil
+}
+
+func TestQueryWhere(t *testing.T) {
+	var (
+		from              = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		reportColumnsV312 = reportColumns[0].columns
+		reportColumnsV33  = reportColumns[len(reportColumns)-1].columns
+	)
+
+	where, args, err := (&Query{}).where(recordColumns)
+	require.NoError(t, err)
+	require.Empty(t, where)
+	require.Empty(t, args)
+
+	where, args, err = (&Query{Manager: "uss1", Code: "NotFound", From: from}).where(recordColumns)
+	require.NoError(t, err)
+	require.Equal(t, "WHERE manager = $1 AND code = $2 AND occurred_at >= $3", where)
+	require.Equal(t, []interface{}{"uss1", "NotFound", from}, args)
+
+	// Response codes are compared as integers.
+	where, args, err = (&Query{EntityID: "abc", ResponseCode: 500, Participant: "USS2.example.com"}).where(reportColumnsV312)
+	require.NoError(t, err)
+	require.Equal(t, "WHERE entity_id = $1 AND response_code = $2 AND participant = $3", where)
+	require.Equal(t, []interface{}{"abc", int32(500), "uss2.example.com"}, args)
+
+	// Columns the schema does not index cannot be searched.
+	for _, q := range []*Query{{EntityID: "abc"}, {ResponseCode: 500}, {Participant: "uss2.example.com"}} {
+		_, _, err = q.where(reportColumnsV33)
+		require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+	}
+	_, _, err = (&Query{ResponseCode: 500}).where(recordColumns)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+}
+
+func TestQueryLimit(t *testing.T) {
+	require.Equal(t, DefaultLimit, (&Query{}).limit())
+	require.Equal(t, 10, (&Query{Limit: 10}).limit())
+	require.Equal(t, MaxLimit, (&Query{Limit: MaxLimit + 1}).limit())
+}
+
+func TestInterceptor(t *testing.T) {
+	var (
+		r           recorder
+		interceptor = Interceptor(&r, zap.NewNop())
+		ctx         = grpc_ctxtags.SetInContext(context.Background(), grpc_ctxtags.NewTags().Set(logging.CallerTag, "uss1"))
+		handler     = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "ISA not found")
+		}
+	)
+
+	_, err := interceptor(ctx, &ridpb.GetIdentificationServiceAreaRequest{Id: "a"}, &grpc.UnaryServerInfo{
+		FullMethod: "/ridpb.DiscoveryAndSynchronizationService/GetIdentificationServiceArea",
+	}, handler)
+	require.Error(t, err)
+	require.Empty(t, r)
+
+	_, err = interceptor(ctx, &ridpb.DeleteIdentificationServiceAreaRequest{Id: "a"}, &grpc.UnaryServerInfo{
+		FullMethod: "/ridpb.DiscoveryAndSynchronizationService/DeleteIdentificationServiceArea",
+	}, handler)
+	require.Error(t, err)
+	require.Len(t, r, 1)
+	require.Equal(t, "uss1", r[0].Manager)
+	require.Equal(t, "a", r[0].EntityID)
+	require.Equal(t, codes.NotFound.String(), r[0].Code)
+	require.Equal(t, "ISA not found", r[0].Details)
+}
+
+// batchRecorder records the batches it is given, failing them with err if
+// set.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]*Record
+	err     error
+}
+
+func (r *batchRecorder) InsertRecords(ctx context.Context, records []*Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, records)
+	return r.err
+}
+
+func TestQueue(t *testing.T) {
+	var (
+		ctx = context.Background()
+		r   = &batchRecorder{}
+		q   = NewQueue(r, zap.NewNop())
+	)
+	for i := 0; i < 2*maxBatch; i++ {
+		require.NoError(t, q.InsertRecord(ctx, &Record{Method: "/ridpb.DiscoveryAndSynchronizationService/CreateSubscription"}))
+	}
+	// Closing persists the records queued.
+	q.Close()
+	var n int
+	for _, batch := range r.batches {
+		require.LessOrEqual(t, len(batch), maxBatch)
+		n += len(batch)
+	}
+	require.Equal(t, 2*maxBatch, n)
+	require.Error(t, q.InsertRecord(ctx, &Record{}))
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	var (
+		r           = &batchRecorder{}
+		q           = NewQueue(r, zap.NewNop())
+		ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	)
+	defer cancel()
+	// Once the queue is full, recording waits for room rather than dropping
+	// records.
+	r.mu.Lock()
+	var err error
+	for i := 0; i <= queueCapacity+maxBatch && err == nil; i++ {
+		err = q.InsertRecord(ctx, &Record{})
+	}
+	require.Equal(t, context.DeadlineExceeded, stacktrace.RootCause(err))
+	r.mu.Unlock()
+	q.Close()
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// recordTimeout bounds the time a call waits for its Record to be accepted
+// by a Recorder, independently of the context of the call so that calls
+// whose client went away are still audited.
+const recordTimeout = 5 * time.Second
+
+// Recorder persists audit records, typically through a Queue.
+type Recorder interface {
+	InsertRecord(ctx context.Context, r *Record) error
+}
+
+// ReportRecorder persists DSS reports.
+type ReportRecorder interface {
+	InsertReport(ctx context.Context, r *Report) error
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor that records every API
+// call changing the state of the DSS to r. Like the access log, it must be
+// installed outside of the error interceptor so that the codes and messages
+// it records are the ones returned to clients. Failures to record a call are
+// logged and do not affect the call.
+func Interceptor(r Recorder, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if !IsMutation(info.FullMethod) {
+			return resp, err
+		}
+
+		st := status.Convert(err)
+		record := &Record{
+			Time:    time.Now(),
+			Method:  info.FullMethod,
+			Code:    st.Code().String(),
+			Details: st.Message(),
+		}
+		if caller, ok := grpc_ctxtags.Extract(ctx).Values()[logging.CallerTag]; ok {
+			record.Manager = fmt.Sprint(caller)
+		}
+		record.EntityID = entityID(req)
+
+		rctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		defer cancel()
+		if rerr := r.InsertRecord(rctx, record); rerr != nil {
+			logger.Error("Failed to record audit log entry", zap.String("method", info.FullMethod), zap.Error(rerr))
+		}
+		return resp, err
+	}
+}
+
+// IsMutation returns true if the gRPC method fullMethod may change the state
+// of the DSS, e.g. "/scdpb.Service/PutOperationalIntentReference".
+func IsMutation(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, prefix := range []string{"Create", "Update", "Put", "Delete", "Set", "Make"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityID returns the ID of the entity req applies to, if any.
+func entityID(req interface{}) string {
+	switch r := req.(type) {
+	case interface{ GetId() string }:
+		return r.GetId()
+	case interface{ GetEntityid() string }:
+		return r.GetEntityid()
+	case interface{ GetSubscriptionid() string }:
+		return r.GetSubscriptionid()
+	}
+	return ""
+}
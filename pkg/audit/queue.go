@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const (
+	// queueCapacity is the number of records a Queue holds before calls
+	// recording to it wait for room.
+	queueCapacity = 1000
+	// maxBatch is the maximum number of records a Queue persists at once.
+	maxBatch = 100
+	// insertTimeout bounds the time spent persisting a batch of records.
+	insertTimeout = 10 * time.Second
+)
+
+// BatchRecorder persists audit records in batches.
+type BatchRecorder interface {
+	InsertRecords(ctx context.Context, records []*Record) error
+}
+
+// Queue is a Recorder persisting records to a BatchRecorder in the
+// background, in batches, so that calls do not wait on the database to be
+// audited. Once it holds queueCapacity records, recording waits for room,
+// slowing calls down to the pace of the database rather than dropping their
+// records.
+type Queue struct {
+	recorder BatchRecorder
+	logger   *zap.Logger
+	records  chan *Record
+	closing  chan struct{}
+	closed   chan struct{}
+}
+
+// NewQueue returns a Queue persisting records to r until it is closed.
+func NewQueue(r BatchRecorder, logger *zap.Logger) *Queue {
+	q := &Queue{
+		recorder: r,
+		logger:   logger,
+		records:  make(chan *Record, queueCapacity),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// InsertRecord implements Recorder, queueing r to be persisted. It waits for
+// room in the queue until ctx is done.
+func (q *Queue) InsertRecord(ctx context.Context, r *Record) error {
+	select {
+	case <-q.closing:
+		return stacktrace.NewError("Audit log is closed")
+	default:
+	}
+	select {
+	case q.records <- r:
+		return nil
+	case <-q.closing:
+		return stacktrace.NewError("Audit log is closed")
+	case <-ctx.Done():
+		return stacktrace.Propagate(ctx.Err(), "Audit log queue is full")
+	}
+}
+
+// Close persists the records queued and stops q.
+func (q *Queue) Close() {
+	close(q.closing)
+	<-q.closed
+}
+
+func (q *Queue) run() {
+	defer close(q.closed)
+	for {
+		select {
+		case r := <-q.records:
+			q.insert(r)
+		case <-q.closing:
+			for {
+				select {
+				case r := <-q.records:
+					q.insert(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// insert persists first along with the records queued after it, up to
+// maxBatch.
+func (q *Queue) insert(first *Record) {
+	batch := []*Record{first}
+collect:
+	for len(batch) < maxBatch {
+		select {
+		case r := <-q.records:
+			batch = append(batch, r)
+		default:
+			break collect
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), insertTimeout)
+	defer cancel()
+	if err := q.recorder.InsertRecords(ctx, batch); err != nil {
+		q.logger.Error("Failed to persist audit log entries", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
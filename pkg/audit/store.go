@@ -0,0 +1,253 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/cockroach"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+)
+
+var (
+	// minSchemaVersion is the first version of the remote ID schema holding
+	// the audit_log and dss_reports tables.
+	minSchemaVersion = *semver.New("3.3.0")
+	// participantSchemaVersion is the first version of the remote ID schema
+	// indexing dss_reports by participant and response code.
+	participantSchemaVersion = *semver.New("3.10.0")
+	// entitySchemaVersion is the first version of the remote ID schema
+	// indexing dss_reports by entity.
+	entitySchemaVersion = *semver.New("3.12.0")
+)
+
+var (
+	recordColumns = columns{
+		time:     "occurred_at",
+		manager:  "manager",
+		entityID: "entity_id",
+		code:     "code",
+	}
+	// reportColumns are the columns of dss_reports indexed by each schema
+	// version, latest first.
+	reportColumns = []struct {
+		version semver.Version
+		columns columns
+	}{
+		{entitySchemaVersion, columns{
+			time:         "reported_at",
+			manager:      "manager",
+			entityID:     "entity_id",
+			responseCode: "response_code",
+			participant:  "participant",
+		}},
+		{participantSchemaVersion, columns{
+			time:         "reported_at",
+			manager:      "manager",
+			responseCode: "response_code",
+			participant:  "participant",
+		}},
+		{minSchemaVersion, columns{
+			time:    "reported_at",
+			manager: "manager",
+		}},
+	}
+)
+
+// Store persists audit records and DSS reports in the remote ID database.
+type Store struct {
+	db            *cockroach.DB
+	reportColumns columns
+}
+
+// NewStore returns a Store persisting to db, which must be the database
+// named dbName.
+func NewStore(ctx context.Context, db *cockroach.DB, dbName string) (*Store, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for audit log")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Audit log requires schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	s := &Store{db: db}
+	for _, c := range reportColumns {
+		if vs.Compare(c.version) >= 0 {
+			s.reportColumns = c.columns
+			break
+		}
+	}
+	return s, nil
+}
+
+// InsertRecords persists records in a single statement, assigning them new
+// IDs.
+func (s *Store) InsertRecords(ctx context.Context, records []*Record) error {
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, r := range records {
+		r.ID = uuid.New().String()
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, NULLIF($%d, ''), $%d, NULLIF($%d, ''))", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		args = append(args, r.ID, r.Time, r.Method, r.Manager, r.EntityID, r.Code, r.Details)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO
+			audit_log
+			(id, occurred_at, method, manager, entity_id, code, details)
+		VALUES
+			%s`, strings.Join(values, ", "))
+
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
+
+// InsertReport persists r, assigning it a new ID if it has none.
+func (s *Store) InsertReport(ctx context.Context, r *Report) error {
+	const query = `
+		INSERT INTO
+			dss_reports
+			(id, reported_at, manager, response_code, report)
+		VALUES
+			($1, $2, $3, $4, $5)`
+
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	if _, err := s.db.ExecContext(ctx, query, r.ID, r.Time, r.Manager, r.ResponseCode, string(r.Details)); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
+
+// SearchRecords returns the audit records matching q, most recent first.
+func (s *Store) SearchRecords(ctx context.Context, q *Query) ([]*Record, error) {
+	where, args, err := q.where(recordColumns)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			id, occurred_at, method, manager, COALESCE(entity_id, ''), code, COALESCE(details, '')
+		FROM
+			audit_log
+		%s
+		ORDER BY
+			occurred_at DESC
+		LIMIT %d`, where, q.limit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	var result []*Record
+	for rows.Next() {
+		r := &Record{}
+		if err := rows.Scan(&r.ID, &r.Time, &r.Method, &r.Manager, &r.EntityID, &r.Code, &r.Details); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning audit record row")
+		}
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// SearchReports returns the DSS reports matching q, most recent first.
+func (s *Store) SearchReports(ctx context.Context, q *Query) ([]*Report, error) {
+	where, args, err := q.where(s.reportColumns)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			id, reported_at, manager, response_code, report::STRING
+		FROM
+			dss_reports
+		%s
+		ORDER BY
+			reported_at DESC
+		LIMIT %d`, where, q.limit())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	var result []*Report
+	for rows.Next() {
+		var (
+			r       = &Report{}
+			details string
+		)
+		if err := rows.Scan(&r.ID, &r.Time, &r.Manager, &r.ResponseCode, &details); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning DSS report row")
+		}
+		r.Details = json.RawMessage(details)
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// CountReports returns the number of DSS reports matching q, but for its
+// limit, by response code and by interval of length interval, oldest first.
+func (s *Store) CountReports(ctx context.Context, q *Query, interval time.Duration) ([]*ReportCount, error) {
+	seconds := int64(interval / time.Second)
+	if seconds < 1 {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Interval must be at least a second, got %s", interval)
+	}
+	where, args, err := q.where(s.reportColumns)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, seconds)
+	query := fmt.Sprintf(`
+		SELECT
+			(extract(epoch FROM reported_at)::INT8 // $%[2]d) * $%[2]d AS start, response_code, count(*)
+		FROM
+			dss_reports
+		%[1]s
+		GROUP BY
+			start, response_code
+		ORDER BY
+			start, response_code`, where, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	var result []*ReportCount
+	for rows.Next() {
+		var (
+			c     = &ReportCount{}
+			start int64
+		)
+		if err := rows.Scan(&start, &c.ResponseCode, &c.Count); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning DSS report count row")
+		}
+		c.Start = time.Unix(start, 0).UTC()
+		result = append(result, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/interuss/stacktrace"
+)
+
+// APIKeyHeader is the HTTP header carrying API keys.
+const APIKeyHeader = "X-Api-Key"
+
+// APIKey is a long-lived credential granting read-only access to the
+// monitoring endpoints of the DSS instances of a single region. API keys are
+// distinct from USS access tokens and never grant access to the USS APIs.
+type APIKey struct {
+	// ID identifies the key, e.g. in logs; it is not secret.
+	ID string `json:"id"`
+	// SHA256 is the hex-encoded SHA-256 digest of the key. The key itself
+	// is never stored.
+	SHA256 string `json:"sha256"`
+	// Region is the region whose DSS instances accept the key.
+	Region string `json:"region"`
+
+	digest []byte
+}
+
+// APIKeys validates API keys against a fixed set of known keys.
+type APIKeys struct {
+	keys []*APIKey
+}
+
+// NewAPIKeys returns an APIKeys accepting keys.
+func NewAPIKeys(keys []*APIKey) (*APIKeys, error) {
+	ids := map[string]bool{}
+	for _, k := range keys {
+		if k.ID == "" || k.Region == "" {
+			return nil, stacktrace.NewError("API keys must have an ID and a region")
+		}
+		if ids[k.ID] {
+			return nil, stacktrace.NewError("Duplicate API key ID %s", k.ID)
+		}
+		ids[k.ID] = true
+		digest, err := hex.DecodeString(k.SHA256)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, stacktrace.NewError("Invalid SHA-256 digest for API key %s", k.ID)
+		}
+		k.digest = digest
+	}
+	return &APIKeys{keys: keys}, nil
+}
+
+// LoadAPIKeys returns an APIKeys accepting the keys listed as a JSON array
+// of APIKey in the file at path.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading API keys from %s", path)
+	}
+	var keys []*APIKey
+	if err := json.Unmarshal(bytes, &keys); err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing API keys from %s", path)
+	}
+	return NewAPIKeys(keys)
+}
+
+// Authenticate returns the APIKey matching key if it is valid for region.
+func (a *APIKeys) Authenticate(key string, region string) (*APIKey, error) {
+	if key == "" {
+		return nil, stacktrace.NewError("Missing API key")
+	}
+	digest := sha256.Sum256([]byte(key))
+	var match *APIKey
+	for _, k := range a.keys {
+		// Compare against all keys to avoid leaking which keys exist
+		// through timing.
+		if subtle.ConstantTimeCompare(digest[:], k.digest) == 1 {
+			match = k
+		}
+	}
+	if match == nil {
+		return nil, stacktrace.NewError("Unknown API key")
+	}
+	if match.Region != region {
+		return nil, stacktrace.NewError("API key %s is not valid in region %s", match.ID, region)
+	}
+	return match, nil
+}
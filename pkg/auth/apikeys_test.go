@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func digestOf(key string) string {
+	d := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(d[:])
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := NewAPIKeys([]*APIKey{
+		{ID: "grafana", SHA256: digestOf("secret-1"), Region: "eu"},
+		{ID: "pager", SHA256: digestOf("secret-2"), Region: "us"},
+	})
+	require.NoError(t, err)
+
+	k, err := keys.Authenticate("secret-1", "eu")
+	require.NoError(t, err)
+	require.Equal(t, "grafana", k.ID)
+
+	_, err = keys.Authenticate("secret-2", "eu")
+	require.Error(t, err)
+	_, err = keys.Authenticate("secret-3", "eu")
+	require.Error(t, err)
+	_, err = keys.Authenticate("", "eu")
+	require.Error(t, err)
+}
+
+func TestNewAPIKeysValidation(t *testing.T) {
+	_, err := NewAPIKeys([]*APIKey{{ID: "a", SHA256: "abc", Region: "eu"}})
+	require.Error(t, err)
+	_, err = NewAPIKeys([]*APIKey{{ID: "a", SHA256: digestOf("x")}})
+	require.Error(t, err)
+	_, err = NewAPIKeys([]*APIKey{
+		{ID: "a", SHA256: digestOf("x"), Region: "eu"},
+		{ID: "a", SHA256: digestOf("y"), Region: "eu"},
+	})
+	require.Error(t, err)
+}
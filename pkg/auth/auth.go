@@ -19,6 +19,8 @@ import (
 	"github.com/interuss/dss/pkg/models"
 
 	"github.com/golang-jwt/jwt"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"github.com/interuss/stacktrace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -294,12 +296,84 @@ func (a *Authorizer) setKeys(keys []interface{}) {
 // AuthInterceptor intercepts incoming gRPC requests and extracts and verifies
 // accompanying bearer tokens.
 func (a *Authorizer) AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// AuthStreamInterceptor intercepts incoming gRPC streams and extracts and
+// verifies accompanying bearer tokens like AuthInterceptor.
+func (a *Authorizer) AuthStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = ctx
+	return handler(srv, wrapped)
+}
 
+// authorize verifies the bearer token of a call to method and returns ctx
+// carrying the owner it was issued to and the identity it claims.
+func (a *Authorizer) authorize(ctx context.Context, method string) (context.Context, error) {
 	tknStr, ok := getToken(ctx)
 	if !ok {
 		return nil, stacktrace.NewErrorWithCode(dsserr.Unauthenticated, "Missing access token")
 	}
 
+	keyClaims, err := a.validateToken(tknStr)
+	if err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+
+	if err := a.validateKeyClaimedScopes(ctx, method, keyClaims.Scopes); err != nil {
+		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Access token missing scopes")
+	}
+
+	grpc_ctxtags.Extract(ctx).Set(logging.CallerTag, keyClaims.Subject)
+	ctx = logging.ContextWithIdentity(ctx, keyClaims.identity())
+	return ContextWithOwner(ctx, models.Owner(keyClaims.Subject)), nil
+}
+
+// Authenticate verifies the bearer token tknStr, without regard to scopes,
+// and returns the owner it was issued to. It serves requests not going
+// through AuthInterceptor.
+func (a *Authorizer) Authenticate(tknStr string) (models.Owner, error) {
+	keyClaims, err := a.validateToken(strings.TrimPrefix(tknStr, "Bearer "))
+	if err != nil {
+		return "", err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	return models.Owner(keyClaims.Subject), nil
+}
+
+// AuthenticateWithScope verifies the bearer token tknStr like Authenticate,
+// additionally requiring it to grant scope.
+func (a *Authorizer) AuthenticateWithScope(tknStr string, scope Scope) (models.Owner, error) {
+	keyClaims, err := a.validateToken(strings.TrimPrefix(tknStr, "Bearer "))
+	if err != nil {
+		return "", err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	if _, ok := keyClaims.Scopes[scope]; !ok {
+		return "", stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Access token missing scope %s", scope)
+	}
+	return models.Owner(keyClaims.Subject), nil
+}
+
+// AuthenticateScopes verifies the bearer token tknStr like Authenticate,
+// additionally returning the scopes it grants.
+func (a *Authorizer) AuthenticateScopes(tknStr string) (models.Owner, ScopeSet, error) {
+	keyClaims, err := a.validateToken(strings.TrimPrefix(tknStr, "Bearer "))
+	if err != nil {
+		return "", nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	return models.Owner(keyClaims.Subject), keyClaims.Scopes, nil
+}
+
+// validateToken verifies the signature and audience of tknStr and returns
+// its claims.
+func (a *Authorizer) validateToken(tknStr string) (*claims, error) {
 	a.keyGuard.RLock()
 	keys := a.keys
 	a.keyGuard.RUnlock()
@@ -326,18 +400,13 @@ func (a *Authorizer) AuthInterceptor(ctx context.Context, req interface{}, info
 		return nil, stacktrace.NewErrorWithCode(dsserr.Unauthenticated,
 			"Invalid access token audience: %v", keyClaims.Audience)
 	}
-
-	if err := a.validateKeyClaimedScopes(ctx, info, keyClaims.Scopes); err != nil {
-		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Access token missing scopes")
-	}
-
-	return handler(ContextWithOwner(ctx, models.Owner(keyClaims.Subject)), req)
+	return &keyClaims, nil
 }
 
 // Matches keyClaimedScopes against the required scopes and returns true if
 // keyClaimedScopes contains at least one of the required scopes in a.
-func (a *Authorizer) validateKeyClaimedScopes(ctx context.Context, info *grpc.UnaryServerInfo, keyClaimedScopes ScopeSet) error {
-	if validator, known := a.scopesValidators[Operation(info.FullMethod)]; known {
+func (a *Authorizer) validateKeyClaimedScopes(ctx context.Context, method string, keyClaimedScopes ScopeSet) error {
+	if validator, known := a.scopesValidators[Operation(method)]; known {
 		return validator.ValidateKeyClaimedScopes(ctx, keyClaimedScopes)
 	}
 
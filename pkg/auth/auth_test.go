@@ -125,6 +125,46 @@ func TestRSAAuthInterceptor(t *testing.T) {
 	}
 }
 
+func TestAuthenticateWithScope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	require.NoError(t, err)
+	a, err := NewRSAAuthorizer(ctx, Configuration{
+		KeyResolver: &fromMemoryKeyResolver{
+			Keys: []interface{}{&key.PublicKey},
+		},
+		KeyRefreshTimeout: 1 * time.Millisecond,
+		AcceptedAudiences: []string{""},
+	})
+	require.NoError(t, err)
+	token := func(scope string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"sub":   "real_owner",
+			"iss":   "baz",
+			"scope": scope,
+		}).SignedString(key)
+		require.NoError(t, err)
+		return "Bearer " + s
+	}
+
+	owner, err := a.AuthenticateWithScope(token("other required"), "required")
+	require.NoError(t, err)
+	require.Equal(t, models.Owner("real_owner"), owner)
+
+	_, err = a.AuthenticateWithScope(token("other"), "required")
+	require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+	_, err = a.AuthenticateWithScope("Bearer invalid", "required")
+	require.Equal(t, dsserr.Unauthenticated, stacktrace.GetCode(err))
+
+	owner, scopes, err := a.AuthenticateScopes(token("other required"))
+	require.NoError(t, err)
+	require.Equal(t, models.Owner("real_owner"), owner)
+	require.Equal(t, ScopeSet{"other": {}, "required": {}}, scopes)
+}
+
 func TestMissingScopes(t *testing.T) {
 	ac := &Authorizer{scopesValidators: map[Operation]KeyClaimedScopesValidator{
 		"/dss.SyncService/PutFoo": RequireAnyScope(("required1"), Scope("required2")),
@@ -164,7 +204,7 @@ func TestMissingScopes(t *testing.T) {
 		},
 	}
 	for _, tc := range tests {
-		require.Equal(t, tc.matchesRequiredScopes, ac.validateKeyClaimedScopes(context.Background(), tc.info, tc.scopes) == nil)
+		require.Equal(t, tc.matchesRequiredScopes, ac.validateKeyClaimedScopes(context.Background(), tc.info.FullMethod, tc.scopes) == nil)
 	}
 }
 
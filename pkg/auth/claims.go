@@ -3,10 +3,12 @@ package auth
 import (
 	"encoding/json"
 	"errors"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/interuss/dss/pkg/logging"
 	"github.com/interuss/stacktrace"
 )
 
@@ -39,6 +41,24 @@ func (s *ScopeSet) UnmarshalJSON(data []byte) error {
 type claims struct {
 	jwt.StandardClaims
 	Scopes ScopeSet `json:"scope"`
+	// ClientID is the client the token was issued to, if the authorization
+	// server says so (RFC 9068).
+	ClientID string `json:"client_id"`
+}
+
+// identity returns the identity of the bearer of the token of c.
+func (c *claims) identity() *logging.Identity {
+	scopes := make([]string, 0, len(c.Scopes))
+	for scope := range c.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	sort.Strings(scopes)
+	return &logging.Identity{
+		Subject:  c.Subject,
+		Issuer:   c.Issuer,
+		ClientID: c.ClientID,
+		Scopes:   scopes,
+	}
 }
 
 func (c *claims) Valid() error {
@@ -25,3 +25,13 @@ func TestScopesJSONUnmarshaling(t *testing.T) {
 	require.Error(t, json.Unmarshal([]byte(`{"scope": false}`), claims))
 	require.Error(t, json.Unmarshal([]byte(`{"scope": {}}`), claims))
 }
+
+func TestClaimsIdentity(t *testing.T) {
+	claims := &claims{}
+	require.NoError(t, json.Unmarshal([]byte(`{"sub": "uss1", "iss": "https://auth.example.com", "client_id": "dashboard", "scope": "two one"}`), claims))
+	identity := claims.identity()
+	require.Equal(t, "uss1", identity.Subject)
+	require.Equal(t, "https://auth.example.com", identity.Issuer)
+	require.Equal(t, "dashboard", identity.ClientID)
+	require.Equal(t, []string{"one", "two"}, identity.Scopes)
+}
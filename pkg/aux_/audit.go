@@ -0,0 +1,168 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/audit"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// AuditSearcher searches the audit log and DSS reports.
+type AuditSearcher interface {
+	SearchRecords(ctx context.Context, q *audit.Query) ([]*audit.Record, error)
+	SearchReports(ctx context.Context, q *audit.Query) ([]*audit.Report, error)
+	CountReports(ctx context.Context, q *audit.Query, interval time.Duration) ([]*audit.ReportCount, error)
+}
+
+// handleAuditLog serves the audit records matching the query parameters,
+// most recent first:
+//
+//	GET /aux/v1/audit_log?manager=&entity_id=&code=&from=<RFC3339>&to=<RFC3339>&limit=
+func (a *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.auditQuery(w, r)
+	if !ok {
+		return
+	}
+	records, err := a.Audit.SearchRecords(r.Context(), q)
+	if err != nil {
+		writeSearchError(w, err, "searching audit log")
+		return
+	}
+	writeJSON(w, struct {
+		Records []*audit.Record `json:"records"`
+	}{records})
+}
+
+// handleDSSReports serves the DSS reports matching the query parameters,
+// most recent first, with the same parameters as handleAuditLog; code
+// matches the response code of the reported exchange, and participant the
+// host of its URL:
+//
+//	GET /aux/v1/dss_reports?manager=&participant=&entity_id=&code=&from=<RFC3339>&to=<RFC3339>&limit=
+func (a *Server) handleDSSReports(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.reportQuery(w, r)
+	if !ok {
+		return
+	}
+	reports, err := a.Audit.SearchReports(r.Context(), q)
+	if err != nil {
+		writeSearchError(w, err, "searching DSS reports")
+		return
+	}
+	writeJSON(w, struct {
+		Reports []*audit.Report `json:"reports"`
+	}{reports})
+}
+
+// handleDSSReportCounts serves the number of DSS reports matching the query
+// parameters of handleDSSReports, but limit, by response code and by
+// interval, 24h by default, oldest first, so that interoperability problems
+// can be trended:
+//
+//	GET /aux/v1/dss_reports/counts?interval=<Go duration>&participant=&code=&from=<RFC3339>&to=<RFC3339>
+func (a *Server) handleDSSReportCounts(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.reportQuery(w, r)
+	if !ok {
+		return
+	}
+	interval := 24 * time.Hour
+	if s := r.URL.Query().Get("interval"); s != "" {
+		var err error
+		if interval, err = time.ParseDuration(s); err != nil || interval < time.Second {
+			http.Error(w, "Invalid interval; expected a duration of at least 1s", http.StatusBadRequest)
+			return
+		}
+	}
+	counts, err := a.Audit.CountReports(r.Context(), q, interval)
+	if err != nil {
+		writeSearchError(w, err, "counting DSS reports")
+		return
+	}
+	if counts == nil {
+		counts = []*audit.ReportCount{}
+	}
+	writeJSON(w, struct {
+		Interval string               `json:"interval"`
+		Counts   []*audit.ReportCount `json:"counts"`
+	}{interval.String(), counts})
+}
+
+// reportQuery parses the audit.Query of r searching DSS reports like
+// auditQuery, whose code must be an HTTP response code.
+func (a *Server) reportQuery(w http.ResponseWriter, r *http.Request) (*audit.Query, bool) {
+	q, ok := a.auditQuery(w, r)
+	if !ok {
+		return nil, false
+	}
+	if q.Code != "" {
+		code, err := strconv.ParseInt(q.Code, 10, 32)
+		if err != nil || code <= 0 {
+			http.Error(w, "Invalid code; expected an HTTP response code", http.StatusBadRequest)
+			return nil, false
+		}
+		q.Code, q.ResponseCode = "", int32(code)
+	}
+	q.EntityID = strings.ToLower(q.EntityID)
+	return q, true
+}
+
+// auditQuery parses the audit.Query of r, replying to r and returning false
+// if it cannot be served.
+func (a *Server) auditQuery(w http.ResponseWriter, r *http.Request) (*audit.Query, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if a.Audit == nil {
+		http.Error(w, "Audit log is not enabled", http.StatusNotFound)
+		return nil, false
+	}
+
+	params := r.URL.Query()
+	q := &audit.Query{
+		Manager:     params.Get("manager"),
+		EntityID:    params.Get("entity_id"),
+		Code:        params.Get("code"),
+		Participant: params.Get("participant"),
+	}
+	if params.Get("q") != "" {
+		http.Error(w, "Free text search is not supported; search by manager, entity_id, code or participant", http.StatusBadRequest)
+		return nil, false
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if s := params.Get(name); s != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+				http.Error(w, "Invalid "+name+" timestamp; expected RFC3339", http.StatusBadRequest)
+				return nil, false
+			}
+		}
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > audit.MaxLimit {
+			http.Error(w, "Invalid limit; expected 1 to "+strconv.Itoa(audit.MaxLimit), http.StatusBadRequest)
+			return nil, false
+		}
+		q.Limit = limit
+	}
+	return q, true
+}
+
+// writeSearchError replies to a request whose search, described by what,
+// failed with err.
+func writeSearchError(w http.ResponseWriter, err error, what string) {
+	if stacktrace.GetCode(err) == dsserr.BadRequest {
+		http.Error(w, stacktrace.RootCause(err).Error(), http.StatusBadRequest)
+		return
+	}
+	logging.Logger.Error("Error "+what, zap.Error(err))
+	http.Error(w, "Error "+what, http.StatusInternalServerError)
+}
@@ -0,0 +1,94 @@
+package aux
+
+import (
+	"context"
+	"time"
+
+	"github.com/interuss/dss/pkg/audit"
+	"github.com/interuss/dss/pkg/journal"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// recordTimeout bounds the time a change waits for its records to be
+// accepted, as for the API calls.
+const recordTimeout = 5 * time.Second
+
+// change is a change to the state of the DSS requested through HTTPHandler,
+// recorded to the audit log and request journal alongside the API calls.
+type change struct {
+	// Method names the endpoint, in place of the gRPC method of the API
+	// calls, e.g. "POST /aux/v1/subscriptions/{api}/{id}/reset_notification_index".
+	Method   string
+	Subject  string
+	EntityID string
+	// Request and Result are the JSON-encodable request and, if the change
+	// succeeded, result, whose digests are journaled.
+	Request interface{}
+	Result  interface{}
+	// Err is the error of the change, if it failed.
+	Err error
+}
+
+// recordChange records c to the audit log and request journal of a, where
+// enabled. Like for the API calls, failures to record c are logged and do
+// not affect c, which has already taken effect.
+func (a *Server) recordChange(c *change) {
+	if a.AuditLog == nil && a.Journal == nil {
+		return
+	}
+	now := time.Now()
+	code := errorCode(c.Err).String()
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	if a.AuditLog != nil {
+		record := &audit.Record{
+			Time:     now,
+			Method:   c.Method,
+			Manager:  c.Subject,
+			EntityID: c.EntityID,
+			Code:     code,
+		}
+		if c.Err != nil {
+			record.Details = stacktrace.RootCause(c.Err).Error()
+		}
+		if err := a.AuditLog.InsertRecord(ctx, record); err != nil {
+			logging.Logger.Error("Failed to record audit log entry", zap.String("method", c.Method), zap.Error(err))
+		}
+	}
+
+	if a.Journal != nil {
+		e := &journal.Entry{
+			Time:    now,
+			Method:  c.Method,
+			Subject: c.Subject,
+			Code:    code,
+		}
+		digest, err := journal.DigestJSON(c.Request)
+		e.PayloadDigest = digest
+		if err == nil && c.Err == nil && c.Result != nil {
+			e.ResultDigest, err = journal.DigestJSON(c.Result)
+		}
+		if err == nil {
+			err = a.Journal.Append(ctx, e)
+		}
+		if err != nil {
+			logging.Logger.Error("Failed to journal change",
+				zap.String("alert", "request_journal_failure"), zap.String("method", c.Method), zap.Error(err))
+		}
+	}
+}
+
+// errorCode returns the gRPC code of err as the API would return it.
+func errorCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if code := stacktrace.GetCode(err); code <= stacktrace.ErrorCode(codes.Unauthenticated) {
+		return codes.Code(code)
+	}
+	return codes.Internal
+}
@@ -0,0 +1,57 @@
+package aux
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/interuss/dss/pkg/auth"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const clockPath = "/aux/v1/clock"
+
+// SimulatedTimeScope is the scope of the access tokens allowed to advance the
+// simulated clock.
+const SimulatedTimeScope auth.Scope = "interuss.dss.simulated_time"
+
+// handleClock reads and advances the simulated clock of this instance, for
+// integration tests to exercise expiry deterministically:
+//
+//	GET /aux/v1/clock
+//	POST /aux/v1/clock?advance=<duration>
+func (a *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	if a.Clock == nil || a.Authorizer == nil {
+		http.Error(w, "Simulated time is not enabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		owner, err := a.Authorizer.AuthenticateWithScope(r.Header.Get("Authorization"), SimulatedTimeScope)
+		if err != nil {
+			logging.Logger.Info("Rejected clock advance", zap.Error(err))
+			if stacktrace.GetCode(err) == dsserr.PermissionDenied {
+				http.Error(w, "Access token missing scope "+string(SimulatedTimeScope), http.StatusForbidden)
+			} else {
+				http.Error(w, "Missing or invalid access token", http.StatusUnauthorized)
+			}
+			return
+		}
+		advance, err := time.ParseDuration(r.URL.Query().Get("advance"))
+		if err != nil || advance < 0 {
+			http.Error(w, "Invalid advance; expected a non-negative duration such as 90s", http.StatusBadRequest)
+			return
+		}
+		a.Clock.Advance(advance)
+		logging.Logger.Info("Advanced simulated clock", zap.String("owner", string(owner)), zap.Duration("advance", advance), zap.Time("now", a.Clock.Now()))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, struct {
+		Now time.Time `json:"now"`
+	}{a.Clock.Now()})
+}
@@ -0,0 +1,156 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const (
+	coveragePath = "/aux/v1/subscription_coverage"
+
+	earthRadiusKm = 6371.01
+)
+
+// coverageWindow is a period during which at least one subscription is
+// active, unbounded if End is nil.
+type coverageWindow struct {
+	Start time.Time  `json:"time_start"`
+	End   *time.Time `json:"time_end,omitempty"`
+}
+
+// subscriptionCoverage is the awareness of a manager granted by its active
+// subscriptions.
+type subscriptionCoverage struct {
+	Manager       string `json:"manager"`
+	Subscriptions int    `json:"subscriptions"`
+	// Cells are the tokens of the normalized union of the cells of the
+	// subscriptions, covering AreaKm2 and approximated by Region.
+	Cells   []string             `json:"cells"`
+	AreaKm2 float64              `json:"area_km2"`
+	Region  *geo.GeoJSONGeometry `json:"region"`
+	Windows []coverageWindow     `json:"windows"`
+}
+
+// handleCoverage serves the cells and the periods covered by the strategic
+// conflict detection subscriptions of a manager active now or later, so
+// that USSs can verify that they are made aware of the entities around
+// their operations:
+//
+//	GET /aux/v1/subscription_coverage[?manager=<manager>]
+//
+// USSs authenticate with the same access tokens as the public API and are
+// only served their own coverage; pool operators, whose tokens grant
+// OperatorScope, must name the manager. The cells and the periods are
+// merged separately: a cell is covered during some but not necessarily all
+// of the windows.
+func (a *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.SCD == nil {
+		http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+		return
+	}
+	manager := dssmodels.Manager(r.URL.Query().Get("manager"))
+	owner, ok := a.authenticateUSS(w, r)
+	if !ok {
+		return
+	}
+	if owner != "" {
+		if manager != "" && manager != owner {
+			http.Error(w, "Access tokens only grant access to the coverage of their owner", http.StatusForbidden)
+			return
+		}
+		manager = owner
+	}
+	if manager == "" {
+		http.Error(w, "Missing manager", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if a.Clock != nil {
+		now = a.Clock.Now()
+	}
+	coverage, err := a.subscriptionCoverage(r.Context(), manager, now)
+	if err != nil {
+		logging.Logger.Error("Error computing subscription coverage", zap.String("manager", manager.String()), zap.Error(err))
+		http.Error(w, "Error computing subscription coverage", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, coverage)
+}
+
+// subscriptionCoverage merges the subscriptions of manager active at now or
+// later.
+func (a *Server) subscriptionCoverage(ctx context.Context, manager dssmodels.Manager, now time.Time) (*subscriptionCoverage, error) {
+	repo, err := a.SCD.Interact(ctx)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to interact with strategic conflict detection store")
+	}
+	subs, err := repo.ListSubscriptionsByManager(ctx, manager, now)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to list subscriptions")
+	}
+
+	var cells s2.CellUnion
+	for _, sub := range subs {
+		cells = append(cells, sub.Cells...)
+	}
+	cells.Normalize()
+	coverage := &subscriptionCoverage{
+		Manager:       manager.String(),
+		Subscriptions: len(subs),
+		Cells:         make([]string, len(cells)),
+		Region:        geo.CellsMultiPolygon(cells),
+		Windows:       mergeWindows(subs, now),
+	}
+	for i, id := range cells {
+		coverage.Cells[i] = id.ToToken()
+		coverage.AreaKm2 += s2.CellFromCellID(id).ApproxArea() * earthRadiusKm * earthRadiusKm
+	}
+	return coverage, nil
+}
+
+// mergeWindows returns the periods from now on during which at least one of
+// subs is active, in chronological order.
+func mergeWindows(subs []*scdmodels.Subscription, now time.Time) []coverageWindow {
+	windows := make([]coverageWindow, 0, len(subs))
+	for _, sub := range subs {
+		w := coverageWindow{Start: now, End: sub.EndTime}
+		if sub.StartTime != nil && sub.StartTime.After(now) {
+			w.Start = *sub.StartTime
+		}
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+
+	var merged []coverageWindow
+	for _, w := range windows {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.End == nil || !w.Start.After(*last.End) {
+				if last.End != nil && (w.End == nil || w.End.After(*last.End)) {
+					last.End = w.End
+				}
+				continue
+			}
+		}
+		merged = append(merged, w)
+	}
+	if merged == nil {
+		merged = []coverageWindow{}
+	}
+	return merged
+}
@@ -0,0 +1,94 @@
+package aux
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"go.uber.org/zap"
+)
+
+const dependenciesPathPrefix = "/aux/v1/dependencies/"
+
+// handleDependencies serves the references between the strategic conflict
+// detection subscriptions and operational intents, read at once from the
+// store, so that USSs can find the operational intents still depending on a
+// subscription before deleting it and the references dangling:
+//
+//	GET /aux/v1/dependencies/subscriptions/<id>
+//	GET /aux/v1/dependencies/operational_intents/<id>
+//
+// The dependencies of a subscription are its dependent operational intents,
+// and those of an operational intent are the subscription it depends on and
+// the subscriptions notified of its changes. USSs authenticate with the same
+// access tokens as the public API and are only served the dependencies of
+// their own entities, unlike pool operators whose tokens grant OperatorScope.
+func (a *Server) handleDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.SCD == nil {
+		http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+		return
+	}
+	owner, ok := a.authenticateUSS(w, r)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, dependenciesPathPrefix), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := dssmodels.IDFromString(parts[1])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	repo, err := a.SCD.Interact(r.Context())
+	if err != nil {
+		logging.Logger.Error("Error interacting with strategic conflict detection store", zap.Error(err))
+		http.Error(w, "Error reading dependencies", http.StatusInternalServerError)
+		return
+	}
+
+	switch parts[0] {
+	case "subscriptions":
+		deps, err := repo.GetSubscriptionDependencies(r.Context(), id)
+		if err != nil {
+			logging.Logger.Error("Error reading subscription dependencies", zap.String("id", id.String()), zap.Error(err))
+			http.Error(w, "Error reading dependencies", http.StatusInternalServerError)
+			return
+		}
+		if owner != "" && !deps.Exists {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		if owner != "" && deps.Manager != owner {
+			http.Error(w, "Subscription is not managed by the caller", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, deps)
+	case "operational_intents":
+		deps, err := repo.GetOperationalIntentDependencies(r.Context(), id)
+		if err != nil {
+			logging.Logger.Error("Error reading operational intent dependencies", zap.String("id", id.String()), zap.Error(err))
+			http.Error(w, "Error reading dependencies", http.StatusInternalServerError)
+			return
+		}
+		if deps == nil {
+			http.Error(w, "Operational intent not found", http.StatusNotFound)
+			return
+		}
+		if owner != "" && deps.Manager != owner {
+			http.Error(w, "Operational intent is not managed by the caller", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, deps)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,68 @@
+package aux
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/interuss/dss/pkg/flags"
+	"github.com/interuss/dss/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const flagsPath = "/aux/v1/feature_flags"
+
+// handleFlags lists the feature gates and their state in this instance, and
+// overrides them across the deployment:
+//
+//	GET /aux/v1/feature_flags
+//	PUT /aux/v1/feature_flags/<name>?enabled={true|false}
+//	DELETE /aux/v1/feature_flags/<name>
+//
+// Other instances apply overrides at their next refresh.
+func (a *Server) handleFlags(w http.ResponseWriter, r *http.Request) {
+	if a.Flags == nil {
+		http.Error(w, "Feature flags are not enabled", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, flagsPath), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, struct {
+			Flags []flags.State `json:"flags"`
+		}{a.Flags.States()})
+		return
+	}
+
+	g := flags.Lookup(name)
+	if g == nil {
+		http.Error(w, "Unknown feature flag", http.StatusNotFound)
+		return
+	}
+	var enabled *bool
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		v, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "Invalid enabled; expected true or false", http.StatusBadRequest)
+			return
+		}
+		enabled = &v
+		fallthrough
+	case http.MethodDelete:
+		if err := a.Flags.Override(r.Context(), name, enabled); err != nil {
+			logging.Logger.Error("Error overriding feature flag", zap.String("flag", name), zap.Error(err))
+			http.Error(w, "Error overriding feature flag", http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Info("Overrode feature flag", zap.String("flag", name), zap.Any("enabled", enabled))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.Flags.State(g))
+}
@@ -0,0 +1,62 @@
+package aux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/stretchr/testify/require"
+)
+
+// footprinter counts the footprints it reports.
+type footprinter struct {
+	footprints []cockroach.Footprint
+	err        error
+	calls      int
+}
+
+func (f *footprinter) StorageFootprint(context.Context) ([]cockroach.Footprint, error) {
+	f.calls++
+	return f.footprints, f.err
+}
+
+func TestHandleStorageFootprint(t *testing.T) {
+	var (
+		rid = &footprinter{footprints: []cockroach.Footprint{
+			{Table: "identification_service_areas", Owner: "uss1", Rows: 2, Bytes: 200},
+		}}
+		scd = &footprinter{err: errors.New("connection refused")}
+		a   = &Server{Footprints: map[string]StorageFootprinter{"defaultdb": rid, "scd": scd}}
+	)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.handleStorageFootprint(w, httptest.NewRequest(http.MethodGet, "/aux/v1/storage_footprint", nil))
+		return w
+	}
+
+	// Failures are not cached.
+	require.Equal(t, http.StatusInternalServerError, get().Code)
+	scd.err = nil
+	scd.footprints = []cockroach.Footprint{
+		{Table: "scd_operations", Owner: "uss1", Rows: 1, Bytes: 300},
+		{Table: "scd_operations", Owner: "uss2", Rows: 1, Bytes: 300},
+	}
+	w := get()
+	require.Equal(t, http.StatusOK, w.Code)
+	var result storageFootprint
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, map[string]*managerFootprint{
+		"uss1": {Rows: 3, Bytes: 500},
+		"uss2": {Rows: 1, Bytes: 300},
+	}, result.Managers)
+	require.Equal(t, scd.footprints, result.Databases["scd"])
+
+	// Footprints are computed once per footprintsTTL.
+	calls := scd.calls
+	require.Equal(t, http.StatusOK, get().Code)
+	require.Equal(t, calls, scd.calls)
+}
@@ -0,0 +1,196 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const geoJSONPath = "/aux/v1/geojson"
+
+// Kinds of the entities served by handleGeoJSON.
+const (
+	isaKind               = "identification_service_areas"
+	operationalIntentKind = "operational_intents"
+	constraintKind        = "constraints"
+)
+
+// handleGeoJSON serves the entities active now intersecting a bounding box
+// as a GeoJSON FeatureCollection, for operations dashboards to overlay on a
+// map:
+//
+//	GET /aux/v1/geojson?bbox=<min_lng>,<min_lat>,<max_lng>,<max_lat>[&kinds=<kind>,...]
+//
+// where the kinds are identification_service_areas, operational_intents and
+// constraints, all of those enabled by default. The footprints of the
+// entities are approximated by the S2 cells they cover. The OVNs of the
+// entities are left out: presenting them to the DSS attests awareness of
+// the entities, which a map of the airspace must not stand in for.
+func (a *Server) handleGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		http.Error(w, "Missing or invalid bbox; expected min_lng,min_lat,max_lng,max_lat in degrees", http.StatusBadRequest)
+		return
+	}
+	cells, err := geo.RectCovering(bbox[1], bbox[0], bbox[3], bbox[2])
+	if err != nil {
+		switch stacktrace.GetCode(err) {
+		case dsserr.AreaTooLarge:
+			http.Error(w, "Bounding box too large", http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, "Invalid bbox", http.StatusBadRequest)
+		}
+		return
+	}
+
+	kinds := map[string]bool{}
+	if s := r.URL.Query().Get("kinds"); s != "" {
+		for _, kind := range strings.Split(s, ",") {
+			switch kind {
+			case isaKind, operationalIntentKind, constraintKind:
+				kinds[kind] = true
+			default:
+				http.Error(w, "Unknown kind "+kind, http.StatusBadRequest)
+				return
+			}
+		}
+	} else {
+		kinds[isaKind] = a.RID != nil
+		kinds[operationalIntentKind] = a.SCD != nil
+		kinds[constraintKind] = a.SCD != nil
+	}
+	if (kinds[isaKind] && a.RID == nil) || ((kinds[operationalIntentKind] || kinds[constraintKind]) && a.SCD == nil) {
+		http.Error(w, "Requested kinds are not enabled", http.StatusNotFound)
+		return
+	}
+
+	features, err := a.geoJSONFeatures(r.Context(), cells, kinds, time.Now())
+	if err != nil {
+		logging.Logger.Error("Error searching entities for GeoJSON", zap.Error(err))
+		http.Error(w, "Error searching entities", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, &geo.FeatureCollection{
+		Type:     "FeatureCollection",
+		BBox:     bbox,
+		Features: features,
+	})
+}
+
+// parseBBox parses a bounding box as in GeoJSON: min_lng,min_lat,max_lng,max_lat.
+func parseBBox(s string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, stacktrace.NewError("Expected 4 coordinates, got %d", len(parts))
+	}
+	bbox := make([]float64, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid coordinate %q", part)
+		}
+		bbox[i] = f
+	}
+	return bbox, nil
+}
+
+// geoJSONFeatures returns the entities of kinds active at now in cells as
+// GeoJSON features.
+func (a *Server) geoJSONFeatures(ctx context.Context, cells s2.CellUnion, kinds map[string]bool, now time.Time) ([]*geo.Feature, error) {
+	features := []*geo.Feature{}
+	feature := func(kind string, id dssmodels.ID, covered s2.CellUnion, properties map[string]interface{}) {
+		properties["kind"] = kind
+		features = append(features, &geo.Feature{
+			Type:       "Feature",
+			ID:         id.String(),
+			Geometry:   geo.CellsMultiPolygon(covered),
+			Properties: properties,
+		})
+	}
+
+	if kinds[isaKind] {
+		repo, err := a.RID.Interact(ctx)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Unable to interact with remote ID store")
+		}
+		isas, err := repo.SearchISAs(ctx, cells, &now, nil, false)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Unable to search ISAs")
+		}
+		for _, isa := range isas {
+			feature(isaKind, isa.ID, isa.Cells, map[string]interface{}{
+				"owner":          isa.Owner.String(),
+				"time_start":     isa.StartTime,
+				"time_end":       isa.EndTime,
+				"altitude_lower": isa.AltitudeLo,
+				"altitude_upper": isa.AltitudeHi,
+			})
+		}
+	}
+
+	if kinds[operationalIntentKind] || kinds[constraintKind] {
+		repo, err := a.SCD.Interact(ctx)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Unable to interact with strategic conflict detection store")
+		}
+		v4d := &dssmodels.Volume4D{
+			StartTime: &now,
+			EndTime:   &now,
+			SpatialVolume: &dssmodels.Volume3D{
+				Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+					return cells, nil
+				}),
+			},
+		}
+		if kinds[operationalIntentKind] {
+			ops, err := repo.SearchOperationalIntents(ctx, v4d, false, scdmodels.OperationalIntentFilter{})
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Unable to search operational intents")
+			}
+			for _, op := range ops {
+				feature(operationalIntentKind, op.ID, op.Cells, map[string]interface{}{
+					"manager":        op.Manager.String(),
+					"state":          op.State,
+					"version":        op.Version,
+					"time_start":     op.StartTime,
+					"time_end":       op.EndTime,
+					"altitude_lower": op.AltitudeLower,
+					"altitude_upper": op.AltitudeUpper,
+				})
+			}
+		}
+		if kinds[constraintKind] {
+			constraints, err := repo.SearchConstraints(ctx, v4d, scdmodels.ConstraintFilter{})
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Unable to search constraints")
+			}
+			for _, c := range constraints {
+				feature(constraintKind, c.ID, c.Cells, map[string]interface{}{
+					"manager":        c.Manager.String(),
+					"type":           c.Type,
+					"version":        c.Version,
+					"time_start":     c.StartTime,
+					"time_end":       c.EndTime,
+					"altitude_lower": c.AltitudeLower,
+					"altitude_upper": c.AltitudeUpper,
+				})
+			}
+		}
+	}
+	return features, nil
+}
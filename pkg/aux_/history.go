@@ -0,0 +1,115 @@
+package aux
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridrepos "github.com/interuss/dss/pkg/rid/repos"
+	scdrepos "github.com/interuss/dss/pkg/scd/repos"
+	"go.uber.org/zap"
+)
+
+const historyPathPrefix = "/aux/v1/history/"
+
+// handleHistory serves the state of a single entity as of a past timestamp:
+//
+//	GET /aux/v1/history/{operational_intents|constraints|identification_service_areas}/<id>?as_of=<RFC3339>
+func (a *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, historyPathPrefix), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	kind := parts[0]
+	id, err := dssmodels.IDFromString(parts[1])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	asOf, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("as_of"))
+	if err != nil {
+		http.Error(w, "Missing or invalid as_of timestamp; expected RFC3339", http.StatusBadRequest)
+		return
+	}
+	if !asOf.Before(time.Now()) {
+		http.Error(w, "as_of must be in the past", http.StatusBadRequest)
+		return
+	}
+
+	var entity json.Marshaler
+	switch kind {
+	case "operational_intents", "constraints":
+		if a.SCDHistory == nil {
+			http.Error(w, "Strategic conflict detection history is not available", http.StatusNotFound)
+			return
+		}
+		entity, err = a.scdEntityAsOf(r.Context(), kind, id, asOf)
+	case "identification_service_areas":
+		if a.RIDHistory == nil {
+			http.Error(w, "Remote ID history is not available", http.StatusNotFound)
+			return
+		}
+		entity, err = a.isaAsOf(r.Context(), id, asOf)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.Logger.Error("Error querying entity history", zap.String("kind", kind), zap.String("id", id.String()), zap.Error(err))
+		http.Error(w, "Error querying entity history", http.StatusInternalServerError)
+		return
+	}
+	if entity == nil {
+		http.Error(w, "Entity did not exist at the requested time", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, entity)
+}
+
+func (a *Server) scdEntityAsOf(ctx context.Context, kind string, id dssmodels.ID, asOf time.Time) (json.Marshaler, error) {
+	var entity json.Marshaler
+	err := a.SCDHistory.InteractAsOf(ctx, asOf, func(ctx context.Context, r scdrepos.Repository) error {
+		switch kind {
+		case "operational_intents":
+			op, err := r.GetOperationalIntent(ctx, id)
+			if err != nil || op == nil {
+				return err
+			}
+			entity = op
+		case "constraints":
+			constraint, err := r.GetConstraint(ctx, id)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			entity = constraint
+		}
+		return nil
+	})
+	return entity, err
+}
+
+func (a *Server) isaAsOf(ctx context.Context, id dssmodels.ID, asOf time.Time) (json.Marshaler, error) {
+	var entity json.Marshaler
+	err := a.RIDHistory.InteractAsOf(ctx, asOf, func(r ridrepos.Repository) error {
+		isa, err := r.GetISA(ctx, id)
+		if err != nil || isa == nil {
+			return err
+		}
+		entity = isa
+		return nil
+	})
+	return entity, err
+}
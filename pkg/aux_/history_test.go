@@ -0,0 +1,105 @@
+package aux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridrepos "github.com/interuss/dss/pkg/rid/repos"
+	ridmemory "github.com/interuss/dss/pkg/rid/store/memory"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	scdrepos "github.com/interuss/dss/pkg/scd/repos"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+// scdHistory serves the current state of a memory store as that of any past
+// time, recording the times queried.
+type scdHistory struct {
+	store *scdmemory.Store
+	asOf  []time.Time
+}
+
+func (h *scdHistory) InteractAsOf(ctx context.Context, t time.Time, f func(context.Context, scdrepos.Repository) error) error {
+	h.asOf = append(h.asOf, t)
+	r, err := h.store.Interact(ctx)
+	if err != nil {
+		return err
+	}
+	return f(ctx, r)
+}
+
+type ridHistory struct {
+	store *ridmemory.Store
+}
+
+func (h *ridHistory) InteractAsOf(ctx context.Context, t time.Time, f func(ridrepos.Repository) error) error {
+	r, err := h.store.Interact(ctx)
+	if err != nil {
+		return err
+	}
+	return f(r)
+}
+
+func TestHandleHistory(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		clock        = clockwork.NewFakeClock()
+		scd          = &scdHistory{store: scdmemory.NewStore(clock)}
+		a            = &Server{SCDHistory: scd}
+		start        = clock.Now()
+		end          = start.Add(time.Hour)
+		constraintID = dssmodels.ID(uuid.New().String())
+		asOf         = time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	)
+	require.NoError(t, scd.store.Transact(ctx, func(ctx context.Context, r scdrepos.Repository) error {
+		_, err := r.UpsertConstraint(ctx, &scdmodels.Constraint{
+			ID:         constraintID,
+			Manager:    "uss1",
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss1.example.com",
+			Cells:      s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)},
+		})
+		return err
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.handleHistory(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	query := "?as_of=" + asOf.Format(time.RFC3339)
+
+	w := get(historyPathPrefix + "constraints/" + constraintID.String() + query)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, json.Valid(w.Body.Bytes()))
+	require.Contains(t, w.Body.String(), constraintID.String())
+	require.Equal(t, []time.Time{asOf}, scd.asOf)
+
+	// Entities missing at the time requested are reported as such.
+	require.Equal(t, http.StatusNotFound, get(historyPathPrefix+"constraints/"+uuid.New().String()+query).Code)
+	require.Equal(t, http.StatusNotFound, get(historyPathPrefix+"operational_intents/"+uuid.New().String()+query).Code)
+
+	// Remote ID history is disabled without a store.
+	isaPath := historyPathPrefix + "identification_service_areas/" + uuid.New().String() + query
+	require.Equal(t, http.StatusNotFound, get(isaPath).Code)
+	a.RIDHistory = &ridHistory{store: ridmemory.NewStore(clock)}
+	require.Equal(t, http.StatusNotFound, get(isaPath).Code)
+
+	for _, path := range []string{
+		historyPathPrefix + "constraints/" + constraintID.String(),
+		historyPathPrefix + "constraints/" + constraintID.String() + "?as_of=yesterday",
+		historyPathPrefix + "constraints/" + constraintID.String() + "?as_of=" + time.Now().Add(time.Hour).Format(time.RFC3339),
+		historyPathPrefix + "constraints/not-a-uuid" + query,
+	} {
+		require.Equal(t, http.StatusBadRequest, get(path).Code, path)
+	}
+	require.Equal(t, http.StatusNotFound, get(historyPathPrefix+"subscriptions/"+constraintID.String()+query).Code)
+}
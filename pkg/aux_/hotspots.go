@@ -0,0 +1,40 @@
+package aux
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	hotspotsPath = "/aux/v1/write_hotspots"
+
+	// defaultHotspots and maxHotspots are the default and maximum number of
+	// hotspots served.
+	defaultHotspots = 10
+	maxHotspots     = 1000
+)
+
+// handleHotspots serves the coarse cells written to the most recently, with
+// their write rates and the managers writing the most, for operators to
+// detect USSs rewriting their entities pathologically often:
+//
+//	GET /aux/v1/write_hotspots[?limit=<count>]
+func (a *Server) handleHotspots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Hotspots == nil {
+		http.Error(w, "Write hotspot tracking is not enabled", http.StatusNotFound)
+		return
+	}
+	limit := defaultHotspots
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxHotspots {
+			http.Error(w, "Invalid limit; expected 1 to "+strconv.Itoa(maxHotspots), http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, a.Hotspots.Top(limit))
+}
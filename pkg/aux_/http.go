@@ -0,0 +1,447 @@
+package aux
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/interuss/dss/pkg/auth"
+	"github.com/interuss/dss/pkg/cache"
+	"github.com/interuss/dss/pkg/cockroach"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+)
+
+// HTTPHandler returns an http.Handler serving the operator-facing auxiliary
+// endpoints that are not part of the public gRPC API. Pool operators
+// authenticate with access tokens granting OperatorScope, and monitoring
+// systems with API keys where configured. The GeoJSON export, which maps the
+// entities of every USS, is only served to pool operators. The ID minting,
+// operational intent transfer, notification index reset, subscription
+// coverage and dependencies endpoints authenticate USSs with their access
+// tokens, and the instance metadata is public. The ID minting, transfer and
+// reset endpoints are refused while the instance is read-only.
+func (a *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/aux/v1/summary", a.monitoring(a.handleSummary))
+	mux.HandleFunc("/aux/v1/db_pool_stats", a.monitoring(a.handleDBPoolStats))
+	mux.HandleFunc("/aux/v1/storage_footprint", a.monitoring(a.handleStorageFootprint))
+	mux.HandleFunc("/aux/v1/leaseholders", a.monitoring(a.handleLeaseholders))
+	mux.HandleFunc("/aux/v1/datastore_health", a.monitoring(a.handleDatastoreHealth))
+	mux.HandleFunc("/aux/v1/statistics", a.monitoring(a.handleStatistics))
+	mux.HandleFunc("/aux/v1/sla_probe", a.monitoring(a.handleSLAProbe))
+	mux.HandleFunc("/aux/v1/pool_check", a.monitoring(a.handlePoolCheck))
+	mux.HandleFunc("/aux/v1/rid_notifications", a.monitoring(a.handleRIDNotifications))
+	mux.HandleFunc(hotspotsPath, a.monitoring(a.handleHotspots))
+	mux.HandleFunc(geoJSONPath, a.operatorOnly(a.handleGeoJSON))
+	mux.HandleFunc(historyPathPrefix, a.operatorOnly(a.handleHistory))
+	mux.HandleFunc(ovnPathPrefix, a.operatorOnly(a.handleOVN))
+	mux.HandleFunc(versionsPathPrefix, a.operatorOnly(a.handleVersions))
+	mux.HandleFunc("/aux/v1/audit_log", a.operatorOnly(a.handleAuditLog))
+	mux.HandleFunc("/aux/v1/dss_reports", a.operatorOnly(a.handleDSSReports))
+	mux.HandleFunc("/aux/v1/dss_reports/counts", a.operatorOnly(a.handleDSSReportCounts))
+	mux.HandleFunc(flagsPath, a.operatorOnly(a.handleFlags))
+	mux.HandleFunc(flagsPath+"/", a.operatorOnly(a.handleFlags))
+	mux.HandleFunc(readOnlyPath, a.operatorOnly(a.handleReadOnly))
+	mux.HandleFunc(restrictionsPath, a.operatorOnly(a.handleRestrictions))
+	mux.HandleFunc(restrictionsPath+"/", a.operatorOnly(a.handleRestrictions))
+	mux.HandleFunc(idsPath, noAPIKeys(a.writable(a.handleIDs)))
+	mux.HandleFunc(transferPathPrefix, noAPIKeys(a.writable(a.handleTransfer)))
+	mux.HandleFunc(notificationIndexPathPrefix, noAPIKeys(a.writable(a.handleNotificationIndexReset)))
+	mux.HandleFunc(coveragePath, noAPIKeys(a.handleCoverage))
+	mux.HandleFunc(dependenciesPathPrefix, noAPIKeys(a.handleDependencies))
+	mux.HandleFunc(clockPath, noAPIKeys(a.handleClock))
+	mux.HandleFunc("/aux/v1/instance", a.handleInstance)
+	return recoverPanics(mux)
+}
+
+// recoverPanics answers the requests whose handling by h panics with an
+// Internal Server Error naming an error ID, with which the panic is logged.
+func recoverPanics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer func() {
+			p, ok := err.(*dsserr.Panic)
+			if !ok {
+				return
+			}
+			if p.Value == http.ErrAbortHandler {
+				panic(p.Value)
+			}
+			errID := dsserr.MakeErrID()
+			logging.Logger.Error("Panic during aux request",
+				zap.String("error_id", errID),
+				zap.String("path", r.URL.Path),
+				zap.String("panic_stack", string(p.Stack)),
+				zap.Error(p))
+			http.Error(w, "Internal server error "+errID, http.StatusInternalServerError)
+		}()
+		defer dsserr.RecoverPanic(&err)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// monitoring restricts h to callers presenting an API key valid for the
+// region of this instance, if API keys are configured.
+func (a *Server) monitoring(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.APIKeys == nil {
+			h(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		key, err := a.APIKeys.Authenticate(r.Header.Get(auth.APIKeyHeader), a.Region)
+		if err != nil {
+			logging.Logger.Info("Rejected monitoring request", zap.String("path", r.URL.Path), zap.Error(err))
+			http.Error(w, "Missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		logging.Logger.Debug("Monitoring request", zap.String("path", r.URL.Path), zap.String("api_key", key.ID))
+		h(w, r)
+	}
+}
+
+// OperatorScope is the scope of the access tokens of pool operators, granting
+// access to the operator endpoints of HTTPHandler.
+const OperatorScope auth.Scope = "interuss.dss.operator"
+
+// OperatorWriteScope is the scope of the access tokens of pool operators
+// allowed to change the state of the pool through the operator endpoints of
+// HTTPHandler, such as feature flags, the read-only mode and write
+// restrictions.
+const OperatorWriteScope auth.Scope = "interuss.dss.operator.write"
+
+// operatorOnly restricts h to pool operators, authenticated by access tokens
+// granting OperatorScope to read and OperatorWriteScope to make changes.
+func (a *Server) operatorOnly(h http.HandlerFunc) http.HandlerFunc {
+	return noAPIKeys(func(w http.ResponseWriter, r *http.Request) {
+		if a.Authorizer == nil {
+			http.Error(w, "Access tokens are not accepted by this instance", http.StatusNotFound)
+			return
+		}
+		scope, mutating := OperatorScope, r.Method != http.MethodGet && r.Method != http.MethodHead
+		if mutating {
+			scope = OperatorWriteScope
+		}
+		operator, err := a.Authorizer.AuthenticateWithScope(r.Header.Get("Authorization"), scope)
+		if err != nil {
+			logging.Logger.Info("Rejected operator request", zap.String("path", r.URL.Path), zap.String("method", r.Method), zap.Error(err))
+			if stacktrace.GetCode(err) == dsserr.PermissionDenied {
+				http.Error(w, "Access token missing scope "+string(scope), http.StatusForbidden)
+			} else {
+				http.Error(w, "Missing or invalid access token", http.StatusUnauthorized)
+			}
+			return
+		}
+		if mutating {
+			logging.Logger.Info("Operator change", zap.String("path", r.URL.Path), zap.String("method", r.Method), zap.String("operator", string(operator)))
+		} else {
+			logging.Logger.Debug("Operator request", zap.String("path", r.URL.Path), zap.String("operator", string(operator)))
+		}
+		h(w, r)
+	})
+}
+
+// noAPIKeys rejects the requests authenticated with an API key since API keys
+// only grant access to the monitoring endpoints.
+func noAPIKeys(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(auth.APIKeyHeader) != "" {
+			http.Error(w, "API keys do not grant access to this endpoint", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// authenticateUSS returns the manager authenticated by the access token of r,
+// or an empty manager if the token grants OperatorScope, for pool operators
+// to act on the entities of every manager. It answers r itself and returns
+// false if r is not authenticated.
+func (a *Server) authenticateUSS(w http.ResponseWriter, r *http.Request) (dssmodels.Manager, bool) {
+	if a.Authorizer == nil {
+		http.Error(w, "Access tokens are not accepted by this instance", http.StatusNotFound)
+		return "", false
+	}
+	owner, scopes, err := a.Authorizer.AuthenticateScopes(r.Header.Get("Authorization"))
+	if err != nil {
+		logging.Logger.Info("Rejected request", zap.String("path", r.URL.Path), zap.Error(err))
+		http.Error(w, "Missing or invalid access token", http.StatusUnauthorized)
+		return "", false
+	}
+	if _, ok := scopes[OperatorScope]; ok {
+		return "", true
+	}
+	return dssmodels.Manager(owner), true
+}
+
+func (a *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Summary == nil {
+		http.Error(w, "Summaries are not enabled", http.StatusNotFound)
+		return
+	}
+	s := a.Summary.Last()
+	if s == nil {
+		http.Error(w, "No summary available yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s)
+}
+
+func (a *Server) handleDBPoolStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := make(map[string]sql.DBStats, len(a.Databases))
+	for name, db := range a.Databases {
+		stats[name] = db.Stats()
+	}
+	writeJSON(w, stats)
+}
+
+// footprintsTTL is how long the storage footprints are cached, sparing the
+// database the index scans computing them.
+const footprintsTTL = 10 * time.Minute
+
+// managerFootprint is the storage consumed by a manager across all tables.
+type managerFootprint struct {
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+}
+
+// storageFootprint is the storage consumed by each manager, in total and by
+// database.
+type storageFootprint struct {
+	AsOf      time.Time                        `json:"as_of"`
+	Managers  map[string]*managerFootprint     `json:"managers"`
+	Databases map[string][]cockroach.Footprint `json:"databases"`
+}
+
+func (a *Server) handleStorageFootprint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.footprintsOnce.Do(func() {
+		a.footprints = cache.New(footprintsTTL, clockwork.NewRealClock())
+	})
+	v, err := a.footprints.Get("storage_footprint", func() (interface{}, error) {
+		s := &storageFootprint{
+			AsOf:      time.Now().UTC(),
+			Managers:  map[string]*managerFootprint{},
+			Databases: map[string][]cockroach.Footprint{},
+		}
+		for name, f := range a.Footprints {
+			footprints, err := f.StorageFootprint(r.Context())
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Error computing storage footprint of database %s", name)
+			}
+			s.Databases[name] = footprints
+			for _, fp := range footprints {
+				m, ok := s.Managers[fp.Owner]
+				if !ok {
+					m = &managerFootprint{}
+					s.Managers[fp.Owner] = m
+				}
+				m.Rows += fp.Rows
+				m.Bytes += fp.Bytes
+			}
+		}
+		return s, nil
+	})
+	if err != nil {
+		logging.Logger.Error("Error computing storage footprint", zap.Error(err))
+		http.Error(w, "Error computing storage footprint", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, v)
+}
+
+// databaseLocality is the locality of the node a database is accessed
+// through and the regions of the leaseholders of its tables.
+type databaseLocality struct {
+	Locality string                   `json:"locality"`
+	Region   string                   `json:"region"`
+	Tables   []cockroach.Leaseholders `json:"tables"`
+}
+
+// handleLeaseholders serves the regions through which the writes to each
+// table go, for operators to tell which writes pay cross-region latency.
+func (a *Server) handleLeaseholders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	result := make(map[string]databaseLocality, len(a.Databases))
+	for name, db := range a.Databases {
+		tables, err := db.LeaseholderRegions(r.Context(), name)
+		if err != nil {
+			logging.Logger.Error("Error listing leaseholder regions", zap.String("database", name), zap.Error(err))
+			http.Error(w, "Error listing leaseholder regions", http.StatusInternalServerError)
+			return
+		}
+		result[name] = databaseLocality{
+			Locality: db.Locality.String(),
+			Region:   db.Locality.Region(),
+			Tables:   tables,
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleDatastoreHealth serves the health of the cockroach cluster shared by
+// the pool: the liveness of its nodes and the replication status of their
+// stores. The cluster being shared, all the instances of the pool report the
+// same nodes.
+func (a *Server) handleDatastoreHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var names []string
+	for name := range a.Databases {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		http.Error(w, "No database is connected", http.StatusNotFound)
+		return
+	}
+	// All the databases are in the same cluster, queried through the first.
+	sort.Strings(names)
+	health, err := a.Databases[names[0]].ClusterHealth(r.Context())
+	if err != nil {
+		logging.Logger.Error("Error reading datastore health", zap.Error(err))
+		http.Error(w, "Error reading datastore health", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, health)
+}
+
+// handleSLAProbe serves the latency percentiles of the API calls of the SLA
+// probe, by operation.
+func (a *Server) handleSLAProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Probe == nil {
+		http.Error(w, "SLA probe is not enabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, a.Probe.Stats())
+}
+
+// handlePoolCheck serves the report of the latest check of the pool
+// convergence.
+func (a *Server) handlePoolCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Pool == nil {
+		http.Error(w, "Pool checker is not enabled", http.StatusNotFound)
+		return
+	}
+	report := a.Pool.Last()
+	if report == nil {
+		http.Error(w, "Pool has not been checked yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// handleRIDNotifications serves the delivery statistics of the ISA
+// notifications pushed to subscribers.
+func (a *Server) handleRIDNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Notifications == nil {
+		http.Error(w, "RID push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, a.Notifications.Stats())
+}
+
+// statisticsTTL is how long the statistics are cached, sparing the
+// database the scans computing them.
+const statisticsTTL = time.Minute
+
+// statistics counts the active entities by kind, by S2 cell at
+// cockroach.DensityLevel and by manager.
+type statistics struct {
+	AsOf     time.Time                   `json:"as_of"`
+	Level    int                         `json:"level"`
+	Regions  map[string]map[string]int64 `json:"regions"`
+	Managers map[string]map[string]int64 `json:"managers"`
+}
+
+// handleStatistics serves the density of the airspace, for authorities to
+// monitor without scraping the entities.
+func (a *Server) handleStatistics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.statisticsOnce.Do(func() {
+		a.statistics = cache.New(statisticsTTL, clockwork.NewRealClock())
+	})
+	v, err := a.statistics.Get("statistics", func() (interface{}, error) {
+		s := &statistics{
+			AsOf:     time.Now().UTC(),
+			Level:    cockroach.DensityLevel,
+			Regions:  map[string]map[string]int64{},
+			Managers: map[string]map[string]int64{},
+		}
+		add := func(counts map[string]map[string]int64, key string, d cockroach.Density) {
+			kinds, ok := counts[key]
+			if !ok {
+				kinds = map[string]int64{}
+				counts[key] = kinds
+			}
+			kinds[d.Kind] += d.Count
+		}
+		for name, reporter := range a.Densities {
+			densities, err := reporter.EntityDensity(r.Context(), s.AsOf)
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Error computing density of database %s", name)
+			}
+			for _, d := range densities {
+				if d.Region != "" {
+					add(s.Regions, d.Region, d)
+				} else {
+					add(s.Managers, d.Manager, d)
+				}
+			}
+		}
+		return s, nil
+	})
+	if err != nil {
+		logging.Logger.Error("Error computing statistics", zap.Error(err))
+		http.Error(w, "Error computing statistics", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Logger.Error("Error encoding aux response", zap.Error(err))
+	}
+}
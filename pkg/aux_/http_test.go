@@ -0,0 +1,157 @@
+package aux
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/interuss/dss/pkg/auth"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/readonly"
+	"github.com/stretchr/testify/require"
+)
+
+type keyResolver []interface{}
+
+func (r keyResolver) ResolveKeys(context.Context) ([]interface{}, error) {
+	return r, nil
+}
+
+// newAuthorizer returns an Authorizer and a function issuing it bearer
+// tokens for an owner and space-separated scopes.
+func newAuthorizer(t *testing.T) (*auth.Authorizer, func(owner, scope string) string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a, err := auth.NewRSAAuthorizer(ctx, auth.Configuration{
+		KeyResolver:       keyResolver{&key.PublicKey},
+		KeyRefreshTimeout: time.Hour,
+		AcceptedAudiences: []string{""},
+	})
+	require.NoError(t, err)
+	return a, func(owner, scope string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"sub":   owner,
+			"iss":   "baz",
+			"scope": scope,
+		}).SignedString(key)
+		require.NoError(t, err)
+		return "Bearer " + s
+	}
+}
+
+func TestOperatorEndpointsRequireOperatorScope(t *testing.T) {
+	authorizer, token := newAuthorizer(t)
+	h := (&Server{Authorizer: authorizer, ReadOnly: &readonly.Mode{}}).HTTPHandler()
+	get := func(header http.Header) int {
+		r := httptest.NewRequest(http.MethodGet, readOnlyPath, nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, get(http.Header{}))
+	require.Equal(t, http.StatusUnauthorized, get(http.Header{"Authorization": {"Bearer invalid"}}))
+	require.Equal(t, http.StatusForbidden, get(http.Header{"Authorization": {token("uss1", "utm.strategic_coordination")}}))
+	require.Equal(t, http.StatusOK, get(http.Header{"Authorization": {token("operator", string(OperatorScope))}}))
+	require.Equal(t, http.StatusForbidden, get(http.Header{
+		"Authorization":   {token("operator", string(OperatorScope))},
+		auth.APIKeyHeader: {"key"},
+	}))
+
+	// Changes additionally require OperatorWriteScope.
+	put := func(scope string) int {
+		r := httptest.NewRequest(http.MethodPut, readOnlyPath+"?reason=upgrade", nil)
+		r.Header.Set("Authorization", token("operator", scope))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusForbidden, put(string(OperatorScope)))
+	require.Equal(t, http.StatusOK, put(string(OperatorWriteScope)))
+
+	// The map of the entities of every USS is not exposed to USSs, nor
+	// without authentication.
+	for _, header := range []http.Header{{}, {"Authorization": {token("uss1", "utm.strategic_coordination")}}} {
+		r := httptest.NewRequest(http.MethodGet, geoJSONPath+"?bbox=0,0,0.01,0.01", nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Contains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, w.Code)
+	}
+
+	// Without access token validation, operator endpoints are unavailable.
+	h = (&Server{ReadOnly: &readonly.Mode{}}).HTTPHandler()
+	require.Equal(t, http.StatusNotFound, get(http.Header{}))
+}
+
+func TestAuthenticateUSS(t *testing.T) {
+	authorizer, token := newAuthorizer(t)
+	a := &Server{Authorizer: authorizer}
+	authenticate := func(header string) (dssmodels.Manager, bool, int) {
+		r := httptest.NewRequest(http.MethodGet, coveragePath, nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		manager, ok := a.authenticateUSS(w, r)
+		return manager, ok, w.Code
+	}
+
+	manager, ok, _ := authenticate(token("uss1", "utm.strategic_coordination"))
+	require.True(t, ok)
+	require.Equal(t, dssmodels.Manager("uss1"), manager)
+
+	// Operators act on the entities of every manager.
+	manager, ok, _ = authenticate(token("operator", string(OperatorScope)))
+	require.True(t, ok)
+	require.Equal(t, dssmodels.Manager(""), manager)
+
+	_, ok, code := authenticate("")
+	require.False(t, ok)
+	require.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestWritesRefusedWhileReadOnly(t *testing.T) {
+	authorizer, token := newAuthorizer(t)
+	a := &Server{Authorizer: authorizer, ReadOnly: &readonly.Mode{}, SchemaReadOnly: &readonly.Mode{}}
+	h := a.HTTPHandler()
+	post := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set("Authorization", token("uss1", "utm.strategic_coordination"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	paths := []string{
+		idsPath,
+		transferPathPrefix + "00000000-0000-4000-8000-000000000000" + transferPathSuffix,
+		notificationIndexPathPrefix + "scd/00000000-0000-4000-8000-000000000000" + notificationIndexPathSuffix,
+	}
+	for _, path := range paths {
+		require.NotEqual(t, http.StatusServiceUnavailable, post(path).Code, path)
+	}
+
+	a.ReadOnly.Enable("maintenance", time.Minute)
+	for _, path := range paths {
+		w := post(path)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+		require.Equal(t, "60", w.Header().Get("Retry-After"))
+	}
+
+	// The read-only mode derived from the schema cannot be lifted by
+	// operators.
+	a.ReadOnly.Disable()
+	a.SchemaReadOnly.Enable("schema too new", 0)
+	w := post(idsPath)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), "schema too new")
+}
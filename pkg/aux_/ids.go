@@ -0,0 +1,62 @@
+package aux
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/ids"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const idsPath = "/aux/v1/ids"
+
+// handleIDs mints IDs reserved to the caller, identified by the same access
+// tokens as the public API:
+//
+//	POST /aux/v1/ids?version={v4|v7}&count=<n>
+func (a *Server) handleIDs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.IDs == nil || a.Authorizer == nil {
+		http.Error(w, "ID minting is not enabled", http.StatusNotFound)
+		return
+	}
+	owner, err := a.Authorizer.Authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		logging.Logger.Info("Rejected ID minting request", zap.Error(err))
+		http.Error(w, "Missing or invalid access token", http.StatusUnauthorized)
+		return
+	}
+
+	version, err := ids.VersionFromString(r.URL.Query().Get("version"))
+	if err != nil {
+		http.Error(w, "Unsupported version; expected v4 or v7", http.StatusBadRequest)
+		return
+	}
+	count := 1
+	if s := r.URL.Query().Get("count"); s != "" {
+		if count, err = strconv.Atoi(s); err != nil || count < 1 || count > ids.MaxCount {
+			http.Error(w, fmt.Sprintf("Invalid count; expected 1 to %d", ids.MaxCount), http.StatusBadRequest)
+			return
+		}
+	}
+
+	reserved, err := a.IDs.Mint(r.Context(), owner, version, count)
+	if stacktrace.GetCode(err) == dsserr.Exhausted {
+		http.Error(w, fmt.Sprintf("Too many IDs reserved; at most %d may be reserved at once", ids.MaxReservations), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		logging.Logger.Error("Error minting IDs", zap.Error(err))
+		http.Error(w, "Error minting IDs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, struct {
+		IDs []ids.Reservation `json:"ids"`
+	}{reserved})
+}
@@ -0,0 +1,102 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/build"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/units"
+	"github.com/interuss/dss/pkg/version"
+	"go.uber.org/zap"
+)
+
+// SchemaVersioner reports the schema version of the database backing a
+// store.
+type SchemaVersioner interface {
+	GetVersion(ctx context.Context) (*semver.Version, error)
+}
+
+// API is a public API served by the DSS.
+type API struct {
+	Name string `json:"name"`
+	// Standard is the standard specifying the API.
+	Standard string `json:"standard"`
+	// BasePath prefixes the paths of the API's endpoints.
+	BasePath string `json:"base_path"`
+}
+
+// The public APIs the DSS may serve.
+var (
+	RIDAPI = API{Name: "rid", Standard: "ASTM F3411-19", BasePath: "/v1/dss"}
+	SCDAPI = API{Name: "scd", Standard: "ASTM F3548-21", BasePath: "/dss/v1"}
+)
+
+// instance is the metadata served by handleInstance.
+type instance struct {
+	Version string `json:"version"`
+	Build   struct {
+		Time   string `json:"time"`
+		Commit string `json:"commit"`
+		Host   string `json:"host"`
+	} `json:"build"`
+	Locality string `json:"locality"`
+	Region   string `json:"region,omitempty"`
+	// Schemas are the database schema versions by API name.
+	Schemas map[string]string `json:"schemas"`
+	// Capabilities are the optional features of the stores by API name.
+	Capabilities map[string]interface{} `json:"capabilities"`
+	APIs         []API                  `json:"apis"`
+	// AltitudeReferences are the vertical datums accepted in the altitudes
+	// of strategic conflict detection volumes; see --egm96_grid_file.
+	AltitudeReferences []units.Reference `json:"altitude_references"`
+	Limits             struct {
+		MaxSubscriptionDuration string `json:"max_subscription_duration"`
+		// SubscriptionTruncation is true if subscriptions exceeding
+		// MaxSubscriptionDuration are truncated rather than rejected.
+		SubscriptionTruncation bool `json:"subscription_truncation"`
+	} `json:"limits"`
+}
+
+// handleInstance describes this instance so that USSs and monitoring tools
+// may check their compatibility with it; it requires no authentication:
+//
+//	GET /aux/v1/instance
+func (a *Server) handleInstance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b := build.Describe()
+	result := &instance{
+		Version:      version.Current().String(),
+		Locality:     a.Locality,
+		Region:       a.Region,
+		Schemas:      make(map[string]string, len(a.Schemas)),
+		Capabilities: map[string]interface{}{},
+		APIs:         a.APIs,
+
+		AltitudeReferences: dssmodels.AltitudeReferences(),
+	}
+	if a.RID != nil {
+		result.Capabilities[RIDAPI.Name] = a.RID.Capabilities()
+	}
+	if a.SCD != nil {
+		result.Capabilities[SCDAPI.Name] = a.SCD.Capabilities()
+	}
+	result.Build.Time, result.Build.Commit, result.Build.Host = b.Time, b.Commit, b.Host
+	result.Limits.MaxSubscriptionDuration = a.Limits.SubscriptionDuration().String()
+	result.Limits.SubscriptionTruncation = a.Limits.TruncateSubscriptions
+	for name, s := range a.Schemas {
+		vs, err := s.GetVersion(r.Context())
+		if err != nil {
+			logging.Logger.Error("Error getting schema version", zap.String("api", name), zap.Error(err))
+			http.Error(w, "Error getting schema version", http.StatusInternalServerError)
+			return
+		}
+		result.Schemas[name] = vs.String()
+	}
+	writeJSON(w, result)
+}
@@ -0,0 +1,68 @@
+package aux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmemory "github.com/interuss/dss/pkg/rid/store/memory"
+	"github.com/interuss/dss/pkg/units"
+	"github.com/interuss/dss/pkg/version"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaVersion struct {
+	version *semver.Version
+	err     error
+}
+
+func (s schemaVersion) GetVersion(context.Context) (*semver.Version, error) {
+	return s.version, s.err
+}
+
+func TestHandleInstance(t *testing.T) {
+	a := &Server{
+		Locality: "dss-west-1",
+		Region:   "eu",
+		APIs:     []API{RIDAPI, SCDAPI},
+		Schemas: map[string]SchemaVersioner{
+			RIDAPI.Name: schemaVersion{version: semver.New("3.1.0")},
+			SCDAPI.Name: schemaVersion{version: semver.New("3.12.0")},
+		},
+		RID:    ridmemory.NewStore(clockwork.NewFakeClock()),
+		Limits: dssmodels.Limits{MaxSubscriptionDuration: 2 * time.Hour, TruncateSubscriptions: true},
+	}
+	get := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.HTTPHandler().ServeHTTP(w, httptest.NewRequest(method, "/aux/v1/instance", nil))
+		return w
+	}
+
+	// No authentication is required.
+	w := get(http.MethodGet)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result instance
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, version.Current().String(), result.Version)
+	require.Equal(t, "dss-west-1", result.Locality)
+	require.Equal(t, "eu", result.Region)
+	require.Equal(t, map[string]string{"rid": "3.1.0", "scd": "3.12.0"}, result.Schemas)
+	require.Equal(t, []API{RIDAPI, SCDAPI}, result.APIs)
+	require.Contains(t, result.Capabilities, RIDAPI.Name)
+	require.NotContains(t, result.Capabilities, SCDAPI.Name)
+	require.Equal(t, "2h0m0s", result.Limits.MaxSubscriptionDuration)
+	require.True(t, result.Limits.SubscriptionTruncation)
+	require.Equal(t, []units.Reference{units.W84}, result.AltitudeReferences)
+
+	require.Equal(t, http.StatusMethodNotAllowed, get(http.MethodPost).Code)
+
+	a.Schemas[SCDAPI.Name] = schemaVersion{err: errors.New("connection refused")}
+	require.Equal(t, http.StatusInternalServerError, get(http.MethodGet).Code)
+}
@@ -0,0 +1,159 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/interuss/dss/pkg/auth"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridrepos "github.com/interuss/dss/pkg/rid/repos"
+	ridserver "github.com/interuss/dss/pkg/rid/server"
+	"github.com/interuss/dss/pkg/scd"
+	scdrepos "github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const (
+	notificationIndexPathPrefix = "/aux/v1/subscriptions/"
+	notificationIndexPathSuffix = "/reset_notification_index"
+	// resetNotificationIndexMethod names the resets in the audit log and
+	// request journal.
+	resetNotificationIndexMethod = "POST " + notificationIndexPathPrefix + "{api}/{id}" + notificationIndexPathSuffix
+)
+
+// notificationIndexScopes are the scopes with which the subscriptions of each
+// API are managed, one of which is required to reset their notification
+// indices.
+var notificationIndexScopes = map[string][]auth.Scope{
+	"rid": {ridserver.Scopes.ISA.Read, ridserver.Scopes.DisplayProvider},
+	"scd": {scd.StrategicCoordinationScope, scd.ConstraintProcessingScope},
+}
+
+// notificationIndexReset is the response of handleNotificationIndexReset.
+type notificationIndexReset struct {
+	ID                dssmodels.ID `json:"id"`
+	NotificationIndex int32        `json:"notification_index"`
+}
+
+// handleNotificationIndexReset sets the notification index of a remote ID or
+// strategic conflict detection subscription back to 0, for its owner, who
+// authenticates with an access token granting a scope managing the
+// subscriptions of the API, or for pool operators granted OperatorWriteScope,
+// to resynchronize with the DSS without recreating the subscription:
+//
+//	POST /aux/v1/subscriptions/{rid|scd}/<id>/reset_notification_index
+//
+// The version of the subscription is left unchanged. Notification indices
+// otherwise wrap around to 0 past models.MaxNotificationIndex. Resets are
+// recorded to the audit log and request journal like the API calls.
+func (a *Server) handleNotificationIndexReset(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, notificationIndexPathSuffix) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Authorizer == nil {
+		http.Error(w, "Access tokens are not accepted by this instance", http.StatusNotFound)
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, notificationIndexPathPrefix), notificationIndexPathSuffix), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	scopes, ok := notificationIndexScopes[parts[0]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	owner, granted, err := a.Authorizer.AuthenticateScopes(r.Header.Get("Authorization"))
+	if err != nil {
+		logging.Logger.Info("Rejected notification index reset", zap.Error(err))
+		http.Error(w, "Missing or invalid access token of the owner of the subscription", http.StatusUnauthorized)
+		return
+	}
+	_, operator := granted[OperatorWriteScope]
+	if !operator {
+		if err := auth.RequireAnyScope(scopes...).ValidateKeyClaimedScopes(r.Context(), granted); err != nil {
+			logging.Logger.Info("Rejected notification index reset", zap.String("owner", owner.String()), zap.Error(err))
+			http.Error(w, "Access token missing scope managing "+parts[0]+" subscriptions", http.StatusForbidden)
+			return
+		}
+	}
+	id, err := dssmodels.IDFromString(parts[1])
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	switch parts[0] {
+	case "rid":
+		if a.RID == nil {
+			http.Error(w, "Remote ID is not enabled", http.StatusNotFound)
+			return
+		}
+		err = a.RID.Transact(r.Context(), func(repo ridrepos.Repository) error {
+			sub, err := repo.GetSubscription(r.Context(), id)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				return stacktrace.NewErrorWithCode(dsserr.NotFound, "Subscription %s not found", id)
+			}
+			if !operator && sub.Owner != owner {
+				return stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Subscription %s is owned by %s", id, sub.Owner)
+			}
+			_, err = repo.ResetNotificationIndex(r.Context(), id)
+			return err
+		})
+	case "scd":
+		if a.SCD == nil {
+			http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+			return
+		}
+		err = a.SCD.Transact(r.Context(), func(ctx context.Context, repo scdrepos.Repository) error {
+			sub, err := repo.GetSubscription(ctx, id)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				return stacktrace.NewErrorWithCode(dsserr.NotFound, "Subscription %s not found", id)
+			}
+			if !operator && sub.Manager != dssmodels.Manager(owner) {
+				return stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Subscription %s is managed by %s", id, sub.Manager)
+			}
+			return repo.ResetNotificationIndex(ctx, id)
+		})
+	}
+	reset := &notificationIndexReset{ID: id}
+	a.recordChange(&change{
+		Method:   resetNotificationIndexMethod,
+		Subject:  owner.String(),
+		EntityID: id.String(),
+		Request:  map[string]string{"api": parts[0], "id": id.String()},
+		Result:   reset,
+		Err:      err,
+	})
+	if err != nil {
+		switch stacktrace.GetCode(err) {
+		case dsserr.NotFound:
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+		case dsserr.PermissionDenied:
+			http.Error(w, "Subscription is not owned by the caller", http.StatusForbidden)
+		default:
+			logging.Logger.Error("Error resetting notification index", zap.String("id", id.String()), zap.Error(err))
+			http.Error(w, "Error resetting notification index", http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Info("Reset notification index", zap.String("api", parts[0]), zap.String("id", id.String()), zap.String("owner", owner.String()))
+
+	writeJSON(w, reset)
+}
@@ -0,0 +1,101 @@
+package aux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/audit"
+	"github.com/interuss/dss/pkg/journal"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/readonly"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	scdrepos "github.com/interuss/dss/pkg/scd/repos"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+type auditLog []*audit.Record
+
+func (l *auditLog) InsertRecord(_ context.Context, r *audit.Record) error {
+	*l = append(*l, r)
+	return nil
+}
+
+type requestJournal []*journal.Entry
+
+func (j *requestJournal) Append(_ context.Context, e *journal.Entry) error {
+	*j = append(*j, e)
+	return nil
+}
+
+func TestHandleNotificationIndexReset(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		clock   = clockwork.NewFakeClock()
+		store   = scdmemory.NewStore(clock)
+		log     = &auditLog{}
+		entries = &requestJournal{}
+		id      = dssmodels.ID(uuid.New().String())
+		start   = clock.Now()
+		end     = start.Add(time.Hour)
+	)
+	authorizer, token := newAuthorizer(t)
+	a := &Server{Authorizer: authorizer, SCD: store, ReadOnly: &readonly.Mode{}, AuditLog: log, Journal: entries}
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r scdrepos.Repository) error {
+		_, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:                id,
+			Manager:           "uss1",
+			StartTime:         &start,
+			EndTime:           &end,
+			USSBaseURL:        "https://uss1.example.com",
+			NotificationIndex: 42,
+			Cells:             s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)},
+		}, "")
+		return err
+	}))
+	h := a.HTTPHandler()
+	post := func(authorization string) int {
+		r := httptest.NewRequest(http.MethodPost, notificationIndexPathPrefix+"scd/"+id.String()+notificationIndexPathSuffix, nil)
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusForbidden, post(token("uss1", "dss.read.identification_service_areas")))
+	require.Empty(t, *log)
+	require.Equal(t, http.StatusForbidden, post(token("uss2", "utm.strategic_coordination")))
+
+	require.Equal(t, http.StatusOK, post(token("uss1", "utm.strategic_coordination")))
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r scdrepos.Repository) error {
+		sub, err := r.GetSubscription(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, 0, sub.NotificationIndex)
+		return nil
+	}))
+	require.Len(t, *log, 2)
+	require.Equal(t, "PermissionDenied", (*log)[0].Code)
+	require.Equal(t, audit.Record{
+		Time:     (*log)[1].Time,
+		Method:   resetNotificationIndexMethod,
+		Manager:  "uss1",
+		EntityID: id.String(),
+		Code:     "OK",
+	}, *(*log)[1])
+	require.Len(t, *entries, 2)
+	require.NotEmpty(t, (*entries)[1].PayloadDigest)
+	require.NotEmpty(t, (*entries)[1].ResultDigest)
+
+	// Pool operators reset the subscriptions of every USS.
+	require.Equal(t, http.StatusOK, post(token("operator", string(OperatorWriteScope))))
+
+	a.ReadOnly.Enable("maintenance", 0)
+	require.Equal(t, http.StatusServiceUnavailable, post(token("uss1", "utm.strategic_coordination")))
+	require.Len(t, *log, 3)
+}
@@ -0,0 +1,130 @@
+package aux
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const ovnPathPrefix = "/aux/v1/operational_intents/by_ovn/"
+
+// operationalIntentVersion is the version of an operational intent served by
+// handleOVN, including its volumes which the API references leave out.
+type operationalIntentVersion struct {
+	ID             dssmodels.ID                     `json:"id"`
+	OVN            scdmodels.OVN                    `json:"ovn"`
+	Manager        dssmodels.Manager                `json:"manager"`
+	Version        scdmodels.VersionNumber          `json:"version"`
+	State          scdmodels.OperationalIntentState `json:"state"`
+	USSBaseURL     string                           `json:"uss_base_url"`
+	SubscriptionID dssmodels.ID                     `json:"subscription_id"`
+	TimeStart      *time.Time                       `json:"time_start"`
+	TimeEnd        *time.Time                       `json:"time_end"`
+	AltitudeLower  *float32                         `json:"altitude_lower"`
+	AltitudeUpper  *float32                         `json:"altitude_upper"`
+	// AltitudeReference is the vertical datum the altitudes were submitted
+	// in, if not WGS84; AltitudeLower and AltitudeUpper are always WGS84.
+	AltitudeReference string    `json:"altitude_reference,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	// Cells are the tokens of the S2 cells covered.
+	Cells []string `json:"cells"`
+	// Volumes and OffNominalVolumes are the volumes submitted for the
+	// operational intent, in the wire format of its details, if the store
+	// keeps them.
+	Volumes           []apiVolume4D `json:"volumes,omitempty"`
+	OffNominalVolumes []apiVolume4D `json:"off_nominal_volumes,omitempty"`
+}
+
+// apiVolume4D encodes a volume in the wire format of the APIs.
+type apiVolume4D struct {
+	*dssmodels.Volume4D
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v apiVolume4D) MarshalJSON() ([]byte, error) {
+	pb, err := v.ToSCDProto()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error converting volume")
+	}
+	return dssmodels.MarshalAPIJSON(pb)
+}
+
+func newAPIVolumes4D(volumes []*dssmodels.Volume4D) []apiVolume4D {
+	result := make([]apiVolume4D, len(volumes))
+	for i, volume := range volumes {
+		result[i] = apiVolume4D{volume}
+	}
+	return result
+}
+
+func newOperationalIntentVersion(op *scdmodels.OperationalIntent) *operationalIntentVersion {
+	version := &operationalIntentVersion{
+		ID:                op.ID,
+		OVN:               op.OVN,
+		Manager:           op.Manager,
+		Version:           op.Version,
+		State:             op.State,
+		USSBaseURL:        op.USSBaseURL,
+		SubscriptionID:    op.SubscriptionID,
+		TimeStart:         op.StartTime,
+		TimeEnd:           op.EndTime,
+		AltitudeLower:     op.AltitudeLower,
+		AltitudeUpper:     op.AltitudeUpper,
+		AltitudeReference: op.AltitudeReference,
+		UpdatedAt:         op.UpdatedAt,
+		Cells:             make([]string, len(op.Cells)),
+
+		Volumes:           newAPIVolumes4D(op.Volumes),
+		OffNominalVolumes: newAPIVolumes4D(op.OffNominalVolumes),
+	}
+	for i, cell := range op.Cells {
+		version.Cells[i] = cell.ToToken()
+	}
+	return version
+}
+
+// handleOVN serves the version of an operational intent identified by an
+// OVN, such as one provided by a USS as part of an airspace key, even if it
+// has been superseded since:
+//
+//	GET /aux/v1/operational_intents/by_ovn/<ovn>
+func (a *Server) handleOVN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.SCD == nil {
+		http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+		return
+	}
+	ovn := scdmodels.OVN(strings.TrimPrefix(r.URL.Path, ovnPathPrefix))
+	if !ovn.Valid() {
+		http.Error(w, "Invalid OVN", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := a.SCD.Interact(r.Context())
+	if err != nil {
+		logging.Logger.Error("Error interacting with store", zap.Error(err))
+		http.Error(w, "Error resolving OVN", http.StatusInternalServerError)
+		return
+	}
+	op, err := repo.GetFullOperationalIntentByOVN(r.Context(), ovn)
+	if err != nil {
+		logging.Logger.Error("Error resolving OVN", zap.String("ovn", ovn.String()), zap.Error(err))
+		http.Error(w, "Error resolving OVN", http.StatusInternalServerError)
+		return
+	}
+	if op == nil {
+		http.Error(w, "OVN does not identify a version of an existing operational intent", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, newOperationalIntentVersion(op))
+}
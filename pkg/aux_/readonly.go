@@ -0,0 +1,79 @@
+package aux
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/readonly"
+	"go.uber.org/zap"
+)
+
+const readOnlyPath = "/aux/v1/read_only"
+
+// handleReadOnly reports and toggles the read-only mode of this instance,
+// in which the calls creating, updating or deleting entities are refused
+// while searches are served:
+//
+//	GET /aux/v1/read_only
+//	PUT /aux/v1/read_only?reason=<reason>&retry_after=<duration>
+//	DELETE /aux/v1/read_only
+//
+// Unlike feature flags, the mode only applies to this instance, so that
+// operators toggle each instance of their deployment.
+func (a *Server) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	if a.ReadOnly == nil {
+		http.Error(w, "Read-only mode is not enabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "maintenance"
+		}
+		var retryAfter time.Duration
+		if s := r.URL.Query().Get("retry_after"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				http.Error(w, "Invalid retry_after; expected a non-negative duration such as 10m", http.StatusBadRequest)
+				return
+			}
+			retryAfter = d
+		}
+		a.ReadOnly.Enable(reason, retryAfter)
+		logging.Logger.Warn("Instance made read-only", zap.String("reason", reason), zap.Duration("retry_after", retryAfter))
+	case http.MethodDelete:
+		a.ReadOnly.Disable()
+		logging.Logger.Warn("Instance made writable")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.ReadOnly.State())
+}
+
+// writable refuses the requests to h which may change the state of the DSS,
+// i.e. other than GET and HEAD, while this instance is read-only, as the
+// read_only interceptor refuses the gRPC calls changing it. They are answered
+// with Service Unavailable and, if known, when to retry in the Retry-After
+// header.
+func (a *Server) writable(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		state := readonly.First(a.SchemaReadOnly, a.ReadOnly)
+		if !state.ReadOnly {
+			h(w, r)
+			return
+		}
+		if state.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(state.RetryAfter, 10))
+		}
+		http.Error(w, "DSS instance is read-only: "+state.Reason, http.StatusServiceUnavailable)
+	}
+}
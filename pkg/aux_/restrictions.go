@@ -0,0 +1,109 @@
+package aux
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/restrictions"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const restrictionsPath = "/aux/v1/write_restrictions"
+
+// writeRestriction is a restrictions.Restriction as served and accepted by
+// handleRestrictions. Requests set the area restricted with Cells, Area or
+// both.
+type writeRestriction struct {
+	*restrictions.Restriction
+	// Cells are the tokens of the S2 cells restricted.
+	Cells []string `json:"cells"`
+	// Area is a polygon in the format of the area parameter of the remote ID
+	// searches, 'lat0,lng0,lat1,lng1,...', whose covering is restricted.
+	Area string `json:"area,omitempty"`
+}
+
+func newWriteRestriction(r *restrictions.Restriction) *writeRestriction {
+	result := &writeRestriction{Restriction: r, Cells: make([]string, len(r.Cells))}
+	for i, cell := range r.Cells {
+		result.Cells[i] = cell.ToToken()
+	}
+	return result
+}
+
+// handleRestrictions lists the write restrictions of the deployment, and
+// creates, replaces or removes them:
+//
+//	GET /aux/v1/write_restrictions
+//	PUT /aux/v1/write_restrictions/<name>
+//	DELETE /aux/v1/write_restrictions/<name>
+//
+// Other instances apply the changes at their next refresh.
+func (a *Server) handleRestrictions(w http.ResponseWriter, r *http.Request) {
+	if a.Restrictions == nil {
+		http.Error(w, "Write restrictions are not enabled", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, restrictionsPath), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		result := []*writeRestriction{}
+		for _, restriction := range a.Restrictions.Restrictions() {
+			result = append(result, newWriteRestriction(restriction))
+		}
+		writeJSON(w, struct {
+			Restrictions []*writeRestriction `json:"restrictions"`
+		}{result})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		req := &writeRestriction{Restriction: &restrictions.Restriction{}}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = name
+		for _, token := range req.Cells {
+			req.Restriction.Cells = append(req.Restriction.Cells, s2.CellIDFromToken(token))
+		}
+		if req.Area != "" {
+			cells, err := geo.AreaToCellIDs(req.Area)
+			if err != nil {
+				http.Error(w, "Invalid area: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Restriction.Cells = append(req.Restriction.Cells, cells...)
+		}
+		if err := a.Restrictions.Put(r.Context(), req.Restriction); err != nil {
+			if stacktrace.GetCode(err) == dsserr.BadRequest {
+				http.Error(w, stacktrace.RootCause(err).Error(), http.StatusBadRequest)
+				return
+			}
+			logging.Logger.Error("Error storing write restriction", zap.String("restriction", name), zap.Error(err))
+			http.Error(w, "Error storing write restriction", http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Info("Stored write restriction", zap.String("restriction", name), zap.Strings("managers", req.Managers))
+		writeJSON(w, newWriteRestriction(req.Restriction))
+	case http.MethodDelete:
+		if err := a.Restrictions.Delete(r.Context(), name); err != nil {
+			logging.Logger.Error("Error deleting write restriction", zap.String("restriction", name), zap.Error(err))
+			http.Error(w, "Error deleting write restriction", http.StatusInternalServerError)
+			return
+		}
+		logging.Logger.Info("Deleted write restriction", zap.String("restriction", name))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
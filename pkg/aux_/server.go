@@ -2,17 +2,133 @@ package aux
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/interuss/dss/pkg/api/v1/auxpb"
+	"github.com/interuss/dss/pkg/audit"
 	"github.com/interuss/dss/pkg/auth"
+	"github.com/interuss/dss/pkg/cache"
+	"github.com/interuss/dss/pkg/cockroach"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/flags"
+	"github.com/interuss/dss/pkg/hotspot"
+	"github.com/interuss/dss/pkg/ids"
+	"github.com/interuss/dss/pkg/journal"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/pool"
+	"github.com/interuss/dss/pkg/probe"
+	"github.com/interuss/dss/pkg/readonly"
+	"github.com/interuss/dss/pkg/restrictions"
+	"github.com/interuss/dss/pkg/rid/notifications"
 	ridserver "github.com/interuss/dss/pkg/rid/server"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/interuss/dss/pkg/version"
 	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
 )
 
 // Server implements auxpb.DSSAuxService.
-type Server struct{}
+type Server struct {
+	// Summary provides the periodic summaries served by HTTPHandler.
+	Summary *summary.Recorder
+	// Databases are the database connections whose pool statistics are
+	// served by HTTPHandler, by database name.
+	Databases map[string]*cockroach.DB
+	// SCDHistory and RIDHistory serve the historical entity queries of
+	// HTTPHandler; the respective queries are disabled if nil.
+	SCDHistory scdstore.HistoricalInteractor
+	RIDHistory ridstore.HistoricalInteractor
+	// SCD resolves the OVNs of operational intents and transfers them
+	// between managers for HTTPHandler; both are disabled if nil, transfers
+	// also requiring Authorizer.
+	SCD scdstore.Store
+	// RID searches the ISAs served as GeoJSON by HTTPHandler, along with
+	// the operational intents and constraints of SCD; ISAs are left out if
+	// nil. The capabilities of both are reported by HTTPHandler.
+	RID ridstore.Store
+	// Footprints report the storage consumed by each manager, by database
+	// name.
+	Footprints map[string]StorageFootprinter
+	// Densities report the number of active entities by region and by
+	// manager, by database name.
+	Densities map[string]DensityReporter
+	// APIKeys, if set, are required to access the monitoring endpoints of
+	// HTTPHandler and must be valid for Region.
+	APIKeys *auth.APIKeys
+	Region  string
+	// IDs mints the IDs served by HTTPHandler to the clients authenticated
+	// by Authorizer; ID minting is disabled if either is nil.
+	IDs        *ids.Reserver
+	Authorizer *auth.Authorizer
+	// Audit serves the audit log and DSS report searches of HTTPHandler;
+	// the searches are disabled if nil.
+	Audit AuditSearcher
+	// AuditLog and Journal record the changes made through HTTPHandler
+	// alongside the API calls; either trail is disabled if nil.
+	AuditLog audit.Recorder
+	Journal  journal.Appender
+	// Locality identifies this instance within the pool, and APIs are the
+	// public APIs it serves, whose database schema versions are reported by
+	// Schemas by API name.
+	Locality string
+	APIs     []API
+	Schemas  map[string]SchemaVersioner
+	// Limits are the limits on the entities accepted by this instance
+	// reported by HTTPHandler.
+	Limits dssmodels.Limits
+	// Flags are the feature gates listed and overridden through
+	// HTTPHandler; the endpoints are disabled if nil.
+	Flags *flags.Set
+	// Clock, if set, is the simulated clock of this instance, advanced
+	// through HTTPHandler by the clients granted SimulatedTimeScope.
+	Clock clockwork.FakeClock
+	// Probe reports the latencies measured by the SLA probe of this
+	// instance, served by HTTPHandler; the endpoint is disabled if nil.
+	Probe *probe.Probe
+	// Pool reports the divergences found by the pool checker of this
+	// instance, served by HTTPHandler; the endpoint is disabled if nil.
+	Pool *pool.Checker
+	// Notifications reports the outcomes of the ISA notifications pushed by
+	// this instance, served by HTTPHandler; the endpoint is disabled if nil.
+	Notifications *notifications.Dispatcher
+	// ReadOnly is the read-only mode of this instance, toggled through
+	// HTTPHandler; the endpoint is disabled if nil.
+	ReadOnly *readonly.Mode
+	// SchemaReadOnly is the read-only mode of this instance derived from the
+	// version of the schema of its databases, which is not toggled at
+	// runtime. Like ReadOnly, it refuses the changes made through
+	// HTTPHandler.
+	SchemaReadOnly *readonly.Mode
+	// Hotspots tracks the rate of the writes to the entities of this
+	// instance by cell, served by HTTPHandler; the endpoint is disabled if
+	// nil.
+	Hotspots *hotspot.Tracker
+	// Restrictions are the write restrictions listed and changed through
+	// HTTPHandler; the endpoints are disabled if nil.
+	Restrictions *restrictions.Set
+
+	// statistics caches the statistics served by HTTPHandler.
+	statistics     *cache.Cache
+	statisticsOnce sync.Once
+	// footprints caches the storage footprints served by HTTPHandler.
+	footprints     *cache.Cache
+	footprintsOnce sync.Once
+}
+
+// StorageFootprinter reports the approximate storage consumed by each
+// manager of the entities in a store.
+type StorageFootprinter interface {
+	StorageFootprint(ctx context.Context) ([]cockroach.Footprint, error)
+}
+
+// DensityReporter reports the number of entities of a store active at a
+// point in time, by region and by manager.
+type DensityReporter interface {
+	EntityDensity(ctx context.Context, now time.Time) ([]cockroach.Density, error)
+}
 
 // AuthScopes returns a map of endpoint to required Oauth scope.
 func (a *Server) AuthScopes() map[auth.Operation]auth.KeyClaimedScopesValidator {
@@ -0,0 +1,188 @@
+package aux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/scd"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const (
+	transferPathPrefix = "/aux/v1/operational_intents/"
+	transferPathSuffix = "/transfer"
+
+	// NewManagerAuthorizationHeader carries the access token of the USS
+	// taking over an operational intent, consenting to the transfer.
+	NewManagerAuthorizationHeader = "X-DSS-New-Manager-Authorization"
+
+	// transferMethod names the transfers in the audit log and request
+	// journal.
+	transferMethod = "POST " + transferPathPrefix + "{id}" + transferPathSuffix
+)
+
+// managerTransferRequest is the body of a request to handleTransfer.
+type managerTransferRequest struct {
+	// OVN is the current OVN of the operational intent.
+	OVN scdmodels.OVN `json:"ovn"`
+	// USSBaseURL and SubscriptionID are those of the new manager.
+	USSBaseURL     string       `json:"uss_base_url"`
+	SubscriptionID dssmodels.ID `json:"subscription_id"`
+}
+
+// handleTransfer hands an operational intent off from its manager, who
+// authenticates as for the public API, to the USS whose access token is in
+// NewManagerAuthorizationHeader, both tokens granting the strategic
+// coordination scope:
+//
+//	POST /aux/v1/operational_intents/<id>/transfer
+//
+// The transfer is made as an update of the operational intent through the
+// API: the subscription of the new manager must cover the operational intent
+// unless it is implicit, the implicit subscription of the former manager is
+// shrunk or removed, and the operational intent gets a new OVN, which is
+// served along with the rest of its new version and the subscribers to
+// notify of it. Transfers are recorded to the audit log and request journal
+// like the API calls.
+func (a *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, transferPathSuffix) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.SCD == nil || a.Authorizer == nil {
+		http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+		return
+	}
+	from, err := a.Authorizer.AuthenticateWithScope(r.Header.Get("Authorization"), scd.StrategicCoordinationScope)
+	if err != nil {
+		logging.Logger.Info("Rejected operational intent transfer", zap.Error(err))
+		http.Error(w, "Missing or invalid access token of the current manager", http.StatusUnauthorized)
+		return
+	}
+	to, err := a.Authorizer.AuthenticateWithScope(r.Header.Get(NewManagerAuthorizationHeader), scd.StrategicCoordinationScope)
+	if err != nil {
+		logging.Logger.Info("Rejected operational intent transfer", zap.String("from", from.String()), zap.Error(err))
+		http.Error(w, "Missing or invalid access token of the new manager in "+NewManagerAuthorizationHeader, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := dssmodels.IDFromString(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, transferPathPrefix), transferPathSuffix))
+	if err != nil {
+		http.Error(w, "Invalid operational intent ID", http.StatusBadRequest)
+		return
+	}
+	req := &managerTransferRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.OVN.Valid() || req.USSBaseURL == "" || req.SubscriptionID == "" {
+		http.Error(w, "Request body must hold the ovn of the operational intent, and the uss_base_url and subscription_id of the new manager", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		op   *scdmodels.OperationalIntent
+		subs []*scdmodels.Subscription
+	)
+	err = a.SCD.Transact(r.Context(), func(ctx context.Context, repo repos.Repository) (err error) {
+		op, subs, err = scd.TransferOperationalIntent(ctx, repo, id, req.OVN, scdmodels.ManagerTransfer{
+			From:           dssmodels.Manager(from),
+			To:             dssmodels.Manager(to),
+			USSBaseURL:     req.USSBaseURL,
+			SubscriptionID: req.SubscriptionID,
+		})
+		return err
+	})
+	var resp *managerTransferResponse
+	if err == nil {
+		resp = &managerTransferResponse{
+			operationalIntentVersion: newOperationalIntentVersion(op),
+			Subscribers:              newSubscribersToNotify(subs),
+		}
+	}
+	a.recordChange(&change{
+		Method:   transferMethod,
+		Subject:  from.String(),
+		EntityID: id.String(),
+		Request: struct {
+			ID dssmodels.ID `json:"id"`
+			To string       `json:"to"`
+			*managerTransferRequest
+		}{id, to.String(), req},
+		Result: resp,
+		Err:    err,
+	})
+	if err != nil {
+		switch stacktrace.GetCode(err) {
+		case dsserr.NotFound:
+			http.Error(w, "Operational intent not found", http.StatusNotFound)
+		case dsserr.VersionMismatch:
+			http.Error(w, "OVN is not the current OVN of the operational intent", http.StatusConflict)
+		case dsserr.PermissionDenied:
+			http.Error(w, "Operational intent is not managed by the caller", http.StatusForbidden)
+		case dsserr.BadRequest:
+			http.Error(w, "Subscription of the new manager does not exist or does not cover the operational intent: "+stacktrace.RootCause(err).Error(), http.StatusBadRequest)
+		default:
+			logging.Logger.Error("Error transferring operational intent", zap.String("id", id.String()), zap.Error(err))
+			http.Error(w, "Error transferring operational intent", http.StatusInternalServerError)
+		}
+		return
+	}
+	logging.Logger.Info("Transferred operational intent", zap.String("id", id.String()), zap.String("from", from.String()), zap.String("to", to.String()))
+
+	writeJSON(w, resp)
+}
+
+// managerTransferResponse is the response of handleTransfer: the new version
+// of the operational intent, and the subscribers to notify of it as for an
+// update of the operational intent through the API.
+type managerTransferResponse struct {
+	*operationalIntentVersion
+	Subscribers []*subscriberToNotify `json:"subscribers"`
+}
+
+// subscriberToNotify is a USS to notify of a change, with the states of its
+// subscriptions, as in the responses of the API.
+type subscriberToNotify struct {
+	USSBaseURL    string               `json:"uss_base_url"`
+	Subscriptions []*subscriptionState `json:"subscriptions"`
+}
+
+type subscriptionState struct {
+	SubscriptionID    dssmodels.ID `json:"subscription_id"`
+	NotificationIndex int32        `json:"notification_index"`
+}
+
+// newSubscribersToNotify groups subs by the USS to notify, ordered by URL.
+func newSubscribersToNotify(subs []*scdmodels.Subscription) []*subscriberToNotify {
+	byURL := map[string]*subscriberToNotify{}
+	result := []*subscriberToNotify{}
+	for _, sub := range subs {
+		subscriber, ok := byURL[sub.USSBaseURL]
+		if !ok {
+			subscriber = &subscriberToNotify{USSBaseURL: sub.USSBaseURL}
+			byURL[sub.USSBaseURL] = subscriber
+			result = append(result, subscriber)
+		}
+		subscriber.Subscriptions = append(subscriber.Subscriptions, &subscriptionState{
+			SubscriptionID:    sub.ID,
+			NotificationIndex: dssmodels.NotificationIndexToProto(sub.NotificationIndex),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].USSBaseURL < result[j].USSBaseURL })
+	return result
+}
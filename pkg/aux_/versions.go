@@ -0,0 +1,119 @@
+package aux
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"go.uber.org/zap"
+)
+
+const versionsPathPrefix = "/aux/v1/versions/"
+
+// constraintVersion is the version of a constraint served by handleVersions.
+type constraintVersion struct {
+	ID            dssmodels.ID             `json:"id"`
+	OVN           scdmodels.OVN            `json:"ovn"`
+	Manager       dssmodels.Manager        `json:"manager"`
+	Type          scdmodels.ConstraintType `json:"type"`
+	Version       scdmodels.VersionNumber  `json:"version"`
+	USSBaseURL    string                   `json:"uss_base_url"`
+	TimeStart     *time.Time               `json:"time_start"`
+	TimeEnd       *time.Time               `json:"time_end"`
+	AltitudeLower *float32                 `json:"altitude_lower"`
+	AltitudeUpper *float32                 `json:"altitude_upper"`
+	UpdatedAt     time.Time                `json:"updated_at"`
+	// Cells are the tokens of the S2 cells covered.
+	Cells []string `json:"cells"`
+}
+
+func newConstraintVersion(c *scdmodels.Constraint) *constraintVersion {
+	version := &constraintVersion{
+		ID:            c.ID,
+		OVN:           c.OVN,
+		Manager:       c.Manager,
+		Type:          c.Type,
+		Version:       c.Version,
+		USSBaseURL:    c.USSBaseURL,
+		TimeStart:     c.StartTime,
+		TimeEnd:       c.EndTime,
+		AltitudeLower: c.AltitudeLower,
+		AltitudeUpper: c.AltitudeUpper,
+		UpdatedAt:     c.UpdatedAt,
+		Cells:         make([]string, len(c.Cells)),
+	}
+	for i, cell := range c.Cells {
+		version.Cells[i] = cell.ToToken()
+	}
+	return version
+}
+
+// handleVersions serves the versions of an operational intent or constraint
+// kept by the store, oldest first, including those of an entity deleted
+// since, to investigate incidents:
+//
+//	GET /aux/v1/versions/{operational_intents|constraints}/<id>
+func (a *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.SCD == nil {
+		http.Error(w, "Strategic conflict detection is not enabled", http.StatusNotFound)
+		return
+	}
+	if !a.SCD.Capabilities().History {
+		http.Error(w, "The strategic conflict detection store does not keep the versions of entities", http.StatusNotImplemented)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, versionsPathPrefix), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	kind := parts[0]
+	id, err := dssmodels.IDFromString(parts[1])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := a.SCD.Interact(r.Context())
+	if err != nil {
+		logging.Logger.Error("Error interacting with store", zap.Error(err))
+		http.Error(w, "Error listing versions", http.StatusInternalServerError)
+		return
+	}
+	var versions []interface{}
+	switch kind {
+	case operationalIntentKind:
+		var ops []*scdmodels.OperationalIntent
+		ops, err = repo.ListOperationalIntentVersions(r.Context(), id)
+		for _, op := range ops {
+			versions = append(versions, newOperationalIntentVersion(op))
+		}
+	case constraintKind:
+		var constraints []*scdmodels.Constraint
+		constraints, err = repo.ListConstraintVersions(r.Context(), id)
+		for _, c := range constraints {
+			versions = append(versions, newConstraintVersion(c))
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.Logger.Error("Error listing versions", zap.String("kind", kind), zap.String("id", id.String()), zap.Error(err))
+		http.Error(w, "Error listing versions", http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "No version of the entity is kept", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"versions": versions})
+}
@@ -0,0 +1,143 @@
+// Package backend opens the stores of the DSS entities in the backend selected
+// by the deployment: CockroachDB, or the memory of the process for tests and
+// demos.
+package backend
+
+import (
+	"context"
+	"flag"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/dss/pkg/logging"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	ridc "github.com/interuss/dss/pkg/rid/store/cockroach"
+	ridmemory "github.com/interuss/dss/pkg/rid/store/memory"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	scdc "github.com/interuss/dss/pkg/scd/store/cockroach"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Kinds of backend.
+const (
+	Cockroach = "cockroach"
+	Memory    = "memory"
+)
+
+// Config selects the backend of an instance.
+type Config struct {
+	// Kind is the kind of backend, Cockroach or Memory.
+	Kind string
+}
+
+// RegisterFlags registers the command line flags setting c in fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Kind, "store_backend", Cockroach, "backing store of the DSS entities: cockroach, or memory to keep them in process memory for tests and demos, losing them on exit")
+}
+
+// Connector connects to the CockroachDB database named dbName.
+type Connector func(dbName string) (*cockroach.DB, error)
+
+// Backend opens the stores of the DSS entities.
+type Backend struct {
+	kind     string
+	connect  Connector
+	clock    clockwork.Clock
+	logger   *zap.Logger
+	recorder *summary.Recorder
+	pings    *cron.Cron
+}
+
+// New returns the Backend selected by c. The stores of the Cockroach backend
+// connect to their databases through connect and record their activity to
+// recorder; those of the Memory backend follow clock.
+func New(c Config, connect Connector, clock clockwork.Clock, logger *zap.Logger, recorder *summary.Recorder) (*Backend, error) {
+	switch c.Kind {
+	case Cockroach, Memory:
+	default:
+		return nil, stacktrace.NewError("Invalid --store_backend %s", c.Kind)
+	}
+	return &Backend{
+		kind:     c.Kind,
+		connect:  connect,
+		clock:    clock,
+		logger:   logger,
+		recorder: recorder,
+	}, nil
+}
+
+// Persistent returns true if the stores of b outlive the process, i.e. are
+// kept in CockroachDB.
+func (b *Backend) Persistent() bool {
+	return b.kind == Cockroach
+}
+
+// RIDStore opens the remote ID store.
+func (b *Backend) RIDStore(ctx context.Context) (ridstore.Store, error) {
+	if !b.Persistent() {
+		return ridmemory.NewStore(b.clock), nil
+	}
+	db, err := b.open(ctx, ridc.DatabaseName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to connect to remote ID database; verify your database configuration is current with https://github.com/interuss/dss/tree/master/build#upgrading-database-schemas")
+	}
+	store, err := ridc.NewStore(ctx, db, b.logger, b.recorder)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to create remote ID store")
+	}
+	return store, nil
+}
+
+// SCDStore opens the strategic conflict detection store, a *scdc.Store with
+// the Cockroach backend.
+func (b *Backend) SCDStore(ctx context.Context) (scdstore.Store, error) {
+	if !b.Persistent() {
+		return scdmemory.NewStore(b.clock), nil
+	}
+	db, err := b.open(ctx, scdc.DatabaseName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to connect to strategic conflict detection database; verify your database configuration is current with https://github.com/interuss/dss/tree/master/build#upgrading-database-schemas")
+	}
+	store, err := scdc.NewStore(ctx, db, b.logger, b.recorder)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to create strategic conflict detection store")
+	}
+	return store, nil
+}
+
+// open connects to the database named dbName and pings it every minute
+// until ctx is done.
+func (b *Backend) open(ctx context.Context, dbName string) (*cockroach.DB, error) {
+	db, err := b.connect(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.pings == nil {
+		b.pings = cron.New()
+		b.pings.Start()
+		go func() {
+			<-ctx.Done()
+			b.pings.Stop()
+		}()
+	}
+	if _, err := b.pings.AddFunc("@every 1m", func() { ping(ctx, db, dbName) }); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to schedule periodic ping to %s", dbName)
+	}
+	return db, nil
+}
+
+// ping pings db, the database named dbName, panicking to force a restart if
+// it fails.
+func ping(ctx context.Context, db *cockroach.DB, dbName string) {
+	logger := logging.WithValuesFromContext(ctx, logging.Logger)
+	if err := db.PingContext(ctx); err != nil {
+		logger.Panic("Failed periodic DB Ping, panic to force restart", zap.String("Database", dbName))
+	} else {
+		logger.Info("Successful periodic DB Ping ", zap.String("Database", dbName), zap.Any("pool", db.Stats()))
+	}
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	ridc "github.com/interuss/dss/pkg/rid/store/cockroach"
+	ridmemory "github.com/interuss/dss/pkg/rid/store/memory"
+	scdc "github.com/interuss/dss/pkg/scd/store/cockroach"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNew(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		clock    = clockwork.NewFakeClock()
+		recorder = summary.NewRecorder(clock)
+		refused  = errors.New("connection refused")
+		connects []string
+		connect  = func(dbName string) (*cockroach.DB, error) {
+			connects = append(connects, dbName)
+			return nil, refused
+		}
+	)
+
+	_, err := New(Config{Kind: "sqlite"}, connect, clock, zap.NewNop(), recorder)
+	require.Error(t, err)
+
+	b, err := New(Config{Kind: Memory}, connect, clock, zap.NewNop(), recorder)
+	require.NoError(t, err)
+	require.False(t, b.Persistent())
+	rid, err := b.RIDStore(ctx)
+	require.NoError(t, err)
+	require.IsType(t, &ridmemory.Store{}, rid)
+	scd, err := b.SCDStore(ctx)
+	require.NoError(t, err)
+	require.IsType(t, &scdmemory.Store{}, scd)
+	require.Empty(t, connects)
+
+	b, err = New(Config{Kind: Cockroach}, connect, clock, zap.NewNop(), recorder)
+	require.NoError(t, err)
+	require.True(t, b.Persistent())
+	_, err = b.RIDStore(ctx)
+	require.True(t, errors.Is(err, refused))
+	_, err = b.SCDStore(ctx)
+	require.True(t, errors.Is(err, refused))
+	require.Equal(t, []string{ridc.DatabaseName, scdc.DatabaseName}, connects)
+}
@@ -0,0 +1,97 @@
+// Package cache implements a read-through cache of values expiring after a
+// TTL, for the queries of the DSS whose results are read far more often
+// than they change.
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// Cache is a read-through cache of values by key, each expiring TTL after it
+// was loaded. It is safe for concurrent use.
+type Cache struct {
+	ttl   time.Duration
+	clock clockwork.Clock
+
+	lock    sync.Mutex
+	entries map[string]entry
+	// generation is incremented by every invalidation, so that the values
+	// loaded concurrently with an invalidation are not cached.
+	generation uint64
+	// swept is the last time the expired entries were removed.
+	swept time.Time
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// New returns an empty Cache whose values expire ttl after being loaded
+// according to clock.
+func New(ttl time.Duration, clock clockwork.Clock) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		clock:   clock,
+		entries: map[string]entry{},
+		swept:   clock.Now(),
+	}
+}
+
+// Get returns the value cached for key, loading it with load if it is
+// missing or expired. Errors returned by load are returned as is and not
+// cached.
+func (c *Cache) Get(key string, load func() (interface{}, error)) (interface{}, error) {
+	c.lock.Lock()
+	now := c.clock.Now()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.lock.Unlock()
+		return e.value, nil
+	}
+	generation := c.generation
+	c.lock.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation == generation {
+		c.entries[key] = entry{value: value, expires: now.Add(c.ttl)}
+	}
+	if now.Sub(c.swept) > c.ttl {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	return value, nil
+}
+
+// Invalidate removes the values which match, and prevents the values being
+// loaded from being cached.
+func (c *Cache) Invalidate(match func(key string, value interface{}) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	for k, e := range c.entries {
+		if match(k, e.value) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Len returns the number of values cached, expired or not.
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
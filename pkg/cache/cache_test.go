@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var (
+		clock = clockwork.NewFakeClock()
+		c     = New(time.Minute, clock)
+		loads int
+	)
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	v, err := c.Get("a/1", load)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+	v, err = c.Get("a/1", load)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	// Errors are not cached.
+	_, err = c.Get("b/1", func() (interface{}, error) { return nil, errors.New("failed") })
+	require.Error(t, err)
+	require.Equal(t, 1, c.Len())
+
+	// Values expire after the TTL.
+	clock.Advance(time.Minute)
+	v, err = c.Get("a/1", load)
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+
+	c.Invalidate(func(key string, _ interface{}) bool { return strings.HasPrefix(key, "a/") })
+	require.Equal(t, 0, c.Len())
+
+	// Values loaded concurrently with an invalidation are not cached.
+	v, err = c.Get("a/1", func() (interface{}, error) {
+		c.Invalidate(func(string, interface{}) bool { return true })
+		return load()
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+	require.Equal(t, 0, c.Len())
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 	"github.com/interuss/stacktrace"
@@ -12,6 +15,10 @@ import (
 
 var (
 	UnknownVersion = &semver.Version{}
+
+	// dbNamePrefixRegexp restricts database name prefixes to characters that
+	// are safe to use in an unquoted SQL identifier.
+	dbNamePrefixRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
 )
 
 type (
@@ -33,8 +40,15 @@ type (
 		Host            string
 		Port            int
 		DBName          string
-		Credentials     Credentials
-		SSL             SSL
+		// DBNamePrefix is prepended to DBName, allowing multiple logical DSS
+		// deployments to share a single CRDB cluster without colliding.
+		DBNamePrefix string
+		Credentials  Credentials
+		// SecondaryCredentials, if Username is set, are used whenever
+		// Credentials are rejected, enabling credential rotation without
+		// downtime.
+		SecondaryCredentials Credentials
+		SSL                  SSL
 	}
 )
 
@@ -51,10 +65,12 @@ func connectParametersFromMap(m map[string]string) ConnectParameters {
 	return ConnectParameters{
 		ApplicationName: m["application_name"],
 		DBName:          m["db_name"],
+		DBNamePrefix:    m["db_name_prefix"],
 		Host:            m["host"],
 		Port:            int(parsePortOrDefault(m["port"], 0)),
 		Credentials: Credentials{
 			Username: m["user"],
+			Password: m["password"],
 		},
 		SSL: SSL{
 			Mode: m["ssl_mode"],
@@ -63,6 +79,15 @@ func connectParametersFromMap(m map[string]string) ConnectParameters {
 	}
 }
 
+// QualifiedDBName returns the name of the database p refers to, including
+// any configured prefix.
+func (p ConnectParameters) QualifiedDBName() string {
+	if p.DBName == "" {
+		return ""
+	}
+	return p.DBNamePrefix + p.DBName
+}
+
 // BuildURI returns a URI built from p.
 func (p ConnectParameters) BuildURI() (string, error) {
 	an := p.ApplicationName
@@ -85,12 +110,19 @@ func (p ConnectParameters) BuildURI() (string, error) {
 	if ssl == "" {
 		return "", stacktrace.NewError("Missing crdb ssl_mode")
 	}
-	db := p.DBName
+	if p.DBNamePrefix != "" && !dbNamePrefixRegexp.MatchString(p.DBNamePrefix) {
+		return "", stacktrace.NewError("Invalid crdb db_name_prefix %s; must consist of lowercase letters, digits and underscores", p.DBNamePrefix)
+	}
+	db := p.QualifiedDBName()
 	if db != "" {
 		db = fmt.Sprintf("/%s", db)
 	}
+	userinfo := u
+	if p.Credentials.Password != "" {
+		userinfo = url.UserPassword(u, p.Credentials.Password).String()
+	}
 	if ssl == "disable" {
-		return fmt.Sprintf("postgresql://%s@%s:%d%s?application_name=%s&sslmode=disable", u, h, port, db, an), nil
+		return fmt.Sprintf("postgresql://%s@%s:%d%s?application_name=%s&sslmode=disable", userinfo, h, port, db, an), nil
 	}
 	dir := p.SSL.Dir
 	if dir == "" {
@@ -99,31 +131,114 @@ func (p ConnectParameters) BuildURI() (string, error) {
 
 	return fmt.Sprintf(
 		"postgresql://%s@%s:%d%s?application_name=%s&sslmode=%s&sslrootcert=%s/ca.crt&sslcert=%s/client.%s.crt&sslkey=%s/client.%s.key",
-		u, h, port, db, an, ssl, dir, dir, u, dir, u,
+		userinfo, h, port, db, an, ssl, dir, dir, u, dir, u,
 	), nil
 }
 
 // DB models a connection to a CRDB instance.
 type DB struct {
 	*sql.DB
+	// NamePrefix is prepended to all database names looked up via this DB.
+	NamePrefix string
+	// RetryPolicy bounds the retries performed by ExecuteTx; the zero value
+	// selects DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+	// Locality is the locality of the node DB is connected to, and
+	// FollowerReadStaleness, if non-zero, how stale the reads of
+	// BeginFollowerRead are.
+	Locality              Locality
+	FollowerReadStaleness time.Duration
+	// pool are the parameters the connections of DB were opened with.
+	pool PoolParameters
+}
+
+// PoolParameters bundles up parameters tuning the pool of connections backing
+// a DB. Zero values keep the database/sql defaults.
+type PoolParameters struct {
+	// MaxOpenConns limits the number of open connections.
+	MaxOpenConns int
+	// MaxIdleConns limits the number of idle connections kept in the pool.
+	MaxIdleConns int
+	// ConnMaxLifetime is the maximum amount of time a connection is reused.
+	ConnMaxLifetime time.Duration
+	// StatementTimeout aborts statements running for longer than it.
+	StatementTimeout time.Duration
+	// DeadlineStatementTimeouts bounds the statements of the transactions
+	// run on behalf of contexts with a deadline by the time left until it,
+	// at the cost of two more statements per transaction.
+	DeadlineStatementTimeouts bool
 }
 
 // Dial returns a DB instance connected to a cockroach instance available at
-// "uri".
+// "uri", with its connection pool configured according to "pool".
 // https://www.cockroachlabs.com/docs/stable/connection-parameters.html
-func Dial(uri string) (*DB, error) {
+func Dial(uri string, pool PoolParameters) (*DB, error) {
+	uri, err := withStatementTimeout(uri, pool.StatementTimeout)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open("postgres", uri)
 	if err != nil {
 		return nil, err
 	}
+	configurePool(db, pool)
 
 	return &DB{
-		DB: db,
+		DB:   db,
+		pool: pool,
 	}, nil
 }
 
+func withStatementTimeout(uri string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error parsing crdb URI")
+	}
+	q := u.Query()
+	q.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func configurePool(db *sql.DB, pool PoolParameters) {
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+}
+
+// BeginAsOf starts a read-only transaction reading the state of the database
+// as of t using CockroachDB time-travel queries. t must be in the past and
+// within the garbage collection window (gc.ttlseconds) of the tables read.
+// The returned transaction should be rolled back once done.
+func (db *DB) BeginAsOf(ctx context.Context, t time.Time) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error beginning read-only transaction")
+	}
+	// AS OF SYSTEM TIME does not accept placeholders; t is rendered as an
+	// integer number of nanoseconds since epoch.
+	query := fmt.Sprintf("SET TRANSACTION AS OF SYSTEM TIME %d", t.UnixNano())
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		_ = tx.Rollback()
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return tx, nil
+}
+
 // GetVersion returns the Schema Version of the requested DB Name
 func (db *DB) GetVersion(ctx context.Context, dbName string) (*semver.Version, error) {
+	dbName = db.NamePrefix + dbName
+
 	const query = `
 		SELECT EXISTS (
 			SELECT
@@ -0,0 +1,111 @@
+package cockroach
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/stacktrace"
+)
+
+// schemaVersionRegexp matches the statements of the migrations setting the
+// schema version.
+var schemaVersionRegexp = regexp.MustCompile(`schema_version\s*=\s*'v?(\d+\.\d+\.\d+)'`)
+
+// SchemaRange is the range of the schema versions of a database a binary
+// supports.
+type SchemaRange struct {
+	// Min is the oldest version the binary reads and writes.
+	Min semver.Version
+	// Max is the newest version the binary knows of, i.e. the version of
+	// the latest migration it was built with.
+	Max semver.Version
+}
+
+// Compatibility is the compatibility of a binary with the schema of a
+// database.
+type Compatibility int
+
+const (
+	// Compatible schemas are read and written.
+	Compatible Compatibility = iota
+	// ReadOnly schemas are newer than the binary, within its major version,
+	// as when the database was migrated before the binary was upgraded.
+	// Since the migrations of a major version only add to the schema, the
+	// binary may read it, but its writes could leave the additions
+	// inconsistent, e.g. new columns it does not know of unset.
+	ReadOnly
+	// Incompatible schemas are neither read nor written.
+	Incompatible
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case Compatible:
+		return "compatible"
+	case ReadOnly:
+		return "read-only"
+	}
+	return "incompatible"
+}
+
+// Compatibility returns the compatibility of a binary supporting r with a
+// database whose schema is at version v.
+func (r SchemaRange) Compatibility(v *semver.Version) Compatibility {
+	switch {
+	case v == nil || *v == *UnknownVersion:
+		return Incompatible
+	case v.Major != r.Max.Major || v.LessThan(r.Min):
+		return Incompatible
+	case r.Max.LessThan(*v):
+		return ReadOnly
+	}
+	return Compatible
+}
+
+// CheckSchema returns the compatibility of a binary supporting r with
+// database, whose schema is at version v, along with an error explaining
+// why unless they are Compatible.
+func CheckSchema(database string, v *semver.Version, r SchemaRange) (Compatibility, error) {
+	c := r.Compatibility(v)
+	switch c {
+	case ReadOnly:
+		return c, stacktrace.NewError("Schema version %s of database %s is newer than %s, the latest this binary supports; upgrade the binary", v, database, r.Max)
+	case Incompatible:
+		if v == nil || *v == *UnknownVersion {
+			return c, stacktrace.NewError("Database %s has not been bootstrapped with Schema Manager", database)
+		}
+		return c, stacktrace.NewError("Schema version %s of database %s is outside of the versions this binary supports, from %s to %s", v, database, r.Min, r.Max)
+	}
+	return c, nil
+}
+
+// LatestSchemaVersion returns the latest schema version set by the up
+// migrations in dir.
+func LatestSchemaVersion(dir string) (*semver.Version, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error listing migrations in %s", dir)
+	}
+	var latest *semver.Version
+	for _, path := range paths {
+		migration, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading migration %s", path)
+		}
+		for _, match := range schemaVersionRegexp.FindAllStringSubmatch(string(migration), -1) {
+			v, err := semver.NewVersion(match[1])
+			if err != nil {
+				return nil, stacktrace.Propagate(err, "Invalid schema version in migration %s", path)
+			}
+			if latest == nil || latest.LessThan(*v) {
+				latest = v
+			}
+		}
+	}
+	if latest == nil {
+		return nil, stacktrace.NewError("No migration in %s sets the schema version", dir)
+	}
+	return latest, nil
+}
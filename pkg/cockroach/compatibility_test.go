@@ -0,0 +1,33 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaRangeCompatibility(t *testing.T) {
+	r := SchemaRange{Min: *semver.New("3.0.0"), Max: *semver.New("3.8.0")}
+
+	for v, expected := range map[string]Compatibility{
+		"3.0.0": Compatible,
+		"3.5.0": Compatible,
+		"3.8.0": Compatible,
+		"3.8.1": ReadOnly,
+		"3.9.0": ReadOnly,
+		"2.9.0": Incompatible,
+		"4.0.0": Incompatible,
+	} {
+		require.Equal(t, expected, r.Compatibility(semver.New(v)), v)
+	}
+	require.Equal(t, Incompatible, r.Compatibility(UnknownVersion))
+	require.Equal(t, Incompatible, r.Compatibility(nil))
+
+	c, err := CheckSchema("scd", semver.New("3.8.0"), r)
+	require.Equal(t, Compatible, c)
+	require.NoError(t, err)
+	c, err = CheckSchema("scd", semver.New("3.9.0"), r)
+	require.Equal(t, ReadOnly, c)
+	require.Error(t, err)
+}
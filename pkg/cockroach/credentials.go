@@ -0,0 +1,169 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Secret is the material authenticating the DSS to CockroachDB supplied by
+// a CredentialsProvider.
+type Secret struct {
+	Credentials Credentials
+	// CACert, ClientCert and ClientKey are PEM-encoded TLS material. If
+	// ClientCert is empty, the files of SSL.Dir are used instead.
+	CACert     []byte
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// CredentialsProvider supplies the current Secret of a database user, such
+// as a secret manager whose secrets are rotated.
+type CredentialsProvider interface {
+	Secret(ctx context.Context) (*Secret, error)
+}
+
+// ApplySecret returns p authenticating with secret, whose TLS material, if
+// any, is written to dir.
+func ApplySecret(p ConnectParameters, secret *Secret, dir string) (ConnectParameters, error) {
+	p.Credentials = secret.Credentials
+	// The credentials of the provider replace those of the flags, so no
+	// fallback is attempted.
+	p.SecondaryCredentials = Credentials{}
+	if len(secret.ClientCert) == 0 {
+		return p, nil
+	}
+	files := map[string][]byte{
+		"ca.crt": secret.CACert,
+		"client." + p.Credentials.Username + ".crt": secret.ClientCert,
+		"client." + p.Credentials.Username + ".key": secret.ClientKey,
+	}
+	for name, content := range files {
+		if len(content) == 0 {
+			return p, stacktrace.NewError("Missing %s in crdb secret", name)
+		}
+		// lib/pq refuses keys readable by others.
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return p, stacktrace.Propagate(err, "Error writing %s of crdb secret", name)
+		}
+	}
+	p.SSL.Dir = dir
+	return p, nil
+}
+
+// providerConnector is a driver.Connector establishing new connections with
+// the current Secret of a CredentialsProvider, fetched at most every refresh
+// unless rejected, so that rotated secrets are picked up without a restart.
+// Established connections are not affected by rotations.
+type providerConnector struct {
+	params   ConnectParameters
+	provider CredentialsProvider
+	refresh  time.Duration
+	pool     PoolParameters
+
+	mu        sync.Mutex
+	connector driver.Connector
+	fetched   time.Time
+	// dirs are the directories holding the TLS material of the secrets
+	// fetched, which are only removed when the next is fetched since
+	// connections may be in the middle of reading them.
+	dirs []string
+}
+
+// current returns the connector using the current Secret, fetching it
+// again if it is older than refresh or if force.
+func (c *providerConnector) current(ctx context.Context, force bool) (driver.Connector, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connector != nil && !force && time.Since(c.fetched) < c.refresh {
+		return c.connector, nil
+	}
+
+	secret, err := c.provider.Secret(ctx)
+	if err != nil {
+		if c.connector != nil {
+			logging.Logger.Warn("Failed to refresh crdb secret; using the previous one", zap.Error(err))
+			return c.connector, nil
+		}
+		return nil, stacktrace.Propagate(err, "Error fetching crdb secret")
+	}
+	dir, err := ioutil.TempDir("", "crdb-secret-")
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error creating directory for crdb secret")
+	}
+	params, err := ApplySecret(c.params, secret, dir)
+	if err == nil {
+		var uri string
+		if uri, err = params.BuildURI(); err == nil {
+			if uri, err = withStatementTimeout(uri, c.pool.StatementTimeout); err == nil {
+				c.connector, err = pq.NewConnector(uri)
+			}
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, stacktrace.Propagate(err, "Error applying crdb secret")
+	}
+	for len(c.dirs) > 1 {
+		_ = os.RemoveAll(c.dirs[0])
+		c.dirs = c.dirs[1:]
+	}
+	c.dirs = append(c.dirs, dir)
+	c.fetched = time.Now()
+	return c.connector, nil
+}
+
+func (c *providerConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connector.Connect(ctx)
+	if err == nil || !isAuthenticationError(err) {
+		return conn, err
+	}
+	// The secret was likely rotated since it was fetched.
+	logging.Logger.Info("Crdb secret rejected; fetching it again", zap.Error(err))
+	if connector, err = c.current(ctx, true); err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *providerConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// DialWithProvider returns a DB instance connected to the cockroach instance
+// of "params" with the Secret supplied by "provider", fetched again at most
+// every "refresh" or whenever it is rejected.
+func DialWithProvider(ctx context.Context, params ConnectParameters, provider CredentialsProvider, refresh time.Duration, pool PoolParameters) (*DB, error) {
+	connector := &providerConnector{
+		params:   params,
+		provider: provider,
+		refresh:  refresh,
+		pool:     pool,
+	}
+	// Fail early on a misconfigured provider.
+	if _, err := connector.current(ctx, true); err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector)
+	configurePool(db, pool)
+
+	return &DB{
+		DB:   db,
+		pool: pool,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package cockroach
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdb-secret-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	params := ConnectParameters{
+		Host:                 "localhost",
+		Port:                 26257,
+		Credentials:          Credentials{Username: "root"},
+		SecondaryCredentials: Credentials{Username: "fallback"},
+		SSL:                  SSL{Mode: "verify-full", Dir: "/flags"},
+	}
+
+	p, err := ApplySecret(params, &Secret{Credentials: Credentials{Username: "dss", Password: "s3cret"}}, dir)
+	require.NoError(t, err)
+	require.Equal(t, "dss", p.Credentials.Username)
+	require.Empty(t, p.SecondaryCredentials.Username)
+	require.Equal(t, "/flags", p.SSL.Dir)
+
+	p, err = ApplySecret(params, &Secret{
+		Credentials: Credentials{Username: "dss"},
+		CACert:      []byte("ca"),
+		ClientCert:  []byte("cert"),
+		ClientKey:   []byte("key"),
+	}, dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, p.SSL.Dir)
+	key, err := ioutil.ReadFile(filepath.Join(dir, "client.dss.key"))
+	require.NoError(t, err)
+	require.Equal(t, "key", string(key))
+	info, err := os.Stat(filepath.Join(dir, "client.dss.key"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = ApplySecret(params, &Secret{Credentials: Credentials{Username: "dss"}, ClientCert: []byte("cert")}, dir)
+	require.Error(t, err)
+}
+
+func TestVaultProvider(t *testing.T) {
+	responses := map[string]string{
+		"/v1/secret/data/dss/crdb": `{"data": {"data": {"username": "dss", "password": "kv"}, "metadata": {"version": 3}}}`,
+		"/v1/database/creds/dss":   `{"lease_id": "database/creds/dss/abc", "data": {"username": "v-dss-abc", "password": "generated"}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+	token := func() (string, error) { return "token", nil }
+
+	secret, err := (&VaultProvider{Address: server.URL, Path: "secret/data/dss/crdb", Token: token}).Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Credentials{Username: "dss", Password: "kv"}, secret.Credentials)
+
+	secret, err = (&VaultProvider{Address: server.URL + "/", Path: "/database/creds/dss", Token: token}).Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Credentials{Username: "v-dss-abc", Password: "generated"}, secret.Credentials)
+
+	_, err = (&VaultProvider{Address: server.URL, Path: "secret/data/missing", Token: token}).Secret(context.Background())
+	require.Error(t, err)
+	_, err = (&VaultProvider{Address: server.URL, Path: "database/creds/dss", Token: func() (string, error) { return "expired", nil }}).Secret(context.Background())
+	require.Error(t, err)
+}
+
+func TestSecretsManagerProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		require.Contains(t, r.Header.Get("Authorization"), "/us-east-1/secretsmanager/aws4_request")
+		require.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		_, _ = w.Write([]byte(`{"Name": "dss/crdb", "SecretString": "{\"username\": \"dss\", \"password\": \"rotated\"}"}`))
+	}))
+	defer server.Close()
+
+	p := &SecretsManagerProvider{
+		Region:   "us-east-1",
+		SecretID: "dss/crdb",
+		Endpoint: server.URL,
+		Credentials: func() (AWSCredentials, error) {
+			return AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		},
+	}
+	secret, err := p.Secret(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, Credentials{Username: "dss", Password: "rotated"}, secret.Credentials)
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// The example of the AWS Signature Version 4 documentation.
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	signAWSRequest(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	require.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	require.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
@@ -0,0 +1,104 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// txBeginner begins transactions: a *sql.DB, or one of its connections.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// deadlineStatementTimeout returns the statement timeout bounding the
+// statements run on behalf of ctx by the time left until its deadline, so
+// that CockroachDB aborts them once their client has given up on them.
+// It returns false if ctx has no deadline, or if the statement timeout of the
+// pool of db expires first anyway.
+func (db *DB) deadlineStatementTimeout(ctx context.Context) (time.Duration, bool) {
+	if !db.pool.DeadlineStatementTimeouts {
+		return 0, false
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	timeout := time.Until(deadline)
+	if db.pool.StatementTimeout > 0 && timeout >= db.pool.StatementTimeout {
+		return 0, false
+	}
+	// A statement_timeout of 0 disables it; a passed deadline fails the
+	// statements anyway.
+	if timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	return timeout, true
+}
+
+// withDeadline runs fn with db, or with a connection of db whose statements
+// are bounded by the deadline of ctx as with deadlineStatementTimeout. The
+// statement timeout of the connection is reset before it returns to the
+// pool.
+func (db *DB) withDeadline(ctx context.Context, fn func(txBeginner) error) error {
+	timeout, ok := db.deadlineStatementTimeout(ctx)
+	if !ok {
+		return fn(db.DB)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error acquiring connection")
+	}
+	defer conn.Close()
+	// SET LOCAL is not supported by CockroachDB 20.2, so the timeout is set
+	// for the session of the connection held for the transaction.
+	query := fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds())
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "RESET statement_timeout"); err != nil {
+			logging.Logger.Warn("Error resetting statement timeout; discarding connection", zap.Error(err))
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+	return fn(conn)
+}
+
+// ExecuteSavepointTx runs fn in a transaction like crdb.ExecuteTx, retrying
+// it within the transaction through the cockroach_restart savepoint, its
+// statements bounded by the deadline of ctx like those of ExecuteTx.
+func (db *DB) ExecuteSavepointTx(ctx context.Context, opts *sql.TxOptions, fn func(*sql.Tx) error) error {
+	return db.withDeadline(ctx, func(b txBeginner) error {
+		tx, err := b.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return crdb.ExecuteInTx(ctx, savepointTx{tx}, func() error { return fn(tx) })
+	})
+}
+
+// savepointTx adapts a *sql.Tx to crdb.Tx.
+type savepointTx struct {
+	tx *sql.Tx
+}
+
+func (tx savepointTx) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := tx.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (tx savepointTx) Commit(context.Context) error {
+	return tx.tx.Commit()
+}
+
+func (tx savepointTx) Rollback(context.Context) error {
+	return tx.tx.Rollback()
+}
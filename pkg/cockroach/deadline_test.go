@@ -0,0 +1,39 @@
+package cockroach
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlineStatementTimeout(t *testing.T) {
+	db := &DB{pool: PoolParameters{DeadlineStatementTimeouts: true, StatementTimeout: time.Minute}}
+
+	_, ok := db.deadlineStatementTimeout(context.Background())
+	require.False(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	timeout, ok := db.deadlineStatementTimeout(ctx)
+	require.True(t, ok)
+	require.True(t, timeout > 9*time.Second && timeout <= 10*time.Second, timeout)
+
+	// The statement timeout of the pool expires first.
+	long, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_, ok = db.deadlineStatementTimeout(long)
+	require.False(t, ok)
+
+	// A passed deadline must not disable the timeout.
+	passed, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	timeout, ok = db.deadlineStatementTimeout(passed)
+	require.True(t, ok)
+	require.Equal(t, time.Millisecond, timeout)
+
+	db.pool.DeadlineStatementTimeouts = false
+	_, ok = db.deadlineStatementTimeout(ctx)
+	require.False(t, ok)
+}
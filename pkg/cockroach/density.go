@@ -0,0 +1,126 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/stacktrace"
+)
+
+// DensityLevel is the level of the S2 cells by which Densities are counted.
+const DensityLevel = 4
+
+// DensityTable identifies a table of entities of Kind with id, owner,
+// cells, starts_at and ends_at columns.
+type DensityTable struct {
+	Name string
+	Kind string
+}
+
+// Density is the number of entities of Kind active at a point in time,
+// either in the S2 cell at DensityLevel whose token is Region or managed by
+// Manager.
+type Density struct {
+	Kind    string `json:"kind"`
+	Region  string `json:"region,omitempty"`
+	Manager string `json:"manager,omitempty"`
+	Count   int64  `json:"count"`
+}
+
+// densityParentMask returns the mask and bit whose bitwise AND and OR with a
+// cell ID yield the ID of its parent at DensityLevel.
+func densityParentMask() (int64, int64) {
+	id := int64(s2.CellIDFromFace(0).ChildBeginAtLevel(DensityLevel))
+	lsb := id & -id
+	return -lsb, lsb
+}
+
+// EntityDensity returns the Densities of the entities of tables active at
+// now, by region and by manager. Entities spanning several regions are
+// counted in each of them. The tables are scanned with follower reads, so
+// the counts may be slightly stale.
+func (db *DB) EntityDensity(ctx context.Context, tables []DensityTable, now time.Time) ([]Density, error) {
+	tx, err := db.BeginFollowerRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing is ever written in tx, so there is nothing to commit.
+	defer func() { _ = tx.Rollback() }()
+
+	const active = `
+			(ends_at IS NULL OR ends_at >= $1)
+		AND
+			(starts_at IS NULL OR starts_at <= $1)`
+	mask, lsb := densityParentMask()
+
+	var result []Density
+	for _, table := range tables {
+		managersQuery := fmt.Sprintf(`
+			SELECT
+				owner,
+				count(*)
+			FROM
+				%s
+			WHERE
+				%s
+			GROUP BY
+				owner`, table.Name, active)
+		rows, err := tx.QueryContext(ctx, managersQuery, now)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error in query: %s", managersQuery)
+		}
+		for rows.Next() {
+			d := Density{Kind: table.Kind}
+			if err := rows.Scan(&d.Manager, &d.Count); err != nil {
+				rows.Close()
+				return nil, stacktrace.Propagate(err, "Error scanning density of table %s", table.Name)
+			}
+			result = append(result, d)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading density of table %s", table.Name)
+		}
+
+		regionsQuery := fmt.Sprintf(`
+			SELECT
+				(cell & $2) | $3 AS parent,
+				count(DISTINCT id)
+			FROM (
+				SELECT
+					id,
+					unnest(cells) AS cell
+				FROM
+					%s
+				WHERE
+					%s
+			)
+			GROUP BY
+				parent`, table.Name, active)
+		rows, err = tx.QueryContext(ctx, regionsQuery, now, mask, lsb)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error in query: %s", regionsQuery)
+		}
+		for rows.Next() {
+			var (
+				d      = Density{Kind: table.Kind}
+				parent int64
+			)
+			if err := rows.Scan(&parent, &d.Count); err != nil {
+				rows.Close()
+				return nil, stacktrace.Propagate(err, "Error scanning density of table %s", table.Name)
+			}
+			d.Region = s2.CellID(parent).ToToken()
+			result = append(result, d)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading density of table %s", table.Name)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,22 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDensityParentMask(t *testing.T) {
+	mask, lsb := densityParentMask()
+	for _, ll := range []s2.LatLng{
+		s2.LatLngFromDegrees(46.2, 6.1),
+		s2.LatLngFromDegrees(-33.9, 151.2),
+		s2.LatLngFromDegrees(37.4, -122.1),
+	} {
+		cell := s2.CellIDFromLatLng(ll).Parent(13)
+		// Cells are stored as signed integers.
+		parent := s2.CellID((int64(cell) & mask) | lsb)
+		require.Equal(t, cell.Parent(DensityLevel), parent)
+	}
+}
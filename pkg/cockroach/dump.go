@@ -0,0 +1,234 @@
+package cockroach
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// importBatchSize is the number of rows inserted per transaction by Import,
+// keeping transactions well below the size limits of CockroachDB.
+const importBatchSize = 500
+
+// DumpHeader is the first line of a dump, identifying the schema the rows
+// of the dump conform to.
+type DumpHeader struct {
+	Database string `json:"database"`
+	Version  string `json:"version"`
+}
+
+// DumpRow is a line of a dump following its DumpHeader, holding the row of
+// a table. Values are the canonical CockroachDB text representations of the
+// columns, nil for NULL, so that they are restored exactly, including the
+// updated_at timestamps from which versions and OVNs derive.
+type DumpRow struct {
+	Table string             `json:"table"`
+	Row   map[string]*string `json:"row"`
+}
+
+// dumpColumns returns the names of the columns of table in dbName that can
+// be written, excluding hidden and computed columns.
+func (db *DB) dumpColumns(ctx context.Context, dbName string, table string) ([]string, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			column_name
+		FROM
+			%s.information_schema.columns
+		WHERE
+			table_schema = 'public'
+		AND
+			table_name = '%s'
+		AND
+			is_hidden = 'NO'
+		AND
+			COALESCE(generation_expression, '') = ''
+		ORDER BY
+			ordinal_position`, dbName, table)
+	var columns []string
+	if err := db.scanRows(ctx, query, func(scan func(...interface{}) error) error {
+		var c string
+		if err := scan(&c); err != nil {
+			return err
+		}
+		columns = append(columns, c)
+		return nil
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Error listing columns of %s", table)
+	}
+	if len(columns) == 0 {
+		return nil, stacktrace.NewError("Table %s does not exist in database %s", table, dbName)
+	}
+	return columns, nil
+}
+
+// Export writes the rows of tables in dbName to w as JSON lines: a
+// DumpHeader followed by a DumpRow per row, table by table in the given
+// order and ordered by id within each table. It returns the number of rows
+// written.
+func (db *DB) Export(ctx context.Context, dbName string, tables []string, w io.Writer) (int, error) {
+	version, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "Error getting version of database %s", dbName)
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(&DumpHeader{Database: dbName, Version: version.String()}); err != nil {
+		return 0, stacktrace.Propagate(err, "Error writing dump header")
+	}
+
+	count := 0
+	for _, table := range tables {
+		columns, err := db.dumpColumns(ctx, dbName, table)
+		if err != nil {
+			return count, err
+		}
+		selections := make([]string, len(columns))
+		for i, c := range columns {
+			selections[i] = c + "::STRING"
+		}
+		query := fmt.Sprintf(`
+			SELECT
+				%s
+			FROM
+				%s.%s
+			ORDER BY
+				id`, strings.Join(selections, ", "), dbName, table)
+		if err := db.scanRows(ctx, query, func(scan func(...interface{}) error) error {
+			values := make([]*string, len(columns))
+			targets := make([]interface{}, len(columns))
+			for i := range values {
+				targets[i] = &values[i]
+			}
+			if err := scan(targets...); err != nil {
+				return err
+			}
+			row := &DumpRow{Table: table, Row: make(map[string]*string, len(columns))}
+			for i, c := range columns {
+				row.Row[c] = values[i]
+			}
+			count++
+			return encoder.Encode(row)
+		}); err != nil {
+			return count, stacktrace.Propagate(err, "Error exporting %s", table)
+		}
+	}
+	return count, nil
+}
+
+// Import inserts the rows of the dump read from r, as written by Export,
+// into dbName. The dump must have been taken from a database at the same
+// schema version and only rows of tables are accepted. Rows are inserted
+// rather than upserted, so Import is meant to restore into empty tables. It
+// returns the number of rows inserted.
+func (db *DB) Import(ctx context.Context, dbName string, tables []string, r io.Reader) (int, error) {
+	version, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return 0, stacktrace.Propagate(err, "Error getting version of database %s", dbName)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	header := &DumpHeader{}
+	if err := decoder.Decode(header); err != nil {
+		return 0, stacktrace.Propagate(err, "Error reading dump header")
+	}
+	if header.Version != version.String() {
+		return 0, stacktrace.NewError("Dump of schema version %s cannot be imported into database %s at schema version %s", header.Version, dbName, version)
+	}
+
+	columns := map[string]map[string]bool{}
+	for _, table := range tables {
+		names, err := db.dumpColumns(ctx, dbName, table)
+		if err != nil {
+			return 0, err
+		}
+		columns[table] = map[string]bool{}
+		for _, c := range names {
+			columns[table][c] = true
+		}
+	}
+
+	var (
+		count int
+		batch []*DumpRow
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error beginning transaction")
+		}
+		for _, row := range batch {
+			query, args, err := insertStatement(dbName, row, columns[row.Table])
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				_ = tx.Rollback()
+				return stacktrace.Propagate(err, "Error in query: %s", query)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return stacktrace.Propagate(err, "Error committing transaction")
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		row := &DumpRow{}
+		if err := decoder.Decode(row); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, stacktrace.Propagate(err, "Error reading row %d of dump", count+len(batch)+1)
+		}
+		if columns[row.Table] == nil {
+			return count, stacktrace.NewError("Dump contains rows of unexpected table %s", row.Table)
+		}
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// insertStatement returns the statement inserting row into dbName along with
+// its arguments. The columns of row must all be among columns.
+func insertStatement(dbName string, row *DumpRow, columns map[string]bool) (string, []interface{}, error) {
+	names := make([]string, 0, len(row.Row))
+	for c := range row.Row {
+		if !columns[c] {
+			return "", nil, stacktrace.NewError("Dump contains unexpected column %s of table %s", c, row.Table)
+		}
+		names = append(names, c)
+	}
+	if len(names) == 0 {
+		return "", nil, stacktrace.NewError("Dump contains an empty row of table %s", row.Table)
+	}
+	sort.Strings(names)
+
+	var (
+		placeholders = make([]string, len(names))
+		args         = make([]interface{}, len(names))
+	)
+	for i, c := range names {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = row.Row[c]
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO
+			%s.%s
+			(%s)
+		VALUES
+			(%s)`, dbName, row.Table, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	return query, args, nil
+}
@@ -0,0 +1,34 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertStatement(t *testing.T) {
+	var (
+		id      = "0f8e9b2c-5c1b-4d6c-9a57-3f0e5d2b9c11"
+		cells   = "{17106221850767130624}"
+		columns = map[string]bool{"id": true, "cells": true, "ends_at": true}
+	)
+
+	query, args, err := insertStatement("defaultdb", &DumpRow{
+		Table: "subscriptions",
+		Row:   map[string]*string{"id": &id, "ends_at": nil, "cells": &cells},
+	}, columns)
+	require.NoError(t, err)
+	require.Contains(t, query, "defaultdb.subscriptions")
+	require.Contains(t, query, "(cells, ends_at, id)")
+	require.Contains(t, query, "($1, $2, $3)")
+	require.Equal(t, []interface{}{&cells, (*string)(nil), &id}, args)
+
+	_, _, err = insertStatement("defaultdb", &DumpRow{
+		Table: "subscriptions",
+		Row:   map[string]*string{"id": &id, "owner); DROP TABLE subscriptions; --": &id},
+	}, columns)
+	require.Error(t, err)
+
+	_, _, err = insertStatement("defaultdb", &DumpRow{Table: "subscriptions"}, columns)
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// failoverConnector is a driver.Connector establishing new connections with
+// the first of its connectors whose credentials are accepted.
+type failoverConnector struct {
+	connectors []driver.Connector
+}
+
+// isAuthenticationError returns true if err indicates that the credentials
+// presented to the database were rejected.
+func isAuthenticationError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// 28000: invalid_authorization_specification, 28P01: invalid_password.
+	return pqErr.Code == "28000" || pqErr.Code == "28P01"
+}
+
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var err error
+	for i, connector := range c.connectors {
+		var conn driver.Conn
+		conn, err = connector.Connect(ctx)
+		if err == nil {
+			if i > 0 {
+				logging.Logger.Warn("Connected to cockroach with fallback credentials", zap.Int("credentials_index", i))
+			}
+			return conn, nil
+		}
+		if !isAuthenticationError(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *failoverConnector) Driver() driver.Driver {
+	return c.connectors[0].Driver()
+}
+
+// DialWithFailover returns a DB instance connected to a cockroach instance
+// using the first of "uris" whose credentials are accepted. Every new
+// connection tries the URIs in order, so credentials of the first URI may be
+// rotated while connections fall back to the following ones.
+func DialWithFailover(uris []string, pool PoolParameters) (*DB, error) {
+	if len(uris) == 0 {
+		return nil, stacktrace.NewError("No crdb URI provided")
+	}
+	connectors := make([]driver.Connector, len(uris))
+	for i, uri := range uris {
+		uri, err := withStatementTimeout(uri, pool.StatementTimeout)
+		if err != nil {
+			return nil, err
+		}
+		connector, err := pq.NewConnector(uri)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error creating connector for crdb URI #%d", i)
+		}
+		connectors[i] = connector
+	}
+
+	db := sql.OpenDB(&failoverConnector{connectors: connectors})
+	configurePool(db, pool)
+
+	return &DB{
+		DB:   db,
+		pool: pool,
+	}, nil
+}
@@ -0,0 +1,91 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConnector counts its connections, failing them with err if set.
+type fakeConnector struct {
+	err   error
+	calls int
+}
+
+type fakeConn struct {
+	driver.Conn
+	connector *fakeConnector
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+func TestIsAuthenticationError(t *testing.T) {
+	require.True(t, isAuthenticationError(&pq.Error{Code: "28P01"}))
+	require.True(t, isAuthenticationError(&pq.Error{Code: "28000"}))
+	require.False(t, isAuthenticationError(&pq.Error{Code: "57P01"}))
+	require.False(t, isAuthenticationError(errors.New("connection refused")))
+}
+
+func TestFailoverConnector(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		primary   = &fakeConnector{}
+		secondary = &fakeConnector{}
+		c         = &failoverConnector{connectors: []driver.Connector{primary, secondary}}
+	)
+
+	conn, err := c.Connect(ctx)
+	require.NoError(t, err)
+	require.Equal(t, primary, conn.(fakeConn).connector)
+	require.Equal(t, 0, secondary.calls)
+
+	// Rejected credentials fall back to the following connector.
+	primary.err = &pq.Error{Code: "28P01"}
+	conn, err = c.Connect(ctx)
+	require.NoError(t, err)
+	require.Equal(t, secondary, conn.(fakeConn).connector)
+
+	// Other errors are not retried with other credentials.
+	primary.err = errors.New("connection refused")
+	_, err = c.Connect(ctx)
+	require.Equal(t, primary.err, err)
+	require.Equal(t, 1, secondary.calls)
+
+	// The error of the last connector is returned once all are rejected.
+	primary.err = &pq.Error{Code: "28P01"}
+	secondary.err = &pq.Error{Code: "28000"}
+	_, err = c.Connect(ctx)
+	require.Equal(t, secondary.err, err)
+
+	// Connections return to the first connector once it accepts them.
+	primary.err = nil
+	conn, err = c.Connect(ctx)
+	require.NoError(t, err)
+	require.Equal(t, primary, conn.(fakeConn).connector)
+}
+
+func TestDialWithFailover(t *testing.T) {
+	_, err := DialWithFailover(nil, PoolParameters{})
+	require.Error(t, err)
+
+	db, err := DialWithFailover([]string{
+		"postgresql://primary@localhost:26257?sslmode=disable",
+		"postgresql://secondary@localhost:26257?sslmode=disable",
+	}, PoolParameters{})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
@@ -2,12 +2,30 @@ package flags
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
 )
 
 var (
 	connectParameters cockroach.ConnectParameters
+	retryPolicy       = cockroach.DefaultRetryPolicy
+	poolParameters    cockroach.PoolParameters
+	locality          string
+	followerStaleness time.Duration
+
+	credentialsSource  string
+	credentialsRefresh time.Duration
+	vaultAddress       string
+	vaultPath          string
+	vaultTokenFile     string
+	awsRegion          string
+	awsSecretID        string
+	awsEndpoint        string
 )
 
 // ConnectParameters returns a ConnectParameters instance that gets populated from well-known CLI flags.
@@ -15,12 +33,114 @@ func ConnectParameters() cockroach.ConnectParameters {
 	return connectParameters
 }
 
+// PoolParameters returns a PoolParameters instance that gets populated from well-known CLI flags.
+func PoolParameters() cockroach.PoolParameters {
+	return poolParameters
+}
+
+// RetryPolicy returns a RetryPolicy instance that gets populated from well-known CLI flags.
+func RetryPolicy() cockroach.RetryPolicy {
+	return retryPolicy
+}
+
+// Locality returns the locality of the cockroach node the DSS connects to,
+// in the format of the --locality flag of cockroach, if set through CLI
+// flags; it is queried from the node otherwise.
+func Locality() string {
+	return locality
+}
+
+// FollowerReadStaleness returns the staleness of follower reads set through
+// CLI flags.
+func FollowerReadStaleness() time.Duration {
+	return followerStaleness
+}
+
+// CredentialsProvider returns the provider of the credentials and TLS
+// material of the cockroach user selected through CLI flags, or nil if they
+// are set through the flags themselves.
+func CredentialsProvider() (cockroach.CredentialsProvider, error) {
+	switch credentialsSource {
+	case "", "flags":
+		return nil, nil
+	case "vault":
+		if vaultAddress == "" || vaultPath == "" {
+			return nil, stacktrace.NewError("--cockroach_vault_address and --cockroach_vault_path are required with --cockroach_credentials_source=vault")
+		}
+		return &cockroach.VaultProvider{
+			Address: vaultAddress,
+			Path:    vaultPath,
+			Token: func() (string, error) {
+				if vaultTokenFile == "" {
+					return os.Getenv("VAULT_TOKEN"), nil
+				}
+				token, err := ioutil.ReadFile(vaultTokenFile)
+				return strings.TrimSpace(string(token)), err
+			},
+		}, nil
+	case "aws_secrets_manager":
+		if awsRegion == "" || awsSecretID == "" {
+			return nil, stacktrace.NewError("--cockroach_aws_region and --cockroach_aws_secret_id are required with --cockroach_credentials_source=aws_secrets_manager")
+		}
+		return &cockroach.SecretsManagerProvider{
+			Region:   awsRegion,
+			SecretID: awsSecretID,
+			Endpoint: awsEndpoint,
+			Credentials: func() (cockroach.AWSCredentials, error) {
+				creds := cockroach.AWSCredentials{
+					AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+					SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+					SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+				}
+				if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+					return creds, stacktrace.NewError("Missing AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY")
+				}
+				return creds, nil
+			},
+		}, nil
+	default:
+		return nil, stacktrace.NewError("Invalid --cockroach_credentials_source %s", credentialsSource)
+	}
+}
+
+// CredentialsRefresh returns how often the secret of CredentialsProvider is
+// fetched again, set through CLI flags.
+func CredentialsRefresh() time.Duration {
+	return credentialsRefresh
+}
+
 func init() {
 	flag.StringVar(&connectParameters.ApplicationName, "cockroach_application_name", "dss", "application name for tagging the connection to cockroach")
 	flag.StringVar(&connectParameters.DBName, "cockroach_db_name", "dss", "application name for tagging the connection to cockroach")
+	flag.StringVar(&connectParameters.DBNamePrefix, "cockroach_db_name_prefix", "", "prefix prepended to the names of all DSS databases, allowing multiple DSS deployments to share a cockroach cluster")
 	flag.StringVar(&connectParameters.Host, "cockroach_host", "", "cockroach host to connect to")
 	flag.IntVar(&connectParameters.Port, "cockroach_port", 26257, "cockroach port to connect to")
 	flag.StringVar(&connectParameters.SSL.Mode, "cockroach_ssl_mode", "disable", "cockroach sslmode")
 	flag.StringVar(&connectParameters.SSL.Dir, "cockroach_ssl_dir", "", "directory to ssl certificates. Must contain files: ca.crt, client.<user>.crt, client.<user>.key")
 	flag.StringVar(&connectParameters.Credentials.Username, "cockroach_user", "root", "cockroach user to authenticate as")
+	flag.StringVar(&connectParameters.Credentials.Password, "cockroach_password", "", "password of cockroach_user, if authenticating with a password")
+	flag.StringVar(&connectParameters.SecondaryCredentials.Username, "cockroach_secondary_user", "", "cockroach user to authenticate as whenever cockroach_user is rejected, e.g. while rotating credentials")
+	flag.StringVar(&connectParameters.SecondaryCredentials.Password, "cockroach_secondary_password", "", "password of cockroach_secondary_user, if authenticating with a password")
+
+	flag.StringVar(&credentialsSource, "cockroach_credentials_source", "flags", "where the credentials and TLS material of the cockroach user come from: flags, the flags above and the files of cockroach_ssl_dir, vault, a secret of HashiCorp Vault, or aws_secrets_manager, a secret of AWS Secrets Manager; secrets hold the fields username, password and optionally ca_cert, client_cert and client_key")
+	flag.DurationVar(&credentialsRefresh, "cockroach_credentials_refresh", 5*time.Minute, "how often the secret of cockroach_credentials_source is fetched again for new connections, which also fetch it whenever it is rejected")
+	flag.StringVar(&vaultAddress, "cockroach_vault_address", "", "base URL of the Vault server holding the cockroach secret, e.g. https://vault.example.com:8200")
+	flag.StringVar(&vaultPath, "cockroach_vault_path", "", "path of the cockroach secret in Vault, e.g. secret/data/dss/crdb for a KV secret or database/creds/dss for the database secrets engine")
+	flag.StringVar(&vaultTokenFile, "cockroach_vault_token_file", "", "file holding the Vault token, read again on every fetch; the VAULT_TOKEN environment variable if empty")
+	flag.StringVar(&awsRegion, "cockroach_aws_region", "", "AWS region of the Secrets Manager secret holding the cockroach secret, read with the credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables")
+	flag.StringVar(&awsSecretID, "cockroach_aws_secret_id", "", "name or ARN of the Secrets Manager secret holding the cockroach secret as a JSON object")
+	flag.StringVar(&awsEndpoint, "cockroach_aws_endpoint", "", "Secrets Manager endpoint overriding the regional one, e.g. a VPC endpoint")
+
+	flag.IntVar(&retryPolicy.MaxAttempts, "cockroach_txn_max_attempts", retryPolicy.MaxAttempts, "maximum number of attempts for transactions aborted due to contention")
+	flag.DurationVar(&retryPolicy.InitialBackoff, "cockroach_txn_initial_backoff", retryPolicy.InitialBackoff, "delay before retrying a transaction aborted due to contention for the first time")
+	flag.DurationVar(&retryPolicy.MaxBackoff, "cockroach_txn_max_backoff", retryPolicy.MaxBackoff, "maximum delay between retries of a transaction aborted due to contention")
+
+	flag.IntVar(&poolParameters.MaxOpenConns, "cockroach_max_open_conns", 0, "maximum number of open connections to cockroach per database; unlimited if 0")
+	flag.IntVar(&poolParameters.MaxIdleConns, "cockroach_max_idle_conns", 0, "maximum number of idle connections to cockroach kept per database; database/sql default if 0")
+	flag.DurationVar(&poolParameters.ConnMaxLifetime, "cockroach_conn_max_lifetime", 0, "maximum amount of time a connection to cockroach is reused; unlimited if 0")
+	flag.DurationVar(&poolParameters.StatementTimeout, "cockroach_statement_timeout", 0, "cockroach statement_timeout applied to all connections; disabled if 0")
+	flag.BoolVar(&poolParameters.DeadlineStatementTimeouts, "cockroach_deadline_statement_timeouts", true, "bound the statement_timeout of transactions by the time left until the deadline of their request, so that cockroach aborts the statements abandoned by clients")
+
+	flag.StringVar(&locality, "cockroach_locality", "", "locality of the cockroach node connected to, e.g. region=us-east1,zone=us-east1-b, tagging logs, traces and summaries with its region; queried from the node if empty")
+	flag.DurationVar(&followerStaleness, "cockroach_follower_read_staleness", 0, "staleness of the follower reads of background scans, which must exceed the closed timestamp target of the cluster for them to be served locally; follower_read_timestamp() if 0 and the node connected to is in a region, strongly consistent reads otherwise")
 }
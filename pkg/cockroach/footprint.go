@@ -0,0 +1,127 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/interuss/stacktrace"
+)
+
+// FootprintTable identifies a table whose rows are attributed to the manager
+// in column OwnerColumn, indexed by OwnerIndex.
+type FootprintTable struct {
+	Name        string
+	OwnerColumn string
+	OwnerIndex  string
+}
+
+// Footprint is the approximate storage consumed by the rows of Owner in
+// Table.
+type Footprint struct {
+	Table string `json:"table"`
+	Owner string `json:"owner"`
+	Rows  int64  `json:"rows"`
+	// Bytes is the share of the logical size of the ranges of Table
+	// proportional to Rows, ignoring replication.
+	Bytes int64 `json:"bytes"`
+}
+
+// StorageFootprint returns the approximate storage consumed by each owner
+// of rows in tables of database dbName. The size of each table is read from
+// the statistics of its ranges, and apportioned between owners by their
+// number of rows, counted through the owner index rather than by decoding
+// every row. Counting still reads the whole index, so the results should be
+// cached.
+func (db *DB) StorageFootprint(ctx context.Context, dbName string, tables []FootprintTable) ([]Footprint, error) {
+	sizes, err := db.tableSizes(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	var result []Footprint
+	for _, table := range tables {
+		query := fmt.Sprintf(`
+			SELECT
+				%[2]s,
+				count(*)
+			FROM
+				%[1]s@%[3]s
+			GROUP BY
+				%[2]s`, table.Name, table.OwnerColumn, table.OwnerIndex)
+
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+		var footprints []Footprint
+		for rows.Next() {
+			f := Footprint{Table: table.Name}
+			if err := rows.Scan(&f.Owner, &f.Rows); err != nil {
+				rows.Close()
+				return nil, stacktrace.Propagate(err, "Error scanning footprint of table %s", table.Name)
+			}
+			footprints = append(footprints, f)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading footprint of table %s", table.Name)
+		}
+		result = append(result, apportion(footprints, sizes[table.Name])...)
+	}
+	return result, nil
+}
+
+// tableSizes returns the logical size in bytes of the ranges of the tables
+// of database dbName, by table name.
+func (db *DB) tableSizes(ctx context.Context, dbName string) (map[string]int64, error) {
+	const query = `
+		SELECT
+			table_name,
+			COALESCE(sum(range_size), 0)
+		FROM
+			crdb_internal.ranges
+		WHERE
+			database_name = $1
+		AND
+			table_name != ''
+		GROUP BY
+			table_name`
+
+	rows, err := db.QueryContext(ctx, query, db.NamePrefix+dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	sizes := map[string]int64{}
+	for rows.Next() {
+		var (
+			table string
+			size  int64
+		)
+		if err := rows.Scan(&table, &size); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning table size row")
+		}
+		sizes[table] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading table size rows")
+	}
+	return sizes, nil
+}
+
+// apportion sets the Bytes of footprints, the rows of a table by owner, to
+// their share of size, the size of the table.
+func apportion(footprints []Footprint, size int64) []Footprint {
+	var total int64
+	for _, f := range footprints {
+		total += f.Rows
+	}
+	if total == 0 {
+		return footprints
+	}
+	for i := range footprints {
+		footprints[i].Bytes = int64(float64(size) * float64(footprints[i].Rows) / float64(total))
+	}
+	return footprints
+}
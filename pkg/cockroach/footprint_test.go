@@ -0,0 +1,22 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApportion(t *testing.T) {
+	require.Equal(t, []Footprint{
+		{Table: "scd_operations", Owner: "uss1", Rows: 3, Bytes: 750},
+		{Table: "scd_operations", Owner: "uss2", Rows: 1, Bytes: 250},
+	}, apportion([]Footprint{
+		{Table: "scd_operations", Owner: "uss1", Rows: 3},
+		{Table: "scd_operations", Owner: "uss2", Rows: 1},
+	}, 1000))
+
+	// Tables missing from the range statistics are reported without size.
+	require.Equal(t, []Footprint{{Owner: "uss1", Rows: 3}}, apportion([]Footprint{{Owner: "uss1", Rows: 3}}, 0))
+
+	require.Empty(t, apportion(nil, 1000))
+}
@@ -0,0 +1,169 @@
+package cockroach
+
+import (
+	"context"
+	"time"
+
+	"github.com/interuss/stacktrace"
+)
+
+// ClusterHealth is the health of the cockroach cluster shared by the
+// instances of a pool, as seen from any of its nodes.
+type ClusterHealth struct {
+	// Healthy is true when all the nodes not being decommissioned are live
+	// and no range is under-replicated or unavailable.
+	Healthy   bool `json:"healthy"`
+	LiveNodes int  `json:"live_nodes"`
+	// UnderReplicatedRanges and UnavailableRanges are summed over all the
+	// stores, each range being counted by the store holding its lease.
+	UnderReplicatedRanges int64 `json:"under_replicated_ranges"`
+	UnavailableRanges     int64 `json:"unavailable_ranges"`
+	// MaxReplicationLagMs is the largest ReplicationLagMs of the stores.
+	MaxReplicationLagMs float64      `json:"max_replication_lag_ms"`
+	Nodes               []NodeHealth `json:"nodes"`
+}
+
+// NodeHealth is the liveness of a node of the cluster.
+type NodeHealth struct {
+	NodeID          int64         `json:"node_id"`
+	Address         string        `json:"address"`
+	Locality        string        `json:"locality"`
+	Region          string        `json:"region"`
+	ServerVersion   string        `json:"server_version"`
+	StartedAt       time.Time     `json:"started_at"`
+	Live            bool          `json:"live"`
+	Draining        bool          `json:"draining"`
+	Decommissioning bool          `json:"decommissioning"`
+	Ranges          int64         `json:"ranges"`
+	Leases          int64         `json:"leases"`
+	Stores          []StoreHealth `json:"stores"`
+}
+
+// StoreHealth is the replication status of the ranges of a store.
+type StoreHealth struct {
+	StoreID               int64 `json:"store_id"`
+	Ranges                int64 `json:"ranges"`
+	UnderReplicatedRanges int64 `json:"under_replicated_ranges"`
+	UnavailableRanges     int64 `json:"unavailable_ranges"`
+	// ReplicationLagMs is how far the closed timestamp of the replicas of
+	// the store lags behind, bounding the staleness of the follower reads
+	// they serve.
+	ReplicationLagMs float64 `json:"replication_lag_ms"`
+}
+
+// ClusterHealth returns the health of the cluster db is connected to, from
+// the internal tables of cockroach. Reading the status of the stores reaches
+// out to every node, so it should be called sparingly.
+func (db *DB) ClusterHealth(ctx context.Context) (*ClusterHealth, error) {
+	const nodesQuery = `
+		SELECT
+			n.node_id,
+			n.address,
+			n.locality,
+			n.server_version,
+			n.started_at,
+			n.is_live,
+			COALESCE(l.draining, false),
+			COALESCE(l.decommissioning, false),
+			n.ranges,
+			n.leases
+		FROM
+			crdb_internal.gossip_nodes AS n
+		LEFT JOIN
+			crdb_internal.gossip_liveness AS l ON l.node_id = n.node_id
+		ORDER BY
+			n.node_id`
+
+	rows, err := db.QueryContext(ctx, nodesQuery)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", nodesQuery)
+	}
+	defer rows.Close()
+
+	var nodes []NodeHealth
+	for rows.Next() {
+		var n NodeHealth
+		if err := rows.Scan(&n.NodeID, &n.Address, &n.Locality, &n.ServerVersion, &n.StartedAt,
+			&n.Live, &n.Draining, &n.Decommissioning, &n.Ranges, &n.Leases); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning node row")
+		}
+		l, err := ParseLocality(n.Locality)
+		if err != nil {
+			return nil, err
+		}
+		n.Region = l.Region()
+		nodes = append(nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading node rows")
+	}
+
+	const storesQuery = `
+		SELECT
+			node_id,
+			store_id,
+			range_count,
+			COALESCE((metrics->>'ranges.underreplicated')::FLOAT8, 0)::INT8,
+			COALESCE((metrics->>'ranges.unavailable')::FLOAT8, 0)::INT8,
+			COALESCE((metrics->>'kv.closed_timestamp.max_behind_nanos')::FLOAT8, 0) / 1e6
+		FROM
+			crdb_internal.kv_store_status
+		ORDER BY
+			node_id, store_id`
+
+	storeRows, err := db.QueryContext(ctx, storesQuery)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", storesQuery)
+	}
+	defer storeRows.Close()
+
+	stores := map[int64][]StoreHealth{}
+	for storeRows.Next() {
+		var (
+			nodeID int64
+			s      StoreHealth
+		)
+		if err := storeRows.Scan(&nodeID, &s.StoreID, &s.Ranges, &s.UnderReplicatedRanges,
+			&s.UnavailableRanges, &s.ReplicationLagMs); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning store row")
+		}
+		stores[nodeID] = append(stores[nodeID], s)
+	}
+	if err := storeRows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading store rows")
+	}
+
+	for i := range nodes {
+		nodes[i].Stores = stores[nodes[i].NodeID]
+	}
+	return newClusterHealth(nodes), nil
+}
+
+// newClusterHealth aggregates the health of nodes.
+func newClusterHealth(nodes []NodeHealth) *ClusterHealth {
+	h := &ClusterHealth{Healthy: true, Nodes: nodes}
+	if h.Nodes == nil {
+		h.Nodes = []NodeHealth{}
+	}
+	for i, n := range nodes {
+		if n.Stores == nil {
+			nodes[i].Stores = []StoreHealth{}
+		}
+		if n.Live {
+			h.LiveNodes++
+		} else if !n.Decommissioning {
+			h.Healthy = false
+		}
+		for _, s := range n.Stores {
+			h.UnderReplicatedRanges += s.UnderReplicatedRanges
+			h.UnavailableRanges += s.UnavailableRanges
+			if s.ReplicationLagMs > h.MaxReplicationLagMs {
+				h.MaxReplicationLagMs = s.ReplicationLagMs
+			}
+		}
+	}
+	if h.UnderReplicatedRanges > 0 || h.UnavailableRanges > 0 {
+		h.Healthy = false
+	}
+	return h
+}
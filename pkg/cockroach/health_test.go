@@ -0,0 +1,35 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClusterHealth(t *testing.T) {
+	h := newClusterHealth(nil)
+	require.True(t, h.Healthy)
+	require.NotNil(t, h.Nodes)
+
+	nodes := []NodeHealth{
+		{NodeID: 1, Live: true, Stores: []StoreHealth{{StoreID: 1, ReplicationLagMs: 3000}}},
+		{NodeID: 2, Live: true, Stores: []StoreHealth{{StoreID: 2, ReplicationLagMs: 4500}}},
+		// Decommissioned nodes are expected to be down.
+		{NodeID: 3, Decommissioning: true},
+	}
+	h = newClusterHealth(nodes)
+	require.True(t, h.Healthy)
+	require.Equal(t, 2, h.LiveNodes)
+	require.Equal(t, 4500.0, h.MaxReplicationLagMs)
+
+	nodes[1].Stores[0].UnderReplicatedRanges = 7
+	h = newClusterHealth(nodes)
+	require.False(t, h.Healthy)
+	require.Equal(t, int64(7), h.UnderReplicatedRanges)
+
+	nodes[1].Stores[0].UnderReplicatedRanges = 0
+	nodes[1].Live = false
+	h = newClusterHealth(nodes)
+	require.False(t, h.Healthy)
+	require.Equal(t, 1, h.LiveNodes)
+}
@@ -0,0 +1,182 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// LocalityTier is a tier of a cockroach locality, e.g. region=us-east1.
+type LocalityTier struct {
+	Key   string
+	Value string
+}
+
+// Locality is the locality of a cockroach node, e.g.
+// region=us-east1,zone=us-east1-b, from the broadest to the narrowest tier.
+type Locality []LocalityTier
+
+// ParseLocality parses the locality s in the format of the --locality flag
+// of cockroach.
+func ParseLocality(s string) (Locality, error) {
+	var l Locality
+	if s == "" {
+		return l, nil
+	}
+	for _, tier := range strings.Split(s, ",") {
+		kv := strings.SplitN(tier, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, stacktrace.NewError("Invalid locality tier %q in %q", tier, s)
+		}
+		l = append(l, LocalityTier{Key: kv[0], Value: kv[1]})
+	}
+	return l, nil
+}
+
+// Region returns the region tier of l, or the empty string if it has none.
+func (l Locality) Region() string {
+	for _, tier := range l {
+		if tier.Key == "region" {
+			return tier.Value
+		}
+	}
+	return ""
+}
+
+func (l Locality) String() string {
+	tiers := make([]string, len(l))
+	for i, tier := range l {
+		tiers[i] = tier.Key + "=" + tier.Value
+	}
+	return strings.Join(tiers, ",")
+}
+
+// QueryLocality returns the locality of the node db is connected to.
+// Connections may be balanced across nodes, whose localities are assumed to
+// be the same when they are reached through the same address.
+func (db *DB) QueryLocality(ctx context.Context) (Locality, error) {
+	const query = `SHOW LOCALITY`
+	var s string
+	if err := db.QueryRowContext(ctx, query).Scan(&s); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return ParseLocality(s)
+}
+
+// followerReadTimestamp returns the expression of the timestamp follower
+// reads are served as of, or the empty string if they are disabled. They are
+// enabled for nodes in a region, where reading from the closest replica
+// rather than from a leaseholder in another region saves a round trip.
+func (db *DB) followerReadTimestamp() string {
+	switch {
+	case db.FollowerReadStaleness > 0:
+		return fmt.Sprintf("'-%dms'", db.FollowerReadStaleness.Milliseconds())
+	case db.Locality.Region() != "":
+		return "follower_read_timestamp()"
+	}
+	return ""
+}
+
+// FollowerReads returns true if the transactions started by
+// BeginFollowerRead are served by follower reads.
+func (db *DB) FollowerReads() bool {
+	return db.followerReadTimestamp() != ""
+}
+
+// BeginFollowerRead starts a read-only transaction reading the state of the
+// database as of FollowerReadStaleness ago or, if zero and the node db is
+// connected to is in a region, as of the most recent timestamp follower
+// reads may be served as of. Reads are strongly consistent otherwise. It
+// suits scans tolerating slightly stale results. The returned transaction
+// should be rolled back once done.
+func (db *DB) BeginFollowerRead(ctx context.Context) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error beginning read-only transaction")
+	}
+	if ts := db.followerReadTimestamp(); ts != "" {
+		query := "SET TRANSACTION AS OF SYSTEM TIME " + ts
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			_ = tx.Rollback()
+			return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+	}
+	return tx, nil
+}
+
+// Leaseholders counts the ranges of a table by the region of their
+// leaseholder, through which all writes to the ranges go.
+type Leaseholders struct {
+	Table string `json:"table"`
+	// Region is the region holding the leases of most ranges of Table.
+	Region string           `json:"region"`
+	Ranges map[string]int64 `json:"ranges"`
+}
+
+// LeaseholderRegions returns the Leaseholders of the tables of database
+// dbName, by table name. Writes issued from other regions pay a round trip
+// to the region of the leaseholder.
+func (db *DB) LeaseholderRegions(ctx context.Context, dbName string) ([]Leaseholders, error) {
+	const query = `
+		SELECT
+			r.table_name,
+			n.locality,
+			count(*)
+		FROM
+			crdb_internal.ranges AS r
+		JOIN
+			crdb_internal.gossip_nodes AS n ON n.node_id = r.lease_holder
+		WHERE
+			r.database_name = $1
+		AND
+			r.table_name != ''
+		GROUP BY
+			r.table_name, n.locality`
+
+	rows, err := db.QueryContext(ctx, query, db.NamePrefix+dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	tables := map[string]*Leaseholders{}
+	for rows.Next() {
+		var (
+			table, locality string
+			n               int64
+		)
+		if err := rows.Scan(&table, &locality, &n); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning leaseholder row")
+		}
+		l, err := ParseLocality(locality)
+		if err != nil {
+			return nil, err
+		}
+		t, ok := tables[table]
+		if !ok {
+			t = &Leaseholders{Table: table, Ranges: map[string]int64{}}
+			tables[table] = t
+		}
+		t.Ranges[l.Region()] += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading leaseholder rows")
+	}
+
+	result := make([]Leaseholders, 0, len(tables))
+	for _, t := range tables {
+		var most int64
+		for region, n := range t.Ranges {
+			if n > most || (n == most && region < t.Region) {
+				t.Region, most = region, n
+			}
+		}
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Table < result[j].Table })
+	return result, nil
+}
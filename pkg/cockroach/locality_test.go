@@ -0,0 +1,37 @@
+package cockroach
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocality(t *testing.T) {
+	l, err := ParseLocality("region=us-east1,zone=us-east1-b")
+	require.NoError(t, err)
+	require.Equal(t, "us-east1", l.Region())
+	require.Equal(t, "region=us-east1,zone=us-east1-b", l.String())
+
+	l, err = ParseLocality("")
+	require.NoError(t, err)
+	require.Empty(t, l.Region())
+
+	_, err = ParseLocality("region")
+	require.Error(t, err)
+	_, err = ParseLocality("region=us-east1,=b")
+	require.Error(t, err)
+}
+
+func TestFollowerReadTimestamp(t *testing.T) {
+	db := &DB{}
+	require.Empty(t, db.followerReadTimestamp())
+	require.False(t, db.FollowerReads())
+
+	db.Locality = Locality{{Key: "region", Value: "us-east1"}}
+	require.Equal(t, "follower_read_timestamp()", db.followerReadTimestamp())
+	require.True(t, db.FollowerReads())
+
+	db.FollowerReadStaleness = 10 * time.Second
+	require.Equal(t, "'-10000ms'", db.followerReadTimestamp())
+}
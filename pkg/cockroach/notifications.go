@@ -0,0 +1,18 @@
+package cockroach
+
+import (
+	"fmt"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+)
+
+// IncrementNotificationIndex returns the expression incrementing the
+// notification_index column of a subscription table. Columns not yet widened
+// to INT8 wrap around to 0 past dssmodels.MaxNotificationIndex instead of
+// failing the notifying write with an out of range error.
+func IncrementNotificationIndex(widened bool) string {
+	if widened {
+		return "notification_index + 1"
+	}
+	return fmt.Sprintf("IF(notification_index >= %d, 0, notification_index + 1)", dssmodels.MaxNotificationIndex)
+}
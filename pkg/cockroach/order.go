@@ -0,0 +1,32 @@
+package cockroach
+
+import (
+	"fmt"
+	"time"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+)
+
+// OrderBy appends to query, whose arguments are args, the ORDER BY clause
+// implementing order for a table whose entities are active between the
+// timestamps in the startColumn and endColumn columns. query and args are
+// returned unchanged if order does not constrain the order of results.
+//
+// SearchOrderRelevance sorts by temporal distance to now: zero for active
+// entities, the time until start for upcoming entities and the time since
+// end for past entities. Ties are broken by idColumn for a stable order.
+func OrderBy(query string, args []interface{}, order dssmodels.SearchOrder, now time.Time, startColumn, endColumn, idColumn string) (string, []interface{}) {
+	switch order {
+	case dssmodels.SearchOrderRelevance:
+		args = append(args, now)
+		query += fmt.Sprintf(`
+			ORDER BY
+				GREATEST(
+					COALESCE(%[1]s - $%[4]d, INTERVAL '0'),
+					COALESCE($%[4]d - %[2]s, INTERVAL '0'),
+					INTERVAL '0'
+				) ASC,
+				%[3]s ASC`, startColumn, endColumn, idColumn, len(args))
+	}
+	return query, args
+}
@@ -0,0 +1,24 @@
+package cockroach
+
+import (
+	"testing"
+	"time"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderBy(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	args := []interface{}{"a", "b"}
+
+	query, got := OrderBy("SELECT 1", args, dssmodels.SearchOrderDefault, now, "starts_at", "ends_at", "id")
+	require.Equal(t, "SELECT 1", query)
+	require.Equal(t, args, got)
+
+	query, got = OrderBy("SELECT 1", args, dssmodels.SearchOrderRelevance, now, "starts_at", "ends_at", "id")
+	require.Contains(t, query, "starts_at - $3")
+	require.Contains(t, query, "$3 - ends_at")
+	require.NotContains(t, query, "now()")
+	require.Equal(t, []interface{}{"a", "b", now}, got)
+}
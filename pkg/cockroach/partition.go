@@ -0,0 +1,323 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// zoneConstraint matches a replica constraint of a zone configuration, e.g.
+// +region=europe-west1.
+var zoneConstraint = regexp.MustCompile(`^[+-][A-Za-z0-9_.-]+(=[A-Za-z0-9_.-]+)?$`)
+
+// PartitionOptions configure PartitionByJurisdiction.
+type PartitionOptions struct {
+	// Jurisdictions are those the tables are partitioned by. If empty, the
+	// tables are unpartitioned.
+	Jurisdictions geo.Jurisdictions
+	// Constraints are the replica constraints of the partition of each
+	// jurisdiction, e.g. +region=europe-west1, which all its replicas, and
+	// thus its leaseholder, are pinned to. Partitions without constraints follow the
+	// zone configuration of their table.
+	Constraints map[string][]string
+	// BatchSize is the number of rows relabelled at once; importBatchSize
+	// if zero.
+	BatchSize int
+	// Progress, if not nil, is called after each batch with the progress of
+	// the table of the batch.
+	Progress func(PartitionProgress)
+}
+
+// PartitionProgress counts the rows of a table scanned and relabelled with
+// their jurisdiction by PartitionByJurisdiction.
+type PartitionProgress struct {
+	Table      string `json:"table"`
+	Scanned    int    `json:"scanned"`
+	Relabelled int    `json:"relabelled"`
+}
+
+// ParseZoneConstraints parses the semicolon-separated replica constraints of
+// s by jurisdiction, each a jurisdiction name followed by a colon and its
+// comma-separated constraints, e.g. "eu:+region=europe-west1".
+func ParseZoneConstraints(s string) (map[string][]string, error) {
+	result := map[string][]string{}
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 {
+			return nil, stacktrace.NewError("Missing constraints of jurisdiction %s", spec)
+		}
+		name := strings.TrimSpace(parts[0])
+		for _, c := range strings.Split(parts[1], ",") {
+			c = strings.TrimSpace(c)
+			if !zoneConstraint.MatchString(c) {
+				return nil, stacktrace.NewError("Invalid constraint %q of jurisdiction %s", c, name)
+			}
+			result[name] = append(result[name], c)
+		}
+	}
+	return result, nil
+}
+
+// PartitionByJurisdiction partitions the primary indexes of tables in
+// dbName, which must have a jurisdiction column, by jurisdiction, pinning
+// the replicas of each partition as configured by opts. The jurisdiction of
+// every row is first recomputed from its cells, in batches ordered by id,
+// so that the rows written before the DSS instances were configured with
+// opts.Jurisdictions, or with other jurisdictions, land in the right
+// partition. The primary key of each table becomes (jurisdiction, id),
+// keeping id unique through a secondary index. Partitioning requires an
+// enterprise license of CockroachDB, and tables whose primary key is
+// hash-sharded cannot be partitioned. It returns the progress of each
+// table.
+func (db *DB) PartitionByJurisdiction(ctx context.Context, dbName string, tables []string, opts PartitionOptions) ([]PartitionProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = importBatchSize
+	}
+	for name := range opts.Constraints {
+		known := false
+		for _, j := range opts.Jurisdictions {
+			known = known || j.Name == name
+		}
+		if !known {
+			return nil, stacktrace.NewError("Constraints of unknown jurisdiction %s", name)
+		}
+	}
+
+	var results []PartitionProgress
+	for _, table := range tables {
+		progress, err := db.partitionTable(ctx, dbName, table, opts)
+		results = append(results, progress)
+		if err != nil {
+			return results, stacktrace.Propagate(err, "Error partitioning %s", table)
+		}
+	}
+	return results, nil
+}
+
+// partitionTable partitions table in dbName as described by
+// PartitionByJurisdiction.
+func (db *DB) partitionTable(ctx context.Context, dbName string, table string, opts PartitionOptions) (PartitionProgress, error) {
+	progress := PartitionProgress{Table: table}
+	columns, err := db.dumpColumns(ctx, dbName, table)
+	if err != nil {
+		return progress, err
+	}
+	hasJurisdiction := false
+	for _, c := range columns {
+		hasJurisdiction = hasJurisdiction || c == "jurisdiction"
+	}
+	if !hasJurisdiction {
+		return progress, stacktrace.NewError("Table %s has no jurisdiction column; migrate the schema first", table)
+	}
+	if buckets, err := db.ShardBuckets(ctx, dbName, table); err != nil {
+		return progress, err
+	} else if buckets > 0 {
+		return progress, stacktrace.NewError("Table %s has a primary key hash-sharded in %d buckets, which cannot be partitioned", table, buckets)
+	}
+
+	if err := db.relabel(ctx, dbName, table, opts, &progress); err != nil {
+		return progress, err
+	}
+
+	key, err := db.primaryKeyColumns(ctx, dbName, table)
+	if err != nil {
+		return progress, err
+	}
+	partitioned, err := db.partitioned(ctx, dbName, table)
+	if err != nil {
+		return progress, err
+	}
+	qualified := dbName + "." + table
+	var statements []string
+	if len(opts.Jurisdictions) == 0 {
+		if partitioned {
+			statements = append(statements, fmt.Sprintf(`ALTER TABLE %s PARTITION BY NOTHING`, qualified))
+		}
+		if strings.Join(key, ",") != "id" {
+			statements = append(statements, fmt.Sprintf(`ALTER TABLE %s ALTER PRIMARY KEY USING COLUMNS (id)`, qualified))
+		}
+	} else {
+		if strings.Join(key, ",") != "jurisdiction,id" {
+			statements = append(statements, fmt.Sprintf(`ALTER TABLE %s ALTER PRIMARY KEY USING COLUMNS (jurisdiction, id)`, qualified))
+		}
+		statements = append(statements, partitionStatement(qualified, opts.Jurisdictions))
+		for _, j := range opts.Jurisdictions {
+			if constraints, ok := opts.Constraints[j.Name]; ok {
+				statements = append(statements, zoneStatement(qualified, j.Name, constraints))
+			}
+		}
+	}
+	for _, query := range statements {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return progress, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+	}
+	return progress, nil
+}
+
+// relabel sets the jurisdiction of the rows of table in dbName to the one
+// of their cells among opts.Jurisdictions, in batches ordered by id.
+func (db *DB) relabel(ctx context.Context, dbName string, table string, opts PartitionOptions, progress *PartitionProgress) error {
+	var (
+		query = fmt.Sprintf(`
+		SELECT
+			id::STRING, cells, jurisdiction
+		FROM
+			%s.%s
+		WHERE
+			$1::UUID IS NULL OR id > $1::UUID
+		ORDER BY
+			id
+		LIMIT
+			$2`, dbName, table)
+		updateQuery = fmt.Sprintf(`
+		UPDATE
+			%s.%s
+		SET
+			jurisdiction = $2
+		WHERE
+			id = $1`, dbName, table)
+		last *string
+	)
+	for {
+		var (
+			ids           []string
+			jurisdictions []string
+		)
+		rows, err := db.QueryContext(ctx, query, last, opts.BatchSize)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+		scanned := 0
+		for rows.Next() {
+			var (
+				id, current string
+				array       pq.Int64Array
+			)
+			if err := rows.Scan(&id, &array, &current); err != nil {
+				rows.Close()
+				return stacktrace.Propagate(err, "Error scanning row")
+			}
+			scanned++
+			last = &id
+			cells := make(s2.CellUnion, len(array))
+			for i, cell := range array {
+				cells[i] = s2.CellID(uint64(cell))
+			}
+			if j := opts.Jurisdictions.Of(cells); j != current {
+				ids = append(ids, id)
+				jurisdictions = append(jurisdictions, j)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return stacktrace.Propagate(err, "Error reading rows")
+		}
+		progress.Scanned += scanned
+
+		if len(ids) > 0 {
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return stacktrace.Propagate(err, "Error beginning transaction")
+			}
+			for i, id := range ids {
+				if _, err := tx.ExecContext(ctx, updateQuery, id, jurisdictions[i]); err != nil {
+					_ = tx.Rollback()
+					return stacktrace.Propagate(err, "Error in query: %s", updateQuery)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				return stacktrace.Propagate(err, "Error committing relabelled rows")
+			}
+			progress.Relabelled += len(ids)
+		}
+		if opts.Progress != nil {
+			opts.Progress(*progress)
+		}
+		if scanned < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// primaryKeyColumns returns the columns of the primary key of table in
+// dbName, in order.
+func (db *DB) primaryKeyColumns(ctx context.Context, dbName string, table string) ([]string, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			column_name
+		FROM
+			%s.information_schema.key_column_usage
+		WHERE
+			table_schema = 'public'
+		AND
+			table_name = '%s'
+		AND
+			constraint_name = 'primary'
+		ORDER BY
+			ordinal_position`, dbName, table)
+	var columns []string
+	if err := db.scanRows(ctx, query, func(scan func(...interface{}) error) error {
+		var c string
+		if err := scan(&c); err != nil {
+			return err
+		}
+		columns = append(columns, c)
+		return nil
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Error listing primary key columns of %s", table)
+	}
+	return columns, nil
+}
+
+// partitioned returns true if an index of table in dbName is partitioned,
+// which only its primary index is by PartitionByJurisdiction.
+func (db *DB) partitioned(ctx context.Context, dbName string, table string) (bool, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			count(*)
+		FROM
+			crdb_internal.partitions AS p
+		JOIN
+			crdb_internal.tables AS t
+		ON
+			p.table_id = t.table_id
+		WHERE
+			t.database_name = '%s'
+		AND
+			t.name = '%s'`, dbName, table)
+	var n int
+	if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return false, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return n > 0, nil
+}
+
+// partitionStatement returns the statement partitioning the primary index
+// of table by jurisdiction, in a partition named after each of
+// jurisdictions and one named geo.UnassignedName for the others.
+func partitionStatement(table string, jurisdictions geo.Jurisdictions) string {
+	partitions := make([]string, 0, len(jurisdictions)+1)
+	for _, name := range jurisdictions.Names() {
+		partitions = append(partitions, fmt.Sprintf(`PARTITION %s VALUES IN ('%s')`, name, name))
+	}
+	partitions = append(partitions, fmt.Sprintf(`PARTITION %s VALUES IN (DEFAULT)`, geo.UnassignedName))
+	return fmt.Sprintf(`ALTER TABLE %s PARTITION BY LIST (jurisdiction) (%s)`, table, strings.Join(partitions, ", "))
+}
+
+// zoneStatement returns the statement pinning the replicas, and thus the
+// leaseholder, of the partition of table named partition to constraints.
+func zoneStatement(table string, partition string, constraints []string) string {
+	return fmt.Sprintf(`ALTER PARTITION %s OF TABLE %s CONFIGURE ZONE USING constraints = '[%s]'`, partition, table, strings.Join(constraints, ", "))
+}
@@ -0,0 +1,33 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionStatements(t *testing.T) {
+	js, err := geo.ParseJurisdictions("ch:45.8,5.9,47.8,10.5;eu:34,-25,72,45")
+	require.NoError(t, err)
+	require.Equal(t,
+		"ALTER TABLE scd.scd_operations PARTITION BY LIST (jurisdiction) (PARTITION ch VALUES IN ('ch'), PARTITION eu VALUES IN ('eu'), PARTITION unassigned VALUES IN (DEFAULT))",
+		partitionStatement("scd.scd_operations", js))
+	require.Equal(t,
+		"ALTER PARTITION eu OF TABLE scd.scd_operations CONFIGURE ZONE USING constraints = '[+region=europe-west1, -zone=europe-west1-c]'",
+		zoneStatement("scd.scd_operations", "eu", []string{"+region=europe-west1", "-zone=europe-west1-c"}))
+}
+
+func TestParseZoneConstraints(t *testing.T) {
+	constraints, err := ParseZoneConstraints("ch:+region=europe-west6; eu:+region=europe-west1,+ssd")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"ch": {"+region=europe-west6"},
+		"eu": {"+region=europe-west1", "+ssd"},
+	}, constraints)
+
+	for _, s := range []string{"eu", "eu:region=europe-west1", "eu:+region=europe-west1']"} {
+		_, err := ParseZoneConstraints(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,171 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+
+	dsssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/stacktrace"
+)
+
+// Statement is a SQL statement issued by a store, with its arguments.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// StatementRecorder is a dsssql.Queryable recording the distinct statements
+// issued through it, so that their plans may be checked.
+type StatementRecorder struct {
+	dsssql.Queryable
+
+	mu         sync.Mutex
+	statements []Statement
+	seen       map[string]bool
+}
+
+// NewStatementRecorder returns a StatementRecorder issuing the statements on
+// q.
+func NewStatementRecorder(q dsssql.Queryable) *StatementRecorder {
+	return &StatementRecorder{Queryable: q, seen: map[string]bool{}}
+}
+
+func (r *StatementRecorder) record(query string, args []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[query] {
+		return
+	}
+	r.seen[query] = true
+	r.statements = append(r.statements, Statement{Query: query, Args: args})
+}
+
+// QueryContext implements dsssql.Queryable.
+func (r *StatementRecorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r.record(query, args)
+	return r.Queryable.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements dsssql.Queryable.
+func (r *StatementRecorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	r.record(query, args)
+	return r.Queryable.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext implements dsssql.Queryable.
+func (r *StatementRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.record(query, args)
+	return r.Queryable.ExecContext(ctx, query, args...)
+}
+
+// Statements returns the distinct statements recorded so far, with the
+// arguments of their first occurrence, in the order they were first issued.
+func (r *StatementRecorder) Statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Statement{}, r.statements...)
+}
+
+// Plan is the textual plan of a statement, as output by EXPLAIN.
+type Plan string
+
+// FullScans returns true if the plan scans a whole table or index.
+func (p Plan) FullScans() bool {
+	return strings.Contains(string(p), "FULL SCAN")
+}
+
+// Scans returns true if the plan reads index of table.
+func (p Plan) Scans(table, index string) bool {
+	return strings.Contains(string(p), table+"@"+index)
+}
+
+// Explain returns the plan of s, with the statistics of its execution if
+// analyze is true. Since EXPLAIN ANALYZE executes s, it is run in a
+// transaction which is rolled back, so that writes leave no trace. The plans
+// of the versions of CockroachDB laying them out as a table, such as 20.2,
+// are returned one row per line, with tab-separated columns.
+func (db *DB) Explain(ctx context.Context, s Statement, analyze bool) (Plan, error) {
+	explain := "EXPLAIN "
+	if analyze {
+		explain = "EXPLAIN ANALYZE "
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := explain + strings.TrimSpace(s.Query)
+	rows, err := tx.QueryContext(ctx, query, s.Args...)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error reading columns of plan")
+	}
+
+	var (
+		lines  []string
+		values = make([]sql.NullString, len(columns))
+		dests  = make([]interface{}, len(columns))
+	)
+	for i := range values {
+		dests[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dests...); err != nil {
+			return "", stacktrace.Propagate(err, "Error scanning plan row")
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = v.String
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return "", stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return Plan(strings.Join(lines, "\n")), nil
+}
+
+// IndexExpectation requires the plans of the statements matching Pattern,
+// once their whitespace is collapsed, to scan one of Indexes of Table.
+type IndexExpectation struct {
+	Pattern *regexp.Regexp
+	Table   string
+	Indexes []string
+}
+
+// CheckPlans explains statements, analyzing them if analyze is true, and
+// returns an error describing the first plan scanning a whole table or not
+// meeting expectations.
+func (db *DB) CheckPlans(ctx context.Context, statements []Statement, analyze bool, expectations []IndexExpectation) error {
+	for _, s := range statements {
+		query := strings.Join(strings.Fields(s.Query), " ")
+		plan, err := db.Explain(ctx, s, analyze)
+		if err != nil {
+			return err
+		}
+		if plan.FullScans() {
+			return stacktrace.NewError("Full scan in the plan of %s:\n%s", query, plan)
+		}
+		for _, e := range expectations {
+			if !e.Pattern.MatchString(query) {
+				continue
+			}
+			scans := false
+			for _, index := range e.Indexes {
+				scans = scans || plan.Scans(e.Table, index)
+			}
+			if !scans {
+				return stacktrace.NewError("Plan of %s scans none of %s@%v:\n%s", query, e.Table, e.Indexes, plan)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package cockroach
+
+import (
+	"fmt"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/lib/pq"
+)
+
+// RestrictToRegions appends to query, a statement whose WHERE clause is last
+// and whose arguments are args, a condition restricting the region column
+// to the regions of the entities that may intersect cells.
+func RestrictToRegions(query string, args []interface{}, column string, cells s2.CellUnion) (string, []interface{}) {
+	query += fmt.Sprintf(`
+		AND
+			%s = ANY($%d)`, column, len(args)+1)
+	return query, append(args, pq.Int64Array(geo.RegionsIntersecting(cells)))
+}
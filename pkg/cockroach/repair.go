@@ -0,0 +1,349 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// The issues of the rows of entity tables found by Repair.
+const (
+	// IssueNullUpdatedAt is a NULL updated_at, from which versions and OVNs
+	// derive. It is fixed by setting updated_at to the current time.
+	IssueNullUpdatedAt = "null_updated_at"
+	// IssueEmptyCells is a NULL or empty cells array, leaving the entity
+	// out of every search. The row is quarantined.
+	IssueEmptyCells = "empty_cells"
+	// IssueInvalidCells are cells that are not valid S2 cell IDs. They are
+	// removed, and the row is quarantined if no valid cell remains.
+	IssueInvalidCells = "invalid_cells"
+)
+
+// repairCellIndexes are the tables indexing the cells of entity tables, by
+// entity table, along with their entity ID column. The invalid cells
+// removed from an entity are removed from its index as well.
+var repairCellIndexes = map[string][2]string{
+	"scd_operations": {"cells_scd_operations", "operation_id"},
+}
+
+// repairQuarantineGuards are the conditions under which the rows of an
+// entity table may be quarantined, by entity table, the database name
+// replacing %[1]s. Deleting a subscription would cascade to the operational
+// intents referencing it.
+var repairQuarantineGuards = map[string]string{
+	"scd_subscriptions": "NOT EXISTS (SELECT 1 FROM %[1]s.scd_operations AS o WHERE o.subscription_id = %[1]s.scd_subscriptions.id)",
+}
+
+// RepairOptions configure Repair.
+type RepairOptions struct {
+	// BatchSize is the number of rows scanned, and repaired in a single
+	// transaction, at once; importBatchSize if zero.
+	BatchSize int
+	// DryRun reports the issues found without repairing them.
+	DryRun bool
+	// Quarantine receives the rows that cannot be fixed, as a dump which
+	// Import accepts once the rows are fixed by hand. It is required unless
+	// DryRun.
+	Quarantine io.Writer
+	// Progress, if not nil, is called after each batch with the progress of
+	// the table of the batch.
+	Progress func(RepairProgress)
+}
+
+// RepairProgress counts the rows of a table scanned and repaired by Repair.
+type RepairProgress struct {
+	Table   string `json:"table"`
+	Scanned int    `json:"scanned"`
+	// Issues counts the rows found with each issue.
+	Issues map[string]int `json:"issues"`
+	Fixed  int            `json:"fixed"`
+	// Quarantined rows were moved to RepairOptions.Quarantine, Skipped rows
+	// could be neither fixed nor quarantined.
+	Quarantined int `json:"quarantined"`
+	Skipped     int `json:"skipped"`
+}
+
+// rowRepair is how Repair repairs a row.
+type rowRepair struct {
+	issues []string
+	// quarantine is true if the row cannot be fixed.
+	quarantine bool
+	// cells replace the cells of the row if IssueInvalidCells is among
+	// issues.
+	cells []int64
+}
+
+// diagnose returns how to repair a row whose updated_at is NULL if
+// nullUpdatedAt and whose cells are cells if hasCells, or nil if the row is
+// sound.
+func diagnose(nullUpdatedAt bool, cells []int64, hasCells bool) *rowRepair {
+	r := &rowRepair{}
+	if nullUpdatedAt {
+		r.issues = append(r.issues, IssueNullUpdatedAt)
+	}
+	if hasCells {
+		valid := make([]int64, 0, len(cells))
+		for _, cell := range cells {
+			if s2.CellID(uint64(cell)).IsValid() {
+				valid = append(valid, cell)
+			}
+		}
+		switch {
+		case len(cells) == 0:
+			r.issues = append(r.issues, IssueEmptyCells)
+			r.quarantine = true
+		case len(valid) < len(cells):
+			r.issues = append(r.issues, IssueInvalidCells)
+			r.quarantine = len(valid) == 0
+			r.cells = valid
+		}
+	}
+	if len(r.issues) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Repair scans the rows of tables in dbName for the issues NULL updated_at,
+// empty cells and invalid cells, as may be left by imports from older schema
+// versions, in batches ordered by id. Unless opts.DryRun, the rows that can
+// be fixed are fixed, and the others deleted and written to
+// opts.Quarantine. It returns the progress of each table.
+func (db *DB) Repair(ctx context.Context, dbName string, tables []string, opts RepairOptions) ([]RepairProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = importBatchSize
+	}
+	var encoder *json.Encoder
+	if !opts.DryRun {
+		if opts.Quarantine == nil {
+			return nil, stacktrace.NewError("Repairing requires a destination for the quarantined rows")
+		}
+		version, err := db.GetVersion(ctx, dbName)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error getting version of database %s", dbName)
+		}
+		encoder = json.NewEncoder(opts.Quarantine)
+		if err := encoder.Encode(&DumpHeader{Database: dbName, Version: version.String()}); err != nil {
+			return nil, stacktrace.Propagate(err, "Error writing quarantine header")
+		}
+	}
+
+	var results []RepairProgress
+	for _, table := range tables {
+		progress, err := db.repairTable(ctx, dbName, table, opts, encoder)
+		results = append(results, progress)
+		if err != nil {
+			return results, stacktrace.Propagate(err, "Error repairing %s", table)
+		}
+	}
+	return results, nil
+}
+
+// repairTable repairs table in dbName as described by Repair, writing the
+// quarantined rows with encoder.
+func (db *DB) repairTable(ctx context.Context, dbName string, table string, opts RepairOptions, encoder *json.Encoder) (RepairProgress, error) {
+	progress := RepairProgress{Table: table, Issues: map[string]int{}}
+	columns, err := db.dumpColumns(ctx, dbName, table)
+	if err != nil {
+		return progress, err
+	}
+	var hasUpdatedAt, hasCells bool
+	for _, c := range columns {
+		hasUpdatedAt = hasUpdatedAt || c == "updated_at"
+		hasCells = hasCells || c == "cells"
+	}
+	if !hasUpdatedAt && !hasCells {
+		return progress, nil
+	}
+	index, indexed := repairCellIndexes[table]
+	if indexed {
+		if _, err := db.dumpColumns(ctx, dbName, index[0]); err != nil {
+			indexed = false
+		}
+	}
+
+	nullUpdatedAt, cells := "false", "NULL::INT8[]"
+	if hasUpdatedAt {
+		nullUpdatedAt = "updated_at IS NULL"
+	}
+	if hasCells {
+		cells = "cells"
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			id::STRING, %s, %s
+		FROM
+			%s.%s
+		WHERE
+			$1::UUID IS NULL OR id > $1::UUID
+		ORDER BY
+			id
+		LIMIT
+			$2`, nullUpdatedAt, cells, dbName, table)
+
+	selections := make([]string, len(columns))
+	for i, c := range columns {
+		selections[i] = c + "::STRING"
+	}
+	deleteQuery := fmt.Sprintf(`
+		DELETE FROM
+			%s.%s
+		WHERE
+			id = $1`, dbName, table)
+	if guard, ok := repairQuarantineGuards[table]; ok {
+		deleteQuery += "\n\t\tAND\n\t\t\t" + fmt.Sprintf(guard, dbName)
+	}
+	deleteQuery += "\n\t\tRETURNING\n\t\t\t" + strings.Join(selections, ", ")
+
+	var last *string
+	for {
+		var (
+			ids     []string
+			repairs []*rowRepair
+		)
+		rows, err := db.QueryContext(ctx, query, last, opts.BatchSize)
+		if err != nil {
+			return progress, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+		scanned := 0
+		for rows.Next() {
+			var (
+				id    string
+				null  bool
+				array pq.Int64Array
+			)
+			if err := rows.Scan(&id, &null, &array); err != nil {
+				rows.Close()
+				return progress, stacktrace.Propagate(err, "Error scanning row")
+			}
+			scanned++
+			last = &id
+			if r := diagnose(null, array, hasCells); r != nil {
+				ids = append(ids, id)
+				repairs = append(repairs, r)
+				for _, issue := range r.issues {
+					progress.Issues[issue]++
+				}
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return progress, stacktrace.Propagate(err, "Error reading rows")
+		}
+		progress.Scanned += scanned
+		if scanned == 0 {
+			return progress, nil
+		}
+
+		if !opts.DryRun && len(ids) > 0 {
+			quarantined, err := db.repairBatch(ctx, dbName, table, columns, deleteQuery, index, indexed, ids, repairs, &progress)
+			if err != nil {
+				return progress, err
+			}
+			for _, row := range quarantined {
+				if err := encoder.Encode(row); err != nil {
+					return progress, stacktrace.Propagate(err, "Error writing quarantined row")
+				}
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		if scanned < opts.BatchSize {
+			return progress, nil
+		}
+	}
+}
+
+// repairBatch repairs the rows of table identified by ids as described by
+// repairs in a single transaction, and returns the rows quarantined, which
+// are only to be written once committed.
+func (db *DB) repairBatch(ctx context.Context, dbName string, table string, columns []string, deleteQuery string, index [2]string, indexed bool, ids []string, repairs []*rowRepair, progress *RepairProgress) ([]*DumpRow, error) {
+	var (
+		quarantined    []*DumpRow
+		fixed, skipped int
+	)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error beginning transaction")
+	}
+	for i, id := range ids {
+		r := repairs[i]
+		if r.quarantine {
+			values := make([]*string, len(columns))
+			targets := make([]interface{}, len(columns))
+			for j := range values {
+				targets[j] = &values[j]
+			}
+			err := tx.QueryRowContext(ctx, deleteQuery, id).Scan(targets...)
+			if err == sql.ErrNoRows {
+				skipped++
+				continue
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return nil, stacktrace.Propagate(err, "Error in query: %s", deleteQuery)
+			}
+			row := &DumpRow{Table: table, Row: make(map[string]*string, len(columns))}
+			for j, c := range columns {
+				row.Row[c] = values[j]
+			}
+			quarantined = append(quarantined, row)
+			continue
+		}
+
+		var (
+			assignments []string
+			args        = []interface{}{id}
+		)
+		for _, issue := range r.issues {
+			switch issue {
+			case IssueNullUpdatedAt:
+				assignments = append(assignments, "updated_at = now()")
+			case IssueInvalidCells:
+				args = append(args, pq.Int64Array(r.cells))
+				assignments = append(assignments, fmt.Sprintf("cells = $%d", len(args)))
+			}
+		}
+		updateQuery := fmt.Sprintf(`
+			UPDATE
+				%s.%s
+			SET
+				%s
+			WHERE
+				id = $1`, dbName, table, strings.Join(assignments, ", "))
+		if _, err := tx.ExecContext(ctx, updateQuery, args...); err != nil {
+			_ = tx.Rollback()
+			return nil, stacktrace.Propagate(err, "Error in query: %s", updateQuery)
+		}
+		if indexed && r.cells != nil {
+			indexQuery := fmt.Sprintf(`
+				DELETE FROM
+					%s.%s
+				WHERE
+					%s = $1
+				AND
+					cell_id <> ALL($2)`, dbName, index[0], index[1])
+			if _, err := tx.ExecContext(ctx, indexQuery, id, pq.Int64Array(r.cells)); err != nil {
+				_ = tx.Rollback()
+				return nil, stacktrace.Propagate(err, "Error in query: %s", indexQuery)
+			}
+		}
+		fixed++
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error committing transaction")
+	}
+	progress.Fixed += fixed
+	progress.Skipped += skipped
+	progress.Quarantined += len(quarantined)
+	return quarantined, nil
+}
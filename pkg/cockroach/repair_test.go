@@ -0,0 +1,35 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	var (
+		valid   = int64(s2.CellIDFromLatLng(s2.LatLngFromDegrees(37.4, -122.1)).Parent(13))
+		invalid = int64(-1)
+	)
+
+	require.Nil(t, diagnose(false, []int64{valid}, true))
+	require.Nil(t, diagnose(false, nil, false))
+
+	r := diagnose(true, []int64{valid}, true)
+	require.Equal(t, []string{IssueNullUpdatedAt}, r.issues)
+	require.False(t, r.quarantine)
+
+	r = diagnose(false, nil, true)
+	require.Equal(t, []string{IssueEmptyCells}, r.issues)
+	require.True(t, r.quarantine)
+
+	r = diagnose(true, []int64{valid, invalid}, true)
+	require.Equal(t, []string{IssueNullUpdatedAt, IssueInvalidCells}, r.issues)
+	require.False(t, r.quarantine)
+	require.Equal(t, []int64{valid}, r.cells)
+
+	r = diagnose(false, []int64{invalid, 0}, true)
+	require.Equal(t, []string{IssueInvalidCells}, r.issues)
+	require.True(t, r.quarantine)
+}
@@ -0,0 +1,143 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// retryableErrorCode is the SQLSTATE CockroachDB uses to signal that a
+// transaction was aborted due to contention and should be retried.
+const retryableErrorCode = "40001"
+
+// checkViolationErrorCode is the SQLSTATE of the writes violating a CHECK
+// constraint.
+const checkViolationErrorCode = "23514"
+
+// idFormatConstraint is the name of the CHECK constraints on the format of
+// the IDs of the entity tables, added by remote ID schema 3.6.0 and strategic
+// conflict detection schema 3.7.0.
+const idFormatConstraint = "id_format"
+
+// RetryPolicy bounds the retries of transactions aborted by CockroachDB.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a transaction is attempted.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; subsequent delays
+	// double up to MaxBackoff. Every delay d is then jittered uniformly
+	// within [d/2, 3d/2), so a retry may wait up to 1.5 times MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by DB instances that do not set
+// one explicitly.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// backoff returns the delay to wait before attempt number "attempt" (with
+// the first retry being attempt 2), jittered by up to 50% either way.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 2; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// IsRetryable returns true if err indicates that the transaction in which it
+// occurred was aborted due to contention and may succeed if retried.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == retryableErrorCode
+	}
+	if pqErr, ok := stacktrace.RootCause(err).(*pq.Error); ok {
+		return pqErr.Code == retryableErrorCode
+	}
+	return false
+}
+
+// IsIDFormatViolation returns true if err indicates that an entity was
+// written with an ID rejected by the id_format constraint of its table.
+func IsIDFormatViolation(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		if pqErr, _ = stacktrace.RootCause(err).(*pq.Error); pqErr == nil {
+			return false
+		}
+	}
+	return pqErr.Code == checkViolationErrorCode && pqErr.Constraint == idFormatConstraint
+}
+
+// ExecuteTx runs fn in a transaction, committing if fn returns nil. If the
+// transaction is aborted by CockroachDB due to contention, it is retried
+// from scratch with exponential backoff and jitter according to db's
+// RetryPolicy. Once the retry budget is exhausted, an Unavailable error is
+// returned rather than the raw retryable error. Writes rejected by the
+// id_format constraints fail with InvalidID. If ctx has a deadline, the
+// statements of every attempt are bounded by the time left until it.
+func (db *DB) ExecuteTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	policy := db.RetryPolicy
+	if policy.MaxAttempts <= 0 {
+		policy = DefaultRetryPolicy
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.executeTxOnce(ctx, fn)
+		if IsIDFormatViolation(err) {
+			return stacktrace.PropagateWithCode(err, dsserr.InvalidID, "ID not in the format required by the database")
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return stacktrace.PropagateWithCode(err, dsserr.Unavailable, "Transaction still contended after %d attempts", attempt)
+		}
+
+		t := time.NewTimer(policy.backoff(attempt + 1))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return stacktrace.Propagate(ctx.Err(), "Context ended while waiting to retry transaction: %s", err.Error())
+		case <-t.C:
+		}
+	}
+}
+
+func (db *DB) executeTxOnce(ctx context.Context, fn func(*sql.Tx) error) error {
+	return db.withDeadline(ctx, func(b txBeginner) error {
+		tx, err := b.BeginTx(ctx, nil)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error beginning transaction")
+		}
+		err = func() (err error) {
+			defer dsserr.RecoverPanic(&err)
+			return fn(tx)
+		}()
+		if err != nil {
+			// The transaction is discarded anyway; the original error matters.
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,41 @@
+package cockroach
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	require.False(t, IsRetryable(nil))
+	require.False(t, IsRetryable(errors.New("boom")))
+	require.False(t, IsRetryable(&pq.Error{Code: "23505"}))
+	require.True(t, IsRetryable(&pq.Error{Code: "40001"}))
+	require.True(t, IsRetryable(stacktrace.Propagate(&pq.Error{Code: "40001"}, "Error upserting")))
+}
+
+func TestIsIDFormatViolation(t *testing.T) {
+	require.False(t, IsIDFormatViolation(nil))
+	require.False(t, IsIDFormatViolation(&pq.Error{Code: "23514", Constraint: "check_altitudes"}))
+	require.True(t, IsIDFormatViolation(stacktrace.Propagate(&pq.Error{Code: "23514", Constraint: "id_format"}, "Error upserting")))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+	}
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		require.True(t, d >= 5*time.Millisecond && d < 15*time.Millisecond, d)
+		d = p.backoff(3)
+		require.True(t, d >= 10*time.Millisecond && d < 30*time.Millisecond, d)
+		d = p.backoff(10)
+		require.True(t, d >= 20*time.Millisecond && d < 60*time.Millisecond, d)
+	}
+}
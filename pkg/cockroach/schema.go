@@ -0,0 +1,264 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// ColumnDescription describes a column of a table.
+type ColumnDescription struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Default  string `json:"default,omitempty"`
+}
+
+// IndexDescription describes an index of a table by its canonical
+// definition, stripped of the database name.
+type IndexDescription struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// ConstraintDescription describes a constraint of a table.
+type ConstraintDescription struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableDescription describes a table of a database.
+type TableDescription struct {
+	Name        string                  `json:"name"`
+	Columns     []ColumnDescription     `json:"columns"`
+	Indexes     []IndexDescription      `json:"indexes"`
+	Constraints []ConstraintDescription `json:"constraints"`
+}
+
+// SchemaDescription is a machine-readable description of the schema of a
+// database, suitable for comparing the schemas of two DSS instances.
+type SchemaDescription struct {
+	Database string             `json:"database"`
+	Version  string             `json:"version"`
+	Tables   []TableDescription `json:"tables"`
+}
+
+// DescribeSchema introspects the public schema of dbName and returns its
+// description. Tables, and the indexes and constraints of each table, are
+// sorted by name; columns are in their declaration order.
+func (db *DB) DescribeSchema(ctx context.Context, dbName string) (*SchemaDescription, error) {
+	version, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error getting version of database %s", dbName)
+	}
+	qualifiedName := db.NamePrefix + dbName
+	result := &SchemaDescription{Database: qualifiedName, Version: version.String()}
+	tables := map[string]*TableDescription{}
+	table := func(name string) *TableDescription {
+		t, ok := tables[name]
+		if !ok {
+			t = &TableDescription{
+				Name:        name,
+				Columns:     []ColumnDescription{},
+				Indexes:     []IndexDescription{},
+				Constraints: []ConstraintDescription{},
+			}
+			tables[name] = t
+		}
+		return t
+	}
+
+	columnsQuery := fmt.Sprintf(`
+		SELECT
+			table_name,
+			column_name,
+			data_type,
+			is_nullable = 'YES',
+			COALESCE(column_default, '')
+		FROM
+			%s.information_schema.columns
+		WHERE
+			table_schema = 'public'
+		ORDER BY
+			table_name, ordinal_position`, qualifiedName)
+	if err := db.scanRows(ctx, columnsQuery, func(scan func(...interface{}) error) error {
+		var (
+			tableName string
+			c         ColumnDescription
+		)
+		if err := scan(&tableName, &c.Name, &c.Type, &c.Nullable, &c.Default); err != nil {
+			return err
+		}
+		t := table(tableName)
+		t.Columns = append(t.Columns, c)
+		return nil
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Error describing columns of database %s", qualifiedName)
+	}
+
+	indexesQuery := fmt.Sprintf(`
+		SELECT
+			tablename,
+			indexname,
+			indexdef
+		FROM
+			%s.pg_catalog.pg_indexes
+		WHERE
+			schemaname = 'public'
+		ORDER BY
+			tablename, indexname`, qualifiedName)
+	if err := db.scanRows(ctx, indexesQuery, func(scan func(...interface{}) error) error {
+		var (
+			tableName string
+			i         IndexDescription
+		)
+		if err := scan(&tableName, &i.Name, &i.Definition); err != nil {
+			return err
+		}
+		// Omit the database name so that definitions are comparable across
+		// databases.
+		i.Definition = strings.ReplaceAll(i.Definition, qualifiedName+".", "")
+		t := table(tableName)
+		t.Indexes = append(t.Indexes, i)
+		return nil
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Error describing indexes of database %s", qualifiedName)
+	}
+
+	constraintsQuery := fmt.Sprintf(`
+		SELECT
+			table_name,
+			constraint_name,
+			constraint_type
+		FROM
+			%s.information_schema.table_constraints
+		WHERE
+			table_schema = 'public'
+		ORDER BY
+			table_name, constraint_name`, qualifiedName)
+	if err := db.scanRows(ctx, constraintsQuery, func(scan func(...interface{}) error) error {
+		var (
+			tableName string
+			c         ConstraintDescription
+		)
+		if err := scan(&tableName, &c.Name, &c.Type); err != nil {
+			return err
+		}
+		t := table(tableName)
+		t.Constraints = append(t.Constraints, c)
+		return nil
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Error describing constraints of database %s", qualifiedName)
+	}
+
+	for _, t := range tables {
+		result.Tables = append(result.Tables, *t)
+	}
+	sort.Slice(result.Tables, func(i, j int) bool { return result.Tables[i].Name < result.Tables[j].Name })
+	return result, nil
+}
+
+// scanRows runs query and calls f with the Scan function of each resulting
+// row.
+func (db *DB) scanRows(ctx context.Context, query string, f func(scan func(...interface{}) error) error) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows.Scan); err != nil {
+			return stacktrace.Propagate(err, "Error scanning row")
+		}
+	}
+	return stacktrace.Propagate(rows.Err(), "Error reading rows")
+}
+
+// SchemaDrift is a difference between an expected and an actual schema.
+type SchemaDrift struct {
+	// Element names the schema element, e.g. "table scd_operations index
+	// cell_idx".
+	Element string `json:"element"`
+	// Missing is set if the element is only expected, and Unexpected if it
+	// is only actual. Expected and Actual are the definitions of the element
+	// otherwise.
+	Missing    bool   `json:"missing,omitempty"`
+	Unexpected bool   `json:"unexpected,omitempty"`
+	Expected   string `json:"expected,omitempty"`
+	Actual     string `json:"actual,omitempty"`
+}
+
+// DiffSchemas returns the differences between the expected and actual
+// schemas, sorted by element. The names of the databases are not compared.
+func DiffSchemas(expected, actual *SchemaDescription) []SchemaDrift {
+	var (
+		elementsE = expected.elements()
+		elementsA = actual.elements()
+		keys      []string
+	)
+	for k := range elementsE {
+		keys = append(keys, k)
+	}
+	for k := range elementsA {
+		if _, ok := elementsE[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var drifts []SchemaDrift
+	for _, k := range keys {
+		ve, okE := elementsE[k]
+		va, okA := elementsA[k]
+		switch {
+		case !okA:
+			drifts = append(drifts, SchemaDrift{Element: k, Missing: true, Expected: ve})
+		case !okE:
+			drifts = append(drifts, SchemaDrift{Element: k, Unexpected: true, Actual: va})
+		case ve != va:
+			drifts = append(drifts, SchemaDrift{Element: k, Expected: ve, Actual: va})
+		}
+	}
+	return drifts
+}
+
+// CompareSchemas returns a human-readable list of the differences between
+// the schemas described by a and b, or nothing if they are identical. The
+// names of the databases are not compared.
+func CompareSchemas(a, b *SchemaDescription) []string {
+	var differences []string
+	for _, d := range DiffSchemas(a, b) {
+		switch {
+		case d.Missing:
+			differences = append(differences, fmt.Sprintf("%s only in %s", d.Element, a.Database))
+		case d.Unexpected:
+			differences = append(differences, fmt.Sprintf("%s only in %s", d.Element, b.Database))
+		default:
+			differences = append(differences, fmt.Sprintf("%s differs: %q in %s, %q in %s", d.Element, d.Expected, a.Database, d.Actual, b.Database))
+		}
+	}
+	return differences
+}
+
+// elements flattens the description into a map from the name of each schema
+// element to its definition.
+func (s *SchemaDescription) elements() map[string]string {
+	result := map[string]string{"version": s.Version}
+	for _, t := range s.Tables {
+		table := fmt.Sprintf("table %s", t.Name)
+		result[table] = ""
+		for i, c := range t.Columns {
+			result[fmt.Sprintf("%s column %s", table, c.Name)] = fmt.Sprintf("#%d %s nullable=%t default=%s", i, c.Type, c.Nullable, c.Default)
+		}
+		for _, i := range t.Indexes {
+			result[fmt.Sprintf("%s index %s", table, i.Name)] = i.Definition
+		}
+		for _, c := range t.Constraints {
+			result[fmt.Sprintf("%s constraint %s", table, c.Name)] = c.Type
+		}
+	}
+	return result
+}
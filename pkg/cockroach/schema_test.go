@@ -0,0 +1,71 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareSchemas(t *testing.T) {
+	describe := func(database string) *SchemaDescription {
+		return &SchemaDescription{
+			Database: database,
+			Version:  "3.1.0",
+			Tables: []TableDescription{
+				{
+					Name: "subscriptions",
+					Columns: []ColumnDescription{
+						{Name: "id", Type: "UUID"},
+						{Name: "owner", Type: "STRING"},
+						{Name: "ends_at", Type: "TIMESTAMPTZ", Nullable: true},
+					},
+					Indexes: []IndexDescription{
+						{Name: "primary", Definition: "CREATE UNIQUE INDEX \"primary\" ON public.subscriptions USING btree (id ASC)"},
+					},
+					Constraints: []ConstraintDescription{
+						{Name: "primary", Type: "PRIMARY KEY"},
+					},
+				},
+			},
+		}
+	}
+
+	require.Empty(t, CompareSchemas(describe("a"), describe("b")))
+
+	b := describe("b")
+	b.Version = "3.2.0"
+	b.Tables[0].Columns = append(b.Tables[0].Columns, ColumnDescription{Name: "writer", Type: "STRING", Nullable: true})
+	b.Tables[0].Columns[2].Nullable = false
+	b.Tables[0].Indexes = nil
+	require.Equal(t, []string{
+		"table subscriptions column ends_at differs: \"#2 TIMESTAMPTZ nullable=true default=\" in a, \"#2 TIMESTAMPTZ nullable=false default=\" in b",
+		"table subscriptions column writer only in b",
+		"table subscriptions index primary only in a",
+		"version differs: \"3.1.0\" in a, \"3.2.0\" in b",
+	}, CompareSchemas(describe("a"), b))
+}
+
+func TestDiffSchemas(t *testing.T) {
+	expected := &SchemaDescription{
+		Database: "expected",
+		Version:  "3.5.0",
+		Tables: []TableDescription{{
+			Name: "scd_operations",
+			Indexes: []IndexDescription{
+				{Name: "cell_idx", Definition: "CREATE INDEX cell_idx ON public.scd_operations USING gin (cells ASC)"},
+			},
+		}},
+	}
+	actual := &SchemaDescription{
+		Database: "actual",
+		Version:  "3.4.0",
+		Tables:   []TableDescription{{Name: "scd_operations"}, {Name: "leftover"}},
+	}
+
+	require.Empty(t, DiffSchemas(expected, expected))
+	require.Equal(t, []SchemaDrift{
+		{Element: "table leftover", Unexpected: true},
+		{Element: "table scd_operations index cell_idx", Missing: true, Expected: expected.Tables[0].Indexes[0].Definition},
+		{Element: "version", Expected: "3.5.0", Actual: "3.4.0"},
+	}, DiffSchemas(expected, actual))
+}
@@ -0,0 +1,157 @@
+package cockroach
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/interuss/stacktrace"
+)
+
+// AWSCredentials are the credentials of an AWS principal.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// SecretsManagerProvider is a CredentialsProvider reading the secret
+// SecretID of AWS Secrets Manager, whose SecretString is a JSON object
+// holding the fields username, password, ca_cert, client_cert and
+// client_key.
+type SecretsManagerProvider struct {
+	Region   string
+	SecretID string
+	// Credentials returns the AWS credentials to sign requests with, read
+	// again for every secret so that temporary credentials are picked up.
+	Credentials func() (AWSCredentials, error)
+	// Endpoint overrides the regional endpoint of Secrets Manager, e.g. for
+	// VPC endpoints.
+	Endpoint string
+	// Client sends the requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Secret implements CredentialsProvider.
+func (p *SecretsManagerProvider) Secret(ctx context.Context) (*Secret, error) {
+	creds, err := p.Credentials()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading AWS credentials")
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + p.Region + ".amazonaws.com/"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": p.SecretID})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error encoding Secrets Manager request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error creating Secrets Manager request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, body, creds, p.Region, "secretsmanager", time.Now())
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading secret %s from Secrets Manager", p.SecretID)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading Secrets Manager response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, stacktrace.NewError("Secrets Manager returned %s reading secret %s: %s", resp.Status, p.SecretID, respBody)
+	}
+
+	var value struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(respBody, &value); err != nil {
+		return nil, stacktrace.Propagate(err, "Error decoding Secrets Manager response")
+	}
+	fields := &secretFields{}
+	if err := json.Unmarshal([]byte(value.SecretString), fields); err != nil {
+		return nil, stacktrace.Propagate(err, "Error decoding secret %s", p.SecretID)
+	}
+	return fields.secret()
+}
+
+// signAWSRequest signs req, whose payload is body, with AWS Signature
+// Version 4 for service in region, as of now. Every header set on req is
+// signed.
+func signAWSRequest(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
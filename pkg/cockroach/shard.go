@@ -0,0 +1,108 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// shardColumnPrefix prefixes the name of the hidden column CockroachDB adds
+// to a table whose primary key on id is hash-sharded, suffixed by the
+// number of buckets.
+const shardColumnPrefix = "crdb_internal_id_shard_"
+
+// ShardBuckets returns the number of buckets of the hash-sharded primary key
+// of table in dbName, 0 if its primary key is not hash-sharded.
+func (db *DB) ShardBuckets(ctx context.Context, dbName string, table string) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			column_name
+		FROM
+			%s.information_schema.columns
+		WHERE
+			table_schema = 'public'
+		AND
+			table_name = '%s'
+		AND
+			column_name LIKE '%s%%'`, dbName, table, shardColumnPrefix)
+	buckets := 0
+	if err := db.scanRows(ctx, query, func(scan func(...interface{}) error) error {
+		var c string
+		if err := scan(&c); err != nil {
+			return err
+		}
+		if n, ok := shardBuckets(c); ok {
+			buckets = n
+		}
+		return nil
+	}); err != nil {
+		return 0, stacktrace.Propagate(err, "Error listing shard columns of %s", table)
+	}
+	return buckets, nil
+}
+
+// ShardPrimaryKey alters the primary key of table in dbName, on id, to be
+// hash-sharded in buckets buckets, spreading inserts of time-ordered IDs
+// over as many ranges, or to be plain again if buckets is 0. It returns
+// false, without altering the table, if its primary key is already so.
+// Tables partitioned by jurisdiction cannot be hash-sharded.
+// The table is rewritten, online, which takes time proportional to its
+// size.
+func (db *DB) ShardPrimaryKey(ctx context.Context, dbName string, table string, buckets int) (bool, error) {
+	if buckets < 0 || buckets == 1 {
+		return false, stacktrace.NewError("Invalid number of shard buckets %d", buckets)
+	}
+	current, err := db.ShardBuckets(ctx, dbName, table)
+	if err != nil {
+		return false, err
+	}
+	if current == buckets {
+		return false, nil
+	}
+	key, err := db.primaryKeyColumns(ctx, dbName, table)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range key {
+		if c == "jurisdiction" {
+			return false, stacktrace.NewError("Table %s is partitioned by jurisdiction, whose primary key cannot be hash-sharded", table)
+		}
+	}
+	if buckets > 0 {
+		const query = `SET experimental_enable_hash_sharded_indexes = on`
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return false, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+	}
+	query := primaryKeyStatement(dbName+"."+table, buckets)
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return false, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return true, nil
+}
+
+// primaryKeyStatement returns the statement altering the primary key of
+// table to be on id, hash-sharded in buckets buckets unless 0.
+func primaryKeyStatement(table string, buckets int) string {
+	query := fmt.Sprintf(`ALTER TABLE %s ALTER PRIMARY KEY USING COLUMNS (id)`, table)
+	if buckets > 0 {
+		query += fmt.Sprintf(` USING HASH WITH BUCKET_COUNT = %d`, buckets)
+	}
+	return query
+}
+
+// shardBuckets returns the number of buckets of the hash-sharded primary key
+// whose shard column is named column, and whether column is such a column.
+func shardBuckets(column string) (int, bool) {
+	if !strings.HasPrefix(column, shardColumnPrefix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(column, shardColumnPrefix))
+	if err != nil || n < 2 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,25 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardBuckets(t *testing.T) {
+	n, ok := shardBuckets("crdb_internal_id_shard_8")
+	require.True(t, ok)
+	require.Equal(t, 8, n)
+
+	for _, column := range []string{"id", "crdb_internal_id_shard_", "crdb_internal_id_shard_x", "crdb_internal_owner_shard_8"} {
+		_, ok := shardBuckets(column)
+		require.False(t, ok, column)
+	}
+}
+
+func TestPrimaryKeyStatement(t *testing.T) {
+	require.Equal(t, "ALTER TABLE scd.scd_operations ALTER PRIMARY KEY USING COLUMNS (id) USING HASH WITH BUCKET_COUNT = 8",
+		primaryKeyStatement("scd.scd_operations", 8))
+	require.Equal(t, "ALTER TABLE scd.scd_operations ALTER PRIMARY KEY USING COLUMNS (id)",
+		primaryKeyStatement("scd.scd_operations", 0))
+}
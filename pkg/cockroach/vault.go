@@ -0,0 +1,102 @@
+package cockroach
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// secretFields are the fields of the secrets read by the providers of this
+// package, whether JSON objects stored in a secret manager or generated by
+// a database secrets engine.
+type secretFields struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+}
+
+func (f *secretFields) secret() (*Secret, error) {
+	if f.Username == "" {
+		return nil, stacktrace.NewError("Missing username in crdb secret")
+	}
+	return &Secret{
+		Credentials: Credentials{Username: f.Username, Password: f.Password},
+		CACert:      []byte(f.CACert),
+		ClientCert:  []byte(f.ClientCert),
+		ClientKey:   []byte(f.ClientKey),
+	}, nil
+}
+
+// VaultProvider is a CredentialsProvider reading the secret at Path of a
+// HashiCorp Vault server through its HTTP API, such as a KV secret
+// (secret/data/dss/crdb) holding the fields username, password, ca_cert,
+// client_cert and client_key, or the credentials generated by the database
+// secrets engine (database/creds/dss).
+type VaultProvider struct {
+	// Address is the base URL of the Vault server, e.g.
+	// https://vault.example.com:8200.
+	Address string
+	Path    string
+	// Token returns the Vault token to authenticate with, read again for
+	// every secret so that renewed tokens are picked up.
+	Token func() (string, error)
+	// Client sends the requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Secret implements CredentialsProvider.
+func (v *VaultProvider) Secret(ctx context.Context) (*Secret, error) {
+	token, err := v.Token()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading Vault token")
+	}
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(v.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error creating Vault request")
+	}
+	req.Header.Set("X-Vault-Token", token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading Vault secret %s", v.Path)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading Vault response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, stacktrace.NewError("Vault returned %s reading secret %s", resp.Status, v.Path)
+	}
+
+	// The KV version 2 secrets engine nests the secret in a second data
+	// object, along with its metadata.
+	var payload struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, stacktrace.Propagate(err, "Error decoding Vault response")
+	}
+	var kv2 struct {
+		Data     *secretFields   `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(payload.Data, &kv2); err == nil && kv2.Data != nil && kv2.Metadata != nil {
+		return kv2.Data.secret()
+	}
+	fields := &secretFields{}
+	if err := json.Unmarshal(payload.Data, fields); err != nil {
+		return nil, stacktrace.Propagate(err, "Error decoding Vault secret %s", v.Path)
+	}
+	return fields.secret()
+}
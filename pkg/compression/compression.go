@@ -0,0 +1,92 @@
+// Package compression compresses the responses of the DSS, such as the
+// results of searches in dense areas which regularly exceed hundreds of
+// kilobytes, with gzip or deflate as negotiated with the clients.
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// Supported encodings, named as in the Content-Encoding and grpc-encoding
+// headers. Deflate is the zlib format, as both HTTP and gRPC define it.
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// Negotiate returns the supported encoding preferred by the client sending
+// acceptEncoding, the value of an Accept-Encoding header, or an empty string
+// if it accepts none. Gzip is preferred over Deflate at equal quality.
+func Negotiate(acceptEncoding string) string {
+	var (
+		best    string
+		bestQ   float64
+		qualify = map[string]float64{}
+	)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[len("q="):], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		qualify[name] = q
+	}
+	for _, encoding := range []string{Gzip, Deflate} {
+		q, ok := qualify[encoding]
+		if !ok {
+			q, ok = qualify["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// newWriter returns a writer compressing to w with encoding.
+func newWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Deflate:
+		return zlib.NewWriter(w), nil
+	}
+	return nil, stacktrace.NewError("Unsupported encoding %s", encoding)
+}
+
+// newReader returns a reader decompressing r with encoding.
+func newReader(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Deflate:
+		return zlib.NewReader(r)
+	}
+	return nil, stacktrace.NewError("Unsupported encoding %s", encoding)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,97 @@
+package compression
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	require.Equal(t, Gzip, Negotiate("gzip, deflate, br"))
+	require.Equal(t, Deflate, Negotiate("gzip;q=0.5, deflate"))
+	require.Equal(t, Deflate, Negotiate("deflate, gzip;q=0"))
+	require.Equal(t, Gzip, Negotiate("*"))
+	require.Equal(t, Deflate, Negotiate("*;q=0.1, deflate;q=0.2"))
+	require.Empty(t, Negotiate("br"))
+	require.Empty(t, Negotiate(""))
+}
+
+func TestHandler(t *testing.T) {
+	var (
+		large    = strings.Repeat(`{"id": "4348c8e5-0b1c-43cf-9114-2e67a4532765"},`, 1000)
+		recorder = summary.NewRecorder(clockwork.NewFakeClock())
+	)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if r.URL.Path == "/large" {
+			// Written in pieces, as the gateway may.
+			for i := 0; i < len(large); i += 1000 {
+				end := i + 1000
+				if end > len(large) {
+					end = len(large)
+				}
+				_, _ = w.Write([]byte(large[i:end]))
+			}
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}), 4096, recorder)
+
+	for _, encoding := range []string{Gzip, Deflate} {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Equal(t, encoding, resp.Header().Get("Content-Encoding"))
+		require.Less(t, resp.Body.Len(), len(large))
+		r, err := newReader(encoding, bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, large, string(body))
+	}
+
+	// Small responses, and the ones of clients not accepting compression, are
+	// sent as is.
+	for _, c := range []struct{ path, accept string }{{"/small", "gzip"}, {"/large", ""}} {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set("Accept-Encoding", c.accept)
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Empty(t, resp.Header().Get("Content-Encoding"))
+		require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	}
+
+	s := recorder.Rotate()
+	require.Equal(t, int64(1), s.Compression[Gzip].Responses)
+	require.Equal(t, int64(len(large)), s.Compression[Gzip].RawBytes)
+	require.Equal(t, int64(1), s.Compression[Deflate].Responses)
+}
+
+func TestGRPCCompressor(t *testing.T) {
+	recorder := summary.NewRecorder(clockwork.NewFakeClock())
+	c := &grpcCompressor{name: Gzip, recorder: recorder}
+	var buf bytes.Buffer
+	w, err := c.Compress(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("message"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := c.Decompress(&buf)
+	require.NoError(t, err)
+	msg, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "message", string(msg))
+	require.Equal(t, int64(7), recorder.Rotate().Compression[Gzip].RawBytes)
+}
@@ -0,0 +1,64 @@
+package compression
+
+import (
+	"io"
+
+	"github.com/interuss/dss/pkg/summary"
+	"google.golang.org/grpc/encoding"
+)
+
+// RegisterGRPC registers the gzip and deflate compressors with gRPC, so that
+// servers decompress the requests of the clients compressing theirs and
+// compress their responses in turn, recording them to recorder. gRPC
+// compresses every message of such calls, whatever its size.
+func RegisterGRPC(recorder *summary.Recorder) {
+	encoding.RegisterCompressor(&grpcCompressor{name: Gzip, recorder: recorder})
+	encoding.RegisterCompressor(&grpcCompressor{name: Deflate, recorder: recorder})
+}
+
+// grpcCompressor is an encoding.Compressor recording the messages it
+// compresses.
+type grpcCompressor struct {
+	name     string
+	recorder *summary.Recorder
+}
+
+func (c *grpcCompressor) Name() string {
+	return c.name
+}
+
+func (c *grpcCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	out := &countingWriter{w: w}
+	zw, err := newWriter(c.name, out)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingWriter{zw: zw, out: out, compressor: c}, nil
+}
+
+func (c *grpcCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return newReader(c.name, r)
+}
+
+// recordingWriter records the sizes of a message before and after its
+// compression once it is closed.
+type recordingWriter struct {
+	zw         io.WriteCloser
+	out        *countingWriter
+	raw        int64
+	compressor *grpcCompressor
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.zw.Write(p)
+	w.raw += int64(n)
+	return n, err
+}
+
+func (w *recordingWriter) Close() error {
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	w.compressor.recorder.RecordCompression(w.compressor.name, w.raw, w.out.n)
+	return nil
+}
@@ -0,0 +1,147 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/interuss/dss/pkg/summary"
+)
+
+// Handler returns a handler compressing the responses of next of at least
+// threshold bytes with the encoding negotiated through the Accept-Encoding
+// header of their request, recording them to recorder. Smaller responses are
+// sent as is, since compressing them saves less than it costs.
+func Handler(next http.Handler, threshold int, recorder *summary.Recorder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &responseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			threshold:      threshold,
+			recorder:       recorder,
+			status:         http.StatusOK,
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// responseWriter buffers a response until it reaches the threshold, from
+// which it is compressed, or until it ends, in which case it is sent as is.
+type responseWriter struct {
+	http.ResponseWriter
+	encoding  string
+	threshold int
+	recorder  *summary.Recorder
+
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	// decided is set once the response is being sent, compressed through zw
+	// if it is set.
+	decided bool
+	zw      io.WriteCloser
+	out     *countingWriter
+	raw     int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if !w.decided {
+		if w.buf.Len()+len(p) < w.threshold {
+			return w.buf.Write(p)
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	n, err := w.zw.Write(p)
+	w.raw += int64(n)
+	return n, err
+}
+
+// Flush sends the response so far, uncompressed if it has not reached the
+// threshold yet.
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+	if f, ok := w.zw.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide sends the header and the buffered response, compressing the rest
+// of the response if compress and the response is not already encoded.
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress && h.Get("Content-Encoding") == "" && bodyAllowed(w.status) {
+		w.out = &countingWriter{w: w.ResponseWriter}
+		zw, err := newWriter(w.encoding, w.out)
+		if err != nil {
+			return err
+		}
+		w.zw = zw
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	buffered := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if w.zw == nil {
+		_, err := w.ResponseWriter.Write(buffered)
+		return err
+	}
+	n, err := w.zw.Write(buffered)
+	w.raw += int64(n)
+	return err
+}
+
+// close ends the response.
+func (w *responseWriter) close() {
+	if !w.decided {
+		if !w.wroteHeader {
+			// The handler wrote nothing; let the server send its default
+			// response.
+			return
+		}
+		_ = w.decide(false)
+		return
+	}
+	if w.zw == nil {
+		return
+	}
+	if err := w.zw.Close(); err == nil {
+		w.recorder.RecordCompression(w.encoding, w.raw, w.out.n)
+	}
+}
+
+// bodyAllowed returns true if responses with status have a body.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,139 @@
+// Package deprecation signals the deprecation of API methods to their
+// callers with the Deprecation (RFC 9745), Sunset (RFC 8594) and Link
+// response headers, so that API versions can be retired across the pool in
+// a managed way.
+package deprecation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Names of the response headers signaling deprecation. They are set as gRPC
+// header metadata, in lower case, and forwarded as is by the HTTP gateway.
+const (
+	DeprecationHeader = "deprecation"
+	SunsetHeader      = "sunset"
+	LinkHeader        = "link"
+)
+
+// Headers lists the names of the response headers signaling deprecation.
+var Headers = []string{DeprecationHeader, SunsetHeader, LinkHeader}
+
+// Deprecation marks the API methods whose full gRPC name starts with Method
+// as deprecated, e.g. "/ridpb.DiscoveryAndSynchronizationService/SearchISAs"
+// for a single endpoint or "/ridpb." for a whole API version.
+type Deprecation struct {
+	Method string `json:"method"`
+	// Deprecation is the time at which the methods were or will be
+	// deprecated.
+	Deprecation time.Time `json:"deprecation"`
+	// Sunset is the time after which the methods are expected to be
+	// removed, if known.
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// Link is the URL of documentation about the deprecation, if any.
+	Link string `json:"link,omitempty"`
+}
+
+// Metadata returns the response headers signaling d.
+func (d *Deprecation) Metadata() metadata.MD {
+	md := metadata.Pairs(DeprecationHeader, fmt.Sprintf("@%d", d.Deprecation.Unix()))
+	if d.Sunset != nil {
+		md.Set(SunsetHeader, d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		md.Set(LinkHeader, fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+	}
+	return md
+}
+
+// Deprecations looks up the Deprecation applying to API methods.
+type Deprecations struct {
+	deprecations []*Deprecation
+}
+
+// New returns a Deprecations applying deprecations.
+func New(deprecations []*Deprecation) (*Deprecations, error) {
+	methods := map[string]bool{}
+	for _, d := range deprecations {
+		if !strings.HasPrefix(d.Method, "/") {
+			return nil, stacktrace.NewError("Deprecated method %q must be a full gRPC method name or a prefix of one", d.Method)
+		}
+		if methods[d.Method] {
+			return nil, stacktrace.NewError("Duplicate deprecation of %s", d.Method)
+		}
+		methods[d.Method] = true
+		if d.Deprecation.IsZero() {
+			return nil, stacktrace.NewError("Missing deprecation time of %s", d.Method)
+		}
+		if d.Sunset != nil && d.Sunset.Before(d.Deprecation) {
+			return nil, stacktrace.NewError("Sunset of %s precedes its deprecation", d.Method)
+		}
+	}
+	return &Deprecations{deprecations: deprecations}, nil
+}
+
+// Load returns a Deprecations applying the deprecations listed as a JSON
+// array of Deprecation in the file at path.
+func Load(path string) (*Deprecations, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading deprecations from %s", path)
+	}
+	var deprecations []*Deprecation
+	if err := json.Unmarshal(bytes, &deprecations); err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing deprecations from %s", path)
+	}
+	return New(deprecations)
+}
+
+// Lookup returns the Deprecation applying to the API method fullMethod, the
+// one with the longest Method if several apply, or nil if it is not
+// deprecated.
+func (d *Deprecations) Lookup(fullMethod string) *Deprecation {
+	var result *Deprecation
+	for _, dep := range d.deprecations {
+		if strings.HasPrefix(fullMethod, dep.Method) && (result == nil || len(dep.Method) > len(result.Method)) {
+			result = dep
+		}
+	}
+	return result
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor that sets the headers
+// signaling the deprecation of the methods deprecated by d on their responses
+// and records their calls to r.
+func Interceptor(d *Deprecations, r *summary.Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		dep := d.Lookup(info.FullMethod)
+		if dep == nil {
+			return handler(ctx, req)
+		}
+		if err := grpc.SetHeader(ctx, dep.Metadata()); err != nil {
+			logging.WithValuesFromContext(ctx, logging.Logger).Warn(
+				"Error setting deprecation headers", zap.String("method", info.FullMethod), zap.Error(err))
+		}
+
+		resp, err := handler(ctx, req)
+
+		var manager string
+		if caller, ok := grpc_ctxtags.Extract(ctx).Values()[logging.CallerTag]; ok {
+			manager = fmt.Sprint(caller)
+		}
+		r.RecordDeprecatedCall(info.FullMethod, manager)
+		return resp, err
+	}
+}
@@ -0,0 +1,46 @@
+package deprecation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	var (
+		deprecated = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		sunset     = time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	)
+	d, err := New([]*Deprecation{
+		{Method: "/ridpb.", Deprecation: deprecated},
+		{Method: "/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions", Deprecation: deprecated, Sunset: &sunset, Link: "https://example.com/rid-v2"},
+	})
+	require.NoError(t, err)
+
+	require.Nil(t, d.Lookup("/scdpb.UTMAPIUSSDSSAndUSSUSSService/SearchConstraintReferences"))
+	require.Equal(t, "/ridpb.", d.Lookup("/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas").Method)
+
+	dep := d.Lookup("/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions")
+	require.NotNil(t, dep)
+	md := dep.Metadata()
+	require.Equal(t, []string{"@1622505600"}, md.Get(DeprecationHeader))
+	require.Equal(t, []string{"Wed, 01 Dec 2021 00:00:00 GMT"}, md.Get(SunsetHeader))
+	require.Equal(t, []string{`<https://example.com/rid-v2>; rel="deprecation"`}, md.Get(LinkHeader))
+}
+
+func TestNewRejectsInvalidDeprecations(t *testing.T) {
+	var (
+		deprecated = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		sunset     = deprecated.Add(-time.Hour)
+	)
+	for _, deprecations := range [][]*Deprecation{
+		{{Method: "ridpb.", Deprecation: deprecated}},
+		{{Method: "/ridpb."}},
+		{{Method: "/ridpb.", Deprecation: deprecated, Sunset: &sunset}},
+		{{Method: "/ridpb.", Deprecation: deprecated}, {Method: "/ridpb.", Deprecation: deprecated}},
+	} {
+		_, err := New(deprecations)
+		require.Error(t, err)
+	}
+}
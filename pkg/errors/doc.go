@@ -15,6 +15,12 @@
 // level calling functions can always override this code if appropriate.  The
 // recognized codes are enumerated in errors.go of this package.
 //
+// Every code has a stable machine-readable reason, served in the
+// errdetails.ErrorInfo detail of errors, and a human-readable message in
+// each language of the catalog in messages.go.  Messages of errors are
+// written in English; clients accepting another language of the catalog
+// with Accept-Language get the message of the code in it instead.
+//
 // Just before an error is ultimately returned by a request handler, the
 // interceptor in errors.go logs the full details of the error and then
 // replaces it with a simple error containing an ID that may be used to look up
@@ -7,10 +7,13 @@ import (
 
 	"github.com/golang/protobuf/ptypes/any"
 	"github.com/google/uuid"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"github.com/interuss/dss/pkg/api/v1/auxpb"
 	"github.com/interuss/dss/pkg/logging"
 	"github.com/interuss/stacktrace"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -28,6 +31,11 @@ const (
 	// be returned rather than the standard error response.
 	MissingOVNs stacktrace.ErrorCode = stacktrace.ErrorCode(19)
 
+	// InvalidID is used when a client creates a resource with a UUID not in
+	// the format required by the deployment, e.g. of another version.  The
+	// http gateway returns 400 for it.
+	InvalidID stacktrace.ErrorCode = stacktrace.ErrorCode(20)
+
 	// AlreadyExists is used when attempting to create a resource that already
 	// exists.
 	AlreadyExists stacktrace.ErrorCode = stacktrace.ErrorCode(uint16(codes.AlreadyExists))
@@ -51,8 +59,50 @@ const (
 
 	// Unauthenticated is used when an OAuth token is invalid or not supplied.
 	Unauthenticated stacktrace.ErrorCode = stacktrace.ErrorCode(uint16(codes.Unauthenticated))
+
+	// Unavailable is used when a request could not be served due to transient
+	// conditions, e.g. persistent contention in the database.
+	Unavailable stacktrace.ErrorCode = stacktrace.ErrorCode(uint16(codes.Unavailable))
+
+	// DeadlineExceeded is used when a database operation did not complete
+	// within the time allotted to it.
+	DeadlineExceeded stacktrace.ErrorCode = stacktrace.ErrorCode(uint16(codes.DeadlineExceeded))
+
+	// Internal is used for the failures of the DSS itself, such as panics,
+	// whose details are only logged.
+	Internal stacktrace.ErrorCode = stacktrace.ErrorCode(uint16(codes.Internal))
 )
 
+// ErrorDomain is the domain of the errdetails.ErrorInfo details of the
+// errors returned by the DSS.
+const ErrorDomain = "github.com/interuss/dss"
+
+// reasons are the errdetails.ErrorInfo reasons of the error codes, which
+// otherwise default to the name of their gRPC code.
+var reasons = map[stacktrace.ErrorCode]string{
+	AreaTooLarge:     "AREA_TOO_LARGE",
+	MissingOVNs:      "MISSING_OVNS",
+	InvalidID:        "INVALID_ID",
+	AlreadyExists:    "ALREADY_EXISTS",
+	BadRequest:       "BAD_REQUEST",
+	VersionMismatch:  "VERSION_MISMATCH",
+	NotFound:         "NOT_FOUND",
+	PermissionDenied: "PERMISSION_DENIED",
+	Exhausted:        "EXHAUSTED",
+	Unauthenticated:  "UNAUTHENTICATED",
+	Unavailable:      "UNAVAILABLE",
+	DeadlineExceeded: "DEADLINE_EXCEEDED",
+	Internal:         "INTERNAL",
+}
+
+// Reason returns the errdetails.ErrorInfo reason of code.
+func Reason(code stacktrace.ErrorCode) string {
+	if reason, ok := reasons[code]; ok {
+		return reason
+	}
+	return codes.Code(uint16(code)).String()
+}
+
 func init() {
 	if _, ok := os.LookupEnv("DSS_ERRORS_OBFUSCATE_INTERNAL_ERRORS"); ok {
 		logging.Logger.Warn("DSS_ERRORS_OBFUSCATE_INTERNAL_ERRORS has been deprecated and will be removed in a future version")
@@ -67,89 +117,195 @@ func MakeErrID() string {
 	return fmt.Sprintf("E:<error ID could not be constructed: %s>", err)
 }
 
-// MakeStatusProto adds the content of a proto as a detail to a Status proto
-// consisting of the provided code and message.
-func MakeStatusProto(code codes.Code, message string, detail proto.Message) (*spb.Status, error) {
-	serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(detail)
-	if err != nil {
-		return nil, stacktrace.Propagate(err, "Error serializing detail proto")
-	}
-
+// MakeStatusProto adds the content of protos as details to a Status proto
+// consisting of the provided code and message. The first detail is the
+// response body of the HTTP gateway.
+func MakeStatusProto(code codes.Code, message string, details ...proto.Message) (*spb.Status, error) {
 	p := &spb.Status{
 		Code:    int32(code),
 		Message: message,
-		Details: []*any.Any{
-			{
-				TypeUrl: "github.com/interuss/dss/" + string(detail.ProtoReflect().Descriptor().FullName()),
-				Value:   serialized,
-			},
-		},
+	}
+	if err := appendDetails(p, details...); err != nil {
+		return nil, err
 	}
 	return p, nil
 }
 
+// appendDetails adds the content of protos as details to p.
+func appendDetails(p *spb.Status, details ...proto.Message) error {
+	for _, detail := range details {
+		serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(detail)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error serializing detail proto")
+		}
+		p.Details = append(p.Details, &any.Any{
+			TypeUrl: "github.com/interuss/dss/" + string(detail.ProtoReflect().Descriptor().FullName()),
+			Value:   serialized,
+		})
+	}
+	return nil
+}
+
 // Interceptor returns a grpc.UnaryServerInterceptor that inspects outgoing
 // errors and logs (to "logger") and replaces errors that are not *status.Status
-// instances or status instances that indicate an internal/unknown error.
+// instances or status instances that indicate an internal/unknown error. The
+// logs of the errors include the identity of the caller, if it was
+// authenticated further down the chain. Panics further down the chain are
+// recovered and answered as Internal errors.
 func Interceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		resp, err := handler(ctx, req)
+		ctx = withTags(ctx)
+		resp, err := func() (resp interface{}, err error) {
+			defer RecoverPanic(&err)
+			return handler(ctx, req)
+		}()
 
 		if err == nil {
 			return resp, nil
 		}
+		return resp, toStatus(ctx, logger, "unary", info.FullMethod, err)
+	}
+}
 
-		errID := MakeErrID()
-
-		// Separate the root cause and code from the stacktrace wrapping.
-		trace := err.Error()
-		rootErr := stacktrace.RootCause(err)
-		code := stacktrace.GetCode(err)
-
-		statusErr, ok := status.FromError(rootErr)
-		if ok {
-			// The root cause is a Status error; return it exactly as-is.
-			logger.Error(
-				fmt.Sprintf("Status error %s during unary server call", errID),
-				zap.String("method", info.FullMethod),
-				zap.String("stacktrace", trace),
-				zap.String("grpc_code", statusErr.Code().String()),
-				zap.Error(rootErr))
-			return resp, rootErr
+// StreamInterceptor returns a grpc.StreamServerInterceptor replacing the
+// errors ending streams like Interceptor does for unary calls.
+func StreamInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = withTags(ss.Context())
+		err := func() (err error) {
+			defer RecoverPanic(&err)
+			return handler(srv, wrapped)
+		}()
+		if err != nil {
+			return toStatus(wrapped.WrappedContext, logger, "stream", info.FullMethod, err)
 		}
+		return nil
+	}
+}
+
+// withTags returns ctx with grpc_ctxtags tags, through which the identity
+// of the caller recorded by the authentication interceptor is found once the
+// call returns.
+func withTags(ctx context.Context) context.Context {
+	if grpc_ctxtags.Extract(ctx) != grpc_ctxtags.NoopTags {
+		return ctx
+	}
+	return grpc_ctxtags.SetInContext(ctx, grpc_ctxtags.NewTags())
+}
+
+// localized returns the message of code in language along with the
+// errdetails.LocalizedMessage detail holding it, or message and no detail if
+// language is DefaultLanguage, in which messages are served as they are.
+func localized(code stacktrace.ErrorCode, language string, message string) (string, []proto.Message) {
+	if language == DefaultLanguage {
+		return message, nil
+	}
+	message = Message(code, language)
+	return message, []proto.Message{&errdetails.LocalizedMessage{Locale: language, Message: message}}
+}
+
+// toStatus logs err, returned by a call of kind to method with ctx, and
+// returns the status error to send to the client in its place. Requests
+// accepting another language of the catalog than DefaultLanguage get the
+// message of the code of err in it, in the message of the
+// StandardErrorResponse and in an errdetails.LocalizedMessage detail.
+func toStatus(ctx context.Context, logger *zap.Logger, kind string, method string, err error) error {
+	errID := MakeErrID()
+	language := languageFromContext(ctx)
+	logger = logger.With(zap.String("error_id", errID))
+	if identity, ok := logging.IdentityFromContext(ctx); ok {
+		logger = logger.With(zap.Object("caller", identity))
+	}
+
+	// Separate the root cause and code from the stacktrace wrapping.
+	trace := err.Error()
+	rootErr := stacktrace.RootCause(err)
+	code := stacktrace.GetCode(err)
+
+	if p, ok := asPanic(err); ok {
+		// The panic value may hold anything; clients only get the error ID.
+		logger.Error(
+			fmt.Sprintf("Panic %s during %s server call", errID, kind),
+			zap.String("method", method),
+			zap.String("stacktrace", trace),
+			zap.String("panic_stack", string(p.Stack)),
+			zap.Error(p))
+		message := fmt.Sprintf("Internal server error %s", errID)
+		localizedMessage, localizedDetails := localized(Internal, language, message)
+		details := append([]proto.Message{&auxpb.StandardErrorResponse{
+			Error:   message,
+			Code:    int32(Internal),
+			Message: localizedMessage,
+			ErrorId: errID,
+		}, &errdetails.ErrorInfo{
+			Reason: Reason(Internal),
+			Domain: ErrorDomain,
+		}}, localizedDetails...)
+		sp, constructionErr := MakeStatusProto(codes.Internal, message, append(details, &errdetails.RequestInfo{RequestId: errID})...)
+		if constructionErr != nil {
+			return status.Error(codes.Internal, message)
+		}
+		return status.ErrorProto(sp)
+	}
 
-		if code != stacktrace.NoCode {
-			logger.Error(
-				fmt.Sprintf("Error %s during unary server call", errID),
-				zap.String("method", info.FullMethod),
-				zap.String("stacktrace", trace),
-				zap.String("grpc_code", codes.Code(uint16(code)).String()),
-				zap.Int("code", int(code)),
-				zap.Error(rootErr))
-			p, constructionErr := MakeStatusProto(codes.Code(uint16(code)), rootErr.Error(), &auxpb.StandardErrorResponse{
-				Error:   rootErr.Error(),
-				Code:    int32(code),
-				Message: rootErr.Error(),
-				ErrorId: errID,
-			})
-			if constructionErr == nil {
-				err = status.ErrorProto(p)
-			} else {
-				constructionErrID := MakeErrID()
-				logger.Error(
-					fmt.Sprintf("Error %s constructing StandardErrorResponse from %s", constructionErrID, errID),
-					zap.Error(constructionErr))
-				err = status.Error(codes.Internal, fmt.Sprintf("Internal server error %s", constructionErrID))
-			}
-		} else {
-			logger.Error(
-				fmt.Sprintf("Uncoded error %s during unary server call", errID),
-				zap.String("method", info.FullMethod),
-				zap.String("stacktrace", trace),
-				zap.Error(rootErr))
-			err = status.Error(codes.Internal, fmt.Sprintf("Internal server error %s", errID))
+	statusErr, ok := status.FromError(rootErr)
+	if ok {
+		// The root cause is a Status error; return it as-is, only adding the
+		// error ID to its details.
+		logger.Error(
+			fmt.Sprintf("Status error %s during %s server call", errID, kind),
+			zap.String("method", method),
+			zap.String("stacktrace", trace),
+			zap.String("grpc_code", statusErr.Code().String()),
+			zap.Error(rootErr))
+		p := statusErr.Proto()
+		_, localizedDetails := localized(stacktrace.ErrorCode(uint16(statusErr.Code())), language, "")
+		if err := appendDetails(p, append(localizedDetails, &errdetails.RequestInfo{RequestId: errID})...); err != nil {
+			logger.Warn("Failed to add error ID to status", zap.String("error_id", errID), zap.Error(err))
+			return rootErr
 		}
+		return status.ErrorProto(p)
+	}
+
+	if code != stacktrace.NoCode {
+		logger.Error(
+			fmt.Sprintf("Error %s during %s server call", errID, kind),
+			zap.String("method", method),
+			zap.String("stacktrace", trace),
+			zap.String("grpc_code", codes.Code(uint16(code)).String()),
+			zap.Int("code", int(code)),
+			zap.Error(rootErr))
+		localizedMessage, localizedDetails := localized(code, language, rootErr.Error())
+		details := append([]proto.Message{&auxpb.StandardErrorResponse{
+			Error:   rootErr.Error(),
+			Code:    int32(code),
+			Message: localizedMessage,
+			ErrorId: errID,
+		}, &errdetails.ErrorInfo{
+			Reason: Reason(code),
+			Domain: ErrorDomain,
+		}}, localizedDetails...)
+		p, constructionErr := MakeStatusProto(codes.Code(uint16(code)), rootErr.Error(), append(details, &errdetails.RequestInfo{RequestId: errID})...)
+		if constructionErr == nil {
+			return status.ErrorProto(p)
+		}
+		constructionErrID := MakeErrID()
+		logger.Error(
+			fmt.Sprintf("Error %s constructing StandardErrorResponse from %s", constructionErrID, errID),
+			zap.Error(constructionErr))
+		return status.Error(codes.Internal, fmt.Sprintf("Internal server error %s", constructionErrID))
+	}
 
-		return resp, err
+	logger.Error(
+		fmt.Sprintf("Uncoded error %s during %s server call", errID, kind),
+		zap.String("method", method),
+		zap.String("stacktrace", trace),
+		zap.Error(rootErr))
+	_, localizedDetails := localized(Internal, language, "")
+	p, constructionErr := MakeStatusProto(codes.Internal, fmt.Sprintf("Internal server error %s", errID), append(localizedDetails, &errdetails.RequestInfo{RequestId: errID})...)
+	if constructionErr != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("Internal server error %s", errID))
 	}
+	return status.ErrorProto(p)
 }
@@ -1,14 +1,133 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/interuss/dss/pkg/api/v1/auxpb"
+	"github.com/interuss/dss/pkg/logging"
 	"github.com/interuss/stacktrace"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestStacktraceUnwrap(t *testing.T) {
 	cause := errors.New("test")
 	assert.Equal(t, cause, errors.Unwrap(stacktrace.Propagate(cause, "test")))
 }
+
+func TestInterceptorDetails(t *testing.T) {
+	interceptor := Interceptor(zap.NewNop())
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	call := func(err error) *status.Status {
+		_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+		s, ok := status.FromError(err)
+		require.True(t, ok)
+		return s
+	}
+
+	s := call(stacktrace.Propagate(stacktrace.NewErrorWithCode(VersionMismatch, "stale"), "context"))
+	require.Equal(t, codes.Aborted, s.Code())
+	details := s.Details()
+	require.Len(t, details, 3)
+	response, ok := details[0].(*auxpb.StandardErrorResponse)
+	require.True(t, ok)
+	require.Equal(t, "VERSION_MISMATCH", details[1].(*errdetails.ErrorInfo).Reason)
+	require.Equal(t, ErrorDomain, details[1].(*errdetails.ErrorInfo).Domain)
+	require.Equal(t, response.ErrorId, details[2].(*errdetails.RequestInfo).RequestId)
+
+	// Status errors keep their details, the error ID coming last.
+	p, err := MakeStatusProto(codes.Code(uint16(MissingOVNs)), "missing", &errdetails.ErrorInfo{Reason: "MISSING_OVNS"})
+	require.NoError(t, err)
+	s = call(stacktrace.Propagate(status.ErrorProto(p), "context"))
+	details = s.Details()
+	require.Len(t, details, 2)
+	require.Equal(t, "MISSING_OVNS", details[0].(*errdetails.ErrorInfo).Reason)
+	require.NotEmpty(t, details[1].(*errdetails.RequestInfo).RequestId)
+
+	s = call(errors.New("uncoded"))
+	require.Equal(t, codes.Internal, s.Code())
+	require.Contains(t, s.Message(), s.Details()[0].(*errdetails.RequestInfo).RequestId)
+}
+
+func TestInterceptorLocalizesMessages(t *testing.T) {
+	interceptor := Interceptor(zap.NewNop())
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("grpcgateway-accept-language", "fr-CH, en;q=0.5"))
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, stacktrace.NewErrorWithCode(NotFound, "Subscription 42 not found")
+	})
+	s, ok := status.FromError(err)
+	require.True(t, ok)
+	details := s.Details()
+	require.Len(t, details, 4)
+	response := details[0].(*auxpb.StandardErrorResponse)
+	require.Equal(t, "Subscription 42 not found", response.Error)
+	require.Equal(t, "L'entité n'existe pas", response.Message)
+	require.Equal(t, "NOT_FOUND", details[1].(*errdetails.ErrorInfo).Reason)
+	require.Equal(t, "fr", details[2].(*errdetails.LocalizedMessage).Locale)
+	require.Equal(t, response.ErrorId, details[3].(*errdetails.RequestInfo).RequestId)
+}
+
+func TestInterceptorLogsCallerIdentity(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	interceptor := Interceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	identity := &logging.Identity{Subject: "uss1", Issuer: "https://auth.example.com", ClientID: "dashboard", Scopes: []string{"one"}}
+
+	// The identity is recorded by an interceptor further down the chain, on
+	// a context the error interceptor does not see.
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		logging.ContextWithIdentity(ctx, identity)
+		return nil, errors.New("uncoded")
+	})
+	s, ok := status.FromError(err)
+	require.True(t, ok)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, s.Details()[0].(*errdetails.RequestInfo).RequestId, fields["error_id"])
+	caller, ok := fields["caller"].(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, "uss1", caller["sub"])
+	require.Equal(t, "https://auth.example.com", caller["iss"])
+	require.Equal(t, "dashboard", caller["client_id"])
+}
+
+func TestInterceptorRecoversPanics(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	interceptor := Interceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("secret state")
+	})
+	s, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.Internal, s.Code())
+	require.NotContains(t, s.Message(), "secret state")
+	details := s.Details()
+	require.Len(t, details, 3)
+	response, ok := details[0].(*auxpb.StandardErrorResponse)
+	require.True(t, ok)
+	require.Contains(t, s.Message(), response.ErrorId)
+	require.Equal(t, "INTERNAL", details[1].(*errdetails.ErrorInfo).Reason)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, response.ErrorId, fields["error_id"])
+	require.Contains(t, fields["panic_stack"], "TestInterceptorRecoversPanics")
+}
@@ -0,0 +1,157 @@
+package errors
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultLanguage is the language of the messages of errors, in which they
+// are written throughout the DSS, and of the messages of the codes served
+// when no other language of the catalog is accepted.
+const DefaultLanguage = "en"
+
+// acceptLanguageKeys are the metadata keys carrying the Accept-Language
+// header of requests: as forwarded by the HTTP gateway, and as sent by gRPC
+// clients.
+var acceptLanguageKeys = []string{"grpcgateway-accept-language", "accept-language"}
+
+// messages are the human-readable messages of the error codes, which are
+// stable along with their reasons, by language.  The messages of errors
+// themselves are only written in DefaultLanguage; in other languages, the
+// message of their code is served instead.
+var messages = map[string]map[stacktrace.ErrorCode]string{
+	DefaultLanguage: {
+		AreaTooLarge:     "The area of the request is too large",
+		MissingOVNs:      "The key of the request is missing the OVNs of conflicting entities",
+		InvalidID:        "The ID is not in the format required by this DSS",
+		AlreadyExists:    "The entity already exists",
+		BadRequest:       "The request is invalid",
+		VersionMismatch:  "The entity was changed since the version provided",
+		NotFound:         "The entity does not exist",
+		PermissionDenied: "The client is not allowed to perform this request",
+		Exhausted:        "The client has too many entities in this area",
+		Unauthenticated:  "The access token is missing or invalid",
+		Unavailable:      "The DSS is temporarily unavailable; retry later",
+		DeadlineExceeded: "The request did not complete in time",
+		Internal:         "Internal server error",
+	},
+	"de": {
+		AreaTooLarge:     "Das Gebiet der Anfrage ist zu groß",
+		MissingOVNs:      "Dem Schlüssel der Anfrage fehlen die OVNs kollidierender Einträge",
+		InvalidID:        "Die ID hat nicht das von diesem DSS verlangte Format",
+		AlreadyExists:    "Der Eintrag existiert bereits",
+		BadRequest:       "Die Anfrage ist ungültig",
+		VersionMismatch:  "Der Eintrag wurde seit der angegebenen Version geändert",
+		NotFound:         "Der Eintrag existiert nicht",
+		PermissionDenied: "Der Client ist zu dieser Anfrage nicht berechtigt",
+		Exhausted:        "Der Client hat zu viele Einträge in diesem Gebiet",
+		Unauthenticated:  "Das Zugriffstoken fehlt oder ist ungültig",
+		Unavailable:      "Der DSS ist vorübergehend nicht verfügbar; später erneut versuchen",
+		DeadlineExceeded: "Die Anfrage wurde nicht rechtzeitig abgeschlossen",
+		Internal:         "Interner Serverfehler",
+	},
+	"es": {
+		AreaTooLarge:     "El área de la solicitud es demasiado grande",
+		MissingOVNs:      "A la clave de la solicitud le faltan los OVN de entidades en conflicto",
+		InvalidID:        "El ID no tiene el formato requerido por este DSS",
+		AlreadyExists:    "La entidad ya existe",
+		BadRequest:       "La solicitud no es válida",
+		VersionMismatch:  "La entidad cambió desde la versión proporcionada",
+		NotFound:         "La entidad no existe",
+		PermissionDenied: "El cliente no está autorizado a realizar esta solicitud",
+		Exhausted:        "El cliente tiene demasiadas entidades en esta área",
+		Unauthenticated:  "El token de acceso falta o no es válido",
+		Unavailable:      "El DSS no está disponible temporalmente; vuelva a intentarlo más tarde",
+		DeadlineExceeded: "La solicitud no se completó a tiempo",
+		Internal:         "Error interno del servidor",
+	},
+	"fr": {
+		AreaTooLarge:     "La zone de la requête est trop grande",
+		MissingOVNs:      "Il manque à la clé de la requête les OVN d'entités en conflit",
+		InvalidID:        "L'ID n'est pas au format requis par ce DSS",
+		AlreadyExists:    "L'entité existe déjà",
+		BadRequest:       "La requête est invalide",
+		VersionMismatch:  "L'entité a changé depuis la version fournie",
+		NotFound:         "L'entité n'existe pas",
+		PermissionDenied: "Le client n'est pas autorisé à effectuer cette requête",
+		Exhausted:        "Le client a trop d'entités dans cette zone",
+		Unauthenticated:  "Le jeton d'accès est absent ou invalide",
+		Unavailable:      "Le DSS est temporairement indisponible ; réessayez plus tard",
+		DeadlineExceeded: "La requête n'a pas abouti à temps",
+		Internal:         "Erreur interne du serveur",
+	},
+}
+
+// Message returns the message of code in language, a language of the
+// catalog, falling back to DefaultLanguage and then to the reason of code.
+func Message(code stacktrace.ErrorCode, language string) string {
+	if message, ok := messages[language][code]; ok {
+		return message
+	}
+	if message, ok := messages[DefaultLanguage][code]; ok {
+		return message
+	}
+	return Reason(code)
+}
+
+// NegotiateLanguage returns the language of the catalog most preferred by
+// acceptLanguage, the value of an Accept-Language header, matching its
+// ranges by their primary subtag if needed, or DefaultLanguage if it accepts
+// none of them.
+func NegotiateLanguage(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		r := weighted{tag: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		if r.tag != "" && r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return DefaultLanguage
+		}
+		if _, ok := messages[r.tag]; ok {
+			return r.tag
+		}
+		if i := strings.Index(r.tag, "-"); i > 0 {
+			if _, ok := messages[r.tag[:i]]; ok {
+				return r.tag[:i]
+			}
+		}
+	}
+	return DefaultLanguage
+}
+
+// languageFromContext returns the language of the catalog negotiated with
+// the Accept-Language header of the incoming request of ctx.
+func languageFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return DefaultLanguage
+	}
+	for _, key := range acceptLanguageKeys {
+		if values := md.Get(key); len(values) > 0 {
+			return NegotiateLanguage(strings.Join(values, ","))
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,37 @@
+package errors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagesCoverEveryCode(t *testing.T) {
+	for language, catalog := range messages {
+		for code := range reasons {
+			require.NotEmpty(t, catalog[code], "%s message of %s", language, Reason(code))
+		}
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	for _, test := range []struct {
+		acceptLanguage, language string
+	}{
+		{"", DefaultLanguage},
+		{"fr", "fr"},
+		{"fr-CA", "fr"},
+		{"ja, de;q=0.5", "de"},
+		{"en;q=0.4, es-MX;q=0.8", "es"},
+		{"de;q=0, fr;q=0.1", "fr"},
+		{"ja, *;q=0.5", DefaultLanguage},
+		{"ja", DefaultLanguage},
+	} {
+		require.Equal(t, test.language, NegotiateLanguage(test.acceptLanguage), test.acceptLanguage)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	require.Equal(t, "La requête est invalide", Message(BadRequest, "fr"))
+	require.Equal(t, "The request is invalid", Message(BadRequest, "ja"))
+}
@@ -0,0 +1,43 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Panic is the error a panic is turned into by RecoverPanic. It is reported
+// to clients as an Internal error identified by an error ID, like uncoded
+// errors, its value and stack being only logged.
+type Panic struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// RecoverPanic turns the panic in flight, if any, into a *Panic assigned to
+// *err, so that the panicking call fails like it would by returning an error:
+// transactions are rolled back and the client is answered. It must be
+// deferred directly, after the deferred calls relying on *err:
+//
+//	func f() (err error) {
+//		defer dsserr.RecoverPanic(&err)
+//		...
+//	}
+func RecoverPanic(err *error) {
+	if p := recover(); p != nil {
+		*err = &Panic{Value: p, Stack: debug.Stack()}
+	}
+}
+
+// asPanic returns the *Panic err wraps, if any.
+func asPanic(err error) (*Panic, bool) {
+	var p *Panic
+	ok := errors.As(err, &p)
+	return p, ok
+}
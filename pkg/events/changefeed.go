@@ -0,0 +1,168 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+const (
+	// resolvedInterval is the interval at which changefeeds report the
+	// timestamp up to which all changes have been emitted.
+	resolvedInterval = "10s"
+	// restartDelay is the delay before a failed changefeed is restarted.
+	restartDelay = 5 * time.Second
+	// leaseDuration is how long the instance publishing a changefeed remains
+	// the only one to, unless it receives a resolved timestamp.
+	leaseDuration = time.Minute
+	// claimInterval is the interval at which the instances not publishing a
+	// changefeed try to take it over.
+	claimInterval = 20 * time.Second
+)
+
+// Consumer tails a changefeed on Tables of DB, which must have rangefeeds
+// enabled (kv.rangefeed.enabled), and publishes the changes to Sink. With a
+// Ledger, only the instance of the pool holding the lease of Feed publishes
+// them, and the others take over from its last resolved timestamp once its
+// lease expires.
+type Consumer struct {
+	DB     *cockroach.DB
+	Tables []string
+	Sink   Sink
+	Logger *zap.Logger
+	// InitialScan makes the first changefeed publish the current state of
+	// every entity before their changes.
+	InitialScan bool
+
+	Ledger Ledger
+	// Feed names the changefeed in Ledger.
+	Feed string
+	// Holder identifies the instance of the pool running the Consumer.
+	Holder string
+
+	// cursor is the last resolved timestamp, from which a restarted
+	// changefeed resumes.
+	cursor string
+}
+
+// Run consumes the changefeed until ctx is done, restarting it from the last
+// resolved timestamp if it fails. Changes after the last resolved timestamp
+// may thus be published again, in particular when another instance takes
+// over the lease of Feed.
+func (c *Consumer) Run(ctx context.Context) {
+	for {
+		if c.Ledger != nil && !c.claim(ctx) {
+			return
+		}
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		c.Logger.Warn("Changefeed interrupted, restarting", zap.Strings("tables", c.Tables), zap.String("cursor", c.cursor), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// claim waits until c holds the lease of Feed, resuming from the cursor
+// recorded in Ledger, and returns false if ctx is done first.
+func (c *Consumer) claim(ctx context.Context) bool {
+	for {
+		now := time.Now()
+		cursor, ok, err := c.Ledger.Claim(ctx, c.Feed, c.Holder, now, now.Add(leaseDuration))
+		switch {
+		case err != nil:
+			c.Logger.Warn("Failed to claim changefeed", zap.String("feed", c.Feed), zap.Error(err))
+		case ok:
+			c.cursor = cursor
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(claimInterval):
+		}
+	}
+}
+
+func (c *Consumer) consume(ctx context.Context) error {
+	options := []string{"updated", fmt.Sprintf("resolved = '%s'", resolvedInterval)}
+	switch {
+	case c.cursor != "":
+		options = append(options, fmt.Sprintf("cursor = '%s'", c.cursor))
+	case !c.InitialScan:
+		options = append(options, "no_initial_scan")
+	}
+	query := fmt.Sprintf("EXPERIMENTAL CHANGEFEED FOR %s WITH %s", strings.Join(c.Tables, ", "), strings.Join(options, ", "))
+
+	// Changefeeds run until canceled, so they run on a dedicated connection
+	// exempted from the statement timeout of the pool.
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error acquiring connection")
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		return stacktrace.Propagate(err, "Error disabling statement timeout")
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "RESET statement_timeout"); err != nil {
+			c.Logger.Warn("Error resetting statement timeout", zap.Error(err))
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			table      sql.NullString
+			key, value []byte
+		)
+		if err := rows.Scan(&table, &key, &value); err != nil {
+			return stacktrace.Propagate(err, "Error scanning changefeed row")
+		}
+		e, resolved, err := decode(table.String, key, value)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			c.cursor = resolved
+			if err := c.advance(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.Sink.Publish(ctx, e); err != nil {
+			return stacktrace.Propagate(err, "Error publishing change of %s %s", e.Kind, e.ID)
+		}
+	}
+	return stacktrace.Propagate(rows.Err(), "Error reading changefeed")
+}
+
+// advance records the cursor of c in Ledger, failing if c lost the lease of
+// Feed.
+func (c *Consumer) advance(ctx context.Context) error {
+	if c.Ledger == nil {
+		return nil
+	}
+	ok, err := c.Ledger.Advance(ctx, c.Feed, c.Holder, c.cursor, time.Now().Add(leaseDuration))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error recording cursor of changefeed %s", c.Feed)
+	}
+	if !ok {
+		return stacktrace.NewError("Lost the lease of changefeed %s", c.Feed)
+	}
+	return nil
+}
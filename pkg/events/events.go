@@ -0,0 +1,162 @@
+// Package events republishes the changes made to DSS entities, as observed
+// through CockroachDB changefeeds, as normalized change events to a Sink so
+// that analytics and monitoring systems can follow them in real time.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+)
+
+// Operation is the kind of change an Event reports.
+type Operation string
+
+const (
+	// OperationUpsert reports the creation or update of an entity.
+	OperationUpsert Operation = "upsert"
+	// OperationDelete reports the deletion of an entity.
+	OperationDelete Operation = "delete"
+	// OperationExpiring reports that an entity is about to reach its end
+	// time.
+	OperationExpiring Operation = "expiring"
+)
+
+// Kinds of entity reported by Events.
+const (
+	KindISA               = "rid.identification_service_area"
+	KindOperationalIntent = "scd.operational_intent"
+	KindConstraint        = "scd.constraint"
+)
+
+// kinds are the kinds of entity reported by Events, by the table holding
+// them.
+var kinds = map[string]string{
+	"identification_service_areas": KindISA,
+	"scd_operations":               KindOperationalIntent,
+	"scd_constraints":              KindConstraint,
+}
+
+// Event is the normalized change of an entity. Only ID is set for
+// deletions.
+type Event struct {
+	Kind string    `json:"kind"`
+	Op   Operation `json:"op"`
+	ID   string    `json:"id"`
+	// Time is the commit time of the change, or the time an
+	// OperationExpiring notice was issued.
+	Time time.Time `json:"time"`
+
+	Manager string `json:"manager,omitempty"`
+	// Version is the version of an ISA or the OVN of an SCD entity.
+	Version   string     `json:"version,omitempty"`
+	State     string     `json:"state,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	// Cells are the tokens of the S2 cells covered by the entity.
+	Cells []string `json:"cells,omitempty"`
+}
+
+// Sink publishes Events. Publish is called sequentially, in commit order
+// for each entity. Events may be published more than once when consumption
+// resumes after a failure.
+type Sink interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// changefeedMessage is the value of a changefeed row, in the wrapped
+// envelope.
+type changefeedMessage struct {
+	After    *changefeedRow `json:"after"`
+	Updated  string         `json:"updated"`
+	Resolved string         `json:"resolved"`
+}
+
+// changefeedRow holds the columns of the entity tables that make up Events.
+type changefeedRow struct {
+	ID        string     `json:"id"`
+	Owner     string     `json:"owner"`
+	State     string     `json:"state"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Cells     []int64    `json:"cells"`
+	// OVN is set for the SCD entities written since schema 3.10.0.
+	OVN string `json:"ovn"`
+}
+
+// parseHLC returns the wall time of the hybrid logical clock timestamp s,
+// e.g. "1532377312562986715.0000000000".
+func parseHLC(s string) (time.Time, error) {
+	wall := s
+	if i := strings.Index(s, "."); i >= 0 {
+		wall = s[:i]
+	}
+	nanos, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return time.Time{}, stacktrace.Propagate(err, "Error parsing HLC timestamp %s", s)
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// decode returns the Event reported by the changefeed row of table with the
+// given key and value, or the resolved timestamp if the row is a resolved
+// message.
+func decode(table string, key []byte, value []byte) (*Event, string, error) {
+	msg := &changefeedMessage{}
+	if err := json.Unmarshal(value, msg); err != nil {
+		return nil, "", stacktrace.Propagate(err, "Error parsing changefeed value")
+	}
+	if table == "" {
+		if msg.Resolved == "" {
+			return nil, "", stacktrace.NewError("Changefeed message without table nor resolved timestamp")
+		}
+		return nil, msg.Resolved, nil
+	}
+
+	kind, ok := kinds[table]
+	if !ok {
+		return nil, "", stacktrace.NewError("Unexpected changefeed table %s", table)
+	}
+	t, err := parseHLC(msg.Updated)
+	if err != nil {
+		return nil, "", err
+	}
+	e := &Event{Kind: kind, Time: t}
+
+	if msg.After == nil {
+		var primaryKey []string
+		if err := json.Unmarshal(key, &primaryKey); err != nil || len(primaryKey) != 1 {
+			return nil, "", stacktrace.NewError("Unexpected changefeed key %s of table %s", key, table)
+		}
+		e.Op = OperationDelete
+		e.ID = primaryKey[0]
+		return e, "", nil
+	}
+
+	row := msg.After
+	e.Op = OperationUpsert
+	e.ID = row.ID
+	e.Manager = row.Owner
+	e.State = row.State
+	e.StartTime = row.StartsAt
+	e.EndTime = row.EndsAt
+	if table == "identification_service_areas" {
+		e.Version = dssmodels.VersionFromTime(row.UpdatedAt).String()
+	} else if row.OVN != "" {
+		e.Version = row.OVN
+	} else {
+		e.Version = scdmodels.NewOVNFromTime(row.UpdatedAt, row.ID).String()
+	}
+	for _, c := range row.Cells {
+		e.Cells = append(e.Cells, s2.CellID(c).ToToken())
+	}
+	return e, "", nil
+}
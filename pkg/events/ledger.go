@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// event_publishers table.
+var minSchemaVersion = *semver.New("3.13.0")
+
+// Ledger elects the one instance of the pool publishing each changefeed, so
+// that every change is published once by the pool rather than by every
+// instance, and persists the resolved timestamp from which the changefeed
+// resumes when another instance takes over.
+type Ledger interface {
+	// Claim makes holder the publisher of feed until leaseEnd, unless
+	// another instance holds a lease past now. It returns the cursor of
+	// feed, and false if another instance holds the lease.
+	Claim(ctx context.Context, feed, holder string, now, leaseEnd time.Time) (string, bool, error)
+	// Advance records cursor as the resolved timestamp of feed and extends
+	// the lease of holder until leaseEnd. It returns false if holder lost
+	// the lease.
+	Advance(ctx context.Context, feed, holder, cursor string, leaseEnd time.Time) (bool, error)
+}
+
+// DBLedger is a Ledger persisting to the remote ID database, shared by the
+// instances of the pool.
+type DBLedger struct {
+	db *cockroach.DB
+}
+
+// NewDBLedger returns a DBLedger persisting to db, which must be the
+// database named dbName.
+func NewDBLedger(ctx context.Context, db *cockroach.DB, dbName string) (*DBLedger, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for event publishers")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Change events require schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	return &DBLedger{db: db}, nil
+}
+
+// Claim implements Ledger.
+func (l *DBLedger) Claim(ctx context.Context, feed, holder string, now, leaseEnd time.Time) (string, bool, error) {
+	const (
+		selectQuery = `
+			SELECT
+				holder, lease_expires_at, cursor
+			FROM
+				event_publishers
+			WHERE
+				feed = $1
+			FOR UPDATE`
+		upsertQuery = `
+			UPSERT INTO
+				event_publishers
+				(feed, holder, lease_expires_at, cursor)
+			VALUES
+				($1, $2, $3, $4)`
+	)
+
+	var (
+		cursor  string
+		claimed bool
+	)
+	err := l.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		var (
+			leaseHolder    string
+			leaseExpiresAt time.Time
+		)
+		cursor, claimed = "", false
+		err := tx.QueryRowContext(ctx, selectQuery, feed).Scan(&leaseHolder, &leaseExpiresAt, &cursor)
+		if err != nil && err != sql.ErrNoRows {
+			return stacktrace.Propagate(err, "Error in query: %s", selectQuery)
+		}
+		if err == nil && leaseHolder != holder && now.Before(leaseExpiresAt) {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, upsertQuery, feed, holder, leaseEnd, cursor); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", upsertQuery)
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return cursor, claimed, nil
+}
+
+// Advance implements Ledger.
+func (l *DBLedger) Advance(ctx context.Context, feed, holder, cursor string, leaseEnd time.Time) (bool, error) {
+	const query = `
+		UPDATE
+			event_publishers
+		SET
+			cursor = $3, lease_expires_at = $4
+		WHERE
+			feed = $1
+		AND
+			holder = $2`
+
+	result, err := l.db.ExecContext(ctx, query, feed, holder, cursor, leaseEnd)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, stacktrace.Propagate(err, "Error counting updated event publishers")
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// webhookTimeout bounds the delivery of an Event by a WebhookSink or a
+// KafkaSink.
+const webhookTimeout = 10 * time.Second
+
+// NewSink returns the Sink described by spec: "log", publishing to logger,
+// the http(s) URL of a webhook, the nats:// or tls:// URL of a NATS server
+// whose path is the subject of the Events, or the kafka+http(s):// URL of a
+// Kafka REST proxy whose path is the topic of the Events.
+func NewSink(spec string, logger *zap.Logger) (Sink, error) {
+	if spec == "log" {
+		return &LogSink{Logger: logger}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing sink URL")
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewWebhookSink(spec)
+	case "nats", "tls":
+		return NewNATSSink(u)
+	case "kafka+http", "kafka+https":
+		return NewKafkaSink(u)
+	}
+	return nil, stacktrace.NewError("Unsupported sink %s; expected log, or an http(s), nats, tls or kafka+http(s) URL", u.Scheme)
+}
+
+// LogSink publishes Events to Logger.
+type LogSink struct {
+	Logger *zap.Logger
+}
+
+// Publish implements Sink.
+func (s *LogSink) Publish(_ context.Context, e *Event) error {
+	s.Logger.Info("Entity change", zap.Any("event", e))
+	return nil
+}
+
+// WebhookSink publishes each Event as a JSON object POSTed to URL.
+// Deliveries answered with a non-2xx status fail.
+type WebhookSink struct {
+	URL    *url.URL
+	Client *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink POSTing to rawURL.
+func NewWebhookSink(rawURL string) (*WebhookSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing webhook URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, stacktrace.NewError("Webhook URL must use http or https")
+	}
+	return &WebhookSink{URL: u, Client: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// Publish implements Sink.
+func (s *WebhookSink) Publish(ctx context.Context, e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error encoding event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error creating webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error delivering event to %s", s.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return stacktrace.NewError("Webhook %s answered %d", s.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// KafkaSink publishes each Event as a JSON record of Topic, keyed by the ID
+// of its entity so that the changes of an entity keep their order, through
+// the v2 API of the Kafka REST proxy at URL.
+type KafkaSink struct {
+	URL    *url.URL
+	Topic  string
+	Client *http.Client
+}
+
+// kafkaRecords is the body of the requests producing records to a topic
+// through the Kafka REST proxy.
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value *Event `json:"value"`
+}
+
+// NewKafkaSink returns a KafkaSink producing to the topic named by the path
+// of u, e.g. kafka+https://kafka-rest.example.com:8082/dss-events, through
+// the REST proxy at the http(s) URL of its host.
+func NewKafkaSink(u *url.URL) (*KafkaSink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, stacktrace.NewError("Kafka sink URL must name a topic as its path")
+	}
+	proxy := *u
+	proxy.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+	proxy.Path = "/topics/" + topic
+	return &KafkaSink{URL: &proxy, Topic: topic, Client: &http.Client{Timeout: webhookTimeout}}, nil
+}
+
+// Publish implements Sink.
+func (s *KafkaSink) Publish(ctx context.Context, e *Event) error {
+	body, err := json.Marshal(&kafkaRecords{Records: []kafkaRecord{{Key: e.ID, Value: e}}})
+	if err != nil {
+		return stacktrace.Propagate(err, "Error encoding event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error creating Kafka REST proxy request")
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error producing event to topic %s", s.Topic)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return stacktrace.NewError("Kafka REST proxy %s answered %d", s.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package flags
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// Config is the configuration of the gates of a deployment.
+type Config struct {
+	// Gates enables or disables gates, in the format of Set.Configure.
+	Gates string
+	// Refresh is the period at which the overrides are reloaded from the
+	// Store.
+	Refresh time.Duration
+}
+
+// RegisterFlags registers the command line flags setting c in fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Gates, "feature_flags", "", "comma-separated feature gates enabled (name or name=true) or disabled (name=false) in this deployment, unless overridden through aux_http_addr; see pkg/flags")
+	fs.DurationVar(&c.Refresh, "feature_flags_refresh", 30*time.Second, "period at which the feature gate overrides are reloaded from the database")
+}
+
+// Start returns a Set configured by c with the overrides persisted in db,
+// the database named dbName, and keeps them in sync with db until ctx is
+// done. Without db, the Set only uses the configuration and defaults.
+func Start(ctx context.Context, c Config, db *cockroach.DB, dbName string, logger *zap.Logger) (*Set, error) {
+	var store Store
+	if db != nil {
+		s, err := NewDBStore(ctx, db, dbName)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to open the store of feature flag overrides")
+		}
+		store = s
+	}
+	return start(ctx, c, store, logger)
+}
+
+// start returns a Set configured by c with the overrides persisted in store,
+// which may be nil, and keeps them in sync with store until ctx is done.
+func start(ctx context.Context, c Config, store Store, logger *zap.Logger) (*Set, error) {
+	set := NewSet(store)
+	if err := set.Configure(c.Gates); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid --feature_flags")
+	}
+	if err := set.Refresh(ctx); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to load feature flag overrides")
+	}
+	if store != nil {
+		go set.Run(ctx, c.Refresh, logger)
+	}
+	return set, nil
+}
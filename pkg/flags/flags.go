@@ -0,0 +1,238 @@
+// Package flags provides feature gates turning experimental behaviors of the
+// DSS on or off at runtime. A gate is enabled according to, in order of
+// precedence, the override persisted in a Store, which pool operators flip
+// through the auxiliary API, the deployment's configuration and the gate's
+// default.
+package flags
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Gate{}
+
+	// Default is the Set consulted by Gate.Enabled.
+	Default = NewSet(nil)
+)
+
+// StrictUUIDs rejects the entity IDs which are valid UUIDs but not in the
+// canonical hyphenated form, such as those enclosed in braces.
+var StrictUUIDs = Define("strict_uuids", false,
+	"reject entity IDs that are not UUIDs in the canonical hyphenated form")
+
+// Gate is a feature gate, declared once with Define.
+type Gate struct {
+	Name        string `json:"name"`
+	Default     bool   `json:"default"`
+	Description string `json:"description"`
+}
+
+// Define declares the gate named name, enabled by default if def. It panics
+// if a gate of that name was already declared.
+func Define(name string, def bool, description string) *Gate {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("feature gate %s declared twice", name))
+	}
+	g := &Gate{Name: name, Default: def, Description: description}
+	registry[name] = g
+	return g
+}
+
+// Lookup returns the gate named name, or nil if there is none.
+func Lookup(name string) *Gate {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return registry[name]
+}
+
+// Gates returns the declared gates sorted by name.
+func Gates() []*Gate {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	result := make([]*Gate, 0, len(registry))
+	for _, g := range registry {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Enabled reports whether g is enabled in Default.
+func (g *Gate) Enabled() bool {
+	return Default.Enabled(g)
+}
+
+// Store persists the overrides of the gates, shared by all the instances of
+// a deployment.
+type Store interface {
+	// LoadFlags returns the overridden gates by name.
+	LoadFlags(ctx context.Context) (map[string]bool, error)
+	// StoreFlag overrides the gate named name.
+	StoreFlag(ctx context.Context, name string, enabled bool) error
+	// DeleteFlag removes the override of the gate named name, if any.
+	DeleteFlag(ctx context.Context, name string) error
+}
+
+// Set holds the state of the gates in an instance. Its overrides are loaded
+// from its Store, if any, by Refresh.
+type Set struct {
+	store Store
+
+	mu         sync.RWMutex
+	configured map[string]bool
+	overrides  map[string]bool
+}
+
+// State is the state of a Gate in a Set.
+type State struct {
+	*Gate
+	Enabled bool `json:"enabled"`
+	// Source is whichever of "override", "config" or "default" determined
+	// Enabled.
+	Source string `json:"source"`
+}
+
+// NewSet returns a Set with the overrides persisted in store, which may be
+// nil to only use the configuration and defaults.
+func NewSet(store Store) *Set {
+	return &Set{
+		store:      store,
+		configured: map[string]bool{},
+		overrides:  map[string]bool{},
+	}
+}
+
+// Configure sets the deployment configuration of the gates from a
+// comma-separated list of name=bool, where a bare name enables the gate.
+func (s *Set) Configure(config string) error {
+	configured := map[string]bool{}
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value := entry, "true"
+		if i := strings.Index(entry, "="); i >= 0 {
+			name, value = entry[:i], entry[i+1:]
+		}
+		if Lookup(name) == nil {
+			return stacktrace.NewError("Unknown feature gate %s", name)
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return stacktrace.Propagate(err, "Invalid value for feature gate %s", name)
+		}
+		configured[name] = enabled
+	}
+	s.mu.Lock()
+	s.configured = configured
+	s.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether g is enabled.
+func (s *Set) Enabled(g *Gate) bool {
+	return s.State(g).Enabled
+}
+
+// State returns the state of g.
+func (s *Set) State(g *Gate) State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if enabled, ok := s.overrides[g.Name]; ok {
+		return State{Gate: g, Enabled: enabled, Source: "override"}
+	}
+	if enabled, ok := s.configured[g.Name]; ok {
+		return State{Gate: g, Enabled: enabled, Source: "config"}
+	}
+	return State{Gate: g, Enabled: g.Default, Source: "default"}
+}
+
+// States returns the state of all the declared gates, sorted by name.
+func (s *Set) States() []State {
+	gates := Gates()
+	result := make([]State, len(gates))
+	for i, g := range gates {
+		result[i] = s.State(g)
+	}
+	return result
+}
+
+// Refresh loads the overrides from the Store of s. Overrides of gates not
+// declared by this instance, e.g. by a newer version of the DSS, are
+// ignored.
+func (s *Set) Refresh(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	overrides, err := s.store.LoadFlags(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to load feature flags")
+	}
+	s.mu.Lock()
+	s.overrides = overrides
+	s.mu.Unlock()
+	return nil
+}
+
+// Override persists the state of the gate named name, or removes its
+// override if enabled is nil, and applies it to s. Other instances apply it
+// at their next Refresh.
+func (s *Set) Override(ctx context.Context, name string, enabled *bool) error {
+	if Lookup(name) == nil {
+		return stacktrace.NewError("Unknown feature gate %s", name)
+	}
+	if s.store != nil {
+		var err error
+		if enabled == nil {
+			err = s.store.DeleteFlag(ctx, name)
+		} else {
+			err = s.store.StoreFlag(ctx, name, *enabled)
+		}
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to persist feature flag %s", name)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overrides := make(map[string]bool, len(s.overrides)+1)
+	for k, v := range s.overrides {
+		overrides[k] = v
+	}
+	if enabled == nil {
+		delete(overrides, name)
+	} else {
+		overrides[name] = *enabled
+	}
+	s.overrides = overrides
+	return nil
+}
+
+// Run refreshes s every period until ctx is done.
+func (s *Set) Run(ctx context.Context, period time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				logger.Warn("Failed to refresh feature flags", zap.Error(err))
+			}
+		}
+	}
+}
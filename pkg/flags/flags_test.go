@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testGate = Define("test_gate", false, "gate exercised by the tests")
+
+type mapStore map[string]bool
+
+func (m mapStore) LoadFlags(ctx context.Context) (map[string]bool, error) {
+	result := map[string]bool{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (m mapStore) StoreFlag(ctx context.Context, name string, enabled bool) error {
+	m[name] = enabled
+	return nil
+}
+
+func (m mapStore) DeleteFlag(ctx context.Context, name string) error {
+	delete(m, name)
+	return nil
+}
+
+func TestSetPrecedence(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		store   = mapStore{}
+		set     = NewSet(store)
+		other   = NewSet(store)
+		enabled = true
+	)
+
+	require.Equal(t, State{Gate: testGate, Enabled: false, Source: "default"}, set.State(testGate))
+
+	require.NoError(t, set.Configure("test_gate"))
+	require.Equal(t, State{Gate: testGate, Enabled: true, Source: "config"}, set.State(testGate))
+	require.NoError(t, set.Configure("test_gate=false"))
+	require.False(t, set.Enabled(testGate))
+
+	require.NoError(t, set.Override(ctx, testGate.Name, &enabled))
+	require.Equal(t, State{Gate: testGate, Enabled: true, Source: "override"}, set.State(testGate))
+
+	// Other instances pick overrides up when refreshing.
+	require.False(t, other.Enabled(testGate))
+	require.NoError(t, other.Refresh(ctx))
+	require.True(t, other.Enabled(testGate))
+
+	require.NoError(t, set.Override(ctx, testGate.Name, nil))
+	require.Equal(t, "config", set.State(testGate).Source)
+	require.NoError(t, other.Refresh(ctx))
+	require.Equal(t, "default", other.State(testGate).Source)
+}
+
+func TestUnknownGates(t *testing.T) {
+	set := NewSet(mapStore{})
+	enabled := true
+	require.Error(t, set.Configure("no_such_gate"))
+	require.Error(t, set.Configure("test_gate=maybe"))
+	require.Error(t, set.Override(context.Background(), "no_such_gate", &enabled))
+	require.Panics(t, func() { Define("test_gate", true, "") })
+}
+
+func TestStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	set, err := start(ctx, Config{Gates: "test_gate", Refresh: time.Hour}, mapStore{"strict_uuids": true}, zap.NewNop())
+	require.NoError(t, err)
+	require.True(t, set.Enabled(testGate))
+	require.Equal(t, "override", set.State(StrictUUIDs).Source)
+
+	_, err = Start(ctx, Config{Gates: "no_such_gate"}, nil, "", zap.NewNop())
+	require.Error(t, err)
+}
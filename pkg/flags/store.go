@@ -0,0 +1,91 @@
+package flags
+
+import (
+	"context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// feature_flags table.
+var minSchemaVersion = *semver.New("3.4.0")
+
+// DBStore persists the overrides of the gates in the remote ID database.
+type DBStore struct {
+	db *cockroach.DB
+}
+
+// NewDBStore returns a DBStore persisting to db, which must be the database
+// named dbName.
+func NewDBStore(ctx context.Context, db *cockroach.DB, dbName string) (*DBStore, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for feature flags")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Feature flags require schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	return &DBStore{db: db}, nil
+}
+
+// LoadFlags implements Store.
+func (s *DBStore) LoadFlags(ctx context.Context) (map[string]bool, error) {
+	const query = `
+		SELECT
+			name, enabled
+		FROM
+			feature_flags`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	result := map[string]bool{}
+	for rows.Next() {
+		var (
+			name    string
+			enabled bool
+		)
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning feature flag row")
+		}
+		result[name] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// StoreFlag implements Store.
+func (s *DBStore) StoreFlag(ctx context.Context, name string, enabled bool) error {
+	const query = `
+		UPSERT INTO
+			feature_flags
+			(name, enabled, updated_at)
+		VALUES
+			($1, $2, now())`
+
+	if _, err := s.db.ExecContext(ctx, query, name, enabled); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
+
+// DeleteFlag implements Store.
+func (s *DBStore) DeleteFlag(ctx context.Context, name string) error {
+	const query = `
+		DELETE FROM
+			feature_flags
+		WHERE
+			name = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, name); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
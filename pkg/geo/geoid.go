@@ -0,0 +1,105 @@
+package geo
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/stacktrace"
+)
+
+// Geoid models the height of a geoid, such as EGM96, relative to the WGS84
+// ellipsoid.
+type Geoid interface {
+	// Undulation returns the height in meters of the geoid above the WGS84
+	// ellipsoid at ll.
+	Undulation(ll s2.LatLng) float64
+}
+
+// GeoidGrid is a Geoid interpolating bilinearly between undulations sampled
+// on a regular grid of latitudes and longitudes.
+type GeoidGrid struct {
+	south, north, west, east float64
+	dlat, dlng               float64
+	rows, cols               int
+	// values are the undulations from north to south, then from west to
+	// east.
+	values []float64
+}
+
+// ReadGeoidGrid reads a GeoidGrid in the format of the EGM96 15' grid
+// distributed by NGA as WW15MGH.GRD: a header listing the south, north,
+// west and east bounds and the latitude and longitude spacings in degrees,
+// followed by the undulations in meters from north to south, then from west
+// to east, all separated by white space.
+func ReadGeoidGrid(r io.Reader) (*GeoidGrid, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	next := func() (float64, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return 0, stacktrace.Propagate(err, "Error reading geoid grid")
+			}
+			return 0, stacktrace.NewError("Geoid grid ended prematurely")
+		}
+		v, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return 0, stacktrace.Propagate(err, "Invalid value in geoid grid")
+		}
+		return v, nil
+	}
+
+	var header [6]float64
+	for i := range header {
+		v, err := next()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading geoid grid header")
+		}
+		header[i] = v
+	}
+	g := &GeoidGrid{
+		south: header[0], north: header[1], west: header[2], east: header[3],
+		dlat: header[4], dlng: header[5],
+	}
+	if g.dlat <= 0 || g.dlng <= 0 || g.north <= g.south || g.east <= g.west {
+		return nil, stacktrace.NewError("Invalid geoid grid header %v", header)
+	}
+	g.rows = int(math.Round((g.north-g.south)/g.dlat)) + 1
+	g.cols = int(math.Round((g.east-g.west)/g.dlng)) + 1
+	g.values = make([]float64, g.rows*g.cols)
+	for i := range g.values {
+		v, err := next()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading undulation %d of geoid grid", i)
+		}
+		g.values[i] = v
+	}
+	return g, nil
+}
+
+// Undulation implements Geoid. Longitudes are wrapped into the bounds of
+// the grid, and latitudes clamped to them.
+func (g *GeoidGrid) Undulation(ll s2.LatLng) float64 {
+	lat := math.Max(g.south, math.Min(g.north, ll.Lat.Degrees()))
+	lng := ll.Lng.Degrees()
+	for lng < g.west {
+		lng += 360
+	}
+	for lng > g.east {
+		lng -= 360
+	}
+	lng = math.Max(g.west, lng)
+
+	y := (g.north - lat) / g.dlat
+	x := (lng - g.west) / g.dlng
+	row := int(math.Min(math.Floor(y), float64(g.rows-2)))
+	col := int(math.Min(math.Floor(x), float64(g.cols-2)))
+	fy, fx := y-float64(row), x-float64(col)
+
+	at := func(r, c int) float64 { return g.values[r*g.cols+c] }
+	top := at(row, col)*(1-fx) + at(row, col+1)*fx
+	bottom := at(row+1, col)*(1-fx) + at(row+1, col+1)*fx
+	return top*(1-fy) + bottom*fy
+}
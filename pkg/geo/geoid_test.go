@@ -0,0 +1,32 @@
+package geo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoidGridUndulation(t *testing.T) {
+	// 3x3 grid spanning [-10, 10] degrees in both directions.
+	g, err := geo.ReadGeoidGrid(strings.NewReader(`
+		-10 10 -10 10 10 10
+		 0  10  20
+		10  20  30
+		20  30  40`))
+	require.NoError(t, err)
+
+	require.InDelta(t, 0, g.Undulation(s2.LatLngFromDegrees(10, -10)), 1e-9)
+	require.InDelta(t, 20, g.Undulation(s2.LatLngFromDegrees(0, 0)), 1e-9)
+	require.InDelta(t, 40, g.Undulation(s2.LatLngFromDegrees(-10, 10)), 1e-9)
+	require.InDelta(t, 25, g.Undulation(s2.LatLngFromDegrees(-5, 0)), 1e-9)
+	// Latitudes are clamped to the grid.
+	require.InDelta(t, 10, g.Undulation(s2.LatLngFromDegrees(30, 0)), 1e-9)
+
+	_, err = geo.ReadGeoidGrid(strings.NewReader(`-10 10 -10 10 10 10 0 10`))
+	require.Error(t, err)
+	_, err = geo.ReadGeoidGrid(strings.NewReader(`10 -10 -10 10 10 10`))
+	require.Error(t, err)
+}
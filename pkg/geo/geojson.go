@@ -0,0 +1,71 @@
+package geo
+
+import (
+	"math"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/stacktrace"
+)
+
+// GeoJSONGeometry is a GeoJSON (RFC 7946) geometry, whose coordinates are
+// given in longitude, latitude order.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// Feature is a GeoJSON (RFC 7946) feature, whose Type is "Feature".
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// FeatureCollection is a GeoJSON feature collection, whose Type is
+// "FeatureCollection".
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	BBox     []float64  `json:"bbox,omitempty"`
+	Features []*Feature `json:"features"`
+}
+
+// CellsMultiPolygon returns the approximate footprint covered by cells, as
+// a GeoJSON MultiPolygon of their normalized union: sibling cells are merged
+// into their parents, but the remaining cells are not merged into larger
+// polygons.
+func CellsMultiPolygon(cells s2.CellUnion) *GeoJSONGeometry {
+	normalized := append(s2.CellUnion(nil), cells...)
+	normalized.Normalize()
+	polygons := make([][][][2]float64, len(normalized))
+	for i, id := range normalized {
+		cell := s2.CellFromCellID(id)
+		// The vertices of cells are counterclockwise, as RFC 7946 requires of
+		// exterior rings, which are closed by repeating their first position.
+		ring := make([][2]float64, 5)
+		for k := 0; k < 4; k++ {
+			ll := s2.LatLngFromPoint(cell.Vertex(k))
+			ring[k] = [2]float64{ll.Lng.Degrees(), ll.Lat.Degrees()}
+		}
+		ring[4] = ring[0]
+		polygons[i] = [][][2]float64{ring}
+	}
+	return &GeoJSONGeometry{Type: "MultiPolygon", Coordinates: polygons}
+}
+
+// RectCovering returns the covering of the rectangle from the south-west
+// corner (minLat, minLng) to the north-east one (maxLat, maxLng), in
+// degrees, or ErrAreaTooLarge if it is larger than allowed of the areas of
+// entities.
+func RectCovering(minLat, minLng, maxLat, maxLng float64) (s2.CellUnion, error) {
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 || minLat > maxLat || minLng > maxLng {
+		return nil, stacktrace.Propagate(ErrBadCoordSet, "Invalid rectangle")
+	}
+	rect := s2.RectFromLatLng(s2.LatLngFromDegrees(minLat, minLng)).AddPoint(s2.LatLngFromDegrees(maxLat, maxLng))
+	if area := rect.Area() * earthAreaKm2 / (4.0 * math.Pi); area > maxAllowedAreaKm2 {
+		return nil, stacktrace.Propagate(
+			ErrAreaTooLarge, "Area is too large (%fkm² > %fkm²)",
+			area, maxAllowedAreaKm2)
+	}
+	return RegionCoverer.Covering(rect), nil
+}
@@ -0,0 +1,55 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/stacktrace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCellsMultiPolygon(t *testing.T) {
+	parent := s2.CellIDFromLatLng(s2.LatLngFromDegrees(37.4, -122.1)).Parent(12)
+	var cells s2.CellUnion
+	for child := parent.ChildBegin(); child != parent.ChildEnd(); child = child.Next() {
+		cells = append(cells, child)
+	}
+	other := s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)
+	cells = append(cells, other)
+
+	geometry := geo.CellsMultiPolygon(cells)
+	require.Equal(t, "MultiPolygon", geometry.Type)
+	polygons := geometry.Coordinates.([][][][2]float64)
+	// The children of parent are merged into it.
+	require.Len(t, polygons, 2)
+	for _, polygon := range polygons {
+		require.Len(t, polygon, 1)
+		ring := polygon[0]
+		require.Len(t, ring, 5)
+		require.Equal(t, ring[0], ring[4])
+	}
+	require.Len(t, cells, 5)
+
+	// Positions are in longitude, latitude order.
+	ring := geo.CellsMultiPolygon(s2.CellUnion{other}).Coordinates.([][][][2]float64)[0][0]
+	require.InDelta(t, 6.1, ring[0][0], 0.1)
+	require.InDelta(t, 46.2, ring[0][1], 0.1)
+}
+
+func TestRectCovering(t *testing.T) {
+	cells, err := geo.RectCovering(37.40, -122.15, 37.42, -122.13)
+	require.NoError(t, err)
+	require.NotEmpty(t, cells)
+	for _, cell := range cells {
+		require.Equal(t, geo.DefaultMinimumCellLevel, cell.Level())
+	}
+
+	_, err = geo.RectCovering(37.42, -122.15, 37.40, -122.13)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+	_, err = geo.RectCovering(30, -125, 45, -110)
+	require.Equal(t, dsserr.AreaTooLarge, stacktrace.GetCode(err))
+}
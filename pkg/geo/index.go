@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"sort"
+
+	"github.com/golang/geo/s2"
+)
+
+// CellIndex maps S2 cells to the IDs of the entities covering them, for
+// stores keeping entities in memory.  Like the cell arrays of the database
+// tables, it matches cells exactly: it does not relate a cell to its parents
+// or children.  It is not safe for concurrent use.
+type CellIndex struct {
+	cells map[s2.CellID]map[string]struct{}
+}
+
+// NewCellIndex returns an empty CellIndex.
+func NewCellIndex() *CellIndex {
+	return &CellIndex{cells: map[s2.CellID]map[string]struct{}{}}
+}
+
+// Add records that the entity id covers cells.
+func (x *CellIndex) Add(id string, cells s2.CellUnion) {
+	for _, cell := range cells {
+		ids, ok := x.cells[cell]
+		if !ok {
+			ids = map[string]struct{}{}
+			x.cells[cell] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+// Remove forgets that the entity id covers cells.
+func (x *CellIndex) Remove(id string, cells s2.CellUnion) {
+	for _, cell := range cells {
+		if ids, ok := x.cells[cell]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(x.cells, cell)
+			}
+		}
+	}
+}
+
+// Intersecting returns the sorted IDs of the entities covering any of cells.
+func (x *CellIndex) Intersecting(cells s2.CellUnion) []string {
+	seen := map[string]struct{}{}
+	for _, cell := range cells {
+		for id := range x.cells[cell] {
+			seen[id] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(seen))
+	for id := range seen {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,141 @@
+package geo
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/r1"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/interuss/stacktrace"
+)
+
+// Unassigned is the jurisdiction of entities lying in none of the
+// Jurisdictions of a pool.
+const Unassigned = ""
+
+// UnassignedName names the partitions holding the entities of no
+// jurisdiction, and may thus not name a Jurisdiction.
+const UnassignedName = "unassigned"
+
+var jurisdictionName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Jurisdiction is a named area the storage of the entities lying within may
+// be restricted to nodes in, for data residency.
+type Jurisdiction struct {
+	Name string
+	// Rects are the latitude/longitude rectangles making up the area.
+	Rects []s2.Rect
+}
+
+// Jurisdictions are the jurisdictions a pool partitions its entities by, in
+// order of precedence.
+type Jurisdictions []Jurisdiction
+
+// ParseJurisdictions parses the semicolon-separated jurisdictions of s, each
+// a name followed by a colon and the rectangle lat_lo,lng_lo,lat_hi,lng_hi
+// in degrees, e.g. "ch:45.8,5.9,47.8,10.5;eu:34,-25,72,45". A name may be
+// repeated to make up its area of several rectangles, and takes the
+// precedence of its first occurrence. A rectangle whose lng_lo is greater
+// than its lng_hi crosses the antimeridian.
+func ParseJurisdictions(s string) (Jurisdictions, error) {
+	var (
+		result Jurisdictions
+		index  = map[string]int{}
+	)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 {
+			return nil, stacktrace.NewError("Missing rectangle of jurisdiction %s", spec)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !jurisdictionName.MatchString(name) || name == UnassignedName {
+			return nil, stacktrace.NewError("Invalid jurisdiction name %q", name)
+		}
+		rect, err := parseRect(parts[1])
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid rectangle of jurisdiction %s", name)
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(result)
+			index[name] = i
+			result = append(result, Jurisdiction{Name: name})
+		}
+		result[i].Rects = append(result[i].Rects, rect)
+	}
+	return result, nil
+}
+
+// parseRect parses the rectangle lat_lo,lng_lo,lat_hi,lng_hi of s.
+func parseRect(s string) (s2.Rect, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 4 {
+		return s2.Rect{}, stacktrace.NewError("Expected 4 coordinates, got %d", len(fields))
+	}
+	var degrees [4]float64
+	for i, f := range fields {
+		d, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return s2.Rect{}, stacktrace.Propagate(err, "Invalid coordinate %s", f)
+		}
+		degrees[i] = d
+	}
+	latLo, lngLo, latHi, lngHi := degrees[0], degrees[1], degrees[2], degrees[3]
+	if latLo < -90 || latHi > 90 || latLo >= latHi {
+		return s2.Rect{}, stacktrace.NewError("Invalid latitudes %g to %g", latLo, latHi)
+	}
+	if lngLo < -180 || lngLo > 180 || lngHi < -180 || lngHi > 180 || lngLo == lngHi {
+		return s2.Rect{}, stacktrace.NewError("Invalid longitudes %g to %g", lngLo, lngHi)
+	}
+	return s2.Rect{
+		Lat: r1.Interval{Lo: (s1.Angle(latLo) * s1.Degree).Radians(), Hi: (s1.Angle(latHi) * s1.Degree).Radians()},
+		Lng: s1.IntervalFromEndpoints((s1.Angle(lngLo) * s1.Degree).Radians(), (s1.Angle(lngHi) * s1.Degree).Radians()),
+	}, nil
+}
+
+// Of returns the name of the first of js whose area contains all cells, the
+// cells of an entity, or Unassigned if none does.
+func (js Jurisdictions) Of(cells s2.CellUnion) string {
+	if len(cells) == 0 {
+		return Unassigned
+	}
+	for _, j := range js {
+		if j.contains(cells) {
+			return j.Name
+		}
+	}
+	return Unassigned
+}
+
+// contains returns true if each of cells lies within a rectangle of j.
+func (j Jurisdiction) contains(cells s2.CellUnion) bool {
+	for _, id := range cells {
+		cell := s2.CellFromCellID(id)
+		contained := false
+		for _, rect := range j.Rects {
+			if rect.ContainsCell(cell) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// Names returns the names of js, in order.
+func (js Jurisdictions) Names() []string {
+	names := make([]string, len(js))
+	for i, j := range js {
+		names[i] = j.Name
+	}
+	return names
+}
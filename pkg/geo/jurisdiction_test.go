@@ -0,0 +1,55 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/stretchr/testify/require"
+)
+
+func cellAt(lat, lng float64) s2.CellID {
+	return s2.CellIDFromLatLng(s2.LatLngFromDegrees(lat, lng)).Parent(13)
+}
+
+func TestJurisdictionOf(t *testing.T) {
+	js, err := geo.ParseJurisdictions("ch:45.8,5.9,47.8,10.5; eu:34,-25,72,45; nz:-48,166,-34,-175; eu:27,-19,30,-13")
+	require.NoError(t, err)
+	require.Equal(t, []string{"ch", "eu", "nz"}, js.Names())
+
+	var (
+		geneva     = cellAt(46.2, 6.1)
+		paris      = cellAt(48.9, 2.4)
+		tenerife   = cellAt(28.3, -16.5)
+		chatham    = cellAt(-44, -176.5)
+		newYork    = cellAt(40.7, -74)
+		wellington = cellAt(-41.3, 174.8)
+	)
+	// The first jurisdiction containing all cells takes precedence.
+	require.Equal(t, "ch", js.Of(s2.CellUnion{geneva}))
+	require.Equal(t, "eu", js.Of(s2.CellUnion{geneva, paris}))
+	require.Equal(t, "eu", js.Of(s2.CellUnion{tenerife}))
+	// Rectangles may cross the antimeridian.
+	require.Equal(t, "nz", js.Of(s2.CellUnion{wellington, chatham}))
+	require.Equal(t, geo.Unassigned, js.Of(s2.CellUnion{paris, newYork}))
+	require.Equal(t, geo.Unassigned, js.Of(nil))
+
+	none, err := geo.ParseJurisdictions("")
+	require.NoError(t, err)
+	require.Equal(t, geo.Unassigned, none.Of(s2.CellUnion{geneva}))
+}
+
+func TestParseJurisdictionsErrors(t *testing.T) {
+	for _, s := range []string{
+		"eu",
+		"EU:34,-25,72,45",
+		"unassigned:34,-25,72,45",
+		"eu:34,-25,72",
+		"eu:72,-25,34,45",
+		"eu:34,-25,72,x",
+		"eu:34,-190,72,45",
+	} {
+		_, err := geo.ParseJurisdictions(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,45 @@
+package geo
+
+import (
+	"github.com/golang/geo/s2"
+)
+
+// Regions are the coarse geographic buckets of entities: an entity lies in
+// the region of the S2 face all its cells belong to, regions 0 to 5, or in
+// MultiFaceRegion if its cells span several faces.  They let searches skip
+// the entities of other faces; faces do not follow borders, so the storage
+// of entities is rather pinned by their Jurisdiction.
+const (
+	// MultiFaceRegion is the region of entities spanning several S2 faces.
+	MultiFaceRegion int16 = 6
+)
+
+// RegionOf returns the region of an entity covering cells.
+func RegionOf(cells s2.CellUnion) int16 {
+	if len(cells) == 0 {
+		return MultiFaceRegion
+	}
+	face := cells[0].Face()
+	for _, cell := range cells[1:] {
+		if cell.Face() != face {
+			return MultiFaceRegion
+		}
+	}
+	return int16(face)
+}
+
+// RegionsIntersecting returns the regions of the entities that may intersect
+// cells: the faces of cells and MultiFaceRegion.
+func RegionsIntersecting(cells s2.CellUnion) []int64 {
+	var (
+		seen   [MultiFaceRegion]bool
+		result []int64
+	)
+	for _, cell := range cells {
+		if face := cell.Face(); !seen[face] {
+			seen[face] = true
+			result = append(result, int64(face))
+		}
+	}
+	return append(result, int64(MultiFaceRegion))
+}
@@ -3,6 +3,7 @@ package geo_test
 import (
 	"testing"
 
+	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/geo"
 	"github.com/interuss/dss/pkg/geo/testdata"
 
@@ -50,3 +51,38 @@ func TestParseAreaFailsForLoopWithOddNumberOfCoordinates(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, cells)
 }
+
+func TestRegions(t *testing.T) {
+	var (
+		europe   = s2.CellIDFromLatLng(s2.LatLngFromDegrees(48.85, 2.35)).Parent(13)
+		pacific  = s2.CellIDFromLatLng(s2.LatLngFromDegrees(0, -150)).Parent(13)
+		faceEU   = int16(europe.Face())
+		faceOcea = int16(pacific.Face())
+	)
+	require.NotEqual(t, faceEU, faceOcea)
+
+	require.Equal(t, faceEU, geo.RegionOf(s2.CellUnion{europe}))
+	require.Equal(t, geo.MultiFaceRegion, geo.RegionOf(s2.CellUnion{europe, pacific}))
+	require.Equal(t, geo.MultiFaceRegion, geo.RegionOf(nil))
+
+	require.Equal(t, []int64{int64(faceEU), int64(geo.MultiFaceRegion)}, geo.RegionsIntersecting(s2.CellUnion{europe, europe.Next()}))
+}
+
+func TestCellIndex(t *testing.T) {
+	var (
+		x = geo.NewCellIndex()
+		a = s2.CellIDFromToken("89c25")
+		b = s2.CellIDFromToken("89c27")
+		c = s2.CellIDFromToken("89c29")
+	)
+	x.Add("isa2", s2.CellUnion{b, c})
+	x.Add("isa1", s2.CellUnion{a, b})
+
+	require.Equal(t, []string{"isa1", "isa2"}, x.Intersecting(s2.CellUnion{b}))
+	require.Equal(t, []string{"isa1"}, x.Intersecting(s2.CellUnion{a}))
+	// Parents do not match their children.
+	require.Empty(t, x.Intersecting(s2.CellUnion{a.Parent(5)}))
+
+	x.Remove("isa1", s2.CellUnion{a, b})
+	require.Equal(t, []string{"isa2"}, x.Intersecting(s2.CellUnion{a, b, c}))
+}
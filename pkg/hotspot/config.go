@@ -0,0 +1,31 @@
+package hotspot
+
+import (
+	"flag"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// Config is the configuration of the write hotspot tracking of an instance.
+type Config struct {
+	// Window is the sliding window over which the writes are counted;
+	// tracking is disabled if 0.
+	Window time.Duration
+	// Level is the S2 level of the cells the writes are counted by.
+	Level int
+}
+
+// RegisterFlags registers the command line flags setting c in fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Window, "write_hotspot_window", 10*time.Minute, "sliding window over which the writes to entities are counted by coarse S2 cell, serving the cells written to the most at /aux/v1/write_hotspots of aux_http_addr and in the activity summary; disabled if 0")
+	fs.IntVar(&c.Level, "write_hotspot_level", DefaultLevel, "S2 level of the cells the writes are counted by over write_hotspot_window")
+}
+
+// New returns the Tracker configured by c, or nil if c disables tracking.
+func New(clock clockwork.Clock, c Config) *Tracker {
+	if c.Window <= 0 {
+		return nil
+	}
+	return NewTracker(clock, c.Level, c.Window)
+}
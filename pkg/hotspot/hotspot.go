@@ -0,0 +1,237 @@
+// Package hotspot tracks the rate of the writes to the entities of a DSS
+// instance by coarse S2 cell, so that pool operators can spot the areas
+// written to pathologically often, e.g. by a USS re-upserting the same
+// operational intent every second, before the load degrades the cell
+// indices of the database.
+package hotspot
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/jonboulle/clockwork"
+)
+
+const (
+	// DefaultLevel is the S2 level of the cells writes are counted by,
+	// cells of roughly 150km across.
+	DefaultLevel = 6
+	// bucketCount is the number of buckets the window of a Tracker is
+	// divided into, the writes expiring a bucket at a time.
+	bucketCount = 10
+	// topManagersCount is the number of managers reported in a Hotspot.
+	topManagersCount = 3
+)
+
+// Kinds of entity whose writes are recorded.
+const (
+	KindISA               = "rid.identification_service_area"
+	KindRIDSubscription   = "rid.subscription"
+	KindOperationalIntent = "scd.operational_intent"
+	KindSCDSubscription   = "scd.subscription"
+	KindConstraint        = "scd.constraint"
+)
+
+// ManagerWrites is the number of writes of a manager to a cell.
+type ManagerWrites struct {
+	Manager string `json:"manager"`
+	Writes  int64  `json:"writes"`
+}
+
+// Hotspot is the activity of a cell over the window of a Tracker.
+type Hotspot struct {
+	Cell  string `json:"cell"`
+	Level int    `json:"level"`
+	// Writes is the number of entity writes covering the cell, and
+	// PerMinute their average rate.
+	Writes    int64   `json:"writes"`
+	PerMinute float64 `json:"per_minute"`
+	// Entities is the number of distinct entities written; many more Writes
+	// than Entities denote entities rewritten over and over.
+	Entities int `json:"entities"`
+	// Kinds counts the writes by kind of entity.
+	Kinds map[string]int64 `json:"kinds"`
+	// TopManagers lists the managers writing the most, most writes first.
+	TopManagers []ManagerWrites `json:"top_managers"`
+}
+
+// cellActivity is the activity of a cell during a bucket.
+type cellActivity struct {
+	writes   int64
+	kinds    map[string]int64
+	managers map[string]int64
+	entities map[string]bool
+}
+
+type bucket struct {
+	start time.Time
+	cells map[s2.CellID]*cellActivity
+}
+
+// Tracker counts the writes to entities by coarse cell over a sliding
+// window. It is safe for concurrent use.
+type Tracker struct {
+	clock  clockwork.Clock
+	level  int
+	window time.Duration
+	width  time.Duration
+	start  time.Time
+
+	mu      sync.Mutex
+	buckets []*bucket
+}
+
+// NewTracker returns a Tracker counting writes by cell at level over the
+// last window.
+func NewTracker(clock clockwork.Clock, level int, window time.Duration) *Tracker {
+	width := window / bucketCount
+	if width <= 0 {
+		width = 1
+	}
+	return &Tracker{
+		clock:  clock,
+		level:  level,
+		window: window,
+		width:  width,
+		start:  clock.Now(),
+	}
+}
+
+// Record records a write by manager of the entity id of kind covering
+// cells.
+func (t *Tracker) Record(kind string, id string, manager string, cells s2.CellUnion) {
+	if len(cells) == 0 {
+		return
+	}
+	parents := make(map[s2.CellID]bool, len(cells))
+	for _, c := range cells {
+		if c.Level() > t.level {
+			c = c.Parent(t.level)
+		}
+		parents[c] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.current(t.clock.Now())
+	for c := range parents {
+		a, ok := b.cells[c]
+		if !ok {
+			a = &cellActivity{
+				kinds:    map[string]int64{},
+				managers: map[string]int64{},
+				entities: map[string]bool{},
+			}
+			b.cells[c] = a
+		}
+		a.writes++
+		a.kinds[kind]++
+		if manager != "" {
+			a.managers[manager]++
+		}
+		a.entities[kind+"/"+id] = true
+	}
+}
+
+// current returns the bucket of now, dropping the buckets out of the window.
+// t.mu must be held.
+func (t *Tracker) current(now time.Time) *bucket {
+	t.expire(now)
+	start := now.Truncate(t.width)
+	if n := len(t.buckets); n > 0 && t.buckets[n-1].start.Equal(start) {
+		return t.buckets[n-1]
+	}
+	b := &bucket{start: start, cells: map[s2.CellID]*cellActivity{}}
+	t.buckets = append(t.buckets, b)
+	return b
+}
+
+// expire drops the buckets out of the window ending at now. t.mu must be
+// held.
+func (t *Tracker) expire(now time.Time) {
+	cutoff := now.Add(-t.window)
+	i := 0
+	for i < len(t.buckets) && !t.buckets[i].start.Add(t.width).After(cutoff) {
+		i++
+	}
+	t.buckets = t.buckets[i:]
+}
+
+// Top returns the n cells written to the most over the window, most writes
+// first, or all of them if n is not positive.
+func (t *Tracker) Top(n int) []Hotspot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	t.expire(now)
+	merged := map[s2.CellID]*cellActivity{}
+	for _, b := range t.buckets {
+		for c, a := range b.cells {
+			m, ok := merged[c]
+			if !ok {
+				m = &cellActivity{
+					kinds:    map[string]int64{},
+					managers: map[string]int64{},
+					entities: map[string]bool{},
+				}
+				merged[c] = m
+			}
+			m.writes += a.writes
+			for kind, count := range a.kinds {
+				m.kinds[kind] += count
+			}
+			for manager, count := range a.managers {
+				m.managers[manager] += count
+			}
+			for id := range a.entities {
+				m.entities[id] = true
+			}
+		}
+	}
+
+	// The rates of a Tracker younger than its window are averaged over its
+	// lifetime.
+	elapsed := t.window
+	if age := now.Sub(t.start); age < elapsed {
+		elapsed = age
+	}
+	hotspots := make([]Hotspot, 0, len(merged))
+	for c, a := range merged {
+		h := Hotspot{
+			Cell:     c.ToToken(),
+			Level:    c.Level(),
+			Writes:   a.writes,
+			Entities: len(a.entities),
+			Kinds:    a.kinds,
+		}
+		if elapsed > 0 {
+			h.PerMinute = float64(a.writes) / elapsed.Minutes()
+		}
+		for manager, count := range a.managers {
+			h.TopManagers = append(h.TopManagers, ManagerWrites{Manager: manager, Writes: count})
+		}
+		sort.Slice(h.TopManagers, func(i, j int) bool {
+			if h.TopManagers[i].Writes != h.TopManagers[j].Writes {
+				return h.TopManagers[i].Writes > h.TopManagers[j].Writes
+			}
+			return h.TopManagers[i].Manager < h.TopManagers[j].Manager
+		})
+		if len(h.TopManagers) > topManagersCount {
+			h.TopManagers = h.TopManagers[:topManagersCount]
+		}
+		hotspots = append(hotspots, h)
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Writes != hotspots[j].Writes {
+			return hotspots[i].Writes > hotspots[j].Writes
+		}
+		return hotspots[i].Cell < hotspots[j].Cell
+	})
+	if n > 0 && len(hotspots) > n {
+		hotspots = hotspots[:n]
+	}
+	return hotspots
+}
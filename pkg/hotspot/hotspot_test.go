@@ -0,0 +1,73 @@
+package hotspot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func cellsAt(lat, lng float64) s2.CellUnion {
+	leaf := s2.CellIDFromLatLng(s2.LatLngFromDegrees(lat, lng))
+	return s2.CellUnion{leaf.Parent(13), leaf.Parent(13).Next()}
+}
+
+func TestTrackerTop(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	tracker := NewTracker(clock, DefaultLevel, 10*time.Minute)
+
+	zurich, tokyo := cellsAt(47.37, 8.54), cellsAt(35.68, 139.69)
+	for i := 0; i < 30; i++ {
+		tracker.Record(KindOperationalIntent, "op1", "uss1", zurich)
+	}
+	tracker.Record(KindSCDSubscription, "sub1", "uss2", zurich)
+	tracker.Record(KindISA, "isa1", "uss3", tokyo)
+	clock.Advance(time.Minute)
+
+	top := tracker.Top(0)
+	require.Len(t, top, 2)
+	require.Equal(t, zurich[0].Parent(DefaultLevel).ToToken(), top[0].Cell)
+	require.Equal(t, DefaultLevel, top[0].Level)
+	require.Equal(t, int64(31), top[0].Writes)
+	require.Equal(t, 2, top[0].Entities)
+	require.InDelta(t, 31, top[0].PerMinute, 1e-9)
+	require.Equal(t, map[string]int64{KindOperationalIntent: 30, KindSCDSubscription: 1}, top[0].Kinds)
+	require.Equal(t, []ManagerWrites{{"uss1", 30}, {"uss2", 1}}, top[0].TopManagers)
+	require.Equal(t, int64(1), top[1].Writes)
+
+	require.Len(t, tracker.Top(1), 1)
+}
+
+func TestTrackerWindow(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	tracker := NewTracker(clock, DefaultLevel, 10*time.Minute)
+	cells := cellsAt(47.37, 8.54)
+
+	tracker.Record(KindOperationalIntent, "op1", "uss1", cells)
+	clock.Advance(5 * time.Minute)
+	tracker.Record(KindOperationalIntent, "op1", "uss1", cells)
+	clock.Advance(5 * time.Minute)
+
+	top := tracker.Top(0)
+	require.Len(t, top, 1)
+	require.Equal(t, int64(2), top[0].Writes)
+	require.InDelta(t, 0.2, top[0].PerMinute, 1e-9)
+
+	clock.Advance(5 * time.Minute)
+	top = tracker.Top(0)
+	require.Len(t, top, 1)
+	require.Equal(t, int64(1), top[0].Writes)
+
+	clock.Advance(5 * time.Minute)
+	require.Empty(t, tracker.Top(0))
+}
+
+func TestNew(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	require.Nil(t, New(clock, Config{Level: DefaultLevel}))
+	tracker := New(clock, Config{Window: time.Minute, Level: DefaultLevel})
+	require.NotNil(t, tracker)
+	require.Equal(t, DefaultLevel, tracker.level)
+}
@@ -0,0 +1,132 @@
+// Package httpheaders applies the header policy of the HTTP gateway: CORS,
+// so that browser-based clients such as USS dashboards may call the DSS
+// across origins, and standard security headers.
+package httpheaders
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnyOrigin, as an allowed origin, allows every origin.
+const AnyOrigin = "*"
+
+// corsMethods are the methods of the APIs served by the gateway.
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// CORSPolicy describes the cross-origin requests browsers may make.
+type CORSPolicy struct {
+	// AllowedOrigins are the origins, such as https://dashboard.example.com,
+	// from which requests are allowed, or AnyOrigin.
+	AllowedOrigins []string
+	// AllowedHeaders are the request headers, case-insensitively, which
+	// cross-origin requests may carry beyond those browsers always allow.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers, beyond those browsers always
+	// expose, readable by the scripts of the allowed origins.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache the response to a preflight
+	// request; they use their own default if it is zero.
+	MaxAge time.Duration
+}
+
+// SplitList returns the non-empty, trimmed elements of the comma-separated
+// list s, as given in a flag.
+func SplitList(s string) []string {
+	var result []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	for _, o := range p.AllowedOrigins {
+		if o == AnyOrigin || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) allowsHeader(header string) bool {
+	for _, h := range p.AllowedHeaders {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+func allowsMethod(method string) bool {
+	for _, m := range corsMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS returns a handler passing requests to next, which answers the
+// preflight requests of browsers following policy and marks the responses
+// to the allowed origins as readable by them. Requests from other origins
+// are passed on without CORS headers, so browsers keep their responses from
+// the scripts which made them, but their preflight requests are rejected.
+// Credentials are not allowed, since the APIs authenticate with access
+// tokens in the Authorization header rather than cookies.
+func CORS(next http.Handler, policy CORSPolicy) http.Handler {
+	exposed := strings.Join(policy.ExposedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if !preflight {
+			if exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !allowsMethod(method) {
+			http.Error(w, "Method not allowed", http.StatusForbidden)
+			return
+		}
+		requested := SplitList(r.Header.Get("Access-Control-Request-Headers"))
+		for _, h := range requested {
+			if !policy.allowsHeader(h) {
+				http.Error(w, "Header "+h+" not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+		if len(requested) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if policy.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
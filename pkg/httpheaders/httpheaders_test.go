@@ -0,0 +1,93 @@
+package httpheaders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+})
+
+func TestSplitList(t *testing.T) {
+	require.Equal(t, []string{"a", "b"}, SplitList(" a, ,b ,"))
+	require.Empty(t, SplitList(""))
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(ok, CORSPolicy{
+		AllowedOrigins: []string{"https://dashboard.example.com"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"Deprecation"},
+		MaxAge:         10 * time.Minute,
+	})
+	serve := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v1/dss/identification_service_areas", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Same-origin and non-browser requests are untouched.
+	w := serve(http.MethodGet, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(http.MethodGet, "https://dashboard.example.com", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Deprecation", w.Header().Get("Access-Control-Expose-Headers"))
+	require.Equal(t, "ok", w.Body.String())
+
+	w = serve(http.MethodGet, "https://evil.example.com", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = serve(http.MethodOptions, "https://dashboard.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "authorization, content-type",
+	})
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "https://dashboard.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPut)
+	require.Equal(t, "authorization, content-type", w.Header().Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	w = serve(http.MethodOptions, "https://dashboard.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodGet,
+		"Access-Control-Request-Headers": "x-unknown",
+	})
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(http.MethodOptions, "https://evil.example.com", map[string]string{
+		"Access-Control-Request-Method": http.MethodGet,
+	})
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	h = CORS(ok, CORSPolicy{AllowedOrigins: []string{AnyOrigin}})
+	w = serve(http.MethodGet, "https://anywhere.example.com", nil)
+	require.Equal(t, "https://anywhere.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestSecurity(t *testing.T) {
+	w := httptest.NewRecorder()
+	Security(ok, 0).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthy", nil))
+	require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	require.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	require.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	w = httptest.NewRecorder()
+	Security(ok, 24*time.Hour).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthy", nil))
+	require.Equal(t, "max-age=86400", w.Header().Get("Strict-Transport-Security"))
+}
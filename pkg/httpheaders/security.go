@@ -0,0 +1,28 @@
+package httpheaders
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Security returns a handler passing requests to next, whose responses
+// carry headers keeping browsers from sniffing their content type, framing
+// them or leaking the URL of the DSS as referrer. If hstsMaxAge is positive,
+// they also require browsers to reach the DSS over HTTPS for that long,
+// which only makes sense if the gateway is only reachable over HTTPS.
+func Security(next http.Handler, hstsMaxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		// Only framing is restricted, so that the OpenAPI UI may still load
+		// its scripts.
+		h.Set("Content-Security-Policy", "frame-ancestors 'none'")
+		h.Set("Referrer-Policy", "no-referrer")
+		if hstsMaxAge > 0 {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(hstsMaxAge.Seconds())))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
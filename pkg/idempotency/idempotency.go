@@ -0,0 +1,281 @@
+// Package idempotency replays the responses to creation and update calls
+// retried with the same Idempotency-Key header, so that the retries of a USS
+// whose connection failed mid-call do not create duplicate implicit
+// subscriptions or increment notification indices twice.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/interuss/dss/pkg/auth"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Header is the request header (gRPC metadata key) carrying the idempotency
+// key of a call.
+const Header = "idempotency-key"
+
+// Record is the call made with an idempotency key.
+type Record struct {
+	Method      string
+	RequestHash []byte
+	// Response is the serialized anypb.Any response to the call. It is nil
+	// only in the Records left in progress by older versions of the DSS.
+	Response []byte
+}
+
+// Store persists the Records of idempotency keys by manager.
+type Store interface {
+	// Get returns the unexpired Record of key of manager, or nil if there is
+	// none.
+	Get(ctx context.Context, manager, key string) (*Record, error)
+	// Put records r for key of manager until expires, unless key is already
+	// recorded, in which case it fails with errors.VersionMismatch.
+	Put(ctx context.Context, manager, key string, r *Record, expires time.Time) error
+	// PutInTx is Put in tx, a transaction of a database of the cluster of the
+	// Store, returning false if the Store cannot write in tx.
+	PutInTx(ctx context.Context, tx *sql.Tx, manager, key string, r *Record, expires time.Time) (bool, error)
+}
+
+// call is a call carrying an idempotency key, found in the context of its
+// handler.
+type call struct {
+	store   Store
+	manager string
+	key     string
+	record  Record
+	expires time.Time
+
+	mu       sync.Mutex
+	response proto.Message
+	recorded bool
+}
+
+type callKey struct{}
+
+// Respond sets response as the response to the call of ctx, if it carries an
+// idempotency key, for the transaction writing the changes of the call to
+// record it with them; see RecordInTx. Handlers call it at the end of their
+// transactions, so that its last call is that of the attempt committed.
+func Respond(ctx context.Context, response proto.Message) {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.response = response
+}
+
+// RecordInTx records the call of ctx, if it carries an idempotency key whose
+// response was set with Respond, in tx, the transaction writing the changes
+// of the call. The response is then recorded if and only if the changes are
+// committed, and a concurrent retry of the call fails tx with
+// errors.VersionMismatch rather than writing the changes twice. Stores call it
+// at the end of every attempt of their write transactions.
+func RecordInTx(ctx context.Context, tx *sql.Tx) error {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response == nil {
+		return nil
+	}
+	response, err := marshalResponse(c.response)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error serializing response for idempotency key")
+	}
+	record := c.record
+	record.Response = response
+	recorded, err := c.store.PutInTx(ctx, tx, c.manager, c.key, &record, c.expires)
+	if err != nil {
+		return err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	c.recorded = recorded
+	return nil
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor replaying, for ttl, the
+// response to a creation or update call carrying an idempotency key to the
+// retries of the call by the same manager. Calls reusing a key for another
+// request are rejected. It must be installed after the auth interceptor
+// identifying the manager. The response is recorded by the transaction
+// writing the changes of the call where the handler and store support it,
+// see RecordInTx, as for the ISA and operational intent writes with
+// CockroachDB, and after the call otherwise. Failed calls are not recorded
+// so that they may be retried.
+func Interceptor(s Store, ttl time.Duration, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := keyFromContext(ctx)
+		manager, ok := auth.ManagerFromContext(ctx)
+		if key == "" || !ok || !isIdempotent(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error serializing request")
+		}
+		hash := sha256.Sum256(serialized)
+		record := &Record{Method: info.FullMethod, RequestHash: hash[:]}
+
+		existing, err := s.Get(ctx, manager.String(), key)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error looking up idempotency key")
+		}
+		if existing != nil {
+			return replay(existing, record, key)
+		}
+
+		c := &call{store: s, manager: manager.String(), key: key, record: *record, expires: time.Now().Add(ttl)}
+		resp, err := handler(context.WithValue(ctx, callKey{}, c), req)
+		if err != nil || c.recorded {
+			return resp, err
+		}
+
+		record.Response, err = marshalResponse(resp)
+		if err != nil {
+			logger.Warn("Failed to serialize response for idempotency key", zap.String("method", info.FullMethod), zap.Error(err))
+			return resp, nil
+		}
+		if err := s.Put(ctx, manager.String(), key, record, c.expires); err != nil {
+			logger.Warn("Failed to record response for idempotency key", zap.String("method", info.FullMethod), zap.Error(err))
+		}
+		return resp, nil
+	}
+}
+
+// replay returns the response recorded in existing for a retry of the call
+// described by record.
+func replay(existing, record *Record, key string) (interface{}, error) {
+	if existing.Method != record.Method || !bytes.Equal(existing.RequestHash, record.RequestHash) {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Idempotency key %s was used for a different request", key)
+	}
+	if existing.Response == nil {
+		return nil, stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "Request with idempotency key %s is still in progress", key)
+	}
+	a := &anypb.Any{}
+	if err := proto.Unmarshal(existing.Response, a); err != nil {
+		return nil, stacktrace.Propagate(err, "Error deserializing recorded response")
+	}
+	resp, err := a.UnmarshalNew()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error deserializing recorded response")
+	}
+	return resp, nil
+}
+
+// marshalResponse serializes resp as an anypb.Any, so that its type may be
+// restored when replaying it.
+func marshalResponse(resp interface{}) ([]byte, error) {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, stacktrace.NewError("Response of type %T is not a proto message", resp)
+	}
+	a, err := anypb.New(msg)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error wrapping response")
+	}
+	return proto.Marshal(a)
+}
+
+// keyFromContext returns the idempotency key of the incoming request in ctx,
+// if any.
+func keyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if vs := md.Get(Header); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// isIdempotent returns true if the gRPC method fullMethod creates or updates
+// an entity, e.g. "/scdpb.Service/CreateOperationalIntentReference".
+func isIdempotent(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, prefix := range []string{"Create", "Update", "Put"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryStore is a Store keeping the Records in process memory, for the
+// memory store backend.
+type MemoryStore struct {
+	lock    sync.Mutex
+	records map[[2]string]*memoryRecord
+}
+
+type memoryRecord struct {
+	Record
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[[2]string]*memoryRecord{}}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, manager, key string) (*Record, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existing, ok := s.records[[2]string{manager, key}]
+	if !ok || existing.expires.Before(time.Now()) {
+		return nil, nil
+	}
+	result := existing.Record
+	return &result, nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(_ context.Context, manager, key string, r *Record, expires time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for k, existing := range s.records {
+		if existing.expires.Before(now) {
+			delete(s.records, k)
+		}
+	}
+	if _, ok := s.records[[2]string{manager, key}]; ok {
+		return alreadyRecorded(key)
+	}
+	s.records[[2]string{manager, key}] = &memoryRecord{Record: *r, expires: expires}
+	return nil
+}
+
+// PutInTx implements Store. Records are kept out of database transactions.
+func (s *MemoryStore) PutInTx(context.Context, *sql.Tx, string, string, *Record, time.Time) (bool, error) {
+	return false, nil
+}
+
+// alreadyRecorded returns the error refusing to record key again.
+func alreadyRecorded(key string) error {
+	return stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "Request with idempotency key %s was made concurrently; retry it", key)
+}
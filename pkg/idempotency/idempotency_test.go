@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/auth"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInterceptorReplaysResponses(t *testing.T) {
+	var (
+		interceptor = Interceptor(NewMemoryStore(), time.Minute, zap.NewNop())
+		info        = &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/CreateSubscription"}
+		calls       int
+		handler     = func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				return nil, stacktrace.NewErrorWithCode(dsserr.Unavailable, "transient")
+			}
+			return &scdpb.PutSubscriptionResponse{
+				Subscription: &scdpb.Subscription{Id: "sub", NotificationIndex: int32(calls)},
+			}, nil
+		}
+		req = &scdpb.CreateSubscriptionRequest{Subscriptionid: "sub"}
+	)
+	call := func(owner dssmodels.Owner, key string, req interface{}) (interface{}, error) {
+		ctx := auth.ContextWithOwner(context.Background(), owner)
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(Header, key))
+		return interceptor(ctx, req, info, handler)
+	}
+
+	// Failed calls are not recorded.
+	_, err := call("uss1", "key1", req)
+	require.Error(t, err)
+
+	resp, err := call("uss1", "key1", req)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), resp.(*scdpb.PutSubscriptionResponse).Subscription.NotificationIndex)
+
+	// Retries are answered with the recorded response.
+	resp, err = call("uss1", "key1", req)
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, int32(2), resp.(*scdpb.PutSubscriptionResponse).Subscription.NotificationIndex)
+
+	// Keys may not be reused for other requests, but are scoped by manager.
+	_, err = call("uss1", "key1", &scdpb.CreateSubscriptionRequest{Subscriptionid: "other"})
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+	_, err = call("uss2", "key1", req)
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+}
+
+// txStore is a MemoryStore writing in transactions, counting the Records
+// written in and out of them.
+type txStore struct {
+	*MemoryStore
+	puts, txPuts int
+}
+
+func (s *txStore) Put(ctx context.Context, manager, key string, r *Record, expires time.Time) error {
+	s.puts++
+	return s.MemoryStore.Put(ctx, manager, key, r, expires)
+}
+
+func (s *txStore) PutInTx(ctx context.Context, _ *sql.Tx, manager, key string, r *Record, expires time.Time) (bool, error) {
+	s.txPuts++
+	return true, s.MemoryStore.Put(ctx, manager, key, r, expires)
+}
+
+func TestInterceptorRecordsInTransaction(t *testing.T) {
+	var (
+		store       = &txStore{MemoryStore: NewMemoryStore()}
+		interceptor = Interceptor(store, time.Minute, zap.NewNop())
+		info        = &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/CreateSubscription"}
+		req         = &scdpb.CreateSubscriptionRequest{Subscriptionid: "sub"}
+		calls       int
+	)
+	// The handler writes its changes in a transaction recording its response,
+	// as the stores do.
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		resp := &scdpb.PutSubscriptionResponse{Subscription: &scdpb.Subscription{Id: "sub"}}
+		Respond(ctx, resp)
+		if err := RecordInTx(ctx, nil); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	ctx := auth.ContextWithOwner(context.Background(), "uss1")
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(Header, "key1"))
+
+	_, err := interceptor(ctx, req, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, 1, store.txPuts)
+	require.Equal(t, 0, store.puts)
+
+	resp, err := interceptor(ctx, req, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, "sub", resp.(*scdpb.PutSubscriptionResponse).Subscription.Id)
+
+	// Calls without idempotency keys are not recorded.
+	Respond(context.Background(), resp.(*scdpb.PutSubscriptionResponse))
+	require.NoError(t, RecordInTx(context.Background(), nil))
+	require.Equal(t, 1, store.txPuts)
+}
+
+func TestMemoryStorePut(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = NewMemoryStore()
+		r     = &Record{Method: "/ridpb.DiscoveryAndSynchronizationService/CreateSubscription"}
+	)
+	require.NoError(t, store.Put(ctx, "uss1", "key1", r, time.Now().Add(time.Minute)))
+	// A concurrent call with the same key fails rather than being recorded.
+	err := store.Put(ctx, "uss1", "key1", r, time.Now().Add(time.Minute))
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+
+	got, err := store.Get(ctx, "uss1", "key1")
+	require.NoError(t, err)
+	require.Equal(t, r, got)
+	got, err = store.Get(ctx, "uss2", "key1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
@@ -0,0 +1,118 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// idempotency_keys table.
+var minSchemaVersion = *semver.New("3.5.0")
+
+// DBStore persists the Records of idempotency keys in the remote ID
+// database, shared by the instances of the pool.
+type DBStore struct {
+	db *cockroach.DB
+	// table is the idempotency_keys table qualified by the name of its
+	// database, so that the transactions of the other databases of the
+	// cluster may write it.
+	table string
+}
+
+// NewDBStore returns a DBStore persisting to db, which must be the database
+// named dbName.
+func NewDBStore(ctx context.Context, db *cockroach.DB, dbName string) (*DBStore, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for idempotency keys")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Idempotency keys require schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	return &DBStore{db: db, table: db.NamePrefix + dbName + ".idempotency_keys"}, nil
+}
+
+// Get implements Store.
+func (s *DBStore) Get(ctx context.Context, manager, key string) (*Record, error) {
+	query := `
+		SELECT
+			method, request_hash, response
+		FROM
+			` + s.table + `
+		WHERE
+			manager = $1
+		AND
+			idempotency_key = $2
+		AND
+			expires_at >= now()`
+
+	r := &Record{}
+	err := s.db.QueryRowContext(ctx, query, manager, key).Scan(&r.Method, &r.RequestHash, &r.Response)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return r, nil
+}
+
+// Put implements Store.
+func (s *DBStore) Put(ctx context.Context, manager, key string, r *Record, expires time.Time) error {
+	return s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		_, err := s.PutInTx(ctx, tx, manager, key, r, expires)
+		return err
+	})
+}
+
+// PutInTx implements Store.
+func (s *DBStore) PutInTx(ctx context.Context, tx *sql.Tx, manager, key string, r *Record, expires time.Time) (bool, error) {
+	deleteExpiredQuery := `
+		DELETE FROM
+			` + s.table + `
+		WHERE
+			manager = $1
+		AND
+			idempotency_key = $2
+		AND
+			expires_at < now()`
+	insertQuery := `
+		INSERT INTO
+			` + s.table + `
+			(manager, idempotency_key, method, request_hash, response, expires_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING`
+
+	if _, err := tx.ExecContext(ctx, deleteExpiredQuery, manager, key); err != nil {
+		return false, stacktrace.Propagate(err, "Error in query: %s", deleteExpiredQuery)
+	}
+	result, err := tx.ExecContext(ctx, insertQuery, manager, key, r.Method, r.RequestHash, r.Response, expires)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "Error in query: %s", insertQuery)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return false, stacktrace.Propagate(err, "Error getting rows affected by query: %s", insertQuery)
+	} else if n == 0 {
+		return false, alreadyRecorded(key)
+	}
+	return true, nil
+}
+
+// DeleteExpired deletes the Records of the expired idempotency keys.
+func (s *DBStore) DeleteExpired(ctx context.Context) error {
+	query := `
+		DELETE FROM
+			` + s.table + `
+		WHERE
+			expires_at < now()`
+
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Package ids mints entity IDs on behalf of clients unable to generate UUIDs
+// themselves and reserves them for a short time to the client they were
+// minted for.
+package ids
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+)
+
+// Version is the UUID version of minted IDs.
+type Version string
+
+const (
+	// V4 IDs are random.
+	V4 Version = "v4"
+	// V7 IDs are prefixed by their creation time in milliseconds so that IDs
+	// minted close in time are close in primary key order.
+	V7 Version = "v7"
+
+	// MaxCount is the maximum number of IDs minted at once.
+	MaxCount = 100
+	// MaxReservations is the maximum number of unexpired IDs reserved to a
+	// client.
+	MaxReservations = 10 * MaxCount
+)
+
+// VersionFromString returns the Version identified by s, defaulting to V4
+// if s is empty.
+func VersionFromString(s string) (Version, error) {
+	switch Version(s) {
+	case "", V4:
+		return V4, nil
+	case V7:
+		return V7, nil
+	}
+	return "", stacktrace.NewErrorWithCode(dsserr.BadRequest, "Unsupported UUID version %s", s)
+}
+
+// New returns a new UUID of version v created at now.
+func New(v Version, now time.Time) (uuid.UUID, error) {
+	switch v {
+	case V4:
+		return uuid.NewRandom()
+	case V7:
+		return newV7(now)
+	}
+	return uuid.Nil, stacktrace.NewError("Unsupported UUID version %s", v)
+}
+
+// newV7 returns a version 7 UUID as specified by RFC 9562: a 48-bit Unix
+// timestamp in milliseconds followed by random bits.
+func newV7(now time.Time) (uuid.UUID, error) {
+	var id uuid.UUID
+	if _, err := rand.Read(id[6:]); err != nil {
+		return uuid.Nil, stacktrace.Propagate(err, "Error reading random bits")
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixNano()/int64(time.Millisecond)))
+	copy(id[:6], ms[2:])
+	id[6] = (id[6] & 0x0f) | 0x70 // Version 7
+	id[8] = (id[8] & 0x3f) | 0x80 // Variant RFC 4122
+	return id, nil
+}
+
+// Reservation is an ID reserved to the client it was minted for until
+// ExpiresAt.
+type Reservation struct {
+	ID        dssmodels.ID `json:"id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+// Store persists the reservations of IDs.
+type Store interface {
+	// Reserve reserves ids to owner until expiresAt, unless owner would then
+	// hold more than max reservations unexpired at now, in which case it
+	// fails with errors.Exhausted.
+	Reserve(ctx context.Context, owner dssmodels.Owner, ids []dssmodels.ID, now, expiresAt time.Time, max int) error
+	// Claim releases the reservation of id, if any, for use by owner. It
+	// fails with errors.PermissionDenied if id is reserved to another owner
+	// at now.
+	Claim(ctx context.Context, id dssmodels.ID, owner dssmodels.Owner, now time.Time) error
+}
+
+// Reserver mints IDs and keeps track of their reservations in a Store. It is
+// safe for concurrent use.
+type Reserver struct {
+	store Store
+	clock clockwork.Clock
+	ttl   time.Duration
+}
+
+// NewReserver returns a Reserver reserving the IDs it mints in store for ttl.
+func NewReserver(store Store, clock clockwork.Clock, ttl time.Duration) *Reserver {
+	return &Reserver{
+		store: store,
+		clock: clock,
+		ttl:   ttl,
+	}
+}
+
+// Mint returns count new IDs of version v reserved to owner. It fails with
+// errors.Exhausted if owner would then hold more than MaxReservations.
+func (r *Reserver) Mint(ctx context.Context, owner dssmodels.Owner, v Version, count int) ([]Reservation, error) {
+	if count < 1 || count > MaxCount {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Count must be between 1 and %d", MaxCount)
+	}
+
+	now := r.clock.Now()
+	expiresAt := now.Add(r.ttl)
+	result := make([]Reservation, 0, count)
+	minted := make([]dssmodels.ID, 0, count)
+	for i := 0; i < count; i++ {
+		id, err := New(v, now)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error minting ID")
+		}
+		result = append(result, Reservation{ID: dssmodels.ID(id.String()), ExpiresAt: expiresAt})
+		minted = append(minted, dssmodels.ID(id.String()))
+	}
+
+	if err := r.store.Reserve(ctx, owner, minted, now, expiresAt, MaxReservations); err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	return result, nil
+}
+
+// Claim releases the reservation of id, if any, for use by owner. It fails if
+// id is reserved to another owner. Claim on a nil Reserver always succeeds.
+func (r *Reserver) Claim(ctx context.Context, id dssmodels.ID, owner dssmodels.Owner) error {
+	if r == nil {
+		return nil
+	}
+	return r.store.Claim(ctx, id, owner, r.clock.Now())
+}
+
+// reservedError returns the error refusing the use of id, reserved to another
+// owner until expiresAt.
+func reservedError(id dssmodels.ID, expiresAt time.Time) error {
+	return stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
+		"ID %s is reserved to another client until %s", id, expiresAt.Format(time.RFC3339))
+}
+
+// exhaustedError returns the error refusing to reserve more IDs to owner.
+func exhaustedError(owner dssmodels.Owner, max int) error {
+	return stacktrace.NewErrorWithCode(dsserr.Exhausted,
+		"Client %s may not hold more than %d ID reservations; use or let some expire first", owner, max)
+}
+
+// MemoryStore is a Store keeping the reservations in process memory, for the
+// memory store backend. Reservations are indexed by owner so that those
+// expired are pruned one owner at a time, in at most MaxReservations steps.
+type MemoryStore struct {
+	lock    sync.Mutex
+	owners  map[dssmodels.ID]dssmodels.Owner
+	byOwner map[dssmodels.Owner]map[dssmodels.ID]time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		owners:  map[dssmodels.ID]dssmodels.Owner{},
+		byOwner: map[dssmodels.Owner]map[dssmodels.ID]time.Time{},
+	}
+}
+
+// Reserve implements Store.
+func (s *MemoryStore) Reserve(_ context.Context, owner dssmodels.Owner, ids []dssmodels.ID, now, expiresAt time.Time, max int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	reserved := s.byOwner[owner]
+	for id, expires := range reserved {
+		if !now.Before(expires) {
+			s.releaseLocked(id, owner)
+		}
+	}
+	if len(s.byOwner[owner])+len(ids) > max {
+		return exhaustedError(owner, max)
+	}
+	if s.byOwner[owner] == nil {
+		s.byOwner[owner] = map[dssmodels.ID]time.Time{}
+	}
+	for _, id := range ids {
+		s.owners[id] = owner
+		s.byOwner[owner][id] = expiresAt
+	}
+	return nil
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(_ context.Context, id dssmodels.ID, owner dssmodels.Owner, now time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	reservedTo, ok := s.owners[id]
+	if !ok {
+		return nil
+	}
+	expiresAt := s.byOwner[reservedTo][id]
+	if reservedTo != owner && now.Before(expiresAt) {
+		return reservedError(id, expiresAt)
+	}
+	s.releaseLocked(id, reservedTo)
+	return nil
+}
+
+func (s *MemoryStore) releaseLocked(id dssmodels.ID, owner dssmodels.Owner) {
+	delete(s.owners, id)
+	delete(s.byOwner[owner], id)
+	if len(s.byOwner[owner]) == 0 {
+		delete(s.byOwner, owner)
+	}
+}
@@ -0,0 +1,83 @@
+package ids
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewV7(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC)
+
+	id, err := New(V7, now)
+	require.NoError(t, err)
+	require.Equal(t, uuid.Version(7), id.Version())
+	require.Equal(t, uuid.RFC4122, id.Variant())
+
+	later, err := New(V7, now.Add(time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, id.String() < later.String())
+}
+
+func TestReserver(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		r     = NewReserver(NewMemoryStore(), clock, time.Minute)
+	)
+
+	_, err := r.Mint(ctx, "uss1", V4, 0)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+	reserved, err := r.Mint(ctx, "uss1", V4, 3)
+	require.NoError(t, err)
+	require.Len(t, reserved, 3)
+
+	// Only the owner may claim a reserved ID, and only once.
+	err = r.Claim(ctx, reserved[0].ID, "uss2")
+	require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+	require.NoError(t, r.Claim(ctx, reserved[0].ID, "uss1"))
+	require.NoError(t, r.Claim(ctx, reserved[0].ID, "uss2"))
+
+	// Reservations lapse after their TTL.
+	clock.Advance(time.Minute)
+	require.NoError(t, r.Claim(ctx, reserved[1].ID, "uss2"))
+
+	// A nil Reserver enforces nothing.
+	var none *Reserver
+	require.NoError(t, none.Claim(ctx, reserved[2].ID, "uss2"))
+}
+
+func TestReserverMaxReservations(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		r     = NewReserver(NewMemoryStore(), clock, time.Minute)
+	)
+
+	for i := 0; i < MaxReservations/MaxCount; i++ {
+		_, err := r.Mint(ctx, "uss1", V4, MaxCount)
+		require.NoError(t, err)
+	}
+	_, err := r.Mint(ctx, "uss1", V4, 1)
+	require.Equal(t, dsserr.Exhausted, stacktrace.GetCode(err))
+
+	// Other clients have their own allowance.
+	_, err = r.Mint(ctx, "uss2", V4, 1)
+	require.NoError(t, err)
+
+	// Claimed and expired reservations no longer count.
+	clock.Advance(30 * time.Second)
+	reserved, err := r.Mint(ctx, "uss2", V4, 1)
+	require.NoError(t, err)
+	require.NoError(t, r.Claim(ctx, reserved[0].ID, "uss2"))
+	clock.Advance(30 * time.Second)
+	_, err = r.Mint(ctx, "uss1", V4, MaxCount)
+	require.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package ids
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// id_reservations table.
+var minSchemaVersion = *semver.New("3.11.0")
+
+// DBStore persists the reservations of IDs in the remote ID database, shared
+// by the instances of the pool, so that they are enforced by all of them and
+// survive restarts.
+type DBStore struct {
+	db *cockroach.DB
+}
+
+// NewDBStore returns a DBStore persisting to db, which must be the database
+// named dbName.
+func NewDBStore(ctx context.Context, db *cockroach.DB, dbName string) (*DBStore, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for ID reservations")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("ID reservations require schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	return &DBStore{db: db}, nil
+}
+
+// Reserve implements Store. The reservations of owner expired at now are
+// deleted through the index by owner, so that the count of those remaining
+// only reads the reservations of owner.
+func (s *DBStore) Reserve(ctx context.Context, owner dssmodels.Owner, ids []dssmodels.ID, now, expiresAt time.Time, max int) error {
+	const (
+		deleteExpiredQuery = `
+			DELETE FROM
+				id_reservations
+			WHERE
+				owner = $1
+			AND
+				expires_at <= $2`
+		countQuery = `
+			SELECT
+				count(*)
+			FROM
+				id_reservations
+			WHERE
+				owner = $1`
+		insertQuery = `
+			INSERT INTO
+				id_reservations
+				(id, owner, expires_at)
+			SELECT
+				unnest($1::UUID[]), $2, $3`
+	)
+
+	uuids := make([]string, len(ids))
+	for i, id := range ids {
+		uuids[i] = id.String()
+	}
+	return s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, deleteExpiredQuery, owner, now); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", deleteExpiredQuery)
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, countQuery, owner).Scan(&count); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", countQuery)
+		}
+		if count+len(ids) > max {
+			return exhaustedError(owner, max)
+		}
+		if _, err := tx.ExecContext(ctx, insertQuery, pq.StringArray(uuids), owner, expiresAt); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", insertQuery)
+		}
+		return nil
+	})
+}
+
+// Claim implements Store.
+func (s *DBStore) Claim(ctx context.Context, id dssmodels.ID, owner dssmodels.Owner, now time.Time) error {
+	const (
+		selectQuery = `
+			SELECT
+				owner, expires_at
+			FROM
+				id_reservations
+			WHERE
+				id = $1`
+		deleteQuery = `
+			DELETE FROM
+				id_reservations
+			WHERE
+				id = $1`
+	)
+
+	return s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		var (
+			reservedTo dssmodels.Owner
+			expiresAt  time.Time
+		)
+		err := tx.QueryRowContext(ctx, selectQuery, id).Scan(&reservedTo, &expiresAt)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", selectQuery)
+		}
+		if reservedTo != owner && now.Before(expiresAt) {
+			return reservedError(id, expiresAt)
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery, id); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", deleteQuery)
+		}
+		return nil
+	})
+}
+
+// DeleteExpired deletes the reservations expired at now, through the index
+// by expiry, outside of the calls minting and claiming IDs.
+func (s *DBStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	const query = `
+		DELETE FROM
+			id_reservations
+		WHERE
+			expires_at <= $1`
+
+	if _, err := s.db.ExecContext(ctx, query, now); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
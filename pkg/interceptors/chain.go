@@ -0,0 +1,59 @@
+package interceptors
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Chain is the interceptor chain of a server, in the order set through the
+// command line flag registered by RegisterFlags.
+type Chain struct {
+	// Default is the comma-separated order of the chain unless set otherwise,
+	// naming the builtins of the server, outermost first.
+	Default string
+	// Required are the names the order may not leave out.
+	Required []string
+
+	order string
+}
+
+// RegisterFlags registers the command line flag setting the order of c in
+// fs.
+func (c *Chain) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.order, "interceptors", c.Default, "comma-separated interceptors of the gRPC calls, outermost first, among "+c.Default+" and those registered with pkg/interceptors by the packages compiled in; those disabled by other flags are left out; must include "+strings.Join(c.Required, ", "))
+}
+
+// Build creates the interceptors of c, in its order, from builtins or the
+// registry, as Assemble does. The builtins named by c.Default but missing
+// from builtins are disabled and left out. The order is logged to logger.
+func (c *Chain) Build(ctx context.Context, builtins map[string]Factory, logger *zap.Logger) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor, error) {
+	order := ParseOrder(c.order)
+	listed := map[string]bool{}
+	for _, name := range order {
+		listed[name] = true
+	}
+	for _, name := range c.Required {
+		if !listed[name] {
+			return nil, nil, stacktrace.NewError("--interceptors must include %s", name)
+		}
+	}
+
+	all := make(map[string]Factory, len(builtins))
+	for _, name := range ParseOrder(c.Default) {
+		all[name] = Of(nil, nil)
+	}
+	for name, f := range builtins {
+		all[name] = f
+	}
+	unary, stream, err := Assemble(ctx, order, all)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to assemble interceptor chain")
+	}
+	logger.Info("config", zap.Strings("interceptors", order), zap.Strings("registered_interceptors", Registered()))
+	return unary, stream, nil
+}
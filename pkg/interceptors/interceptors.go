@@ -0,0 +1,144 @@
+// Package interceptors assembles the gRPC interceptor chain of the DSS from
+// an ordered list of names. Each name identifies a Factory, either one of the
+// DSS's own, supplied to Assemble, or one registered with Register by a
+// package compiled into the backend, e.g. through a blank import in a
+// deployment-specific file, so that deployments can insert their own
+// interceptors anywhere in the chain without modifying the DSS.
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Factory{}
+)
+
+// Interceptor is an element of the chain, intercepting unary calls, streams
+// or both. Either interceptor may be nil.
+type Interceptor struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// Factory creates an Interceptor, which is left out of the chain if zero,
+// as when disabled by the configuration of the instance.
+type Factory func(ctx context.Context) (Interceptor, error)
+
+// Register makes the Factory f available under name to the chains assembled
+// afterwards. It is meant to be called from init functions, and panics if
+// name was already registered.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("interceptor %s registered twice", name))
+	}
+	registry[name] = f
+}
+
+// Registered returns the names registered with Register, sorted.
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseOrder parses s, a comma-separated list of interceptor names.
+func ParseOrder(s string) []string {
+	var order []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// Assemble creates the interceptors named by order, the first being the
+// outermost, from builtins or, for the names builtins lacks, from the
+// registry, and returns their unary and stream chains. Names must be known
+// and appear at most once.
+func Assemble(ctx context.Context, order []string, builtins map[string]Factory) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor, error) {
+	var (
+		unary  []grpc.UnaryServerInterceptor
+		stream []grpc.StreamServerInterceptor
+		seen   = map[string]bool{}
+	)
+	for _, name := range order {
+		if seen[name] {
+			return nil, nil, stacktrace.NewError("Interceptor %s is listed twice", name)
+		}
+		seen[name] = true
+
+		f, ok := builtins[name]
+		if !ok {
+			registryMu.Lock()
+			f, ok = registry[name]
+			registryMu.Unlock()
+		}
+		if !ok {
+			return nil, nil, stacktrace.NewError("Unknown interceptor %s", name)
+		}
+		i, err := f(ctx)
+		if err != nil {
+			return nil, nil, stacktrace.Propagate(err, "Error creating interceptor %s", name)
+		}
+		if i.Unary != nil {
+			unary = append(unary, i.Unary)
+		}
+		if i.Stream != nil {
+			stream = append(stream, i.Stream)
+		}
+	}
+	return unary, stream, nil
+}
+
+// Unary returns a Factory of the unary interceptor i, which is left out if
+// nil.
+func Unary(i grpc.UnaryServerInterceptor) Factory {
+	return func(context.Context) (Interceptor, error) {
+		return Interceptor{Unary: i}, nil
+	}
+}
+
+// Of returns a Factory of the unary interceptor unary and the stream
+// interceptor stream, either of which may be nil.
+func Of(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) Factory {
+	return func(context.Context) (Interceptor, error) {
+		return Interceptor{Unary: unary, Stream: stream}, nil
+	}
+}
+
+// CheckReceived returns ss calling check with each message received from the
+// client, failing the receipt with its error. Streaming handlers receive their
+// requests themselves, so that the stream counterparts of interceptors
+// inspecting requests inspect them through it.
+func CheckReceived(ss grpc.ServerStream, check func(m interface{}) error) grpc.ServerStream {
+	return &checkedStream{ServerStream: ss, check: check}
+}
+
+type checkedStream struct {
+	grpc.ServerStream
+	check func(m interface{}) error
+}
+
+func (s *checkedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.check(m)
+}
@@ -0,0 +1,156 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// tracer returns a Factory of interceptors appending name to calls when
+// called.
+func tracer(name string, calls *[]string, stream bool) Factory {
+	return func(context.Context) (Interceptor, error) {
+		i := Interceptor{
+			Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				*calls = append(*calls, name)
+				return handler(ctx, req)
+			},
+		}
+		if stream {
+			i.Stream = func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				*calls = append(*calls, name)
+				return handler(srv, ss)
+			}
+		}
+		return i, nil
+	}
+}
+
+func disabled(context.Context) (Interceptor, error) {
+	return Interceptor{}, nil
+}
+
+func TestParseOrder(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, ParseOrder(" a,b ,, c,"))
+	require.Empty(t, ParseOrder(""))
+}
+
+func TestAssemble(t *testing.T) {
+	var calls []string
+	builtins := map[string]Factory{
+		"a":   tracer("a", &calls, true),
+		"b":   tracer("b", &calls, false),
+		"off": disabled,
+	}
+	unary, stream, err := Assemble(context.Background(), []string{"b", "off", "a"}, builtins)
+	require.NoError(t, err)
+	require.Len(t, unary, 2)
+	require.Len(t, stream, 1)
+
+	for _, i := range unary {
+		_, err := i(context.Background(), nil, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"b", "a"}, calls)
+}
+
+func TestAssembleErrors(t *testing.T) {
+	builtins := map[string]Factory{
+		"a": disabled,
+		"broken": func(context.Context) (Interceptor, error) {
+			return Interceptor{}, errors.New("broken")
+		},
+	}
+	_, _, err := Assemble(context.Background(), []string{"a", "a"}, builtins)
+	require.Error(t, err)
+
+	_, _, err = Assemble(context.Background(), []string{"a", "missing"}, builtins)
+	require.Error(t, err)
+
+	_, _, err = Assemble(context.Background(), []string{"broken"}, builtins)
+	require.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	var calls []string
+	Register("test_registered", tracer("registered", &calls, false))
+	require.Contains(t, Registered(), "test_registered")
+	require.Panics(t, func() { Register("test_registered", disabled) })
+
+	unary, _, err := Assemble(context.Background(), []string{"test_registered"}, nil)
+	require.NoError(t, err)
+	require.Len(t, unary, 1)
+
+	// Builtins take precedence over the registry.
+	unary, _, err = Assemble(context.Background(), []string{"test_registered"}, map[string]Factory{"test_registered": disabled})
+	require.NoError(t, err)
+	require.Empty(t, unary)
+}
+
+func TestChainBuild(t *testing.T) {
+	var (
+		calls []string
+		ctx   = context.Background()
+		chain = &Chain{Default: "a,off,b", Required: []string{"b"}}
+		fs    = flag.NewFlagSet("test", flag.ContinueOnError)
+	)
+	chain.RegisterFlags(fs)
+	builtins := map[string]Factory{
+		"a": tracer("a", &calls, true),
+		"b": Of(nil, nil),
+	}
+
+	// Default builtins missing from builtins are left out.
+	unary, stream, err := chain.Build(ctx, builtins, zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, unary, 1)
+	require.Len(t, stream, 1)
+
+	require.NoError(t, fs.Parse([]string{"--interceptors=a,off"}))
+	_, _, err = chain.Build(ctx, builtins, zap.NewNop())
+	require.Error(t, err)
+
+	require.NoError(t, fs.Parse([]string{"--interceptors=b,missing"}))
+	_, _, err = chain.Build(ctx, builtins, zap.NewNop())
+	require.Error(t, err)
+}
+
+// receiver receives the messages of msgs, then io.EOF.
+type receiver struct {
+	grpc.ServerStream
+	msgs []string
+}
+
+func (r *receiver) RecvMsg(m interface{}) error {
+	if len(r.msgs) == 0 {
+		return io.EOF
+	}
+	*m.(*string), r.msgs = r.msgs[0], r.msgs[1:]
+	return nil
+}
+
+func TestCheckReceived(t *testing.T) {
+	var checked []string
+	ss := CheckReceived(&receiver{msgs: []string{"a", "b"}}, func(m interface{}) error {
+		checked = append(checked, *m.(*string))
+		if *m.(*string) == "b" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+
+	var m string
+	require.NoError(t, ss.RecvMsg(&m))
+	require.Equal(t, "a", m)
+	require.Error(t, ss.RecvMsg(&m))
+	require.Equal(t, io.EOF, ss.RecvMsg(&m))
+	require.Equal(t, []string{"a", "b"}, checked)
+}
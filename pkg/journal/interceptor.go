@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/audit"
+	"github.com/interuss/dss/pkg/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// appendTimeout bounds the time spent appending an Entry. Entries are
+// appended independently of the context of the call so that calls whose
+// client went away are still journaled.
+const appendTimeout = 5 * time.Second
+
+// Appender appends journal entries.
+type Appender interface {
+	Append(ctx context.Context, e *Entry) error
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor that journals every API
+// call changing the state of the DSS to a. Like the audit log, it must be
+// installed outside of the error interceptor so that the codes it journals
+// are the ones returned to clients. Failures to journal a call are alerted
+// on and do not affect the call, which has already taken effect.
+func Interceptor(a Appender, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if !audit.IsMutation(info.FullMethod) {
+			return resp, err
+		}
+
+		e, jerr := newEntry(ctx, info.FullMethod, req, resp, err)
+		if jerr == nil {
+			actx, cancel := context.WithTimeout(context.Background(), appendTimeout)
+			defer cancel()
+			jerr = a.Append(actx, e)
+		}
+		if jerr != nil {
+			logger.Error("Failed to journal API call",
+				zap.String("alert", "request_journal_failure"), zap.String("method", info.FullMethod), zap.Error(jerr))
+		}
+		return resp, err
+	}
+}
+
+// newEntry returns the Entry of a call of method with req, which returned
+// resp and err.
+func newEntry(ctx context.Context, method string, req, resp interface{}, err error) (*Entry, error) {
+	e := &Entry{
+		Time:   time.Now(),
+		Method: method,
+		Code:   status.Code(err).String(),
+	}
+	if caller, ok := grpc_ctxtags.Extract(ctx).Values()[logging.CallerTag]; ok {
+		e.Subject = fmt.Sprint(caller)
+	}
+	if msg, ok := req.(proto.Message); ok {
+		digest, derr := Digest(msg)
+		if derr != nil {
+			return nil, derr
+		}
+		e.PayloadDigest = digest
+	}
+	if msg, ok := resp.(proto.Message); ok && err == nil {
+		digest, derr := Digest(msg)
+		if derr != nil {
+			return nil, derr
+		}
+		e.ResultDigest = digest
+	}
+	return e, nil
+}
@@ -0,0 +1,182 @@
+// Package journal keeps a signed, hash-chained record of the API calls
+// changing the state of the DSS, so that the airspace authorizations it
+// holds cannot be repudiated by their requesters nor altered afterwards
+// without detection.
+//
+// Every DSS instance appends to its own chain, identified by its locality,
+// so that instances do not contend on a single chain. The hash of each entry
+// covers its fields and the hash of the previous entry of its chain, and is
+// signed with the private key of the instance; a Verifier checks the chains
+// with the matching public key.
+package journal
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/interuss/stacktrace"
+)
+
+// Entry is the record of an API call changing the state of the DSS.
+type Entry struct {
+	// Chain identifies the DSS instance which handled the call, and Seq the
+	// position of the Entry in its chain, starting at 1.
+	Chain string    `json:"chain"`
+	Seq   int64     `json:"seq"`
+	Time  time.Time `json:"time"`
+	// Method is the full gRPC method called, and Subject the subject of the
+	// access token of the caller.
+	Method  string `json:"method"`
+	Subject string `json:"subject"`
+	// PayloadDigest and ResultDigest are the Digests of the request and of
+	// the response, if any.
+	PayloadDigest string `json:"payload_digest"`
+	// Code is the gRPC status code returned to the caller.
+	Code         string `json:"code"`
+	ResultDigest string `json:"result_digest,omitempty"`
+	// PrevHash is the Hash of the previous Entry of the chain, empty for the
+	// first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the hex-encoded SHA-256 of the other fields, and Signature its
+	// base64-encoded RSASSA-PKCS1-v1_5 signature.
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+// computeHash returns the hash of e.
+func (e *Entry) computeHash() string {
+	h := sha256.New()
+	for _, field := range []string{
+		e.Chain,
+		fmt.Sprint(e.Seq),
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.Method,
+		e.Subject,
+		e.PayloadDigest,
+		e.Code,
+		e.ResultDigest,
+		e.PrevHash,
+	} {
+		// Fields are length-prefixed so that no two entries hash the same
+		// content.
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// seal links e to prev, the previous Entry of its chain if any, and signs
+// it with key.
+func (e *Entry) seal(prev *Entry, key *rsa.PrivateKey) error {
+	e.Seq = 1
+	e.PrevHash = ""
+	if prev != nil {
+		e.Seq = prev.Seq + 1
+		e.PrevHash = prev.Hash
+	}
+	// The database keeps timestamps to the microsecond.
+	e.Time = e.Time.UTC().Truncate(time.Microsecond)
+	e.Hash = e.computeHash()
+	digest, err := hex.DecodeString(e.Hash)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error decoding journal entry hash")
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error signing journal entry")
+	}
+	e.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// Verifier checks that the entries of chains, fed in order, form unbroken
+// chains from their first entries, each of them unaltered and signed with the
+// private key of Key.
+type Verifier struct {
+	Key *rsa.PublicKey
+	// Last holds the last entry checked, by chain.
+	Last map[string]*Entry
+}
+
+// Check checks e, the entry following the last entry checked of its chain.
+func (v *Verifier) Check(e *Entry) error {
+	if v.Last == nil {
+		v.Last = map[string]*Entry{}
+	}
+	prev := v.Last[e.Chain]
+	switch {
+	case prev == nil && e.Seq != 1:
+		return stacktrace.NewError("Chain %s starts at entry %d instead of 1", e.Chain, e.Seq)
+	case prev == nil && e.PrevHash != "":
+		return stacktrace.NewError("First entry of chain %s follows another entry", e.Chain)
+	case prev != nil && e.Seq != prev.Seq+1:
+		return stacktrace.NewError("Chain %s misses entries between %d and %d", e.Chain, prev.Seq, e.Seq)
+	case prev != nil && e.PrevHash != prev.Hash:
+		return stacktrace.NewError("Entry %d of chain %s does not follow entry %d", e.Seq, e.Chain, prev.Seq)
+	case e.computeHash() != e.Hash:
+		return stacktrace.NewError("Entry %d of chain %s was altered", e.Seq, e.Chain)
+	}
+	digest, err := hex.DecodeString(e.Hash)
+	if err != nil {
+		return stacktrace.Propagate(err, "Invalid hash of entry %d of chain %s", e.Seq, e.Chain)
+	}
+	signature, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return stacktrace.Propagate(err, "Invalid signature of entry %d of chain %s", e.Seq, e.Chain)
+	}
+	if err := rsa.VerifyPKCS1v15(v.Key, crypto.SHA256, digest, signature); err != nil {
+		return stacktrace.Propagate(err, "Entry %d of chain %s was not signed by the key", e.Seq, e.Chain)
+	}
+	v.Last[e.Chain] = e
+	return nil
+}
+
+// Digest returns the hex-encoded SHA-256 of the canonical JSON encoding of
+// msg: the JSON encoding of the API with its object keys sorted and without
+// insignificant whitespace, so that clients may compute the digests of
+// their requests independently.
+func Digest(msg proto.Message) (string, error) {
+	encoded, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(msg)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error encoding message")
+	}
+	return digestJSON(encoded)
+}
+
+// DigestJSON returns the Digest of v, which is not a message of the API,
+// from its encoding/json encoding, e.g. for the changes requested through
+// the auxiliary endpoints.
+func DigestJSON(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error encoding value")
+	}
+	return digestJSON(string(encoded))
+}
+
+// digestJSON returns the hex-encoded SHA-256 of the canonical form of the
+// JSON document encoded.
+func digestJSON(encoded string) (string, error) {
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return "", stacktrace.Propagate(err, "Error decoding message")
+	}
+	// encoding/json sorts the keys of maps.
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error canonicalizing message")
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,76 @@
+package journal
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var (
+		chain []*Entry
+		prev  *Entry
+	)
+	for i := 0; i < 3; i++ {
+		e := &Entry{
+			Chain:         "dss-1",
+			Time:          time.Now(),
+			Method:        "/ridpb.DiscoveryAndSynchronizationService/CreateSubscription",
+			Subject:       "uss1",
+			PayloadDigest: "digest",
+			Code:          "OK",
+		}
+		require.NoError(t, e.seal(prev, key))
+		chain = append(chain, e)
+		prev = e
+	}
+	require.Equal(t, int64(3), chain[2].Seq)
+
+	verify := func(entries ...*Entry) error {
+		v := &Verifier{Key: &key.PublicKey}
+		for _, e := range entries {
+			if err := v.Check(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	require.NoError(t, verify(chain...))
+
+	// Entries may not be removed, reordered, altered or forged.
+	require.Error(t, verify(chain[0], chain[2]))
+	require.Error(t, verify(chain[1], chain[2]))
+	altered := *chain[1]
+	altered.Subject = "uss2"
+	require.Error(t, verify(chain[0], &altered, chain[2]))
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	require.NoError(t, altered.seal(chain[0], other))
+	require.Error(t, verify(chain[0], &altered))
+}
+
+func TestDigest(t *testing.T) {
+	digest, err := Digest(&ridpb.DeleteSubscriptionRequest{Version: "v1", Id: "4348c8e5-0b1c-43cf-9114-2e67a4532765"})
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(`{"id":"4348c8e5-0b1c-43cf-9114-2e67a4532765","version":"v1"}`))
+	require.Equal(t, hex.EncodeToString(sum[:]), digest)
+}
+
+func TestDigestJSON(t *testing.T) {
+	digest, err := DigestJSON(struct {
+		Version string `json:"version"`
+		ID      string `json:"id"`
+	}{"v1", "4348c8e5-0b1c-43cf-9114-2e67a4532765"})
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(`{"id":"4348c8e5-0b1c-43cf-9114-2e67a4532765","version":"v1"}`))
+	require.Equal(t, hex.EncodeToString(sum[:]), digest)
+}
@@ -0,0 +1,130 @@
+package journal
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"sync"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// request_journal table.
+var minSchemaVersion = *semver.New("3.7.0")
+
+const entryColumns = `chain, seq, recorded_at, method, subject, payload_digest, code, result_digest, prev_hash, hash, signature`
+
+// Store appends the entries of the chain of a DSS instance to the
+// request_journal table of the remote ID database.
+type Store struct {
+	db    *cockroach.DB
+	chain string
+	key   *rsa.PrivateKey
+	// mu serializes the appends of the instance, which would otherwise
+	// conflict on the tail of its chain.
+	mu sync.Mutex
+}
+
+// NewStore returns a Store appending to chain, signing with key, in db,
+// which must be the database named dbName.
+func NewStore(ctx context.Context, db *cockroach.DB, dbName string, chain string, key *rsa.PrivateKey) (*Store, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for request journal")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Request journal requires schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	if chain == "" {
+		return nil, stacktrace.NewError("Request journal requires a chain name")
+	}
+	return &Store{db: db, chain: chain, key: key}, nil
+}
+
+// Append seals e as the next entry of the chain of s and persists it.
+func (s *Store) Append(ctx context.Context, e *Entry) error {
+	const (
+		tailQuery = `
+			SELECT
+				` + entryColumns + `
+			FROM
+				request_journal
+			WHERE
+				chain = $1
+			ORDER BY
+				seq DESC
+			LIMIT 1`
+		insertQuery = `
+			INSERT INTO
+				request_journal
+				(` + entryColumns + `)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Chain = s.chain
+	return s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		prev, err := scanEntry(tx.QueryRowContext(ctx, tailQuery, s.chain))
+		switch {
+		case err == sql.ErrNoRows:
+			prev = nil
+		case err != nil:
+			return stacktrace.Propagate(err, "Error in query: %s", tailQuery)
+		}
+		if err := e.seal(prev, s.key); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, insertQuery,
+			e.Chain, e.Seq, e.Time, e.Method, e.Subject, e.PayloadDigest, e.Code, e.ResultDigest, e.PrevHash, e.Hash, e.Signature)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", insertQuery)
+		}
+		return nil
+	})
+}
+
+// Scan calls f with every entry of the journal in db, chain by chain in
+// order, and stops at the first error returned by f.
+func Scan(ctx context.Context, db *cockroach.DB, f func(*Entry) error) error {
+	const query = `
+		SELECT
+			` + entryColumns + `
+		FROM
+			request_journal
+		ORDER BY
+			chain, seq`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error scanning journal entry row")
+		}
+		if err := f(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return nil
+}
+
+// scanEntry reads an entry from the entryColumns of row.
+func scanEntry(row interface{ Scan(...interface{}) error }) (*Entry, error) {
+	e := &Entry{}
+	err := row.Scan(&e.Chain, &e.Seq, &e.Time, &e.Method, &e.Subject, &e.PayloadDigest, &e.Code, &e.ResultDigest, &e.PrevHash, &e.Hash, &e.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
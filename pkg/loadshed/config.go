@@ -0,0 +1,46 @@
+package loadshed
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/interuss/dss/pkg/interceptors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/summary"
+	"go.uber.org/zap"
+)
+
+// Config is the configuration of the load shedding of an instance.
+type Config struct {
+	Thresholds
+	// SamplePeriod is the period at which the pools are sampled.
+	SamplePeriod time.Duration
+}
+
+// RegisterFlags registers the command line flags setting c in fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.MaxWait, "shed_max_pool_wait", 0, "average time waited for a database connection over a shed_sample_period above which searches are rejected as unavailable, keeping the latency of the calls creating, updating and deleting entities during overload; disabled if 0")
+	fs.IntVar(&c.MaxInUse, "shed_max_connections_in_use", 0, "number of connections of a database pool in use, i.e. of in-flight statements and transactions, above which searches are rejected as unavailable; disabled if 0")
+	fs.DurationVar(&c.SamplePeriod, "shed_sample_period", time.Second, "period at which the database connection pools are sampled for shed_max_pool_wait and shed_max_connections_in_use")
+}
+
+// Factory returns the interceptors.Factory of the interceptors shedding
+// searches while any of the pools of sources is saturated according to c,
+// recording them to r. The pools are sampled every c.SamplePeriod until the
+// context passed to the Factory is done. The interceptors are left out if c
+// sets no threshold or there is no pool.
+func Factory(c Config, sources map[string]StatsSource, r *summary.Recorder) interceptors.Factory {
+	return func(ctx context.Context) (interceptors.Interceptor, error) {
+		if (c.MaxWait <= 0 && c.MaxInUse <= 0) || len(sources) == 0 {
+			return interceptors.Interceptor{}, nil
+		}
+		shedder := New(sources, c.Thresholds)
+		go shedder.Run(ctx, c.SamplePeriod)
+		logging.WithValuesFromContext(ctx, logging.Logger).Info("config", zap.Duration("shed_max_pool_wait", c.MaxWait), zap.Int("shed_max_connections_in_use", c.MaxInUse))
+		return interceptors.Interceptor{
+			Unary:  Interceptor(shedder, r),
+			Stream: StreamInterceptor(shedder, r),
+		}, nil
+	}
+}
@@ -0,0 +1,152 @@
+// Package loadshed rejects the low-priority calls of a DSS instance, its
+// searches, while the pools of connections to its databases are saturated,
+// so that the calls creating, updating and deleting entities keep within
+// their latency objectives during overload.
+package loadshed
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// StatsSource reports the statistics of a pool of database connections,
+// as *sql.DB does.
+type StatsSource interface {
+	Stats() sql.DBStats
+}
+
+// Thresholds are the levels of activity of a pool above which it is
+// saturated.
+type Thresholds struct {
+	// MaxWait is the average time waited for a connection over a sampling
+	// period; ignored if 0.
+	MaxWait time.Duration
+	// MaxInUse is the number of connections in use, i.e. of in-flight
+	// statements and transactions; ignored if 0.
+	MaxInUse int
+}
+
+// Shedder samples the statistics of pools of database connections and
+// sheds the low-priority calls while any of them is saturated.
+type Shedder struct {
+	sources    map[string]StatsSource
+	thresholds Thresholds
+
+	mu       sync.Mutex
+	last     map[string]sql.DBStats
+	shedding string
+}
+
+// New returns a Shedder of the pools of sources, by database name,
+// saturated above thresholds.
+func New(sources map[string]StatsSource, thresholds Thresholds) *Shedder {
+	return &Shedder{
+		sources:    sources,
+		thresholds: thresholds,
+		last:       map[string]sql.DBStats{},
+	}
+}
+
+// Sample updates whether s sheds calls from the current statistics of its
+// pools, the average wait being computed since the previous Sample.
+func (s *Shedder) Sample() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reason string
+	for name, source := range s.sources {
+		stats := source.Stats()
+		last, ok := s.last[name]
+		s.last[name] = stats
+		if s.thresholds.MaxInUse > 0 && stats.InUse > s.thresholds.MaxInUse {
+			reason = name + " connections in use above threshold"
+		}
+		if waits := stats.WaitCount - last.WaitCount; ok && s.thresholds.MaxWait > 0 && waits > 0 {
+			if wait := (stats.WaitDuration - last.WaitDuration) / time.Duration(waits); wait > s.thresholds.MaxWait {
+				reason = name + " connection wait above threshold"
+			}
+		}
+	}
+
+	switch {
+	case reason != "" && s.shedding == "":
+		logging.Logger.Warn("Shedding searches", zap.String("reason", reason))
+	case reason == "" && s.shedding != "":
+		logging.Logger.Info("Stopped shedding searches")
+	}
+	s.shedding = reason
+}
+
+// Shedding returns why s sheds calls, or an empty string if it does not.
+func (s *Shedder) Shedding() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shedding
+}
+
+// Run samples the pools of s every period until ctx is done.
+func (s *Shedder) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sample()
+		}
+	}
+}
+
+// IsSearch returns true if the gRPC method fullMethod searches entities,
+// e.g. "/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas".
+func IsSearch(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, prefix := range []string{"Search", "Query", "Stream"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor failing the searches,
+// as told by IsSearch, with the errors.Unavailable code while s sheds calls,
+// recording them to r.
+func Interceptor(s *Shedder, r *summary.Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !IsSearch(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if reason := s.Shedding(); reason != "" {
+			r.RecordShedCall(info.FullMethod)
+			return nil, stacktrace.NewErrorWithCode(dsserr.Unavailable, "DSS instance overloaded (%s); retry the search later", reason)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a grpc.StreamServerInterceptor failing the
+// streams Interceptor would fail while s sheds calls.
+func StreamInterceptor(s *Shedder, r *summary.Recorder) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !IsSearch(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		if reason := s.Shedding(); reason != "" {
+			r.RecordShedCall(info.FullMethod)
+			return stacktrace.NewErrorWithCode(dsserr.Unavailable, "DSS instance overloaded (%s); retry the search later", reason)
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,134 @@
+package loadshed
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakePool struct {
+	stats sql.DBStats
+}
+
+func (p *fakePool) Stats() sql.DBStats {
+	return p.stats
+}
+
+func TestShedderSample(t *testing.T) {
+	pool := &fakePool{}
+	s := New(map[string]StatsSource{"rid": pool}, Thresholds{MaxWait: 50 * time.Millisecond, MaxInUse: 10})
+
+	s.Sample()
+	require.Empty(t, s.Shedding())
+
+	// 10 waits of 100ms on average.
+	pool.stats.WaitCount = 10
+	pool.stats.WaitDuration = time.Second
+	s.Sample()
+	require.NotEmpty(t, s.Shedding())
+
+	// 10 more waits of 10ms on average.
+	pool.stats.WaitCount = 20
+	pool.stats.WaitDuration = 1100 * time.Millisecond
+	s.Sample()
+	require.Empty(t, s.Shedding())
+
+	pool.stats.InUse = 11
+	s.Sample()
+	require.NotEmpty(t, s.Shedding())
+
+	pool.stats.InUse = 10
+	s.Sample()
+	require.Empty(t, s.Shedding())
+}
+
+func TestIsSearch(t *testing.T) {
+	require.True(t, IsSearch("/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas"))
+	require.True(t, IsSearch("/scdpb.UTMAPIUSSDSSAndUSSUSSService/QueryOperationalIntentReferences"))
+	require.True(t, IsSearch("/ridpb.DiscoveryAndSynchronizationStreamingService/StreamIdentificationServiceAreas"))
+	require.False(t, IsSearch("/scdpb.UTMAPIUSSDSSAndUSSUSSService/PutOperationalIntentReference"))
+	require.False(t, IsSearch("/scdpb.UTMAPIUSSDSSAndUSSUSSService/GetOperationalIntentReference"))
+}
+
+func TestInterceptor(t *testing.T) {
+	pool := &fakePool{}
+	s := New(map[string]StatsSource{"scd": pool}, Thresholds{MaxInUse: 1})
+	r := summary.NewRecorder(clockwork.NewFakeClock())
+	interceptor := Interceptor(s, r)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	query := &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/QueryOperationalIntentReferences"}
+	put := &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/PutOperationalIntentReference"}
+
+	resp, err := interceptor(context.Background(), nil, query, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	pool.stats.InUse = 2
+	s.Sample()
+	_, err = interceptor(context.Background(), nil, query, handler)
+	require.Error(t, err)
+	require.Equal(t, dsserr.Unavailable, stacktrace.GetCode(err))
+	resp, err = interceptor(context.Background(), nil, put, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	require.Equal(t, map[string]int64{query.FullMethod: 1}, r.Rotate().ShedCalls)
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	var (
+		pool        = &fakePool{}
+		s           = New(map[string]StatsSource{"rid": pool}, Thresholds{MaxInUse: 1})
+		r           = summary.NewRecorder(clockwork.NewFakeClock())
+		interceptor = StreamInterceptor(s, r)
+		info        = &grpc.StreamServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationStreamingService/StreamIdentificationServiceAreas"}
+		handled     bool
+	)
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		handled = true
+		return nil
+	}
+
+	require.NoError(t, interceptor(nil, nil, info, handler))
+	require.True(t, handled)
+
+	pool.stats.InUse = 2
+	s.Sample()
+	handled = false
+	err := interceptor(nil, nil, info, handler)
+	require.Equal(t, dsserr.Unavailable, stacktrace.GetCode(err))
+	require.False(t, handled)
+	require.Equal(t, map[string]int64{info.FullMethod: 1}, r.Rotate().ShedCalls)
+}
+
+func TestFactory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		pools = map[string]StatsSource{"rid": &fakePool{}}
+		r     = summary.NewRecorder(clockwork.NewFakeClock())
+	)
+
+	i, err := Factory(Config{SamplePeriod: time.Second}, pools, r)(ctx)
+	require.NoError(t, err)
+	require.Nil(t, i.Unary)
+
+	i, err = Factory(Config{Thresholds: Thresholds{MaxInUse: 10}, SamplePeriod: time.Second}, nil, r)(ctx)
+	require.NoError(t, err)
+	require.Nil(t, i.Unary)
+
+	i, err = Factory(Config{Thresholds: Thresholds{MaxInUse: 10}, SamplePeriod: time.Second}, pools, r)(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, i.Unary)
+	require.NotNil(t, i.Stream)
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/interceptors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// CallerTag is the grpc_ctxtags key under which the identity of the
+	// authenticated caller is recorded for the access log.
+	CallerTag = "caller"
+
+	redactedValue = "<redacted>"
+)
+
+// AccessLogConfig configures the structured access log emitted by
+// AccessLogInterceptor.
+type AccessLogConfig struct {
+	// RequestBodies, if set, adds the requests to the access log. Requests
+	// carry personal data such as the callback URLs and operational details
+	// of USSs, so they are left out unless deployments opt in.
+	RequestBodies bool
+	// RedactedFields lists the (proto) names of request fields whose values
+	// must never appear in the access log when RequestBodies is set. Fields
+	// are matched at any depth.
+	RedactedFields []string
+	// SampleRate is the fraction of successful calls in [0, 1] that are
+	// logged. Failed calls are always logged.
+	SampleRate float64
+}
+
+type entityIDRequest interface {
+	GetId() string
+}
+
+// AccessLogInterceptor returns a grpc.UnaryServerInterceptor that logs every
+// API call to "logger" as a single structured entry including method, caller,
+// entity ID, latency and status code, and the request if config says so.
+//
+// The interceptor is meant to be the outermost interceptor of the chain so
+// that the status code it reports is the one returned to the client.
+func AccessLogInterceptor(logger *zap.Logger, config AccessLogConfig) grpc.UnaryServerInterceptor {
+	redacted := redactedFields(config)
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	tags := grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor))
+
+	log := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, config, redacted, marshaler, info.FullMethod, req, time.Since(start), err)
+		return resp, err
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return tags(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return log(ctx, req, info, handler)
+		})
+	}
+}
+
+// AccessLogStreamInterceptor returns a grpc.StreamServerInterceptor that logs
+// every stream like AccessLogInterceptor does for unary calls, once it ends.
+// The entity ID and request logged are those of the first message received.
+func AccessLogStreamInterceptor(logger *zap.Logger, config AccessLogConfig) grpc.StreamServerInterceptor {
+	redacted := redactedFields(config)
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	tags := grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor))
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return tags(srv, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+			var req interface{}
+			start := time.Now()
+			err := handler(srv, interceptors.CheckReceived(ss, func(m interface{}) error {
+				if req == nil {
+					req = m
+				}
+				return nil
+			}))
+			logCall(ss.Context(), logger, config, redacted, marshaler, info.FullMethod, req, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// redactedFields returns the set of the RedactedFields of config.
+func redactedFields(config AccessLogConfig) map[string]bool {
+	redacted := make(map[string]bool, len(config.RedactedFields))
+	for _, f := range config.RedactedFields {
+		if f != "" {
+			redacted[f] = true
+		}
+	}
+	return redacted
+}
+
+// logCall logs to logger the call to method with req, which took latency and
+// returned err, as configured by config.
+func logCall(ctx context.Context, logger *zap.Logger, config AccessLogConfig, redacted map[string]bool, marshaler jsonpb.Marshaler, method string, req interface{}, latency time.Duration, err error) {
+	if err == nil && config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+		return
+	}
+
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("code", code.String()),
+		zap.Duration("latency", latency),
+	}
+	if caller, ok := grpc_ctxtags.Extract(ctx).Values()[CallerTag]; ok {
+		fields = append(fields, zap.Any("caller", caller))
+	}
+	if r, ok := req.(entityIDRequest); ok && r.GetId() != "" {
+		fields = append(fields, zap.String("entity_id", r.GetId()))
+	}
+	if m, ok := req.(proto.Message); ok && config.RequestBodies {
+		if s, err := marshaler.MarshalToString(m); err == nil {
+			var body interface{}
+			if err := json.Unmarshal([]byte(s), &body); err == nil {
+				fields = append(fields, zap.Any("request", redact(body, redacted)))
+			}
+		}
+	}
+
+	level := grpc_zap.DefaultCodeToLevel(code)
+	if ce := logger.Check(level, "API call"); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// redact replaces the values of all keys in v found in fields.
+func redact(v interface{}, fields map[string]bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if fields[k] {
+				t[k] = redactedValue
+			} else {
+				t[k] = redact(child, fields)
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redact(child, fields)
+		}
+	}
+	return v
+}
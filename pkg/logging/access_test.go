@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAccessLogInterceptor(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		info = &grpc.UnaryServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationService/CreateIdentificationServiceArea"}
+		req  = &ridpb.CreateIdentificationServiceAreaRequest{
+			Id: "64d1b0a4-9cf4-4b3c-a3c8-0b63c0dbdbd2",
+			Params: &ridpb.CreateIdentificationServiceAreaParameters{
+				FlightsUrl: "https://uss1.example.com/flights",
+			},
+		}
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		}
+	)
+	call := func(config AccessLogConfig) map[string]interface{} {
+		core, logs := observer.New(zap.InfoLevel)
+		_, err := AccessLogInterceptor(zap.New(core), config)(ctx, req, info, handler)
+		require.NoError(t, err)
+		require.Equal(t, 1, logs.Len())
+		return logs.All()[0].ContextMap()
+	}
+
+	// Only metadata is logged by default.
+	fields := call(AccessLogConfig{SampleRate: 1})
+	require.Equal(t, info.FullMethod, fields["method"])
+	require.Equal(t, "OK", fields["code"])
+	require.Equal(t, req.Id, fields["entity_id"])
+	require.NotContains(t, fields, "request")
+
+	// Requests are logged on demand, without their redacted fields.
+	fields = call(AccessLogConfig{RequestBodies: true, RedactedFields: []string{"flights_url"}, SampleRate: 1})
+	require.Equal(t, map[string]interface{}{
+		"id":     req.Id,
+		"params": map[string]interface{}{"flights_url": redactedValue},
+	}, fields["request"])
+}
+
+// requestStream receives req, then io.EOF.
+type requestStream struct {
+	grpc.ServerStream
+	req proto.Message
+}
+
+func (s *requestStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *requestStream) RecvMsg(m interface{}) error {
+	if s.req == nil {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.req)
+	s.req = nil
+	return nil
+}
+
+func TestAccessLogStreamInterceptor(t *testing.T) {
+	var (
+		core, logs = observer.New(zap.InfoLevel)
+		info       = &grpc.StreamServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationService/GetIdentificationServiceArea"}
+		req        = &ridpb.GetIdentificationServiceAreaRequest{Id: "64d1b0a4-9cf4-4b3c-a3c8-0b63c0dbdbd2"}
+	)
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			if err := ss.RecvMsg(&ridpb.GetIdentificationServiceAreaRequest{}); err != nil {
+				return status.Error(codes.NotFound, "not found")
+			}
+		}
+	}
+
+	err := AccessLogStreamInterceptor(zap.New(core), AccessLogConfig{SampleRate: 1})(nil, &requestStream{req: req}, info, handler)
+	require.Error(t, err)
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, info.FullMethod, fields["method"])
+	require.Equal(t, "NotFound", fields["code"])
+	require.Equal(t, req.Id, fields["entity_id"])
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"go.uber.org/zap/zapcore"
+)
+
+// IdentityTag is the grpc_ctxtags key under which the Identity of the
+// authenticated caller is recorded, for the interceptors wrapping the one
+// authenticating it to find.
+const IdentityTag = "identity"
+
+// Identity is the identity of an authenticated caller, as claimed by its
+// access token.
+type Identity struct {
+	Subject  string
+	Issuer   string
+	ClientID string
+	Scopes   []string
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, so that i may be
+// logged with zap.Object.
+func (i *Identity) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("sub", i.Subject)
+	enc.AddString("iss", i.Issuer)
+	if i.ClientID != "" {
+		enc.AddString("client_id", i.ClientID)
+	}
+	return enc.AddArray("scopes", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, scope := range i.Scopes {
+			arr.AppendString(scope)
+		}
+		return nil
+	}))
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns ctx carrying identity, which it also records
+// in the tags of ctx, if any.
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	grpc_ctxtags.Extract(ctx).Set(IdentityTag, identity)
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the Identity of the caller of the call of ctx,
+// whether ctx derives from the context ContextWithIdentity returned or only
+// shares its tags, and a boolean indicating whether it is known.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return identity, true
+	}
+	identity, ok := grpc_ctxtags.Extract(ctx).Values()[IdentityTag].(*Identity)
+	return identity, ok
+}
@@ -5,9 +5,6 @@ import (
 	"os"
 
 	"github.com/golang/protobuf/proto"
-	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
-	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -82,18 +79,6 @@ func Configure(level string, format string) error {
 	return setUpLogger(level, format)
 }
 
-// Interceptor returns a grpc.UnaryServerInterceptor that logs incoming requests
-// and associated tags to "logger".
-func Interceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
-	opts := []grpc_zap.Option{
-		grpc_zap.WithLevels(grpc_zap.DefaultCodeToLevel),
-	}
-	return grpc_middleware.ChainUnaryServer(
-		grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
-		grpc_zap.UnaryServerInterceptor(logger, opts...),
-	)
-}
-
 // WithValuesFromContext augments logger with relevant fields from ctx and returns
 // the the resulting logger.
 func WithValuesFromContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
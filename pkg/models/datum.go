@@ -0,0 +1,88 @@
+package models
+
+import (
+	"math"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/units"
+	"github.com/interuss/stacktrace"
+)
+
+// EGM96 is the geoid used to normalize altitudes submitted relative to the
+// EGM96 geoid, or under the standard pressure setting, to the WGS84
+// ellipsoid. Such altitudes are rejected while it is nil.
+var EGM96 geo.Geoid
+
+// altitudeToWGS84 returns altitude, in meters relative to reference, as
+// meters above the WGS84 ellipsoid over footprint. As the geoid undulates
+// across the footprint, upper altitudes are raised to the highest undulation
+// sampled and lower altitudes lowered to the lowest, so that the normalized
+// volume always contains the submitted one.
+func altitudeToWGS84(reference units.Reference, altitude float64, footprint Geometry, upper bool) (float64, error) {
+	switch reference {
+	case units.W84:
+		return altitude, nil
+	case units.EGM96, units.SPS:
+		if EGM96 == nil {
+			return 0, stacktrace.NewError("%s altitudes are not supported by this DSS instance, which has no EGM96 geoid grid; submit %s altitudes instead", reference, units.W84)
+		}
+		samples := footprintSamples(footprint)
+		if len(samples) == 0 {
+			return 0, stacktrace.NewError("%s altitudes require an outline geometry", reference)
+		}
+		bound := math.Inf(1)
+		if upper {
+			bound = math.Inf(-1)
+		}
+		for _, ll := range samples {
+			n := EGM96.Undulation(ll)
+			if upper {
+				bound = math.Max(bound, n)
+			} else {
+				bound = math.Min(bound, n)
+			}
+		}
+		return altitude + bound, nil
+	default:
+		return 0, stacktrace.NewError("Unsupported altitude reference %s", reference)
+	}
+}
+
+// footprintSamples returns the points of footprint the geoid is sampled at
+// when normalizing altitudes: the vertices of a polygon, or the center and
+// corners of the bounding rectangle of a circle.
+func footprintSamples(footprint Geometry) []s2.LatLng {
+	switch t := footprint.(type) {
+	case *GeoPolygon:
+		var result []s2.LatLng
+		for _, v := range t.Vertices {
+			result = append(result, s2.LatLngFromDegrees(v.Lat, v.Lng))
+		}
+		return result
+	case *GeoCircle:
+		center := s2.LatLngFromDegrees(t.Center.Lat, t.Center.Lng)
+		rect := s2.CapFromCenterAngle(
+			s2.PointFromLatLng(center), geo.DistanceMetersToAngle(float64(t.RadiusMeter)),
+		).RectBound()
+		return []s2.LatLng{center, rect.Vertex(0), rect.Vertex(1), rect.Vertex(2), rect.Vertex(3)}
+	}
+	return nil
+}
+
+// AltitudeReferences returns the vertical datums of the altitudes accepted
+// by this instance: those other than WGS84 require EGM96.
+func AltitudeReferences() []units.Reference {
+	if EGM96 == nil {
+		return []units.Reference{units.W84}
+	}
+	return []units.Reference{units.W84, units.EGM96, units.SPS}
+}
+
+// referenceIfNotWGS84 returns reference, or an empty string if it is WGS84.
+func referenceIfNotWGS84(reference units.Reference) string {
+	if reference == units.W84 {
+		return ""
+	}
+	return reference.String()
+}
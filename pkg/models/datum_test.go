@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/units"
+	"github.com/stretchr/testify/require"
+)
+
+// slopedGeoid rises by one meter per degree of longitude.
+type slopedGeoid struct{}
+
+func (slopedGeoid) Undulation(ll s2.LatLng) float64 {
+	return ll.Lng.Degrees()
+}
+
+func TestVolume3DFromSCDProtoEGM96(t *testing.T) {
+	vol3 := &scdpb.Volume3D{
+		OutlinePolygon: &scdpb.Polygon{Vertices: []*scdpb.LatLngPoint{
+			{Lat: 0, Lng: 10}, {Lat: 1, Lng: 12}, {Lat: 0, Lng: 14},
+		}},
+		AltitudeLower: &scdpb.Altitude{Reference: ReferenceEGM96, Units: UnitsM, Value: 100},
+		AltitudeUpper: &scdpb.Altitude{Reference: ReferenceEGM96, Units: UnitsM, Value: 200},
+	}
+
+	EGM96 = nil
+	_, err := Volume3DFromSCDProto(vol3)
+	require.Error(t, err)
+	require.Equal(t, []units.Reference{units.W84}, AltitudeReferences())
+
+	EGM96 = slopedGeoid{}
+	defer func() { EGM96 = nil }()
+	require.Equal(t, []units.Reference{units.W84, units.EGM96, units.SPS}, AltitudeReferences())
+	got, err := Volume3DFromSCDProto(vol3)
+	require.NoError(t, err)
+	require.Equal(t, ReferenceEGM96, got.AltitudeReference)
+	require.InDelta(t, 110, *got.AltitudeLo, 1e-3)
+	require.InDelta(t, 214, *got.AltitudeHi, 1e-3)
+
+	vol3.OutlinePolygon = nil
+	_, err = Volume3DFromSCDProto(vol3)
+	require.Error(t, err)
+
+	vol3.AltitudeUpper.Reference = ReferenceW84
+	vol3.AltitudeLower = nil
+	got, err = Volume3DFromSCDProto(vol3)
+	require.NoError(t, err)
+	require.Empty(t, got.AltitudeReference)
+	require.InDelta(t, 200, *got.AltitudeHi, 1e-3)
+}
+
+func TestVolume3DFromSCDProtoFeet(t *testing.T) {
+	vol3 := &scdpb.Volume3D{
+		OutlineCircle: &scdpb.Circle{
+			Center: &scdpb.LatLngPoint{Lat: 46.2, Lng: 6.1},
+			Radius: &scdpb.Radius{Units: UnitsM, Value: 100},
+		},
+		AltitudeLower: &scdpb.Altitude{Reference: ReferenceW84, Units: "FT", Value: 100},
+		AltitudeUpper: &scdpb.Altitude{Reference: ReferenceW84, Units: UnitsM, Value: 120},
+	}
+	got, err := Volume3DFromSCDProto(vol3)
+	require.NoError(t, err)
+	require.InDelta(t, 30.48, *got.AltitudeLo, 1e-3)
+	require.InDelta(t, 120, *got.AltitudeHi, 1e-3)
+
+	// The altitudes are output as submitted.
+	out, err := got.ToSCDProto()
+	require.NoError(t, err)
+	require.Equal(t, vol3.AltitudeLower, out.AltitudeLower)
+	require.Equal(t, vol3.AltitudeUpper, out.AltitudeUpper)
+
+	vol3.AltitudeLower.Units = "NM"
+	_, err = Volume3DFromSCDProto(vol3)
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/units"
 	"github.com/interuss/stacktrace"
 )
 
@@ -15,8 +16,9 @@ const (
 	maxLat            = 90.0
 	minLng            = -180.0
 	maxLng            = 180.0
-	UnitsM            = "M"
-	ReferenceW84      = "W84"
+	UnitsM            = string(units.Meters)
+	ReferenceW84      = string(units.W84)
+	ReferenceEGM96    = string(units.EGM96)
 )
 
 var (
@@ -24,18 +26,10 @@ var (
 		unitMeter: 1,
 	}
 
-	altitudeReferenceWGS84 altitudeReference = "W84"
-	unitMeter              unit              = "M"
+	unitMeter unit = "M"
 )
 
-type (
-	altitudeReference string
-	unit              string
-)
-
-func (ar altitudeReference) String() string {
-	return string(ar)
-}
+type unit string
 
 func (u unit) String() string {
 	return string(u)
@@ -70,6 +64,15 @@ type Volume3D struct {
 	AltitudeLo *float32
 	// Projection of this volume onto the earth's surface.
 	Footprint Geometry
+	// Vertical datum the altitudes of this volume were submitted in, before
+	// being normalized to WGS84. Empty if they were submitted in WGS84 or,
+	// for a union of volumes, in different datums.
+	AltitudeReference string
+	// Altitudes of this volume as submitted, in their original unit and
+	// reference, which are output in place of AltitudeHi and AltitudeLo.
+	// Nil unless the volume was converted from the API; not kept by stores.
+	SubmittedAltitudeHi *units.Altitude
+	SubmittedAltitudeLo *units.Altitude
 }
 
 // Geometry models a geometry.
@@ -81,22 +84,31 @@ type Geometry interface {
 // GeometryFunc is an implementation of Geometry
 type GeometryFunc func() (s2.CellUnion, error)
 
-type precomputedCellGeometry map[s2.CellID]struct{}
+// precomputedCellGeometry is the union of parts, whose coverings are
+// computed as they are merged.
+type precomputedCellGeometry struct {
+	cells map[s2.CellID]struct{}
+	parts []Geometry
+}
 
-func (pcg precomputedCellGeometry) merge(ids ...s2.CellID) precomputedCellGeometry {
+func (pcg *precomputedCellGeometry) merge(part Geometry, ids ...s2.CellID) *precomputedCellGeometry {
+	if pcg.cells == nil {
+		pcg.cells = map[s2.CellID]struct{}{}
+	}
 	for _, id := range ids {
-		pcg[id] = struct{}{}
+		pcg.cells[id] = struct{}{}
 	}
+	pcg.parts = append(pcg.parts, part)
 	return pcg
 }
 
-func (pcg precomputedCellGeometry) CalculateCovering() (s2.CellUnion, error) {
+func (pcg *precomputedCellGeometry) CalculateCovering() (s2.CellUnion, error) {
 	var (
-		result = make(s2.CellUnion, len(pcg))
+		result = make(s2.CellUnion, len(pcg.cells))
 		idx    int
 	)
 
-	for id := range pcg {
+	for id := range pcg.cells {
 		result[idx] = id
 		idx++
 	}
@@ -112,6 +124,9 @@ func (pcg precomputedCellGeometry) CalculateCovering() (s2.CellUnion, error) {
 // * geo.ErrRadiusMustBeLargerThan0
 func UnionVolumes4D(volumes ...*Volume4D) (*Volume4D, error) {
 	result := &Volume4D{}
+	// referenced is true once the reference of a volume with altitudes has
+	// been merged into the result.
+	referenced := false
 
 	for _, volume := range volumes {
 		if volume.EndTime != nil {
@@ -159,6 +174,16 @@ func UnionVolumes4D(volumes ...*Volume4D) (*Volume4D, error) {
 				}
 			}
 
+			if volume.SpatialVolume.AltitudeLo != nil || volume.SpatialVolume.AltitudeHi != nil {
+				switch {
+				case !referenced:
+					result.SpatialVolume.AltitudeReference = volume.SpatialVolume.AltitudeReference
+					referenced = true
+				case result.SpatialVolume.AltitudeReference != volume.SpatialVolume.AltitudeReference:
+					result.SpatialVolume.AltitudeReference = ""
+				}
+			}
+
 			if volume.SpatialVolume.Footprint != nil {
 				cells, err := volume.SpatialVolume.Footprint.CalculateCovering()
 				if err != nil {
@@ -166,9 +191,9 @@ func UnionVolumes4D(volumes ...*Volume4D) (*Volume4D, error) {
 				}
 
 				if result.SpatialVolume.Footprint == nil {
-					result.SpatialVolume.Footprint = precomputedCellGeometry{}
+					result.SpatialVolume.Footprint = &precomputedCellGeometry{}
 				}
-				result.SpatialVolume.Footprint.(precomputedCellGeometry).merge(cells...)
+				result.SpatialVolume.Footprint.(*precomputedCellGeometry).merge(volume.SpatialVolume.Footprint, cells...)
 			}
 		}
 	}
@@ -230,11 +255,16 @@ func (gc *GeoCircle) CalculateCovering() (s2.CellUnion, error) {
 	}
 
 	// TODO: Use an S2 Cap as an inscribed polygon does not fully cover the defined circle
-	return geo.RegionCoverer.Covering(s2.RegularLoop(
+	return geo.RegionCoverer.Covering(gc.loop()), nil
+}
+
+// loop returns the polygon inscribed in gc standing for it.
+func (gc *GeoCircle) loop() *s2.Loop {
+	return s2.RegularLoop(
 		s2.PointFromLatLng(s2.LatLngFromDegrees(gc.Center.Lat, gc.Center.Lng)),
 		geo.DistanceMetersToAngle(float64(gc.RadiusMeter)),
 		20,
-	)), nil
+	)
 }
 
 // GeoPolygon models an enclosed area on the earth.
@@ -53,3 +53,24 @@ func TestPolygonCovering(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, want, got)
 }
+
+func TestUnionVolumes4DAltitudeReference(t *testing.T) {
+	var (
+		lo, hi = float32(10), float32(20)
+		egm96  = &Volume4D{SpatialVolume: &Volume3D{AltitudeLo: &lo, AltitudeHi: &hi, AltitudeReference: ReferenceEGM96}}
+		w84    = &Volume4D{SpatialVolume: &Volume3D{AltitudeLo: &lo, AltitudeHi: &hi}}
+		flat   = &Volume4D{SpatialVolume: &Volume3D{}}
+	)
+
+	got, err := UnionVolumes4D(egm96, flat, egm96)
+	require.NoError(t, err)
+	require.Equal(t, ReferenceEGM96, got.SpatialVolume.AltitudeReference)
+
+	// Volumes submitted in different datums are reported in WGS84.
+	got, err = UnionVolumes4D(egm96, w84)
+	require.NoError(t, err)
+	require.Empty(t, got.SpatialVolume.AltitudeReference)
+	got, err = UnionVolumes4D(w84, egm96)
+	require.NoError(t, err)
+	require.Empty(t, got.SpatialVolume.AltitudeReference)
+}
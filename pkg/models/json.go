@@ -0,0 +1,53 @@
+package models
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/interuss/stacktrace"
+)
+
+var (
+	// apiMarshaler encodes protos in the wire format of the HTTP gateway:
+	// the field names of the OpenAPI specs, with default values so that
+	// empty lists are present.
+	apiMarshaler = &jsonpb.Marshaler{OrigName: true, EmitDefaults: true}
+	// apiUnmarshaler decodes protos in the wire format of the HTTP gateway,
+	// ignoring the fields unknown to this version of the DSS.
+	apiUnmarshaler = &jsonpb.Unmarshaler{AllowUnknownFields: true}
+)
+
+// MarshalAPIJSON returns the encoding of m in the wire format of the APIs,
+// from which the JSON encodings of the entity models derive.
+func MarshalAPIJSON(m proto.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := apiMarshaler.Marshal(&buf, m); err != nil {
+		return nil, stacktrace.Propagate(err, "Error encoding %T", m)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalAPIJSON decodes data, in the wire format of the APIs, into m.
+func UnmarshalAPIJSON(data []byte, m proto.Message) error {
+	if err := apiUnmarshaler.Unmarshal(bytes.NewReader(data), m); err != nil {
+		return stacktrace.Propagate(err, "Error decoding %T", m)
+	}
+	return nil
+}
+
+// OptionalTimeFromProto converts ts, emitted by TimestampProto, returning nil
+// if ts is nil. Unlike TimeChecks, it accepts any valid timestamp.
+func OptionalTimeFromProto(ts *timestamp.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid timestamp")
+	}
+	return &t, nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+)
+
+// DefaultMaxSubscriptionDuration is the longest time range of a subscription
+// allowed by ASTM F3411-19 and F3548-21.
+const DefaultMaxSubscriptionDuration = 24 * time.Hour
+
+// Limits bounds the extents of the entities accepted by the DSS, protecting
+// the cell index from pathological entities. Entities whose lower altitude
+// is above their upper altitude are always implausible; beyond that, the
+// zero value imposes no limit.
+type Limits struct {
+	// MaxCells is the largest number of cells an entity may cover, unbounded
+	// if zero.
+	MaxCells int
+	// MaxDuration is the largest interval between the start and the end of
+	// an entity, unbounded if zero.
+	MaxDuration time.Duration
+	// MinAltitude and MaxAltitude, if set, bound the altitudes in meters of
+	// an entity.
+	MinAltitude *float32
+	MaxAltitude *float32
+	// MaxSubscriptionDuration is the largest interval between the start and
+	// the end of a subscription, DefaultMaxSubscriptionDuration if zero.
+	MaxSubscriptionDuration time.Duration
+	// TruncateSubscriptions makes subscriptions exceeding
+	// MaxSubscriptionDuration end at the limit instead of being rejected.
+	TruncateSubscriptions bool
+}
+
+// SubscriptionDuration returns the largest interval between the start and the
+// end of a subscription.
+func (l Limits) SubscriptionDuration() time.Duration {
+	if l.MaxSubscriptionDuration > 0 {
+		return l.MaxSubscriptionDuration
+	}
+	return DefaultMaxSubscriptionDuration
+}
+
+// BoundSubscriptionEnd returns end if a subscription starting at start may
+// end then. Otherwise, it returns the latest end allowed if subscriptions are
+// truncated, or a BadRequest error.
+func (l Limits) BoundSubscriptionEnd(start, end time.Time) (time.Time, error) {
+	max := l.SubscriptionDuration()
+	if end.Sub(start) <= max {
+		return end, nil
+	}
+	if l.TruncateSubscriptions {
+		return start.Add(max), nil
+	}
+	return time.Time{}, stacktrace.NewErrorWithCode(dsserr.BadRequest,
+		"Subscription window of %s exceeds the limit of %s", end.Sub(start), max)
+}
+
+// Check returns a BadRequest error describing the first limit exceeded by
+// an entity covering cells between start and end and between altitudes lo
+// and hi, any of which may be unset.
+func (l Limits) Check(cells s2.CellUnion, start, end *time.Time, lo, hi *float32) error {
+	if l.MaxCells > 0 && len(cells) > l.MaxCells {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+			"Area covers %d cells, exceeding the limit of %d", len(cells), l.MaxCells)
+	}
+	if l.MaxDuration > 0 && start != nil && end != nil && end.Sub(*start) > l.MaxDuration {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+			"Duration of %s exceeds the limit of %s", end.Sub(*start), l.MaxDuration)
+	}
+	if lo != nil && hi != nil && *lo > *hi {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+			"Lower altitude %g is above upper altitude %g", *lo, *hi)
+	}
+	for _, altitude := range []*float32{lo, hi} {
+		if altitude == nil {
+			continue
+		}
+		if l.MinAltitude != nil && *altitude < *l.MinAltitude {
+			return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+				"Altitude %g is below the limit of %g", *altitude, *l.MinAltitude)
+		}
+		if l.MaxAltitude != nil && *altitude > *l.MaxAltitude {
+			return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+				"Altitude %g is above the limit of %g", *altitude, *l.MaxAltitude)
+		}
+	}
+	return nil
+}
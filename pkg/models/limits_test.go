@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	var (
+		start  = time.Now()
+		end    = start.Add(2 * time.Hour)
+		cells  = s2.CellUnion{s2.CellIDFromToken("89c25"), s2.CellIDFromToken("89c27")}
+		lo     = float32(10)
+		hi     = float32(100)
+		floor  = float32(-500)
+		ceil   = float32(50)
+		limits = Limits{MaxCells: 2, MaxDuration: 2 * time.Hour}
+	)
+	require.NoError(t, Limits{}.Check(cells, &start, &end, &lo, &hi))
+	require.NoError(t, limits.Check(cells, &start, &end, &lo, &hi))
+	require.NoError(t, limits.Check(nil, nil, nil, nil, nil))
+
+	for _, err := range []error{
+		Limits{MaxCells: 1}.Check(cells, &start, &end, &lo, &hi),
+		Limits{MaxDuration: time.Hour}.Check(cells, &start, &end, &lo, &hi),
+		Limits{}.Check(cells, &start, &end, &hi, &lo),
+		Limits{MinAltitude: &floor, MaxAltitude: &ceil}.Check(cells, &start, &end, &lo, &hi),
+	} {
+		require.Error(t, err)
+		require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+	}
+}
+
+func TestBoundSubscriptionEnd(t *testing.T) {
+	start := time.Now()
+
+	end, err := Limits{}.BoundSubscriptionEnd(start, start.Add(DefaultMaxSubscriptionDuration))
+	require.NoError(t, err)
+	require.Equal(t, start.Add(DefaultMaxSubscriptionDuration), end)
+
+	_, err = Limits{MaxSubscriptionDuration: time.Hour}.BoundSubscriptionEnd(start, start.Add(2*time.Hour))
+	require.Error(t, err)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+	end, err = Limits{MaxSubscriptionDuration: time.Hour, TruncateSubscriptions: true}.BoundSubscriptionEnd(start, start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, start.Add(time.Hour), end)
+}
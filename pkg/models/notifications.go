@@ -0,0 +1,14 @@
+package models
+
+import "math"
+
+// MaxNotificationIndex is the largest notification index of a subscription
+// representable in the ASTM APIs. Notification indices are stored as 64-bit
+// integers, and wrap around to 0 past MaxNotificationIndex when served.
+const MaxNotificationIndex = math.MaxInt32
+
+// NotificationIndexToProto returns the notification index served for a
+// subscription notified index times since it was created or reset.
+func NotificationIndexToProto(index int) int32 {
+	return int32(int64(index) % (MaxNotificationIndex + 1))
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationIndexToProto(t *testing.T) {
+	for _, tc := range []struct {
+		index int
+		want  int32
+	}{
+		{0, 0},
+		{42, 42},
+		{MaxNotificationIndex, MaxNotificationIndex},
+		{MaxNotificationIndex + 1, 0},
+		{MaxNotificationIndex + 43, 42},
+		{2*MaxNotificationIndex + 2, 0},
+	} {
+		require.Equal(t, tc.want, NotificationIndexToProto(tc.index), "index %d", tc.index)
+	}
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/interuss/dss/pkg/api/v1/ridpb"
@@ -22,7 +21,7 @@ func Volume4DFromRIDProto(vol4 *ridpb.Volume4D) (*Volume4D, error) {
 	}
 
 	if startTime := vol4.GetTimeStart(); startTime != nil {
-		ts, err := ptypes.Timestamp(startTime)
+		ts, err := RequestTimes.FromProto(startTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time from proto")
 		}
@@ -30,7 +29,7 @@ func Volume4DFromRIDProto(vol4 *ridpb.Volume4D) (*Volume4D, error) {
 	}
 
 	if endTime := vol4.GetTimeEnd(); endTime != nil {
-		ts, err := ptypes.Timestamp(endTime)
+		ts, err := RequestTimes.FromProto(endTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time from proto")
 		}
@@ -90,7 +89,7 @@ func (vol4 *Volume4D) ToRIDProto() (*ridpb.Volume4D, error) {
 	}
 
 	if vol4.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*vol4.StartTime)
+		ts, err := TimestampProto(*vol4.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time from proto")
 		}
@@ -98,7 +97,7 @@ func (vol4 *Volume4D) ToRIDProto() (*ridpb.Volume4D, error) {
 	}
 
 	if vol4.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*vol4.EndTime)
+		ts, err := TimestampProto(*vol4.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time from proto")
 		}
@@ -1,9 +1,8 @@
 package models
 
 import (
-	"github.com/golang/protobuf/ptypes"
-
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/units"
 	"github.com/interuss/stacktrace"
 )
 
@@ -19,8 +18,7 @@ func Volume4DFromSCDProto(vol4 *scdpb.Volume4D) (*Volume4D, error) {
 	}
 
 	if startTime := vol4.GetTimeStart(); startTime != nil {
-		st := startTime.GetValue()
-		ts, err := ptypes.Timestamp(st)
+		ts, err := RequestTimes.FromSCDProto(startTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time from proto")
 		}
@@ -28,8 +26,7 @@ func Volume4DFromSCDProto(vol4 *scdpb.Volume4D) (*Volume4D, error) {
 	}
 
 	if endTime := vol4.GetTimeEnd(); endTime != nil {
-		et := endTime.GetValue()
-		ts, err := ptypes.Timestamp(et)
+		ts, err := RequestTimes.FromSCDProto(endTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time from proto")
 		}
@@ -45,51 +42,52 @@ func Volume3DFromSCDProto(vol3 *scdpb.Volume3D) (*Volume3D, error) {
 		return nil, nil
 	}
 
-	altitudeLower := vol3.GetAltitudeLower()
-	var altLo *float32
-	if altitudeLower != nil {
-		if altitudeLower.Units != UnitsM {
-			return nil, stacktrace.NewError("Invalid lower altitude unit")
-		}
-		if altitudeLower.Reference != ReferenceW84 {
-			return nil, stacktrace.NewError("Invalid lower altitude reference")
-		}
-		altLo = float32p(float32(altitudeLower.GetValue()))
+	var footprint Geometry
+	switch {
+	case vol3.GetOutlineCircle() != nil && vol3.GetOutlinePolygon() != nil:
+		return nil, stacktrace.NewError("Both circle and polygon specified in outline geometry")
+	case vol3.GetOutlinePolygon() != nil:
+		footprint = GeoPolygonFromSCDProto(vol3.GetOutlinePolygon())
+	case vol3.GetOutlineCircle() != nil:
+		footprint = GeoCircleFromSCDProto(vol3.GetOutlineCircle())
 	}
 
-	altitudeUpper := vol3.GetAltitudeUpper()
-	var altHi *float32
-	if altitudeUpper != nil {
-		if altitudeUpper.Units != UnitsM {
-			return nil, stacktrace.NewError("Invalid upper altitude unit")
+	result := &Volume3D{Footprint: footprint}
+
+	if altitudeLower := vol3.GetAltitudeLower(); altitudeLower != nil {
+		submitted, err := units.ParseAltitude(altitudeLower.GetValue(), altitudeLower.GetUnits(), altitudeLower.GetReference())
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid lower altitude")
 		}
-		if altitudeUpper.Reference != ReferenceW84 {
-			return nil, stacktrace.NewError("Invalid upper altitude reference")
+		altLo, err := altitudeToWGS84(submitted.Reference, submitted.Meters(), footprint, false)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid lower altitude")
 		}
-		altHi = float32p(float32(altitudeUpper.GetValue()))
+		result.AltitudeLo = float32p(float32(altLo))
+		result.SubmittedAltitudeLo = submitted
+		result.AltitudeReference = referenceIfNotWGS84(submitted.Reference)
 	}
 
-	switch {
-	case vol3.GetOutlineCircle() != nil && vol3.GetOutlinePolygon() != nil:
-		return nil, stacktrace.NewError("Both circle and polygon specified in outline geometry")
-	case vol3.GetOutlinePolygon() != nil:
-		return &Volume3D{
-			Footprint:  GeoPolygonFromSCDProto(vol3.GetOutlinePolygon()),
-			AltitudeLo: altLo,
-			AltitudeHi: altHi,
-		}, nil
-	case vol3.GetOutlineCircle() != nil:
-		return &Volume3D{
-			Footprint:  GeoCircleFromSCDProto(vol3.GetOutlineCircle()),
-			AltitudeLo: altLo,
-			AltitudeHi: altHi,
-		}, nil
+	if altitudeUpper := vol3.GetAltitudeUpper(); altitudeUpper != nil {
+		submitted, err := units.ParseAltitude(altitudeUpper.GetValue(), altitudeUpper.GetUnits(), altitudeUpper.GetReference())
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid upper altitude")
+		}
+		altHi, err := altitudeToWGS84(submitted.Reference, submitted.Meters(), footprint, true)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid upper altitude")
+		}
+		result.AltitudeHi = float32p(float32(altHi))
+		result.SubmittedAltitudeHi = submitted
+		if reference := referenceIfNotWGS84(submitted.Reference); reference != "" {
+			if result.AltitudeReference != "" && result.AltitudeReference != reference {
+				return nil, stacktrace.NewError("Lower and upper altitudes use different references")
+			}
+			result.AltitudeReference = reference
+		}
 	}
 
-	return &Volume3D{
-		AltitudeLo: altLo,
-		AltitudeHi: altHi,
-	}, nil
+	return result, nil
 }
 
 // GeoCircleFromSCDProto converts a circle proto to a GeoCircle
@@ -130,7 +128,7 @@ func (vol4 *Volume4D) ToSCDProto() (*scdpb.Volume4D, error) {
 	}
 
 	if vol4.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*vol4.StartTime)
+		ts, err := TimestampProto(*vol4.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -141,7 +139,7 @@ func (vol4 *Volume4D) ToSCDProto() (*scdpb.Volume4D, error) {
 	}
 
 	if vol4.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*vol4.EndTime)
+		ts, err := TimestampProto(*vol4.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -163,19 +161,11 @@ func (vol3 *Volume3D) ToSCDProto() (*scdpb.Volume3D, error) {
 	result := &scdpb.Volume3D{}
 
 	if vol3.AltitudeLo != nil {
-		result.AltitudeLower = &scdpb.Altitude{
-			Reference: altitudeReferenceWGS84.String(),
-			Units:     unitMeter.String(),
-			Value:     float64(*vol3.AltitudeLo),
-		}
+		result.AltitudeLower = altitudeToSCDProto(vol3.SubmittedAltitudeLo, *vol3.AltitudeLo)
 	}
 
 	if vol3.AltitudeHi != nil {
-		result.AltitudeUpper = &scdpb.Altitude{
-			Reference: altitudeReferenceWGS84.String(),
-			Units:     unitMeter.String(),
-			Value:     float64(*vol3.AltitudeHi),
-		}
+		result.AltitudeUpper = altitudeToSCDProto(vol3.SubmittedAltitudeHi, *vol3.AltitudeHi)
 	}
 
 	switch t := vol3.Footprint.(type) {
@@ -190,6 +180,19 @@ func (vol3 *Volume3D) ToSCDProto() (*scdpb.Volume3D, error) {
 	return result, nil
 }
 
+// altitudeToSCDProto converts the altitude submitted, if known, or meters
+// above the WGS84 ellipsoid otherwise, to a proto.
+func altitudeToSCDProto(submitted *units.Altitude, meters float32) *scdpb.Altitude {
+	if submitted == nil {
+		submitted = units.WGS84Meters(float64(meters))
+	}
+	return &scdpb.Altitude{
+		Reference: submitted.Reference.String(),
+		Units:     submitted.Unit.String(),
+		Value:     submitted.Value,
+	}
+}
+
 // ToSCDProto converts the GeoCircle to a proto
 func (gc *GeoCircle) ToSCDProto() *scdpb.Circle {
 	if gc == nil {
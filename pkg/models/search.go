@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// SearchOrder determines the order of the results of a search.
+type SearchOrder string
+
+const (
+	// SearchOrderDefault leaves the order of search results unspecified.
+	SearchOrderDefault SearchOrder = ""
+	// SearchOrderRelevance returns the entities active now first, followed
+	// by the others in order of increasing temporal distance to now.
+	SearchOrderRelevance SearchOrder = "relevance"
+
+	// SearchOrderHeader is the request header (gRPC metadata key) through
+	// which clients request a SearchOrder.
+	SearchOrderHeader = "x-dss-search-order"
+
+	// IncludeExpiredHeader is the request header (gRPC metadata key) through
+	// which clients request expired entities to be included in search
+	// results by setting it to "true".
+	IncludeExpiredHeader = "x-dss-include-expired"
+)
+
+// TemporalDistance returns the key by which SearchOrderRelevance sorts an
+// entity active between start and end, either of which may be unbounded:
+// zero for active entities, the time until start for upcoming entities and
+// the time since end for past entities.
+func TemporalDistance(now time.Time, start, end *time.Time) time.Duration {
+	switch {
+	case start != nil && start.After(now):
+		return start.Sub(now)
+	case end != nil && end.Before(now):
+		return now.Sub(*end)
+	}
+	return 0
+}
+
+type searchOrderKey struct{}
+
+// WithSearchOrder returns a copy of ctx requesting order for searches.
+func WithSearchOrder(ctx context.Context, order SearchOrder) context.Context {
+	return context.WithValue(ctx, searchOrderKey{}, order)
+}
+
+// SearchOrderFromContext returns the SearchOrder requested in ctx, either
+// through WithSearchOrder or through the SearchOrderHeader of an incoming
+// request. Unknown orders are ignored.
+func SearchOrderFromContext(ctx context.Context) SearchOrder {
+	order, ok := ctx.Value(searchOrderKey{}).(SearchOrder)
+	if !ok {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vs := md.Get(SearchOrderHeader); len(vs) > 0 {
+				order = SearchOrder(vs[0])
+			}
+		}
+	}
+	if order != SearchOrderRelevance {
+		return SearchOrderDefault
+	}
+	return order
+}
+
+// IncludeExpiredFromContext returns true if the incoming request in ctx asks
+// for expired entities to be included in search results.
+func IncludeExpiredFromContext(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	vs := md.Get(IncludeExpiredHeader)
+	if len(vs) == 0 {
+		return false
+	}
+	include, err := strconv.ParseBool(vs[0])
+	return err == nil && include
+}
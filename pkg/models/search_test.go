@@ -0,0 +1,45 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSearchOrderFromContext(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, SearchOrderDefault, SearchOrderFromContext(ctx))
+
+	incoming := metadata.NewIncomingContext(ctx, metadata.Pairs(SearchOrderHeader, "relevance"))
+	require.Equal(t, SearchOrderRelevance, SearchOrderFromContext(incoming))
+
+	unknown := metadata.NewIncomingContext(ctx, metadata.Pairs(SearchOrderHeader, "alphabetical"))
+	require.Equal(t, SearchOrderDefault, SearchOrderFromContext(unknown))
+
+	// An explicitly requested order takes precedence over request headers.
+	require.Equal(t, SearchOrderDefault, SearchOrderFromContext(WithSearchOrder(incoming, SearchOrderDefault)))
+	require.Equal(t, SearchOrderRelevance, SearchOrderFromContext(WithSearchOrder(ctx, SearchOrderRelevance)))
+}
+
+func TestIncludeExpiredFromContext(t *testing.T) {
+	ctx := context.Background()
+	require.False(t, IncludeExpiredFromContext(ctx))
+	require.True(t, IncludeExpiredFromContext(metadata.NewIncomingContext(ctx, metadata.Pairs(IncludeExpiredHeader, "true"))))
+	require.False(t, IncludeExpiredFromContext(metadata.NewIncomingContext(ctx, metadata.Pairs(IncludeExpiredHeader, "false"))))
+	require.False(t, IncludeExpiredFromContext(metadata.NewIncomingContext(ctx, metadata.Pairs(IncludeExpiredHeader, "maybe"))))
+}
+
+func TestTemporalDistance(t *testing.T) {
+	var (
+		now   = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		early = now.Add(-time.Hour)
+		late  = now.Add(time.Hour)
+	)
+	require.Equal(t, time.Duration(0), TemporalDistance(now, nil, nil))
+	require.Equal(t, time.Duration(0), TemporalDistance(now, &early, &late))
+	require.Equal(t, time.Hour, TemporalDistance(now, &late, nil))
+	require.Equal(t, time.Hour, TemporalDistance(now, nil, &early))
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+)
+
+// DefaultTimePrecision is the finest resolution of the timestamps accepted
+// by the DSS: that of the timestamps stored by CockroachDB, which silently
+// truncates finer timestamps.
+const DefaultTimePrecision = time.Microsecond
+
+// TimeChecks defines the timestamps accepted in requests. The zero value
+// accepts the timestamps allowed by ASTM F3411 and F3548: RFC3339 in UTC,
+// no finer than DefaultTimePrecision.
+type TimeChecks struct {
+	// Precision is the finest resolution accepted, DefaultTimePrecision if
+	// zero.
+	Precision time.Duration
+	// AllowOffsets accepts timestamps with a UTC offset other than Z, which
+	// are converted to UTC.
+	AllowOffsets bool
+}
+
+// RequestTimes are the TimeChecks applied to the timestamps of requests by
+// the conversions of this package. It is set once at startup.
+var RequestTimes TimeChecks
+
+func (c TimeChecks) precision() time.Duration {
+	if c.Precision > 0 {
+		return c.Precision
+	}
+	return DefaultTimePrecision
+}
+
+// Check returns a BadRequest error if t is finer than the precision of c.
+func (c TimeChecks) Check(t time.Time) error {
+	if t.Truncate(c.precision()).Equal(t) {
+		return nil
+	}
+	return stacktrace.NewErrorWithCode(dsserr.BadRequest,
+		"Time %s is more precise than %s", t.UTC().Format(time.RFC3339Nano), c.precision())
+}
+
+// Parse parses s, an RFC3339 timestamp, returning a BadRequest error if it
+// is malformed or not accepted by c.
+func (c TimeChecks) Parse(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid RFC3339 time %s", s)
+	}
+	if !c.AllowOffsets && !strings.HasSuffix(s, "Z") {
+		return time.Time{}, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Time %s is not in UTC (Z)", s)
+	}
+	if err := c.Check(t); err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// FromProto converts ts, returning a BadRequest error if it is invalid or
+// not accepted by c.
+func (c TimeChecks) FromProto(ts *timestamp.Timestamp) (time.Time, error) {
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return time.Time{}, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid timestamp")
+	}
+	if err := c.Check(t); err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+// FromSCDProto converts t, returning a BadRequest error if its format is not
+// RFC3339 or if its value is invalid or not accepted by c.
+func (c TimeChecks) FromSCDProto(t *scdpb.Time) (time.Time, error) {
+	if format := t.GetFormat(); format != TimeFormatRFC3339 {
+		return time.Time{}, stacktrace.NewErrorWithCode(dsserr.BadRequest,
+			"Unsupported time format %q; expected %s", format, TimeFormatRFC3339)
+	}
+	return c.FromProto(t.GetValue())
+}
+
+// FormatTime formats t as required by ASTM F3411 and F3548: RFC3339 in UTC,
+// with as many fractional digits as needed up to DefaultTimePrecision.
+func FormatTime(t time.Time) string {
+	return t.UTC().Truncate(DefaultTimePrecision).Format(time.RFC3339Nano)
+}
+
+// TimestampProto converts t to a proto truncated to DefaultTimePrecision, so
+// that the timestamps emitted by the DSS are accepted back.
+func TimestampProto(t time.Time) (*timestamp.Timestamp, error) {
+	return ptypes.TimestampProto(t.Truncate(DefaultTimePrecision))
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeChecksParse(t *testing.T) {
+	parsed, err := TimeChecks{}.Parse("2022-01-01T10:00:00.123456Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 123456000, time.UTC), parsed)
+
+	parsed, err = TimeChecks{AllowOffsets: true}.Parse("2022-01-01T12:00:00+02:00")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC), parsed)
+
+	for _, c := range []struct {
+		checks TimeChecks
+		value  string
+	}{
+		{TimeChecks{}, "2022-01-01T12:00:00+02:00"},
+		{TimeChecks{}, "2022-01-01T10:00:00.123456789Z"},
+		{TimeChecks{Precision: time.Millisecond}, "2022-01-01T10:00:00.1234Z"},
+		{TimeChecks{}, "2022-01-01 10:00:00Z"},
+		{TimeChecks{}, "2022-01-01T10:00:00"},
+	} {
+		_, err := c.checks.Parse(c.value)
+		require.Error(t, err, c.value)
+		require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err), c.value)
+	}
+}
+
+func TestTimeChecksFromSCDProto(t *testing.T) {
+	ts, err := ptypes.TimestampProto(time.Date(2022, 1, 1, 10, 0, 0, 500, time.UTC))
+	require.NoError(t, err)
+
+	_, err = TimeChecks{}.FromSCDProto(&scdpb.Time{Value: ts, Format: TimeFormatRFC3339})
+	require.Error(t, err)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+	parsed, err := TimeChecks{Precision: time.Nanosecond}.FromSCDProto(&scdpb.Time{Value: ts, Format: TimeFormatRFC3339})
+	require.NoError(t, err)
+	require.Equal(t, 500, parsed.Nanosecond())
+
+	_, err = TimeChecks{Precision: time.Nanosecond}.FromSCDProto(&scdpb.Time{Value: ts, Format: "ISO8601"})
+	require.Error(t, err)
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+}
+
+func TestEmittedTimesAccepted(t *testing.T) {
+	now := time.Date(2022, 1, 1, 10, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+
+	formatted := FormatTime(now)
+	require.Equal(t, "2022-01-01T08:00:00.123456Z", formatted)
+	_, err := TimeChecks{}.Parse(formatted)
+	require.NoError(t, err)
+
+	ts, err := TimestampProto(now)
+	require.NoError(t, err)
+	_, err = TimeChecks{}.FromProto(ts)
+	require.NoError(t, err)
+}
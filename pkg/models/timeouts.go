@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+)
+
+// Operation is a category of repository calls sharing a timeout.
+type Operation string
+
+const (
+	// OperationSearch covers the repository calls reading entities.
+	OperationSearch Operation = "search"
+	// OperationUpsert covers the repository calls creating or updating
+	// entities.
+	OperationUpsert Operation = "upsert"
+	// OperationDelete covers the repository calls deleting entities.
+	OperationDelete Operation = "delete"
+)
+
+// Timeouts bounds the time a single repository call may take, so a slow
+// query cannot hold a handler indefinitely. A zero timeout leaves the calls
+// of its operation bounded by their context only.
+type Timeouts struct {
+	Search time.Duration
+	Upsert time.Duration
+	Delete time.Duration
+}
+
+// Timeout returns the timeout of the repository calls of op.
+func (t Timeouts) Timeout(op Operation) time.Duration {
+	switch op {
+	case OperationSearch:
+		return t.Search
+	case OperationUpsert:
+		return t.Upsert
+	case OperationDelete:
+		return t.Delete
+	}
+	return 0
+}
+
+// Bound calls f with ctx bounded by the timeout of op. When f fails because
+// that timeout, rather than ctx, expired, the timeout is recorded in
+// summary.Default and the error returned carries dsserr.DeadlineExceeded.
+func (t Timeouts) Bound(ctx context.Context, op Operation, f func(context.Context) error) error {
+	timeout := t.Timeout(op)
+	if timeout <= 0 {
+		return f(ctx)
+	}
+	bounded, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := f(bounded)
+	if err != nil && bounded.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		summary.Default.RecordTimeout(string(op))
+		return stacktrace.PropagateWithCode(err, dsserr.DeadlineExceeded, "Repository %s exceeded its %s timeout", op, timeout)
+	}
+	return err
+}
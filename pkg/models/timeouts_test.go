@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutsBound(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		timeouts = Timeouts{Search: time.Millisecond}
+		wait     = func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	)
+
+	// An exceeded timeout is reported with its own code.
+	err := timeouts.Bound(ctx, OperationSearch, wait)
+	require.Error(t, err)
+	require.Equal(t, dsserr.DeadlineExceeded, stacktrace.GetCode(err))
+
+	// Operations without a timeout are bounded by their context only.
+	require.NoError(t, timeouts.Bound(ctx, OperationUpsert, func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		require.False(t, ok)
+		return nil
+	}))
+
+	// The expiry of the parent context is not attributed to the timeout.
+	parent, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	err = Timeouts{Search: time.Hour}.Bound(parent, OperationSearch, wait)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
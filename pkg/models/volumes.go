@@ -0,0 +1,211 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/stacktrace"
+)
+
+// The operations in this file compose volumes over the S2 coverings of their
+// footprints and their altitude and time intervals, in which a missing bound
+// stands for an unbounded interval.  Unlike UnionVolumes4D, which ignores
+// missing bounds, they treat a volume without a start time as starting in
+// the infinite past.  The volumes they return have a precomputed footprint
+// and altitudes relative to WGS84, without their submitted altitudes.
+
+// Union returns the smallest volume containing both vol4 and other: the union
+// of their footprints, over the smallest altitude and time intervals
+// containing theirs.  Errors are those of CalculateSpatialCovering.
+func (vol4 *Volume4D) Union(other *Volume4D) (*Volume4D, error) {
+	if vol4.SpatialVolume == nil || other.SpatialVolume == nil {
+		return nil, geo.ErrMissingSpatialVolume
+	}
+	spatialVolume, err := vol4.SpatialVolume.Union(other.SpatialVolume)
+	if err != nil {
+		return nil, err
+	}
+	return &Volume4D{
+		SpatialVolume: spatialVolume,
+		StartTime:     outerTime(vol4.StartTime, other.StartTime, true),
+		EndTime:       outerTime(vol4.EndTime, other.EndTime, false),
+	}, nil
+}
+
+// Intersect returns the volume common to vol4 and other, or nil if they do
+// not intersect.  Errors are those of CalculateSpatialCovering.
+func (vol4 *Volume4D) Intersect(other *Volume4D) (*Volume4D, error) {
+	if vol4.SpatialVolume == nil || other.SpatialVolume == nil {
+		return nil, geo.ErrMissingSpatialVolume
+	}
+	startTime := innerTime(vol4.StartTime, other.StartTime, true)
+	endTime := innerTime(vol4.EndTime, other.EndTime, false)
+	if startTime != nil && endTime != nil && startTime.After(*endTime) {
+		return nil, nil
+	}
+	spatialVolume, err := vol4.SpatialVolume.Intersect(other.SpatialVolume)
+	if err != nil || spatialVolume == nil {
+		return nil, err
+	}
+	return &Volume4D{
+		SpatialVolume: spatialVolume,
+		StartTime:     startTime,
+		EndTime:       endTime,
+	}, nil
+}
+
+// Contains returns whether vol4 contains other entirely.  Errors are those of
+// CalculateSpatialCovering.
+func (vol4 *Volume4D) Contains(other *Volume4D) (bool, error) {
+	if vol4.SpatialVolume == nil || other.SpatialVolume == nil {
+		return false, geo.ErrMissingSpatialVolume
+	}
+	if !containsTimes(vol4.StartTime, vol4.EndTime, other.StartTime, other.EndTime) {
+		return false, nil
+	}
+	return vol4.SpatialVolume.Contains(other.SpatialVolume)
+}
+
+// Union returns the smallest volume containing both vol3 and other: the union
+// of their footprints, over the smallest altitude interval containing theirs.
+// Errors are those of CalculateCovering.
+func (vol3 *Volume3D) Union(other *Volume3D) (*Volume3D, error) {
+	cells, otherCells, err := coverings(vol3, other)
+	if err != nil {
+		return nil, err
+	}
+	return &Volume3D{
+		AltitudeLo: outerAltitude(vol3.AltitudeLo, other.AltitudeLo, true),
+		AltitudeHi: outerAltitude(vol3.AltitudeHi, other.AltitudeHi, false),
+		Footprint:  cellGeometry(s2.CellUnionFromUnion(cells, otherCells)),
+	}, nil
+}
+
+// Intersect returns the volume common to vol3 and other, or nil if they do
+// not intersect.  Errors are those of CalculateCovering.
+func (vol3 *Volume3D) Intersect(other *Volume3D) (*Volume3D, error) {
+	altitudeLo := innerAltitude(vol3.AltitudeLo, other.AltitudeLo, true)
+	altitudeHi := innerAltitude(vol3.AltitudeHi, other.AltitudeHi, false)
+	if altitudeLo != nil && altitudeHi != nil && *altitudeLo > *altitudeHi {
+		return nil, nil
+	}
+	cells, otherCells, err := coverings(vol3, other)
+	if err != nil {
+		return nil, err
+	}
+	intersection := s2.CellUnionFromIntersection(cells, otherCells)
+	if len(intersection) == 0 {
+		return nil, nil
+	}
+	return &Volume3D{
+		AltitudeLo: altitudeLo,
+		AltitudeHi: altitudeHi,
+		Footprint:  cellGeometry(intersection),
+	}, nil
+}
+
+// Contains returns whether vol3 contains other entirely.  Errors are those of
+// CalculateCovering.
+func (vol3 *Volume3D) Contains(other *Volume3D) (bool, error) {
+	if (vol3.AltitudeLo != nil && (other.AltitudeLo == nil || *other.AltitudeLo < *vol3.AltitudeLo)) ||
+		(vol3.AltitudeHi != nil && (other.AltitudeHi == nil || *other.AltitudeHi > *vol3.AltitudeHi)) {
+		return false, nil
+	}
+	cells, otherCells, err := coverings(vol3, other)
+	if err != nil {
+		return false, err
+	}
+	return cells.Contains(otherCells), nil
+}
+
+// coverings returns the normalized coverings of a and b.
+func coverings(a, b *Volume3D) (s2.CellUnion, s2.CellUnion, error) {
+	aCells, err := a.CalculateCovering()
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Error calculating footprint covering")
+	}
+	bCells, err := b.CalculateCovering()
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Error calculating footprint covering")
+	}
+	// CellUnionFromUnion copies the cells before normalizing them, leaving the
+	// coverings of the footprints untouched.
+	return s2.CellUnionFromUnion(aCells), s2.CellUnionFromUnion(bCells), nil
+}
+
+// cellGeometry returns the Geometry covered by cells.
+func cellGeometry(cells s2.CellUnion) Geometry {
+	return GeometryFunc(func() (s2.CellUnion, error) {
+		return cells, nil
+	})
+}
+
+// containsTimes returns whether the time interval [start, end] contains
+// [otherStart, otherEnd].
+func containsTimes(start, end, otherStart, otherEnd *time.Time) bool {
+	return (start == nil || (otherStart != nil && !otherStart.Before(*start))) &&
+		(end == nil || (otherEnd != nil && !otherEnd.After(*end)))
+}
+
+// outerTime returns the start, if start, or else the end of the smallest time
+// interval containing the intervals bounded by a and b.
+func outerTime(a, b *time.Time, start bool) *time.Time {
+	if a == nil || b == nil {
+		return nil
+	}
+	if a.Before(*b) == start {
+		return copyTime(a)
+	}
+	return copyTime(b)
+}
+
+// innerTime returns the start, if start, or else the end of the intersection
+// of the time intervals bounded by a and b.
+func innerTime(a, b *time.Time, start bool) *time.Time {
+	switch {
+	case a == nil:
+		return copyTime(b)
+	case b == nil:
+		return copyTime(a)
+	case a.After(*b) == start:
+		return copyTime(a)
+	default:
+		return copyTime(b)
+	}
+}
+
+// outerAltitude returns the lower bound, if lower, or else the upper bound of
+// the smallest altitude interval containing the intervals bounded by a and b.
+func outerAltitude(a, b *float32, lower bool) *float32 {
+	if a == nil || b == nil {
+		return nil
+	}
+	if (*a < *b) == lower {
+		return float32p(*a)
+	}
+	return float32p(*b)
+}
+
+// innerAltitude returns the lower bound, if lower, or else the upper bound of
+// the intersection of the altitude intervals bounded by a and b.
+func innerAltitude(a, b *float32, lower bool) *float32 {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return float32p(*b)
+	case b == nil, (*a > *b) == lower:
+		return float32p(*a)
+	default:
+		return float32p(*b)
+	}
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
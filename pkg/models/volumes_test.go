@@ -0,0 +1,95 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/stretchr/testify/require"
+)
+
+func testVolume(start, end time.Time, lo, hi float32, cells ...s2.CellID) *Volume4D {
+	return &Volume4D{
+		StartTime: &start,
+		EndTime:   &end,
+		SpatialVolume: &Volume3D{
+			AltitudeLo: &lo,
+			AltitudeHi: &hi,
+			Footprint:  cellGeometry(s2.CellUnion(cells)),
+		},
+	}
+}
+
+func TestVolume4DOperations(t *testing.T) {
+	var (
+		t0    = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		t1    = t0.Add(time.Hour)
+		t2    = t0.Add(2 * time.Hour)
+		t3    = t0.Add(3 * time.Hour)
+		cellA = s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.5, 6.5)).Parent(13)
+		cellB = s2.CellIDFromLatLng(s2.LatLngFromDegrees(47.5, 8.5)).Parent(13)
+		a     = testVolume(t0, t2, 10, 100, cellA, cellB)
+		b     = testVolume(t1, t3, 50, 200, cellB)
+		c     = testVolume(t1, t2, 20, 80, cellA.ChildBegin())
+	)
+
+	union, err := a.Union(b)
+	require.NoError(t, err)
+	require.Equal(t, t0, *union.StartTime)
+	require.Equal(t, t3, *union.EndTime)
+	require.Equal(t, float32(10), *union.SpatialVolume.AltitudeLo)
+	require.Equal(t, float32(200), *union.SpatialVolume.AltitudeHi)
+	cells, err := union.CalculateSpatialCovering()
+	require.NoError(t, err)
+	require.Equal(t, s2.CellUnionFromUnion(s2.CellUnion{cellA, cellB}), cells)
+
+	intersection, err := a.Intersect(b)
+	require.NoError(t, err)
+	require.Equal(t, t1, *intersection.StartTime)
+	require.Equal(t, t2, *intersection.EndTime)
+	require.Equal(t, float32(50), *intersection.SpatialVolume.AltitudeLo)
+	require.Equal(t, float32(100), *intersection.SpatialVolume.AltitudeHi)
+	cells, err = intersection.CalculateSpatialCovering()
+	require.NoError(t, err)
+	require.Equal(t, s2.CellUnion{cellB}, cells)
+
+	// Volumes overlapping in space and time but at different altitudes do
+	// not intersect.
+	intersection, err = c.Intersect(testVolume(t0, t3, 90, 100, cellA))
+	require.NoError(t, err)
+	require.Nil(t, intersection)
+
+	for _, test := range []struct {
+		name       string
+		vol, other *Volume4D
+		contains   bool
+	}{
+		{"itself", a, a, true},
+		{"smaller", a, c, true},
+		{"larger", c, a, false},
+		{"overlapping", a, b, false},
+		{"union", union, b, true},
+		{"unbounded start", &Volume4D{EndTime: a.EndTime, SpatialVolume: a.SpatialVolume}, c, true},
+		{"unbounded other", a, &Volume4D{EndTime: c.EndTime, SpatialVolume: c.SpatialVolume}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			contains, err := test.vol.Contains(test.other)
+			require.NoError(t, err)
+			require.Equal(t, test.contains, contains)
+		})
+	}
+
+	// Missing bounds are unbounded.
+	unbounded := &Volume4D{SpatialVolume: &Volume3D{Footprint: a.SpatialVolume.Footprint}}
+	union, err = a.Union(unbounded)
+	require.NoError(t, err)
+	require.Nil(t, union.StartTime)
+	require.Nil(t, union.SpatialVolume.AltitudeHi)
+	intersection, err = a.Intersect(unbounded)
+	require.NoError(t, err)
+	require.Equal(t, t0, *intersection.StartTime)
+	require.Equal(t, float32(100), *intersection.SpatialVolume.AltitudeHi)
+
+	_, err = a.Union(&Volume4D{})
+	require.Error(t, err)
+}
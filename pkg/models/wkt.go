@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+)
+
+// FootprintWKT returns the Well-Known Text representation of the exact shape
+// of footprint, for storage as a geography alongside its covering. It
+// returns an empty string if footprint is only known by its covering, as are
+// the footprints built from stored cells. Circles are represented by the
+// polygon inscribed in them from which their covering is computed.
+func FootprintWKT(footprint Geometry) (string, error) {
+	switch g := footprint.(type) {
+	case *GeoPolygon:
+		if g == nil {
+			return "", geo.ErrBadCoordSet
+		}
+		var points []s2.Point
+		for _, v := range g.Vertices {
+			if (v.Lat > maxLat) || (v.Lat < minLat) || (v.Lng > maxLng) || (v.Lng < minLng) {
+				return "", geo.ErrBadCoordSet
+			}
+			points = append(points, s2.PointFromLatLng(s2.LatLngFromDegrees(v.Lat, v.Lng)))
+		}
+		if len(points) < 3 {
+			return "", geo.ErrNotEnoughPointsInPolygon
+		}
+		// The polygon is the side of its vertices with the smaller area.
+		loop := s2.LoopFromPoints(points)
+		loop.Normalize()
+		return "POLYGON" + loopWKT(loop), nil
+	case *GeoCircle:
+		if (g.Center.Lat > maxLat) || (g.Center.Lat < minLat) || (g.Center.Lng > maxLng) || (g.Center.Lng < minLng) {
+			return "", geo.ErrBadCoordSet
+		}
+		if !(g.RadiusMeter > 0) {
+			return "", geo.ErrRadiusMustBeLargerThan0
+		}
+		return "POLYGON" + loopWKT(g.loop()), nil
+	case *precomputedCellGeometry:
+		parts := make([]string, len(g.parts))
+		for i, part := range g.parts {
+			wkt, err := FootprintWKT(part)
+			if err != nil || wkt == "" {
+				return "", err
+			}
+			parts[i] = wkt
+		}
+		if len(parts) == 1 {
+			return parts[0], nil
+		}
+		return "GEOMETRYCOLLECTION(" + strings.Join(parts, ",") + ")", nil
+	}
+	return "", nil
+}
+
+// loopWKT returns the Well-Known Text ring of loop, enclosed in parentheses.
+func loopWKT(loop *s2.Loop) string {
+	var b strings.Builder
+	b.WriteString("((")
+	for i := 0; i <= loop.NumVertices(); i++ {
+		// Vertex wraps around, closing the ring with its first vertex.
+		v := loop.Vertex(i)
+		if i > 0 {
+			b.WriteString(",")
+		}
+		ll := s2.LatLngFromPoint(v)
+		b.WriteString(strconv.FormatFloat(ll.Lng.Degrees(), 'f', -1, 64))
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(ll.Lat.Degrees(), 'f', -1, 64))
+	}
+	b.WriteString("))")
+	return b.String()
+}
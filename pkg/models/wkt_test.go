@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFootprintWKT(t *testing.T) {
+	square := func(vertices ...LatLngPoint) *GeoPolygon {
+		p := &GeoPolygon{}
+		for i := range vertices {
+			p.Vertices = append(p.Vertices, &vertices[i])
+		}
+		return p
+	}
+	ccw := square(LatLngPoint{0, 0}, LatLngPoint{0, 0.1}, LatLngPoint{0.1, 0.1}, LatLngPoint{0.1, 0})
+	cw := square(LatLngPoint{0, 0}, LatLngPoint{0.1, 0}, LatLngPoint{0.1, 0.1}, LatLngPoint{0, 0.1})
+
+	// ring returns the vertices of the ring of a polygon, without the
+	// closing one.
+	ring := func(wkt string) []string {
+		require.True(t, strings.HasPrefix(wkt, "POLYGON(("), wkt)
+		vertices := strings.Split(strings.TrimSuffix(strings.TrimPrefix(wkt, "POLYGON(("), "))"), ",")
+		require.Equal(t, vertices[0], vertices[len(vertices)-1])
+		return vertices[:len(vertices)-1]
+	}
+
+	// Either winding yields the smaller polygon, wound counterclockwise.
+	wkt, err := FootprintWKT(ccw)
+	require.NoError(t, err)
+	vertices := ring(wkt)
+	require.Len(t, vertices, 4)
+	reversed, err := FootprintWKT(cw)
+	require.NoError(t, err)
+	require.Contains(t, strings.Join(append(vertices, vertices...), ","), strings.Join(ring(reversed), ","))
+
+	wkt, err = FootprintWKT(&GeoCircle{Center: LatLngPoint{46.2, 6.1}, RadiusMeter: 100})
+	require.NoError(t, err)
+	require.Len(t, ring(wkt), 20)
+
+	// Unions keep the shapes of their parts.
+	union, err := UnionVolumes4D(
+		&Volume4D{SpatialVolume: &Volume3D{Footprint: ccw}},
+		&Volume4D{SpatialVolume: &Volume3D{Footprint: &GeoCircle{Center: LatLngPoint{46.2, 6.1}, RadiusMeter: 100}}},
+	)
+	require.NoError(t, err)
+	wkt, err = FootprintWKT(union.SpatialVolume.Footprint)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(wkt, "GEOMETRYCOLLECTION(POLYGON(("), wkt)
+	require.Equal(t, 2, strings.Count(wkt, "POLYGON"))
+
+	// Footprints only known by their covering have no shape.
+	cells := GeometryFunc(func() (s2.CellUnion, error) { return nil, nil })
+	wkt, err = FootprintWKT(cells)
+	require.NoError(t, err)
+	require.Empty(t, wkt)
+	union, err = UnionVolumes4D(
+		&Volume4D{SpatialVolume: &Volume3D{Footprint: ccw}},
+		&Volume4D{SpatialVolume: &Volume3D{Footprint: cells}},
+	)
+	require.NoError(t, err)
+	wkt, err = FootprintWKT(union.SpatialVolume.Footprint)
+	require.NoError(t, err)
+	require.Empty(t, wkt)
+
+	_, err = FootprintWKT(square(LatLngPoint{0, 0}, LatLngPoint{0, 1}))
+	require.Error(t, err)
+}
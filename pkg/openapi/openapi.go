@@ -0,0 +1,160 @@
+// Package openapi serves the OpenAPI specifications of the APIs exposed by a
+// DSS instance, adjusted to point at that instance.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// PathPrefix is the URL path under which specifications are served.
+const PathPrefix = "/openapi/"
+
+var uiTemplate = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <title>DSS API: {{.Name}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@3/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@3/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`))
+
+// Handler is an http.Handler serving OpenAPI specifications below PathPrefix:
+//
+//	/openapi/           lists the available specifications
+//	/openapi/<api>.json returns the specification of <api>
+//	/openapi/<api>/ui   renders an interactive page to try out <api>
+type Handler struct {
+	specs     map[string][]byte
+	publicURL *url.URL
+}
+
+// NewHandler returns a Handler serving the specifications <dir>/<api>.swagger.json
+// for every api in apis. The server URLs in the served specifications point
+// at publicURL if not empty, or at the host the request was addressed to
+// otherwise.
+func NewHandler(dir string, publicURL string, apis []string) (*Handler, error) {
+	h := &Handler{
+		specs: make(map[string][]byte, len(apis)),
+	}
+	if publicURL != "" {
+		u, err := url.Parse(publicURL)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error parsing public URL %s", publicURL)
+		}
+		h.publicURL = u
+	}
+	for _, api := range apis {
+		filename := filepath.Join(dir, api+".swagger.json")
+		spec, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error reading OpenAPI specification %s", filename)
+		}
+		if !json.Valid(spec) {
+			return nil, stacktrace.NewError("OpenAPI specification %s is not valid JSON", filename)
+		}
+		h.specs[api] = spec
+	}
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	switch {
+	case name == "":
+		h.serveIndex(w)
+	case strings.HasSuffix(name, ".json"):
+		h.serveSpec(w, r, strings.TrimSuffix(name, ".json"))
+	case strings.HasSuffix(name, "/ui"):
+		h.serveUI(w, strings.TrimSuffix(name, "/ui"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveIndex(w http.ResponseWriter) {
+	apis := make([]string, 0, len(h.specs))
+	for api := range h.specs {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]string{"apis": apis})
+}
+
+func (h *Handler) serveSpec(w http.ResponseWriter, r *http.Request, api string) {
+	raw, ok := h.specs[api]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		http.Error(w, "Invalid OpenAPI specification", http.StatusInternalServerError)
+		return
+	}
+	setServer(spec, h.serverURL(r))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(spec)
+}
+
+func (h *Handler) serveUI(w http.ResponseWriter, api string) {
+	if _, ok := h.specs[api]; !ok {
+		http.Error(w, "Unknown API", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = uiTemplate.Execute(w, struct {
+		Name    string
+		SpecURL string
+	}{api, fmt.Sprintf("%s%s.json", PathPrefix, api)})
+}
+
+// serverURL returns the base URL clients should use to reach this instance.
+func (h *Handler) serverURL(r *http.Request) *url.URL {
+	if h.publicURL != nil {
+		return h.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return &url.URL{Scheme: scheme, Host: r.Host}
+}
+
+// setServer points spec at u, handling both Swagger 2.0 and OpenAPI 3
+// documents.
+func setServer(spec map[string]interface{}, u *url.URL) {
+	if _, ok := spec["openapi"]; ok {
+		spec["servers"] = []map[string]string{{"url": u.String()}}
+		return
+	}
+	spec["host"] = u.Host
+	spec["schemes"] = []string{u.Scheme}
+	if u.Path != "" {
+		spec["basePath"] = u.Path
+	}
+}
@@ -0,0 +1,49 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openapi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "rid.swagger.json"), []byte(`{"swagger": "2.0", "host": "example.com"}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "scd.swagger.json"), []byte(`{"openapi": "3.0.2"}`), 0644))
+
+	_, err = NewHandler(dir, "", []string{"aux_service"})
+	require.Error(t, err)
+
+	h, err := NewHandler(dir, "", []string{"rid", "scd"})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://dss.example.org/openapi/rid.json", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code)
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	require.Equal(t, "dss.example.org", spec["host"])
+	require.Equal(t, []interface{}{"https"}, spec["schemes"])
+
+	h, err = NewHandler(dir, "https://pool.example.org/dss", []string{"scd"})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/openapi/scd.json", nil))
+	require.Equal(t, 200, w.Code)
+	spec = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	require.Equal(t, []interface{}{map[string]interface{}{"url": "https://pool.example.org/dss"}}, spec["servers"])
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://localhost/openapi/rid.json", nil))
+	require.Equal(t, 404, w.Code)
+}
@@ -0,0 +1,328 @@
+// Package pool verifies that the DSS instances of a pool converge, as the
+// interoperability test of the InterUSS automated testing suite does, by
+// writing canary entities through each instance and reading them back
+// through the others.
+package pool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+)
+
+const (
+	// Manager is the manager of the canary entities.
+	Manager = "dss-pool-checker"
+
+	// canaryDuration is how long the canary entities last, should a check
+	// fail to delete them.
+	canaryDuration = 5 * time.Minute
+)
+
+// Kinds of canary entities.
+const (
+	EntityISA          = "isa"
+	EntitySubscription = "subscription"
+)
+
+// area is the footprint of the canary entities, around the oceanic pole of
+// inaccessibility so that no USS is notified of them.
+var area = []*ridpb.LatLngPoint{
+	{Lat: -48.91, Lng: -123.40},
+	{Lat: -48.91, Lng: -123.38},
+	{Lat: -48.93, Lng: -123.38},
+	{Lat: -48.93, Lng: -123.40},
+}
+
+// Divergence is a canary entity written through the DSS instance at Writer
+// and not read back as written through the DSS instance at Reader.
+type Divergence struct {
+	Entity string `json:"entity"`
+	ID     string `json:"id"`
+	Writer string `json:"writer"`
+	Reader string `json:"reader"`
+	Reason string `json:"reason"`
+}
+
+// Report is the outcome of a check of the pool.
+type Report struct {
+	Time        time.Time    `json:"time"`
+	Peers       []string     `json:"peers"`
+	Divergences []Divergence `json:"divergences"`
+	// Errors lists the canary entities which could not be written or
+	// deleted, thus not checked.
+	Errors []string `json:"errors"`
+}
+
+// Checker writes, through every DSS instance of a pool, a canary ISA and
+// subscription managed by Manager, reads them back through every other
+// instance, then deletes them and verifies they are gone from every other
+// instance. It is safe for concurrent use.
+type Checker struct {
+	// Peers are the base URLs of the DSS instances of the pool, such as
+	// https://dss.uss1.example.com.
+	Peers  []string
+	Client *http.Client
+	// Token returns the access token authorizing the calls of the checker
+	// to the DSS instance whose host name is audience.
+	Token    func(audience string) (string, error)
+	Clock    clockwork.Clock
+	Logger   *zap.Logger
+	Recorder *summary.Recorder
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// Run checks the pool every period until ctx is done.
+func (c *Checker) Run(ctx context.Context, period time.Duration) {
+	ticker := c.Clock.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			if _, err := c.Check(ctx); err != nil {
+				c.Logger.Warn("Failed to check DSS pool", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Last returns the report of the latest check, if any.
+func (c *Checker) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Check checks the pool once, alerting on every divergence found.
+func (c *Checker) Check(ctx context.Context) (*Report, error) {
+	now := c.Clock.Now()
+	extents, err := canaryExtents(now)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Time: now, Peers: c.Peers, Divergences: []Divergence{}, Errors: []string{}}
+	for _, writer := range c.Peers {
+		for _, canary := range []canary{isaCanary(extents), subscriptionCanary(extents)} {
+			if err := c.checkCanary(ctx, writer, canary, report); err != nil {
+				c.Logger.Warn("Failed to write or delete canary entity",
+					zap.String("entity", canary.entity), zap.String("writer", writer), zap.Error(err))
+				report.Errors = append(report.Errors, fmt.Sprintf("%s via %s: %s", canary.entity, writer, err))
+			}
+		}
+	}
+
+	for _, d := range report.Divergences {
+		c.Logger.Error("DSS pool divergence",
+			zap.String("alert", "dss_pool_divergence"),
+			zap.String("entity", d.Entity),
+			zap.String("id", d.ID),
+			zap.String("writer", d.Writer),
+			zap.String("reader", d.Reader),
+			zap.String("reason", d.Reason))
+		c.Recorder.RecordPoolDivergence(d.Reader)
+	}
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+	return report, nil
+}
+
+// canary describes how to write, read and delete a canary entity of a kind.
+type canary struct {
+	entity string
+	// collection is the path of the entities of the kind under the base URL
+	// of a DSS instance.
+	collection string
+	params     proto.Message
+	// version returns the version of the entity in a response to its
+	// creation or retrieval.
+	version func(body []byte) (string, error)
+}
+
+func isaCanary(extents *ridpb.Volume4D) canary {
+	return canary{
+		entity:     EntityISA,
+		collection: "/v1/dss/identification_service_areas",
+		params: &ridpb.CreateIdentificationServiceAreaParameters{
+			Extents:    extents,
+			FlightsUrl: "https://" + Manager + ".invalid/flights",
+		},
+		version: func(body []byte) (string, error) {
+			// Put and Get responses share the layout of their service_area.
+			resp := &ridpb.GetIdentificationServiceAreaResponse{}
+			if err := unmarshal(body, resp); err != nil {
+				return "", err
+			}
+			return resp.GetServiceArea().GetVersion(), nil
+		},
+	}
+}
+
+func subscriptionCanary(extents *ridpb.Volume4D) canary {
+	return canary{
+		entity:     EntitySubscription,
+		collection: "/v1/dss/subscriptions",
+		params: &ridpb.CreateSubscriptionParameters{
+			Extents: extents,
+			Callbacks: &ridpb.SubscriptionCallbacks{
+				IdentificationServiceAreaUrl: "https://" + Manager + ".invalid/identification_service_areas",
+			},
+		},
+		version: func(body []byte) (string, error) {
+			resp := &ridpb.GetSubscriptionResponse{}
+			if err := unmarshal(body, resp); err != nil {
+				return "", err
+			}
+			return resp.GetSubscription().GetVersion(), nil
+		},
+	}
+}
+
+// checkCanary writes canary through writer, then reads and deletes it,
+// appending the divergences found to report.
+func (c *Checker) checkCanary(ctx context.Context, writer string, canary canary, report *Report) error {
+	id := uuid.New().String()
+	body, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(canary.params)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error marshaling canary %s", canary.entity)
+	}
+	status, resp, err := c.call(ctx, http.MethodPut, writer, canary.collection+"/"+id, body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return stacktrace.NewError("Creating canary %s %s returned %d: %s", canary.entity, id, status, resp)
+	}
+	version, err := canary.version(resp)
+	if err != nil {
+		return err
+	}
+
+	diverge := func(reader, reason string) {
+		report.Divergences = append(report.Divergences, Divergence{
+			Entity: canary.entity,
+			ID:     id,
+			Writer: writer,
+			Reader: reader,
+			Reason: reason,
+		})
+	}
+
+	for _, reader := range c.Peers {
+		if reader == writer {
+			continue
+		}
+		status, resp, err := c.call(ctx, http.MethodGet, reader, canary.collection+"/"+id, "")
+		switch {
+		case err != nil:
+			diverge(reader, err.Error())
+		case status != http.StatusOK:
+			diverge(reader, fmt.Sprintf("read returned %d", status))
+		default:
+			if v, err := canary.version(resp); err != nil {
+				diverge(reader, err.Error())
+			} else if v != version {
+				diverge(reader, fmt.Sprintf("read version %s instead of %s", v, version))
+			}
+		}
+	}
+
+	status, resp, err = c.call(ctx, http.MethodDelete, writer, canary.collection+"/"+id+"/"+version, "")
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return stacktrace.NewError("Deleting canary %s %s returned %d: %s", canary.entity, id, status, resp)
+	}
+
+	for _, reader := range c.Peers {
+		if reader == writer {
+			continue
+		}
+		status, _, err := c.call(ctx, http.MethodGet, reader, canary.collection+"/"+id, "")
+		switch {
+		case err != nil:
+			diverge(reader, err.Error())
+		case status != http.StatusNotFound:
+			diverge(reader, fmt.Sprintf("read after deletion returned %d", status))
+		}
+	}
+	return nil
+}
+
+// call issues an HTTP request to path under the base URL of peer, returning
+// the status and body of the response.
+func (c *Checker) call(ctx context.Context, method, peer, path, body string) (int, []byte, error) {
+	url := peer + path
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, nil, stacktrace.Propagate(err, "Error creating request to %s", url)
+	}
+	token, err := c.Token(req.URL.Hostname())
+	if err != nil {
+		return 0, nil, stacktrace.Propagate(err, "Error obtaining pool checker access token for %s", peer)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, nil, stacktrace.Propagate(err, "Error calling %s %s", method, url)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, stacktrace.Propagate(err, "Error reading response of %s %s", method, url)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+func unmarshal(body []byte, msg proto.Message) error {
+	if err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(body), msg); err != nil {
+		return stacktrace.Propagate(err, "Error decoding response")
+	}
+	return nil
+}
+
+// canaryExtents returns the extents of the canary entities written at now.
+func canaryExtents(now time.Time) (*ridpb.Volume4D, error) {
+	start, err := dssmodels.TimestampProto(now)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error converting start time")
+	}
+	end, err := dssmodels.TimestampProto(now.Add(canaryDuration))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error converting end time")
+	}
+	return &ridpb.Volume4D{
+		SpatialVolume: &ridpb.Volume3D{
+			AltitudeLo: 0,
+			AltitudeHi: 120,
+			Footprint:  &ridpb.GeoPolygon{Vertices: area},
+		},
+		TimeStart: start,
+		TimeEnd:   end,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeDatabase holds the versions of the entities written through the fake
+// DSS instances sharing it, by path.
+type fakeDatabase struct {
+	mu       sync.Mutex
+	versions map[string]int
+}
+
+// handler returns a fake DSS instance backed by db.
+func (db *fakeDatabase) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		field := "service_area"
+		if strings.HasPrefix(r.URL.Path, "/v1/dss/subscriptions/") {
+			field = "subscription"
+		}
+		switch r.Method {
+		case http.MethodPut:
+			db.versions[r.URL.Path]++
+			fmt.Fprintf(w, `{"%s": {"version": "%d"}, "subscribers": []}`, field, db.versions[r.URL.Path])
+		case http.MethodGet:
+			v, ok := db.versions[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, `{"%s": {"version": "%d"}}`, field, v)
+		case http.MethodDelete:
+			path := r.URL.Path[:strings.LastIndex(r.URL.Path, "/")]
+			if _, ok := db.versions[path]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			delete(db.versions, path)
+			fmt.Fprint(w, `{}`)
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	var (
+		pool      = &fakeDatabase{versions: map[string]int{}}
+		partition = &fakeDatabase{versions: map[string]int{}}
+		uss1      = httptest.NewServer(pool.handler(t))
+		uss2      = httptest.NewServer(pool.handler(t))
+		uss3      = httptest.NewServer(partition.handler(t))
+		recorder  = summary.NewRecorder(clockwork.NewFakeClock())
+	)
+	defer uss1.Close()
+	defer uss2.Close()
+	defer uss3.Close()
+
+	c := &Checker{
+		Peers:  []string{uss1.URL, uss2.URL},
+		Client: uss1.Client(),
+		Token: func(audience string) (string, error) {
+			require.Equal(t, "127.0.0.1", audience)
+			return "token", nil
+		},
+		Clock:    clockwork.NewFakeClock(),
+		Logger:   zap.NewNop(),
+		Recorder: recorder,
+	}
+	report, err := c.Check(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Divergences)
+	require.Empty(t, report.Errors)
+	require.Empty(t, pool.versions)
+	require.Equal(t, report, c.Last())
+
+	// Entities written through the partitioned instance are missing from the
+	// others, and conversely.
+	c.Peers = append(c.Peers, uss3.URL)
+	report, err = c.Check(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Len(t, report.Divergences, 8)
+	readers := map[string]int{}
+	for _, d := range report.Divergences {
+		require.True(t, d.Writer == uss3.URL || d.Reader == uss3.URL, d)
+		require.Equal(t, "read returned 404", d.Reason)
+		readers[d.Reader]++
+	}
+	require.Equal(t, map[string]int{uss1.URL: 2, uss2.URL: 2, uss3.URL: 4}, readers)
+	require.Equal(t, int64(8), sum(recorder.Rotate().PoolDivergences))
+}
+
+func sum(counts map[string]int64) int64 {
+	var n int64
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
@@ -0,0 +1,254 @@
+// Package probe continuously measures the response times of the DSS API, as
+// bounded by the ASTM standards, by executing synthetic end-to-end cycles
+// against it.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Manager is the manager of the entities created by the probe.
+	Manager = "dss-sla-probe"
+
+	// windowSize is the number of most recent samples of each operation the
+	// latency percentiles are computed over.
+	windowSize = 1000
+	// isaDuration is how long the ISAs created by the probe last, should a
+	// cycle fail to delete them.
+	isaDuration = 5 * time.Minute
+)
+
+// Operations measured by the probe.
+const (
+	OperationCreate = "create_isa"
+	OperationSearch = "search_isas"
+	OperationDelete = "delete_isa"
+)
+
+// area is the footprint of the ISAs created by the probe, around the oceanic
+// pole of inaccessibility so that no USS is notified of them.
+var area = []*ridpb.LatLngPoint{
+	{Lat: -48.87, Lng: -123.40},
+	{Lat: -48.87, Lng: -123.38},
+	{Lat: -48.89, Lng: -123.38},
+	{Lat: -48.89, Lng: -123.40},
+}
+
+// Stats are the latency statistics of an operation over its most recent
+// samples.
+type Stats struct {
+	// Count and Failures are the numbers of calls since the probe started.
+	Count    int64   `json:"count"`
+	Failures int64   `json:"failures"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+// window holds the latest latencies of an operation.
+type window struct {
+	count, failures int64
+	latencies       []time.Duration
+	next            int
+}
+
+func (w *window) add(latency time.Duration, failed bool) {
+	w.count++
+	if failed {
+		w.failures++
+	}
+	if len(w.latencies) < windowSize {
+		w.latencies = append(w.latencies, latency)
+		return
+	}
+	w.latencies[w.next] = latency
+	w.next = (w.next + 1) % windowSize
+}
+
+func (w *window) stats() Stats {
+	sorted := append([]time.Duration(nil), w.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return float64(sorted[(len(sorted)-1)*p/100]) / float64(time.Millisecond)
+	}
+	return Stats{
+		Count:    w.count,
+		Failures: w.failures,
+		P50Ms:    percentile(50),
+		P95Ms:    percentile(95),
+		P99Ms:    percentile(99),
+	}
+}
+
+// Probe executes create, search and delete cycles of ISAs managed by Manager
+// against the remote ID API of a DSS instance, recording the latency of
+// every call. It is safe for concurrent use.
+type Probe struct {
+	// Client calls the API probed.
+	Client ridpb.DiscoveryAndSynchronizationServiceClient
+	// Token returns the access token authorizing the calls of the probe.
+	Token  func() (string, error)
+	Clock  clockwork.Clock
+	Logger *zap.Logger
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// Run executes a cycle every period until ctx is done.
+func (p *Probe) Run(ctx context.Context, period time.Duration) {
+	ticker := p.Clock.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			if err := p.Cycle(ctx); err != nil {
+				p.Logger.Warn("SLA probe cycle failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Cycle creates an ISA, searches the area of the ISA and deletes it.
+func (p *Probe) Cycle(ctx context.Context) error {
+	token, err := p.Token()
+	if err != nil {
+		return stacktrace.Propagate(err, "Error obtaining SLA probe access token")
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	now := p.Clock.Now()
+	start, err := dssmodels.TimestampProto(now)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time")
+	}
+	end, err := dssmodels.TimestampProto(now.Add(isaDuration))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time")
+	}
+
+	id := uuid.New().String()
+	var created *ridpb.PutIdentificationServiceAreaResponse
+	err = p.measure(OperationCreate, func() (err error) {
+		created, err = p.Client.CreateIdentificationServiceArea(ctx, &ridpb.CreateIdentificationServiceAreaRequest{
+			Id: id,
+			Params: &ridpb.CreateIdentificationServiceAreaParameters{
+				Extents: &ridpb.Volume4D{
+					SpatialVolume: &ridpb.Volume3D{
+						AltitudeLo: 0,
+						AltitudeHi: 120,
+						Footprint:  &ridpb.GeoPolygon{Vertices: area},
+					},
+					TimeStart: start,
+					TimeEnd:   end,
+				},
+				FlightsUrl: "https://" + Manager + ".invalid/flights",
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return stacktrace.Propagate(err, "Error creating SLA probe ISA")
+	}
+
+	err = p.measure(OperationSearch, func() error {
+		_, err := p.Client.SearchIdentificationServiceAreas(ctx, &ridpb.SearchIdentificationServiceAreasRequest{
+			Area:         searchArea(),
+			EarliestTime: start,
+			LatestTime:   end,
+		})
+		return err
+	})
+	if err != nil {
+		p.Logger.Warn("SLA probe search failed", zap.Error(err))
+	}
+
+	err = p.measure(OperationDelete, func() error {
+		_, err := p.Client.DeleteIdentificationServiceArea(ctx, &ridpb.DeleteIdentificationServiceAreaRequest{
+			Id:      id,
+			Version: created.GetServiceArea().GetVersion(),
+		})
+		return err
+	})
+	if err != nil {
+		return stacktrace.Propagate(err, "Error deleting SLA probe ISA %s", id)
+	}
+	return nil
+}
+
+// measure calls f, recording its latency for operation.
+func (p *Probe) measure(operation string, f func() error) error {
+	start := p.Clock.Now()
+	err := f()
+	latency := p.Clock.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.windows == nil {
+		p.windows = map[string]*window{}
+	}
+	w, ok := p.windows[operation]
+	if !ok {
+		w = &window{}
+		p.windows[operation] = w
+	}
+	w.add(latency, err != nil)
+	return err
+}
+
+// Stats returns the latency statistics of the operations called so far, by
+// operation.
+func (p *Probe) Stats() map[string]Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]Stats, len(p.windows))
+	for operation, w := range p.windows {
+		stats[operation] = w.stats()
+	}
+	return stats
+}
+
+// searchArea returns area in the format of the area parameter of
+// SearchIdentificationServiceAreas.
+func searchArea() string {
+	var s string
+	for i, v := range area {
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf("%f,%f", v.Lat, v.Lng)
+	}
+	return s
+}
+
+// NewClient returns a client of the remote ID API served at address.
+func NewClient(ctx context.Context, address string) (ridpb.DiscoveryAndSynchronizationServiceClient, error) {
+	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure())
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error dialing %s", address)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	return ridpb.NewDiscoveryAndSynchronizationServiceClient(conn), nil
+}
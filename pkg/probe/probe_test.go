@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeClient serves the calls of the probe, each taking latency.
+type fakeClient struct {
+	ridpb.DiscoveryAndSynchronizationServiceClient
+	clock      clockwork.FakeClock
+	latency    time.Duration
+	failSearch bool
+	deleted    []string
+}
+
+func (c *fakeClient) CreateIdentificationServiceArea(ctx context.Context, req *ridpb.CreateIdentificationServiceAreaRequest, _ ...grpc.CallOption) (*ridpb.PutIdentificationServiceAreaResponse, error) {
+	c.clock.Advance(c.latency)
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get("authorization")) != 1 {
+		return nil, errors.New("unauthenticated")
+	}
+	return &ridpb.PutIdentificationServiceAreaResponse{
+		ServiceArea: &ridpb.IdentificationServiceArea{Id: req.Id, Version: "v1"},
+	}, nil
+}
+
+func (c *fakeClient) SearchIdentificationServiceAreas(context.Context, *ridpb.SearchIdentificationServiceAreasRequest, ...grpc.CallOption) (*ridpb.SearchIdentificationServiceAreasResponse, error) {
+	c.clock.Advance(c.latency)
+	if c.failSearch {
+		return nil, errors.New("unavailable")
+	}
+	return &ridpb.SearchIdentificationServiceAreasResponse{}, nil
+}
+
+func (c *fakeClient) DeleteIdentificationServiceArea(_ context.Context, req *ridpb.DeleteIdentificationServiceAreaRequest, _ ...grpc.CallOption) (*ridpb.DeleteIdentificationServiceAreaResponse, error) {
+	c.clock.Advance(c.latency)
+	if req.Version != "v1" {
+		return nil, errors.New("version mismatch")
+	}
+	c.deleted = append(c.deleted, req.Id)
+	return &ridpb.DeleteIdentificationServiceAreaResponse{}, nil
+}
+
+func TestProbeCycle(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		clock  = clockwork.NewFakeClock()
+		client = &fakeClient{clock: clock}
+		p      = &Probe{
+			Client: client,
+			Token:  func() (string, error) { return "token", nil },
+			Clock:  clock,
+			Logger: zap.NewNop(),
+		}
+	)
+
+	for i := 1; i <= 100; i++ {
+		client.latency = time.Duration(i) * time.Millisecond
+		client.failSearch = i == 100
+		require.NoError(t, p.Cycle(ctx))
+	}
+	require.Len(t, client.deleted, 100)
+
+	stats := p.Stats()
+	require.Equal(t, Stats{Count: 100, P50Ms: 50, P95Ms: 95, P99Ms: 99}, stats[OperationCreate])
+	require.Equal(t, int64(1), stats[OperationSearch].Failures)
+
+	// Percentiles cover the most recent samples only.
+	client.latency = time.Second
+	for i := 0; i < windowSize; i++ {
+		require.NoError(t, p.Cycle(ctx))
+	}
+	require.Equal(t, 1000.0, p.Stats()[OperationDelete].P50Ms)
+	require.Equal(t, int64(100+windowSize), p.Stats()[OperationDelete].Count)
+}
+
+func TestTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	token, err := TokenSource(key, "dss.example.com", Manager, clockwork.NewRealClock())()
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, Manager, claims["sub"])
+	require.Equal(t, "dss.example.com", claims["aud"])
+	require.Equal(t, "dss.write.identification_service_areas dss.read.identification_service_areas", claims["scope"])
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"crypto/rsa"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	ridserver "github.com/interuss/dss/pkg/rid/server"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+)
+
+// tokenDuration is how long the access tokens signed for the probe are valid.
+const tokenDuration = 10 * time.Minute
+
+// ReadPrivateKey reads the PEM-encoded RSA key signing the access tokens of
+// the probe from path. Its public key must be accepted by the DSS probed.
+func ReadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading private key file %s", path)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(bytes)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing private key %s", path)
+	}
+	return key, nil
+}
+
+// TokenSource returns a Probe.Token signing, with key, access tokens of
+// manager granting the scopes required by the probe for audience.
+func TokenSource(key *rsa.PrivateKey, audience, manager string, clock clockwork.Clock) func() (string, error) {
+	scope := strings.Join([]string{
+		string(ridserver.Scopes.ISA.Write),
+		string(ridserver.Scopes.ISA.Read),
+	}, " ")
+	return func() (string, error) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"aud":   audience,
+			"scope": scope,
+			"iss":   manager,
+			"exp":   clock.Now().Add(tokenDuration).Unix(),
+			"sub":   manager,
+		}).SignedString(key)
+		if err != nil {
+			return "", stacktrace.Propagate(err, "Error signing access token of %s", manager)
+		}
+		return token, nil
+	}
+}
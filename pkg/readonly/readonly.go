@@ -0,0 +1,158 @@
+// Package readonly lets a DSS instance serve the calls reading its state
+// while refusing those which may change it, e.g. while the schema of its
+// database is newer than it supports or during a maintenance window.
+package readonly
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/interuss/dss/pkg/audit"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/interceptors"
+	"github.com/interuss/dss/pkg/logging"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader is the name of the response header telling the callers
+// of the refused calls when to retry them, in seconds, as the HTTP
+// Retry-After header. It is set as gRPC header metadata, in lower case.
+const RetryAfterHeader = "retry-after"
+
+// Reason is the errdetails.ErrorInfo reason of the errors of the refused
+// calls.
+const Reason = "READ_ONLY"
+
+// State is the read-only state of an instance.
+type State struct {
+	ReadOnly bool `json:"read_only"`
+	// Reason explains why the instance is read-only.
+	Reason string `json:"reason,omitempty"`
+	// RetryAfter is how long callers are told to wait before retrying the
+	// refused calls, in seconds, if known.
+	RetryAfter int64 `json:"retry_after,omitempty"`
+	// Since is when the instance became read-only.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Mode is whether an instance is read-only, which may change at any time.
+// The zero value is a Mode which is not read-only.
+type Mode struct {
+	mu    sync.RWMutex
+	state State
+}
+
+// Enable makes m read-only, explaining why with reason and telling callers
+// to retry after retryAfter, if positive.
+func (m *Mode) Enable(reason string, retryAfter time.Duration) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = State{
+		ReadOnly:   true,
+		Reason:     reason,
+		RetryAfter: int64(retryAfter / time.Second),
+		Since:      &now,
+	}
+}
+
+// Disable makes m writable.
+func (m *Mode) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = State{}
+}
+
+// State returns the current state of m.
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor failing the calls of the
+// methods which may change the state of the DSS, as told by
+// audit.IsMutation, while m is read-only. Their errors have the Unavailable
+// code and carry the reason of m as errdetails.ErrorInfo and, if known, when
+// to retry as errdetails.RetryInfo and in the RetryAfterHeader header.
+func Interceptor(m *Mode) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		state := m.State()
+		if !state.ReadOnly || !audit.IsMutation(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return nil, unavailable(ctx, info.FullMethod, state)
+	}
+}
+
+// StreamInterceptor returns a grpc.StreamServerInterceptor failing the
+// streams Interceptor would fail while m is read-only.
+func StreamInterceptor(m *Mode) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		state := m.State()
+		if !state.ReadOnly || !audit.IsMutation(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		return unavailable(ss.Context(), info.FullMethod, state)
+	}
+}
+
+// unavailable returns the error refusing a call to method while in state.
+func unavailable(ctx context.Context, method string, state State) error {
+	message := fmt.Sprintf("DSS instance is read-only: %s", state.Reason)
+	details := []proto.Message{&errdetails.ErrorInfo{
+		Reason:   Reason,
+		Domain:   dsserr.ErrorDomain,
+		Metadata: map[string]string{"reason": state.Reason},
+	}}
+	if state.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Duration(state.RetryAfter) * time.Second),
+		})
+		if err := grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, strconv.FormatInt(state.RetryAfter, 10))); err != nil {
+			logging.WithValuesFromContext(ctx, logging.Logger).Warn(
+				"Error setting retry-after header", zap.String("method", method), zap.Error(err))
+		}
+	}
+	p, err := dsserr.MakeStatusProto(codes.Unavailable, message, details...)
+	if err != nil {
+		return status.Error(codes.Unavailable, message)
+	}
+	return status.ErrorProto(p)
+}
+
+// Factory returns the interceptors.Factory of the interceptors failing the
+// calls Interceptor fails while maintenance or schema is read-only. schema is
+// the mode derived from the version of the database schema at startup,
+// which unlike maintenance is not toggled at runtime.
+func Factory(maintenance, schema *Mode) interceptors.Factory {
+	return interceptors.Of(
+		grpc_middleware.ChainUnaryServer(Interceptor(schema), Interceptor(maintenance)),
+		grpc_middleware.ChainStreamServer(StreamInterceptor(schema), StreamInterceptor(maintenance)),
+	)
+}
+
+// First returns the state of the first of modes which is read-only, or the
+// State of a writable instance if none is.
+func First(modes ...*Mode) State {
+	for _, m := range modes {
+		if m == nil {
+			continue
+		}
+		if state := m.State(); state.ReadOnly {
+			return state
+		}
+	}
+	return State{}
+}
@@ -0,0 +1,125 @@
+package readonly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterceptor(t *testing.T) {
+	m := &Mode{}
+	interceptor := Interceptor(m)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	query := &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/QueryOperationalIntentReferences"}
+	put := &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/PutOperationalIntentReference"}
+
+	resp, err := interceptor(context.Background(), nil, put, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	m.Enable("schema too new", 0)
+	resp, err = interceptor(context.Background(), nil, query, handler)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	_, err = interceptor(context.Background(), nil, put, handler)
+	require.Error(t, err)
+	s, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.Unavailable, s.Code())
+	require.Len(t, s.Details(), 1)
+	require.Equal(t, Reason, s.Details()[0].(*errdetails.ErrorInfo).Reason)
+
+	m.Enable("maintenance", 10*time.Minute)
+	_, err = interceptor(context.Background(), nil, put, handler)
+	s, _ = status.FromError(err)
+	require.Equal(t, codes.Unavailable, s.Code())
+	require.Len(t, s.Details(), 2)
+	require.Equal(t, 10*time.Minute, s.Details()[1].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+
+	m.Disable()
+	_, err = interceptor(context.Background(), nil, put, handler)
+	require.NoError(t, err)
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	var (
+		m           = &Mode{}
+		interceptor = StreamInterceptor(m)
+		ss          = &grpc_middleware.WrappedServerStream{WrappedContext: context.Background()}
+		stream      = &grpc.StreamServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationStreamingService/StreamIdentificationServiceAreas"}
+		put         = &grpc.StreamServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/PutOperationalIntentReference"}
+	)
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		return nil
+	}
+
+	m.Enable("schema too new", 0)
+	require.NoError(t, interceptor(nil, ss, stream, handler))
+	err := interceptor(nil, ss, put, handler)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	m.Disable()
+	require.NoError(t, interceptor(nil, ss, put, handler))
+}
+
+func TestModeState(t *testing.T) {
+	m := &Mode{}
+	require.False(t, m.State().ReadOnly)
+
+	m.Enable("maintenance", 90*time.Second)
+	state := m.State()
+	require.True(t, state.ReadOnly)
+	require.Equal(t, "maintenance", state.Reason)
+	require.Equal(t, int64(90), state.RetryAfter)
+	require.NotNil(t, state.Since)
+
+	m.Disable()
+	require.Equal(t, State{}, m.State())
+}
+
+func TestFactory(t *testing.T) {
+	var (
+		ctx         = context.Background()
+		maintenance = &Mode{}
+		put         = &grpc.UnaryServerInfo{FullMethod: "/scdpb.UTMAPIUSSDSSAndUSSUSSService/PutOperationalIntentReference"}
+		handler     = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "ok", nil
+		}
+	)
+	i, err := Factory(maintenance, &Mode{})(ctx)
+	require.NoError(t, err)
+	_, err = i.Unary(ctx, nil, put, handler)
+	require.NoError(t, err)
+	maintenance.Enable("maintenance", 0)
+	_, err = i.Unary(ctx, nil, put, handler)
+	require.Error(t, err)
+
+	maintenance.Disable()
+	schema := &Mode{}
+	schema.Enable("schema too new", 0)
+	i, err = Factory(maintenance, schema)(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, i.Stream)
+	_, err = i.Unary(ctx, nil, put, handler)
+	require.Contains(t, err.Error(), "schema too new")
+}
+
+func TestFirst(t *testing.T) {
+	maintenance, schema := &Mode{}, &Mode{}
+	require.False(t, First(maintenance, nil, schema).ReadOnly)
+
+	maintenance.Enable("maintenance", time.Minute)
+	schema.Enable("schema too new", 0)
+	require.Equal(t, "schema too new", First(schema, maintenance).Reason)
+	require.Equal(t, "maintenance", First(nil, maintenance, schema).Reason)
+}
@@ -0,0 +1,51 @@
+package restrictions
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// Config is the configuration of the write restrictions of an instance.
+type Config struct {
+	// Refresh is the period at which the restrictions are reloaded from the
+	// Store.
+	Refresh time.Duration
+}
+
+// RegisterFlags registers the command line flags setting c in fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Refresh, "write_restrictions_refresh", 30*time.Second, "period at which the write restrictions are reloaded from the database")
+}
+
+// Start returns a Set with the restrictions persisted in db, the database
+// named dbName, and keeps it in sync with db until ctx is done. Without db,
+// the restrictions of the Set only apply to this instance.
+func Start(ctx context.Context, c Config, db *cockroach.DB, dbName string, logger *zap.Logger) (*Set, error) {
+	var store Store
+	if db != nil {
+		s, err := NewDBStore(ctx, db, dbName)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to open the store of write restrictions")
+		}
+		store = s
+	}
+	return start(ctx, c, store, logger)
+}
+
+// start returns a Set with the restrictions persisted in store, which may be
+// nil, and keeps it in sync with store until ctx is done.
+func start(ctx context.Context, c Config, store Store, logger *zap.Logger) (*Set, error) {
+	set := NewSet(store)
+	if err := set.Refresh(ctx); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to load write restrictions")
+	}
+	if store != nil {
+		go set.Run(ctx, c.Refresh, logger)
+	}
+	return set, nil
+}
@@ -0,0 +1,223 @@
+// Package restrictions lets pool operators reserve the writes of entities in
+// some areas to specific managers, e.g. to the authority managing a temporary
+// flight restriction. Restrictions are persisted in a Store shared by all
+// the instances of a deployment, which refresh them periodically.
+package restrictions
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+)
+
+// Default is the Set enforced by the remote ID and strategic conflict
+// detection applications.
+var Default = NewSet(nil)
+
+// Kinds are the kinds of entity whose writes may be restricted.
+var Kinds = []string{events.KindISA, events.KindOperationalIntent, events.KindConstraint}
+
+// Restriction reserves the writes of the entities covering any of its cells
+// to its managers.
+type Restriction struct {
+	// Name identifies the restriction.
+	Name string `json:"name"`
+	// Cells is the normalized union of the cells restricted.
+	Cells s2.CellUnion `json:"-"`
+	// Managers are the only managers allowed to write the entities covering
+	// Cells.
+	Managers []string `json:"managers"`
+	// Kinds are the kinds of entity restricted, all of Kinds if empty.
+	Kinds []string `json:"kinds,omitempty"`
+	// Reason is reported to the managers whose writes are rejected.
+	Reason string `json:"reason"`
+}
+
+// Validate normalizes the cells of r and returns a BadRequest error if r is
+// incomplete.
+func (r *Restriction) Validate() error {
+	if r.Name == "" || strings.ContainsAny(r.Name, "/?#") {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid restriction name %q", r.Name)
+	}
+	if len(r.Cells) == 0 {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Restriction %s covers no cells", r.Name)
+	}
+	for _, cell := range r.Cells {
+		if !cell.IsValid() {
+			return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Restriction %s covers invalid cell %d", r.Name, uint64(cell))
+		}
+	}
+	if len(r.Managers) == 0 {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Restriction %s allows no manager", r.Name)
+	}
+	for _, kind := range r.Kinds {
+		known := false
+		for _, k := range Kinds {
+			known = known || k == kind
+		}
+		if !known {
+			return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Restriction %s names unknown kind %s", r.Name, kind)
+		}
+	}
+	r.Cells.Normalize()
+	return nil
+}
+
+// restricts returns whether r rejects the write by manager of an entity of
+// kind covering cells.
+func (r *Restriction) restricts(kind, manager string, cells s2.CellUnion) bool {
+	if len(r.Kinds) > 0 {
+		restricted := false
+		for _, k := range r.Kinds {
+			restricted = restricted || k == kind
+		}
+		if !restricted {
+			return false
+		}
+	}
+	for _, m := range r.Managers {
+		if m == manager {
+			return false
+		}
+	}
+	return r.Cells.Intersects(cells)
+}
+
+// Store persists the restrictions, shared by all the instances of a
+// deployment.
+type Store interface {
+	// LoadRestrictions returns all the restrictions.
+	LoadRestrictions(ctx context.Context) ([]*Restriction, error)
+	// StoreRestriction creates or replaces the restriction named r.Name.
+	StoreRestriction(ctx context.Context, r *Restriction) error
+	// DeleteRestriction removes the restriction named name, if any.
+	DeleteRestriction(ctx context.Context, name string) error
+}
+
+// Set holds the restrictions enforced by an instance. They are loaded from
+// its Store, if any, by Refresh.
+type Set struct {
+	store Store
+
+	mu           sync.RWMutex
+	restrictions map[string]*Restriction
+}
+
+// NewSet returns a Set with the restrictions persisted in store, which may be
+// nil to only apply them to this instance.
+func NewSet(store Store) *Set {
+	return &Set{store: store, restrictions: map[string]*Restriction{}}
+}
+
+// Check returns a PermissionDenied error naming the first restriction, by
+// name, rejecting the write by manager of an entity of kind covering cells.
+func (s *Set) Check(kind, manager string, cells s2.CellUnion) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var rejecting *Restriction
+	for _, r := range s.restrictions {
+		if r.restricts(kind, manager, cells) && (rejecting == nil || r.Name < rejecting.Name) {
+			rejecting = r
+		}
+	}
+	if rejecting == nil {
+		return nil
+	}
+	return stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
+		"Area is write-restricted to %s by restriction %s: %s",
+		strings.Join(rejecting.Managers, ", "), rejecting.Name, rejecting.Reason)
+}
+
+// Restrictions returns the restrictions of s, sorted by name.
+func (s *Set) Restrictions() []*Restriction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*Restriction, 0, len(s.restrictions))
+	for _, r := range s.restrictions {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Refresh loads the restrictions from the Store of s.
+func (s *Set) Refresh(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+	loaded, err := s.store.LoadRestrictions(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to load write restrictions")
+	}
+	restrictions := make(map[string]*Restriction, len(loaded))
+	for _, r := range loaded {
+		r.Cells.Normalize()
+		restrictions[r.Name] = r
+	}
+	s.mu.Lock()
+	s.restrictions = restrictions
+	s.mu.Unlock()
+	return nil
+}
+
+// Put validates and persists r, replacing the restriction of the same name,
+// and applies it to s. Other instances apply it at their next Refresh.
+func (s *Set) Put(ctx context.Context, r *Restriction) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if s.store != nil {
+		if err := s.store.StoreRestriction(ctx, r); err != nil {
+			return stacktrace.Propagate(err, "Failed to persist write restriction %s", r.Name)
+		}
+	}
+	s.update(func(restrictions map[string]*Restriction) { restrictions[r.Name] = r })
+	return nil
+}
+
+// Delete removes the restriction named name, if any, like Put.
+func (s *Set) Delete(ctx context.Context, name string) error {
+	if s.store != nil {
+		if err := s.store.DeleteRestriction(ctx, name); err != nil {
+			return stacktrace.Propagate(err, "Failed to delete write restriction %s", name)
+		}
+	}
+	s.update(func(restrictions map[string]*Restriction) { delete(restrictions, name) })
+	return nil
+}
+
+// update replaces the restrictions of s with a copy modified by f.
+func (s *Set) update(f func(map[string]*Restriction)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	restrictions := make(map[string]*Restriction, len(s.restrictions)+1)
+	for k, v := range s.restrictions {
+		restrictions[k] = v
+	}
+	f(restrictions)
+	s.restrictions = restrictions
+}
+
+// Run refreshes s every period until ctx is done.
+func (s *Set) Run(ctx context.Context, period time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				logger.Warn("Failed to refresh write restrictions", zap.Error(err))
+			}
+		}
+	}
+}
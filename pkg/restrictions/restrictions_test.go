@@ -0,0 +1,90 @@
+package restrictions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type mapStore map[string]*Restriction
+
+func (m mapStore) LoadRestrictions(ctx context.Context) ([]*Restriction, error) {
+	var result []*Restriction
+	for _, r := range m {
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func (m mapStore) StoreRestriction(ctx context.Context, r *Restriction) error {
+	m[r.Name] = r
+	return nil
+}
+
+func (m mapStore) DeleteRestriction(ctx context.Context, name string) error {
+	delete(m, name)
+	return nil
+}
+
+func TestSetCheck(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		store  = mapStore{}
+		set    = NewSet(store)
+		other  = NewSet(store)
+		leaf   = s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)
+		inside = s2.CellUnion{leaf}
+		// outside is a cell of the same level next to the restricted area.
+		outside = s2.CellUnion{leaf.Parent(8).Next().ChildBeginAtLevel(13)}
+	)
+	require.NoError(t, set.Check(events.KindConstraint, "uss1", inside))
+
+	require.Error(t, set.Put(ctx, &Restriction{Name: "tfr", Managers: []string{"authority"}}))
+	require.NoError(t, set.Put(ctx, &Restriction{
+		Name:     "tfr",
+		Cells:    s2.CellUnion{leaf.Parent(8)},
+		Managers: []string{"authority"},
+		Kinds:    []string{events.KindOperationalIntent, events.KindConstraint},
+		Reason:   "Temporary flight restriction",
+	}))
+
+	err := set.Check(events.KindConstraint, "uss1", inside)
+	require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+	require.Contains(t, err.Error(), "restricted to authority by restriction tfr: Temporary flight restriction")
+	require.NoError(t, set.Check(events.KindConstraint, "authority", inside))
+	require.NoError(t, set.Check(events.KindConstraint, "uss1", outside))
+	require.NoError(t, set.Check(events.KindISA, "uss1", inside))
+
+	// Other instances apply the restrictions once refreshed.
+	require.NoError(t, other.Check(events.KindOperationalIntent, "uss1", inside))
+	require.NoError(t, other.Refresh(ctx))
+	require.Error(t, other.Check(events.KindOperationalIntent, "uss1", inside))
+	require.Len(t, other.Restrictions(), 1)
+
+	require.NoError(t, set.Delete(ctx, "tfr"))
+	require.NoError(t, set.Check(events.KindConstraint, "uss1", inside))
+	require.NoError(t, other.Refresh(ctx))
+	require.Empty(t, other.Restrictions())
+}
+
+func TestStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaf := s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)
+	store := mapStore{"tfr": {Name: "tfr", Cells: s2.CellUnion{leaf.Parent(8)}, Managers: []string{"authority"}}}
+	set, err := start(ctx, Config{Refresh: time.Hour}, store, zap.NewNop())
+	require.NoError(t, err)
+	require.Error(t, set.Check(events.KindISA, "uss1", s2.CellUnion{leaf}))
+
+	set, err = Start(ctx, Config{}, nil, "", zap.NewNop())
+	require.NoError(t, err)
+	require.Empty(t, set.Restrictions())
+}
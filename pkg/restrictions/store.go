@@ -0,0 +1,100 @@
+package restrictions
+
+import (
+	"context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// minSchemaVersion is the first version of the remote ID schema holding the
+// write_restrictions table.
+var minSchemaVersion = *semver.New("3.9.0")
+
+// DBStore persists the restrictions in the remote ID database.
+type DBStore struct {
+	db *cockroach.DB
+}
+
+// NewDBStore returns a DBStore persisting to db, which must be the database
+// named dbName.
+func NewDBStore(ctx context.Context, db *cockroach.DB, dbName string) (*DBStore, error) {
+	vs, err := db.GetVersion(ctx, dbName)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for write restrictions")
+	}
+	if vs.Compare(minSchemaVersion) < 0 {
+		return nil, stacktrace.NewError("Write restrictions require schema version %s of %s, got %s", minSchemaVersion, dbName, vs)
+	}
+	return &DBStore{db: db}, nil
+}
+
+// LoadRestrictions implements Store.
+func (s *DBStore) LoadRestrictions(ctx context.Context) ([]*Restriction, error) {
+	const query = `
+		SELECT
+			name, cells, managers, kinds, reason
+		FROM
+			write_restrictions`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	var result []*Restriction
+	for rows.Next() {
+		var (
+			r     = new(Restriction)
+			cells pq.Int64Array
+		)
+		if err := rows.Scan(&r.Name, &cells, (*pq.StringArray)(&r.Managers), (*pq.StringArray)(&r.Kinds), &r.Reason); err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning write restriction row")
+		}
+		r.Cells = geo.CellUnionFromInt64(cells)
+		result = append(result, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// StoreRestriction implements Store.
+func (s *DBStore) StoreRestriction(ctx context.Context, r *Restriction) error {
+	const query = `
+		UPSERT INTO
+			write_restrictions
+			(name, cells, managers, kinds, reason, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, now())`
+
+	// A nil array would be stored as NULL.
+	kinds := append(pq.StringArray{}, r.Kinds...)
+	cids := make(pq.Int64Array, len(r.Cells))
+	for i, cell := range r.Cells {
+		cids[i] = int64(cell)
+	}
+	if _, err := s.db.ExecContext(ctx, query, r.Name, cids, pq.StringArray(r.Managers), kinds, r.Reason); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
+
+// DeleteRestriction implements Store.
+func (s *DBStore) DeleteRestriction(ctx context.Context, name string) error {
+	const query = `
+		DELETE FROM
+			write_restrictions
+		WHERE
+			name = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, name); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+// Package adapter serves the F3411-22a (RID v2) DSS API on top of the
+// F3411-19 (RID v1) gRPC service, so that both API versions read and write
+// the same identification service areas and subscriptions.
+//
+// The two versions differ mostly in representation: v2 carries USS base URLs
+// where v1 carries the full URLs of the flights and notification endpoints,
+// and v2 wraps times and altitudes in objects stating their format.  The
+// adapter stores the v1 URLs derived from v2 base URLs, so that v1 clients
+// see v2 entities as if they had been created through v1.
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// V2PathPrefix is the path prefix of all RID v2 DSS endpoints.
+	V2PathPrefix = "/rid/v2/dss/"
+
+	isasCollection          = "identification_service_areas"
+	subscriptionsCollection = "subscriptions"
+)
+
+// ErrorHandler writes err, a gRPC status error, as the HTTP response to r.
+type ErrorHandler func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error)
+
+// v2Handler serves the RID v2 DSS API by translating requests to the RID v1
+// gRPC service.
+type v2Handler struct {
+	client         ridpb.DiscoveryAndSynchronizationServiceClient
+	onError        ErrorHandler
+	forwardHeaders []string
+}
+
+// NewV2Handler returns an http.Handler serving the RID v2 DSS API under
+// V2PathPrefix using client. Errors are written with onError. The values of
+// the request headers in forwardHeaders are forwarded to client as gRPC
+// metadata in addition to the Authorization header.
+func NewV2Handler(client ridpb.DiscoveryAndSynchronizationServiceClient, onError ErrorHandler, forwardHeaders ...string) http.Handler {
+	return &v2Handler{
+		client:         client,
+		onError:        onError,
+		forwardHeaders: append([]string{"authorization"}, forwardHeaders...),
+	}
+}
+
+func (h *v2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	for _, header := range h.forwardHeaders {
+		if v := r.Header.Get(header); v != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(header), v)
+		}
+	}
+
+	var (
+		parts    = strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, V2PathPrefix), "/"), "/")
+		response interface{}
+		err      error
+	)
+	switch {
+	case parts[0] == isasCollection:
+		response, err = h.serveISAs(ctx, r, parts[1:])
+	case parts[0] == subscriptionsCollection:
+		response, err = h.serveSubscriptions(ctx, r, parts[1:])
+	default:
+		err = status.Error(codes.NotFound, "Not found")
+	}
+	if err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.onError(ctx, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.onError(ctx, w, r, status.Error(codes.Internal, "Error encoding response"))
+	}
+}
+
+// route returns the kind of request addressed to a collection given the
+// path segments following the collection name.
+func route(method string, segments []string) string {
+	switch {
+	case len(segments) == 0 && method == http.MethodGet:
+		return "search"
+	case len(segments) == 1 && method == http.MethodGet:
+		return "get"
+	case len(segments) == 1 && method == http.MethodPut:
+		return "create"
+	case len(segments) == 2 && method == http.MethodPut:
+		return "update"
+	case len(segments) == 2 && method == http.MethodDelete:
+		return "delete"
+	}
+	return ""
+}
+
+func methodNotAllowed() error {
+	return status.Error(codes.Unimplemented, "Method or path not supported")
+}
+
+func decodeParameters(r *http.Request) (*v2PutParameters, *ridpb.Volume4D, error) {
+	params := &v2PutParameters{}
+	if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Error decoding request body")
+	}
+	if params.USSBaseURL == "" {
+		return nil, nil, stacktrace.NewError("Missing uss_base_url")
+	}
+	extents, err := volume4DFromV2(params.Extents)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Invalid extents")
+	}
+	return params, extents, nil
+}
+
+func (h *v2Handler) serveISAs(ctx context.Context, r *http.Request, segments []string) (interface{}, error) {
+	switch route(r.Method, segments) {
+	case "search":
+		req := &ridpb.SearchIdentificationServiceAreasRequest{Area: r.URL.Query().Get("area")}
+		for param, target := range map[string]**timestamp.Timestamp{
+			"earliest_time": &req.EarliestTime,
+			"latest_time":   &req.LatestTime,
+		} {
+			if v := r.URL.Query().Get(param); v != "" {
+				t, err := dssmodels.RequestTimes.Parse(v)
+				if err != nil {
+					return nil, stacktrace.Propagate(err, "Invalid %s", param)
+				}
+				if *target, err = dssmodels.TimestampProto(t); err != nil {
+					return nil, stacktrace.Propagate(err, "Invalid %s", param)
+				}
+			}
+		}
+		resp, err := h.client.SearchIdentificationServiceAreas(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		isas, err := isasToV2(resp.ServiceAreas)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &v2SearchISAsResponse{ServiceAreas: isas}, nil
+
+	case "get":
+		resp, err := h.client.GetIdentificationServiceArea(ctx, &ridpb.GetIdentificationServiceAreaRequest{Id: segments[0]})
+		if err != nil {
+			return nil, err
+		}
+		return h.isaResponse(resp.ServiceArea, nil)
+
+	case "create":
+		params, extents, err := decodeParameters(r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.client.CreateIdentificationServiceArea(ctx, &ridpb.CreateIdentificationServiceAreaRequest{
+			Id: segments[0],
+			Params: &ridpb.CreateIdentificationServiceAreaParameters{
+				Extents:    extents,
+				FlightsUrl: flightsURL(params.USSBaseURL),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.isaResponse(resp.ServiceArea, resp.Subscribers)
+
+	case "update":
+		params, extents, err := decodeParameters(r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.client.UpdateIdentificationServiceArea(ctx, &ridpb.UpdateIdentificationServiceAreaRequest{
+			Id:      segments[0],
+			Version: segments[1],
+			Params: &ridpb.UpdateIdentificationServiceAreaParameters{
+				Extents:    extents,
+				FlightsUrl: flightsURL(params.USSBaseURL),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.isaResponse(resp.ServiceArea, resp.Subscribers)
+
+	case "delete":
+		resp, err := h.client.DeleteIdentificationServiceArea(ctx, &ridpb.DeleteIdentificationServiceAreaRequest{
+			Id:      segments[0],
+			Version: segments[1],
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.isaResponse(resp.ServiceArea, resp.Subscribers)
+	}
+	return nil, methodNotAllowed()
+}
+
+func (h *v2Handler) isaResponse(isa *ridpb.IdentificationServiceArea, subscribers []*ridpb.SubscriberToNotify) (interface{}, error) {
+	v2, err := isaToV2(isa)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v2ISAResponse{ServiceArea: v2, Subscribers: subscribersToV2(subscribers)}, nil
+}
+
+func (h *v2Handler) serveSubscriptions(ctx context.Context, r *http.Request, segments []string) (interface{}, error) {
+	switch route(r.Method, segments) {
+	case "search":
+		resp, err := h.client.SearchSubscriptions(ctx, &ridpb.SearchSubscriptionsRequest{Area: r.URL.Query().Get("area")})
+		if err != nil {
+			return nil, err
+		}
+		result := &v2SearchSubscriptionsResponse{Subscriptions: []*v2Subscription{}}
+		for _, sub := range resp.Subscriptions {
+			v2, err := subscriptionToV2(sub)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			result.Subscriptions = append(result.Subscriptions, v2)
+		}
+		return result, nil
+
+	case "get":
+		resp, err := h.client.GetSubscription(ctx, &ridpb.GetSubscriptionRequest{Id: segments[0]})
+		if err != nil {
+			return nil, err
+		}
+		return h.subscriptionResponse(resp.Subscription, nil)
+
+	case "create":
+		params, extents, err := decodeParameters(r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.client.CreateSubscription(ctx, &ridpb.CreateSubscriptionRequest{
+			Id: segments[0],
+			Params: &ridpb.CreateSubscriptionParameters{
+				Extents:   extents,
+				Callbacks: &ridpb.SubscriptionCallbacks{IdentificationServiceAreaUrl: isaCallbackURL(params.USSBaseURL)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.subscriptionResponse(resp.Subscription, resp.ServiceAreas)
+
+	case "update":
+		params, extents, err := decodeParameters(r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := h.client.UpdateSubscription(ctx, &ridpb.UpdateSubscriptionRequest{
+			Id:      segments[0],
+			Version: segments[1],
+			Params: &ridpb.UpdateSubscriptionParameters{
+				Extents:   extents,
+				Callbacks: &ridpb.SubscriptionCallbacks{IdentificationServiceAreaUrl: isaCallbackURL(params.USSBaseURL)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.subscriptionResponse(resp.Subscription, resp.ServiceAreas)
+
+	case "delete":
+		resp, err := h.client.DeleteSubscription(ctx, &ridpb.DeleteSubscriptionRequest{
+			Id:      segments[0],
+			Version: segments[1],
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.subscriptionResponse(resp.Subscription, nil)
+	}
+	return nil, methodNotAllowed()
+}
+
+func (h *v2Handler) subscriptionResponse(sub *ridpb.Subscription, isas []*ridpb.IdentificationServiceArea) (interface{}, error) {
+	v2, err := subscriptionToV2(sub)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	result := &v2SubscriptionResponse{Subscription: v2}
+	if isas != nil {
+		if result.ServiceAreas, err = isasToV2(isas); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return result, nil
+}
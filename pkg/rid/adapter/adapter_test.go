@@ -0,0 +1,134 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClient struct {
+	ridpb.DiscoveryAndSynchronizationServiceClient
+
+	createISA     *ridpb.CreateIdentificationServiceAreaRequest
+	authorization []string
+}
+
+func (c *fakeClient) CreateIdentificationServiceArea(ctx context.Context, req *ridpb.CreateIdentificationServiceAreaRequest, _ ...grpc.CallOption) (*ridpb.PutIdentificationServiceAreaResponse, error) {
+	c.createISA = req
+	md, _ := metadata.FromOutgoingContext(ctx)
+	c.authorization = md.Get("authorization")
+	return &ridpb.PutIdentificationServiceAreaResponse{
+		ServiceArea: &ridpb.IdentificationServiceArea{
+			Id:         req.Id,
+			Owner:      "uss1",
+			FlightsUrl: req.Params.FlightsUrl,
+			Version:    "v1",
+			TimeStart:  req.Params.Extents.TimeStart,
+			TimeEnd:    req.Params.Extents.TimeEnd,
+		},
+		Subscribers: []*ridpb.SubscriberToNotify{{
+			Url:           "https://uss2.example.com/rid/v2" + isaCallbackPath,
+			Subscriptions: []*ridpb.SubscriptionState{{SubscriptionId: "sub1", NotificationIndex: 3}},
+		}},
+	}, nil
+}
+
+func (c *fakeClient) GetIdentificationServiceArea(ctx context.Context, req *ridpb.GetIdentificationServiceAreaRequest, _ ...grpc.CallOption) (*ridpb.GetIdentificationServiceAreaResponse, error) {
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+func TestCreateISA(t *testing.T) {
+	var (
+		client = &fakeClient{}
+		h      = NewV2Handler(client, func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+			t.Fatalf("unexpected error: %v", err)
+		})
+		body = `{
+			"extents": {
+				"volume": {
+					"outline_polygon": {"vertices": [{"lat": 37.1, "lng": -122.1}, {"lat": 37.2, "lng": -122.1}, {"lat": 37.2, "lng": -122.2}]},
+					"altitude_lower": {"value": 20, "reference": "W84", "units": "M"},
+					"altitude_upper": {"value": 400, "reference": "W84", "units": "M"}
+				},
+				"time_start": {"value": "2022-01-01T10:00:00Z", "format": "RFC3339"},
+				"time_end": {"value": "2022-01-01T11:00:00Z", "format": "RFC3339"}
+			},
+			"uss_base_url": "https://uss1.example.com/rid/v2"
+		}`
+		req = httptest.NewRequest(http.MethodPut, V2PathPrefix+"identification_service_areas/b6a4ca8c-c2b1-4a4e-8d4e-8e8b8a4e5c7d", strings.NewReader(body))
+		w   = httptest.NewRecorder()
+	)
+	req.Header.Set("Authorization", "Bearer token")
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Equal(t, []string{"Bearer token"}, client.authorization)
+	require.Equal(t, "https://uss1.example.com/rid/v2/uss/flights", client.createISA.Params.FlightsUrl)
+	require.Len(t, client.createISA.Params.Extents.SpatialVolume.Footprint.Vertices, 3)
+	require.Equal(t, float32(400), client.createISA.Params.Extents.SpatialVolume.AltitudeHi)
+	start, err := ptypes.Timestamp(client.createISA.Params.Extents.TimeStart)
+	require.NoError(t, err)
+	require.True(t, start.Equal(time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)))
+
+	var resp v2ISAResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "https://uss1.example.com/rid/v2", resp.ServiceArea.USSBaseURL)
+	require.Equal(t, "2022-01-01T10:00:00Z", resp.ServiceArea.TimeStart.Value)
+	require.Equal(t, timeFormatRFC3339, resp.ServiceArea.TimeStart.Format)
+	require.Len(t, resp.Subscribers, 1)
+	require.Equal(t, "https://uss2.example.com/rid/v2", resp.Subscribers[0].URL)
+	require.Equal(t, int32(3), resp.Subscribers[0].Subscriptions[0].NotificationIndex)
+}
+
+func TestErrors(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   codes.Code
+	}{
+		{"backend error", http.MethodGet, "identification_service_areas/foo", "", codes.NotFound},
+		{"unknown collection", http.MethodGet, "flights", "", codes.NotFound},
+		{"unsupported method", http.MethodPost, "subscriptions/foo", "", codes.Unimplemented},
+		{"missing base URL", http.MethodPut, "subscriptions/foo", `{"extents": {"volume": {}}}`, codes.InvalidArgument},
+		{"unsupported units", http.MethodPut, "subscriptions/foo", `{"uss_base_url": "https://uss", "extents": {"volume": {"altitude_lower": {"value": 1, "units": "NM"}}}}`, codes.InvalidArgument},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var got error
+			h := NewV2Handler(&fakeClient{}, func(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+				got = err
+			})
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, V2PathPrefix+c.path, strings.NewReader(c.body)))
+			require.Equal(t, c.code, status.Code(got))
+		})
+	}
+}
+
+func TestCircleToPolygon(t *testing.T) {
+	polygon, err := circleToPolygon(&v2Circle{
+		Center: &v2LatLngPoint{Lat: 46.5, Lng: 6.6},
+		Radius: &v2Radius{Value: 1000, Units: unitsMeters},
+	})
+	require.NoError(t, err)
+	require.Len(t, polygon.Vertices, circlePolygonEdges)
+	for _, v := range polygon.Vertices {
+		require.InDelta(t, 46.5, v.Lat, 0.01)
+		require.InDelta(t, 6.6, v.Lng, 0.02)
+	}
+
+	_, err = circleToPolygon(&v2Circle{Center: &v2LatLngPoint{}})
+	require.Error(t, err)
+}
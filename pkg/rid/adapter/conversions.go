@@ -0,0 +1,213 @@
+package adapter
+
+import (
+	"math"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/units"
+	"github.com/interuss/stacktrace"
+)
+
+const earthRadiusMeters = 6371010.0
+
+// flightsURL returns the F3411-19 flights_url of the USS at baseURL.
+func flightsURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + flightsPath
+}
+
+// isaCallbackURL returns the F3411-19 identification_service_area_url of the
+// USS at baseURL.
+func isaCallbackURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + isaCallbackPath
+}
+
+// ussBaseURL returns the F3411-22a uss_base_url corresponding to the
+// F3411-19 url, the latter being returned unchanged if it does not end in
+// the expected path.
+func ussBaseURL(url, path string) string {
+	return strings.TrimSuffix(url, path)
+}
+
+func timeToV2(ts *timestamp.Timestamp) (*v2Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error converting timestamp")
+	}
+	return &v2Time{Value: dssmodels.FormatTime(t), Format: timeFormatRFC3339}, nil
+}
+
+func timeFromV2(t *v2Time) (*timestamp.Timestamp, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.Format != "" && t.Format != timeFormatRFC3339 {
+		return nil, stacktrace.NewError("Unsupported time format %s", t.Format)
+	}
+	parsed, err := dssmodels.RequestTimes.Parse(t.Value)
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.TimestampProto(parsed)
+}
+
+func altitudeFromV2(a *v2Altitude) (float32, error) {
+	if a == nil {
+		return 0, nil
+	}
+	unit, reference := a.Units, a.Reference
+	if unit == "" {
+		unit = unitsMeters
+	}
+	if reference == "" {
+		reference = altitudeReference
+	}
+	altitude, err := units.ParseAltitude(a.Value, unit, reference)
+	if err != nil {
+		return 0, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	// Remote ID volumes are not normalized to WGS84.
+	if altitude.Reference != units.W84 {
+		return 0, stacktrace.NewError("Unsupported altitude reference %s", a.Reference)
+	}
+	return float32(altitude.Meters()), nil
+}
+
+// circleToPolygon approximates c with a regular polygon inscribed in it.
+func circleToPolygon(c *v2Circle) (*ridpb.GeoPolygon, error) {
+	if c.Center == nil || c.Radius == nil {
+		return nil, stacktrace.NewError("Circle is missing center or radius")
+	}
+	if c.Radius.Units != "" && c.Radius.Units != unitsMeters {
+		return nil, stacktrace.NewError("Unsupported radius units %s", c.Radius.Units)
+	}
+	var (
+		dLat    = c.Radius.Value / earthRadiusMeters * 180 / math.Pi
+		dLng    = dLat / math.Cos(c.Center.Lat*math.Pi/180)
+		polygon = &ridpb.GeoPolygon{}
+	)
+	for i := 0; i < circlePolygonEdges; i++ {
+		angle := 2 * math.Pi * float64(i) / circlePolygonEdges
+		polygon.Vertices = append(polygon.Vertices, &ridpb.LatLngPoint{
+			Lat: c.Center.Lat + dLat*math.Sin(angle),
+			Lng: c.Center.Lng + dLng*math.Cos(angle),
+		})
+	}
+	return polygon, nil
+}
+
+func volume4DFromV2(v *v2Volume4D) (*ridpb.Volume4D, error) {
+	if v == nil || v.Volume == nil {
+		return nil, stacktrace.NewError("Missing volume")
+	}
+	result := &ridpb.Volume4D{SpatialVolume: &ridpb.Volume3D{}}
+
+	switch {
+	case v.Volume.OutlinePolygon != nil && v.Volume.OutlineCircle != nil:
+		return nil, stacktrace.NewError("Only one of outline_polygon and outline_circle may be specified")
+	case v.Volume.OutlinePolygon != nil:
+		footprint := &ridpb.GeoPolygon{}
+		for _, vertex := range v.Volume.OutlinePolygon.Vertices {
+			if vertex == nil {
+				return nil, stacktrace.NewError("Missing polygon vertex")
+			}
+			footprint.Vertices = append(footprint.Vertices, &ridpb.LatLngPoint{Lat: vertex.Lat, Lng: vertex.Lng})
+		}
+		result.SpatialVolume.Footprint = footprint
+	case v.Volume.OutlineCircle != nil:
+		footprint, err := circleToPolygon(v.Volume.OutlineCircle)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Invalid outline_circle")
+		}
+		result.SpatialVolume.Footprint = footprint
+	}
+
+	var err error
+	if result.SpatialVolume.AltitudeLo, err = altitudeFromV2(v.Volume.AltitudeLower); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid altitude_lower")
+	}
+	if result.SpatialVolume.AltitudeHi, err = altitudeFromV2(v.Volume.AltitudeUpper); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid altitude_upper")
+	}
+	if result.TimeStart, err = timeFromV2(v.TimeStart); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid time_start")
+	}
+	if result.TimeEnd, err = timeFromV2(v.TimeEnd); err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid time_end")
+	}
+	return result, nil
+}
+
+func isaToV2(isa *ridpb.IdentificationServiceArea) (*v2IdentificationServiceArea, error) {
+	if isa == nil {
+		return nil, nil
+	}
+	result := &v2IdentificationServiceArea{
+		ID:         isa.Id,
+		Owner:      isa.Owner,
+		USSBaseURL: ussBaseURL(isa.FlightsUrl, flightsPath),
+		Version:    isa.Version,
+	}
+	var err error
+	if result.TimeStart, err = timeToV2(isa.TimeStart); err != nil {
+		return nil, err
+	}
+	if result.TimeEnd, err = timeToV2(isa.TimeEnd); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func isasToV2(isas []*ridpb.IdentificationServiceArea) ([]*v2IdentificationServiceArea, error) {
+	result := make([]*v2IdentificationServiceArea, 0, len(isas))
+	for _, isa := range isas {
+		v2, err := isaToV2(isa)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error converting ISA %s", isa.GetId())
+		}
+		result = append(result, v2)
+	}
+	return result, nil
+}
+
+func subscriptionToV2(sub *ridpb.Subscription) (*v2Subscription, error) {
+	if sub == nil {
+		return nil, nil
+	}
+	result := &v2Subscription{
+		ID:                sub.Id,
+		Owner:             sub.Owner,
+		USSBaseURL:        ussBaseURL(sub.GetCallbacks().GetIdentificationServiceAreaUrl(), isaCallbackPath),
+		NotificationIndex: sub.NotificationIndex,
+		Version:           sub.Version,
+	}
+	var err error
+	if result.TimeStart, err = timeToV2(sub.TimeStart); err != nil {
+		return nil, err
+	}
+	if result.TimeEnd, err = timeToV2(sub.TimeEnd); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func subscribersToV2(subscribers []*ridpb.SubscriberToNotify) []*v2SubscriberToNotify {
+	result := make([]*v2SubscriberToNotify, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		v2 := &v2SubscriberToNotify{URL: ussBaseURL(subscriber.Url, isaCallbackPath)}
+		for _, state := range subscriber.Subscriptions {
+			v2.Subscriptions = append(v2.Subscriptions, &v2SubscriptionState{
+				SubscriptionID:    state.SubscriptionId,
+				NotificationIndex: state.NotificationIndex,
+			})
+		}
+		result = append(result, v2)
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package adapter
+
+// The types in this file model the JSON payloads of the F3411-22a (RID v2)
+// DSS API.  Only the fields the DSS populates or consumes are modeled.
+
+const (
+	timeFormatRFC3339  = "RFC3339"
+	altitudeReference  = "W84"
+	unitsMeters        = "M"
+	flightsPath        = "/uss/flights"
+	isaCallbackPath    = "/uss/identification_service_areas"
+	circlePolygonEdges = 32
+)
+
+type v2Time struct {
+	Value  string `json:"value"`
+	Format string `json:"format"`
+}
+
+type v2Altitude struct {
+	Value     float64 `json:"value"`
+	Reference string  `json:"reference"`
+	Units     string  `json:"units"`
+}
+
+type v2Radius struct {
+	Value float64 `json:"value"`
+	Units string  `json:"units"`
+}
+
+type v2LatLngPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type v2Polygon struct {
+	Vertices []*v2LatLngPoint `json:"vertices"`
+}
+
+type v2Circle struct {
+	Center *v2LatLngPoint `json:"center"`
+	Radius *v2Radius      `json:"radius"`
+}
+
+type v2Volume3D struct {
+	OutlineCircle  *v2Circle   `json:"outline_circle,omitempty"`
+	OutlinePolygon *v2Polygon  `json:"outline_polygon,omitempty"`
+	AltitudeLower  *v2Altitude `json:"altitude_lower,omitempty"`
+	AltitudeUpper  *v2Altitude `json:"altitude_upper,omitempty"`
+}
+
+type v2Volume4D struct {
+	Volume    *v2Volume3D `json:"volume"`
+	TimeStart *v2Time     `json:"time_start,omitempty"`
+	TimeEnd   *v2Time     `json:"time_end,omitempty"`
+}
+
+type v2IdentificationServiceArea struct {
+	ID         string  `json:"id"`
+	Owner      string  `json:"owner"`
+	USSBaseURL string  `json:"uss_base_url"`
+	Version    string  `json:"version"`
+	TimeStart  *v2Time `json:"time_start"`
+	TimeEnd    *v2Time `json:"time_end"`
+}
+
+type v2Subscription struct {
+	ID                string  `json:"id"`
+	Owner             string  `json:"owner"`
+	USSBaseURL        string  `json:"uss_base_url"`
+	NotificationIndex int32   `json:"notification_index"`
+	Version           string  `json:"version"`
+	TimeStart         *v2Time `json:"time_start"`
+	TimeEnd           *v2Time `json:"time_end"`
+}
+
+type v2SubscriptionState struct {
+	SubscriptionID    string `json:"subscription_id"`
+	NotificationIndex int32  `json:"notification_index"`
+}
+
+type v2SubscriberToNotify struct {
+	Subscriptions []*v2SubscriptionState `json:"subscriptions"`
+	URL           string                 `json:"url"`
+}
+
+type v2PutParameters struct {
+	Extents    *v2Volume4D `json:"extents"`
+	USSBaseURL string      `json:"uss_base_url"`
+}
+
+type v2ISAResponse struct {
+	ServiceArea *v2IdentificationServiceArea `json:"service_area"`
+	Subscribers []*v2SubscriberToNotify      `json:"subscribers,omitempty"`
+}
+
+type v2SearchISAsResponse struct {
+	ServiceAreas []*v2IdentificationServiceArea `json:"service_areas"`
+}
+
+type v2SubscriptionResponse struct {
+	Subscription *v2Subscription                `json:"subscription"`
+	ServiceAreas []*v2IdentificationServiceArea `json:"service_areas,omitempty"`
+}
+
+type v2SearchSubscriptionsResponse struct {
+	Subscriptions []*v2Subscription `json:"subscriptions"`
+}
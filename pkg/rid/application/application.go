@@ -1,6 +1,7 @@
 package application
 
 import (
+	dssmodels "github.com/interuss/dss/pkg/models"
 	"github.com/interuss/dss/pkg/rid/store"
 	"github.com/jonboulle/clockwork"
 	"go.uber.org/zap"
@@ -17,6 +18,7 @@ type app struct {
 	store.Store
 	clock  clockwork.Clock
 	logger *zap.Logger
+	limits dssmodels.Limits
 }
 
 type App interface {
@@ -25,11 +27,16 @@ type App interface {
 }
 
 // NewFromTransactor is a convenience function for creating an App
-// with the given store.
-func NewFromTransactor(store store.Store, logger *zap.Logger) App {
+// with the given store, rejecting ISAs and Subscriptions exceeding limits and
+// bounding each repository call with timeouts.
+func NewFromTransactor(store store.Store, logger *zap.Logger, limits dssmodels.Limits, timeouts dssmodels.Timeouts) App {
+	if timeouts != (dssmodels.Timeouts{}) {
+		store = &timeoutStore{Store: store, timeouts: timeouts}
+	}
 	return &app{
 		Store:  store,
 		clock:  DefaultClock,
 		logger: logger,
+		limits: limits,
 	}
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/interuss/dss/pkg/rid/store"
 	ridcrdb "github.com/interuss/dss/pkg/rid/store/cockroach"
 	dssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/require"
 
@@ -40,6 +41,22 @@ func (s *mockRepo) Transact(ctx context.Context, f func(repo repos.Repository) e
 	return f(s)
 }
 
+func (s *mockRepo) TransactISA(ctx context.Context, write store.ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	isa, cells, err := write(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	subs, err := s.UpdateNotificationIdxsInCells(ctx, cells)
+	if err != nil {
+		return nil, nil, err
+	}
+	return isa, subs, nil
+}
+
+func (s *mockRepo) Capabilities() store.Capabilities {
+	return store.Capabilities{}
+}
+
 func (s *mockRepo) Close() error {
 	return nil
 }
@@ -62,10 +79,10 @@ func setUpStore(ctx context.Context, t *testing.T, logger *zap.Logger) (store.St
 	logger.Info("using cockroachDB.")
 
 	// Use a real store.
-	cdb, err := cockroach.Dial(*storeURI)
+	cdb, err := cockroach.Dial(*storeURI, cockroach.PoolParameters{})
 	require.NoError(t, err)
 
-	store, err := ridcrdb.NewStore(ctx, cdb, logger)
+	store, err := ridcrdb.NewStore(ctx, cdb, logger, summary.Default)
 	require.NoError(t, err)
 
 	return store, func() {
@@ -0,0 +1,128 @@
+package application
+
+import (
+	"context"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/hotspot"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/rid/store"
+)
+
+// NewHotspotStore returns a store.Store recording the writes to the
+// entities of s to tracker. The writes of a transaction are recorded once it
+// commits. It returns s itself if tracker is nil.
+func NewHotspotStore(s store.Store, tracker *hotspot.Tracker) store.Store {
+	if tracker == nil {
+		return s
+	}
+	return &hotspotStore{Store: s, tracker: tracker}
+}
+
+type hotspotStore struct {
+	store.Store
+	tracker *hotspot.Tracker
+}
+
+// hotspotWrite is a write to an entity not yet recorded.
+type hotspotWrite struct {
+	kind  string
+	id    string
+	owner string
+	cells s2.CellUnion
+}
+
+func (s *hotspotStore) flush(writes []hotspotWrite) {
+	for _, w := range writes {
+		s.tracker.Record(w.kind, w.id, w.owner, w.cells)
+	}
+}
+
+// Interact implements store.Interactor.
+func (s *hotspotStore) Interact(ctx context.Context) (repos.Repository, error) {
+	repo, err := s.Store.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &hotspotRepo{Repository: repo, record: func(w hotspotWrite) {
+		s.flush([]hotspotWrite{w})
+	}}, nil
+}
+
+// Transact implements store.Transactor. Only the writes of the attempt which
+// committed are recorded.
+func (s *hotspotStore) Transact(ctx context.Context, f func(repos.Repository) error) error {
+	var writes []hotspotWrite
+	err := s.Store.Transact(ctx, func(repo repos.Repository) error {
+		writes = nil
+		return f(&hotspotRepo{Repository: repo, record: func(w hotspotWrite) {
+			writes = append(writes, w)
+		}})
+	})
+	if err == nil {
+		s.flush(writes)
+	}
+	return err
+}
+
+// TransactISA implements store.ISATransactor, recording the writes like
+// Transact.
+func (s *hotspotStore) TransactISA(ctx context.Context, write store.ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	var writes []hotspotWrite
+	isa, subs, err := s.Store.TransactISA(ctx, func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
+		writes = nil
+		return write(&hotspotRepo{Repository: repo, record: func(w hotspotWrite) {
+			writes = append(writes, w)
+		}})
+	})
+	if err == nil {
+		s.flush(writes)
+	}
+	return isa, subs, err
+}
+
+type hotspotRepo struct {
+	repos.Repository
+	record func(hotspotWrite)
+}
+
+func (r *hotspotRepo) recordISA(isa *ridmodels.IdentificationServiceArea) {
+	r.record(hotspotWrite{hotspot.KindISA, isa.ID.String(), isa.Owner.String(), isa.Cells})
+}
+
+func (r *hotspotRepo) recordSubscription(sub *ridmodels.Subscription) {
+	r.record(hotspotWrite{hotspot.KindRIDSubscription, sub.ID.String(), sub.Owner.String(), sub.Cells})
+}
+
+func (r *hotspotRepo) InsertISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
+	inserted, err := r.Repository.InsertISA(ctx, isa)
+	if err == nil {
+		r.recordISA(isa)
+	}
+	return inserted, err
+}
+
+func (r *hotspotRepo) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
+	updated, err := r.Repository.UpdateISA(ctx, isa)
+	if err == nil {
+		r.recordISA(isa)
+	}
+	return updated, err
+}
+
+func (r *hotspotRepo) InsertSubscription(ctx context.Context, sub *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	inserted, err := r.Repository.InsertSubscription(ctx, sub)
+	if err == nil {
+		r.recordSubscription(sub)
+	}
+	return inserted, err
+}
+
+func (r *hotspotRepo) UpdateSubscription(ctx context.Context, sub *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	updated, err := r.Repository.UpdateSubscription(ctx, sub)
+	if err == nil {
+		r.recordSubscription(sub)
+	}
+	return updated, err
+}
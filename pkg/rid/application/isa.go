@@ -6,10 +6,13 @@ import (
 
 	"github.com/golang/geo/s2"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
 	"github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/restrictions"
 	ridmodels "github.com/interuss/dss/pkg/rid/models"
 	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
 )
 
@@ -29,11 +32,21 @@ type ISAApp interface {
 	// UpdateISA
 	UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error)
 
-	// SearchISAs returns all subscriptions ownded by "owner" in "cells".
-	SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error)
+	// SearchISAs returns all ISAs in "cells" and, if set, the temporal volume
+	// defined by "earliest" and "latest". Expired ISAs are excluded unless
+	// "includeExpired" is true.
+	SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error)
+
+	// StreamISAs calls "f" with each of the ISAs SearchISAs would return as
+	// they are read from the store, stopping at the first error returned by
+	// "f".
+	StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error
 }
 
 func (a *app) GetISA(ctx context.Context, id dssmodels.ID) (*ridmodels.IdentificationServiceArea, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.GetISA")
+	defer span.End()
+
 	repo, err := a.Store.Interact(ctx)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to interact with store")
@@ -42,141 +55,140 @@ func (a *app) GetISA(ctx context.Context, id dssmodels.ID) (*ridmodels.Identific
 }
 
 // SearchISAs for ISA within the volume bounds.
-func (a *app) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error) {
-	now := a.clock.Now()
-	if earliest == nil || earliest.Before(now) {
-		earliest = &now
-	}
+func (a *app) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.SearchISAs")
+	defer span.End()
 
 	repo, err := a.Store.Interact(ctx)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to interact with store")
 	}
 
-	return repo.SearchISAs(ctx, cells, earliest, latest)
+	return repo.SearchISAs(ctx, cells, earliest, latest, includeExpired)
+}
+
+// StreamISAs streams the ISAs within the volume bounds. The search is not run
+// in a transaction, which could not be retried once ISAs have been passed to
+// f.
+func (a *app) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	ctx, span := tracing.StartSpan(ctx, "rid.StreamISAs")
+	defer span.End()
+
+	repo, err := a.Store.Interact(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to interact with store")
+	}
+
+	return repo.StreamISAs(ctx, cells, earliest, latest, includeExpired, f)
 }
 
 // DeleteISA the given ISA
 func (a *app) DeleteISA(ctx context.Context, id dssmodels.ID, owner dssmodels.Owner, version *dssmodels.Version) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
-	var (
-		ret  *ridmodels.IdentificationServiceArea
-		subs []*ridmodels.Subscription
-	)
+	ctx, span := tracing.StartSpan(ctx, "rid.DeleteISA")
+	defer span.End()
+
 	// The following will automatically retry TXN retry errors.
-	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
+	return a.Store.TransactISA(ctx, func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
 		old, err := repo.GetISA(ctx, id)
 		switch {
 		case err != nil:
-			return stacktrace.Propagate(err, "Error getting ISA")
+			return nil, nil, stacktrace.Propagate(err, "Error getting ISA")
 		case old == nil:
-			return stacktrace.NewErrorWithCode(dsserr.NotFound, "ISA %s not found", id.String())
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.NotFound, "ISA %s not found", id.String())
 		case !version.Matches(old.Version):
-			return stacktrace.NewErrorWithCode(dsserr.VersionMismatch,
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.VersionMismatch,
 				"ISA currently at version %s but client specified %s", old.Version, version)
 		case old.Owner != owner:
-			return stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
 				"ISA owned by %s, but %s attempted to delete", old.Owner, owner)
 		}
 
-		ret, err = repo.DeleteISA(ctx, old)
-		if err != nil {
-			return stacktrace.Propagate(err, "Error deleting ISA")
-		}
-
-		subs, err = repo.UpdateNotificationIdxsInCells(ctx, old.Cells)
+		ret, err := repo.DeleteISA(ctx, old)
 		if err != nil {
-			return stacktrace.Propagate(err, "Error updating notification indices")
+			return nil, nil, stacktrace.Propagate(err, "Error deleting ISA")
 		}
-		return nil
-	})
-	return ret, subs, err // No need to Propagate this error as this stack layer does not add useful information
+		return ret, old.Cells, nil
+	}) // No need to Propagate this error as this stack layer does not add useful information
 }
 
 // InsertISA implments the AppInterface InsertISA method
 func (a *app) InsertISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.InsertISA")
+	defer span.End()
+
 	// Validate and perhaps correct StartTime and EndTime.
 	if err := isa.AdjustTimeRange(a.clock.Now(), nil); err != nil {
 		return nil, nil, stacktrace.Propagate(err, "Error adjusting time range")
 	}
-	// Update the notification index for both cells removed and added.
-	var (
-		ret  *ridmodels.IdentificationServiceArea
-		subs []*ridmodels.Subscription
-	)
+	if err := a.limits.Check(isa.Cells, isa.StartTime, isa.EndTime, isa.AltitudeLo, isa.AltitudeHi); err != nil {
+		return nil, nil, stacktrace.Propagate(err, "ISA exceeds limits")
+	}
+	if err := restrictions.Default.Check(events.KindISA, isa.Owner.String(), isa.Cells); err != nil {
+		return nil, nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	// The notification indices of the Subscriptions in the ISA's cells are
+	// updated in the same transaction as the insert.
 	// The following will automatically retry TXN retry errors.
-	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
+	return a.Store.TransactISA(ctx, func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
 		// ensure it doesn't exist yet
 		old, err := repo.GetISA(ctx, isa.ID)
 		if err != nil {
-			return stacktrace.Propagate(err, "Error getting ISA")
+			return nil, nil, stacktrace.Propagate(err, "Error getting ISA")
 		}
 		if old != nil {
-			return stacktrace.NewErrorWithCode(dsserr.AlreadyExists, "ISA %s already exists", isa.ID)
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.AlreadyExists, "ISA %s already exists", isa.ID)
 		}
 
-		// UpdateNotificationIdxsInCells is done in a Txn along with insert since
-		// they are both modifying the db. Insert a susbcription alone does
-		// not do this, so that does not need to use a txn (in subscription.go).
-		subs, err = repo.UpdateNotificationIdxsInCells(ctx, isa.Cells)
+		ret, err := repo.InsertISA(ctx, isa)
 		if err != nil {
-			return stacktrace.Propagate(err, "Error updating notification indices")
+			return nil, nil, stacktrace.Propagate(err, "Error inserting ISA")
 		}
-		ret, err = repo.InsertISA(ctx, isa)
-		if err != nil {
-			return stacktrace.Propagate(err, "Error inserting ISA")
-		}
-		return nil
-	})
-	return ret, subs, err // No need to Propagate this error as this stack layer does not add useful information
+		return ret, isa.Cells, nil
+	}) // No need to Propagate this error as this stack layer does not add useful information
 }
 
 // UpdateISA implments the AppInterface UpdateISA method
 func (a *app) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
-	// Update the notification index for both cells removed and added.
-	var (
-		ret  *ridmodels.IdentificationServiceArea
-		subs []*ridmodels.Subscription
-	)
-	// The following will automatically retry TXN retry errors.
-	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
-		var err error
+	ctx, span := tracing.StartSpan(ctx, "rid.UpdateISA")
+	defer span.End()
 
+	// The notification indices of the Subscriptions in both the cells removed
+	// and added are updated in the same transaction as the update.
+	// The following will automatically retry TXN retry errors.
+	return a.Store.TransactISA(ctx, func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
 		old, err := repo.GetISA(ctx, isa.ID)
 		switch {
 		case err != nil:
-			return stacktrace.Propagate(err, "Error getting ISA")
+			return nil, nil, stacktrace.Propagate(err, "Error getting ISA")
 		case old == nil:
-			return stacktrace.NewErrorWithCode(dsserr.NotFound, "ISA %s not found", isa.ID)
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.NotFound, "ISA %s not found", isa.ID)
 		case old.Owner != isa.Owner:
-			return stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied,
 				"ISA owned by %s, but %s attempted to modify", old.Owner, isa.Owner)
 		case !old.Version.Matches(isa.Version):
-			return stacktrace.NewErrorWithCode(dsserr.VersionMismatch,
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.VersionMismatch,
 				"ISA currently at version %s but client specified %s", old.Version, isa.Version)
 		}
 		// Validate and perhaps correct StartTime and EndTime.
 		if err := isa.AdjustTimeRange(a.clock.Now(), old); err != nil {
-			return stacktrace.Propagate(err, "Error adjusting time range")
+			return nil, nil, stacktrace.Propagate(err, "Error adjusting time range")
+		}
+		if err := a.limits.Check(isa.Cells, isa.StartTime, isa.EndTime, isa.AltitudeLo, isa.AltitudeHi); err != nil {
+			return nil, nil, stacktrace.Propagate(err, "ISA exceeds limits")
+		}
+		if err := restrictions.Default.Check(events.KindISA, isa.Owner.String(), isa.Cells); err != nil {
+			return nil, nil, err // No need to Propagate this error as this stack layer does not add useful information
 		}
 
-		ret, err = repo.UpdateISA(ctx, isa)
+		ret, err := repo.UpdateISA(ctx, isa)
 		if err != nil {
-			return stacktrace.Propagate(err, "Error updating ISA")
+			return nil, nil, stacktrace.Propagate(err, "Error updating ISA")
 		}
 
 		// TODO steeling, we should change this to a Custom type, to obfuscate
 		// some of these metrics and prevent us from doing the wrong thing.
 		cells := s2.CellUnionFromUnion(old.Cells, isa.Cells)
 		geo.Levelify(&cells)
-		// UpdateNotificationIdxsInCells is done in a Txn along with insert since
-		// they are both modifying the db. Insert a susbcription alone does
-		// not do this, so that does not need to use a txn (in subscription.go).
-		subs, err = repo.UpdateNotificationIdxsInCells(ctx, cells)
-		if err != nil {
-			return stacktrace.Propagate(err, "Error updating notification indices")
-		}
-		return nil
-	})
-
-	return ret, subs, err // No need to Propagate this error as this stack layer does not add useful information
+		return ret, cells, nil
+	}) // No need to Propagate this error as this stack layer does not add useful information
 }
@@ -23,7 +23,7 @@ var (
 func setUpISAApp(ctx context.Context, t *testing.T) (*app, func()) {
 	l := zap.L()
 	transactor, cleanup := setUpStore(ctx, t, l)
-	return NewFromTransactor(transactor, l).(*app), cleanup
+	return NewFromTransactor(transactor, l, dssmodels.Limits{}, dssmodels.Timeouts{}).(*app), cleanup
 }
 
 // TODO:steeling add owner logic.
@@ -73,7 +73,7 @@ func (store *isaStore) GetVersion(ctx context.Context) (*semver.Version, error)
 }
 
 // Implements repos.ISA.SearchISA
-func (store *isaStore) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error) {
+func (store *isaStore) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
 	var isas []*ridmodels.IdentificationServiceArea
 
 	for _, isa := range store.isas {
@@ -84,6 +84,20 @@ func (store *isaStore) SearchISAs(ctx context.Context, cells s2.CellUnion, earli
 	return isas, nil
 }
 
+// Implements repos.ISA.StreamISAs
+func (store *isaStore) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	isas, err := store.SearchISAs(ctx, cells, earliest, latest, includeExpired)
+	if err != nil {
+		return err
+	}
+	for _, isa := range isas {
+		if err := f(isa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Implements repos.ISA.ListExpiredISAs
 func (store *isaStore) ListExpiredISAs(ctx context.Context, writer string) ([]*ridmodels.IdentificationServiceArea, error) {
 	return make([]*ridmodels.IdentificationServiceArea, 0), nil
@@ -142,7 +156,7 @@ func TestISAUpdateIdxCells(t *testing.T) {
 		require.Equal(t, 1, sub.NotificationIndex)
 	}
 
-	isas, err := app.SearchISAs(ctx, isa.Cells, &startTime, nil)
+	isas, err := app.SearchISAs(ctx, isa.Cells, &startTime, nil, false)
 	require.NoError(t, err)
 	require.NotNil(t, isas)
 	require.Len(t, isas, 1)
@@ -8,13 +8,8 @@ import (
 	dssmodels "github.com/interuss/dss/pkg/models"
 	ridmodels "github.com/interuss/dss/pkg/rid/models"
 	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
-	"go.uber.org/zap"
-)
-
-const (
-	// Defined in requirement DSS0030.
-	maxSubscriptionsPerArea = 10
 )
 
 // SubscriptionApp provides the interface to the application logic for Subscription entities
@@ -39,6 +34,9 @@ type SubscriptionApp interface {
 }
 
 func (a *app) GetSubscription(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.GetSubscription")
+	defer span.End()
+
 	repo, err := a.Store.Interact(ctx)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to interact with store")
@@ -47,6 +45,9 @@ func (a *app) GetSubscription(ctx context.Context, id dssmodels.ID) (*ridmodels.
 }
 
 func (a *app) SearchSubscriptionsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) ([]*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.SearchSubscriptionsByOwner")
+	defer span.End()
+
 	repo, err := a.Store.Interact(ctx)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to interact with store")
@@ -55,10 +56,16 @@ func (a *app) SearchSubscriptionsByOwner(ctx context.Context, cells s2.CellUnion
 }
 
 func (a *app) InsertSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.InsertSubscription")
+	defer span.End()
+
 	// Validate and perhaps correct StartTime and EndTime.
-	if err := s.AdjustTimeRange(a.clock.Now(), nil); err != nil {
+	if err := s.AdjustTimeRange(a.clock.Now(), nil, a.limits); err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to adjust time range")
 	}
+	if err := a.limits.Check(s.Cells, s.StartTime, s.EndTime, s.AltitudeLo, s.AltitudeHi); err != nil {
+		return nil, stacktrace.Propagate(err, "Subscription exceeds limits")
+	}
 	var sub *ridmodels.Subscription
 	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
 
@@ -71,19 +78,6 @@ func (a *app) InsertSubscription(ctx context.Context, s *ridmodels.Subscription)
 			return stacktrace.NewErrorWithCode(dsserr.AlreadyExists, "Subscription %s already exists", s.ID)
 		}
 
-		// Check the user hasn't created too many subscriptions in this area.
-		count, err := repo.MaxSubscriptionCountInCellsByOwner(ctx, s.Cells, s.Owner)
-		if err != nil {
-			a.logger.Error("Error fetching max subscription count", zap.Error(err))
-			return stacktrace.Propagate(err,
-				"Failed to fetch subscription count, rejecting request")
-		}
-		if count >= maxSubscriptionsPerArea {
-			return stacktrace.Propagate(
-				stacktrace.NewErrorWithCode(dsserr.Exhausted, "Too many existing subscriptions in this area already"),
-				"%s had %d subscriptions in the area", s.Owner, count)
-		}
-
 		sub, err = repo.InsertSubscription(ctx, s)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error inserting Subscription into repo")
@@ -96,6 +90,9 @@ func (a *app) InsertSubscription(ctx context.Context, s *ridmodels.Subscription)
 
 // InsertSubscription implements the App InsertSubscription method
 func (a *app) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.UpdateSubscription")
+	defer span.End()
+
 	var sub *ridmodels.Subscription
 
 	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
@@ -117,22 +114,13 @@ func (a *app) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription)
 				"Subscription owned by %s, but %s attempted to update", old.Owner, s.Owner)
 		}
 		// Validate and perhaps correct StartTime and EndTime.
-		if err := s.AdjustTimeRange(a.clock.Now(), old); err != nil {
+		if err := s.AdjustTimeRange(a.clock.Now(), old, a.limits); err != nil {
 			return stacktrace.Propagate(err, "Error adjusting time range")
 		}
-
-		// Check the user hasn't created too many subscriptions in this area.
-		count, err := repo.MaxSubscriptionCountInCellsByOwner(ctx, s.Cells, s.Owner)
-		if err != nil {
-			a.logger.Error("Error fetching max subscription count", zap.Error(err))
-			return stacktrace.Propagate(err,
-				"Failed to fetch subscription count, rejecting request")
-		}
-		if count >= maxSubscriptionsPerArea {
-			return stacktrace.Propagate(
-				stacktrace.NewErrorWithCode(dsserr.Exhausted, "Too many existing subscriptions in this area already"),
-				"%s had %d subscriptions in the area", s.Owner, count)
+		if err := a.limits.Check(s.Cells, s.StartTime, s.EndTime, s.AltitudeLo, s.AltitudeHi); err != nil {
+			return stacktrace.Propagate(err, "Subscription exceeds limits")
 		}
+
 		sub, err = repo.UpdateSubscription(ctx, s)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error updating Subscription in repo")
@@ -144,6 +132,9 @@ func (a *app) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription)
 
 // DeleteSubscription deletes the Subscription identified by "id" and owned by "owner".
 func (a *app) DeleteSubscription(ctx context.Context, id dssmodels.ID, owner dssmodels.Owner, version *dssmodels.Version) (*ridmodels.Subscription, error) {
+	ctx, span := tracing.StartSpan(ctx, "rid.DeleteSubscription")
+	defer span.End()
+
 	var ret *ridmodels.Subscription
 	err := a.Store.Transact(ctx, func(repo repos.Repository) error {
 		var err error
@@ -55,7 +55,7 @@ var (
 func setUpSubApp(ctx context.Context, t *testing.T) (*app, func()) {
 	l := zap.L()
 	transactor, cleanup := setUpStore(ctx, t, l)
-	return NewFromTransactor(transactor, l).(*app), cleanup
+	return NewFromTransactor(transactor, l, dssmodels.Limits{}, dssmodels.Timeouts{}).(*app), cleanup
 }
 
 type subscriptionStore struct {
@@ -80,6 +80,9 @@ func (store *subscriptionStore) DeleteSubscription(ctx context.Context, s *ridmo
 }
 
 func (store *subscriptionStore) InsertSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	if err := store.checkSubscriptionCount(ctx, s); err != nil {
+		return nil, err
+	}
 	storedCopy := *s
 	storedCopy.Version = dssmodels.VersionFromTime(time.Now())
 	store.subs[s.ID] = &storedCopy
@@ -89,6 +92,9 @@ func (store *subscriptionStore) InsertSubscription(ctx context.Context, s *ridmo
 }
 
 func (store *subscriptionStore) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	if err := store.checkSubscriptionCount(ctx, s); err != nil {
+		return nil, err
+	}
 	storedCopy := *s
 	storedCopy.Version = dssmodels.VersionFromTime(time.Now())
 	store.subs[s.ID] = &storedCopy
@@ -117,6 +123,14 @@ func (store *subscriptionStore) UpdateNotificationIdxsInCells(ctx context.Contex
 	return subs, nil
 }
 
+func (store *subscriptionStore) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	if sub, ok := store.subs[id]; ok {
+		sub.NotificationIndex = 0
+		return sub, nil
+	}
+	return nil, nil
+}
+
 func (store *subscriptionStore) MaxSubscriptionCountInCellsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (int, error) {
 	max := 0
 	subs, _ := store.SearchSubscriptionsByOwner(ctx, cells, owner)
@@ -137,6 +151,18 @@ func (store *subscriptionStore) MaxSubscriptionCountInCellsByOwner(ctx context.C
 	return max, nil
 }
 
+// checkSubscriptionCount enforces ridmodels.MaxSubscriptionsPerArea like the
+// real stores do.
+func (store *subscriptionStore) checkSubscriptionCount(ctx context.Context, s *ridmodels.Subscription) error {
+	old, ok := store.subs[s.ID]
+	delete(store.subs, s.ID)
+	count, _ := store.MaxSubscriptionCountInCellsByOwner(ctx, s.Cells, s.Owner)
+	if ok {
+		store.subs[s.ID] = old
+	}
+	return s.CheckSubscriptionCount(count)
+}
+
 func (store *subscriptionStore) SearchSubscriptions(ctx context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
 	var subs []*ridmodels.Subscription
 	for _, s := range store.subs {
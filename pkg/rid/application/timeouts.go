@@ -0,0 +1,184 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/rid/store"
+)
+
+// timeoutStore is a store.Store whose repositories bound each of their
+// calls with timeouts.
+type timeoutStore struct {
+	store.Store
+	timeouts dssmodels.Timeouts
+}
+
+// Interact implements store.Interactor.
+func (s *timeoutStore) Interact(ctx context.Context) (repos.Repository, error) {
+	repo, err := s.Store.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutRepo{Repository: repo, timeouts: s.timeouts}, nil
+}
+
+// Transact implements store.Transactor.
+func (s *timeoutStore) Transact(ctx context.Context, f func(repos.Repository) error) error {
+	return s.Store.Transact(ctx, func(repo repos.Repository) error {
+		return f(&timeoutRepo{Repository: repo, timeouts: s.timeouts})
+	})
+}
+
+// TransactISA implements store.ISATransactor. The notification index
+// increments following write are bounded by the store.
+func (s *timeoutStore) TransactISA(ctx context.Context, write store.ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	return s.Store.TransactISA(ctx, func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
+		return write(&timeoutRepo{Repository: repo, timeouts: s.timeouts})
+	})
+}
+
+// timeoutRepo bounds each call to its repos.Repository with the timeout of
+// the operation of the call.
+type timeoutRepo struct {
+	repos.Repository
+	timeouts dssmodels.Timeouts
+}
+
+func (r *timeoutRepo) GetISA(ctx context.Context, id dssmodels.ID) (isa *ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		isa, err = r.Repository.GetISA(ctx, id)
+		return err
+	})
+	return isa, err
+}
+
+func (r *timeoutRepo) DeleteISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (deleted *ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationDelete, func(ctx context.Context) error {
+		deleted, err = r.Repository.DeleteISA(ctx, isa)
+		return err
+	})
+	return deleted, err
+}
+
+func (r *timeoutRepo) InsertISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (inserted *ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		inserted, err = r.Repository.InsertISA(ctx, isa)
+		return err
+	})
+	return inserted, err
+}
+
+func (r *timeoutRepo) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (updated *ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		updated, err = r.Repository.UpdateISA(ctx, isa)
+		return err
+	})
+	return updated, err
+}
+
+func (r *timeoutRepo) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) (isas []*ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		isas, err = r.Repository.SearchISAs(ctx, cells, earliest, latest, includeExpired)
+		return err
+	})
+	return isas, err
+}
+
+func (r *timeoutRepo) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		return r.Repository.StreamISAs(ctx, cells, earliest, latest, includeExpired, f)
+	})
+}
+
+func (r *timeoutRepo) ListExpiredISAs(ctx context.Context, writer string) (isas []*ridmodels.IdentificationServiceArea, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		isas, err = r.Repository.ListExpiredISAs(ctx, writer)
+		return err
+	})
+	return isas, err
+}
+
+func (r *timeoutRepo) GetSubscription(ctx context.Context, id dssmodels.ID) (sub *ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		sub, err = r.Repository.GetSubscription(ctx, id)
+		return err
+	})
+	return sub, err
+}
+
+func (r *timeoutRepo) DeleteSubscription(ctx context.Context, sub *ridmodels.Subscription) (deleted *ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationDelete, func(ctx context.Context) error {
+		deleted, err = r.Repository.DeleteSubscription(ctx, sub)
+		return err
+	})
+	return deleted, err
+}
+
+func (r *timeoutRepo) InsertSubscription(ctx context.Context, sub *ridmodels.Subscription) (inserted *ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		inserted, err = r.Repository.InsertSubscription(ctx, sub)
+		return err
+	})
+	return inserted, err
+}
+
+func (r *timeoutRepo) UpdateSubscription(ctx context.Context, sub *ridmodels.Subscription) (updated *ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		updated, err = r.Repository.UpdateSubscription(ctx, sub)
+		return err
+	})
+	return updated, err
+}
+
+func (r *timeoutRepo) SearchSubscriptions(ctx context.Context, cells s2.CellUnion) (subs []*ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.SearchSubscriptions(ctx, cells)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) SearchSubscriptionsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (subs []*ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.SearchSubscriptionsByOwner(ctx, cells, owner)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) UpdateNotificationIdxsInCells(ctx context.Context, cells s2.CellUnion) (subs []*ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		subs, err = r.Repository.UpdateNotificationIdxsInCells(ctx, cells)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) (sub *ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		sub, err = r.Repository.ResetNotificationIndex(ctx, id)
+		return err
+	})
+	return sub, err
+}
+
+func (r *timeoutRepo) MaxSubscriptionCountInCellsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (count int, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		count, err = r.Repository.MaxSubscriptionCountInCellsByOwner(ctx, cells, owner)
+		return err
+	})
+	return count, err
+}
+
+func (r *timeoutRepo) ListExpiredSubscriptions(ctx context.Context, writer string) (subs []*ridmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.ListExpiredSubscriptions(ctx, writer)
+		return err
+	})
+	return subs, err
+}
@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/golang/geo/s2"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/dss/pkg/api/v1/ridpb"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	"github.com/interuss/dss/pkg/geo"
@@ -47,7 +46,7 @@ func (i *IdentificationServiceArea) ToProto() (*ridpb.IdentificationServiceArea,
 	}
 
 	if i.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*i.StartTime)
+		ts, err := dssmodels.TimestampProto(*i.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -55,7 +54,7 @@ func (i *IdentificationServiceArea) ToProto() (*ridpb.IdentificationServiceArea,
 	}
 
 	if i.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*i.EndTime)
+		ts, err := dssmodels.TimestampProto(*i.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -64,6 +63,45 @@ func (i *IdentificationServiceArea) ToProto() (*ridpb.IdentificationServiceArea,
 	return result, nil
 }
 
+// MarshalJSON encodes i in the wire format of IdentificationServiceAreas.
+func (i *IdentificationServiceArea) MarshalJSON() ([]byte, error) {
+	p, err := i.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.MarshalAPIJSON(p)
+}
+
+// UnmarshalJSON decodes the fields of i held by IdentificationServiceAreas
+// from their wire format.
+func (i *IdentificationServiceArea) UnmarshalJSON(data []byte) error {
+	p := &ridpb.IdentificationServiceArea{}
+	if err := dssmodels.UnmarshalAPIJSON(data, p); err != nil {
+		return err
+	}
+	startTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeStart())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time from proto")
+	}
+	endTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeEnd())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time from proto")
+	}
+	var version *dssmodels.Version
+	if p.GetVersion() != "" {
+		if version, err = dssmodels.VersionFromString(p.GetVersion()); err != nil {
+			return stacktrace.Propagate(err, "Error parsing version")
+		}
+	}
+	i.ID = dssmodels.ID(p.GetId())
+	i.Owner = dssmodels.Owner(p.GetOwner())
+	i.URL = p.GetFlightsUrl()
+	i.Version = version
+	i.StartTime = startTime
+	i.EndTime = endTime
+	return nil
+}
+
 // SetExtents performs some data validation and sets the 4D volume on the
 // IdentificationServiceArea.
 func (i *IdentificationServiceArea) SetExtents(extents *ridpb.Volume4D) error {
@@ -72,7 +110,7 @@ func (i *IdentificationServiceArea) SetExtents(extents *ridpb.Volume4D) error {
 		return nil
 	}
 	if startTime := extents.GetTimeStart(); startTime != nil {
-		ts, err := ptypes.Timestamp(startTime)
+		ts, err := dssmodels.RequestTimes.FromProto(startTime)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error converting start time from proto")
 		}
@@ -80,7 +118,7 @@ func (i *IdentificationServiceArea) SetExtents(extents *ridpb.Volume4D) error {
 	}
 
 	if endTime := extents.GetTimeEnd(); endTime != nil {
-		ts, err := ptypes.Timestamp(endTime)
+		ts, err := dssmodels.RequestTimes.FromProto(endTime)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error converting end time from proto")
 		}
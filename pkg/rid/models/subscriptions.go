@@ -9,20 +9,31 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"github.com/golang/geo/s2"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/stacktrace"
 )
 
 var (
-	// maxSubscriptionDuration is the largest allowed interval between StartTime
-	// and EndTime.
-	maxSubscriptionDuration = time.Hour * 24
-
 	// maxClockSkew is the largest allowed interval between the StartTime of a new
 	// subscription and the server's idea of the current time.
 	maxClockSkew = time.Minute * 5
 )
 
+// MaxSubscriptionsPerArea is the largest number of active subscriptions an
+// owner may have in any one cell, defined in requirement DSS0030.
+const MaxSubscriptionsPerArea = 10
+
+// CheckSubscriptionCount returns an Exhausted error if the owner of s already
+// has, besides s, count active subscriptions in one of the cells of s, which
+// leaves no room for s.
+func (s *Subscription) CheckSubscriptionCount(count int) error {
+	if count >= MaxSubscriptionsPerArea {
+		return stacktrace.Propagate(
+			stacktrace.NewErrorWithCode(dsserr.Exhausted, "Too many existing subscriptions in this area already"),
+			"%s had %d subscriptions in the area", s.Owner, count)
+	}
+	return nil
+}
+
 // Subscription represents a USS subscription over a given 4D volume.
 type Subscription struct {
 	ID                dssmodels.ID
@@ -58,7 +69,7 @@ func (s *Subscription) ToNotifyProto() *ridpb.SubscriberToNotify {
 		Url: s.URL,
 		Subscriptions: []*ridpb.SubscriptionState{
 			{
-				NotificationIndex: int32(s.NotificationIndex),
+				NotificationIndex: dssmodels.NotificationIndexToProto(s.NotificationIndex),
 				SubscriptionId:    s.ID.String(),
 			},
 		},
@@ -72,12 +83,12 @@ func (s *Subscription) ToProto() (*ridpb.Subscription, error) {
 		Id:                s.ID.String(),
 		Owner:             s.Owner.String(),
 		Callbacks:         &ridpb.SubscriptionCallbacks{IdentificationServiceAreaUrl: s.URL},
-		NotificationIndex: int32(s.NotificationIndex),
+		NotificationIndex: dssmodels.NotificationIndexToProto(s.NotificationIndex),
 		Version:           s.Version.String(),
 	}
 
 	if s.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*s.StartTime)
+		ts, err := dssmodels.TimestampProto(*s.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -85,7 +96,7 @@ func (s *Subscription) ToProto() (*ridpb.Subscription, error) {
 	}
 
 	if s.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*s.EndTime)
+		ts, err := dssmodels.TimestampProto(*s.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -94,6 +105,46 @@ func (s *Subscription) ToProto() (*ridpb.Subscription, error) {
 	return result, nil
 }
 
+// MarshalJSON encodes s in the wire format of Subscriptions.
+func (s *Subscription) MarshalJSON() ([]byte, error) {
+	p, err := s.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.MarshalAPIJSON(p)
+}
+
+// UnmarshalJSON decodes the fields of s held by Subscriptions from their
+// wire format.
+func (s *Subscription) UnmarshalJSON(data []byte) error {
+	p := &ridpb.Subscription{}
+	if err := dssmodels.UnmarshalAPIJSON(data, p); err != nil {
+		return err
+	}
+	startTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeStart())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time from proto")
+	}
+	endTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeEnd())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time from proto")
+	}
+	var version *dssmodels.Version
+	if p.GetVersion() != "" {
+		if version, err = dssmodels.VersionFromString(p.GetVersion()); err != nil {
+			return stacktrace.Propagate(err, "Error parsing version")
+		}
+	}
+	s.ID = dssmodels.ID(p.GetId())
+	s.Owner = dssmodels.Owner(p.GetOwner())
+	s.URL = p.GetCallbacks().GetIdentificationServiceAreaUrl()
+	s.NotificationIndex = int(p.GetNotificationIndex())
+	s.Version = version
+	s.StartTime = startTime
+	s.EndTime = endTime
+	return nil
+}
+
 // SetExtents performs some data validation and sets the 4D volume on the
 // Subscription.
 func (s *Subscription) SetExtents(extents *ridpb.Volume4D) error {
@@ -102,7 +153,7 @@ func (s *Subscription) SetExtents(extents *ridpb.Volume4D) error {
 		return nil
 	}
 	if startTime := extents.GetTimeStart(); startTime != nil {
-		ts, err := ptypes.Timestamp(startTime)
+		ts, err := dssmodels.RequestTimes.FromProto(startTime)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error converting start time from proto")
 		}
@@ -110,7 +161,7 @@ func (s *Subscription) SetExtents(extents *ridpb.Volume4D) error {
 	}
 
 	if endTime := extents.GetTimeEnd(); endTime != nil {
-		ts, err := ptypes.Timestamp(endTime)
+		ts, err := dssmodels.RequestTimes.FromProto(endTime)
 		if err != nil {
 			return stacktrace.Propagate(err, "Error converting end time from proto")
 		}
@@ -135,8 +186,9 @@ func (s *Subscription) SetExtents(extents *ridpb.Volume4D) error {
 }
 
 // AdjustTimeRange adjusts the time range to the max allowed ranges on a
-// subscription.
-func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
+// subscription, truncating it or rejecting it if it exceeds the subscription
+// duration of limits.
+func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription, limits dssmodels.Limits) error {
 	if s.StartTime == nil {
 		// If StartTime was omitted, default to Now() for new subscriptions or re-
 		// use the existing time of existing subscriptions.
@@ -157,9 +209,9 @@ func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
 		s.EndTime = old.EndTime
 	}
 
-	// Or if this is a new subscription default to StartTime + 1 day.
+	// Or if this is a new subscription default to the longest duration.
 	if s.EndTime == nil {
-		truncatedEndTime := s.StartTime.Add(maxSubscriptionDuration)
+		truncatedEndTime := s.StartTime.Add(limits.SubscriptionDuration())
 		s.EndTime = &truncatedEndTime
 	}
 
@@ -168,10 +220,12 @@ func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
 		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription time_end must be after time_start")
 	}
 
-	// EndTime cannot be 24 hrs after StartTime
-	if s.EndTime.Sub(*s.StartTime) > maxSubscriptionDuration {
-		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription window exceeds 24 hours")
+	// EndTime cannot be further than the longest duration after StartTime.
+	endTime, err := limits.BoundSubscriptionEnd(*s.StartTime, *s.EndTime)
+	if err != nil {
+		return err // No need to Propagate this error as this stack layer does not add useful information
 	}
+	s.EndTime = &endTime
 
 	return nil
 }
@@ -0,0 +1,296 @@
+// Package notifications pushes the changes of ISAs to the USSs subscribed to
+// them, on behalf of USSs relying on the DSS to notify their subscribers.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+)
+
+const (
+	// Manager is the subject of the access tokens of the notifications.
+	Manager = "dss-notifier"
+
+	// queueSize is the number of notifications awaiting delivery beyond
+	// which new ones are dropped.
+	queueSize = 1000
+)
+
+// RetryPolicy bounds the attempts to deliver a notification.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a notification is POSTed.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; subsequent delays
+	// double up to MaxBackoff. Every delay is jittered by up to 100%.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns the delay to wait before attempt number "attempt" (with
+// the first retry being attempt 2).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 2; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// BreakerPolicy configures the circuit breakers isolating the hosts of
+// unresponsive subscribers.
+type BreakerPolicy struct {
+	// Threshold is the number of consecutive failed attempts to deliver to a
+	// host after which deliveries to it fail immediately, for Cooldown.
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// breaker tracks the recent deliveries to a host.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Stats counts the outcomes of the notifications since the Dispatcher
+// started.
+type Stats struct {
+	// Delivered notifications were acknowledged with a 2xx status, and Failed
+	// ones were not after every attempt.
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	// Retries is the number of additional attempts made.
+	Retries int64 `json:"retries"`
+	// ShortCircuited notifications were not attempted since the circuit of
+	// their host was open, and Dropped ones since the queue was full.
+	ShortCircuited int64 `json:"short_circuited"`
+	Dropped        int64 `json:"dropped"`
+	// OpenCircuits lists the hosts currently isolated.
+	OpenCircuits []string `json:"open_circuits"`
+}
+
+// notification is a POST of body to url.
+type notification struct {
+	url  string
+	body []byte
+}
+
+// Dispatcher POSTs, following ASTM F3411-19, a
+// PutIdentificationServiceAreaNotificationParameters to every subscriber of
+// a changed ISA, retrying failed deliveries with exponential backoff. It is
+// safe for concurrent use.
+type Dispatcher struct {
+	Client *http.Client
+	// Token, if set, returns the access token authorizing the notifications
+	// to the host audience.
+	Token   func(audience string) (string, error)
+	Retry   RetryPolicy
+	Breaker BreakerPolicy
+	Clock   clockwork.Clock
+	Logger  *zap.Logger
+
+	queue chan *notification
+	once  sync.Once
+
+	mu       sync.Mutex
+	stats    Stats
+	breakers map[string]*breaker
+}
+
+func (d *Dispatcher) init() {
+	d.once.Do(func() {
+		d.queue = make(chan *notification, queueSize)
+		d.breakers = map[string]*breaker{}
+	})
+}
+
+// Start delivers the notifications with workers concurrent deliveries until
+// ctx is done.
+func (d *Dispatcher) Start(ctx context.Context, workers int) {
+	d.init()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-d.queue:
+					d.deliver(ctx, n)
+				}
+			}
+		}()
+	}
+}
+
+// NotifyISA queues the notifications of the change of the ISA identified by
+// id to subscribers, grouped by callback URL. isa and extents are nil if the
+// ISA was deleted.
+func (d *Dispatcher) NotifyISA(id dssmodels.ID, isa *ridpb.IdentificationServiceArea, extents *ridpb.Volume4D, subscribers []*ridmodels.Subscription) {
+	d.init()
+	states := map[string][]*ridpb.SubscriptionState{}
+	for _, sub := range subscribers {
+		callback := strings.TrimSuffix(sub.URL, "/")
+		states[callback] = append(states[callback], &ridpb.SubscriptionState{
+			SubscriptionId:    sub.ID.String(),
+			NotificationIndex: dssmodels.NotificationIndexToProto(sub.NotificationIndex),
+		})
+	}
+	for callback, subs := range states {
+		body, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(&ridpb.PutIdentificationServiceAreaNotificationParameters{
+			ServiceArea:   isa,
+			Extents:       extents,
+			Subscriptions: subs,
+		})
+		if err != nil {
+			d.Logger.Error("Failed to encode ISA notification", zap.String("id", id.String()), zap.Error(err))
+			continue
+		}
+		n := &notification{
+			url:  callback + "/" + id.String(),
+			body: []byte(body),
+		}
+		select {
+		case d.queue <- n:
+		default:
+			d.mu.Lock()
+			d.stats.Dropped++
+			d.mu.Unlock()
+			d.Logger.Warn("Dropped ISA notification, queue full", zap.String("url", n.url))
+		}
+	}
+}
+
+// deliver POSTs n until it is acknowledged, it was attempted
+// d.Retry.MaxAttempts times or the circuit of its host opens.
+func (d *Dispatcher) deliver(ctx context.Context, n *notification) {
+	u, err := url.Parse(n.url)
+	if err != nil {
+		d.Logger.Warn("Invalid subscriber callback URL", zap.String("url", n.url), zap.Error(err))
+		d.record(func(s *Stats) { s.Failed++ })
+		return
+	}
+	host := u.Host
+
+	for attempt := 1; ; attempt++ {
+		if !d.allow(host) {
+			d.record(func(s *Stats) { s.ShortCircuited++ })
+			return
+		}
+		err := d.post(ctx, u, n.body)
+		d.report(host, err == nil)
+		if err == nil {
+			d.record(func(s *Stats) { s.Delivered++ })
+			return
+		}
+		if attempt >= d.Retry.MaxAttempts {
+			d.Logger.Warn("Failed to deliver ISA notification", zap.String("url", n.url), zap.Int("attempts", attempt), zap.Error(err))
+			d.record(func(s *Stats) { s.Failed++ })
+			return
+		}
+		d.record(func(s *Stats) { s.Retries++ })
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.Clock.After(d.Retry.backoff(attempt + 1)):
+		}
+	}
+}
+
+// post POSTs body to u.
+func (d *Dispatcher) post(ctx context.Context, u *url.URL, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error creating notification request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.Token != nil {
+		token, err := d.Token(u.Hostname())
+		if err != nil {
+			return stacktrace.Propagate(err, "Error obtaining notification access token")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error delivering notification to %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return stacktrace.NewError("Notification rejected by %s with status %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
+// allow returns false if the circuit of host is open.
+func (d *Dispatcher) allow(host string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.breakers[host]
+	return !ok || !d.Clock.Now().Before(b.openUntil)
+}
+
+// report records the outcome of an attempt to deliver to host, opening its
+// circuit after d.Breaker.Threshold consecutive failures.
+func (d *Dispatcher) report(host string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ok {
+		delete(d.breakers, host)
+		return
+	}
+	b, found := d.breakers[host]
+	if !found {
+		b = &breaker{}
+		d.breakers[host] = b
+	}
+	b.failures++
+	if d.Breaker.Threshold > 0 && b.failures >= d.Breaker.Threshold {
+		if d.Clock.Now().After(b.openUntil) {
+			d.Logger.Warn("Opened notification circuit", zap.String("host", host), zap.Int("failures", b.failures))
+		}
+		b.openUntil = d.Clock.Now().Add(d.Breaker.Cooldown)
+	}
+}
+
+func (d *Dispatcher) record(f func(*Stats)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f(&d.stats)
+}
+
+// Stats returns the outcomes of the notifications so far.
+func (d *Dispatcher) Stats() Stats {
+	d.init()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.OpenCircuits = []string{}
+	now := d.Clock.Now()
+	for host, b := range d.breakers {
+		if now.Before(b.openUntil) {
+			stats.OpenCircuits = append(stats.OpenCircuits, host)
+		}
+	}
+	sort.Strings(stats.OpenCircuits)
+	return stats
+}
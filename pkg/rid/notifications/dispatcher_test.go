@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const isaID = dssmodels.ID("4348c8e5-0b1c-43cf-9114-2e67a4532765")
+
+func TestNotifyISA(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		mu          sync.Mutex
+		received    []*ridpb.PutIdentificationServiceAreaNotificationParameters
+		failures    int
+	)
+	defer cancel()
+
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/uss/identification_service_areas/"+isaID.String(), r.URL.Path)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		params := &ridpb.PutIdentificationServiceAreaNotificationParameters{}
+		require.NoError(t, jsonpb.UnmarshalString(string(body), params))
+		mu.Lock()
+		received = append(received, params)
+		mu.Unlock()
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failures++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	d := &Dispatcher{
+		Client: ok.Client(),
+		Token: func(audience string) (string, error) {
+			require.Equal(t, "127.0.0.1", audience)
+			return "token", nil
+		},
+		Retry:   RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		Breaker: BreakerPolicy{Threshold: 3, Cooldown: time.Hour},
+		Clock:   clockwork.NewRealClock(),
+		Logger:  zap.NewNop(),
+	}
+	d.Start(ctx, 1)
+
+	subscribers := []*ridmodels.Subscription{
+		{ID: "sub1", URL: ok.URL + "/uss/identification_service_areas", NotificationIndex: 3},
+		{ID: "sub2", URL: ok.URL + "/uss/identification_service_areas/", NotificationIndex: 7},
+		{ID: "sub3", URL: failing.URL + "/uss/identification_service_areas", NotificationIndex: 1},
+	}
+	d.NotifyISA(isaID, &ridpb.IdentificationServiceArea{Id: isaID.String()}, &ridpb.Volume4D{}, subscribers)
+	require.Eventually(t, func() bool {
+		s := d.Stats()
+		return s.Delivered+s.Failed == 2
+	}, 5*time.Second, time.Millisecond)
+
+	// Subscriptions sharing a callback URL are notified at once.
+	mu.Lock()
+	require.Len(t, received, 1)
+	require.Equal(t, isaID.String(), received[0].GetServiceArea().GetId())
+	require.Len(t, received[0].GetSubscriptions(), 2)
+	require.Equal(t, 3, failures)
+	mu.Unlock()
+
+	stats := d.Stats()
+	require.Equal(t, int64(1), stats.Delivered)
+	require.Equal(t, int64(1), stats.Failed)
+	require.Equal(t, int64(2), stats.Retries)
+	u, err := url.Parse(failing.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{u.Host}, stats.OpenCircuits)
+
+	// The deletion is not attempted on the isolated host.
+	d.NotifyISA(isaID, nil, nil, subscribers)
+	require.Eventually(t, func() bool {
+		return d.Stats().ShortCircuited == 1 && d.Stats().Delivered == 2
+	}, 5*time.Second, time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 3, failures)
+	require.Nil(t, received[1].GetServiceArea())
+}
@@ -26,8 +26,15 @@ type ISA interface {
 	// Returns nil, nil if ID, version not found
 	UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error)
 
-	// SearchISAs returns all subscriptions ownded by "owner" in "cells".
-	SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error)
+	// SearchISAs returns all ISAs in "cells" and, if set, the temporal volume
+	// defined by "earliest" and "latest". ISAs that ended before the current
+	// time of the store are excluded unless "includeExpired" is true.
+	SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error)
+
+	// StreamISAs calls "f" with each of the ISAs SearchISAs would return, as
+	// they are read from the store rather than all at once, and stops at the
+	// first error returned by "f".
+	StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error
 
 	// ListExpiredISAs lists all expired ISAs based on writer
 	ListExpiredISAs(ctx context.Context, writer string) ([]*ridmodels.IdentificationServiceArea, error)
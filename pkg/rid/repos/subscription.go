@@ -19,10 +19,13 @@ type Subscription interface {
 	DeleteSubscription(ctx context.Context, sub *ridmodels.Subscription) (*ridmodels.Subscription, error)
 
 	// InsertSubscription inserts or updates an ISA.
+	// Fails with Exhausted if its owner would then have more than
+	// ridmodels.MaxSubscriptionsPerArea subscriptions in one of its cells.
 	InsertSubscription(ctx context.Context, sub *ridmodels.Subscription) (*ridmodels.Subscription, error)
 
 	// UpdateSubscription
 	// Returns nil, nil if ID, version not found
+	// Fails with Exhausted like InsertSubscription.
 	UpdateSubscription(ctx context.Context, sub *ridmodels.Subscription) (*ridmodels.Subscription, error)
 
 	// SearchSubscriptions returns all subscriptions ownded by in "cells".
@@ -34,6 +37,11 @@ type Subscription interface {
 	// UpdateNotificationIdxsInCells incremement the notification for each sub in the given cells.
 	UpdateNotificationIdxsInCells(ctx context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error)
 
+	// ResetNotificationIndex sets the notification index of the subscription
+	// identified by "id" back to 0, without changing its version.
+	// Returns nil, nil if not found
+	ResetNotificationIndex(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error)
+
 	// MaxSubscriptionCountInCellsByOwner finds, out of a set of cells, the cell with the most subscriptions
 	// belonging to the given owner, and returns that number.
 	MaxSubscriptionCountInCellsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (int, error)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/golang/geo/s2"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/dss/pkg/api/v1/ridpb"
 	"github.com/interuss/dss/pkg/auth"
@@ -12,8 +13,10 @@ import (
 	geoerr "github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
 	"github.com/interuss/stacktrace"
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
 )
 
 // GetIdentificationServiceArea returns a single ISA for a given ID.
@@ -71,6 +74,9 @@ func (s *Server) CreateIdentificationServiceArea(
 	if err != nil {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid ID format")
 	}
+	if err := s.IDs.Claim(ctx, id, owner); err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
 
 	if !s.EnableHTTP {
 		err = ridmodels.ValidateURL(params.GetFlightsUrl())
@@ -90,25 +96,25 @@ func (s *Server) CreateIdentificationServiceArea(
 		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid extents")
 	}
 
+	// The response is recorded for idempotency keys along with the write.
+	ctx = ridstore.WithISAResponse(ctx, func(isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) (proto.Message, error) {
+		return makePutISAResponse(isa, subs)
+	})
 	insertedISA, subscribers, err := s.App.InsertISA(ctx, isa)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not insert ISA")
 	}
 
-	pbISA, err := insertedISA.ToProto()
+	response, err := makePutISAResponse(insertedISA, subscribers)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Could not convert ISA to proto")
+		return nil, err
 	}
 
-	pbSubscribers := []*ridpb.SubscriberToNotify{}
-	for _, subscriber := range subscribers {
-		pbSubscribers = append(pbSubscribers, subscriber.ToNotifyProto())
+	if s.Notifier != nil {
+		s.Notifier.NotifyISA(id, response.ServiceArea, params.Extents, subscribers)
 	}
 
-	return &ridpb.PutIdentificationServiceAreaResponse{
-		ServiceArea: pbISA,
-		Subscribers: pbSubscribers,
-	}, nil
+	return response, nil
 }
 
 // UpdateIdentificationServiceArea updates an existing ISA.
@@ -156,18 +162,37 @@ func (s *Server) UpdateIdentificationServiceArea(
 		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid extents")
 	}
 
+	// The response is recorded for idempotency keys along with the write.
+	ctx = ridstore.WithISAResponse(ctx, func(isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) (proto.Message, error) {
+		return makePutISAResponse(isa, subs)
+	})
 	insertedISA, subscribers, err := s.App.UpdateISA(ctx, isa)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not update ISA")
 	}
 
-	pbISA, err := insertedISA.ToProto()
+	response, err := makePutISAResponse(insertedISA, subscribers)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Notifier != nil {
+		s.Notifier.NotifyISA(id, response.ServiceArea, params.Extents, subscribers)
+	}
+
+	return response, nil
+}
+
+// makePutISAResponse returns the response to the creation or update of isa,
+// notifying subs.
+func makePutISAResponse(isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) (*ridpb.PutIdentificationServiceAreaResponse, error) {
+	pbISA, err := isa.ToProto()
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not convert ISA to proto")
 	}
 
 	pbSubscribers := []*ridpb.SubscriberToNotify{}
-	for _, subscriber := range subscribers {
+	for _, subscriber := range subs {
 		pbSubscribers = append(pbSubscribers, subscriber.ToNotifyProto())
 	}
 
@@ -205,6 +230,10 @@ func (s *Server) DeleteIdentificationServiceArea(
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not convert ISA to proto")
 	}
+	if s.Notifier != nil {
+		s.Notifier.NotifyISA(id, nil, nil, subscribers)
+	}
+
 	sp := make([]*ridpb.SubscriberToNotify, len(subscribers))
 	for i := range subscribers {
 		sp[i] = subscribers[i].ToNotifyProto()
@@ -217,16 +246,14 @@ func (s *Server) DeleteIdentificationServiceArea(
 }
 
 // SearchIdentificationServiceAreas queries for all ISAs in the bounds.
-func (s *Server) SearchIdentificationServiceAreas(
-	ctx context.Context, req *ridpb.SearchIdentificationServiceAreasRequest) (
-	*ridpb.SearchIdentificationServiceAreasResponse, error) {
-
+// parseISASearch returns the cells and the temporal volume searched by req.
+func parseISASearch(req *ridpb.SearchIdentificationServiceAreasRequest) (s2.CellUnion, *time.Time, *time.Time, error) {
 	cu, err := geo.AreaToCellIDs(req.GetArea())
 	if err != nil {
 		if errors.Is(err, geoerr.ErrAreaTooLarge) {
-			return nil, stacktrace.Propagate(err, "Invalid area")
+			return nil, nil, nil, stacktrace.Propagate(err, "Invalid area")
 		}
-		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid area")
+		return nil, nil, nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid area")
 	}
 
 	var (
@@ -238,7 +265,7 @@ func (s *Server) SearchIdentificationServiceAreas(
 		if ts, err := ptypes.Timestamp(et); err == nil {
 			earliest = &ts
 		} else {
-			return nil, stacktrace.Propagate(err, "Unable to convert earliest timestamp to ptype")
+			return nil, nil, nil, stacktrace.Propagate(err, "Unable to convert earliest timestamp to ptype")
 		}
 	}
 
@@ -246,13 +273,24 @@ func (s *Server) SearchIdentificationServiceAreas(
 		if ts, err := ptypes.Timestamp(lt); err == nil {
 			latest = &ts
 		} else {
-			return nil, stacktrace.Propagate(err, "Unable to convert latest timestamp to ptype")
+			return nil, nil, nil, stacktrace.Propagate(err, "Unable to convert latest timestamp to ptype")
 		}
 	}
+	return cu, earliest, latest, nil
+}
+
+func (s *Server) SearchIdentificationServiceAreas(
+	ctx context.Context, req *ridpb.SearchIdentificationServiceAreasRequest) (
+	*ridpb.SearchIdentificationServiceAreasResponse, error) {
+
+	cu, earliest, latest, err := parseISASearch(req)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
 	defer cancel()
-	isas, err := s.App.SearchISAs(ctx, cu, earliest, latest)
+	isas, err := s.App.SearchISAs(ctx, cu, earliest, latest, dssmodels.IncludeExpiredFromContext(ctx))
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Unable to search ISAs")
 	}
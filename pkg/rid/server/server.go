@@ -3,8 +3,12 @@ package server
 import (
 	"time"
 
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
 	"github.com/interuss/dss/pkg/auth"
+	"github.com/interuss/dss/pkg/ids"
+	dssmodels "github.com/interuss/dss/pkg/models"
 	"github.com/interuss/dss/pkg/rid/application"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
 )
 
 var (
@@ -14,6 +18,11 @@ var (
 			Write auth.Scope
 			Read  auth.Scope
 		}
+		// ServiceProvider and DisplayProvider are the F3411-22a (RID v2)
+		// scopes, accepted alongside the F3411-19 ones so that the same
+		// service backs both API versions.
+		ServiceProvider auth.Scope
+		DisplayProvider auth.Scope
 	}{
 		ISA: struct {
 			Write auth.Scope
@@ -22,6 +31,8 @@ var (
 			Write: "dss.write.identification_service_areas",
 			Read:  "dss.read.identification_service_areas",
 		},
+		ServiceProvider: "rid.service_provider",
+		DisplayProvider: "rid.display_provider",
 	}
 )
 
@@ -31,20 +42,38 @@ type Server struct {
 	Timeout    time.Duration
 	Locality   string
 	EnableHTTP bool
+	// IDs, if set, prevents the creation of entities with IDs reserved to
+	// other owners.
+	IDs *ids.Reserver
+	// Notifier, if set, pushes the changes of ISAs to the USSs subscribed to
+	// them, besides returning the subscribers to the caller.
+	Notifier ISANotifier
+}
+
+// ISANotifier pushes the change of the ISA identified by id to subscribers.
+// isa and extents are nil if the ISA was deleted. It must not block.
+type ISANotifier interface {
+	NotifyISA(id dssmodels.ID, isa *ridpb.IdentificationServiceArea, extents *ridpb.Volume4D, subscribers []*ridmodels.Subscription)
 }
 
 // AuthScopes returns a map of endpoint to required Oauth scope.
 func (s *Server) AuthScopes() map[auth.Operation]auth.KeyClaimedScopesValidator {
+	var (
+		write = auth.RequireAnyScope(Scopes.ISA.Write, Scopes.ServiceProvider)
+		read  = auth.RequireAnyScope(Scopes.ISA.Read, Scopes.DisplayProvider)
+	)
 	return map[auth.Operation]auth.KeyClaimedScopesValidator{
-		"/ridpb.DiscoveryAndSynchronizationService/CreateIdentificationServiceArea":  auth.RequireAllScopes(Scopes.ISA.Write),
-		"/ridpb.DiscoveryAndSynchronizationService/DeleteIdentificationServiceArea":  auth.RequireAllScopes(Scopes.ISA.Write),
-		"/ridpb.DiscoveryAndSynchronizationService/GetIdentificationServiceArea":     auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas": auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/UpdateIdentificationServiceArea":  auth.RequireAllScopes(Scopes.ISA.Write),
-		"/ridpb.DiscoveryAndSynchronizationService/CreateSubscription":               auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/DeleteSubscription":               auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/GetSubscription":                  auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions":              auth.RequireAllScopes(Scopes.ISA.Read),
-		"/ridpb.DiscoveryAndSynchronizationService/UpdateSubscription":               auth.RequireAllScopes(Scopes.ISA.Read),
+		"/ridpb.DiscoveryAndSynchronizationService/CreateIdentificationServiceArea":  write,
+		"/ridpb.DiscoveryAndSynchronizationService/DeleteIdentificationServiceArea":  write,
+		"/ridpb.DiscoveryAndSynchronizationService/GetIdentificationServiceArea":     auth.RequireAnyScope(Scopes.ISA.Read, Scopes.ServiceProvider, Scopes.DisplayProvider),
+		"/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas": read,
+		"/ridpb.DiscoveryAndSynchronizationService/UpdateIdentificationServiceArea":  write,
+		"/ridpb.DiscoveryAndSynchronizationService/CreateSubscription":               read,
+		"/ridpb.DiscoveryAndSynchronizationService/DeleteSubscription":               read,
+		"/ridpb.DiscoveryAndSynchronizationService/GetSubscription":                  read,
+		"/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions":              read,
+		"/ridpb.DiscoveryAndSynchronizationService/UpdateSubscription":               read,
+
+		"/ridpb.DiscoveryAndSynchronizationStreamingService/StreamIdentificationServiceAreas": read,
 	}
 }
@@ -103,13 +103,23 @@ func (ma *mockApp) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationS
 	return args.Get(0).(*ridmodels.IdentificationServiceArea), args.Get(1).([]*ridmodels.Subscription), args.Error(2)
 }
 
-func (ma *mockApp) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error) {
+func (ma *mockApp) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	args := ma.Called(ctx, cells, earliest, latest)
+	args := ma.Called(ctx, cells, earliest, latest, includeExpired)
 	return args.Get(0).([]*ridmodels.IdentificationServiceArea), args.Error(1)
 }
 
+func (ma *mockApp) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	args := ma.Called(ctx, cells, earliest, latest, includeExpired)
+	for _, isa := range args.Get(0).([]*ridmodels.IdentificationServiceArea) {
+		if err := f(isa); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
 func TestDeleteSubscription(t *testing.T) {
 	ctx := auth.ContextWithOwner(context.Background(), "foo")
 	version, _ := dssmodels.VersionFromString("bar")
@@ -234,7 +244,7 @@ func TestCreateSubscription(t *testing.T) {
 		t.Run(r.name, func(t *testing.T) {
 			ma := &mockApp{}
 			if r.wantErr == stacktrace.ErrorCode(0) {
-				ma.On("SearchISAs", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+				ma.On("SearchISAs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, false).Return(
 					[]*ridmodels.IdentificationServiceArea(nil), nil)
 				ma.On("InsertSubscription", mock.Anything, r.wantSubscription).Return(
 					r.wantSubscription, nil,
@@ -282,7 +292,7 @@ func TestCreateSubscriptionResponseIncludesISAs(t *testing.T) {
 
 	ma := &mockApp{}
 
-	ma.On("SearchISAs", mock.Anything, cells, mock.Anything, mock.Anything).Return(isas, nil)
+	ma.On("SearchISAs", mock.Anything, cells, mock.Anything, mock.Anything, false).Return(isas, nil)
 	ma.On("InsertSubscription", mock.Anything, sub).Return(sub, nil)
 	s := &Server{
 		App: ma,
@@ -645,7 +655,7 @@ func TestSearchIdentificationServiceAreas(t *testing.T) {
 
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	ma.On("SearchISAs", mock.Anything, mock.Anything, (*time.Time)(nil), (*time.Time)(nil)).Return(
+	ma.On("SearchISAs", mock.Anything, mock.Anything, (*time.Time)(nil), (*time.Time)(nil), false).Return(
 		[]*ridmodels.IdentificationServiceArea{
 			{
 				ID:    dssmodels.ID(uuid.New().String()),
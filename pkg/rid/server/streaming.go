@@ -0,0 +1,63 @@
+package server
+
+import (
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc"
+)
+
+// StreamingServiceDesc describes the server-streaming variants of the
+// searches of Server, served over gRPC only. Each response message is a
+// single ISA, sent as it is read from the store.
+var StreamingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ridpb.DiscoveryAndSynchronizationStreamingService",
+	HandlerType: (*StreamingServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamIdentificationServiceAreas",
+			Handler:       streamIdentificationServiceAreasHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/rid/server/streaming.go",
+}
+
+// StreamingServer is the server of StreamingServiceDesc.
+type StreamingServer interface {
+	// StreamIdentificationServiceAreas sends the results of the search req
+	// on stream, one ridpb.IdentificationServiceArea per message.
+	StreamIdentificationServiceAreas(req *ridpb.SearchIdentificationServiceAreasRequest, stream grpc.ServerStream) error
+}
+
+func streamIdentificationServiceAreasHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &ridpb.SearchIdentificationServiceAreasRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(StreamingServer).StreamIdentificationServiceAreas(req, stream)
+}
+
+// StreamIdentificationServiceAreas implements StreamingServer. The stream
+// is bounded by the client's deadline and the search timeout of the
+// repository rather than s.Timeout, as large results may take longer to
+// send.
+func (s *Server) StreamIdentificationServiceAreas(req *ridpb.SearchIdentificationServiceAreasRequest, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	cu, earliest, latest, err := parseISASearch(req)
+	if err != nil {
+		return err
+	}
+
+	return s.App.StreamISAs(ctx, cu, earliest, latest, dssmodels.IncludeExpiredFromContext(ctx), func(isa *ridmodels.IdentificationServiceArea) error {
+		p, err := isa.ToProto()
+		if err != nil {
+			return stacktrace.Propagate(err, "Could not convert ISA to proto")
+		}
+		if err := stream.SendMsg(p); err != nil {
+			return stacktrace.Propagate(err, "Error sending ISA")
+		}
+		return nil
+	})
+}
@@ -139,6 +139,9 @@ func (s *Server) CreateSubscription(
 	if err != nil {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid ID format")
 	}
+	if err := s.IDs.Claim(ctx, id, owner); err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
 
 	if !s.EnableHTTP {
 		err = ridmodels.ValidateURL(params.Callbacks.IdentificationServiceAreaUrl)
@@ -170,7 +173,7 @@ func (s *Server) CreateSubscription(
 	}
 
 	// Find ISAs that were in this subscription's area.
-	isas, err := s.App.SearchISAs(ctx, sub.Cells, nil, nil)
+	isas, err := s.App.SearchISAs(ctx, sub.Cells, nil, nil, false)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not search ISAs")
 	}
@@ -246,7 +249,7 @@ func (s *Server) UpdateSubscription(
 	}
 
 	// Find ISAs that were in this subscription's area.
-	isas, err := s.App.SearchISAs(ctx, sub.Cells, nil, nil)
+	isas, err := s.App.SearchISAs(ctx, sub.Cells, nil, nil, false)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Could not search ISAs")
 	}
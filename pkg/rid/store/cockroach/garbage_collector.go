@@ -4,18 +4,21 @@ import (
 	"context"
 
 	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/interuss/stacktrace"
 )
 
 type GarbageCollector struct {
-	repos  repos.Repository
-	writer string
+	repos    repos.Repository
+	writer   string
+	recorder *summary.Recorder
 }
 
-func NewGarbageCollector(repos repos.Repository, writer string) *GarbageCollector {
+func NewGarbageCollector(repos repos.Repository, writer string, recorder *summary.Recorder) *GarbageCollector {
 	return &GarbageCollector{
-		repos:  repos,
-		writer: writer,
+		repos:    repos,
+		writer:   writer,
+		recorder: recorder,
 	}
 }
 
@@ -43,6 +46,9 @@ func (gc *GarbageCollector) DeleteExpiredISAs(ctx context.Context) error {
 
 	for _, isa := range expiredISAs {
 		isaOut, err := gc.repos.DeleteISA(ctx, isa)
+		if err == nil {
+			gc.recorder.RecordGarbageCollected("ridpb.IdentificationServiceArea", 1)
+		}
 		if isaOut != nil {
 			return stacktrace.Propagate(err,
 				"Deleted ISA")
@@ -65,6 +71,9 @@ func (gc *GarbageCollector) DeleteExpiredSubscriptions(ctx context.Context) erro
 
 	for _, sub := range expiredSubscriptions {
 		subOut, err := gc.repos.DeleteSubscription(ctx, sub)
+		if err == nil {
+			gc.recorder.RecordGarbageCollected("ridpb.Subscription", 1)
+		}
 		if subOut != nil {
 			return stacktrace.Propagate(err,
 				"Deleted Subscription")
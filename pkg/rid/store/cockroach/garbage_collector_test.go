@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/require"
 )
@@ -46,7 +47,7 @@ func TestDeleteExpiredISAs(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, ret)
 
-	gc := NewGarbageCollector(repo, writer)
+	gc := NewGarbageCollector(repo, writer, summary.NewRecorder(fakeClock))
 	err = gc.DeleteRIDExpiredRecords(ctx)
 	require.NoError(t, err)
 
@@ -90,7 +91,7 @@ func TestDeleteExpiredSubscriptions(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, ret)
 
-	gc := NewGarbageCollector(repo, writer)
+	gc := NewGarbageCollector(repo, writer, summary.NewRecorder(fakeClock))
 	err = gc.DeleteRIDExpiredRecords(ctx)
 	require.NoError(t, err)
 
@@ -0,0 +1,108 @@
+package cockroach
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/interuss/dss/pkg/auth"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/idempotency"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/rid/repos"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	"github.com/interuss/stacktrace"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestTransactISARecordsIdempotentResponse checks that concurrent retries of
+// a call with an idempotency key increment the notification indices of the
+// Subscriptions to notify once, as the response is recorded in the
+// transaction of TransactISA.
+func TestTransactISARecordsIdempotentResponse(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	keys, err := idempotency.NewDBStore(ctx, store.db, DatabaseName)
+	require.NoError(t, err)
+
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	_, err = repo.InsertISA(ctx, serviceArea)
+	require.NoError(t, err)
+	sub, err := repo.InsertSubscription(ctx, subscriptionsPool[0].input)
+	require.NoError(t, err)
+
+	const retries = 4
+	var (
+		interceptor = idempotency.Interceptor(keys, time.Minute, zap.NewNop())
+		info        = &grpc.UnaryServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationService/UpdateIdentificationServiceArea"}
+		req         = &ridpb.UpdateIdentificationServiceAreaRequest{Id: serviceArea.ID.String()}
+		started     sync.WaitGroup
+		done        sync.WaitGroup
+		errs        = make(chan error, retries)
+	)
+	// The handler notifies the Subscriptions in the cells of the ISA, which
+	// every retry would do again without idempotency.
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		started.Done()
+		started.Wait()
+		ctx = ridstore.WithISAResponse(ctx, func(isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) (proto.Message, error) {
+			return &ridpb.PutIdentificationServiceAreaResponse{ServiceArea: &ridpb.IdentificationServiceArea{Id: isa.ID.String()}}, nil
+		})
+		isa, _, err := store.TransactISA(ctx, func(r repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
+			isa, err := r.GetISA(ctx, serviceArea.ID)
+			return isa, serviceArea.Cells, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ridpb.PutIdentificationServiceAreaResponse{ServiceArea: &ridpb.IdentificationServiceArea{Id: isa.ID.String()}}, nil
+	}
+	callCtx := auth.ContextWithOwner(ctx, "uss1")
+	callCtx = metadata.NewIncomingContext(callCtx, metadata.Pairs(idempotency.Header, uuid.New().String()))
+	started.Add(retries)
+	done.Add(retries)
+	for i := 0; i < retries; i++ {
+		go func() {
+			defer done.Done()
+			_, err := interceptor(callCtx, req, info, handler)
+			errs <- err
+		}()
+	}
+	done.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+	}
+	require.Equal(t, 1, succeeded)
+
+	got, err := repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, sub.NotificationIndex+1, got.NotificationIndex)
+
+	// Later retries are replayed.
+	started.Add(1)
+	resp, err := interceptor(callCtx, req, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, serviceArea.ID.String(), resp.(*ridpb.PutIdentificationServiceAreaResponse).ServiceArea.Id)
+	got, err = repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, sub.NotificationIndex+1, got.NotificationIndex)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/coreos/go-semver/semver"
 
+	"github.com/interuss/dss/pkg/cockroach"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	"github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
@@ -17,25 +18,48 @@ import (
 	repos "github.com/interuss/dss/pkg/rid/repos"
 	dssql "github.com/interuss/dss/pkg/sql"
 	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
 	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
-const (
-	isaFields       = "id, owner, url, cells, starts_at, ends_at, writer, updated_at"
-	updateISAFields = "id, url, cells, starts_at, ends_at, writer, updated_at"
-)
+// isaFields are the columns read into ISAs.
+var isaFields = isaColumns(new(ridmodels.IdentificationServiceArea), new(isaRow)).Names("")
+
+// isaRow holds the columns of an ISA row which are not read directly into
+// the IdentificationServiceArea.
+type isaRow struct {
+	cells  pq.Int64Array
+	writer sql.NullString
+}
 
-func NewISARepo(ctx context.Context, db dssql.Queryable, dbVersion semver.Version, logger *zap.Logger) repos.ISA {
+// isaColumns returns the columns read into isa and row.
+func isaColumns(isa *ridmodels.IdentificationServiceArea, row *isaRow) dssql.Columns {
+	return dssql.Columns{
+		{Name: "id", Value: &isa.ID},
+		{Name: "owner", Value: &isa.Owner},
+		{Name: "url", Value: &isa.URL},
+		{Name: "cells", Value: &row.cells},
+		{Name: "starts_at", Value: &isa.StartTime},
+		{Name: "ends_at", Value: &isa.EndTime},
+		{Name: "writer", Value: &row.writer},
+		{Name: "updated_at", Value: &isa.Version},
+	}
+}
+
+func NewISARepo(ctx context.Context, db dssql.Queryable, dbVersion semver.Version, jurisdictions geo.Jurisdictions, logger *zap.Logger, clock clockwork.Clock) repos.ISA {
 	if dbVersion.Compare(v310) >= 0 {
 		return &isaRepo{
-			Queryable: db,
-			logger:    logger,
+			Queryable:     db,
+			logger:        logger,
+			clock:         clock,
+			regionColumns: newRegionColumns(dbVersion, jurisdictions),
 		}
 	}
 	return &isaRepoV3{
 		Queryable: db,
 		logger:    logger,
+		clock:     clock,
 	}
 }
 
@@ -43,45 +67,51 @@ func NewISARepo(ctx context.Context, db dssql.Queryable, dbVersion semver.Versio
 type isaRepo struct {
 	dssql.Queryable
 
+	clock  clockwork.Clock
 	logger *zap.Logger
+	regionColumns
 }
 
 func (c *isaRepo) process(ctx context.Context, query string, args ...interface{}) ([]*ridmodels.IdentificationServiceArea, error) {
+	var payload []*ridmodels.IdentificationServiceArea
+	err := c.stream(ctx, query, args, func(i *ridmodels.IdentificationServiceArea) error {
+		payload = append(payload, i)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// stream calls f with each ISA returned by query as rows are read, stopping
+// at the first error returned by f.
+func (c *isaRepo) stream(ctx context.Context, query string, args []interface{}, f func(*ridmodels.IdentificationServiceArea) error) error {
 	rows, err := c.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, fmt.Sprintf("Error in query: %s", query))
+		return stacktrace.Propagate(err, fmt.Sprintf("Error in query: %s", query))
 	}
 	defer rows.Close()
 
-	var payload []*ridmodels.IdentificationServiceArea
-	cids := pq.Int64Array{}
-
-	var writer sql.NullString
 	for rows.Next() {
-		i := new(ridmodels.IdentificationServiceArea)
-
-		err := rows.Scan(
-			&i.ID,
-			&i.Owner,
-			&i.URL,
-			&cids,
-			&i.StartTime,
-			&i.EndTime,
-			&writer,
-			&i.Version,
+		var (
+			i   = new(ridmodels.IdentificationServiceArea)
+			row isaRow
 		)
-		if err != nil {
-			return nil, stacktrace.Propagate(err, "Error scanning ISA row")
+		if err := rows.Scan(isaColumns(i, &row).Values()...); err != nil {
+			return stacktrace.Propagate(err, "Error scanning ISA row")
+		}
+		i.Writer = row.writer.String
+		i.SetCells(row.cells)
+		if err := f(i); err != nil {
+			return err
 		}
-		i.Writer = writer.String
-		i.SetCells(cids)
-		payload = append(payload, i)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, stacktrace.Propagate(err, "Error in rows query result")
+		return stacktrace.Propagate(err, "Error in rows query result")
 	}
 
-	return payload, nil
+	return nil
 }
 
 func (c *isaRepo) processOne(ctx context.Context, query string, args ...interface{}) (*ridmodels.IdentificationServiceArea, error) {
@@ -117,17 +147,6 @@ func (c *isaRepo) GetISA(ctx context.Context, id dssmodels.ID) (*ridmodels.Ident
 // TODO: Simplify the logic to insert without a query, such that the insert fails
 // if there's an existing entity.
 func (c *isaRepo) InsertISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
-	var (
-		insertAreasQuery = fmt.Sprintf(`
-			INSERT INTO
-				identification_service_areas
-				(%s)
-			VALUES
-				($1, $2, $3, $4, $5, $6, $7, transaction_timestamp())
-			RETURNING
-				%s`, isaFields, isaFields)
-	)
-
 	cids := make([]int64, len(isa.Cells))
 
 	for i, cell := range isa.Cells {
@@ -137,7 +156,25 @@ func (c *isaRepo) InsertISA(ctx context.Context, isa *ridmodels.IdentificationSe
 		cids[i] = int64(cell)
 	}
 
-	return c.processOne(ctx, insertAreasQuery, isa.ID, isa.Owner, isa.URL, pq.Int64Array(cids), isa.StartTime, isa.EndTime, isa.Writer)
+	columns := dssql.Columns{
+		{Name: "id", Value: isa.ID},
+		{Name: "owner", Value: isa.Owner},
+		{Name: "url", Value: isa.URL},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: isa.StartTime},
+		{Name: "ends_at", Value: isa.EndTime},
+		{Name: "writer", Value: isa.Writer},
+	}
+	columns = c.with(columns, isa.Cells)
+	insertAreasQuery := fmt.Sprintf(`
+		INSERT INTO
+			identification_service_areas
+			(%s, updated_at)
+		VALUES
+			(%s, transaction_timestamp())
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(0), isaFields)
+	return c.processOne(ctx, insertAreasQuery, columns.Values()...)
 }
 
 // UpdateISA updates the IdentificationServiceArea identified by "id" and owned
@@ -148,16 +185,6 @@ func (c *isaRepo) InsertISA(ctx context.Context, isa *ridmodels.IdentificationSe
 // TODO: simplify the logic to just update, without the primary query.
 // Returns nil, nil if ID, version not found
 func (c *isaRepo) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
-	var (
-		updateAreasQuery = fmt.Sprintf(`
-			UPDATE
-				identification_service_areas
-			SET	(%s) = ($1, $2, $3, $4, $5, $7, transaction_timestamp())
-			WHERE id = $1 AND updated_at = $6
-			RETURNING
-				%s`, updateISAFields, isaFields)
-	)
-
 	cids := make([]int64, len(isa.Cells))
 
 	for i, cell := range isa.Cells {
@@ -167,7 +194,23 @@ func (c *isaRepo) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationSe
 		cids[i] = int64(cell)
 	}
 
-	return c.processOne(ctx, updateAreasQuery, isa.ID, isa.URL, pq.Int64Array(cids), isa.StartTime, isa.EndTime, isa.Version.ToTimestamp(), isa.Writer)
+	columns := dssql.Columns{
+		{Name: "url", Value: isa.URL},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: isa.StartTime},
+		{Name: "ends_at", Value: isa.EndTime},
+		{Name: "writer", Value: isa.Writer},
+	}
+	columns = c.with(columns, isa.Cells)
+	updateAreasQuery := fmt.Sprintf(`
+		UPDATE
+			identification_service_areas
+		SET	(%s, updated_at) = (%s, transaction_timestamp())
+		WHERE id = $1 AND updated_at = $2
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(2), isaFields)
+	args := append([]interface{}{isa.ID, isa.Version.ToTimestamp()}, columns.Values()...)
+	return c.processOne(ctx, updateAreasQuery, args...)
 }
 
 // DeleteISA deletes the IdentificationServiceArea identified by "id" and owned by "owner".
@@ -189,30 +232,46 @@ func (c *isaRepo) DeleteISA(ctx context.Context, isa *ridmodels.IdentificationSe
 
 // SearchISAs searches IdentificationServiceArea
 // instances that intersect with "cells" and, if set, the temporal volume
-// defined by "earliest" and "latest".
-func (c *isaRepo) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error) {
-	var (
-		// TODO: make earliest and latest required (NOT NULL) and remove coalesce.
-		// Make them real values (not pointers), on the model layer.
-		isasInCellsQuery = fmt.Sprintf(`
-			SELECT
-				%s
-			FROM
-				identification_service_areas
-			WHERE
-				ends_at >= $1
-			AND
-				COALESCE(starts_at <= $2, true)
-			AND
-				cells && $3`, isaFields)
-	)
+// defined by "earliest" and "latest". Unless "includeExpired" is true, ISAs
+// that ended before the current time of the store's clock are excluded.
+func (c *isaRepo) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
+	query, args, err := c.searchISAsQuery(ctx, cells, earliest, latest, includeExpired)
+	if err != nil {
+		return nil, err
+	}
+	return c.process(ctx, query, args...)
+}
 
-	if len(cells) == 0 {
-		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
+// StreamISAs calls f with each ISA SearchISAs would return as rows are
+// read, stopping at the first error returned by f.
+func (c *isaRepo) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	query, args, err := c.searchISAsQuery(ctx, cells, earliest, latest, includeExpired)
+	if err != nil {
+		return err
 	}
+	return c.stream(ctx, query, args, f)
+}
 
-	if earliest == nil {
-		return nil, stacktrace.NewError("Earliest start time is missing")
+// searchISAsQuery returns the query of SearchISAs and its arguments.
+func (c *isaRepo) searchISAsQuery(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) (string, []interface{}, error) {
+	// TODO: make earliest and latest required (NOT NULL) and remove coalesce.
+	// Make them real values (not pointers), on the model layer.
+	isasInCellsQuery := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			identification_service_areas
+		WHERE
+			COALESCE(ends_at >= $1, true)
+		AND
+			COALESCE(starts_at <= $2, true)
+		AND
+			cells && $3
+		AND
+			($4 OR ends_at >= $5)`, isaFields)
+
+	if len(cells) == 0 {
+		return "", nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
 	}
 
 	cids := make([]int64, len(cells))
@@ -220,11 +279,17 @@ func (c *isaRepo) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *
 		cids[i] = int64(cid)
 	}
 
-	return c.process(ctx, isasInCellsQuery, earliest, latest, pq.Int64Array(cids))
+	args := []interface{}{earliest, latest, pq.Int64Array(cids), includeExpired, c.clock.Now()}
+	if c.partitioned {
+		isasInCellsQuery, args = cockroach.RestrictToRegions(isasInCellsQuery, args, "region", cells)
+	}
+	isasInCellsQuery, args = cockroach.OrderBy(isasInCellsQuery, args, dssmodels.SearchOrderFromContext(ctx), c.clock.Now(), "starts_at", "ends_at", "id")
+
+	return isasInCellsQuery, args, nil
 }
 
 // ListExpiredISAs lists all expired ISAs based on writer.
-// Records expire if current time is <expiredDurationInMin> minutes more than records' endTime.
+// Records expire if the time of the clock of c is <expiredDurationInMin> minutes more than records' endTime.
 // The function queries both empty writer and null writer when passing empty string as a writer.
 func (c *isaRepo) ListExpiredISAs(ctx context.Context, writer string) ([]*ridmodels.IdentificationServiceArea, error) {
 	writerQuery := "'" + writer + "'"
@@ -239,10 +304,10 @@ func (c *isaRepo) ListExpiredISAs(ctx context.Context, writer string) ([]*ridmod
 	FROM
 		identification_service_areas
 	WHERE
-		ends_at + INTERVAL '%d' MINUTE <= CURRENT_TIMESTAMP
+		ends_at + INTERVAL '%d' MINUTE <= $1
 	AND
 		(writer = %s)`, isaFields, expiredDurationInMin, writerQuery)
 	)
 
-	return c.process(ctx, isasInCellsQuery)
+	return c.process(ctx, isasInCellsQuery, c.clock.Now())
 }
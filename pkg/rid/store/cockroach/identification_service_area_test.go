@@ -133,7 +133,7 @@ func TestStoreSearchISAs(t *testing.T) {
 		t.Run(r.name, func(t *testing.T) {
 			earliest, latest := r.timestampMutator(*saOut.StartTime, *saOut.EndTime)
 
-			serviceAreas, err := repo.SearchISAs(ctx, r.cells, earliest, latest)
+			serviceAreas, err := repo.SearchISAs(ctx, r.cells, earliest, latest, true)
 			require.NoError(t, err)
 			require.Len(t, serviceAreas, r.expectedLen)
 		})
@@ -182,7 +182,7 @@ func TestStoreExpiredISA(t *testing.T) {
 
 	// We should still be able to find the ISA by searching and by ID.
 	now := fakeClock.Now()
-	serviceAreas, err := repo.SearchISAs(ctx, serviceArea.Cells, &now, nil)
+	serviceAreas, err := repo.SearchISAs(ctx, serviceArea.Cells, &now, nil, false)
 	require.NoError(t, err)
 	require.Len(t, serviceAreas, 1)
 
@@ -194,7 +194,7 @@ func TestStoreExpiredISA(t *testing.T) {
 	fakeClock.Advance(2 * time.Minute)
 	now = fakeClock.Now()
 
-	serviceAreas, err = repo.SearchISAs(ctx, serviceArea.Cells, &now, nil)
+	serviceAreas, err = repo.SearchISAs(ctx, serviceArea.Cells, &now, nil, false)
 	require.NoError(t, err)
 	require.Len(t, serviceAreas, 0)
 
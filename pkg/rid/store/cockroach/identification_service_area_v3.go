@@ -13,20 +13,34 @@ import (
 	"github.com/golang/geo/s2"
 	dssql "github.com/interuss/dss/pkg/sql"
 	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
 	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
-const (
-	isaFieldsV3       = "id, owner, url, cells, starts_at, ends_at, updated_at"
-	updateISAFieldsV3 = "id, url, cells, starts_at, ends_at, updated_at"
-)
+// isaFieldsV3 are the columns read into ISAs before schema 3.1.0.
+var isaFieldsV3 = isaColumnsV3(new(ridmodels.IdentificationServiceArea), new(pq.Int64Array)).Names("")
+
+// isaColumnsV3 returns the columns read into isa and cells before schema
+// 3.1.0, which lack the writer.
+func isaColumnsV3(isa *ridmodels.IdentificationServiceArea, cells *pq.Int64Array) dssql.Columns {
+	return dssql.Columns{
+		{Name: "id", Value: &isa.ID},
+		{Name: "owner", Value: &isa.Owner},
+		{Name: "url", Value: &isa.URL},
+		{Name: "cells", Value: cells},
+		{Name: "starts_at", Value: &isa.StartTime},
+		{Name: "ends_at", Value: &isa.EndTime},
+		{Name: "updated_at", Value: &isa.Version},
+	}
+}
 
 // The purpose od isaRepoV3 is solely to support backwards compatibility
 // It will be deleted from the codebase when all existing production deployments have been upgraded to 3.1.0+.
 type isaRepoV3 struct {
 	dssql.Queryable
 
+	clock  clockwork.Clock
 	logger *zap.Logger
 }
 
@@ -38,21 +52,12 @@ func (c *isaRepoV3) process(ctx context.Context, query string, args ...interface
 	defer rows.Close()
 
 	var payload []*ridmodels.IdentificationServiceArea
-	cids := pq.Int64Array{}
-
 	for rows.Next() {
-		i := new(ridmodels.IdentificationServiceArea)
-
-		err := rows.Scan(
-			&i.ID,
-			&i.Owner,
-			&i.URL,
-			&cids,
-			&i.StartTime,
-			&i.EndTime,
-			&i.Version,
+		var (
+			i    = new(ridmodels.IdentificationServiceArea)
+			cids pq.Int64Array
 		)
-		if err != nil {
+		if err := rows.Scan(isaColumnsV3(i, &cids).Values()...); err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning ISA row")
 		}
 		i.SetCells(cids)
@@ -98,17 +103,6 @@ func (c *isaRepoV3) GetISA(ctx context.Context, id dssmodels.ID) (*ridmodels.Ide
 // TODO: Simplify the logic to insert without a query, such that the insert fails
 // if there's an existing entity.
 func (c *isaRepoV3) InsertISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
-	var (
-		insertAreasQuery = fmt.Sprintf(`
-			INSERT INTO
-				identification_service_areas
-				(%s)
-			VALUES
-				($1, $2, $3, $4, $5, $6, transaction_timestamp())
-			RETURNING
-				%s`, isaFieldsV3, isaFieldsV3)
-	)
-
 	cids := make([]int64, len(isa.Cells))
 
 	for i, cell := range isa.Cells {
@@ -118,7 +112,23 @@ func (c *isaRepoV3) InsertISA(ctx context.Context, isa *ridmodels.Identification
 		cids[i] = int64(cell)
 	}
 
-	return c.processOne(ctx, insertAreasQuery, isa.ID, isa.Owner, isa.URL, pq.Int64Array(cids), isa.StartTime, isa.EndTime)
+	columns := dssql.Columns{
+		{Name: "id", Value: isa.ID},
+		{Name: "owner", Value: isa.Owner},
+		{Name: "url", Value: isa.URL},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: isa.StartTime},
+		{Name: "ends_at", Value: isa.EndTime},
+	}
+	insertAreasQuery := fmt.Sprintf(`
+		INSERT INTO
+			identification_service_areas
+			(%s, updated_at)
+		VALUES
+			(%s, transaction_timestamp())
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(0), isaFieldsV3)
+	return c.processOne(ctx, insertAreasQuery, columns.Values()...)
 }
 
 // UpdateISA updates the IdentificationServiceArea identified by "id" and owned
@@ -129,16 +139,6 @@ func (c *isaRepoV3) InsertISA(ctx context.Context, isa *ridmodels.Identification
 // TODO: simplify the logic to just update, without the primary query.
 // Returns nil, nil if ID, version not found
 func (c *isaRepoV3) UpdateISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
-	var (
-		updateAreasQuery = fmt.Sprintf(`
-			UPDATE
-				identification_service_areas
-			SET	(%s) = ($1, $2, $3, $4, $5, transaction_timestamp())
-			WHERE id = $1 AND updated_at = $6
-			RETURNING
-				%s`, updateISAFieldsV3, isaFieldsV3)
-	)
-
 	cids := make([]int64, len(isa.Cells))
 
 	for i, cell := range isa.Cells {
@@ -148,7 +148,21 @@ func (c *isaRepoV3) UpdateISA(ctx context.Context, isa *ridmodels.Identification
 		cids[i] = int64(cell)
 	}
 
-	return c.processOne(ctx, updateAreasQuery, isa.ID, isa.URL, pq.Int64Array(cids), isa.StartTime, isa.EndTime, isa.Version.ToTimestamp())
+	columns := dssql.Columns{
+		{Name: "url", Value: isa.URL},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: isa.StartTime},
+		{Name: "ends_at", Value: isa.EndTime},
+	}
+	updateAreasQuery := fmt.Sprintf(`
+		UPDATE
+			identification_service_areas
+		SET	(%s, updated_at) = (%s, transaction_timestamp())
+		WHERE id = $1 AND updated_at = $2
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(2), isaFieldsV3)
+	args := append([]interface{}{isa.ID, isa.Version.ToTimestamp()}, columns.Values()...)
+	return c.processOne(ctx, updateAreasQuery, args...)
 }
 
 // DeleteISA deletes the IdentificationServiceArea identified by "id" and owned by "owner".
@@ -170,8 +184,9 @@ func (c *isaRepoV3) DeleteISA(ctx context.Context, isa *ridmodels.Identification
 
 // SearchISAs searches IdentificationServiceArea
 // instances that intersect with "cells" and, if set, the temporal volume
-// defined by "earliest" and "latest".
-func (c *isaRepoV3) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time) ([]*ridmodels.IdentificationServiceArea, error) {
+// defined by "earliest" and "latest". Unless "includeExpired" is true, ISAs
+// that ended before the current time of the store's clock are excluded.
+func (c *isaRepoV3) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
 	var (
 		// TODO: make earliest and latest required (NOT NULL) and remove coalesce.
 		// Make them real values (not pointers), on the model layer.
@@ -181,27 +196,40 @@ func (c *isaRepoV3) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest
 			FROM
 				identification_service_areas
 			WHERE
-				ends_at >= $1
+				COALESCE(ends_at >= $1, true)
 			AND
 				COALESCE(starts_at <= $2, true)
 			AND
-				cells && $3`, isaFieldsV3)
+				cells && $3
+			AND
+				($4 OR ends_at >= $5)`, isaFieldsV3)
 	)
 
 	if len(cells) == 0 {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
 	}
 
-	if earliest == nil {
-		return nil, stacktrace.NewError("Earliest start time is missing")
-	}
-
 	cids := make([]int64, len(cells))
 	for i, cid := range cells {
 		cids[i] = int64(cid)
 	}
 
-	return c.process(ctx, isasInCellsQuery, earliest, latest, pq.Int64Array(cids))
+	return c.process(ctx, isasInCellsQuery, earliest, latest, pq.Int64Array(cids), includeExpired, c.clock.Now())
+}
+
+// StreamISAs calls f with each ISA SearchISAs would return, searched all at
+// once since schema 3.0 is only supported for backwards compatibility.
+func (c *isaRepoV3) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	isas, err := c.SearchISAs(ctx, cells, earliest, latest, includeExpired)
+	if err != nil {
+		return err
+	}
+	for _, isa := range isas {
+		if err := f(isa); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ListExpiredISAs returns empty. We don't support thi function in store v3.0 because db doesn't have 'writer' field.
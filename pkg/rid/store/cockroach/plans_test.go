@@ -0,0 +1,78 @@
+package cockroach
+
+import (
+	"context"
+	"flag"
+	"regexp"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/cockroach"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+var explainAnalyze = flag.Bool("explain-analyze", false, "with store-uri, check the plans of TestQueryPlans with EXPLAIN ANALYZE rather than EXPLAIN (requires CockroachDB 21.1 or later)")
+
+// planExpectations lists the indexes through which the searches must go.
+var planExpectations = []cockroach.IndexExpectation{
+	{Pattern: regexp.MustCompile(`FROM identification_service_areas WHERE .*cells && \$3`), Table: "identification_service_areas", Indexes: []string{"cell_idx", "ends_at_idx", "starts_at_idx"}},
+	{Pattern: regexp.MustCompile(`FROM subscriptions WHERE cells && \$1`), Table: "subscriptions", Indexes: []string{"cell_idx", "ends_at_idx", "starts_at_idx"}},
+}
+
+// TestQueryPlans exercises the statements of the repos serving the API and
+// fails if any of them scans a whole table, or if a search does not go
+// through the indexes of planExpectations. The listings of the garbage
+// collector are left out, as they go through every expired record by design.
+func TestQueryPlans(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	version, err := store.GetVersion(ctx)
+	require.NoError(t, err)
+	var (
+		recorder = cockroach.NewStatementRecorder(store.db)
+		isas     = NewISARepo(ctx, recorder, *version, nil, logging.Logger, fakeClock)
+		subs     = NewISASubscriptionRepo(ctx, recorder, *version, nil, logging.Logger, fakeClock)
+	)
+
+	isa, err := isas.InsertISA(ctx, serviceArea)
+	require.NoError(t, err)
+	_, err = isas.GetISA(ctx, isa.ID)
+	require.NoError(t, err)
+	_, err = isas.SearchISAs(ctx, isa.Cells, &startTime, &endTime, false)
+	require.NoError(t, err)
+	isa, err = isas.UpdateISA(ctx, isa)
+	require.NoError(t, err)
+
+	sub := *subscriptionsPool[0].input
+	sub.ID = dssmodels.ID(uuid.New().String())
+	_, err = subs.MaxSubscriptionCountInCellsByOwner(ctx, sub.Cells, sub.Owner)
+	require.NoError(t, err)
+	created, err := subs.InsertSubscription(ctx, &sub)
+	require.NoError(t, err)
+	_, err = subs.GetSubscription(ctx, created.ID)
+	require.NoError(t, err)
+	_, err = subs.SearchSubscriptions(ctx, created.Cells)
+	require.NoError(t, err)
+	_, err = subs.SearchSubscriptionsByOwner(ctx, created.Cells, created.Owner)
+	require.NoError(t, err)
+	_, err = subs.UpdateNotificationIdxsInCells(ctx, isa.Cells)
+	require.NoError(t, err)
+	created, err = subs.GetSubscription(ctx, created.ID)
+	require.NoError(t, err)
+	created, err = subs.UpdateSubscription(ctx, created)
+	require.NoError(t, err)
+	_, err = subs.DeleteSubscription(ctx, created)
+	require.NoError(t, err)
+	_, err = isas.DeleteISA(ctx, isa)
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.NotEmpty(t, statements)
+	require.NoError(t, store.db.CheckPlans(ctx, statements, *explainAnalyze, planExpectations))
+}
@@ -0,0 +1,41 @@
+package cockroach
+
+import (
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	dssql "github.com/interuss/dss/pkg/sql"
+)
+
+// regionColumns writes the region and jurisdiction columns of an entity
+// table.
+type regionColumns struct {
+	// partitioned is true if the table has a region column, in which case
+	// it is written and used to prune searches.
+	partitioned bool
+	// jurisdictions determine the jurisdiction written if the table has a
+	// jurisdiction column, nil otherwise.
+	jurisdictions *geo.Jurisdictions
+}
+
+// newRegionColumns returns the regionColumns of the schema dbVersion,
+// writing the jurisdiction of entities among jurisdictions.
+func newRegionColumns(dbVersion semver.Version, jurisdictions geo.Jurisdictions) regionColumns {
+	r := regionColumns{partitioned: dbVersion.Compare(v320) >= 0}
+	if dbVersion.Compare(v3140) >= 0 {
+		r.jurisdictions = &jurisdictions
+	}
+	return r
+}
+
+// with returns columns with the region and jurisdiction of an entity
+// covering cells, as the table holds them.
+func (r regionColumns) with(columns dssql.Columns, cells s2.CellUnion) dssql.Columns {
+	if r.partitioned {
+		columns = columns.With("region", geo.RegionOf(cells))
+	}
+	if r.jurisdictions != nil {
+		columns = columns.With("jurisdiction", r.jurisdictions.Of(cells))
+	}
+	return columns
+}
@@ -0,0 +1,30 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	dssql "github.com/interuss/dss/pkg/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionColumns(t *testing.T) {
+	var (
+		columns = dssql.Columns{{Name: "id", Value: "id"}}
+		cells   = s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)}
+	)
+	js, err := geo.ParseJurisdictions("ch:45.8,5.9,47.8,10.5")
+	require.NoError(t, err)
+
+	require.Equal(t, "id", newRegionColumns(*semver.New("3.1.0"), js).with(columns, cells).Names(""))
+	require.Equal(t, "id,region", newRegionColumns(*semver.New("3.13.0"), js).with(columns, cells).Names(""))
+
+	withJurisdiction := newRegionColumns(*semver.New("3.14.0"), js).with(columns, cells)
+	require.Equal(t, "id,region,jurisdiction", withJurisdiction.Names(""))
+	require.Equal(t, "ch", withJurisdiction.Values()[2])
+
+	// Entities of no jurisdiction are labelled as such.
+	require.Equal(t, geo.Unassigned, newRegionColumns(*semver.New("3.14.0"), nil).with(columns, cells).Values()[2])
+}
@@ -5,11 +5,19 @@ import (
 	"database/sql"
 	"time"
 
-	"github.com/cockroachdb/cockroach-go/crdb"
 	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/cockroach"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/idempotency"
 	"github.com/interuss/dss/pkg/logging"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
 	"github.com/interuss/dss/pkg/rid/repos"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	dssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/interuss/stacktrace"
 	"github.com/jonboulle/clockwork"
 	"go.uber.org/zap"
@@ -34,10 +42,20 @@ var (
 	// TODO: use this in other function calls
 	DefaultTimeout = 10 * time.Second
 
+	// SupportedSchemas is the range of schema versions the store supports,
+	// whose maximum is raised with every migration.
+	SupportedSchemas = cockroach.SchemaRange{Min: *semver.New("3.0.0"), Max: *semver.New("3.14.0")}
+
 	// DatabaseName is the name of database storing remote ID data.
 	DatabaseName = "defaultdb"
 
 	v310 = *semver.New("3.1.0")
+	// v320 introduced the region column holding the S2 face of entities.
+	v320 = *semver.New("3.2.0")
+	// v380 widened notification_index to INT8.
+	v380 = *semver.New("3.8.0")
+	// v3140 introduced the jurisdiction column of entities.
+	v3140 = *semver.New("3.14.0")
 )
 
 type repo struct {
@@ -51,24 +69,29 @@ type repo struct {
 // TODO: Add the SCD interfaces here, and collapse this store with the
 // outer pkg/cockroach
 type Store struct {
-	db      *cockroach.DB
-	logger  *zap.Logger
-	clock   clockwork.Clock
-	version *semver.Version
+	db       *cockroach.DB
+	logger   *zap.Logger
+	clock    clockwork.Clock
+	recorder *summary.Recorder
+	version  *semver.Version
+	// jurisdictions determine the jurisdiction written with entities.
+	jurisdictions geo.Jurisdictions
 }
 
-// NewStore returns a Store instance connected to a cockroach instance via db.
-func NewStore(ctx context.Context, db *cockroach.DB, logger *zap.Logger) (*Store, error) {
+// NewStore returns a Store instance connected to a cockroach instance via db,
+// recording the statistics of its transactions to recorder.
+func NewStore(ctx context.Context, db *cockroach.DB, logger *zap.Logger, recorder *summary.Recorder) (*Store, error) {
 	vs, err := db.GetVersion(ctx, DatabaseName)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to get database schema version for remote ID")
 	}
 
 	store := &Store{
-		db:      db,
-		logger:  logger,
-		clock:   DefaultClock,
-		version: vs,
+		db:       db,
+		logger:   logger,
+		clock:    DefaultClock,
+		recorder: recorder,
+		version:  vs,
 	}
 
 	if err := store.CheckCurrentMajorSchemaVersion(ctx); err != nil {
@@ -78,6 +101,15 @@ func NewStore(ctx context.Context, db *cockroach.DB, logger *zap.Logger) (*Store
 	return store, nil
 }
 
+// SetJurisdictions makes s write the jurisdiction of entities among js.
+func (s *Store) SetJurisdictions(js geo.Jurisdictions) error {
+	if len(js) > 0 && s.version.LessThan(v3140) {
+		return stacktrace.NewError("Jurisdictions require remote ID schema %s", v3140)
+	}
+	s.jurisdictions = js
+	return nil
+}
+
 // CheckCurrentMajorSchemaVersion checks that store supports the current major schema version.
 func (s *Store) CheckCurrentMajorSchemaVersion(ctx context.Context) error {
 	vs, err := s.GetVersion(ctx)
@@ -104,8 +136,8 @@ func (s *Store) Interact(ctx context.Context) (repos.Repository, error) {
 	}
 
 	return &repo{
-		ISA:          NewISARepo(ctx, s.db, *storeVersion, logger),
-		Subscription: NewISASubscriptionRepo(ctx, s.db, *storeVersion, logger, s.clock),
+		ISA:          NewISARepo(ctx, dssql.Traced(s.db), *storeVersion, s.jurisdictions, logger, s.clock),
+		Subscription: NewISASubscriptionRepo(ctx, dssql.Traced(s.db), *storeVersion, s.jurisdictions, logger, s.clock),
 	}, nil
 }
 
@@ -113,6 +145,37 @@ func (s *Store) Interact(ctx context.Context) (repos.Repository, error) {
 // in a Txn, and will retry any Txn's that fail due to retry-able errors
 // (typically contention).
 func (s *Store) Transact(ctx context.Context, f func(repo repos.Repository) error) error {
+	return s.transact(ctx, func(r *repo) error { return f(r) })
+}
+
+// TransactISA implements store.ISATransactor interface.
+func (s *Store) TransactISA(ctx context.Context, write ridstore.ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	var (
+		isa  *ridmodels.IdentificationServiceArea
+		subs []*ridmodels.Subscription
+	)
+	err := s.transact(ctx, func(r *repo) error {
+		var (
+			cells s2.CellUnion
+			err   error
+		)
+		isa, cells, err = write(r)
+		if err != nil {
+			return err
+		}
+		subs, err = r.UpdateNotificationIdxsInCells(ctx, cells)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error updating notification indices")
+		}
+		return ridstore.RespondISA(ctx, isa, subs)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return isa, subs, nil
+}
+
+func (s *Store) transact(ctx context.Context, f func(repo *repo) error) error {
 	logger := logging.WithValuesFromContext(ctx, s.logger)
 	// TODO: consider what tx opts we want to support.
 	// TODO: we really need to remove the upper cockroach package, and have one
@@ -124,29 +187,75 @@ func (s *Store) Transact(ctx context.Context, f func(repo repos.Repository) erro
 	if err != nil {
 		return stacktrace.Propagate(err, "Error determining database RID schema version")
 	}
-	return crdb.ExecuteTx(ctx, s.db.DB, nil /* nil txopts */, func(tx *sql.Tx) error {
-		// Is this recover still necessary?
-		defer recoverRollbackRepanic(ctx, tx)
-		return f(&repo{
-			ISA:          NewISARepo(ctx, tx, *storeVersion, logger),
-			Subscription: NewISASubscriptionRepo(ctx, tx, *storeVersion, logger, s.clock),
-		})
+	attempts := 0
+	defer func() { s.recorder.RecordTransaction(attempts) }()
+	return s.db.ExecuteSavepointTx(ctx, nil /* nil txopts */, func(tx *sql.Tx) (err error) {
+		attempts++
+		// ExecuteSavepointTx rolls tx back when f fails, panicking included.
+		defer dsserr.RecoverPanic(&err)
+		if err := f(&repo{
+			ISA:          NewISARepo(ctx, dssql.Traced(tx), *storeVersion, s.jurisdictions, logger, s.clock),
+			Subscription: NewISASubscriptionRepo(ctx, dssql.Traced(tx), *storeVersion, s.jurisdictions, logger, s.clock),
+		}); err != nil {
+			return err
+		}
+		// The response to a call with an idempotency key is recorded along
+		// with its changes.
+		return idempotency.RecordInTx(ctx, tx)
 	})
 }
 
+// InteractAsOf implements store.HistoricalInteractor interface.
+func (s *Store) InteractAsOf(ctx context.Context, t time.Time, f func(repo repos.Repository) error) error {
+	logger := logging.WithValuesFromContext(ctx, s.logger)
+	storeVersion, err := s.GetVersion(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error determining database RID schema version")
+	}
+
+	tx, err := s.db.BeginAsOf(ctx, t)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error starting historical query as of %s", t)
+	}
+	// Nothing is ever written in tx, so there is nothing to commit.
+	defer func() { _ = tx.Rollback() }()
+
+	return f(&repo{
+		ISA:          NewISARepo(ctx, dssql.Traced(tx), *storeVersion, s.jurisdictions, logger, s.clock),
+		Subscription: NewISASubscriptionRepo(ctx, dssql.Traced(tx), *storeVersion, s.jurisdictions, logger, s.clock),
+	})
+}
+
+// Capabilities implements store.Store interface. ISAs are streamed starting
+// with schema 3.1.0.
+func (s *Store) Capabilities() ridstore.Capabilities {
+	return ridstore.Capabilities{
+		Pagination:    s.version.Compare(v310) >= 0,
+		History:       true,
+		FollowerReads: s.db.FollowerReads(),
+	}
+}
+
 // Close closes the underlying DB connection.
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func recoverRollbackRepanic(ctx context.Context, tx *sql.Tx) {
-	if p := recover(); p != nil {
-		if err := tx.Rollback(); err != nil {
-			logging.WithValuesFromContext(ctx, logging.Logger).Error(
-				"failed to rollback transaction", zap.Error(err),
-			)
-		}
-	}
+// StorageFootprint returns the approximate storage consumed by each owner
+// in the remote ID tables.
+func (s *Store) StorageFootprint(ctx context.Context) ([]cockroach.Footprint, error) {
+	return s.db.StorageFootprint(ctx, DatabaseName, []cockroach.FootprintTable{
+		{Name: "identification_service_areas", OwnerColumn: "owner", OwnerIndex: "owner_idx"},
+		{Name: "subscriptions", OwnerColumn: "owner", OwnerIndex: "owner_idx"},
+	})
+}
+
+// EntityDensity returns the number of ISAs active at now by region and by
+// manager.
+func (s *Store) EntityDensity(ctx context.Context, now time.Time) ([]cockroach.Density, error) {
+	return s.db.EntityDensity(ctx, []cockroach.DensityTable{
+		{Name: "identification_service_areas", Kind: events.KindISA},
+	}, now)
 }
 
 // CleanUp removes all database tables managed by s.
@@ -13,6 +13,7 @@ import (
 	dssmodels "github.com/interuss/dss/pkg/models"
 	ridmodels "github.com/interuss/dss/pkg/rid/models"
 	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/dss/pkg/summary"
 	"github.com/jonboulle/clockwork"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
@@ -46,14 +47,15 @@ func setUpStore(ctx context.Context, t *testing.T) (*Store, func()) {
 }
 
 func newStore() (*Store, error) {
-	cdb, err := cockroach.Dial(*storeURI)
+	cdb, err := cockroach.Dial(*storeURI, cockroach.PoolParameters{})
 	if err != nil {
 		return nil, err
 	}
 	return &Store{
-		db:     cdb,
-		logger: logging.Logger,
-		clock:  fakeClock,
+		db:       cdb,
+		logger:   logging.Logger,
+		clock:    fakeClock,
+		recorder: summary.NewRecorder(fakeClock),
 	}, nil
 }
 
@@ -209,6 +211,7 @@ func TestBasicTxn(t *testing.T) {
 		ISA: &isaRepo{
 			Queryable: tx1,
 			logger:    logging.Logger,
+			clock:     DefaultClock,
 		},
 		Subscription: &subscriptionRepo{
 			Queryable: tx1,
@@ -223,6 +226,7 @@ func TestBasicTxn(t *testing.T) {
 		ISA: &isaRepo{
 			Queryable: tx2,
 			logger:    logging.Logger,
+			clock:     DefaultClock,
 		},
 		Subscription: &subscriptionRepo{
 			Queryable: tx2,
@@ -257,3 +261,9 @@ func TestBasicTxn(t *testing.T) {
 
 	require.Len(t, subs, 1)
 }
+
+func TestSupportedSchemasIncludeLatestMigration(t *testing.T) {
+	latest, err := cockroach.LatestSchemaVersion("../../../../build/deploy/db_schemas/defaultdb")
+	require.NoError(t, err)
+	require.Equal(t, *latest, SupportedSchemas.Max)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/interuss/dss/pkg/cockroach"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	"github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
@@ -17,10 +18,24 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	subscriptionFieldsV3       = "id, owner, url, notification_index, cells, starts_at, ends_at, updated_at"
-	updateSubscriptionFieldsV3 = "id, url, notification_index, cells, starts_at, ends_at, updated_at"
-)
+// subscriptionFieldsV3 are the columns read into Subscriptions before schema
+// 3.1.0.
+var subscriptionFieldsV3 = subscriptionColumnsV3(new(ridmodels.Subscription), new(pq.Int64Array)).Names("")
+
+// subscriptionColumnsV3 returns the columns read into s and cells before
+// schema 3.1.0, which lack the writer.
+func subscriptionColumnsV3(s *ridmodels.Subscription, cells *pq.Int64Array) dssql.Columns {
+	return dssql.Columns{
+		{Name: "id", Value: &s.ID},
+		{Name: "owner", Value: &s.Owner},
+		{Name: "url", Value: &s.URL},
+		{Name: "notification_index", Value: &s.NotificationIndex},
+		{Name: "cells", Value: cells},
+		{Name: "starts_at", Value: &s.StartTime},
+		{Name: "ends_at", Value: &s.EndTime},
+		{Name: "updated_at", Value: &s.Version},
+	}
+}
 
 // subscriptions is an implementation of the SubscriptionRepo for CRDB.
 type subscriptionRepoV3 struct {
@@ -39,22 +54,12 @@ func (c *subscriptionRepoV3) process(ctx context.Context, query string, args ...
 	defer rows.Close()
 
 	var payload []*ridmodels.Subscription
-	cids := pq.Int64Array{}
-
 	for rows.Next() {
-		s := new(ridmodels.Subscription)
-
-		err := rows.Scan(
-			&s.ID,
-			&s.Owner,
-			&s.URL,
-			&s.NotificationIndex,
-			&cids,
-			&s.StartTime,
-			&s.EndTime,
-			&s.Version,
+		var (
+			s    = new(ridmodels.Subscription)
+			cids pq.Int64Array
 		)
-		if err != nil {
+		if err := rows.Scan(subscriptionColumnsV3(s, &cids).Values()...); err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning Subscription row")
 		}
 		s.SetCells(cids)
@@ -85,35 +90,7 @@ func (c *subscriptionRepoV3) processOne(ctx context.Context, query string, args
 // owner has in each one of these cells, and returns the number of subscriptions
 // in the cell with the highest number of subscriptions.
 func (c *subscriptionRepoV3) MaxSubscriptionCountInCellsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (int, error) {
-	// TODO:steeling this query is expensive. The standard defines the max sub
-	// per "area", but area is loosely defined. Since we may not have to be so
-	// strict we could keep this count in memory, (or in some other storage).
-	var query = `
-    SELECT
-      IFNULL(MAX(subscriptions_per_cell_id), 0)
-    FROM (
-      SELECT
-        COUNT(*) AS subscriptions_per_cell_id
-      FROM (
-      	SELECT unnest(cells) as cell_id
-      	FROM subscriptions
-      	WHERE owner = $1
-      		AND ends_at >= $2
-      )
-      WHERE
-        cell_id = ANY($3)
-      GROUP BY cell_id
-    )`
-
-	cids := make([]int64, len(cells))
-	for i, cell := range cells {
-		cids[i] = int64(cell)
-	}
-
-	row := c.QueryRowContext(ctx, query, owner, c.clock.Now(), pq.Int64Array(cids))
-	var ret int
-	err := row.Scan(&ret)
-	return ret, stacktrace.Propagate(err, "Error scanning subscription count row")
+	return maxSubscriptionCount(ctx, c, c.clock.Now(), cells, owner, noSubscription)
 }
 
 // GetSubscription returns the subscription identified by "id".
@@ -129,16 +106,6 @@ func (c *subscriptionRepoV3) GetSubscription(ctx context.Context, id dssmodels.I
 // UpdateSubscription updates the Subscription.. not yet implemented.
 // Returns nil, nil if ID, version not found
 func (c *subscriptionRepoV3) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
-	var (
-		updateQuery = fmt.Sprintf(`
-		UPDATE
-		  subscriptions
-		SET (%s) = ($1, $2, $3, $4, $5, $6, transaction_timestamp())
-		WHERE id = $1 AND updated_at = $7
-		RETURNING
-			%s`, updateSubscriptionFieldsV3, subscriptionFieldsV3)
-	)
-
 	cids := make([]int64, len(s.Cells))
 
 	for i, cell := range s.Cells {
@@ -147,31 +114,31 @@ func (c *subscriptionRepoV3) UpdateSubscription(ctx context.Context, s *ridmodel
 		}
 		cids[i] = int64(cell)
 	}
+	if err := checkSubscriptionCount(ctx, c, c.clock.Now(), s); err != nil {
+		return nil, err
+	}
 
-	return c.processOne(ctx, updateQuery,
-		s.ID,
-		s.URL,
-		s.NotificationIndex,
-		pq.Int64Array(cids),
-		s.StartTime,
-		s.EndTime,
-		s.Version.ToTimestamp())
+	columns := dssql.Columns{
+		{Name: "url", Value: s.URL},
+		{Name: "notification_index", Value: s.NotificationIndex},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+	}
+	updateQuery := fmt.Sprintf(`
+		UPDATE
+		  subscriptions
+		SET (%s, updated_at) = (%s, transaction_timestamp())
+		WHERE id = $1 AND updated_at = $2
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(2), subscriptionFieldsV3)
+	args := append([]interface{}{s.ID, s.Version.ToTimestamp()}, columns.Values()...)
+	return c.processOne(ctx, updateQuery, args...)
 }
 
 // InsertSubscription inserts subscription into the store and returns
 // the resulting subscription including its ID.
 func (c *subscriptionRepoV3) InsertSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
-	var (
-		insertQuery = fmt.Sprintf(`
-		INSERT INTO
-		  subscriptions
-		  (%s)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, transaction_timestamp())
-		RETURNING
-			%s`, subscriptionFieldsV3, subscriptionFieldsV3)
-	)
-
 	cids := make([]int64, len(s.Cells))
 
 	for i, cell := range s.Cells {
@@ -180,15 +147,28 @@ func (c *subscriptionRepoV3) InsertSubscription(ctx context.Context, s *ridmodel
 		}
 		cids[i] = int64(cell)
 	}
+	if err := checkSubscriptionCount(ctx, c, c.clock.Now(), s); err != nil {
+		return nil, err
+	}
 
-	return c.processOne(ctx, insertQuery,
-		s.ID,
-		s.Owner,
-		s.URL,
-		s.NotificationIndex,
-		pq.Int64Array(cids),
-		s.StartTime,
-		s.EndTime)
+	columns := dssql.Columns{
+		{Name: "id", Value: s.ID},
+		{Name: "owner", Value: s.Owner},
+		{Name: "url", Value: s.URL},
+		{Name: "notification_index", Value: s.NotificationIndex},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+	}
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO
+		  subscriptions
+		  (%s, updated_at)
+		VALUES
+			(%s, transaction_timestamp())
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(0), subscriptionFieldsV3)
+	return c.processOne(ctx, insertQuery, columns.Values()...)
 }
 
 // DeleteSubscription deletes the subscription identified by ID.
@@ -211,11 +191,11 @@ func (c *subscriptionRepoV3) DeleteSubscription(ctx context.Context, s *ridmodel
 func (c *subscriptionRepoV3) UpdateNotificationIdxsInCells(ctx context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
 	var updateQuery = fmt.Sprintf(`
 			UPDATE subscriptions
-			SET notification_index = notification_index + 1
+			SET notification_index = %s
 			WHERE
 				cells && $1
 				AND ends_at >= $2
-			RETURNING %s`, subscriptionFieldsV3)
+			RETURNING %s`, cockroach.IncrementNotificationIndex(false), subscriptionFieldsV3)
 
 	cids := make([]int64, len(cells))
 	for i, cell := range cells {
@@ -225,6 +205,18 @@ func (c *subscriptionRepoV3) UpdateNotificationIdxsInCells(ctx context.Context,
 		ctx, updateQuery, pq.Int64Array(cids), c.clock.Now())
 }
 
+// ResetNotificationIndex sets the notification index of the subscription
+// identified by "id" back to 0, leaving its version unchanged.
+// Returns nil, nil if not found
+func (c *subscriptionRepoV3) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	var query = fmt.Sprintf(`
+		UPDATE subscriptions
+		SET notification_index = 0
+		WHERE id = $1
+		RETURNING %s`, subscriptionFieldsV3)
+	return c.processOne(ctx, query, id)
+}
+
 // SearchSubscriptions returns all subscriptions in "cells".
 func (c *subscriptionRepoV3) SearchSubscriptions(ctx context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
 	var (
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/cockroach"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	"github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
@@ -20,17 +23,39 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	subscriptionFields       = "id, owner, url, notification_index, cells, starts_at, ends_at, writer, updated_at"
-	updateSubscriptionFields = "id, url, notification_index, cells, starts_at, ends_at, writer, updated_at"
-)
+// subscriptionFields are the columns read into Subscriptions.
+var subscriptionFields = subscriptionColumns(new(ridmodels.Subscription), new(subscriptionRow)).Names("")
+
+// subscriptionRow holds the columns of a Subscription row which are not read
+// directly into the Subscription.
+type subscriptionRow struct {
+	cells  pq.Int64Array
+	writer sql.NullString
+}
 
-func NewISASubscriptionRepo(ctx context.Context, db dssql.Queryable, dbVersion semver.Version, logger *zap.Logger, clock clockwork.Clock) repos.Subscription {
+// subscriptionColumns returns the columns read into s and row.
+func subscriptionColumns(s *ridmodels.Subscription, row *subscriptionRow) dssql.Columns {
+	return dssql.Columns{
+		{Name: "id", Value: &s.ID},
+		{Name: "owner", Value: &s.Owner},
+		{Name: "url", Value: &s.URL},
+		{Name: "notification_index", Value: &s.NotificationIndex},
+		{Name: "cells", Value: &row.cells},
+		{Name: "starts_at", Value: &s.StartTime},
+		{Name: "ends_at", Value: &s.EndTime},
+		{Name: "writer", Value: &row.writer},
+		{Name: "updated_at", Value: &s.Version},
+	}
+}
+
+func NewISASubscriptionRepo(ctx context.Context, db dssql.Queryable, dbVersion semver.Version, jurisdictions geo.Jurisdictions, logger *zap.Logger, clock clockwork.Clock) repos.Subscription {
 	if dbVersion.Compare(v310) >= 0 {
 		return &subscriptionRepo{
-			Queryable: db,
-			logger:    logger,
-			clock:     clock,
+			Queryable:     db,
+			logger:        logger,
+			clock:         clock,
+			regionColumns: newRegionColumns(dbVersion, jurisdictions),
+			widened:       dbVersion.Compare(v380) >= 0,
 		}
 	}
 	return &subscriptionRepoV3{
@@ -46,6 +71,10 @@ type subscriptionRepo struct {
 
 	clock  clockwork.Clock
 	logger *zap.Logger
+	regionColumns
+	// widened is true if notification_index is an INT8. Otherwise, it wraps
+	// around when incremented past dssmodels.MaxNotificationIndex.
+	widened bool
 }
 
 // process a query that should return one or many subscriptions.
@@ -57,28 +86,16 @@ func (c *subscriptionRepo) process(ctx context.Context, query string, args ...in
 	defer rows.Close()
 
 	var payload []*ridmodels.Subscription
-	cids := pq.Int64Array{}
-
-	var writer sql.NullString
 	for rows.Next() {
-		s := new(ridmodels.Subscription)
-
-		err := rows.Scan(
-			&s.ID,
-			&s.Owner,
-			&s.URL,
-			&s.NotificationIndex,
-			&cids,
-			&s.StartTime,
-			&s.EndTime,
-			&writer,
-			&s.Version,
+		var (
+			s   = new(ridmodels.Subscription)
+			row subscriptionRow
 		)
-		if err != nil {
+		if err := rows.Scan(subscriptionColumns(s, &row).Values()...); err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning Subscription row")
 		}
-		s.Writer = writer.String
-		s.SetCells(cids)
+		s.Writer = row.writer.String
+		s.SetCells(row.cells)
 		payload = append(payload, s)
 	}
 	if err := rows.Err(); err != nil {
@@ -106,6 +123,15 @@ func (c *subscriptionRepo) processOne(ctx context.Context, query string, args ..
 // owner has in each one of these cells, and returns the number of subscriptions
 // in the cell with the highest number of subscriptions.
 func (c *subscriptionRepo) MaxSubscriptionCountInCellsByOwner(ctx context.Context, cells s2.CellUnion, owner dssmodels.Owner) (int, error) {
+	return maxSubscriptionCount(ctx, c, c.clock.Now(), cells, owner, noSubscription)
+}
+
+// noSubscription is the ID of no subscription.
+var noSubscription = dssmodels.ID(uuid.Nil.String())
+
+// maxSubscriptionCount returns the largest number of subscriptions of owner,
+// other than excluded, active at now in one of cells.
+func maxSubscriptionCount(ctx context.Context, q dssql.Queryable, now time.Time, cells s2.CellUnion, owner dssmodels.Owner, excluded dssmodels.ID) (int, error) {
 	// TODO:steeling this query is expensive. The standard defines the max sub
 	// per "area", but area is loosely defined. Since we may not have to be so
 	// strict we could keep this count in memory, (or in some other storage).
@@ -120,6 +146,7 @@ func (c *subscriptionRepo) MaxSubscriptionCountInCellsByOwner(ctx context.Contex
       	FROM subscriptions
       	WHERE owner = $1
       		AND ends_at >= $2
+      		AND id != $4
       )
       WHERE
         cell_id = ANY($3)
@@ -131,12 +158,23 @@ func (c *subscriptionRepo) MaxSubscriptionCountInCellsByOwner(ctx context.Contex
 		cids[i] = int64(cell)
 	}
 
-	row := c.QueryRowContext(ctx, query, owner, c.clock.Now(), pq.Int64Array(cids))
+	row := q.QueryRowContext(ctx, query, owner, now, pq.Int64Array(cids), excluded)
 	var ret int
 	err := row.Scan(&ret)
 	return ret, stacktrace.Propagate(err, "Error scanning subscription count row")
 }
 
+// checkSubscriptionCount fails with Exhausted if the owner of s has too many
+// other subscriptions active at now in one of the cells of s for s to be
+// written.
+func checkSubscriptionCount(ctx context.Context, q dssql.Queryable, now time.Time, s *ridmodels.Subscription) error {
+	count, err := maxSubscriptionCount(ctx, q, now, s.Cells, s.Owner, s.ID)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to fetch subscription count, rejecting request")
+	}
+	return s.CheckSubscriptionCount(count)
+}
+
 // GetSubscription returns the subscription identified by "id".
 // Returns nil, nil if not found
 func (c *subscriptionRepo) GetSubscription(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
@@ -150,16 +188,6 @@ func (c *subscriptionRepo) GetSubscription(ctx context.Context, id dssmodels.ID)
 // UpdateSubscription updates the Subscription.. not yet implemented.
 // Returns nil, nil if ID, version not found
 func (c *subscriptionRepo) UpdateSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
-	var (
-		updateQuery = fmt.Sprintf(`
-		UPDATE
-		  subscriptions
-		SET (%s) = ($1, $2, $3, $4, $5, $6, $7, transaction_timestamp())
-		WHERE id = $1 AND updated_at = $8
-		RETURNING
-			%s`, updateSubscriptionFields, subscriptionFields)
-	)
-
 	cids := make([]int64, len(s.Cells))
 
 	for i, cell := range s.Cells {
@@ -168,32 +196,33 @@ func (c *subscriptionRepo) UpdateSubscription(ctx context.Context, s *ridmodels.
 		}
 		cids[i] = int64(cell)
 	}
+	if err := checkSubscriptionCount(ctx, c, c.clock.Now(), s); err != nil {
+		return nil, err
+	}
 
-	return c.processOne(ctx, updateQuery,
-		s.ID,
-		s.URL,
-		s.NotificationIndex,
-		pq.Int64Array(cids),
-		s.StartTime,
-		s.EndTime,
-		s.Writer,
-		s.Version.ToTimestamp())
+	columns := dssql.Columns{
+		{Name: "url", Value: s.URL},
+		{Name: "notification_index", Value: s.NotificationIndex},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+		{Name: "writer", Value: s.Writer},
+	}
+	columns = c.with(columns, s.Cells)
+	updateQuery := fmt.Sprintf(`
+		UPDATE
+		  subscriptions
+		SET (%s, updated_at) = (%s, transaction_timestamp())
+		WHERE id = $1 AND updated_at = $2
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(2), subscriptionFields)
+	args := append([]interface{}{s.ID, s.Version.ToTimestamp()}, columns.Values()...)
+	return c.processOne(ctx, updateQuery, args...)
 }
 
 // InsertSubscription inserts subscription into the store and returns
 // the resulting subscription including its ID.
 func (c *subscriptionRepo) InsertSubscription(ctx context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
-	var (
-		insertQuery = fmt.Sprintf(`
-		INSERT INTO
-		  subscriptions
-		  (%s)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, transaction_timestamp())
-		RETURNING
-			%s`, subscriptionFields, subscriptionFields)
-	)
-
 	cids := make([]int64, len(s.Cells))
 
 	for i, cell := range s.Cells {
@@ -202,16 +231,30 @@ func (c *subscriptionRepo) InsertSubscription(ctx context.Context, s *ridmodels.
 		}
 		cids[i] = int64(cell)
 	}
+	if err := checkSubscriptionCount(ctx, c, c.clock.Now(), s); err != nil {
+		return nil, err
+	}
 
-	return c.processOne(ctx, insertQuery,
-		s.ID,
-		s.Owner,
-		s.URL,
-		s.NotificationIndex,
-		pq.Int64Array(cids),
-		s.StartTime,
-		s.EndTime,
-		s.Writer)
+	columns := dssql.Columns{
+		{Name: "id", Value: s.ID},
+		{Name: "owner", Value: s.Owner},
+		{Name: "url", Value: s.URL},
+		{Name: "notification_index", Value: s.NotificationIndex},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+		{Name: "writer", Value: s.Writer},
+	}
+	columns = c.with(columns, s.Cells)
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO
+		  subscriptions
+		  (%s, updated_at)
+		VALUES
+			(%s, transaction_timestamp())
+		RETURNING
+			%s`, columns.Names(""), columns.Placeholders(0), subscriptionFields)
+	return c.processOne(ctx, insertQuery, columns.Values()...)
 }
 
 // DeleteSubscription deletes the subscription identified by ID.
@@ -232,20 +275,36 @@ func (c *subscriptionRepo) DeleteSubscription(ctx context.Context, s *ridmodels.
 
 // UpdateNotificationIdxsInCells incremement the notification for each sub in the given cells.
 func (c *subscriptionRepo) UpdateNotificationIdxsInCells(ctx context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
-	var updateQuery = fmt.Sprintf(`
+	updateQuery := fmt.Sprintf(`
 			UPDATE subscriptions
-			SET notification_index = notification_index + 1
+			SET notification_index = %s
 			WHERE
 				cells && $1
-				AND ends_at >= $2
-			RETURNING %s`, subscriptionFields)
+				AND ends_at >= $2`, cockroach.IncrementNotificationIndex(c.widened))
 
 	cids := make([]int64, len(cells))
 	for i, cell := range cells {
 		cids[i] = int64(cell)
 	}
-	return c.process(
-		ctx, updateQuery, pq.Int64Array(cids), c.clock.Now())
+	args := []interface{}{pq.Int64Array(cids), c.clock.Now()}
+	if c.partitioned {
+		updateQuery, args = cockroach.RestrictToRegions(updateQuery, args, "region", cells)
+	}
+	updateQuery += fmt.Sprintf(`
+			RETURNING %s`, subscriptionFields)
+	return c.process(ctx, updateQuery, args...)
+}
+
+// ResetNotificationIndex sets the notification index of the subscription
+// identified by "id" back to 0, leaving its version unchanged.
+// Returns nil, nil if not found
+func (c *subscriptionRepo) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	var query = fmt.Sprintf(`
+		UPDATE subscriptions
+		SET notification_index = 0
+		WHERE id = $1
+		RETURNING %s`, subscriptionFields)
+	return c.processOne(ctx, query, id)
 }
 
 // SearchSubscriptions returns all subscriptions in "cells".
@@ -271,7 +330,11 @@ func (c *subscriptionRepo) SearchSubscriptions(ctx context.Context, cells s2.Cel
 		cids[i] = int64(cell)
 	}
 
-	return c.process(ctx, query, pq.Int64Array(cids), c.clock.Now())
+	args := []interface{}{pq.Int64Array(cids), c.clock.Now()}
+	if c.partitioned {
+		query, args = cockroach.RestrictToRegions(query, args, "region", cells)
+	}
+	return c.process(ctx, query, args...)
 }
 
 // SearchSubscriptionsByOwner returns all subscriptions in "cells".
@@ -299,11 +362,15 @@ func (c *subscriptionRepo) SearchSubscriptionsByOwner(ctx context.Context, cells
 		cids[i] = int64(cell)
 	}
 
-	return c.process(ctx, query, pq.Int64Array(cids), owner, c.clock.Now())
+	args := []interface{}{pq.Int64Array(cids), owner, c.clock.Now()}
+	if c.partitioned {
+		query, args = cockroach.RestrictToRegions(query, args, "region", cells)
+	}
+	return c.process(ctx, query, args...)
 }
 
 // ListExpiredSubscriptions lists all expired Subscriptions based on writer.
-// Records expire if current time is <expiredDurationInMin> minutes more than records' endTime.
+// Records expire if the time of the clock of c is <expiredDurationInMin> minutes more than records' endTime.
 // The function queries both empty writer and null writer when passing empty string as a writer.
 func (c *subscriptionRepo) ListExpiredSubscriptions(ctx context.Context, writer string) ([]*ridmodels.Subscription, error) {
 	writerQuery := "'" + writer + "'"
@@ -318,10 +385,10 @@ func (c *subscriptionRepo) ListExpiredSubscriptions(ctx context.Context, writer
 	FROM
 		subscriptions
 	WHERE
-		ends_at + INTERVAL '%d' MINUTE <= CURRENT_TIMESTAMP
+		ends_at + INTERVAL '%d' MINUTE <= $1
 	AND
 		(writer = %s)`, subscriptionFields, expiredDurationInMin, writerQuery)
 	)
 
-	return c.process(ctx, query)
+	return c.process(ctx, query, c.clock.Now())
 }
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/stacktrace"
+)
+
+func copyISA(isa *ridmodels.IdentificationServiceArea) *ridmodels.IdentificationServiceArea {
+	result := *isa
+	result.Cells = copyCells(isa.Cells)
+	return &result
+}
+
+// putISA stores isa, replacing any ISA with the same ID. r.s must be locked.
+func (r *repo) putISA(isa *ridmodels.IdentificationServiceArea) {
+	old, existed := r.s.isas[isa.ID]
+	if existed {
+		r.s.isaCells.Remove(old.ID.String(), old.Cells)
+	}
+	r.s.isas[isa.ID] = isa
+	r.s.isaCells.Add(isa.ID.String(), isa.Cells)
+	r.onRollback(func() {
+		r.s.isaCells.Remove(isa.ID.String(), isa.Cells)
+		delete(r.s.isas, isa.ID)
+		if existed {
+			r.s.isas[old.ID] = old
+			r.s.isaCells.Add(old.ID.String(), old.Cells)
+		}
+	})
+}
+
+// removeISA deletes the ISA identified by id. r.s must be locked.
+func (r *repo) removeISA(id dssmodels.ID) {
+	old, ok := r.s.isas[id]
+	if !ok {
+		return
+	}
+	r.s.isaCells.Remove(id.String(), old.Cells)
+	delete(r.s.isas, id)
+	r.onRollback(func() {
+		r.s.isas[id] = old
+		r.s.isaCells.Add(id.String(), old.Cells)
+	})
+}
+
+// GetISA returns the isa identified by "id".
+// Returns nil, nil if not found
+func (r *repo) GetISA(_ context.Context, id dssmodels.ID) (*ridmodels.IdentificationServiceArea, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	isa, ok := r.s.isas[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyISA(isa), nil
+}
+
+// InsertISA inserts isa, failing if an ISA with the same ID exists.
+func (r *repo) InsertISA(_ context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
+	for _, cell := range isa.Cells {
+		if err := geo.ValidateCell(cell); err != nil {
+			return nil, stacktrace.Propagate(err, "Error validating cell")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.s.isas[isa.ID]; ok {
+		return nil, stacktrace.NewError("ISA %s already exists", isa.ID)
+	}
+	stored := copyISA(isa)
+	stored.Version = dssmodels.VersionFromTime(r.now())
+	r.putISA(stored)
+	return copyISA(stored), nil
+}
+
+// UpdateISA updates the ISA identified by the ID and version of isa.
+// Returns nil, nil if ID, version not found
+func (r *repo) UpdateISA(_ context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
+	for _, cell := range isa.Cells {
+		if err := geo.ValidateCell(cell); err != nil {
+			return nil, stacktrace.Propagate(err, "Error validating cell")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.isas[isa.ID]
+	if !ok || !old.Version.Matches(isa.Version) {
+		return nil, nil
+	}
+	stored := copyISA(isa)
+	stored.Owner = old.Owner
+	stored.Version = dssmodels.VersionFromTime(r.now())
+	r.putISA(stored)
+	return copyISA(stored), nil
+}
+
+// DeleteISA deletes the ISA identified by the ID and version of isa.
+// Returns nil, nil if ID, version not found
+func (r *repo) DeleteISA(_ context.Context, isa *ridmodels.IdentificationServiceArea) (*ridmodels.IdentificationServiceArea, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.isas[isa.ID]
+	if !ok || !old.Version.Matches(isa.Version) {
+		return nil, nil
+	}
+	r.removeISA(isa.ID)
+	return copyISA(old), nil
+}
+
+// SearchISAs returns the ISAs intersecting "cells" and, if set, the temporal
+// volume defined by "earliest" and "latest". Unless "includeExpired" is true,
+// ISAs that ended before the current time of the store's clock are excluded.
+func (r *repo) SearchISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool) ([]*ridmodels.IdentificationServiceArea, error) {
+	if len(cells) == 0 {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		now    = r.s.clock.Now()
+		result []*ridmodels.IdentificationServiceArea
+	)
+	for _, id := range r.s.isaCells.Intersecting(cells) {
+		isa := r.s.isas[dssmodels.ID(id)]
+		if !overlaps(isa.StartTime, isa.EndTime, earliest, latest) {
+			continue
+		}
+		if !includeExpired && !active(isa.EndTime, now) {
+			continue
+		}
+		result = append(result, copyISA(isa))
+	}
+	if dssmodels.SearchOrderFromContext(ctx) == dssmodels.SearchOrderRelevance {
+		sort.SliceStable(result, func(i, j int) bool {
+			return dssmodels.TemporalDistance(now, result[i].StartTime, result[i].EndTime) <
+				dssmodels.TemporalDistance(now, result[j].StartTime, result[j].EndTime)
+		})
+	}
+	return result, nil
+}
+
+// StreamISAs calls f with each ISA SearchISAs would return, searched all at
+// once since the ISAs are in memory already.
+func (r *repo) StreamISAs(ctx context.Context, cells s2.CellUnion, earliest *time.Time, latest *time.Time, includeExpired bool, f func(*ridmodels.IdentificationServiceArea) error) error {
+	isas, err := r.SearchISAs(ctx, cells, earliest, latest, includeExpired)
+	if err != nil {
+		return err
+	}
+	for _, isa := range isas {
+		if err := f(isa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListExpiredISAs lists the ISAs of writer that ended more than
+// expiredDuration ago.
+func (r *repo) ListExpiredISAs(_ context.Context, writer string) ([]*ridmodels.IdentificationServiceArea, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		threshold = r.s.clock.Now().Add(-expiredDuration)
+		result    []*ridmodels.IdentificationServiceArea
+	)
+	for _, isa := range r.s.isas {
+		if isa.Writer == writer && isa.EndTime != nil && !isa.EndTime.After(threshold) {
+			result = append(result, copyISA(isa))
+		}
+	}
+	return result, nil
+}
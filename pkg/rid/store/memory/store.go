@@ -0,0 +1,187 @@
+// Package memory implements the remote ID store in process memory, so that
+// the DSS can be run and its handlers tested without a CockroachDB cluster.
+// Nothing is persisted: the contents of a Store are lost when the process
+// exits.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/rid/repos"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+)
+
+// expiredDuration is the time after their end at which entities are listed
+// for garbage collection, as in the CockroachDB store.
+const expiredDuration = 30 * time.Minute
+
+// schemaVersion is the version of the database schema whose behavior Store
+// reproduces.
+var schemaVersion = semver.New("3.5.0")
+
+// Store is an implementation of store.Store keeping entities in memory and
+// indexing them by S2 cell. Transactions are serialized.
+type Store struct {
+	clock clockwork.Clock
+
+	mu         sync.Mutex
+	isas       map[dssmodels.ID]*ridmodels.IdentificationServiceArea
+	isaCells   *geo.CellIndex
+	subs       map[dssmodels.ID]*ridmodels.Subscription
+	subCells   *geo.CellIndex
+	lastUpdate time.Time
+}
+
+// NewStore returns an empty Store using clock to timestamp and expire
+// entities.
+func NewStore(clock clockwork.Clock) *Store {
+	return &Store{
+		clock:    clock,
+		isas:     map[dssmodels.ID]*ridmodels.IdentificationServiceArea{},
+		isaCells: geo.NewCellIndex(),
+		subs:     map[dssmodels.ID]*ridmodels.Subscription{},
+		subCells: geo.NewCellIndex(),
+	}
+}
+
+// repo is an implementation of repos.Repository operating on the entities of
+// s. Outside of transactions, every call locks s; within a transaction, s is
+// locked for the duration of the transaction and every change registers its
+// inverse in undo.
+type repo struct {
+	s    *Store
+	lock sync.Locker
+	undo *[]func()
+}
+
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// Interact implements store.Interactor interface.
+func (s *Store) Interact(_ context.Context) (repos.Repository, error) {
+	return &repo{s: s, lock: &s.mu}, nil
+}
+
+// Transact implements store.Transactor interface.
+func (s *Store) Transact(_ context.Context, f func(repo repos.Repository) error) error {
+	return s.transact(func(r *repo) error { return f(r) })
+}
+
+// TransactISA implements store.ISATransactor interface.
+func (s *Store) TransactISA(ctx context.Context, write ridstore.ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error) {
+	var (
+		isa  *ridmodels.IdentificationServiceArea
+		subs []*ridmodels.Subscription
+	)
+	err := s.transact(func(r *repo) error {
+		var (
+			cells s2.CellUnion
+			err   error
+		)
+		isa, cells, err = write(r)
+		if err != nil {
+			return err
+		}
+		subs, err = r.UpdateNotificationIdxsInCells(ctx, cells)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error updating notification indices")
+		}
+		return ridstore.RespondISA(ctx, isa, subs)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return isa, subs, nil
+}
+
+// transact runs f with s locked, reverting the changes f made if it fails.
+func (s *Store) transact(f func(r *repo) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var undo []func()
+	defer func() {
+		if err != nil {
+			rollback(undo)
+		}
+	}()
+	defer dsserr.RecoverPanic(&err)
+	return f(&repo{s: s, lock: noLock{}, undo: &undo})
+}
+
+func rollback(undo []func()) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		undo[i]()
+	}
+}
+
+// Capabilities implements ridstore.Store. Searches are served from memory
+// all at once, and past states are not kept.
+func (s *Store) Capabilities() ridstore.Capabilities {
+	return ridstore.Capabilities{}
+}
+
+// Close implements io.Closer.
+func (s *Store) Close() error {
+	return nil
+}
+
+// GetVersion returns the version of the database schema whose behavior s
+// reproduces.
+func (s *Store) GetVersion(context.Context) (*semver.Version, error) {
+	return schemaVersion, nil
+}
+
+// onRollback registers f to be called if the transaction of r fails.
+func (r *repo) onRollback(f func()) {
+	if r.undo != nil {
+		*r.undo = append(*r.undo, f)
+	}
+}
+
+// now returns the current time of the clock of r.s for use as the update
+// time of an entity, ensuring successive updates get distinct versions.
+// r.s must be locked.
+func (r *repo) now() time.Time {
+	now := r.s.clock.Now()
+	if !now.After(r.s.lastUpdate) {
+		now = r.s.lastUpdate.Add(time.Microsecond)
+	}
+	r.s.lastUpdate = now
+	return now
+}
+
+// active returns true if an entity ending at end has not ended at now.
+// Like the SQL comparisons of the CockroachDB store, it is false if end is
+// unknown.
+func active(end *time.Time, now time.Time) bool {
+	return end != nil && !end.Before(now)
+}
+
+// overlaps returns true if the time range [start, end] of an entity overlaps
+// [earliest, latest], any of which may be unbounded.
+func overlaps(start, end, earliest, latest *time.Time) bool {
+	if end != nil && earliest != nil && end.Before(*earliest) {
+		return false
+	}
+	if start != nil && latest != nil && start.After(*latest) {
+		return false
+	}
+	return true
+}
+
+func copyCells(cells s2.CellUnion) s2.CellUnion {
+	return append(s2.CellUnion{}, cells...)
+}
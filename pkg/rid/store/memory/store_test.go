@@ -0,0 +1,216 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/dss/pkg/rid/repos"
+	ridstore "github.com/interuss/dss/pkg/rid/store"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// Ensure the structs conform to the interfaces
+	_ ridstore.Store   = &Store{}
+	_ repos.Repository = &repo{}
+
+	cells = s2.CellUnion{s2.CellID(17106221850767130624), s2.CellID(17106221885126868992)}
+)
+
+func newISA(clock clockwork.Clock) *ridmodels.IdentificationServiceArea {
+	var (
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+	)
+	return &ridmodels.IdentificationServiceArea{
+		ID:        dssmodels.ID(uuid.New().String()),
+		Owner:     "owner",
+		URL:       "https://example.com/flights",
+		StartTime: &start,
+		EndTime:   &end,
+		Cells:     cells,
+	}
+}
+
+func TestISALifecycle(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	isa, err := repo.InsertISA(ctx, newISA(clock))
+	require.NoError(t, err)
+	require.False(t, isa.Version.Empty())
+	_, err = repo.InsertISA(ctx, isa)
+	require.Error(t, err)
+
+	isas, err := repo.SearchISAs(ctx, s2.CellUnion{cells[1]}, nil, nil, false)
+	require.NoError(t, err)
+	require.Len(t, isas, 1)
+
+	// Updates require the current version.
+	stale := *isa
+	isa.URL = "https://example.com/other"
+	updated, err := repo.UpdateISA(ctx, isa)
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	require.False(t, updated.Version.Matches(isa.Version))
+	updated, err = repo.UpdateISA(ctx, &stale)
+	require.NoError(t, err)
+	require.Nil(t, updated)
+
+	// Expired ISAs are only found on request.
+	clock.Advance(2 * time.Hour)
+	isas, err = repo.SearchISAs(ctx, cells, nil, nil, false)
+	require.NoError(t, err)
+	require.Empty(t, isas)
+	isas, err = repo.SearchISAs(ctx, cells, nil, nil, true)
+	require.NoError(t, err)
+	require.Len(t, isas, 1)
+
+	isas, err = repo.ListExpiredISAs(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, isas, 1)
+	deleted, err := repo.DeleteISA(ctx, isas[0])
+	require.NoError(t, err)
+	require.NotNil(t, deleted)
+	isas, err = repo.SearchISAs(ctx, cells, nil, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, isas)
+}
+
+func TestTransactISANotifiesSubscriptions(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		end   = clock.Now().Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	_, err = repo.InsertSubscription(ctx, &ridmodels.Subscription{
+		ID:      dssmodels.ID(uuid.New().String()),
+		Owner:   "owner",
+		URL:     "https://example.com/subscriptions",
+		EndTime: &end,
+		Cells:   s2.CellUnion{cells[0]},
+	})
+	require.NoError(t, err)
+
+	isa, subs, err := store.TransactISA(ctx, func(r repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error) {
+		isa, err := r.InsertISA(ctx, newISA(clock))
+		return isa, cells, err
+	})
+	require.NoError(t, err)
+	require.NotNil(t, isa)
+	require.Len(t, subs, 1)
+	require.Equal(t, 1, subs[0].NotificationIndex)
+}
+
+func TestResetNotificationIndex(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		end   = clock.Now().Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	sub, err := repo.InsertSubscription(ctx, &ridmodels.Subscription{
+		ID:                dssmodels.ID(uuid.New().String()),
+		Owner:             "owner",
+		URL:               "https://example.com/subscriptions",
+		NotificationIndex: dssmodels.MaxNotificationIndex,
+		EndTime:           &end,
+		Cells:             s2.CellUnion{cells[0]},
+	})
+	require.NoError(t, err)
+
+	// Indices past the maximum are served wrapped around.
+	subs, err := repo.UpdateNotificationIdxsInCells(ctx, cells)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	require.Equal(t, dssmodels.MaxNotificationIndex+1, subs[0].NotificationIndex)
+	notified, err := subs[0].ToProto()
+	require.NoError(t, err)
+	require.Equal(t, int32(0), notified.NotificationIndex)
+
+	reset, err := repo.ResetNotificationIndex(ctx, sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0, reset.NotificationIndex)
+	require.True(t, reset.Version.Matches(sub.Version))
+
+	reset, err = repo.ResetNotificationIndex(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.Nil(t, reset)
+}
+
+func TestTransactRollsBack(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		isa   = newISA(clock)
+		fail  = errors.New("fail")
+	)
+
+	err := store.Transact(ctx, func(r repos.Repository) error {
+		_, err := r.InsertISA(ctx, isa)
+		require.NoError(t, err)
+		return fail
+	})
+	require.Equal(t, fail, err)
+
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetISA(ctx, isa.ID)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	isas, err := repo.SearchISAs(ctx, cells, nil, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, isas)
+}
+
+func TestSubscriptionLimitPerArea(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		end   = clock.Now().Add(time.Hour)
+		subs  []*ridmodels.Subscription
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	for i := 0; i <= ridmodels.MaxSubscriptionsPerArea; i++ {
+		sub, err := repo.InsertSubscription(ctx, &ridmodels.Subscription{
+			ID:      dssmodels.ID(uuid.New().String()),
+			Owner:   "owner",
+			URL:     "https://example.com/subscriptions",
+			EndTime: &end,
+			Cells:   s2.CellUnion{cells[0]},
+		})
+		if i == ridmodels.MaxSubscriptionsPerArea {
+			require.Equal(t, dsserr.Exhausted, stacktrace.GetCode(err))
+			break
+		}
+		require.NoError(t, err)
+		subs = append(subs, sub)
+	}
+
+	// Subscriptions at the limit may still be updated.
+	subs[0].URL = "https://example.com/v2/subscriptions"
+	_, err = repo.UpdateSubscription(ctx, subs[0])
+	require.NoError(t, err)
+}
@@ -0,0 +1,254 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
+	"github.com/interuss/stacktrace"
+)
+
+func copySubscription(sub *ridmodels.Subscription) *ridmodels.Subscription {
+	result := *sub
+	result.Cells = copyCells(sub.Cells)
+	return &result
+}
+
+// putSubscription stores sub, replacing any Subscription with the same ID.
+// r.s must be locked.
+func (r *repo) putSubscription(sub *ridmodels.Subscription) {
+	old, existed := r.s.subs[sub.ID]
+	if existed {
+		r.s.subCells.Remove(old.ID.String(), old.Cells)
+	}
+	r.s.subs[sub.ID] = sub
+	r.s.subCells.Add(sub.ID.String(), sub.Cells)
+	r.onRollback(func() {
+		r.s.subCells.Remove(sub.ID.String(), sub.Cells)
+		delete(r.s.subs, sub.ID)
+		if existed {
+			r.s.subs[old.ID] = old
+			r.s.subCells.Add(old.ID.String(), old.Cells)
+		}
+	})
+}
+
+// removeSubscription deletes the Subscription identified by id. r.s must be
+// locked.
+func (r *repo) removeSubscription(id dssmodels.ID) {
+	old, ok := r.s.subs[id]
+	if !ok {
+		return
+	}
+	r.s.subCells.Remove(id.String(), old.Cells)
+	delete(r.s.subs, id)
+	r.onRollback(func() {
+		r.s.subs[id] = old
+		r.s.subCells.Add(id.String(), old.Cells)
+	})
+}
+
+// activeSubscriptionsInCells returns the Subscriptions in cells that have
+// not ended, in ID order. r.s must be locked.
+func (r *repo) activeSubscriptionsInCells(cells s2.CellUnion) []*ridmodels.Subscription {
+	var (
+		now    = r.s.clock.Now()
+		result []*ridmodels.Subscription
+	)
+	for _, id := range r.s.subCells.Intersecting(cells) {
+		if sub := r.s.subs[dssmodels.ID(id)]; active(sub.EndTime, now) {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// MaxSubscriptionCountInCellsByOwner counts how many subscriptions the
+// owner has in each one of these cells, and returns the number of subscriptions
+// in the cell with the highest number of subscriptions.
+func (r *repo) MaxSubscriptionCountInCellsByOwner(_ context.Context, cells s2.CellUnion, owner dssmodels.Owner) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.maxSubscriptionCount(cells, owner, ""), nil
+}
+
+// maxSubscriptionCount returns the largest number of active Subscriptions
+// of owner, other than excluded, in one of cells. r.s must be locked.
+func (r *repo) maxSubscriptionCount(cells s2.CellUnion, owner dssmodels.Owner, excluded dssmodels.ID) int {
+	max := 0
+	for _, cell := range cells {
+		count := 0
+		for _, sub := range r.activeSubscriptionsInCells(s2.CellUnion{cell}) {
+			if sub.Owner == owner && sub.ID != excluded {
+				count++
+			}
+		}
+		if count > max {
+			max = count
+		}
+	}
+	return max
+}
+
+// GetSubscription returns the subscription identified by "id".
+// Returns nil, nil if not found
+func (r *repo) GetSubscription(_ context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sub, ok := r.s.subs[id]
+	if !ok {
+		return nil, nil
+	}
+	return copySubscription(sub), nil
+}
+
+// UpdateSubscription updates the Subscription identified by the ID and
+// version of s.
+// Returns nil, nil if ID, version not found
+func (r *repo) UpdateSubscription(_ context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	for _, cell := range s.Cells {
+		if err := geo.ValidateCell(cell); err != nil {
+			return nil, stacktrace.Propagate(err, "Error validating cell")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.subs[s.ID]
+	if !ok || !old.Version.Matches(s.Version) {
+		return nil, nil
+	}
+	if err := s.CheckSubscriptionCount(r.maxSubscriptionCount(s.Cells, old.Owner, s.ID)); err != nil {
+		return nil, err
+	}
+	stored := copySubscription(s)
+	stored.Owner = old.Owner
+	stored.Version = dssmodels.VersionFromTime(r.now())
+	r.putSubscription(stored)
+	return copySubscription(stored), nil
+}
+
+// InsertSubscription inserts subscription into the store and returns
+// the resulting subscription including its ID.
+func (r *repo) InsertSubscription(_ context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	for _, cell := range s.Cells {
+		if err := geo.ValidateCell(cell); err != nil {
+			return nil, stacktrace.Propagate(err, "Error validating cell")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.s.subs[s.ID]; ok {
+		return nil, stacktrace.NewError("Subscription %s already exists", s.ID)
+	}
+	if err := s.CheckSubscriptionCount(r.maxSubscriptionCount(s.Cells, s.Owner, s.ID)); err != nil {
+		return nil, err
+	}
+	stored := copySubscription(s)
+	stored.Version = dssmodels.VersionFromTime(r.now())
+	r.putSubscription(stored)
+	return copySubscription(stored), nil
+}
+
+// DeleteSubscription deletes the Subscription identified by the ID and
+// version of s.
+// Returns nil, nil if ID, version not found
+func (r *repo) DeleteSubscription(_ context.Context, s *ridmodels.Subscription) (*ridmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.subs[s.ID]
+	if !ok || !old.Version.Matches(s.Version) {
+		return nil, nil
+	}
+	r.removeSubscription(s.ID)
+	return copySubscription(old), nil
+}
+
+// UpdateNotificationIdxsInCells increments the notification index of each
+// Subscription in the given cells that has not ended.
+func (r *repo) UpdateNotificationIdxsInCells(_ context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*ridmodels.Subscription
+	for _, sub := range r.activeSubscriptionsInCells(cells) {
+		updated := copySubscription(sub)
+		updated.NotificationIndex++
+		r.putSubscription(updated)
+		result = append(result, copySubscription(updated))
+	}
+	return result, nil
+}
+
+// ResetNotificationIndex sets the notification index of the Subscription
+// identified by id back to 0, leaving its version unchanged.
+// Returns nil, nil if not found
+func (r *repo) ResetNotificationIndex(_ context.Context, id dssmodels.ID) (*ridmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sub, ok := r.s.subs[id]
+	if !ok {
+		return nil, nil
+	}
+	updated := copySubscription(sub)
+	updated.NotificationIndex = 0
+	r.putSubscription(updated)
+	return copySubscription(updated), nil
+}
+
+// SearchSubscriptions returns all subscriptions in "cells".
+func (r *repo) SearchSubscriptions(_ context.Context, cells s2.CellUnion) ([]*ridmodels.Subscription, error) {
+	if len(cells) == 0 {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "no location provided")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*ridmodels.Subscription
+	for _, sub := range r.activeSubscriptionsInCells(cells) {
+		result = append(result, copySubscription(sub))
+	}
+	return result, nil
+}
+
+// SearchSubscriptionsByOwner returns all subscriptions of owner in "cells".
+func (r *repo) SearchSubscriptionsByOwner(_ context.Context, cells s2.CellUnion, owner dssmodels.Owner) ([]*ridmodels.Subscription, error) {
+	if len(cells) == 0 {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "no location provided")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*ridmodels.Subscription
+	for _, sub := range r.activeSubscriptionsInCells(cells) {
+		if sub.Owner == owner {
+			result = append(result, copySubscription(sub))
+		}
+	}
+	return result, nil
+}
+
+// ListExpiredSubscriptions lists the Subscriptions of writer that ended more
+// than expiredDuration ago.
+func (r *repo) ListExpiredSubscriptions(_ context.Context, writer string) ([]*ridmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		threshold = r.s.clock.Now().Add(-expiredDuration)
+		result    []*ridmodels.Subscription
+	)
+	for _, sub := range r.s.subs {
+		if sub.Writer == writer && sub.EndTime != nil && !sub.EndTime.After(threshold) {
+			result = append(result, copySubscription(sub))
+		}
+	}
+	return result, nil
+}
@@ -3,9 +3,15 @@ package store
 import (
 	"context"
 	"io"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/idempotency"
+	ridmodels "github.com/interuss/dss/pkg/rid/models"
 	"github.com/interuss/dss/pkg/rid/repos"
+	"github.com/interuss/stacktrace"
+	"google.golang.org/protobuf/proto"
 )
 
 // Store provides the means by which to obtain Repos with which to interact with
@@ -14,9 +20,29 @@ type Store interface {
 	io.Closer
 	Interactor
 	Transactor
+	ISATransactor
 
 	// Get store version
 	GetVersion(ctx context.Context) (*semver.Version, error)
+
+	// Capabilities reports the optional features the store supports.
+	Capabilities() Capabilities
+}
+
+// Capabilities are the optional features of a Store, which vary between
+// backends. Callers check them to degrade gracefully rather than fail on a
+// Store lacking a feature.
+type Capabilities struct {
+	// Pagination is true if the results of the Stream methods of the
+	// repositories are read from the store as they are consumed, rather than
+	// all at once.
+	Pagination bool `json:"pagination"`
+	// History is true if the store is a HistoricalInteractor able to read
+	// its past states.
+	History bool `json:"history"`
+	// FollowerReads is true if the background scans of the store are served
+	// by follower reads rather than by the leaseholders of the data.
+	FollowerReads bool `json:"follower_reads"`
 }
 
 // Interactor provides means to get hold of a repos.Repository instance *without* any
@@ -33,3 +59,58 @@ type Transactor interface {
 	// isolation/atomicity.
 	Transact(ctx context.Context, f func(repos.Repository) error) error
 }
+
+// ISAWrite writes a single IdentificationServiceArea using repo and returns
+// the written ISA together with the cells whose Subscriptions must be notified
+// of the write.
+type ISAWrite func(repo repos.Repository) (*ridmodels.IdentificationServiceArea, s2.CellUnion, error)
+
+// ISATransactor provides means to write an IdentificationServiceArea
+// atomically with the notification index increments of the Subscriptions
+// affected by the write.
+type ISATransactor interface {
+	// TransactISA executes write and increments the notification indices of
+	// the Subscriptions in the cells it returns, all in one transaction. The
+	// Subscriptions to notify are returned as observed by that transaction.
+	TransactISA(ctx context.Context, write ISAWrite) (*ridmodels.IdentificationServiceArea, []*ridmodels.Subscription, error)
+}
+
+// ISAResponse builds the response to the API call writing isa, with the
+// Subscriptions subs to notify of it.
+type ISAResponse func(isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) (proto.Message, error)
+
+type isaResponseKey struct{}
+
+// WithISAResponse returns a copy of ctx in which TransactISA sets the
+// response built by f as that of the call of ctx with idempotency.Respond at
+// the end of every attempt of its transaction, see RespondISA.
+func WithISAResponse(ctx context.Context, f ISAResponse) context.Context {
+	return context.WithValue(ctx, isaResponseKey{}, f)
+}
+
+// RespondISA sets the response to the call of ctx built by its ISAResponse,
+// if any, from isa and subs with idempotency.Respond, so that the stores
+// recording idempotent responses in their transactions record it along with
+// the write of isa. Implementations of TransactISA call it at the end of
+// every attempt of their transaction.
+func RespondISA(ctx context.Context, isa *ridmodels.IdentificationServiceArea, subs []*ridmodels.Subscription) error {
+	f, ok := ctx.Value(isaResponseKey{}).(ISAResponse)
+	if !ok {
+		return nil
+	}
+	response, err := f(isa, subs)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error building response")
+	}
+	idempotency.Respond(ctx, response)
+	return nil
+}
+
+// HistoricalInteractor provides means to get hold of a read-only
+// repos.Repository instance reflecting the state of the store at a past
+// point in time.
+type HistoricalInteractor interface {
+	// InteractAsOf executes f and provides a repos.Repository instance
+	// reading the state of the store as of t.
+	InteractAsOf(ctx context.Context, t time.Time, f func(repos.Repository) error) error
+}
@@ -0,0 +1,35 @@
+package scd
+
+import (
+	"context"
+
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+)
+
+// ConflictPolicy decides which of the entities intersecting an
+// OperationalIntent being upserted in a state requiring a key its manager
+// must provide the OVNs of, so that regional rules may be implemented
+// without changing the handlers: e.g., letting priority flights be planned
+// without the OVNs of the OperationalIntents of lower priority.
+type ConflictPolicy interface {
+	// Resolve returns the subsets of ops and constraints whose OVNs must be
+	// in the key of the upsert of op, or an error rejecting op. ops and
+	// constraints are the entities intersecting op, read in the transaction
+	// of the upsert, including the current version of op if any; op is the
+	// version being upserted, whose manager is the caller.
+	Resolve(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error)
+}
+
+// ConflictPolicyFunc is a ConflictPolicy implemented by a function.
+type ConflictPolicyFunc func(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error)
+
+// Resolve implements ConflictPolicy.
+func (f ConflictPolicyFunc) Resolve(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error) {
+	return f(ctx, op, ops, constraints)
+}
+
+// RequireAllOVNs is the ConflictPolicy of ASTM F3548-21, requiring the OVNs
+// of every intersecting entity.
+var RequireAllOVNs ConflictPolicy = ConflictPolicyFunc(func(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error) {
+	return ops, constraints, nil
+})
@@ -4,19 +4,36 @@ import (
 	"context"
 	"database/sql"
 
-	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	"github.com/interuss/dss/pkg/auth"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/dss/pkg/idempotency"
+	"github.com/interuss/dss/pkg/logging"
 	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/restrictions"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
+// setConstraintTypes lists the types of constraints in the response headers,
+// since ConstraintReferences have no field for them.
+func setConstraintTypes(ctx context.Context, constraints ...*scdmodels.Constraint) {
+	if err := grpc.SetHeader(ctx, scdmodels.ConstraintTypesMetadata(constraints...)); err != nil {
+		logging.WithValuesFromContext(ctx, logging.Logger).Warn("Error setting constraint types header", zap.Error(err))
+	}
+}
+
 // DeleteConstraintReference deletes a single constraint ref for a given ID at
 // the specified version.
 func (a *Server) DeleteConstraintReference(ctx context.Context, req *scdpb.DeleteConstraintReferenceRequest) (*scdpb.ChangeConstraintReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.DeleteConstraintReference")
+	defer span.End()
+
 	// Retrieve Constraint ID
 	id, err := dssmodels.IDFromString(req.GetEntityid())
 	if err != nil {
@@ -29,7 +46,10 @@ func (a *Server) DeleteConstraintReference(ctx context.Context, req *scdpb.Delet
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
 	}
 
-	var response *scdpb.ChangeConstraintReferenceResponse
+	var (
+		response *scdpb.ChangeConstraintReferenceResponse
+		deleted  *scdmodels.Constraint
+	)
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		// Make sure deletion request is valid
 		old, err := r.GetConstraint(ctx, id)
@@ -43,42 +63,21 @@ func (a *Server) DeleteConstraintReference(ctx context.Context, req *scdpb.Delet
 				"Constraint owned by %s, but %s attempted to delete", old.Manager, manager)
 		}
 
-		// Find Subscriptions that may overlap the Constraint's Volume4D
-		allsubs, err := r.SearchSubscriptions(ctx, &dssmodels.Volume4D{
-			StartTime: old.StartTime,
-			EndTime:   old.EndTime,
-			SpatialVolume: &dssmodels.Volume3D{
-				AltitudeHi: old.AltitudeUpper,
-				AltitudeLo: old.AltitudeLower,
-				Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
-					return old.Cells, nil
-				}),
-			}})
-		if err != nil {
-			return stacktrace.Propagate(err, "Unable to search Subscriptions in repo")
-		}
-
-		// Limit Subscription notifications to only those interested in Constraints
-		var subs repos.Subscriptions
-		for _, sub := range allsubs {
-			if sub.NotifyForConstraints {
-				subs = append(subs, sub)
-			}
-		}
-
 		// Delete Constraint in repo
 		err = r.DeleteConstraint(ctx, id)
 		if err != nil {
 			return stacktrace.Propagate(err, "Unable to delete Constraint from repo")
 		}
 
-		// Increment notification indices for relevant Subscriptions
-		err = subs.IncrementNotificationIndices(ctx, r)
+		// Increment notification indices for Subscriptions that may overlap
+		// the Constraint's Volume4D
+		subs, err := r.NotifySubscriptions(ctx, old.Volume4D(), scdmodels.SubscriptionFilter{NotifyForConstraints: true})
 		if err != nil {
-			return stacktrace.Propagate(err, "Unable to increment notification indices")
+			return stacktrace.Propagate(err, "Unable to notify Subscriptions in repo")
 		}
 
 		// Convert deleted Constraint to proto
+		deleted = old
 		constraintProto, err := old.ToProto()
 		if err != nil {
 			return stacktrace.Propagate(err, "Could not convert Constraint to proto")
@@ -97,12 +96,16 @@ func (a *Server) DeleteConstraintReference(ctx context.Context, req *scdpb.Delet
 	if err != nil {
 		return nil, err // No need to Propagate this error as this is not a useful stacktrace line
 	}
+	setConstraintTypes(ctx, deleted)
 
 	return response, nil
 }
 
 // GetConstraintReference returns a single constraint ref for the given ID.
 func (a *Server) GetConstraintReference(ctx context.Context, req *scdpb.GetConstraintReferenceRequest) (*scdpb.GetConstraintReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.GetConstraintReference")
+	defer span.End()
+
 	id, err := dssmodels.IDFromString(req.GetEntityid())
 	if err != nil {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid ID format: `%s`", req.GetEntityid())
@@ -113,7 +116,10 @@ func (a *Server) GetConstraintReference(ctx context.Context, req *scdpb.GetConst
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
 	}
 
-	var response *scdpb.GetConstraintReferenceResponse
+	var (
+		response *scdpb.GetConstraintReferenceResponse
+		found    *scdmodels.Constraint
+	)
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		constraint, err := r.GetConstraint(ctx, id)
 		switch {
@@ -126,6 +132,7 @@ func (a *Server) GetConstraintReference(ctx context.Context, req *scdpb.GetConst
 		if constraint.Manager != manager {
 			constraint.OVN = scdmodels.OVN(scdmodels.NoOvnPhrase)
 		}
+		found = constraint
 
 		// Convert retrieved Constraint to proto
 		p, err := constraint.ToProto()
@@ -145,6 +152,7 @@ func (a *Server) GetConstraintReference(ctx context.Context, req *scdpb.GetConst
 	if err != nil {
 		return nil, err // No need to Propagate this error as this is not a useful stacktrace line
 	}
+	setConstraintTypes(ctx, found)
 
 	return response, nil
 }
@@ -160,6 +168,9 @@ func (a *Server) UpdateConstraintReference(ctx context.Context, req *scdpb.Updat
 // PutConstraintReference inserts or updates a Constraint.
 // If the ovn argument is empty (""), it will attempt to create a new Constraint.
 func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ovn string, params *scdpb.PutConstraintReferenceParameters) (*scdpb.ChangeConstraintReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.PutConstraintReference")
+	defer span.End()
+
 	id, err := dssmodels.IDFromString(entityid)
 
 	if err != nil {
@@ -172,6 +183,17 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
 	}
 
+	if ovn == "" {
+		if err := a.IDs.Claim(ctx, id, dssmodels.Owner(manager)); err != nil {
+			return nil, err // No need to Propagate this error as this stack layer does not add useful information
+		}
+	}
+
+	constraintType, err := scdmodels.ConstraintTypeFromContext(ctx)
+	if err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+
 	var extents = make([]*dssmodels.Volume4D, len(params.GetExtents()))
 
 	if len(params.UssBaseUrl) == 0 {
@@ -209,10 +231,23 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 	if err != nil {
 		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid area")
 	}
+	if err := a.Limits.Check(cells, uExtent.StartTime, uExtent.EndTime, uExtent.SpatialVolume.AltitudeLo, uExtent.SpatialVolume.AltitudeHi); err != nil {
+		return nil, stacktrace.Propagate(err, "Constraint exceeds limits")
+	}
+	if err := restrictions.Default.Check(events.KindConstraint, manager.String(), cells); err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
 
-	var response *scdpb.ChangeConstraintReferenceResponse
+	var (
+		response *scdpb.ChangeConstraintReferenceResponse
+		upserted *scdmodels.Constraint
+	)
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		var version int32 // Version of the Constraint (0 means creation requested).
+		ctype := constraintType
+		if ctype == "" {
+			ctype = scdmodels.ConstraintTypeRestriction
+		}
 
 		// Get existing Constraint, if any, and validate request
 		old, err := r.GetConstraint(ctx, id)
@@ -236,6 +271,9 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 					"Current version is %s but client specified version %s", old.OVN, ovn)
 			}
 			version = int32(old.Version)
+			if constraintType == "" {
+				ctype = old.Type
+			}
 		}
 
 		// Compute total affected Volume4D for notification purposes
@@ -243,17 +281,7 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 		if old == nil {
 			notifyVol4 = uExtent
 		} else {
-			oldVol4 := &dssmodels.Volume4D{
-				StartTime: old.StartTime,
-				EndTime:   old.EndTime,
-				SpatialVolume: &dssmodels.Volume3D{
-					AltitudeHi: old.AltitudeUpper,
-					AltitudeLo: old.AltitudeLower,
-					Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
-						return old.Cells, nil
-					}),
-				}}
-			notifyVol4, err = dssmodels.UnionVolumes4D(uExtent, oldVol4)
+			notifyVol4, err = dssmodels.UnionVolumes4D(uExtent, old.Volume4D())
 			if err != nil {
 				return stacktrace.Propagate(err, "Error constructing 4D volumes union")
 			}
@@ -263,41 +291,33 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 		constraint, err := r.UpsertConstraint(ctx, &scdmodels.Constraint{
 			ID:      id,
 			Manager: manager,
+			Type:    ctype,
 			Version: scdmodels.VersionNumber(version + 1),
 
-			StartTime:     uExtent.StartTime,
-			EndTime:       uExtent.EndTime,
-			AltitudeLower: uExtent.SpatialVolume.AltitudeLo,
-			AltitudeUpper: uExtent.SpatialVolume.AltitudeHi,
+			StartTime:         uExtent.StartTime,
+			EndTime:           uExtent.EndTime,
+			AltitudeLower:     uExtent.SpatialVolume.AltitudeLo,
+			AltitudeUpper:     uExtent.SpatialVolume.AltitudeHi,
+			AltitudeReference: uExtent.SpatialVolume.AltitudeReference,
 
 			USSBaseURL: params.UssBaseUrl,
 			Cells:      cells,
+			Footprint:  uExtent.SpatialVolume.Footprint,
 		})
 		if err != nil {
 			return err
 		}
 
-		// Find Subscriptions that may need to be notified
-		allsubs, err := r.SearchSubscriptions(ctx, notifyVol4)
-		if err != nil {
-			return err
-		}
-
-		// Limit Subscription notifications to only those interested in Constraints
-		var subs repos.Subscriptions
-		for _, sub := range allsubs {
-			if sub.NotifyForConstraints {
-				subs = append(subs, sub)
-			}
-		}
-
-		// Increment notification indices for relevant Subscriptions
-		err = subs.IncrementNotificationIndices(ctx, r)
+		// Increment notification indices for Subscriptions that may need to
+		// be notified, limited to those interested in Constraints, found by
+		// the same statement
+		subs, err := r.NotifySubscriptions(ctx, notifyVol4, scdmodels.SubscriptionFilter{NotifyForConstraints: true})
 		if err != nil {
 			return err
 		}
 
 		// Convert upserted Constraint to proto
+		upserted = constraint
 		p, err := constraint.ToProto()
 		if err != nil {
 			return err
@@ -308,6 +328,7 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 			ConstraintReference: p,
 			Subscribers:         makeSubscribersToNotify(subs),
 		}
+		idempotency.Respond(ctx, response)
 
 		return nil
 	}
@@ -316,13 +337,17 @@ func (a *Server) PutConstraintReference(ctx context.Context, entityid string, ov
 	if err != nil {
 		return nil, err // No need to Propagate this error as this is not a useful stacktrace line
 	}
+	setConstraintTypes(ctx, upserted)
 
 	return response, nil
 }
 
 // QueryConstraintReferences queries existing contraint refs in the given
-// bounds.
+// bounds, of the types requested in the ConstraintTypesHeader if any.
 func (a *Server) QueryConstraintReferences(ctx context.Context, req *scdpb.QueryConstraintReferencesRequest) (*scdpb.QueryConstraintReferencesResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.QueryConstraintReferences")
+	defer span.End()
+
 	// Retrieve the area of interest parameter
 	aoi := req.GetParams().AreaOfInterest
 	if aoi == nil {
@@ -341,13 +366,22 @@ func (a *Server) QueryConstraintReferences(ctx context.Context, req *scdpb.Query
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
 	}
 
-	var response *scdpb.QueryConstraintReferencesResponse
+	filter, err := scdmodels.ConstraintFilterFromContext(ctx)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Invalid search filter")
+	}
+
+	var (
+		response *scdpb.QueryConstraintReferencesResponse
+		found    []*scdmodels.Constraint
+	)
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		// Perform search query on Store
-		constraints, err := r.SearchConstraints(ctx, vol4)
+		constraints, err := r.SearchConstraints(ctx, vol4, filter)
 		if err != nil {
 			return err
 		}
+		found = constraints
 
 		// Create response for client
 		response = &scdpb.QueryConstraintReferencesResponse{}
@@ -365,10 +399,17 @@ func (a *Server) QueryConstraintReferences(ctx context.Context, req *scdpb.Query
 		return nil
 	}
 
-	err = a.Store.Transact(ctx, action)
+	// The search writes nothing, so it is served outside of a transaction
+	// where Stores may cache its results.
+	r, err := a.Store.Interact(ctx)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to interact with store")
+	}
+	err = action(ctx, r)
 	if err != nil {
 		return nil, err // No need to Propagate this error as this is not a useful stacktrace line
 	}
+	setConstraintTypes(ctx, found...)
 
 	return response, nil
 }
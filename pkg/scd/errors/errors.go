@@ -1,10 +1,13 @@
 package errors
 
 import (
+	"strings"
+
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	dsserrors "github.com/interuss/dss/pkg/errors"
 	dssmodels "github.com/interuss/dss/pkg/scd/models"
 	"github.com/interuss/stacktrace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 )
@@ -22,7 +25,9 @@ func MissingOVNsErrorResponse(missingOps []*dssmodels.OperationalIntent, missing
 	detail := &scdpb.AirspaceConflictResponse{
 		Message: errMessageMissingOVNs,
 	}
+	var missingOpIDs, missingConstraintIDs []string
 	for _, missingOp := range missingOps {
+		missingOpIDs = append(missingOpIDs, missingOp.ID.String())
 		opRef, err := missingOp.ToProto()
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting missing OperationalIntent to proto")
@@ -30,6 +35,7 @@ func MissingOVNsErrorResponse(missingOps []*dssmodels.OperationalIntent, missing
 		detail.MissingOperationalIntents = append(detail.MissingOperationalIntents, opRef)
 	}
 	for _, missingConstraint := range missingConstraints {
+		missingConstraintIDs = append(missingConstraintIDs, missingConstraint.ID.String())
 		constraintRef, err := missingConstraint.ToProto()
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting missing Constraint to proto")
@@ -37,7 +43,18 @@ func MissingOVNsErrorResponse(missingOps []*dssmodels.OperationalIntent, missing
 		detail.MissingConstraints = append(detail.MissingConstraints, constraintRef)
 	}
 
-	p, err := dsserrors.MakeStatusProto(codes.Code(uint16(dsserrors.MissingOVNs)), errMessageMissingOVNs, detail)
+	// The IDs of the conflicting entities are repeated in an ErrorInfo so
+	// that gRPC clients may handle missing OVNs like any other error.
+	info := &errdetails.ErrorInfo{
+		Reason: dsserrors.Reason(dsserrors.MissingOVNs),
+		Domain: dsserrors.ErrorDomain,
+		Metadata: map[string]string{
+			"missing_operational_intents": strings.Join(missingOpIDs, ","),
+			"missing_constraints":         strings.Join(missingConstraintIDs, ","),
+		},
+	}
+
+	p, err := dsserrors.MakeStatusProto(codes.Code(uint16(dsserrors.MissingOVNs)), errMessageMissingOVNs, detail, info)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error adding AirspaceConflictResponse detail to Status")
 	}
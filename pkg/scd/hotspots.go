@@ -0,0 +1,96 @@
+package scd
+
+import (
+	"context"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/hotspot"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+)
+
+// NewHotspotStore returns a Store recording the writes to the entities of s
+// to tracker. The writes of a transaction are recorded once it commits.
+// It returns s itself if tracker is nil.
+func NewHotspotStore(s scdstore.Store, tracker *hotspot.Tracker) scdstore.Store {
+	if tracker == nil {
+		return s
+	}
+	return &hotspotStore{Store: s, tracker: tracker}
+}
+
+type hotspotStore struct {
+	scdstore.Store
+	tracker *hotspot.Tracker
+}
+
+// hotspotWrite is a write to an entity not yet recorded.
+type hotspotWrite struct {
+	kind    string
+	id      string
+	manager string
+	cells   s2.CellUnion
+}
+
+func (s *hotspotStore) flush(writes []hotspotWrite) {
+	for _, w := range writes {
+		s.tracker.Record(w.kind, w.id, w.manager, w.cells)
+	}
+}
+
+// Interact implements scdstore.Interactor.
+func (s *hotspotStore) Interact(ctx context.Context) (repos.Repository, error) {
+	repo, err := s.Store.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &hotspotRepo{Repository: repo, record: func(w hotspotWrite) {
+		s.flush([]hotspotWrite{w})
+	}}, nil
+}
+
+// Transact implements scdstore.Transactor. Only the writes of the attempt
+// which committed are recorded.
+func (s *hotspotStore) Transact(ctx context.Context, f func(context.Context, repos.Repository) error) error {
+	var writes []hotspotWrite
+	err := s.Store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		writes = nil
+		return f(ctx, &hotspotRepo{Repository: repo, record: func(w hotspotWrite) {
+			writes = append(writes, w)
+		}})
+	})
+	if err == nil {
+		s.flush(writes)
+	}
+	return err
+}
+
+type hotspotRepo struct {
+	repos.Repository
+	record func(hotspotWrite)
+}
+
+func (r *hotspotRepo) UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent, previous scdmodels.OVN) (*scdmodels.OperationalIntent, error) {
+	upserted, err := r.Repository.UpsertOperationalIntent(ctx, operation, previous)
+	if err == nil {
+		r.record(hotspotWrite{hotspot.KindOperationalIntent, operation.ID.String(), operation.Manager.String(), operation.Cells})
+	}
+	return upserted, err
+}
+
+func (r *hotspotRepo) UpsertSubscription(ctx context.Context, sub *scdmodels.Subscription, previous scdmodels.OVN) (*scdmodels.Subscription, error) {
+	upserted, err := r.Repository.UpsertSubscription(ctx, sub, previous)
+	if err == nil {
+		r.record(hotspotWrite{hotspot.KindSCDSubscription, sub.ID.String(), sub.Manager.String(), sub.Cells})
+	}
+	return upserted, err
+}
+
+func (r *hotspotRepo) UpsertConstraint(ctx context.Context, constraint *scdmodels.Constraint) (*scdmodels.Constraint, error) {
+	upserted, err := r.Repository.UpsertConstraint(ctx, constraint)
+	if err == nil {
+		r.record(hotspotWrite{hotspot.KindConstraint, constraint.ID.String(), constraint.Manager.String(), constraint.Cells})
+	}
+	return upserted, err
+}
@@ -0,0 +1,65 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/hotspot"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotspotStore(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		clock   = clockwork.NewFakeClock()
+		tracker = hotspot.NewTracker(clock, hotspot.DefaultLevel, time.Hour)
+		store   = NewHotspotStore(scdmemory.NewStore(clock), tracker)
+		start   = clock.Now()
+		end     = start.Add(time.Hour)
+		cell    = s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)
+	)
+	upsert := func(ctx context.Context, r repos.Repository) error {
+		_, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:         dssmodels.ID(uuid.New().String()),
+			Manager:    "uss1",
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss1.example.com",
+			Cells:      s2.CellUnion{cell},
+		}, "")
+		return err
+	}
+
+	// The writes of transactions rolled back are not recorded.
+	require.Error(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		require.NoError(t, upsert(ctx, r))
+		return errors.New("rolled back")
+	}))
+	require.Empty(t, tracker.Top(0))
+
+	require.NoError(t, store.Transact(ctx, upsert))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	require.NoError(t, upsert(ctx, repo))
+
+	top := tracker.Top(0)
+	require.Len(t, top, 1)
+	require.Equal(t, int64(2), top[0].Writes)
+	require.Equal(t, 2, top[0].Entities)
+	require.Equal(t, []hotspot.ManagerWrites{{Manager: "uss1", Writes: 2}}, top[0].TopManagers)
+}
+
+func TestHotspotStoreDisabled(t *testing.T) {
+	store := scdmemory.NewStore(clockwork.NewFakeClock())
+	require.Equal(t, scdstore.Store(store), NewHotspotStore(store, nil))
+}
@@ -0,0 +1,143 @@
+package scd
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+)
+
+// The functions in this file manage the lifecycle of implicit Subscriptions:
+// an implicit Subscription is created when an OperationalIntent is created
+// without a Subscription, always covers exactly the OperationalIntents
+// depending on it, and is removed along with the last of them.  They must be
+// called from within the transaction modifying the dependent
+// OperationalIntents.
+
+// createImplicitSubscription creates a new implicit Subscription "id" on
+// behalf of manager covering "extent" and "cells".
+func createImplicitSubscription(ctx context.Context, r repos.Repository, id dssmodels.ID, manager dssmodels.Manager, params *scdpb.ImplicitSubscriptionParameters, extent *dssmodels.Volume4D, cells s2.CellUnion) (*scdmodels.Subscription, error) {
+	if err := scdmodels.ValidateUSSBaseURL(params.GetUssBaseUrl()); err != nil {
+		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Failed to validate USS base URL")
+	}
+
+	sub, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:                          id,
+		Manager:                     manager,
+		StartTime:                   extent.StartTime,
+		EndTime:                     extent.EndTime,
+		AltitudeLo:                  extent.SpatialVolume.AltitudeLo,
+		AltitudeHi:                  extent.SpatialVolume.AltitudeHi,
+		Cells:                       cells,
+		USSBaseURL:                  params.GetUssBaseUrl(),
+		NotifyForOperationalIntents: true,
+		NotifyForConstraints:        params.GetNotifyForConstraints(),
+		ImplicitSubscription:        true,
+	}, "")
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to create implicit Subscription")
+	}
+	return sub, nil
+}
+
+// fitImplicitSubscription grows or shrinks the implicit Subscription
+// identified by "id" so that it covers exactly its dependent
+// OperationalIntents, and deletes it if there are none left.  It does nothing
+// if the Subscription is not implicit.
+func fitImplicitSubscription(ctx context.Context, r repos.Repository, id dssmodels.ID) error {
+	sub, err := r.GetSubscription(ctx, id)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to get Subscription %s", id)
+	}
+	if sub == nil || !sub.ImplicitSubscription {
+		return nil
+	}
+
+	dependentIDs, err := r.GetDependentOperationalIntents(ctx, id)
+	if err != nil {
+		return stacktrace.Propagate(err, "Could not find dependent OperationalIntents of Subscription %s", id)
+	}
+	if len(dependentIDs) == 0 {
+		if err := r.DeleteSubscription(ctx, id); err != nil {
+			return stacktrace.Propagate(err, "Unable to delete unused implicit Subscription %s", id)
+		}
+		return nil
+	}
+
+	dependentOps := make([]*scdmodels.OperationalIntent, 0, len(dependentIDs))
+	for _, opID := range dependentIDs {
+		op, err := r.GetOperationalIntent(ctx, opID)
+		if err != nil {
+			return stacktrace.Propagate(err, "Unable to get dependent OperationalIntent %s", opID)
+		}
+		if op != nil {
+			dependentOps = append(dependentOps, op)
+		}
+	}
+
+	changed, err := coverOperationalIntents(sub, dependentOps)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to fit implicit Subscription %s", id)
+	}
+	if !changed {
+		return nil
+	}
+	if _, err := r.UpsertSubscription(ctx, sub, sub.Version); err != nil {
+		return stacktrace.Propagate(err, "Failed to resize implicit Subscription %s", id)
+	}
+	return nil
+}
+
+// coverOperationalIntents sets the extent of sub to the union of the extents
+// of ops and returns true if this changed sub.
+func coverOperationalIntents(sub *scdmodels.Subscription, ops []*scdmodels.OperationalIntent) (bool, error) {
+	if len(ops) == 0 {
+		return false, nil
+	}
+
+	extent := ops[0].Volume4D()
+	for _, op := range ops[1:] {
+		var err error
+		if extent, err = extent.Union(op.Volume4D()); err != nil {
+			return false, stacktrace.Propagate(err, "Failed to union the extents of OperationalIntents")
+		}
+	}
+	cells, err := extent.CalculateSpatialCovering()
+	if err != nil {
+		return false, stacktrace.Propagate(err, "Failed to compute the covering of OperationalIntents")
+	}
+	cells = s2.CellUnionFromUnion(cells)
+
+	changed := !equalTimes(sub.StartTime, extent.StartTime) ||
+		!equalTimes(sub.EndTime, extent.EndTime) ||
+		!equalAltitudes(sub.AltitudeLo, extent.SpatialVolume.AltitudeLo) ||
+		!equalAltitudes(sub.AltitudeHi, extent.SpatialVolume.AltitudeHi) ||
+		!sub.Cells.Equal(cells)
+
+	sub.StartTime = extent.StartTime
+	sub.EndTime = extent.EndTime
+	sub.AltitudeLo = extent.SpatialVolume.AltitudeLo
+	sub.AltitudeHi = extent.SpatialVolume.AltitudeHi
+	sub.Cells = cells
+	return changed, nil
+}
+
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func equalAltitudes(a, b *float32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
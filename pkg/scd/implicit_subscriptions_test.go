@@ -0,0 +1,51 @@
+package scd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverOperationalIntents(t *testing.T) {
+	var (
+		t0     = time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+		t1     = t0.Add(time.Hour)
+		t2     = t0.Add(2 * time.Hour)
+		lo     = float32(10)
+		mid    = float32(50)
+		hi     = float32(100)
+		cellA  = s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.5, 6.5)).Parent(13)
+		cellB  = s2.CellIDFromLatLng(s2.LatLngFromDegrees(47.5, 8.5)).Parent(13)
+		opLow  = &scdmodels.OperationalIntent{StartTime: &t0, EndTime: &t1, AltitudeLower: &lo, AltitudeUpper: &mid, Cells: s2.CellUnion{cellA}}
+		opHigh = &scdmodels.OperationalIntent{StartTime: &t1, EndTime: &t2, AltitudeLower: &mid, AltitudeUpper: &hi, Cells: s2.CellUnion{cellB}}
+	)
+
+	sub := &scdmodels.Subscription{ImplicitSubscription: true}
+	requireCovered(t, true, sub, []*scdmodels.OperationalIntent{opLow, opHigh})
+	require.Equal(t, t0, *sub.StartTime)
+	require.Equal(t, t2, *sub.EndTime)
+	require.Equal(t, lo, *sub.AltitudeLo)
+	require.Equal(t, hi, *sub.AltitudeHi)
+	require.True(t, sub.Cells.ContainsCellID(cellA))
+	require.True(t, sub.Cells.ContainsCellID(cellB))
+
+	// Covering the same OperationalIntents again does not change anything.
+	requireCovered(t, false, sub, []*scdmodels.OperationalIntent{opHigh, opLow})
+
+	// Removing a dependent OperationalIntent shrinks the Subscription.
+	requireCovered(t, true, sub, []*scdmodels.OperationalIntent{opHigh})
+	require.Equal(t, t1, *sub.StartTime)
+	require.Equal(t, mid, *sub.AltitudeLo)
+	require.False(t, sub.Cells.ContainsCellID(cellA))
+
+	requireCovered(t, false, sub, nil)
+}
+
+func requireCovered(t *testing.T, changed bool, sub *scdmodels.Subscription, ops []*scdmodels.OperationalIntent) {
+	got, err := coverOperationalIntents(sub, ops)
+	require.NoError(t, err)
+	require.Equal(t, changed, got)
+}
@@ -4,17 +4,35 @@ import (
 	"time"
 
 	"github.com/golang/geo/s2"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	"github.com/interuss/stacktrace"
 )
 
+// ConstraintType is the kind of a Constraint, by which USSs prioritize the
+// constraint providers to query for the details of the Constraints.
+type ConstraintType string
+
+const (
+	// ConstraintTypeRestriction Constraints restrict the airspace they cover.
+	// It is the type of the Constraints created without a type.
+	ConstraintTypeRestriction ConstraintType = "restriction"
+	// ConstraintTypeAdvisory Constraints only advise of conditions in the
+	// airspace they cover.
+	ConstraintTypeAdvisory ConstraintType = "advisory"
+)
+
+// IsValid returns true if t is a known ConstraintType.
+func (t ConstraintType) IsValid() bool {
+	return t == ConstraintTypeRestriction || t == ConstraintTypeAdvisory
+}
+
 // Constraint models a constraint, as known by the DSS
 type Constraint struct {
 	ID              dssmodels.ID
 	Manager         dssmodels.Manager
+	Type            ConstraintType
 	UssAvailability UssAvailabilityState
 	Version         VersionNumber
 	OVN             OVN
@@ -24,6 +42,15 @@ type Constraint struct {
 	AltitudeLower   *float32
 	AltitudeUpper   *float32
 	Cells           s2.CellUnion
+	// AltitudeReference is the vertical datum AltitudeLower and AltitudeUpper
+	// were submitted in, as dssmodels.Volume3D.AltitudeReference.
+	AltitudeReference string
+	// UpdatedAt is when this version was written, from which OVN derives.
+	// It is set by stores.
+	UpdatedAt time.Time
+	// Footprint, if known, is the exact shape Cells cover. It is not read
+	// back from stores.
+	Footprint dssmodels.Geometry
 }
 
 // ToProto converts the Constraint to its proto API format
@@ -38,7 +65,7 @@ func (c *Constraint) ToProto() (*scdpb.ConstraintReference, error) {
 	}
 
 	if c.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*c.StartTime)
+		ts, err := dssmodels.TimestampProto(*c.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -49,7 +76,7 @@ func (c *Constraint) ToProto() (*scdpb.ConstraintReference, error) {
 	}
 
 	if c.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*c.EndTime)
+		ts, err := dssmodels.TimestampProto(*c.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -62,6 +89,57 @@ func (c *Constraint) ToProto() (*scdpb.ConstraintReference, error) {
 	return result, nil
 }
 
+// MarshalJSON encodes c in the wire format of ConstraintReferences.
+func (c *Constraint) MarshalJSON() ([]byte, error) {
+	p, err := c.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.MarshalAPIJSON(p)
+}
+
+// UnmarshalJSON decodes the fields of c held by ConstraintReferences from
+// their wire format.
+func (c *Constraint) UnmarshalJSON(data []byte) error {
+	p := &scdpb.ConstraintReference{}
+	if err := dssmodels.UnmarshalAPIJSON(data, p); err != nil {
+		return err
+	}
+	startTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeStart().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time from proto")
+	}
+	endTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeEnd().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time from proto")
+	}
+	c.ID = dssmodels.ID(p.GetId())
+	c.OVN = OVN(p.GetOvn())
+	c.Manager = dssmodels.Manager(p.GetManager())
+	c.Version = VersionNumber(p.GetVersion())
+	c.UssAvailability = UssAvailabilityState(p.GetUssAvailability())
+	c.USSBaseURL = p.GetUssBaseUrl()
+	c.StartTime = startTime
+	c.EndTime = endTime
+	return nil
+}
+
+// Volume4D returns the extent of c.
+func (c *Constraint) Volume4D() *dssmodels.Volume4D {
+	return &dssmodels.Volume4D{
+		StartTime: c.StartTime,
+		EndTime:   c.EndTime,
+		SpatialVolume: &dssmodels.Volume3D{
+			AltitudeLo:        c.AltitudeLower,
+			AltitudeHi:        c.AltitudeUpper,
+			AltitudeReference: c.AltitudeReference,
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return c.Cells, nil
+			}),
+		},
+	}
+}
+
 // ValidateTimeRange validates the time range of c.
 func (c *Constraint) ValidateTimeRange() error {
 	if c.StartTime == nil {
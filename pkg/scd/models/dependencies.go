@@ -0,0 +1,30 @@
+package models
+
+import (
+	dssmodels "github.com/interuss/dss/pkg/models"
+)
+
+// SubscriptionDependencies are the OperationalIntents depending on a
+// Subscription, which must not be deleted while they do.
+type SubscriptionDependencies struct {
+	SubscriptionID dssmodels.ID `json:"subscription_id"`
+	// Exists is false if the Subscription does not exist, the references of
+	// its dependent OperationalIntents dangling, and Manager is empty then.
+	Exists                      bool              `json:"exists"`
+	Manager                     dssmodels.Manager `json:"manager,omitempty"`
+	DependentOperationalIntents []dssmodels.ID    `json:"dependent_operational_intents"`
+}
+
+// OperationalIntentDependencies are the references of an OperationalIntent to
+// Subscriptions.
+type OperationalIntentDependencies struct {
+	OperationalIntentID dssmodels.ID      `json:"operational_intent_id"`
+	Manager             dssmodels.Manager `json:"manager"`
+	// SubscriptionID identifies the Subscription the OperationalIntent
+	// depends on, if any, and SubscriptionExists whether it still exists.
+	SubscriptionID     dssmodels.ID `json:"subscription_id,omitempty"`
+	SubscriptionExists bool         `json:"subscription_exists"`
+	// NotifiedSubscriptions are the Subscriptions notified of the changes to
+	// the OperationalIntent: those for operational intents intersecting it.
+	NotifiedSubscriptions []dssmodels.ID `json:"notified_subscriptions"`
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// StatesHeader is the request header (gRPC metadata key) through which
+	// clients restrict searches of OperationalIntents to a comma-separated
+	// list of states, e.g. "Activated,Nonconforming".
+	StatesHeader = "x-dss-states"
+
+	// ManagersHeader is the request header (gRPC metadata key) through which
+	// clients restrict searches of OperationalIntents to a comma-separated
+	// list of managers.
+	ManagersHeader = "x-dss-managers"
+
+	// ConstraintTypeHeader is the request header (gRPC metadata key) through
+	// which clients set the ConstraintType of the Constraints they create or
+	// update. Constraints are created as restrictions and keep their type
+	// through updates without it.
+	ConstraintTypeHeader = "x-dss-constraint-type"
+
+	// ConstraintTypesHeader is the request header (gRPC metadata key) through
+	// which clients restrict searches of Constraints to a comma-separated list
+	// of ConstraintTypes. It is also the response header listing the type of
+	// each Constraint referenced in a response as comma-separated id=type
+	// pairs, since ConstraintReferences have no field for it.
+	ConstraintTypesHeader = "x-dss-constraint-types"
+)
+
+// OperationalIntentFilter restricts searches of OperationalIntents to the
+// ones in any of States and managed by any of Managers. Empty lists do not
+// restrict searches.
+type OperationalIntentFilter struct {
+	States   []OperationalIntentState
+	Managers []dssmodels.Manager
+}
+
+// Matches returns true if op passes f.
+func (f OperationalIntentFilter) Matches(op *OperationalIntent) bool {
+	if len(f.States) > 0 {
+		found := false
+		for _, s := range f.States {
+			found = found || s == op.State
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Managers) > 0 {
+		found := false
+		for _, m := range f.Managers {
+			found = found || m == op.Manager
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// OperationalIntentFilterFromContext returns the OperationalIntentFilter
+// requested through the StatesHeader and ManagersHeader of the incoming
+// request in ctx.
+func OperationalIntentFilterFromContext(ctx context.Context) (OperationalIntentFilter, error) {
+	var f OperationalIntentFilter
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return f, nil
+	}
+	for _, s := range headerValues(md, StatesHeader) {
+		state := OperationalIntentState(s)
+		if !state.IsValidInDSS() {
+			return f, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid state %s in %s", s, StatesHeader)
+		}
+		f.States = append(f.States, state)
+	}
+	for _, m := range headerValues(md, ManagersHeader) {
+		f.Managers = append(f.Managers, dssmodels.Manager(m))
+	}
+	return f, nil
+}
+
+// headerValues returns the non-empty comma-separated values of key in md.
+func headerValues(md metadata.MD, key string) []string {
+	var result []string
+	for _, v := range md.Get(key) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// ConstraintFilter restricts searches of Constraints to the ones of any of
+// Types. An empty list does not restrict searches.
+type ConstraintFilter struct {
+	Types []ConstraintType
+}
+
+// Matches returns true if c passes f.
+func (f ConstraintFilter) Matches(c *Constraint) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == c.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// ConstraintFilterFromContext returns the ConstraintFilter requested through
+// the ConstraintTypesHeader of the incoming request in ctx.
+func ConstraintFilterFromContext(ctx context.Context) (ConstraintFilter, error) {
+	var f ConstraintFilter
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return f, nil
+	}
+	for _, s := range headerValues(md, ConstraintTypesHeader) {
+		t := ConstraintType(s)
+		if !t.IsValid() {
+			return f, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid constraint type %s in %s", s, ConstraintTypesHeader)
+		}
+		f.Types = append(f.Types, t)
+	}
+	return f, nil
+}
+
+// ConstraintTypeFromContext returns the ConstraintType requested through the
+// ConstraintTypeHeader of the incoming request in ctx, or an empty
+// ConstraintType if there is none.
+func ConstraintTypeFromContext(ctx context.Context) (ConstraintType, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	vs := headerValues(md, ConstraintTypeHeader)
+	if len(vs) == 0 {
+		return "", nil
+	}
+	t := ConstraintType(vs[0])
+	if len(vs) > 1 || !t.IsValid() {
+		return "", stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid constraint type %s in %s", strings.Join(vs, ","), ConstraintTypeHeader)
+	}
+	return t, nil
+}
+
+// ConstraintTypesMetadata returns the response metadata listing the type of
+// each of constraints in the ConstraintTypesHeader.
+func ConstraintTypesMetadata(constraints ...*Constraint) metadata.MD {
+	pairs := make([]string, len(constraints))
+	for i, c := range constraints {
+		pairs[i] = c.ID.String() + "=" + string(c.Type)
+	}
+	return metadata.Pairs(ConstraintTypesHeader, strings.Join(pairs, ","))
+}
+
+// SubscriptionFilter restricts searches of Subscriptions to the ones notified
+// of changes to OperationalIntents if NotifyForOperationalIntents, and to the
+// ones notified of changes to Constraints if NotifyForConstraints. The zero
+// value does not restrict searches.
+type SubscriptionFilter struct {
+	NotifyForOperationalIntents bool
+	NotifyForConstraints        bool
+}
+
+// Matches returns true if sub passes f.
+func (f SubscriptionFilter) Matches(sub *Subscription) bool {
+	return (!f.NotifyForOperationalIntents || sub.NotifyForOperationalIntents) &&
+		(!f.NotifyForConstraints || sub.NotifyForConstraints)
+}
@@ -24,9 +24,25 @@ type (
 	VersionNumber int32
 )
 
-// NewOVNFromTime encodes t as an OVN.
+// NewOVN returns the OVN of the version of the entity identified by salt
+// written at timestamp, the logical timestamp of the cluster at which the
+// transaction writing it commits, following the version previous, empty for
+// the first version. Unlike those of NewOVNFromTime, the OVNs of versions
+// written within the same second or by instances whose clocks are skewed
+// differ.
+func NewOVN(salt string, timestamp string, previous OVN) OVN {
+	return encodeOVN(sha256.Sum256([]byte(salt + "\x00" + timestamp + "\x00" + string(previous))))
+}
+
+// NewOVNFromTime encodes t as an OVN, as the stores did for every version
+// before OVNs were generated by NewOVN.
 func NewOVNFromTime(t time.Time, salt string) OVN {
-	sum := sha256.Sum256([]byte(salt + t.Format(time.RFC3339)))
+	return encodeOVN(sha256.Sum256([]byte(salt + t.Format(time.RFC3339))))
+}
+
+// encodeOVN encodes sum as an OVN, in base64 but for the characters which
+// are not URL-safe.
+func encodeOVN(sum [sha256.Size]byte) OVN {
 	ovn := base64.StdEncoding.EncodeToString(
 		sum[:],
 	)
@@ -36,6 +52,19 @@ func NewOVNFromTime(t time.Time, salt string) OVN {
 	return OVN(ovn)
 }
 
+// TimeOfOVN returns the time within [from, to] from which ovn was encoded
+// with salt, if any, as written by the stores, in UTC. OVNs only depend on
+// the second of their time, so every second of the range is tried. OVNs
+// generated by NewOVN do not encode their time.
+func TimeOfOVN(ovn OVN, salt string, from, to time.Time) (time.Time, bool) {
+	for t := from.UTC().Truncate(time.Second); !t.After(to); t = t.Add(time.Second) {
+		if NewOVNFromTime(t, salt) == ovn {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // Empty returns true if ovn indicates an empty opaque version number.
 func (ovn OVN) Empty() bool {
 	return len(ovn) == 0
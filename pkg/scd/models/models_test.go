@@ -1,13 +1,195 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	dssmodels "github.com/interuss/dss/pkg/models"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestOVNFromTimeIsValid(t *testing.T) {
 	require.True(t, NewOVNFromTime(time.Now(), uuid.New().String()).Valid())
 }
+
+func TestNewOVN(t *testing.T) {
+	var (
+		id  = uuid.New().String()
+		ovn = NewOVN(id, "1697450000123456789.0000000000", "")
+	)
+	require.True(t, ovn.Valid())
+	require.Equal(t, ovn, NewOVN(id, "1697450000123456789.0000000000", ""))
+	// Transactions within the same nanosecond have different logical
+	// timestamps.
+	require.NotEqual(t, ovn, NewOVN(id, "1697450000123456789.0000000001", ""))
+	require.NotEqual(t, ovn, NewOVN(id, "1697450000123456789.0000000000", ovn))
+	require.NotEqual(t, ovn, NewOVN(uuid.New().String(), "1697450000123456789.0000000000", ""))
+}
+
+func TestTimeOfOVN(t *testing.T) {
+	var (
+		id      = uuid.New().String()
+		written = time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+		ovn     = NewOVNFromTime(written.Add(500*time.Millisecond), id)
+	)
+	found, ok := TimeOfOVN(ovn, id, written.Add(-time.Hour), written.Add(time.Hour))
+	require.True(t, ok)
+	require.True(t, written.Equal(found))
+
+	_, ok = TimeOfOVN(ovn, id, written.Add(time.Second), written.Add(time.Hour))
+	require.False(t, ok)
+	_, ok = TimeOfOVN(ovn, uuid.New().String(), written.Add(-time.Hour), written.Add(time.Hour))
+	require.False(t, ok)
+}
+
+func TestOperationalIntentFilterFromContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		StatesHeader, "Activated, Nonconforming",
+		ManagersHeader, "uss1",
+	))
+	f, err := OperationalIntentFilterFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, OperationalIntentFilter{
+		States:   []OperationalIntentState{OperationalIntentStateActivated, OperationalIntentStateNonconforming},
+		Managers: []dssmodels.Manager{"uss1"},
+	}, f)
+
+	require.True(t, f.Matches(&OperationalIntent{State: OperationalIntentStateActivated, Manager: "uss1"}))
+	require.False(t, f.Matches(&OperationalIntent{State: OperationalIntentStateAccepted, Manager: "uss1"}))
+	require.False(t, f.Matches(&OperationalIntent{State: OperationalIntentStateActivated, Manager: "uss2"}))
+	require.True(t, OperationalIntentFilter{}.Matches(&OperationalIntent{State: OperationalIntentStateAccepted}))
+
+	_, err = OperationalIntentFilterFromContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(StatesHeader, "Landed")))
+	require.Error(t, err)
+}
+
+func TestConstraintFilterFromContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		ConstraintTypesHeader, "advisory",
+		ConstraintTypeHeader, "restriction",
+	))
+	f, err := ConstraintFilterFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ConstraintFilter{Types: []ConstraintType{ConstraintTypeAdvisory}}, f)
+	require.True(t, f.Matches(&Constraint{Type: ConstraintTypeAdvisory}))
+	require.False(t, f.Matches(&Constraint{Type: ConstraintTypeRestriction}))
+	require.True(t, ConstraintFilter{}.Matches(&Constraint{Type: ConstraintTypeRestriction}))
+
+	ct, err := ConstraintTypeFromContext(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ConstraintTypeRestriction, ct)
+	ct, err = ConstraintTypeFromContext(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, ct)
+
+	_, err = ConstraintFilterFromContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(ConstraintTypesHeader, "prohibition")))
+	require.Error(t, err)
+	_, err = ConstraintTypeFromContext(metadata.NewIncomingContext(context.Background(), metadata.Pairs(ConstraintTypeHeader, "restriction,advisory")))
+	require.Error(t, err)
+
+	md := ConstraintTypesMetadata(
+		&Constraint{ID: "c1", Type: ConstraintTypeRestriction},
+		&Constraint{ID: "c2", Type: ConstraintTypeAdvisory})
+	require.Equal(t, []string{"c1=restriction,c2=advisory"}, md.Get(ConstraintTypesHeader))
+}
+
+func TestOperationalIntentJSON(t *testing.T) {
+	var (
+		start = time.Date(2022, 1, 1, 10, 0, 0, 123456000, time.UTC)
+		end   = start.Add(time.Hour)
+		op    = &OperationalIntent{
+			ID:             dssmodels.ID(uuid.New().String()),
+			Manager:        "uss1",
+			Version:        2,
+			State:          OperationalIntentStateAccepted,
+			OVN:            NewOVNFromTime(start, "salt"),
+			StartTime:      &start,
+			EndTime:        &end,
+			USSBaseURL:     "https://uss1.example.com",
+			SubscriptionID: dssmodels.ID(uuid.New().String()),
+		}
+	)
+	b, err := json.Marshal(op)
+	require.NoError(t, err)
+	var wire map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &wire))
+	require.Equal(t, op.OVN.String(), wire["ovn"])
+	require.Equal(t, "https://uss1.example.com", wire["uss_base_url"])
+	require.Equal(t, map[string]interface{}{"value": "2022-01-01T10:00:00.123456Z", "format": "RFC3339"}, wire["time_start"])
+
+	decoded := &OperationalIntent{}
+	require.NoError(t, json.Unmarshal(b, decoded))
+	require.Equal(t, op, decoded)
+}
+
+func TestOperationalIntentVolumesIntersect(t *testing.T) {
+	var (
+		start = time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+		box   = func(lat, lng float64, start time.Time) *dssmodels.Volume4D {
+			end := start.Add(10 * time.Minute)
+			return &dssmodels.Volume4D{
+				StartTime: &start,
+				EndTime:   &end,
+				SpatialVolume: &dssmodels.Volume3D{
+					Footprint: &dssmodels.GeoPolygon{Vertices: []*dssmodels.LatLngPoint{
+						{Lat: lat, Lng: lng},
+						{Lat: lat + 0.01, Lng: lng},
+						{Lat: lat + 0.01, Lng: lng + 0.01},
+						{Lat: lat, Lng: lng + 0.01},
+					}},
+				},
+			}
+		}
+		// A trajectory over two places, one after the other.
+		op = &OperationalIntent{State: OperationalIntentStateAccepted}
+	)
+	ok, err := op.VolumesIntersect(box(37, -122, start))
+	require.NoError(t, err)
+	require.True(t, ok, "unknown volumes intersect everything within the extent")
+
+	op.SetExtents([]*dssmodels.Volume4D{box(37, -122, start), box(37.5, -122, start.Add(30*time.Minute))})
+	require.Len(t, op.Volumes, 2)
+	require.Empty(t, op.OffNominalVolumes)
+	ok, err = op.VolumesIntersect(box(37.5, -122, start.Add(35*time.Minute)))
+	require.NoError(t, err)
+	require.True(t, ok)
+	// The first place once the trajectory has left it.
+	ok, err = op.VolumesIntersect(box(37, -122, start.Add(35*time.Minute)))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	op.State = OperationalIntentStateContingent
+	op.SetExtents([]*dssmodels.Volume4D{box(37, -122, start.Add(35*time.Minute))})
+	require.Empty(t, op.Volumes)
+	require.Len(t, op.Extents(), 1)
+	ok, err = op.VolumesIntersect(box(37, -122, start.Add(35*time.Minute)))
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestSubscriptionJSON(t *testing.T) {
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	sub := &Subscription{
+		ID:                   dssmodels.ID(uuid.New().String()),
+		Version:              NewOVNFromTime(start, "salt"),
+		NotificationIndex:    3,
+		StartTime:            &start,
+		USSBaseURL:           "https://uss1.example.com",
+		NotifyForConstraints: true,
+	}
+	b, err := json.Marshal(sub)
+	require.NoError(t, err)
+	var wire map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &wire))
+	// Defaults are present, as served by the API.
+	require.Equal(t, false, wire["notify_for_operational_intents"])
+	require.Equal(t, []interface{}{}, wire["dependent_operational_intents"])
+
+	decoded := &Subscription{}
+	require.NoError(t, json.Unmarshal(b, decoded))
+	require.Equal(t, sub, decoded)
+}
@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/golang/geo/s2"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	dssmodels "github.com/interuss/dss/pkg/models"
@@ -35,6 +34,13 @@ func (s OperationalIntentState) RequiresKey() bool {
 	return true
 }
 
+// IsOffNominal indicates whether an OperationalIntent in this state is no
+// longer conforming to its nominal volumes, its extents then being its
+// off-nominal volumes.
+func (s OperationalIntentState) IsOffNominal() bool {
+	return s == OperationalIntentStateNonconforming || s == OperationalIntentStateContingent
+}
+
 // IsValid indicates whether an OperationalIntent may be transitioned to the specified
 // state via a DSS PUT.
 func (s OperationalIntentState) IsValidInDSS() bool {
@@ -66,6 +72,32 @@ type OperationalIntent struct {
 	AltitudeLower  *float32
 	AltitudeUpper  *float32
 	Cells          s2.CellUnion
+	// AltitudeReference is the vertical datum AltitudeLower and AltitudeUpper
+	// were submitted in, as dssmodels.Volume3D.AltitudeReference.
+	AltitudeReference string
+	// UpdatedAt is when this version was written, from which OVN derives.
+	// It is set by stores.
+	UpdatedAt time.Time
+	// Footprint, if known, is the exact shape Cells cover. It is not read
+	// back from stores.
+	Footprint dssmodels.Geometry
+	// Volumes are the extents submitted while the OperationalIntent is
+	// nominal, in their order, and OffNominalVolumes those submitted while it
+	// is off-nominal; the bounds and Cells above span their union. They are
+	// nil when read back from stores whose schema does not hold them.
+	Volumes           []*dssmodels.Volume4D
+	OffNominalVolumes []*dssmodels.Volume4D
+}
+
+// ManagerTransfer hands an OperationalIntent off from its manager, From, to
+// another USS, To, for instance mid-flight.
+type ManagerTransfer struct {
+	From dssmodels.Manager
+	To   dssmodels.Manager
+	// USSBaseURL and SubscriptionID replace those of the OperationalIntent,
+	// the Subscription being managed by To.
+	USSBaseURL     string
+	SubscriptionID dssmodels.ID
 }
 
 func (s OperationalIntentState) String() string {
@@ -86,7 +118,7 @@ func (o *OperationalIntent) ToProto() (*scdpb.OperationalIntentReference, error)
 	}
 
 	if o.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*o.StartTime)
+		ts, err := dssmodels.TimestampProto(*o.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -97,7 +129,7 @@ func (o *OperationalIntent) ToProto() (*scdpb.OperationalIntentReference, error)
 	}
 
 	if o.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*o.EndTime)
+		ts, err := dssmodels.TimestampProto(*o.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -110,6 +142,95 @@ func (o *OperationalIntent) ToProto() (*scdpb.OperationalIntentReference, error)
 	return result, nil
 }
 
+// MarshalJSON encodes o in the wire format of OperationalIntentReferences.
+func (o *OperationalIntent) MarshalJSON() ([]byte, error) {
+	p, err := o.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.MarshalAPIJSON(p)
+}
+
+// UnmarshalJSON decodes the fields of o held by OperationalIntentReferences
+// from their wire format.
+func (o *OperationalIntent) UnmarshalJSON(data []byte) error {
+	p := &scdpb.OperationalIntentReference{}
+	if err := dssmodels.UnmarshalAPIJSON(data, p); err != nil {
+		return err
+	}
+	startTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeStart().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time from proto")
+	}
+	endTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeEnd().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time from proto")
+	}
+	o.ID = dssmodels.ID(p.GetId())
+	o.OVN = OVN(p.GetOvn())
+	o.Manager = dssmodels.Manager(p.GetManager())
+	o.Version = VersionNumber(p.GetVersion())
+	o.State = OperationalIntentState(p.GetState())
+	o.USSBaseURL = p.GetUssBaseUrl()
+	o.SubscriptionID = dssmodels.ID(p.GetSubscriptionId())
+	o.StartTime = startTime
+	o.EndTime = endTime
+	return nil
+}
+
+// Volume4D returns the extent of o.
+func (o *OperationalIntent) Volume4D() *dssmodels.Volume4D {
+	return &dssmodels.Volume4D{
+		StartTime: o.StartTime,
+		EndTime:   o.EndTime,
+		SpatialVolume: &dssmodels.Volume3D{
+			AltitudeLo:        o.AltitudeLower,
+			AltitudeHi:        o.AltitudeUpper,
+			AltitudeReference: o.AltitudeReference,
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return o.Cells, nil
+			}),
+		},
+	}
+}
+
+// SetExtents sets the volumes of o to extents, submitted in its current
+// state: its off-nominal volumes if the state is off-nominal, and its nominal
+// volumes otherwise.
+func (o *OperationalIntent) SetExtents(extents []*dssmodels.Volume4D) {
+	if o.State.IsOffNominal() {
+		o.Volumes, o.OffNominalVolumes = nil, extents
+	} else {
+		o.Volumes, o.OffNominalVolumes = extents, nil
+	}
+}
+
+// Extents returns the volumes of o, nominal then off-nominal.
+func (o *OperationalIntent) Extents() []*dssmodels.Volume4D {
+	extents := make([]*dssmodels.Volume4D, 0, len(o.Volumes)+len(o.OffNominalVolumes))
+	return append(append(extents, o.Volumes...), o.OffNominalVolumes...)
+}
+
+// VolumesIntersect returns whether one of the volumes of o intersects v4d,
+// refining the intersection of v4d with the union of the volumes. It returns
+// true if the volumes of o are unknown.
+func (o *OperationalIntent) VolumesIntersect(v4d *dssmodels.Volume4D) (bool, error) {
+	extents := o.Extents()
+	if len(extents) == 0 {
+		return true, nil
+	}
+	for _, extent := range extents {
+		intersection, err := extent.Intersect(v4d)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "Error intersecting volume of OperationalIntent %s", o.ID)
+		}
+		if intersection != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // ValidateTimeRange validates the time range of o.
 func (o *OperationalIntent) ValidateTimeRange() error {
 	if o.StartTime == nil {
@@ -8,15 +8,10 @@ import (
 	dssmodels "github.com/interuss/dss/pkg/models"
 
 	"github.com/golang/geo/s2"
-	"github.com/golang/protobuf/ptypes"
 	"github.com/interuss/stacktrace"
 )
 
 const (
-	// maxSubscriptionDuration is the largest allowed interval between StartTime
-	// and EndTime.
-	maxSubscriptionDuration = time.Hour * 24
-
 	// maxClockSkew is the largest allowed interval between the StartTime of a new
 	// subscription and the server's idea of the current time.
 	maxClockSkew = time.Minute * 5
@@ -48,7 +43,7 @@ func (s *Subscription) ToProto(dependentOperationalIntents []dssmodels.ID) (*scd
 	result := &scdpb.Subscription{
 		Id:                          s.ID.String(),
 		Version:                     s.Version.String(),
-		NotificationIndex:           int32(s.NotificationIndex),
+		NotificationIndex:           dssmodels.NotificationIndexToProto(s.NotificationIndex),
 		UssBaseUrl:                  s.USSBaseURL,
 		NotifyForOperationalIntents: s.NotifyForOperationalIntents,
 		NotifyForConstraints:        s.NotifyForConstraints,
@@ -56,7 +51,7 @@ func (s *Subscription) ToProto(dependentOperationalIntents []dssmodels.ID) (*scd
 	}
 
 	if s.StartTime != nil {
-		ts, err := ptypes.TimestampProto(*s.StartTime)
+		ts, err := dssmodels.TimestampProto(*s.StartTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting start time to proto")
 		}
@@ -67,7 +62,7 @@ func (s *Subscription) ToProto(dependentOperationalIntents []dssmodels.ID) (*scd
 	}
 
 	if s.EndTime != nil {
-		ts, err := ptypes.TimestampProto(*s.EndTime)
+		ts, err := dssmodels.TimestampProto(*s.EndTime)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error converting end time to proto")
 		}
@@ -84,9 +79,47 @@ func (s *Subscription) ToProto(dependentOperationalIntents []dssmodels.ID) (*scd
 	return result, nil
 }
 
+// MarshalJSON encodes s in the wire format of Subscriptions, without
+// dependent OperationalIntents.
+func (s *Subscription) MarshalJSON() ([]byte, error) {
+	p, err := s.ToProto(nil)
+	if err != nil {
+		return nil, err
+	}
+	return dssmodels.MarshalAPIJSON(p)
+}
+
+// UnmarshalJSON decodes the fields of s held by Subscriptions from their
+// wire format.
+func (s *Subscription) UnmarshalJSON(data []byte) error {
+	p := &scdpb.Subscription{}
+	if err := dssmodels.UnmarshalAPIJSON(data, p); err != nil {
+		return err
+	}
+	startTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeStart().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting start time from proto")
+	}
+	endTime, err := dssmodels.OptionalTimeFromProto(p.GetTimeEnd().GetValue())
+	if err != nil {
+		return stacktrace.Propagate(err, "Error converting end time from proto")
+	}
+	s.ID = dssmodels.ID(p.GetId())
+	s.Version = OVN(p.GetVersion())
+	s.NotificationIndex = int(p.GetNotificationIndex())
+	s.USSBaseURL = p.GetUssBaseUrl()
+	s.NotifyForOperationalIntents = p.GetNotifyForOperationalIntents()
+	s.NotifyForConstraints = p.GetNotifyForConstraints()
+	s.ImplicitSubscription = p.GetImplicitSubscription()
+	s.StartTime = startTime
+	s.EndTime = endTime
+	return nil
+}
+
 // AdjustTimeRange adjusts the time range to the max allowed ranges on a
-// subscription.
-func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
+// subscription, truncating it or rejecting it if it exceeds the subscription
+// duration of limits.
+func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription, limits dssmodels.Limits) error {
 	if s.StartTime == nil {
 		// If StartTime was omitted, default to Now() for new subscriptions or re-
 		// use the existing time of existing subscriptions.
@@ -107,9 +140,9 @@ func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
 		s.EndTime = old.EndTime
 	}
 
-	// Or if this is a new subscription default to StartTime + 1 day.
+	// Or if this is a new subscription default to the longest duration.
 	if s.EndTime == nil {
-		truncatedEndTime := s.StartTime.Add(maxSubscriptionDuration)
+		truncatedEndTime := s.StartTime.Add(limits.SubscriptionDuration())
 		s.EndTime = &truncatedEndTime
 	}
 
@@ -118,14 +151,31 @@ func (s *Subscription) AdjustTimeRange(now time.Time, old *Subscription) error {
 		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription time_end must be after time_start")
 	}
 
-	// EndTime cannot be 24 hrs after StartTime
-	if s.EndTime.Sub(*s.StartTime) > maxSubscriptionDuration {
-		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription window exceeds 24 hours")
+	// EndTime cannot be further than the longest duration after StartTime.
+	endTime, err := limits.BoundSubscriptionEnd(*s.StartTime, *s.EndTime)
+	if err != nil {
+		return err // No need to Propagate this error as this stack layer does not add useful information
 	}
+	s.EndTime = &endTime
 
 	return nil
 }
 
+// Volume4D returns the extent of s.
+func (s *Subscription) Volume4D() *dssmodels.Volume4D {
+	return &dssmodels.Volume4D{
+		StartTime: s.StartTime,
+		EndTime:   s.EndTime,
+		SpatialVolume: &dssmodels.Volume3D{
+			AltitudeLo: s.AltitudeLo,
+			AltitudeHi: s.AltitudeHi,
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return s.Cells, nil
+			}),
+		},
+	}
+}
+
 // ValidateDependentOps validates subscription against given operations in all 4 dimensions
 func (s *Subscription) ValidateDependentOps(operationalIntents []*OperationalIntent) error {
 	for _, op := range operationalIntents {
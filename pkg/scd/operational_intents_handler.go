@@ -2,17 +2,18 @@ package scd
 
 import (
 	"context"
-	"time"
 
-	"github.com/golang/geo/s2"
-	"github.com/google/uuid"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	"github.com/interuss/dss/pkg/auth"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/dss/pkg/idempotency"
 	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/dss/pkg/restrictions"
 	scderr "github.com/interuss/dss/pkg/scd/errors"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
 	"google.golang.org/grpc/status"
 )
@@ -20,6 +21,9 @@ import (
 // DeleteOperationalIntentReference deletes a single operational intent ref for a given ID at
 // the specified version.
 func (a *Server) DeleteOperationalIntentReference(ctx context.Context, req *scdpb.DeleteOperationalIntentReferenceRequest) (*scdpb.ChangeOperationalIntentReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.DeleteOperationalIntentReference")
+	defer span.End()
+
 	// Retrieve OperationalIntent ID
 	id, err := dssmodels.IDFromString(req.GetEntityid())
 	if err != nil {
@@ -58,46 +62,11 @@ func (a *Server) DeleteOperationalIntentReference(ctx context.Context, req *scdp
 			return stacktrace.NewError("OperationalIntent's Subscription missing from repo")
 		}
 
-		removeImplicitSubscription := false
-		if sub.ImplicitSubscription {
-			// Get the Subscription's dependent OperationalIntents
-			dependentOps, err := r.GetDependentOperationalIntents(ctx, sub.ID)
-			if err != nil {
-				return stacktrace.Propagate(err, "Could not find dependent OperationalIntents")
-			}
-			if len(dependentOps) == 0 {
-				return stacktrace.NewError("An implicit Subscription had no dependent OperationalIntents")
-			} else if len(dependentOps) == 1 {
-				removeImplicitSubscription = true
-			}
-		}
-
-		// Find Subscriptions that may overlap the OperationalIntent's Volume4D
-		allsubs, err := r.SearchSubscriptions(ctx, &dssmodels.Volume4D{
-			StartTime: old.StartTime,
-			EndTime:   old.EndTime,
-			SpatialVolume: &dssmodels.Volume3D{
-				AltitudeHi: old.AltitudeUpper,
-				AltitudeLo: old.AltitudeLower,
-				Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
-					return old.Cells, nil
-				}),
-			}})
+		// Increment notification indices for Subscriptions that may overlap
+		// the OperationalIntent's Volume4D
+		subs, err := r.NotifySubscriptions(ctx, old.Volume4D(), scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
 		if err != nil {
-			return stacktrace.Propagate(err, "Unable to search Subscriptions in repo")
-		}
-
-		// Limit Subscription notifications to only those interested in OperationalIntents
-		var subs repos.Subscriptions
-		for _, s := range allsubs {
-			if s.NotifyForOperationalIntents {
-				subs = append(subs, s)
-			}
-		}
-
-		// Increment notification indices for Subscriptions to be notified
-		if err := subs.IncrementNotificationIndices(ctx, r); err != nil {
-			return stacktrace.Propagate(err, "Unable to increment notification indices")
+			return stacktrace.Propagate(err, "Unable to notify Subscriptions in repo")
 		}
 
 		// Delete OperationalIntent from repo
@@ -105,12 +74,10 @@ func (a *Server) DeleteOperationalIntentReference(ctx context.Context, req *scdp
 			return stacktrace.Propagate(err, "Unable to delete OperationalIntent from repo")
 		}
 
-		if removeImplicitSubscription {
-			// Automatically remove a now-unused implicit Subscription
-			err = r.DeleteSubscription(ctx, sub.ID)
-			if err != nil {
-				return stacktrace.Propagate(err, "Unable to delete associated implicit Subscription")
-			}
+		// Shrink or remove the implicit Subscription, if any, that supported the
+		// deleted OperationalIntent
+		if err := fitImplicitSubscription(ctx, r, sub.ID); err != nil {
+			return stacktrace.Propagate(err, "Unable to update associated implicit Subscription")
 		}
 
 		// Convert deleted OperationalIntent to proto
@@ -138,6 +105,9 @@ func (a *Server) DeleteOperationalIntentReference(ctx context.Context, req *scdp
 
 // GetOperationalIntentReference returns a single operation intent ref for the given ID.
 func (a *Server) GetOperationalIntentReference(ctx context.Context, req *scdpb.GetOperationalIntentReferenceRequest) (*scdpb.GetOperationalIntentReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.GetOperationalIntentReference")
+	defer span.End()
+
 	id, err := dssmodels.IDFromString(req.GetEntityid())
 	if err != nil {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid ID format: `%s`", req.GetEntityid())
@@ -184,29 +154,47 @@ func (a *Server) GetOperationalIntentReference(ctx context.Context, req *scdpb.G
 
 // QueryOperationalIntentsReferences queries existing operational intent refs in the given
 // bounds.
-func (a *Server) QueryOperationalIntentReferences(ctx context.Context, req *scdpb.QueryOperationalIntentReferencesRequest) (*scdpb.QueryOperationalIntentReferenceResponse, error) {
+// parseOperationalIntentQuery returns the volume searched by req, the
+// manager making the call and the filter of the search.
+func parseOperationalIntentQuery(ctx context.Context, req *scdpb.QueryOperationalIntentReferencesRequest) (*dssmodels.Volume4D, dssmodels.Manager, scdmodels.OperationalIntentFilter, error) {
 	// Retrieve the area of interest parameter
 	aoi := req.GetParams().AreaOfInterest
 	if aoi == nil {
-		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing area_of_interest")
+		return nil, "", scdmodels.OperationalIntentFilter{}, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing area_of_interest")
 	}
 
 	// Parse area of interest to common Volume4D
 	vol4, err := dssmodels.Volume4DFromSCDProto(aoi)
 	if err != nil {
-		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Error parsing geometry")
+		return nil, "", scdmodels.OperationalIntentFilter{}, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Error parsing geometry")
 	}
 
 	// Retrieve ID of client making call
 	manager, ok := auth.ManagerFromContext(ctx)
 	if !ok {
-		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
+		return nil, "", scdmodels.OperationalIntentFilter{}, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
+	}
+
+	filter, err := scdmodels.OperationalIntentFilterFromContext(ctx)
+	if err != nil {
+		return nil, "", scdmodels.OperationalIntentFilter{}, stacktrace.Propagate(err, "Invalid search filter")
+	}
+	return vol4, manager, filter, nil
+}
+
+func (a *Server) QueryOperationalIntentReferences(ctx context.Context, req *scdpb.QueryOperationalIntentReferencesRequest) (*scdpb.QueryOperationalIntentReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.QueryOperationalIntentReferences")
+	defer span.End()
+
+	vol4, manager, filter, err := parseOperationalIntentQuery(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	var response *scdpb.QueryOperationalIntentReferenceResponse
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		// Perform search query on Store
-		ops, err := r.SearchOperationalIntents(ctx, vol4)
+		ops, err := r.SearchOperationalIntentReferences(ctx, vol4, dssmodels.IncludeExpiredFromContext(ctx), filter)
 		if err != nil {
 			return stacktrace.Propagate(err, "Unable to query for OperationalIntents in repo")
 		}
@@ -246,6 +234,9 @@ func (a *Server) UpdateOperationalIntentReference(ctx context.Context, req *scdp
 // PutOperationalIntentReference inserts or updates an Operational Intent.
 // If the ovn argument is empty (""), it will attempt to create a new Operational Intent.
 func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid string, ovn string, params *scdpb.PutOperationalIntentReferenceParameters) (*scdpb.ChangeOperationalIntentReferenceResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.PutOperationalIntentReference")
+	defer span.End()
+
 	id, err := dssmodels.IDFromString(entityid)
 	if err != nil {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid ID format: `%s`", entityid)
@@ -257,6 +248,12 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing manager from context")
 	}
 
+	if ovn == "" {
+		if err := a.IDs.Claim(ctx, id, dssmodels.Owner(manager)); err != nil {
+			return nil, err // No need to Propagate this error as this stack layer does not add useful information
+		}
+	}
+
 	var (
 		extents = make([]*dssmodels.Volume4D, len(params.GetExtents()))
 	)
@@ -294,7 +291,7 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing time_end from extents")
 	}
 
-	if time.Now().After(*uExtent.EndTime) {
+	if DefaultClock.Now().After(*uExtent.EndTime) {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "OperationalIntents may not end in the past")
 	}
 
@@ -302,6 +299,12 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 	if err != nil {
 		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid area")
 	}
+	if err := a.Limits.Check(cells, uExtent.StartTime, uExtent.EndTime, uExtent.SpatialVolume.AltitudeLo, uExtent.SpatialVolume.AltitudeHi); err != nil {
+		return nil, stacktrace.Propagate(err, "OperationalIntent exceeds limits")
+	}
+	if err := restrictions.Default.Check(events.KindOperationalIntent, manager.String(), cells); err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
 
 	if uExtent.EndTime.Before(*uExtent.StartTime) {
 		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "End time is past the start time")
@@ -346,27 +349,25 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 
 		var sub *scdmodels.Subscription
 		if subscriptionID.Empty() {
-			// Create implicit Subscription
-			err := scdmodels.ValidateUSSBaseURL(params.GetNewSubscription().GetUssBaseUrl())
-			if err != nil {
-				return stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Failed to validate USS base URL")
+			if old != nil {
+				// Keep using the implicit Subscription of the existing OperationalIntent
+				sub, err = r.GetSubscription(ctx, old.SubscriptionID)
+				if err != nil {
+					return stacktrace.Propagate(err, "Unable to get OperationalIntent's Subscription from repo")
+				}
+				if sub != nil && !sub.ImplicitSubscription {
+					sub = nil
+				}
 			}
-
-			sub, err = r.UpsertSubscription(ctx, &scdmodels.Subscription{
-				ID:                          dssmodels.ID(uuid.New().String()),
-				Manager:                     manager,
-				StartTime:                   uExtent.StartTime,
-				EndTime:                     uExtent.EndTime,
-				AltitudeLo:                  uExtent.SpatialVolume.AltitudeLo,
-				AltitudeHi:                  uExtent.SpatialVolume.AltitudeHi,
-				Cells:                       cells,
-				USSBaseURL:                  params.GetNewSubscription().GetUssBaseUrl(),
-				NotifyForOperationalIntents: true,
-				NotifyForConstraints:        params.GetNewSubscription().GetNotifyForConstraints(),
-				ImplicitSubscription:        true,
-			})
-			if err != nil {
-				return stacktrace.Propagate(err, "Failed to create implicit subscription")
+			if sub == nil {
+				subID, err := a.newID()
+				if err != nil {
+					return stacktrace.Propagate(err, "Failed to generate implicit Subscription ID")
+				}
+				sub, err = createImplicitSubscription(ctx, r, subID, manager, params.GetNewSubscription(), uExtent, cells)
+				if err != nil {
+					return stacktrace.Propagate(err, "Failed to create implicit Subscription")
+				}
 			}
 		} else {
 			// Use existing Subscription
@@ -382,39 +383,39 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 					stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Specificed Subscription is owned by different client"),
 					"Subscription %s owned by %s, but %s attempted to use it for an OperationalIntent", subscriptionID, sub.Manager, manager)
 			}
-			updateSub := false
-			if sub.StartTime != nil && sub.StartTime.After(*uExtent.StartTime) {
-				if sub.ImplicitSubscription {
-					sub.StartTime = uExtent.StartTime
-					updateSub = true
-				} else {
-					return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription does not begin until after the OperationalIntent starts")
-				}
-			}
-			if sub.EndTime != nil && sub.EndTime.Before(*uExtent.EndTime) {
-				if sub.ImplicitSubscription {
-					sub.EndTime = uExtent.EndTime
-					updateSub = true
-				} else {
-					return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription ends before the OperationalIntent ends")
-				}
-			}
-			if !sub.Cells.Contains(cells) {
-				if sub.ImplicitSubscription {
-					sub.Cells = s2.CellUnionFromUnion(sub.Cells, cells)
-					updateSub = true
-				} else {
-					return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription does not cover entire spatial area of the OperationalIntent")
-				}
-			}
-			if updateSub {
-				sub, err = r.UpsertSubscription(ctx, sub)
-				if err != nil {
-					return stacktrace.Propagate(err, "Failed to update existing Subscription")
+			// Implicit Subscriptions are fitted to their dependent
+			// OperationalIntents once the OperationalIntent is upserted below.
+			if !sub.ImplicitSubscription {
+				if err := checkSubscriptionCovers(sub, uExtent.StartTime, uExtent.EndTime, cells); err != nil {
+					return err
 				}
 			}
 		}
 
+		// Construct the new OperationalIntent
+		op := &scdmodels.OperationalIntent{
+			ID:      id,
+			Manager: manager,
+			Version: scdmodels.VersionNumber(version + 1),
+
+			StartTime:         uExtent.StartTime,
+			EndTime:           uExtent.EndTime,
+			AltitudeLower:     uExtent.SpatialVolume.AltitudeLo,
+			AltitudeUpper:     uExtent.SpatialVolume.AltitudeHi,
+			AltitudeReference: uExtent.SpatialVolume.AltitudeReference,
+			Cells:             cells,
+			Footprint:         uExtent.SpatialVolume.Footprint,
+
+			USSBaseURL:     params.UssBaseUrl,
+			SubscriptionID: sub.ID,
+			State:          state,
+		}
+		op.SetExtents(extents)
+		err = op.ValidateTimeRange()
+		if err != nil {
+			return stacktrace.Propagate(err, "Error validating time range")
+		}
+
 		if state.RequiresKey() {
 			// Construct a hash set of OVNs as the key
 			key := map[scdmodels.OVN]bool{}
@@ -422,36 +423,9 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 				key[scdmodels.OVN(ovn)] = true
 			}
 
-			// Identify OperationalIntents missing from the key
-			var missingOps []*scdmodels.OperationalIntent
-			relevantOps, err := r.SearchOperationalIntents(ctx, uExtent)
+			missingOps, missingConstraints, err := a.missingFromKey(ctx, r, op, uExtent, key, sub.NotifyForConstraints)
 			if err != nil {
-				return stacktrace.Propagate(err, "Unable to SearchOperations")
-			}
-			for _, relevantOp := range relevantOps {
-				if _, ok := key[relevantOp.OVN]; !ok {
-					if relevantOp.Manager != manager {
-						relevantOp.OVN = scdmodels.NoOvnPhrase
-					}
-					missingOps = append(missingOps, relevantOp)
-				}
-			}
-
-			// Identify Constraints missing from the key
-			var missingConstraints []*scdmodels.Constraint
-			if sub.NotifyForConstraints {
-				constraints, err := r.SearchConstraints(ctx, uExtent)
-				if err != nil {
-					return stacktrace.Propagate(err, "Unable to SearchConstraints")
-				}
-				for _, relevantConstraint := range constraints {
-					if _, ok := key[relevantConstraint.OVN]; !ok {
-						if relevantConstraint.Manager != manager {
-							relevantConstraint.OVN = scdmodels.NoOvnPhrase
-						}
-						missingConstraints = append(missingConstraints, relevantConstraint)
-					}
-				}
+				return stacktrace.Propagate(err, "Unable to identify entities missing from key")
 			}
 
 			// If the client is missing some OVNs, provide the pointers to the
@@ -465,70 +439,42 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 			}
 		}
 
-		// Construct the new OperationalIntent
-		op := &scdmodels.OperationalIntent{
-			ID:      id,
-			Manager: manager,
-			Version: scdmodels.VersionNumber(version + 1),
-
-			StartTime:     uExtent.StartTime,
-			EndTime:       uExtent.EndTime,
-			AltitudeLower: uExtent.SpatialVolume.AltitudeLo,
-			AltitudeUpper: uExtent.SpatialVolume.AltitudeHi,
-			Cells:         cells,
-
-			USSBaseURL:     params.UssBaseUrl,
-			SubscriptionID: sub.ID,
-			State:          state,
-		}
-		err = op.ValidateTimeRange()
-		if err != nil {
-			return stacktrace.Propagate(err, "Error validating time range")
-		}
-
 		// Compute total affected Volume4D for notification purposes
 		var notifyVol4 *dssmodels.Volume4D
 		if old == nil {
 			notifyVol4 = uExtent
 		} else {
-			oldVol4 := &dssmodels.Volume4D{
-				StartTime: old.StartTime,
-				EndTime:   old.EndTime,
-				SpatialVolume: &dssmodels.Volume3D{
-					AltitudeHi: old.AltitudeUpper,
-					AltitudeLo: old.AltitudeLower,
-					Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
-						return old.Cells, nil
-					}),
-				}}
-			notifyVol4, err = dssmodels.UnionVolumes4D(uExtent, oldVol4)
+			notifyVol4, err = dssmodels.UnionVolumes4D(uExtent, old.Volume4D())
 			if err != nil {
 				return stacktrace.Propagate(err, "Error constructing 4D volumes union")
 			}
 		}
 
 		// Upsert the OperationalIntent
-		op, err = r.UpsertOperationalIntent(ctx, op)
+		var previous scdmodels.OVN
+		if old != nil {
+			previous = old.OVN
+		}
+		op, err = r.UpsertOperationalIntent(ctx, op, previous)
 		if err != nil {
 			return stacktrace.Propagate(err, "Failed to upsert OperationalIntent in repo")
 		}
 
-		// Find Subscriptions that may need to be notified
-		allsubs, err := r.SearchSubscriptions(ctx, notifyVol4)
-		if err != nil {
-			return err
+		// Fit the implicit Subscriptions affected by the change, removing the
+		// previous one if it no longer supports any OperationalIntent
+		if err := fitImplicitSubscription(ctx, r, sub.ID); err != nil {
+			return stacktrace.Propagate(err, "Failed to update implicit Subscription")
 		}
-
-		// Limit Subscription notifications to only those interested in OperationalIntents
-		var subs repos.Subscriptions
-		for _, sub := range allsubs {
-			if sub.NotifyForOperationalIntents {
-				subs = append(subs, sub)
+		if old != nil && old.SubscriptionID != sub.ID {
+			if err := fitImplicitSubscription(ctx, r, old.SubscriptionID); err != nil {
+				return stacktrace.Propagate(err, "Failed to update previous implicit Subscription")
 			}
 		}
 
-		// Increment notification indices for relevant Subscriptions
-		err = subs.IncrementNotificationIndices(ctx, r)
+		// Increment notification indices for Subscriptions that may need to
+		// be notified, limited to those interested in OperationalIntents,
+		// found by the same statement
+		subs, err := r.NotifySubscriptions(ctx, notifyVol4, scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
 		if err != nil {
 			return err
 		}
@@ -544,6 +490,7 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 			OperationalIntentReference: p,
 			Subscribers:                makeSubscribersToNotify(subs),
 		}
+		idempotency.Respond(ctx, response)
 
 		return nil
 	}
@@ -555,3 +502,54 @@ func (a *Server) PutOperationalIntentReference(ctx context.Context, entityid str
 
 	return response, nil
 }
+
+// missingFromKey returns the OperationalIntents and, if withConstraints, the
+// Constraints intersecting extent, the extent of op, whose OVNs are required
+// by the ConflictPolicy of a and are not in key, masking the OVNs of the
+// entities not managed by the manager of op. The entities are those returned
+// to the client in an AirspaceConflictResponse; r must be transactional so
+// that they are read from the same snapshot as the entities checked by the
+// rest of the upsert.
+func (a *Server) missingFromKey(ctx context.Context, r repos.Repository, op *scdmodels.OperationalIntent, extent *dssmodels.Volume4D, key map[scdmodels.OVN]bool, withConstraints bool) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error) {
+	relevantOps, err := r.SearchOperationalIntentReferences(ctx, extent, true, scdmodels.OperationalIntentFilter{})
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Unable to SearchOperations")
+	}
+	var relevantConstraints []*scdmodels.Constraint
+	if withConstraints {
+		relevantConstraints, err = r.SearchConstraints(ctx, extent, scdmodels.ConstraintFilter{})
+		if err != nil {
+			return nil, nil, stacktrace.Propagate(err, "Unable to SearchConstraints")
+		}
+	}
+
+	policy := a.ConflictPolicy
+	if policy == nil {
+		policy = RequireAllOVNs
+	}
+	relevantOps, relevantConstraints, err = policy.Resolve(ctx, op, relevantOps, relevantConstraints)
+	if err != nil {
+		return nil, nil, err // No need to Propagate this error as the policy is expected to describe it
+	}
+
+	var missingOps []*scdmodels.OperationalIntent
+	for _, relevantOp := range relevantOps {
+		if _, ok := key[relevantOp.OVN]; !ok {
+			if relevantOp.Manager != op.Manager {
+				relevantOp.OVN = scdmodels.NoOvnPhrase
+			}
+			missingOps = append(missingOps, relevantOp)
+		}
+	}
+
+	var missingConstraints []*scdmodels.Constraint
+	for _, relevantConstraint := range relevantConstraints {
+		if _, ok := key[relevantConstraint.OVN]; !ok {
+			if relevantConstraint.Manager != op.Manager {
+				relevantConstraint.OVN = scdmodels.NoOvnPhrase
+			}
+			missingConstraints = append(missingConstraints, relevantConstraint)
+		}
+	}
+	return missingOps, missingConstraints, nil
+}
@@ -0,0 +1,137 @@
+package scd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scderr "github.com/interuss/dss/pkg/scd/errors"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+func TestMissingFromKey(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		clock  = clockwork.NewFakeClock()
+		store  = scdmemory.NewStore(clock)
+		start  = clock.Now()
+		end    = start.Add(time.Hour)
+		extent = &dssmodels.Volume4D{
+			StartTime: &start,
+			EndTime:   &end,
+			SpatialVolume: &dssmodels.Volume3D{
+				Footprint: &dssmodels.GeoCircle{
+					Center:      dssmodels.LatLngPoint{Lat: 46.2, Lng: 6.1},
+					RadiusMeter: 100,
+				},
+			},
+		}
+	)
+	cells, err := extent.CalculateSpatialCovering()
+	require.NoError(t, err)
+
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		var ops []*scdmodels.OperationalIntent
+		for _, manager := range []dssmodels.Manager{"uss1", "uss2"} {
+			url := "https://" + manager.String() + ".example.com"
+			sub, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+				ID:                          dssmodels.ID(uuid.New().String()),
+				Manager:                     manager,
+				StartTime:                   &start,
+				EndTime:                     &end,
+				USSBaseURL:                  url,
+				NotifyForOperationalIntents: true,
+				ImplicitSubscription:        true,
+				Cells:                       cells,
+			}, "")
+			require.NoError(t, err)
+			op, err := r.UpsertOperationalIntent(ctx, &scdmodels.OperationalIntent{
+				ID:             dssmodels.ID(uuid.New().String()),
+				Manager:        manager,
+				Version:        1,
+				State:          scdmodels.OperationalIntentStateAccepted,
+				StartTime:      &start,
+				EndTime:        &end,
+				USSBaseURL:     url,
+				SubscriptionID: sub.ID,
+				Cells:          cells,
+			}, "")
+			require.NoError(t, err)
+			ops = append(ops, op)
+		}
+		constraint, err := r.UpsertConstraint(ctx, &scdmodels.Constraint{
+			ID:         dssmodels.ID(uuid.New().String()),
+			Manager:    "uss2",
+			Version:    1,
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss2.example.com",
+			Cells:      cells,
+		})
+		require.NoError(t, err)
+
+		var (
+			server = &Server{}
+			op     = &scdmodels.OperationalIntent{ID: ops[0].ID, Manager: "uss1"}
+			key    = map[scdmodels.OVN]bool{ops[0].OVN: true}
+		)
+		missingOps, missingConstraints, err := server.missingFromKey(ctx, r, op, extent, key, false)
+		require.NoError(t, err)
+		require.Len(t, missingOps, 1)
+		require.Equal(t, ops[1].ID, missingOps[0].ID)
+		require.Equal(t, scdmodels.OVN(scdmodels.NoOvnPhrase), missingOps[0].OVN)
+		require.Empty(t, missingConstraints)
+
+		missingOps, missingConstraints, err = server.missingFromKey(ctx, r, op, extent, key, true)
+		require.NoError(t, err)
+		require.Len(t, missingConstraints, 1)
+		require.Equal(t, constraint.ID, missingConstraints[0].ID)
+
+		// The response carries the full references of the entities missing.
+		p, err := scderr.MissingOVNsErrorResponse(missingOps, missingConstraints)
+		require.NoError(t, err)
+		details := status.FromProto(p).Details()
+		require.Len(t, details, 2)
+		response := details[0].(*scdpb.AirspaceConflictResponse)
+		require.Len(t, response.MissingOperationalIntents, 1)
+		require.Equal(t, "https://uss2.example.com", response.MissingOperationalIntents[0].UssBaseUrl)
+		require.Len(t, response.MissingConstraints, 1)
+		info := details[1].(*errdetails.ErrorInfo)
+		require.Equal(t, ops[1].ID.String(), info.Metadata["missing_operational_intents"])
+		require.Equal(t, constraint.ID.String(), info.Metadata["missing_constraints"])
+
+		// A policy may waive OVNs, here those of other managers.
+		server.ConflictPolicy = ConflictPolicyFunc(func(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error) {
+			var required []*scdmodels.OperationalIntent
+			for _, other := range ops {
+				if other.Manager == op.Manager {
+					required = append(required, other)
+				}
+			}
+			return required, constraints, nil
+		})
+		missingOps, missingConstraints, err = server.missingFromKey(ctx, r, op, extent, key, true)
+		require.NoError(t, err)
+		require.Empty(t, missingOps)
+		require.Len(t, missingConstraints, 1)
+
+		// Or reject the OperationalIntent.
+		server.ConflictPolicy = ConflictPolicyFunc(func(ctx context.Context, op *scdmodels.OperationalIntent, ops []*scdmodels.OperationalIntent, constraints []*scdmodels.Constraint) ([]*scdmodels.OperationalIntent, []*scdmodels.Constraint, error) {
+			return nil, nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Priority too low")
+		})
+		_, _, err = server.missingFromKey(ctx, r, op, extent, key, true)
+		require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+		return nil
+	}))
+}
@@ -2,7 +2,9 @@ package repos
 
 import (
 	"context"
+	"time"
 
+	"github.com/golang/geo/s2"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 )
@@ -18,29 +20,75 @@ type OperationalIntent interface {
 	// DeleteOperationalIntent deletes the operation identified by "id".
 	DeleteOperationalIntent(ctx context.Context, id dssmodels.ID) error
 
-	// UpsertOperationalIntent inserts or updates an operation into the store.
-	UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent) (*scdmodels.OperationalIntent, error)
-
-	// SearchOperationalIntents returns all operations intersecting "v4d".
-	SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.OperationalIntent, error)
+	// UpsertOperationalIntent inserts or updates an operation into the store
+	// provided that its current OVN is "previous", or that it does not exist
+	// if "previous" is empty. Otherwise, it returns an error with the
+	// errors.VersionMismatch code.
+	UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent, previous scdmodels.OVN) (*scdmodels.OperationalIntent, error)
+
+	// TransferOperationalIntentManager hands the operation identified by "id"
+	// off as described by "transfer", provided that its current OVN is
+	// "previous" and that it is managed by transfer.From, and returns the
+	// operation with its new OVN. Otherwise, it returns an error with the
+	// errors.VersionMismatch or errors.PermissionDenied code respectively.
+	// It only changes the operation; scd.TransferOperationalIntent also
+	// maintains the Subscriptions affected as an update would.
+	TransferOperationalIntentManager(ctx context.Context, id dssmodels.ID, previous scdmodels.OVN, transfer scdmodels.ManagerTransfer) (*scdmodels.OperationalIntent, error)
+
+	// SearchOperationalIntents returns all operations intersecting "v4d" and
+	// passing "filter". Operations that ended before the current time of the
+	// store are excluded unless "includeExpired" is true.
+	SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error)
+
+	// SearchOperationalIntentReferences returns the operations
+	// SearchOperationalIntents would return, without their cells, for callers
+	// only needing their references. Their Cells are left nil, to be fetched
+	// with GetOperationalIntentCells if needed.
+	SearchOperationalIntentReferences(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error)
+
+	// GetOperationalIntentCells returns the cells of the operation identified
+	// by "id", or nil and no error if it does not exist.
+	GetOperationalIntentCells(ctx context.Context, id dssmodels.ID) (s2.CellUnion, error)
+
+	// StreamOperationalIntents calls "f" with each of the operations
+	// SearchOperationalIntents would return, as they are read from the store
+	// rather than all at once, and stops at the first error returned by "f".
+	StreamOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter, f func(*scdmodels.OperationalIntent) error) error
+
+	// GetFullOperationalIntentByOVN returns the version of an operation
+	// identified by "ovn", which may have been superseded or deleted since,
+	// or nil and no error if "ovn" identifies no version kept by the store.
+	GetFullOperationalIntentByOVN(ctx context.Context, ovn scdmodels.OVN) (*scdmodels.OperationalIntent, error)
+
+	// ListOperationalIntentVersions returns the versions of the operation
+	// identified by "id" kept by the store, oldest first, including those of
+	// an operation deleted since.
+	ListOperationalIntentVersions(ctx context.Context, id dssmodels.ID) ([]*scdmodels.OperationalIntent, error)
 
 	// GetDependentOperationalIntents returns IDs of all operations dependent on
 	// subscription identified by "subscriptionID".
 	GetDependentOperationalIntents(ctx context.Context, subscriptionID dssmodels.ID) ([]dssmodels.ID, error)
+
+	// GetOperationalIntentDependencies returns the references of the
+	// operation identified by "id" to Subscriptions, read in a single round
+	// trip to the store, or nil and no error if it does not exist.
+	GetOperationalIntentDependencies(ctx context.Context, id dssmodels.ID) (*scdmodels.OperationalIntentDependencies, error)
 }
 
 // Subscription abstracts subscription-specific interactions with the backing repository.
 type Subscription interface {
-	// SearchSubscriptions returns all Subscriptions in "v4d".
-	SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.Subscription, error)
+	// SearchSubscriptions returns all Subscriptions in "v4d" passing "filter".
+	SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error)
 
 	// GetSubscription returns the Subscription referenced by id, or nil and no
 	// error if the Subscription doesn't exist
 	GetSubscription(ctx context.Context, id dssmodels.ID) (*scdmodels.Subscription, error)
 
 	// UpsertSubscription upserts sub into the store and returns the result
-	// subscription.
-	UpsertSubscription(ctx context.Context, sub *scdmodels.Subscription) (*scdmodels.Subscription, error)
+	// subscription, provided that the current version of sub is "previous",
+	// or that it does not exist if "previous" is empty. Otherwise, it returns
+	// an error with the errors.VersionMismatch code.
+	UpsertSubscription(ctx context.Context, sub *scdmodels.Subscription, previous scdmodels.OVN) (*scdmodels.Subscription, error)
 
 	// DeleteSubscription deletes a Subscription from the store and returns the
 	// deleted subscription.  Returns an error if the Subscription does not
@@ -51,12 +99,36 @@ type Subscription interface {
 	// specified Subscription and returns the resulting corresponding
 	// notification indices.
 	IncrementNotificationIndices(ctx context.Context, subscriptionIds []dssmodels.ID) ([]int, error)
+
+	// NotifySubscriptions increments the notification index of each
+	// Subscription in "v4d" passing "filter" and returns them with their
+	// resulting notification indices, searched and incremented in a single
+	// round trip to the store.
+	NotifySubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error)
+
+	// ResetNotificationIndex sets the notification index of the Subscription
+	// referenced by id back to 0, without changing its OVN. Returns an error
+	// if the Subscription does not exist.
+	ResetNotificationIndex(ctx context.Context, id dssmodels.ID) error
+
+	// GetSubscriptionDependencies returns the operations depending on the
+	// Subscription identified by "id", whether or not it exists, read in a
+	// single round trip to the store.
+	GetSubscriptionDependencies(ctx context.Context, id dssmodels.ID) (*scdmodels.SubscriptionDependencies, error)
+
+	// ListExpiringSubscriptions returns the Subscriptions ending after "after"
+	// and no later than "until", by end time.
+	ListExpiringSubscriptions(ctx context.Context, after, until time.Time) ([]*scdmodels.Subscription, error)
+
+	// ListSubscriptionsByManager returns the Subscriptions of "manager" not
+	// ended by "after", by start time.
+	ListSubscriptionsByManager(ctx context.Context, manager dssmodels.Manager, after time.Time) ([]*scdmodels.Subscription, error)
 }
 
 // repos.Constraint abstracts constraint-specific interactions with the backing store.
 type Constraint interface {
-	// SearchConstraints returns all Constraints in "v4d".
-	SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.Constraint, error)
+	// SearchConstraints returns all Constraints in "v4d" passing "filter".
+	SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) ([]*scdmodels.Constraint, error)
 
 	// GetConstraint returns the Constraint referenced by id, or
 	// (nil, sql.ErrNoRows) if the Constraint doesn't exist
@@ -69,6 +141,11 @@ type Constraint interface {
 	// deleted subscription.  Returns nil and an error if the Constraint does
 	// not exist.
 	DeleteConstraint(ctx context.Context, id dssmodels.ID) error
+
+	// ListConstraintVersions returns the versions of the Constraint
+	// identified by "id" kept by the store, oldest first, including those of
+	// a Constraint deleted since.
+	ListConstraintVersions(ctx context.Context, id dssmodels.ID) ([]*scdmodels.Constraint, error)
 }
 
 // Repository aggregates all SCD-specific repo interfaces.
@@ -2,13 +2,19 @@ package scd
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/audit"
 	"github.com/interuss/dss/pkg/auth"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/ids"
+	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
 )
 
@@ -20,6 +26,14 @@ const (
 	availabilityArbitrationScope = "utm.availability_arbitration"
 )
 
+// StrategicCoordinationScope is the scope of the access tokens of the USSs
+// managing operational intents.
+const StrategicCoordinationScope auth.Scope = strategicCoordinationScope
+
+// ConstraintProcessingScope is the scope of the access tokens of the USSs
+// processing constraints.
+const ConstraintProcessingScope auth.Scope = constraintProcessingScope
+
 func makeSubscribersToNotify(subscriptions []*scdmodels.Subscription) []*scdpb.SubscriberToNotify {
 	result := []*scdpb.SubscriberToNotify{}
 
@@ -27,7 +41,7 @@ func makeSubscribersToNotify(subscriptions []*scdmodels.Subscription) []*scdpb.S
 	for _, sub := range subscriptions {
 		subState := &scdpb.SubscriptionState{
 			SubscriptionId:    sub.ID.String(),
-			NotificationIndex: int32(sub.NotificationIndex),
+			NotificationIndex: dssmodels.NotificationIndexToProto(sub.NotificationIndex),
 		}
 		subscriptionsByURL[sub.USSBaseURL] = append(subscriptionsByURL[sub.USSBaseURL], subState)
 	}
@@ -46,6 +60,34 @@ type Server struct {
 	Store      scdstore.Store
 	Timeout    time.Duration
 	EnableHTTP bool
+	// IDs, if set, prevents the creation of entities with IDs reserved to
+	// other managers.
+	IDs *ids.Reserver
+	// IDVersion is the version of the IDs generated by the DSS itself, such
+	// as those of implicit Subscriptions.  It defaults to ids.V4.
+	IDVersion ids.Version
+	// Reports, if set, persists the DSS reports filed through MakeDssReport.
+	Reports audit.ReportRecorder
+	// Limits bounds the extents of the OperationalIntents, Constraints and
+	// Subscriptions accepted.
+	Limits dssmodels.Limits
+	// ConflictPolicy, if set, decides which intersecting entities the OVNs
+	// of are required to upsert an OperationalIntent. It defaults to
+	// RequireAllOVNs.
+	ConflictPolicy ConflictPolicy
+}
+
+// newID returns a new ID of version a.IDVersion.
+func (a *Server) newID() (dssmodels.ID, error) {
+	v := a.IDVersion
+	if v == "" {
+		v = ids.V4
+	}
+	id, err := ids.New(v, time.Now())
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error generating ID")
+	}
+	return dssmodels.ID(id.String()), nil
 }
 
 // AuthScopes returns a map of endpoint to required Oauth scope.
@@ -69,10 +111,46 @@ func (a *Server) AuthScopes() map[auth.Operation]auth.KeyClaimedScopesValidator
 		"/scdpb.UTMAPIUSSDSSAndUSSUSSService/UpdateConstraintReference":        auth.RequireAnyScope(constraintManagementScope),
 		"/scdpb.UTMAPIUSSDSSAndUSSUSSService/UpdateOperationalIntentReference": auth.RequireAnyScope(strategicCoordinationScope, conformanceMonitoringSAScope),
 		"/scdpb.UTMAPIUSSDSSAndUSSUSSService/UpdateSubscription":               auth.RequireAnyScope(strategicCoordinationScope, constraintProcessingScope),
+
+		"/scdpb.UTMAPIUSSDSSAndUSSUSSStreamingService/StreamOperationalIntentReferences": auth.RequireAnyScope(strategicCoordinationScope, conformanceMonitoringSAScope),
 	}
 }
 
-// MakeDssReport creates an error report about a DSS.
+// MakeDssReport creates an error report about a DSS, persisted for pool
+// operators to investigate.
 func (a *Server) MakeDssReport(ctx context.Context, req *scdpb.MakeDssReportRequest) (*scdpb.ErrorReport, error) {
-	return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Not yet implemented")
+	ctx, span := tracing.StartSpan(ctx, "scd.MakeDssReport")
+	defer span.End()
+
+	if a.Reports == nil {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Not yet implemented")
+	}
+	manager, ok := auth.ManagerFromContext(ctx)
+	if !ok {
+		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing owner from context")
+	}
+	report := req.GetParams()
+	if report.GetExchange() == nil {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing exchange record")
+	}
+
+	id, err := a.newID()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to generate report ID")
+	}
+	report.ReportId = id.String()
+	details, err := (&jsonpb.Marshaler{OrigName: true}).MarshalToString(report)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to marshal report")
+	}
+	if err := a.Reports.InsertReport(ctx, &audit.Report{
+		ID:           report.ReportId,
+		Time:         time.Now(),
+		Manager:      manager.String(),
+		ResponseCode: report.GetExchange().GetResponseCode(),
+		Details:      json.RawMessage(details),
+	}); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to persist report")
+	}
+	return report, nil
 }
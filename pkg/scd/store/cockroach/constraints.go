@@ -4,9 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/interuss/dss/pkg/cockroach"
 	"github.com/interuss/dss/pkg/geo"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
@@ -16,41 +16,57 @@ import (
 	"github.com/lib/pq"
 )
 
-const (
-	nConstraintFields = 10
-)
-
-var (
-	constraintFieldsWithIndices   [nConstraintFields]string
-	constraintFieldsWithPrefix    string
-	constraintFieldsWithoutPrefix string
-)
+// constraintRow holds the columns of a Constraint row which are not read
+// directly into the Constraint.
+type constraintRow struct {
+	cells     pq.Int64Array
+	updatedAt time.Time
+	ovn       sql.NullString
+}
 
-// TODO Update database schema and fields below.
-func init() {
-	constraintFieldsWithIndices[0] = "id"
-	constraintFieldsWithIndices[1] = "owner"
-	constraintFieldsWithIndices[2] = "version"
-	constraintFieldsWithIndices[3] = "url"
-	constraintFieldsWithIndices[4] = "altitude_lower"
-	constraintFieldsWithIndices[5] = "altitude_upper"
-	constraintFieldsWithIndices[6] = "starts_at"
-	constraintFieldsWithIndices[7] = "ends_at"
-	constraintFieldsWithIndices[8] = "cells"
-	constraintFieldsWithIndices[9] = "updated_at"
-
-	constraintFieldsWithoutPrefix = strings.Join(
-		constraintFieldsWithIndices[:], ",",
-	)
+// constraintColumns returns the columns read into constraint and row: those
+// of constraintVersionColumns followed by the ovn column if the schema holds
+// it.
+func (c *repo) constraintColumns(constraint *scdmodels.Constraint, row *constraintRow) dsssql.Columns {
+	columns := c.constraintVersionColumns(constraint, row)
+	if c.supports(v3100) {
+		columns = columns.With("ovn", &row.ovn)
+	}
+	return columns
+}
 
-	withPrefix := make([]string, nConstraintFields)
-	for idx, field := range constraintFieldsWithIndices {
-		withPrefix[idx] = "scd_constraints." + field
+// constraintVersionColumns returns the columns of Constraints kept by both
+// scd_constraints and scd_constraint_versions, read into constraint and row.
+func (c *repo) constraintVersionColumns(constraint *scdmodels.Constraint, row *constraintRow) dsssql.Columns {
+	columns := dsssql.Columns{
+		{Name: "id", Value: &constraint.ID},
+		{Name: "owner", Value: &constraint.Manager},
+		{Name: "version", Value: &constraint.Version},
+		{Name: "url", Value: &constraint.USSBaseURL},
+		{Name: "altitude_lower", Value: &constraint.AltitudeLower},
+		{Name: "altitude_upper", Value: &constraint.AltitudeUpper},
+		{Name: "starts_at", Value: &constraint.StartTime},
+		{Name: "ends_at", Value: &constraint.EndTime},
+		{Name: "cells", Value: &row.cells},
+		{Name: "updated_at", Value: &row.updatedAt},
+	}
+	if c.supports(v380) {
+		columns = columns.With("type", &constraint.Type)
+	}
+	if c.supports(v3130) {
+		columns = columns.With("altitude_reference", &constraint.AltitudeReference)
 	}
+	return columns
+}
 
-	constraintFieldsWithPrefix = strings.Join(
-		withPrefix[:], ",",
-	)
+// constraintFields returns the columns read into Constraints, prefixed with
+// the table name if withPrefix.
+func (c *repo) constraintFields(withPrefix bool) string {
+	prefix := ""
+	if withPrefix {
+		prefix = "scd_constraints."
+	}
+	return c.constraintColumns(new(scdmodels.Constraint), new(constraintRow)).Names(prefix)
 }
 
 func (c *repo) fetchConstraints(ctx context.Context, q dsssql.Queryable, query string, args ...interface{}) ([]*scdmodels.Constraint, error) {
@@ -61,30 +77,18 @@ func (c *repo) fetchConstraints(ctx context.Context, q dsssql.Queryable, query s
 	defer rows.Close()
 
 	var payload []*scdmodels.Constraint
-	cids := pq.Int64Array{}
 	for rows.Next() {
 		var (
-			c         = new(scdmodels.Constraint)
-			updatedAt time.Time
+			constraint = &scdmodels.Constraint{Type: scdmodels.ConstraintTypeRestriction}
+			row        constraintRow
 		)
-		err := rows.Scan(
-			&c.ID,
-			&c.Manager,
-			&c.Version,
-			&c.USSBaseURL,
-			&c.AltitudeLower,
-			&c.AltitudeUpper,
-			&c.StartTime,
-			&c.EndTime,
-			&cids,
-			&updatedAt,
-		)
-		if err != nil {
+		if err := rows.Scan(c.constraintColumns(constraint, &row).Values()...); err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning Constraint row")
 		}
-		c.Cells = geo.CellUnionFromInt64(cids)
-		c.OVN = scdmodels.NewOVNFromTime(updatedAt, c.ID.String())
-		payload = append(payload, c)
+		constraint.Cells = geo.CellUnionFromInt64(row.cells)
+		constraint.OVN = storedOVN(row.ovn, row.updatedAt, constraint.ID)
+		constraint.UpdatedAt = row.updatedAt
+		payload = append(payload, constraint)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, stacktrace.Propagate(err, "Error in rows query result")
@@ -115,24 +119,13 @@ func (c *repo) GetConstraint(ctx context.Context, id dssmodels.ID) (*scdmodels.C
 			FROM
 				scd_constraints
 			WHERE
-				id = $1`, constraintFieldsWithoutPrefix)
+				id = $1`, c.constraintFields(false))
 	)
 	return c.fetchConstraint(ctx, c.q, query, id)
 }
 
 // Implements scd.repos.Constraint.UpsertConstraint
 func (c *repo) UpsertConstraint(ctx context.Context, s *scdmodels.Constraint) (*scdmodels.Constraint, error) {
-	var (
-		upsertQuery = fmt.Sprintf(`
-		UPSERT INTO
-		  scd_constraints
-		  (%s)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, transaction_timestamp())
-		RETURNING
-			%s`, constraintFieldsWithoutPrefix, constraintFieldsWithPrefix)
-	)
-
 	cids := make([]int64, len(s.Cells))
 
 	for i, cell := range s.Cells {
@@ -142,23 +135,101 @@ func (c *repo) UpsertConstraint(ctx context.Context, s *scdmodels.Constraint) (*
 		cids[i] = int64(cell)
 	}
 
-	s, err := c.fetchConstraint(ctx, c.q, upsertQuery,
-		s.ID,
-		s.Manager,
-		s.Version,
-		s.USSBaseURL,
-		s.AltitudeLower,
-		s.AltitudeUpper,
-		s.StartTime,
-		s.EndTime,
-		pq.Int64Array(cids))
+	footprint := s.Footprint
+	columns := dsssql.Columns{
+		{Name: "id", Value: s.ID},
+		{Name: "owner", Value: s.Manager},
+		{Name: "version", Value: s.Version},
+		{Name: "url", Value: s.USSBaseURL},
+		{Name: "altitude_lower", Value: s.AltitudeLower},
+		{Name: "altitude_upper", Value: s.AltitudeUpper},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "updated_at", Value: c.clock.Now()},
+	}
+	if c.supports(v380) {
+		columns = columns.With("type", s.Type)
+	}
+	if c.supports(v3130) {
+		columns = columns.With("altitude_reference", s.AltitudeReference)
+	}
+	if c.supports(v3100) {
+		// Constraints are written regardless of their current version, so
+		// their OVNs only follow from the logical timestamps of the writes.
+		ovn, err := c.newOVN(ctx, s.ID, "")
+		if err != nil {
+			return nil, err
+		}
+		columns = columns.With("ovn", ovn)
+	}
+	upsertQuery, args := c.upsert("scd_constraints", columns, s.Cells)
+	upsertQuery += fmt.Sprintf(`
+		RETURNING
+			%s`, c.constraintFields(true))
+	s, err := c.fetchConstraint(ctx, c.q, upsertQuery, args...)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error fetching Constraint")
 	}
 
+	if c.dualWrites[LayoutConstraintFootprints] {
+		if err := storeFootprint(ctx, c.q, "scd_constraints", s.ID, footprint); err != nil {
+			return nil, stacktrace.Propagate(err, "Error storing footprint of Constraint")
+		}
+	}
+	if err := c.recordConstraintVersion(ctx, s); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
+// recordConstraintVersion keeps the current version of constraint,
+// identified by its OVN, if the schema holds versions.
+func (c *repo) recordConstraintVersion(ctx context.Context, constraint *scdmodels.Constraint) error {
+	if !c.supports(v390) {
+		return nil
+	}
+	versionQuery := fmt.Sprintf(`
+		UPSERT INTO
+			scd_constraint_versions
+			(ovn, %[1]s)
+		SELECT
+			$1, %[1]s
+		FROM
+			scd_constraints
+		WHERE
+			id = $2`, c.constraintVersionColumns(new(scdmodels.Constraint), new(constraintRow)).Names(""))
+	if _, err := c.q.ExecContext(ctx, versionQuery, constraint.OVN, constraint.ID); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", versionQuery)
+	}
+	return nil
+}
+
+// Implements scd.repos.Constraint.ListConstraintVersions
+func (c *repo) ListConstraintVersions(ctx context.Context, id dssmodels.ID) ([]*scdmodels.Constraint, error) {
+	if !c.supports(v390) {
+		return nil, stacktrace.NewError("Listing versions of constraints requires strategic conflict detection schema %s", v390)
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_constraint_versions
+		WHERE
+			id = $1
+		ORDER BY
+			updated_at`, c.constraintFields(false))
+	versions, err := c.fetchConstraints(ctx, c.q, query, id)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error fetching Constraint versions")
+	}
+	if versions == nil {
+		versions = []*scdmodels.Constraint{}
+	}
+	return versions, nil
+}
+
 // Implements scd.repos.Constraint.DeleteConstraint
 func (c *repo) DeleteConstraint(ctx context.Context, id dssmodels.ID) error {
 	const (
@@ -185,31 +256,27 @@ func (c *repo) DeleteConstraint(ctx context.Context, id dssmodels.ID) error {
 	return nil
 }
 
-// Implements scd.repos.Constraint.SearchConstraints
-func (c *repo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.Constraint, error) {
-	var (
-		query = fmt.Sprintf(`
-			SELECT
-				%s
-			FROM
-				scd_constraints
-			WHERE
-			  cells && $1
-			AND
-				COALESCE(starts_at <= $3, true)
-			AND
-				COALESCE(ends_at >= $2, true)`, constraintFieldsWithoutPrefix)
-	)
+// searchConstraintsQuery returns the query selecting the constraints
+// intersecting v4d and passing filter, and its arguments, or an empty query
+// if v4d covers no cells or filter excludes every constraint.
+func (c *repo) searchConstraintsQuery(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) (string, []interface{}, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_constraints
+		WHERE
+			cells && $1`, c.constraintFields(false))
 
 	// TODO: Lazily calculate & cache spatial covering so that it is only ever
 	// computed once on a particular Volume4D
 	cells, err := v4d.CalculateSpatialCovering()
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
+		return "", nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
 	}
 
 	if len(cells) == 0 {
-		return []*scdmodels.Constraint{}, nil
+		return "", nil, nil
 	}
 
 	cids := make([]int64, len(cells))
@@ -217,8 +284,42 @@ func (c *repo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D) (
 		cids[i] = int64(cell)
 	}
 
-	constraints, err := c.fetchConstraints(
-		ctx, c.q, query, pq.Array(cids), v4d.StartTime, v4d.EndTime)
+	args := []interface{}{pq.Array(cids)}
+	query, args = restrictToTimeRange(query, args, "", v4d.StartTime, v4d.EndTime)
+	if len(filter.Types) > 0 {
+		if !c.supports(v380) {
+			// Every constraint is a restriction.
+			if !filter.Matches(&scdmodels.Constraint{Type: scdmodels.ConstraintTypeRestriction}) {
+				return "", nil, nil
+			}
+		} else {
+			types := make([]string, len(filter.Types))
+			for i, t := range filter.Types {
+				types[i] = string(t)
+			}
+			args = append(args, pq.Array(types))
+			query += fmt.Sprintf(" AND type = ANY($%d)", len(args))
+		}
+	}
+	if c.supports(v310) {
+		query, args = cockroach.RestrictToRegions(query, args, "region", cells)
+	}
+	query, args = cockroach.OrderBy(query, args, dssmodels.SearchOrderFromContext(ctx), c.clock.Now(), "starts_at", "ends_at", "id")
+
+	return query, args, nil
+}
+
+// Implements scd.repos.Constraint.SearchConstraints
+func (c *repo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) ([]*scdmodels.Constraint, error) {
+	query, args, err := c.searchConstraintsQuery(ctx, v4d, filter)
+	if err != nil {
+		return nil, err
+	}
+	if query == "" {
+		return []*scdmodels.Constraint{}, nil
+	}
+
+	constraints, err := c.fetchConstraints(ctx, c.q, query, args...)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error fetching Constraints")
 	}
@@ -0,0 +1,63 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/interuss/stacktrace"
+)
+
+// ClaimExpiryScan implements store.ExpiryScanLedger interface, holding the
+// progress and the lease of the scans in the single row of scd_expiry_scans.
+func (s *Store) ClaimExpiryScan(ctx context.Context, holder string, now, until, leaseEnd time.Time) (time.Time, bool, error) {
+	const (
+		selectQuery = `
+			SELECT
+				scanned_until, holder, lease_expires_at
+			FROM
+				scd_expiry_scans
+			FOR UPDATE`
+		upsertQuery = `
+			UPSERT INTO
+				scd_expiry_scans
+				(scanned_until, holder, lease_expires_at)
+			VALUES
+				($1, $2, $3)`
+	)
+
+	if !s.supports(v3140) {
+		return time.Time{}, false, stacktrace.NewError("Expiry scans require schema version %s of %s, got %s", v3140, DatabaseName, s.schema)
+	}
+	var (
+		after   time.Time
+		claimed bool
+	)
+	err := s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		var (
+			leaseHolder    string
+			leaseExpiresAt time.Time
+		)
+		after, claimed = time.Time{}, false
+		err := tx.QueryRowContext(ctx, selectQuery).Scan(&after, &leaseHolder, &leaseExpiresAt)
+		if err != nil && err != sql.ErrNoRows {
+			return stacktrace.Propagate(err, "Error in query: %s", selectQuery)
+		}
+		if err == nil && leaseHolder != holder && now.Before(leaseExpiresAt) {
+			return nil
+		}
+		scannedUntil := until
+		if after.After(until) {
+			scannedUntil = after
+		}
+		if _, err := tx.ExecContext(ctx, upsertQuery, scannedUntil, holder, leaseEnd); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", upsertQuery)
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return after, claimed, nil
+}
@@ -0,0 +1,52 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/interuss/stacktrace"
+)
+
+// PurgeVersions deletes the versions of operational intents and constraints
+// written before "before", but for the current versions of existing
+// entities, and returns how many were deleted. The versions of constraints
+// are only kept starting with schema 3.9.0.
+func (s *Store) PurgeVersions(ctx context.Context, before time.Time) (int64, error) {
+	tables := map[string]string{}
+	if s.supports(v320) {
+		tables["scd_operation_versions"] = "scd_operations"
+	}
+	if s.supports(v390) {
+		tables["scd_constraint_versions"] = "scd_constraints"
+	}
+
+	var purged int64
+	for versions, entities := range tables {
+		query := fmt.Sprintf(`
+			DELETE FROM
+				%[1]s AS v
+			WHERE
+				v.updated_at < $1
+			AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					%[2]s AS e
+				WHERE
+					e.id = v.id
+				AND
+					e.updated_at = v.updated_at
+			)`, versions, entities)
+		res, err := s.db.ExecContext(ctx, query, before)
+		if err != nil {
+			return purged, stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return purged, stacktrace.Propagate(err, "Could not get RowsAffected")
+		}
+		purged += n
+	}
+	return purged, nil
+}
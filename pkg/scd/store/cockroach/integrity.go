@@ -0,0 +1,159 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+	"github.com/interuss/stacktrace"
+)
+
+// The integrity violations of operational intents found by CheckIntegrity.
+const (
+	// ViolationMissingSubscription is an operational intent referencing a
+	// subscription which does not exist.
+	ViolationMissingSubscription = "missing_subscription"
+	// ViolationNoCells is an operational intent covering no cell, which no
+	// search can find.
+	ViolationNoCells = "no_cells"
+	// ViolationTooManyCells is an operational intent covering more cells
+	// than allowed.
+	ViolationTooManyCells = "too_many_cells"
+)
+
+// IntegrityViolation is an operational intent failing an integrity check,
+// typically because it was written by an older or faulty binary.
+type IntegrityViolation struct {
+	ID        dssmodels.ID
+	Manager   dssmodels.Manager
+	Violation string
+	// Cells is the number of cells covered.
+	Cells int
+	// MaxCells is the limit of cells the operational intent was checked
+	// against, if positive.
+	MaxCells int
+}
+
+// violationsQuery selects the operational intents failing the integrity
+// check with a limit of $1 cells.
+const violationsQuery = `
+	SELECT
+		o.id,
+		o.owner,
+		COALESCE(array_length(o.cells, 1), 0) AS n,
+		o.subscription_id IS NOT NULL AND s.id IS NULL
+	FROM
+		scd_operations AS o
+	LEFT JOIN
+		scd_subscriptions AS s ON s.id = o.subscription_id
+	WHERE
+		(
+			(o.subscription_id IS NOT NULL AND s.id IS NULL)
+		OR
+			COALESCE(array_length(o.cells, 1), 0) = 0
+		OR
+			($1 > 0 AND array_length(o.cells, 1) > $1)
+		)`
+
+// scanViolation scans a row of violationsQuery.
+func scanViolation(scan func(...interface{}) error, maxCells int) (IntegrityViolation, error) {
+	var (
+		v                   = IntegrityViolation{MaxCells: maxCells}
+		missingSubscription bool
+	)
+	if err := scan(&v.ID, &v.Manager, &v.Cells, &missingSubscription); err != nil {
+		return v, err
+	}
+	switch {
+	case missingSubscription:
+		v.Violation = ViolationMissingSubscription
+	case v.Cells == 0:
+		v.Violation = ViolationNoCells
+	default:
+		v.Violation = ViolationTooManyCells
+	}
+	return v, nil
+}
+
+// CheckIntegrity returns the operational intents which reference a missing
+// subscription, or cover no cell or, if maxCells is positive, more than
+// maxCells cells. The scan is served by follower reads where enabled.
+func (s *Store) CheckIntegrity(ctx context.Context, maxCells int) ([]IntegrityViolation, error) {
+	tx, err := s.db.BeginFollowerRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing is ever written in tx, so there is nothing to commit.
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, violationsQuery, maxCells)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", violationsQuery)
+	}
+	defer rows.Close()
+
+	var result []IntegrityViolation
+	for rows.Next() {
+		v, err := scanViolation(rows.Scan, maxCells)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning operational intent row")
+		}
+		result = append(result, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// Quarantine moves the operational intent of v to
+// scd_quarantined_operations, where pool operators may inspect it, and
+// removes it from the API. As v may come from a stale follower read, the
+// operational intent is checked again in the transaction moving it, and left
+// in place if it no longer fails the check; Quarantine returns whether it was
+// moved.
+func (s *Store) Quarantine(ctx context.Context, v IntegrityViolation) (bool, error) {
+	if !s.supports(v330) {
+		return false, stacktrace.NewError("Quarantining operational intents requires schema version %s", v330)
+	}
+	const (
+		checkQuery = violationsQuery + `
+			AND
+				o.id = $2`
+		insertQuery = `
+			UPSERT INTO
+				scd_quarantined_operations
+				(id, quarantined_at, violation, operation)
+			SELECT
+				id, now(), $2, row_to_json(scd_operations.*)::JSONB
+			FROM
+				scd_operations
+			WHERE
+				id = $1`
+		deleteQuery = `
+			DELETE FROM
+				scd_operations
+			WHERE
+				id = $1`
+	)
+	var quarantined bool
+	err := s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		quarantined = false
+		current, err := scanViolation(tx.QueryRowContext(ctx, checkQuery, v.MaxCells, v.ID).Scan, v.MaxCells)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", checkQuery)
+		}
+		if _, err := tx.ExecContext(ctx, insertQuery, v.ID, current.Violation); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", insertQuery)
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery, v.ID); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", deleteQuery)
+		}
+		quarantined = true
+		return nil
+	})
+	return quarantined, err
+}
@@ -0,0 +1,337 @@
+package cockroach
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	invariantWorkers = flag.Int("invariant-workers", 8, "number of concurrent workers of TestConcurrentInvariants")
+	invariantActions = flag.Int("invariant-actions", 50, "number of random actions performed by each worker of TestConcurrentInvariants")
+	invariantSeed    = flag.Int64("invariant-seed", 0, "seed of the random actions of TestConcurrentInvariants, worker i using seed+i; random if 0")
+)
+
+// tickingClock is a clock advancing by a second on every reading, so that
+// every write gets a distinct OVN, OVNs having a resolution of a second.
+type tickingClock struct {
+	clockwork.Clock
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+// invariantHarness holds the entities TestConcurrentInvariants works on and
+// what the workers observed of their committed writes.
+type invariantHarness struct {
+	store      *Store
+	start, end time.Time
+	// operationIDs are the operational intents upserted and deleted, whose
+	// subscriptions are drawn from subscriptionIDs, which may be deleted
+	// once no operational intent depends on them.
+	operationIDs    []dssmodels.ID
+	subscriptionIDs []dssmodels.ID
+	// counterIDs are subscriptions depending on no operational intent,
+	// never deleted, whose notification indices are incremented by every
+	// write of an operational intent.
+	counterIDs []dssmodels.ID
+
+	mu sync.Mutex
+	// ovns are the OVNs of the committed writes of each operational intent.
+	ovns map[dssmodels.ID][]scdmodels.OVN
+	// indices are the notification indices returned by the committed
+	// increments of each counter.
+	indices map[dssmodels.ID][]int
+}
+
+func (h *invariantHarness) subscription(id dssmodels.ID, manager dssmodels.Manager) *scdmodels.Subscription {
+	return &scdmodels.Subscription{
+		ID:                          id,
+		Manager:                     manager,
+		StartTime:                   &h.start,
+		EndTime:                     &h.end,
+		USSBaseURL:                  "https://" + manager.String() + ".example.com",
+		NotifyForOperationalIntents: true,
+		Cells:                       cells,
+	}
+}
+
+// tolerated returns true if err may result from concurrent writes rather
+// than from a bug: a write conflict or a transaction still contended after
+// its retries.
+func tolerated(err error) bool {
+	switch stacktrace.GetCode(err) {
+	case dsserr.VersionMismatch, dsserr.Unavailable:
+		return true
+	}
+	return false
+}
+
+// upsertOperationalIntent writes a new version of the operational intent
+// id, with a subscription recreated if it was deleted, and increments the
+// notification indices of the counters like the notification of the
+// subscribers would.
+func (h *invariantHarness) upsertOperationalIntent(ctx context.Context, rnd *rand.Rand, id dssmodels.ID) error {
+	var (
+		previous, ovn scdmodels.OVN
+		indices       []int
+	)
+	subID := h.subscriptionIDs[rnd.Intn(len(h.subscriptionIDs))]
+	err := h.store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		old, err := repo.GetOperationalIntent(ctx, id)
+		if err != nil {
+			return err
+		}
+		op := &scdmodels.OperationalIntent{
+			ID:             id,
+			Manager:        "uss1",
+			Version:        1,
+			State:          scdmodels.OperationalIntentStateAccepted,
+			StartTime:      &h.start,
+			EndTime:        &h.end,
+			USSBaseURL:     "https://uss1.example.com",
+			SubscriptionID: subID,
+			Cells:          cells,
+		}
+		previous = ""
+		if old != nil {
+			previous = old.OVN
+			op.Version = old.Version + 1
+		}
+		sub, err := repo.GetSubscription(ctx, subID)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			if _, err := repo.UpsertSubscription(ctx, h.subscription(subID, "uss1"), ""); err != nil {
+				return err
+			}
+		}
+		op, err = repo.UpsertOperationalIntent(ctx, op, previous)
+		if err != nil {
+			return err
+		}
+		ovn = op.OVN
+		indices, err = repo.IncrementNotificationIndices(ctx, h.counterIDs)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if ovn == previous {
+		return stacktrace.NewError("Upsert of operational intent %s kept OVN %s", id, ovn)
+	}
+	h.record(id, ovn, indices)
+	return nil
+}
+
+// deleteOperationalIntent deletes the operational intent id, if it exists.
+func (h *invariantHarness) deleteOperationalIntent(ctx context.Context, id dssmodels.ID) error {
+	var indices []int
+	err := h.store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		indices = nil
+		old, err := repo.GetOperationalIntent(ctx, id)
+		if err != nil || old == nil {
+			return err
+		}
+		if err := repo.DeleteOperationalIntent(ctx, id); err != nil {
+			return err
+		}
+		indices, err = repo.IncrementNotificationIndices(ctx, h.counterIDs)
+		return err
+	})
+	if err != nil || indices == nil {
+		return err
+	}
+	h.record(id, "", indices)
+	return nil
+}
+
+// deleteSubscription deletes the subscription id if no operational intent
+// depends on it, like the DSS does.
+func (h *invariantHarness) deleteSubscription(ctx context.Context, id dssmodels.ID) error {
+	return h.store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		sub, err := repo.GetSubscription(ctx, id)
+		if err != nil || sub == nil {
+			return err
+		}
+		dependents, err := repo.GetDependentOperationalIntents(ctx, id)
+		if err != nil || len(dependents) > 0 {
+			return err
+		}
+		return repo.DeleteSubscription(ctx, id)
+	})
+}
+
+// search checks that the operational intents found reference existing
+// subscriptions, as read in the same transaction.
+func (h *invariantHarness) search(ctx context.Context) error {
+	return h.store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		ops, err := repo.SearchOperationalIntents(ctx, &dssmodels.Volume4D{
+			StartTime:     &h.start,
+			EndTime:       &h.end,
+			SpatialVolume: &dssmodels.Volume3D{Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) { return cells, nil })},
+		}, true, scdmodels.OperationalIntentFilter{})
+		if err != nil {
+			return err
+		}
+		for _, op := range ops {
+			sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				return stacktrace.NewError("Operational intent %s found without its subscription %s", op.ID, op.SubscriptionID)
+			}
+		}
+		return nil
+	})
+}
+
+func (h *invariantHarness) record(id dssmodels.ID, ovn scdmodels.OVN, indices []int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ovn != "" {
+		h.ovns[id] = append(h.ovns[id], ovn)
+	}
+	for i, counter := range h.counterIDs {
+		h.indices[counter] = append(h.indices[counter], indices[i])
+	}
+}
+
+// TestConcurrentInvariants runs random concurrent writes and searches of
+// operational intents and subscriptions against a real CockroachDB, and
+// checks the invariants the isolation of transactions should guarantee:
+//   - no operational intent references a missing subscription,
+//   - no increment of a notification index is lost or duplicated,
+//   - every write of an operational intent changes its OVN.
+//
+// Failures report the seed reproducing the actions of the workers, although
+// their interleaving depends on scheduling.
+func TestConcurrentInvariants(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if testing.Short() {
+		t.Skip("Skipped in short mode")
+	}
+	seed := *invariantSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("Seed: %d", seed)
+
+	start := fakeClock.Now()
+	store.clock = &tickingClock{Clock: fakeClock, now: start}
+	h := &invariantHarness{
+		store:   store,
+		start:   start,
+		end:     start.Add(24 * time.Hour),
+		ovns:    map[dssmodels.ID][]scdmodels.OVN{},
+		indices: map[dssmodels.ID][]int{},
+	}
+	newIDs := func(n int) []dssmodels.ID {
+		ids := make([]dssmodels.ID, n)
+		for i := range ids {
+			ids[i] = dssmodels.ID(uuid.New().String())
+		}
+		return ids
+	}
+	h.operationIDs = newIDs(8)
+	h.subscriptionIDs = newIDs(3)
+	h.counterIDs = newIDs(2)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	for _, id := range append(h.subscriptionIDs, h.counterIDs...) {
+		_, err := repo.UpsertSubscription(ctx, h.subscription(id, "uss2"), "")
+		require.NoError(t, err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, *invariantWorkers)
+	)
+	for w := 0; w < *invariantWorkers; w++ {
+		wg.Add(1)
+		go func(rnd *rand.Rand) {
+			defer wg.Done()
+			for i := 0; i < *invariantActions; i++ {
+				var err error
+				switch action := rnd.Intn(10); {
+				case action < 5:
+					err = h.upsertOperationalIntent(ctx, rnd, h.operationIDs[rnd.Intn(len(h.operationIDs))])
+				case action < 7:
+					err = h.deleteOperationalIntent(ctx, h.operationIDs[rnd.Intn(len(h.operationIDs))])
+				case action < 8:
+					err = h.deleteSubscription(ctx, h.subscriptionIDs[rnd.Intn(len(h.subscriptionIDs))])
+				default:
+					err = h.search(ctx)
+				}
+				if err != nil && !tolerated(err) {
+					errs <- err
+					return
+				}
+			}
+		}(rand.New(rand.NewSource(seed + int64(w))))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// No operational intent is left without its subscription.
+	for _, id := range h.operationIDs {
+		op, err := repo.GetOperationalIntent(ctx, id)
+		require.NoError(t, err)
+		if op == nil {
+			continue
+		}
+		sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+		require.NoError(t, err)
+		require.NotNil(t, sub, "Operational intent %s left without its subscription %s", id, op.SubscriptionID)
+	}
+
+	// The increments returned 1, 2, ... n, the final index, each once.
+	for _, id := range h.counterIDs {
+		sub, err := repo.GetSubscription(ctx, id)
+		require.NoError(t, err)
+		indices := h.indices[id]
+		sort.Ints(indices)
+		require.Len(t, indices, sub.NotificationIndex, "Increments of subscription %s lost", id)
+		for i, index := range indices {
+			require.Equal(t, i+1, index, "Notification index of subscription %s returned twice or skipped", id)
+		}
+	}
+
+	// Every committed write of an operational intent got a distinct OVN.
+	for id, ovns := range h.ovns {
+		seen := map[scdmodels.OVN]bool{}
+		for _, ovn := range ovns {
+			require.False(t, seen[ovn], "OVN %s of operational intent %s reused", ovn, id)
+			seen[ovn] = true
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cockroach
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// Layout is a secondary layout of the strategic conflict detection tables,
+// holding a copy of part of an entity table organized for other queries.
+// Tables are restructured without downtime by writing the new layout
+// alongside the entity table (dual writes), backfilling it, reading from it
+// with the matching SpatialIndex and, should it replace another secondary
+// layout, no longer writing the latter. The entity tables remain the source
+// of truth of the entities and are always written.
+type Layout string
+
+const (
+	// LayoutCellsTable lists the cells of operational intents in
+	// cells_scd_operations, read by CellsTableIndex.
+	LayoutCellsTable Layout = "cells_scd_operations"
+	// LayoutOperationFootprints keeps the exact footprints of operational
+	// intents in scd_operations.footprint, read by GeographyIndex.
+	LayoutOperationFootprints Layout = "scd_operations.footprint"
+	// LayoutConstraintFootprints keeps the exact footprints of constraints in
+	// scd_constraints.footprint.
+	LayoutConstraintFootprints Layout = "scd_constraints.footprint"
+)
+
+// Layouts are the secondary layouts, all dual-written by default when the
+// schema holds them.
+var Layouts = []Layout{LayoutCellsTable, LayoutOperationFootprints, LayoutConstraintFootprints}
+
+// ParseLayouts parses a comma-separated list of layouts.
+func ParseLayouts(s string) ([]Layout, error) {
+	var layouts []Layout
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		layout := Layout(name)
+		known := false
+		for _, l := range Layouts {
+			known = known || l == layout
+		}
+		if !known {
+			return nil, stacktrace.NewError("Unknown layout %s", name)
+		}
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// held returns whether the schema of s holds layout.
+func (s *Store) held(layout Layout) bool {
+	switch layout {
+	case LayoutCellsTable:
+		return s.supports(v340)
+	case LayoutOperationFootprints, LayoutConstraintFootprints:
+		return s.supports(v360)
+	}
+	return false
+}
+
+// dualWritten returns the secondary layouts written by s along with the
+// entity tables.
+func (s *Store) dualWritten() map[Layout]bool {
+	written := map[Layout]bool{}
+	for _, layout := range Layouts {
+		if s.held(layout) && (s.dualWrites == nil || s.dualWrites[layout]) {
+			written[layout] = true
+		}
+	}
+	return written
+}
+
+// readLayout returns the secondary layout index reads from, if any.
+func readLayout(index SpatialIndex) (Layout, bool) {
+	switch index.(type) {
+	case CellsTableIndex:
+		return LayoutCellsTable, true
+	case GeographyIndex:
+		return LayoutOperationFootprints, true
+	}
+	return "", false
+}
+
+// SetDualWrites makes the writes of s maintain exactly layouts, which must be
+// held by the schema, besides the entity tables. The layout read by the
+// SpatialIndex in use must be among them.
+func (s *Store) SetDualWrites(layouts []Layout) error {
+	dualWrites := map[Layout]bool{}
+	for _, layout := range layouts {
+		if !s.held(layout) {
+			return stacktrace.NewError("Layout %s is not held by the strategic conflict detection schema", layout)
+		}
+		dualWrites[layout] = true
+	}
+	if layout, ok := readLayout(s.index); ok && !dualWrites[layout] {
+		return stacktrace.NewError("Layout %s is read by spatial index %s and must be written", layout, s.index.Name())
+	}
+	s.dualWrites = dualWrites
+	return nil
+}
+
+// DualWrites returns the secondary layouts written by s, sorted by name.
+func (s *Store) DualWrites() []Layout {
+	var layouts []Layout
+	for layout := range s.dualWritten() {
+		layouts = append(layouts, layout)
+	}
+	sort.Slice(layouts, func(i, j int) bool { return layouts[i] < layouts[j] })
+	return layouts
+}
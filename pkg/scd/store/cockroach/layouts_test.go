@@ -0,0 +1,64 @@
+package cockroach
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLayouts(t *testing.T) {
+	layouts, err := ParseLayouts("cells_scd_operations, scd_constraints.footprint,")
+	require.NoError(t, err)
+	require.Equal(t, []Layout{LayoutCellsTable, LayoutConstraintFootprints}, layouts)
+
+	layouts, err = ParseLayouts("")
+	require.NoError(t, err)
+	require.Empty(t, layouts)
+
+	_, err = ParseLayouts("scd_operations.cells")
+	require.Error(t, err)
+}
+
+func TestSetDualWrites(t *testing.T) {
+	store := &Store{schema: v340, index: InvertedIndex{}}
+	// By default, the layouts held by the schema are all written.
+	require.Equal(t, []Layout{LayoutCellsTable}, store.DualWrites())
+	require.Error(t, store.SetDualWrites([]Layout{LayoutOperationFootprints}))
+
+	require.NoError(t, store.UseSpatialIndex(CellsTableIndex{}.Name()))
+	require.Error(t, store.SetDualWrites(nil))
+	require.NoError(t, store.UseSpatialIndex(InvertedIndex{}.Name()))
+	require.NoError(t, store.SetDualWrites(nil))
+	require.Empty(t, store.DualWrites())
+	require.Empty(t, store.newRepo(nil).dualWrites)
+	require.Error(t, store.UseSpatialIndex(CellsTableIndex{}.Name()))
+
+	require.NoError(t, store.SetDualWrites([]Layout{LayoutCellsTable}))
+	require.True(t, store.newRepo(nil).dualWrites[LayoutCellsTable])
+	require.NoError(t, store.UseSpatialIndex(CellsTableIndex{}.Name()))
+}
+
+func TestLayoutsBySchema(t *testing.T) {
+	for _, c := range []struct {
+		schema     string
+		dualWrites []Layout
+		indexes    []string
+	}{
+		{"3.0.0", nil, []string{"inverted"}},
+		{"3.4.0", []Layout{LayoutCellsTable}, []string{"inverted", "cells_table"}},
+		{"3.5.0", []Layout{LayoutCellsTable}, []string{"inverted", "cells_table"}},
+		{"3.6.0", []Layout{LayoutCellsTable, LayoutConstraintFootprints, LayoutOperationFootprints}, []string{"inverted", "cells_table", "geography"}},
+		{"3.12.0", []Layout{LayoutCellsTable, LayoutConstraintFootprints, LayoutOperationFootprints}, []string{"inverted", "cells_table", "geography"}},
+	} {
+		store := &Store{schema: *semver.New(c.schema), index: InvertedIndex{}}
+		require.Equal(t, c.dualWrites, store.DualWrites(), c.schema)
+		var indexes []string
+		for _, name := range []string{"inverted", "cells_table", "geography"} {
+			if store.UseSpatialIndex(name) == nil {
+				indexes = append(indexes, name)
+			}
+		}
+		require.Equal(t, c.indexes, indexes, c.schema)
+	}
+}
@@ -0,0 +1,188 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	dsssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// encodeOperationVolumes returns the value of the volumes column holding the
+// volumes of o, in the wire format of the details of operational intents, or
+// NULL if they are unknown.
+func encodeOperationVolumes(o *scdmodels.OperationalIntent) (sql.NullString, error) {
+	if len(o.Volumes) == 0 && len(o.OffNominalVolumes) == 0 {
+		return sql.NullString{}, nil
+	}
+	var (
+		details = &scdpb.OperationalIntentDetails{}
+		err     error
+	)
+	if details.Volumes, err = volumesToSCDProto(o.Volumes); err != nil {
+		return sql.NullString{}, stacktrace.Propagate(err, "Error converting volumes of Operation")
+	}
+	if details.OffNominalVolumes, err = volumesToSCDProto(o.OffNominalVolumes); err != nil {
+		return sql.NullString{}, stacktrace.Propagate(err, "Error converting off-nominal volumes of Operation")
+	}
+	data, err := dssmodels.MarshalAPIJSON(details)
+	if err != nil {
+		return sql.NullString{}, stacktrace.Propagate(err, "Error encoding volumes of Operation")
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// decodeOperationVolumes sets the volumes of o to those held by data, the
+// value of its volumes column, leaving them nil if data is NULL.
+func decodeOperationVolumes(o *scdmodels.OperationalIntent, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	details := &scdpb.OperationalIntentDetails{}
+	if err := dssmodels.UnmarshalAPIJSON(data, details); err != nil {
+		return stacktrace.Propagate(err, "Error decoding volumes of Operation %s", o.ID)
+	}
+	var err error
+	if o.Volumes, err = volumesFromSCDProto(details.GetVolumes()); err != nil {
+		return stacktrace.Propagate(err, "Error converting volumes of Operation %s", o.ID)
+	}
+	if o.OffNominalVolumes, err = volumesFromSCDProto(details.GetOffNominalVolumes()); err != nil {
+		return stacktrace.Propagate(err, "Error converting off-nominal volumes of Operation %s", o.ID)
+	}
+	return nil
+}
+
+func volumesToSCDProto(volumes []*dssmodels.Volume4D) ([]*scdpb.Volume4D, error) {
+	result := make([]*scdpb.Volume4D, len(volumes))
+	for i, volume := range volumes {
+		pb, err := volume.ToSCDProto()
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error converting volume %d", i)
+		}
+		result[i] = pb
+	}
+	return result, nil
+}
+
+func volumesFromSCDProto(volumes []*scdpb.Volume4D) ([]*dssmodels.Volume4D, error) {
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	result := make([]*dssmodels.Volume4D, len(volumes))
+	for i, pb := range volumes {
+		volume, err := dssmodels.Volume4DFromSCDProto(pb)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error converting volume %d", i)
+		}
+		result[i] = volume
+	}
+	return result, nil
+}
+
+// indexOperationVolumes makes scd_operation_volumes list exactly the volumes
+// of o, nominal then off-nominal, so that searches select o by the volumes
+// intersecting them rather than by their union.
+func indexOperationVolumes(ctx context.Context, q dsssql.Queryable, o *scdmodels.OperationalIntent) error {
+	const deleteQuery = `
+		DELETE FROM
+			scd_operation_volumes
+		WHERE
+			operation_id = $1`
+	if _, err := q.ExecContext(ctx, deleteQuery, o.ID); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", deleteQuery)
+	}
+
+	var (
+		names  string
+		rows   []string
+		args   []interface{}
+		offset = len(o.Volumes)
+	)
+	for i, volume := range o.Extents() {
+		if volume.SpatialVolume == nil {
+			return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing spatial volume in volume %d of Operation", i)
+		}
+		cells, err := volume.CalculateSpatialCovering()
+		if err != nil {
+			return stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid volume %d of Operation", i)
+		}
+		cids := make([]int64, len(cells))
+		for j, cell := range cells {
+			cids[j] = int64(cell)
+		}
+		columns := dsssql.Columns{
+			{Name: "operation_id", Value: o.ID},
+			{Name: "volume_index", Value: i},
+			{Name: "off_nominal", Value: i >= offset},
+			{Name: "altitude_lower", Value: volume.SpatialVolume.AltitudeLo},
+			{Name: "altitude_upper", Value: volume.SpatialVolume.AltitudeHi},
+			{Name: "starts_at", Value: volume.StartTime},
+			{Name: "ends_at", Value: volume.EndTime},
+			{Name: "cells", Value: pq.Int64Array(cids)},
+		}
+		names = columns.Names("")
+		rows = append(rows, fmt.Sprintf("(%s)", columns.Placeholders(len(args))))
+		args = append(args, columns.Values()...)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO
+			scd_operation_volumes
+			(%s)
+		VALUES
+			%s`, names, strings.Join(rows, ",\n\t\t\t"))
+	if _, err := q.ExecContext(ctx, insertQuery, args...); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", insertQuery)
+	}
+	return nil
+}
+
+// restrictToOperationVolumes restricts query to the operations with a volume
+// intersecting the volume searched, whose cells and altitude bounds are
+// the arguments $1, $2 and $3 of query, over [start, end]. Operations
+// without volumes in scd_operation_volumes, written before schema 3.12.0,
+// are kept. It returns the restricted query with its arguments.
+func restrictToOperationVolumes(query string, args []interface{}, start, end *time.Time) (string, []interface{}) {
+	volumes := `
+				SELECT
+					1
+				FROM
+					scd_operation_volumes AS v
+				WHERE
+					v.operation_id = scd_operations.id`
+	intersecting := volumes + `
+				AND
+					v.cells && $1
+				AND
+					COALESCE(v.altitude_upper >= $2, true)
+				AND
+					COALESCE(v.altitude_lower <= $3, true)`
+	if start != nil {
+		args = append(args, *start)
+		intersecting += fmt.Sprintf(`
+				AND
+					COALESCE(v.ends_at >= $%d, true)`, len(args))
+	}
+	if end != nil {
+		args = append(args, *end)
+		intersecting += fmt.Sprintf(`
+				AND
+					COALESCE(v.starts_at <= $%d, true)`, len(args))
+	}
+	query += fmt.Sprintf(`
+		AND
+			(NOT EXISTS (%s
+			) OR EXISTS (%s
+			))`, volumes, intersecting)
+	return query, args
+}
@@ -2,11 +2,12 @@ package cockroach
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/cockroach"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
@@ -15,39 +16,93 @@ import (
 	"github.com/lib/pq"
 )
 
-var (
-	operationFieldsWithIndices   [12]string
-	operationFieldsWithPrefix    string
-	operationFieldsWithoutPrefix string
-)
+// operationRow holds the columns of an operation row which are not read
+// directly into the OperationalIntent.
+type operationRow struct {
+	cells     pq.Int64Array
+	updatedAt time.Time
+	ovn       sql.NullString
+	volumes   []byte
+}
 
-// TODO Update database schema and fields below.
-func init() {
-	operationFieldsWithIndices[0] = "id"
-	operationFieldsWithIndices[1] = "owner"
-	operationFieldsWithIndices[2] = "version"
-	operationFieldsWithIndices[3] = "url"
-	operationFieldsWithIndices[4] = "altitude_lower"
-	operationFieldsWithIndices[5] = "altitude_upper"
-	operationFieldsWithIndices[6] = "starts_at"
-	operationFieldsWithIndices[7] = "ends_at"
-	operationFieldsWithIndices[8] = "subscription_id"
-	operationFieldsWithIndices[9] = "updated_at"
-	operationFieldsWithIndices[10] = "state"
-	operationFieldsWithIndices[11] = "cells"
-
-	operationFieldsWithoutPrefix = strings.Join(
-		operationFieldsWithIndices[:], ",",
-	)
+// operationVersionColumns returns the columns of operations kept by both
+// scd_operations and scd_operation_versions, read into o and row, the cells
+// and volumes columns only if withCells.
+func (s *repo) operationVersionColumns(o *scdmodels.OperationalIntent, row *operationRow, withCells bool) dsssql.Columns {
+	columns := dsssql.Columns{
+		{Name: "id", Value: &o.ID},
+		{Name: "owner", Value: &o.Manager},
+		{Name: "version", Value: &o.Version},
+		{Name: "url", Value: &o.USSBaseURL},
+		{Name: "altitude_lower", Value: &o.AltitudeLower},
+		{Name: "altitude_upper", Value: &o.AltitudeUpper},
+		{Name: "starts_at", Value: &o.StartTime},
+		{Name: "ends_at", Value: &o.EndTime},
+		{Name: "subscription_id", Value: &o.SubscriptionID},
+		{Name: "updated_at", Value: &row.updatedAt},
+		{Name: "state", Value: &o.State},
+	}
+	if s.supports(v3130) {
+		columns = columns.With("altitude_reference", &o.AltitudeReference)
+	}
+	if withCells {
+		columns = columns.With("cells", &row.cells)
+		if s.supports(v3120) {
+			columns = columns.With("volumes", &row.volumes)
+		}
+	}
+	return columns
+}
 
-	withPrefix := make([]string, len(operationFieldsWithIndices))
-	for idx, field := range operationFieldsWithIndices {
-		withPrefix[idx] = "scd_operations." + field
+// operationColumns returns the columns of operationVersionColumns followed
+// by the ovn column if the schema holds it.
+func (s *repo) operationColumns(o *scdmodels.OperationalIntent, row *operationRow, withCells bool) dsssql.Columns {
+	columns := s.operationVersionColumns(o, row, withCells)
+	if s.supports(v3100) {
+		columns = columns.With("ovn", &row.ovn)
 	}
+	return columns
+}
+
+// operationFields returns the columns read into operations, prefixed with
+// prefix, as scanned by scanOperationalIntent if withCells and by
+// scanOperationalIntentReference otherwise.
+func (s *repo) operationFields(prefix string, withCells bool) string {
+	return s.operationColumns(new(scdmodels.OperationalIntent), new(operationRow), withCells).Names(prefix)
+}
+
+// scanOperationalIntent returns the operation held by the columns
+// operationFields(prefix, true) of a row, read with scan.
+func (s *repo) scanOperationalIntent(scan func(...interface{}) error) (*scdmodels.OperationalIntent, error) {
+	return s.scanOperationalIntentColumns(scan, true)
+}
+
+// scanOperationalIntentReference returns the operation, without its cells,
+// held by the columns operationFields(prefix, false) of a row, read with
+// scan.
+func (s *repo) scanOperationalIntentReference(scan func(...interface{}) error) (*scdmodels.OperationalIntent, error) {
+	return s.scanOperationalIntentColumns(scan, false)
+}
 
-	operationFieldsWithPrefix = strings.Join(
-		withPrefix[:], ",",
+// scanOperationalIntentColumns reads the columns operationColumns of an
+// operation with scan.
+func (s *repo) scanOperationalIntentColumns(scan func(...interface{}) error, withCells bool) (*scdmodels.OperationalIntent, error) {
+	var (
+		o   = &scdmodels.OperationalIntent{}
+		row operationRow
 	)
+	if err := scan(s.operationColumns(o, &row, withCells).Values()...); err != nil {
+		return nil, err
+	}
+	o.OVN = storedOVN(row.ovn, row.updatedAt, o.ID)
+	o.UpdatedAt = row.updatedAt
+	if withCells {
+		o.SetCells(row.cells)
+		if err := decodeOperationVolumes(o, row.volumes); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
 }
 
 func (s *repo) fetchOperationalIntents(ctx context.Context, q dsssql.Queryable, query string, args ...interface{}) ([]*scdmodels.OperationalIntent, error) {
@@ -58,31 +113,11 @@ func (s *repo) fetchOperationalIntents(ctx context.Context, q dsssql.Queryable,
 	defer rows.Close()
 
 	var payload []*scdmodels.OperationalIntent
-	cids := pq.Int64Array{}
 	for rows.Next() {
-		var (
-			o         = &scdmodels.OperationalIntent{}
-			updatedAt time.Time
-		)
-		err := rows.Scan(
-			&o.ID,
-			&o.Manager,
-			&o.Version,
-			&o.USSBaseURL,
-			&o.AltitudeLower,
-			&o.AltitudeUpper,
-			&o.StartTime,
-			&o.EndTime,
-			&o.SubscriptionID,
-			&updatedAt,
-			&o.State,
-			&cids,
-		)
+		o, err := s.scanOperationalIntent(rows.Scan)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning Operation row")
 		}
-		o.OVN = scdmodels.NewOVNFromTime(updatedAt, o.ID.String())
-		o.SetCells(cids)
 		payload = append(payload, o)
 	}
 	if err := rows.Err(); err != nil {
@@ -117,7 +152,7 @@ func (s *repo) fetchOperationByID(ctx context.Context, q dsssql.Queryable, id ds
 		SELECT %s FROM
 			scd_operations
 		WHERE
-			id = $1`, operationFieldsWithoutPrefix)
+			id = $1`, s.operationFields("", true))
 	return s.fetchOperationalIntent(ctx, q, query, id)
 }
 
@@ -156,6 +191,30 @@ func (s *repo) GetOperationalIntent(ctx context.Context, id dssmodels.ID) (*scdm
 	return s.fetchOperationByID(ctx, s.q, id)
 }
 
+// GetOperationalIntentCells implements repos.OperationalIntent.GetOperationalIntentCells.
+func (s *repo) GetOperationalIntentCells(ctx context.Context, id dssmodels.ID) (s2.CellUnion, error) {
+	const query = `
+		SELECT
+			cells
+		FROM
+			scd_operations
+		WHERE
+			id = $1`
+
+	cids := pq.Int64Array{}
+	if err := s.q.QueryRowContext(ctx, query, id).Scan(&cids); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	cells := make(s2.CellUnion, len(cids))
+	for i, cid := range cids {
+		cells[i] = s2.CellID(uint64(cid))
+	}
+	return cells, nil
+}
+
 // DeleteOperation implements repos.Operation.DeleteOperation.
 func (s *repo) DeleteOperationalIntent(ctx context.Context, id dssmodels.ID) error {
 	var (
@@ -183,18 +242,7 @@ func (s *repo) DeleteOperationalIntent(ctx context.Context, id dssmodels.ID) err
 }
 
 // UpsertOperation implements repos.Operation.UpsertOperation.
-func (s *repo) UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent) (*scdmodels.OperationalIntent, error) {
-	var (
-		upsertOperationsQuery = fmt.Sprintf(`
-			UPSERT INTO
-				scd_operations
-				(%s)
-			VALUES
-				($1, $2, $3, $4, $5, $6, $7, $8, $9, transaction_timestamp(), $10, $11)
-			RETURNING
-				%s`, operationFieldsWithoutPrefix, operationFieldsWithPrefix)
-	)
-
+func (s *repo) UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent, previous scdmodels.OVN) (*scdmodels.OperationalIntent, error) {
 	cids := make([]int64, len(operation.Cells))
 	clevels := make([]int, len(operation.Cells))
 
@@ -203,56 +251,238 @@ func (s *repo) UpsertOperationalIntent(ctx context.Context, operation *scdmodels
 		clevels[i] = cell.Level()
 	}
 
-	cells := operation.Cells
-	operation, err := s.fetchOperationalIntent(ctx, s.q, upsertOperationsQuery,
-		operation.ID,
-		operation.Manager,
-		operation.Version,
-		operation.USSBaseURL,
-		operation.AltitudeLower,
-		operation.AltitudeUpper,
-		operation.StartTime,
-		operation.EndTime,
-		operation.SubscriptionID,
-		operation.State,
-		pq.Int64Array(cids),
-	)
+	cells, footprint := operation.Cells, operation.Footprint
+	columns := dsssql.Columns{
+		{Name: "id", Value: operation.ID},
+		{Name: "owner", Value: operation.Manager},
+		{Name: "version", Value: operation.Version},
+		{Name: "url", Value: operation.USSBaseURL},
+		{Name: "altitude_lower", Value: operation.AltitudeLower},
+		{Name: "altitude_upper", Value: operation.AltitudeUpper},
+		{Name: "starts_at", Value: operation.StartTime},
+		{Name: "ends_at", Value: operation.EndTime},
+		{Name: "subscription_id", Value: operation.SubscriptionID},
+		{Name: "updated_at", Value: s.clock.Now()},
+		{Name: "state", Value: operation.State},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+	}
+	if s.supports(v3130) {
+		columns = columns.With("altitude_reference", operation.AltitudeReference)
+	}
+	if s.supports(v3120) {
+		encoded, err := encodeOperationVolumes(operation)
+		if err != nil {
+			return nil, err
+		}
+		columns = columns.With("volumes", encoded)
+	}
+	upsertOperationsQuery, args, err := s.conditionalWrite(ctx, "scd_operations", operation.ID, columns, cells, previous)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error checking version of Operation")
+	}
+	upsertOperationsQuery += fmt.Sprintf(`
+		RETURNING
+			%s`, s.operationFields("scd_operations.", true))
+	id := operation.ID
+	operation, err = s.fetchOperationalIntent(ctx, s.q, upsertOperationsQuery, args...)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error fetching Operation")
 	}
+	if operation == nil {
+		return nil, writeConflict("Operation", id, previous)
+	}
 	operation.Cells = cells
 
+	if s.dualWrites[LayoutOperationFootprints] {
+		if err := storeFootprint(ctx, s.q, "scd_operations", operation.ID, footprint); err != nil {
+			return nil, stacktrace.Propagate(err, "Error storing footprint of Operation")
+		}
+	}
+
+	if s.supports(v3120) {
+		if err := indexOperationVolumes(ctx, s.q, operation); err != nil {
+			return nil, stacktrace.Propagate(err, "Error indexing volumes of Operation")
+		}
+	}
+
+	if s.dualWrites[LayoutCellsTable] {
+		if err := indexOperationalIntentCells(ctx, s.q, operation.ID, cids); err != nil {
+			return nil, stacktrace.Propagate(err, "Error indexing cells of Operation")
+		}
+	}
+
+	if err := s.recordOperationalIntentVersion(ctx, operation); err != nil {
+		return nil, err
+	}
+
 	return operation, nil
 }
 
-func (s *repo) searchOperationalIntents(ctx context.Context, q dsssql.Queryable, v4d *dssmodels.Volume4D) ([]*scdmodels.OperationalIntent, error) {
+// recordOperationalIntentVersion keeps the current version of operation,
+// identified by its OVN, if the schema holds versions.
+func (s *repo) recordOperationalIntentVersion(ctx context.Context, operation *scdmodels.OperationalIntent) error {
+	if !s.supports(v320) {
+		return nil
+	}
+	// Before schema 3.10.0, two writes within the same second yield the
+	// same OVN, which then identifies the last of them, like it does in
+	// scd_operations.
+	versionQuery := fmt.Sprintf(`
+		UPSERT INTO
+			scd_operation_versions
+			(ovn, %[1]s)
+		SELECT
+			$1, %[1]s
+		FROM
+			scd_operations
+		WHERE
+			id = $2`, s.operationVersionColumns(new(scdmodels.OperationalIntent), new(operationRow), true).Names(""))
+	if _, err := s.q.ExecContext(ctx, versionQuery, operation.OVN, operation.ID); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", versionQuery)
+	}
+	return nil
+}
+
+// TransferOperationalIntentManager implements repos.OperationalIntent.TransferOperationalIntentManager.
+func (s *repo) TransferOperationalIntentManager(ctx context.Context, id dssmodels.ID, previous scdmodels.OVN, transfer scdmodels.ManagerTransfer) (*scdmodels.OperationalIntent, error) {
 	var (
-		operationsIntersectingVolumeQuery = fmt.Sprintf(`
-			SELECT
-				%s
-			FROM
-				scd_operations
-			WHERE
-				cells && $1
-			AND
-				COALESCE(scd_operations.altitude_upper >= $2, true)
-			AND
-				COALESCE(scd_operations.altitude_lower <= $3, true)
-			AND
-				COALESCE(scd_operations.ends_at >= $4, true)
-			AND
-				COALESCE(scd_operations.starts_at <= $5, true)`, operationFieldsWithPrefix)
+		columns = "owner, url, subscription_id, version, updated_at"
+		values  = "$2, $3, $4, version + 1, $5"
+		args    = []interface{}{id, transfer.To, transfer.USSBaseURL, transfer.SubscriptionID, s.clock.Now()}
 	)
+	condition, args, err := s.versionCondition(ctx, "scd_operations", id, previous, args)
+	if err != nil {
+		return nil, err
+	}
+	if s.supports(v3100) {
+		ovn, err := s.newOVN(ctx, id, previous)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, ovn)
+		columns += ", ovn"
+		values += fmt.Sprintf(", $%d", len(args))
+	}
+
+	old, err := s.fetchOperationByID(ctx, s.q, id)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error fetching Operation")
+	}
+	if old == nil {
+		return nil, writeConflict("Operation", id, previous)
+	}
+	if old.Manager != transfer.From {
+		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Operation %s is not managed by %s", id, transfer.From)
+	}
+	sub, err := s.GetSubscription(ctx, transfer.SubscriptionID)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error fetching Subscription of new manager")
+	}
+	if sub == nil || sub.Manager != transfer.To {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription %s of %s does not exist", transfer.SubscriptionID, transfer.To)
+	}
+
+	transferQuery := fmt.Sprintf(`
+		UPDATE
+			scd_operations
+		SET
+			(%s) = (%s)
+		WHERE
+			id = $1
+		AND
+			%s
+		RETURNING
+			%s`, columns, values, condition, s.operationFields("scd_operations.", true))
+	operation, err := s.fetchOperationalIntent(ctx, s.q, transferQuery, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error transferring Operation")
+	}
+	if operation == nil {
+		return nil, writeConflict("Operation", id, previous)
+	}
+
+	if err := s.recordOperationalIntentVersion(ctx, operation); err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// GetFullOperationalIntentByOVN implements repos.OperationalIntent.GetFullOperationalIntentByOVN.
+func (s *repo) GetFullOperationalIntentByOVN(ctx context.Context, ovn scdmodels.OVN) (*scdmodels.OperationalIntent, error) {
+	if !s.supports(v320) {
+		return nil, stacktrace.NewError("Resolving OVNs requires strategic conflict detection schema %s", v320)
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_operation_versions
+		WHERE
+			ovn = $1`, s.operationFields("", true))
+	op, err := s.scanOperationalIntent(s.q.QueryRowContext(ctx, query, ovn).Scan)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return op, nil
+}
+
+// ListOperationalIntentVersions implements repos.OperationalIntent.ListOperationalIntentVersions.
+func (s *repo) ListOperationalIntentVersions(ctx context.Context, id dssmodels.ID) ([]*scdmodels.OperationalIntent, error) {
+	if !s.supports(v320) {
+		return nil, stacktrace.NewError("Listing versions of operational intents requires strategic conflict detection schema %s", v320)
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_operation_versions
+		WHERE
+			id = $1
+		ORDER BY
+			updated_at`, s.operationFields("", true))
+	rows, err := s.q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	versions := []*scdmodels.OperationalIntent{}
+	for rows.Next() {
+		op, err := s.scanOperationalIntent(rows.Scan)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning Operation version row")
+		}
+		versions = append(versions, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return versions, nil
+}
+
+// spatialIndex returns the SpatialIndex selecting operations by cell.
+func (s *repo) spatialIndex() SpatialIndex {
+	if s.index == nil {
+		return InvertedIndex{}
+	}
+	return s.index
+}
 
+// searchOperationalIntentsQuery returns the query selecting fields of the
+// operations intersecting v4d and passing filter, and its arguments.
+func (s *repo) searchOperationalIntentsQuery(ctx context.Context, fields string, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) (string, []interface{}, error) {
 	if v4d.SpatialVolume == nil || v4d.SpatialVolume.Footprint == nil {
-		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing geospatial footprint for query")
+		return "", nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing geospatial footprint for query")
 	}
 	cells, err := v4d.SpatialVolume.Footprint.CalculateCovering()
 	if err != nil {
-		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Failed to calculate footprint covering")
+		return "", nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Failed to calculate footprint covering")
 	}
 	if len(cells) == 0 {
-		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
+		return "", nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
 	}
 
 	cids := make([]int64, len(cells))
@@ -260,14 +490,77 @@ func (s *repo) searchOperationalIntents(ctx context.Context, q dsssql.Queryable,
 		cids[i] = int64(cid)
 	}
 
-	result, err := s.fetchOperationalIntents(
-		ctx, q, operationsIntersectingVolumeQuery,
+	args := []interface{}{
 		pq.Array(cids),
 		v4d.SpatialVolume.AltitudeLo,
 		v4d.SpatialVolume.AltitudeHi,
-		v4d.StartTime,
-		v4d.EndTime,
-	)
+		includeExpired,
+		s.clock.Now(),
+	}
+	index := s.spatialIndex()
+	covering := index.Covering("$1")
+	if shapes, ok := index.(ShapeIndex); ok {
+		wkt, err := dssmodels.FootprintWKT(v4d.SpatialVolume.Footprint)
+		if err != nil {
+			return "", nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid footprint")
+		}
+		if wkt != "" {
+			args = append(args, wkt)
+			covering = shapes.Intersecting("$1", fmt.Sprintf("$%d", len(args)))
+		}
+	}
+	operationsIntersectingVolumeQuery := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_operations
+		WHERE
+			%s
+		AND
+			COALESCE(scd_operations.altitude_upper >= $2, true)
+		AND
+			COALESCE(scd_operations.altitude_lower <= $3, true)
+		AND
+			($4 OR scd_operations.ends_at >= $5)`, fields, covering)
+	operationsIntersectingVolumeQuery, args = restrictToTimeRange(operationsIntersectingVolumeQuery, args, "scd_operations.", v4d.StartTime, v4d.EndTime)
+	if s.supports(v3120) {
+		operationsIntersectingVolumeQuery, args = restrictToOperationVolumes(operationsIntersectingVolumeQuery, args, v4d.StartTime, v4d.EndTime)
+	}
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, state := range filter.States {
+			states[i] = state.String()
+		}
+		args = append(args, pq.StringArray(states))
+		operationsIntersectingVolumeQuery += fmt.Sprintf(`
+		AND
+			scd_operations.state::STRING = ANY($%d)`, len(args))
+	}
+	if len(filter.Managers) > 0 {
+		managers := make([]string, len(filter.Managers))
+		for i, manager := range filter.Managers {
+			managers[i] = manager.String()
+		}
+		args = append(args, pq.StringArray(managers))
+		operationsIntersectingVolumeQuery += fmt.Sprintf(`
+		AND
+			scd_operations.owner = ANY($%d)`, len(args))
+	}
+	if s.supports(v310) {
+		operationsIntersectingVolumeQuery, args = cockroach.RestrictToRegions(operationsIntersectingVolumeQuery, args, "scd_operations.region", cells)
+	}
+	operationsIntersectingVolumeQuery, args = cockroach.OrderBy(operationsIntersectingVolumeQuery, args, dssmodels.SearchOrderFromContext(ctx), s.clock.Now(), "scd_operations.starts_at", "scd_operations.ends_at", "scd_operations.id")
+
+	return operationsIntersectingVolumeQuery, args, nil
+}
+
+// SearchOperations implements repos.Operation.SearchOperations.
+func (s *repo) SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error) {
+	query, args, err := s.searchOperationalIntentsQuery(ctx, s.operationFields("scd_operations.", true), v4d, includeExpired, filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.fetchOperationalIntents(ctx, s.q, query, args...)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error fetching Operations")
 	}
@@ -275,9 +568,61 @@ func (s *repo) searchOperationalIntents(ctx context.Context, q dsssql.Queryable,
 	return result, nil
 }
 
-// SearchOperations implements repos.Operation.SearchOperations.
-func (s *repo) SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.OperationalIntent, error) {
-	return s.searchOperationalIntents(ctx, s.q, v4d)
+// SearchOperationalIntentReferences implements repos.OperationalIntent.SearchOperationalIntentReferences.
+// Unlike SearchOperationalIntents, the cells of the operations are neither
+// selected nor populated.
+func (s *repo) SearchOperationalIntentReferences(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error) {
+	query, args, err := s.searchOperationalIntentsQuery(ctx, s.operationFields("scd_operations.", false), v4d, includeExpired, filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	var result []*scdmodels.OperationalIntent
+	for rows.Next() {
+		op, err := s.scanOperationalIntentReference(rows.Scan)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error scanning Operation row")
+		}
+		result = append(result, op)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return result, nil
+}
+
+// StreamOperationalIntents implements repos.OperationalIntent.StreamOperationalIntents.
+// Operations are passed to f as rows are read, their cells coming from the
+// cells column.
+func (s *repo) StreamOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter, f func(*scdmodels.OperationalIntent) error) error {
+	query, args, err := s.searchOperationalIntentsQuery(ctx, s.operationFields("scd_operations.", true), v4d, includeExpired, filter)
+	if err != nil {
+		return err
+	}
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		op, err := s.scanOperationalIntent(rows.Scan)
+		if err != nil {
+			return stacktrace.Propagate(err, "Error scanning Operation row")
+		}
+		if err := f(op); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return stacktrace.Propagate(err, "Error in rows query result")
+	}
+	return nil
 }
 
 // GetDependentOperations implements repos.Operation.GetDependentOperations.
@@ -307,3 +652,51 @@ func (s *repo) GetDependentOperationalIntents(ctx context.Context, subscriptionI
 
 	return dependentOps, nil
 }
+
+// GetOperationalIntentDependencies implements repos.OperationalIntent.GetOperationalIntentDependencies.
+func (s *repo) GetOperationalIntentDependencies(ctx context.Context, id dssmodels.ID) (*scdmodels.OperationalIntentDependencies, error) {
+	const query = `
+		SELECT
+			o.owner,
+			o.subscription_id,
+			EXISTS(SELECT 1 FROM scd_subscriptions WHERE id = o.subscription_id),
+			ARRAY(
+				SELECT
+					sub.id::STRING
+				FROM
+					scd_subscriptions AS sub
+				WHERE
+					sub.cells && o.cells
+				AND
+					sub.notify_for_operations
+				AND
+					(sub.ends_at >= o.starts_at OR sub.ends_at IS NULL OR o.starts_at IS NULL)
+				AND
+					(sub.starts_at <= o.ends_at OR sub.starts_at IS NULL OR o.ends_at IS NULL)
+				ORDER BY
+					sub.id
+			)
+		FROM
+			scd_operations AS o
+		WHERE
+			o.id = $1`
+
+	var (
+		deps           = &scdmodels.OperationalIntentDependencies{OperationalIntentID: id}
+		subscriptionID sql.NullString
+		notified       pq.StringArray
+	)
+	err := s.q.QueryRowContext(ctx, query, id).Scan(&deps.Manager, &subscriptionID, &deps.SubscriptionExists, &notified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	deps.SubscriptionID = dssmodels.ID(subscriptionID.String)
+	deps.NotifiedSubscriptions = make([]dssmodels.ID, len(notified))
+	for i, subID := range notified {
+		deps.NotifiedSubscriptions[i] = dssmodels.ID(subID)
+	}
+	return deps, nil
+}
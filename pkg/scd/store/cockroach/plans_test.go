@@ -0,0 +1,134 @@
+package cockroach
+
+import (
+	"context"
+	"flag"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/cockroach"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/stretchr/testify/require"
+)
+
+var explainAnalyze = flag.Bool("explain-analyze", false, "with store-uri, check the plans of TestQueryPlans with EXPLAIN ANALYZE rather than EXPLAIN (requires CockroachDB 21.1 or later)")
+
+// planExpectations lists the indexes through which the searches must go.
+var planExpectations = []cockroach.IndexExpectation{
+	{Pattern: regexp.MustCompile(`FROM scd_operations WHERE scd_operations\.cells && \$1`), Table: "scd_operations", Indexes: []string{"cell_idx", "ends_at_starts_at_idx"}},
+	{Pattern: regexp.MustCompile(`FROM scd_subscriptions WHERE cells && \$1`), Table: "scd_subscriptions", Indexes: []string{"cell_idx", "ends_at_starts_at_idx"}},
+	{Pattern: regexp.MustCompile(`UPDATE scd_subscriptions SET notification_index = .* WHERE cells && \$1`), Table: "scd_subscriptions", Indexes: []string{"cell_idx", "ends_at_starts_at_idx"}},
+	{Pattern: regexp.MustCompile(`FROM scd_constraints WHERE cells && \$1`), Table: "scd_constraints", Indexes: []string{"cells_idx", "ends_at_starts_at_idx"}},
+}
+
+// TestQueryPlans exercises every statement of the repo and fails if any of
+// them scans a whole table, or if a search does not go through the indexes
+// of planExpectations, so that changes to the statements or the schema
+// degrading their plans are caught before they reach production.
+func TestQueryPlans(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+		recorder             = cockroach.NewStatementRecorder(store.db)
+		repo                 = store.newRepo(recorder)
+		start                = fakeClock.Now()
+		end                  = start.Add(time.Hour)
+		volume               = &dssmodels.Volume4D{
+			StartTime: &start,
+			EndTime:   &end,
+			SpatialVolume: &dssmodels.Volume3D{
+				Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+					return cells, nil
+				}),
+			},
+		}
+	)
+	defer tearDownStore()
+
+	sub, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:                          dssmodels.ID(uuid.New().String()),
+		Manager:                     "uss1",
+		StartTime:                   &start,
+		EndTime:                     &end,
+		USSBaseURL:                  "https://uss1.example.com",
+		NotifyForOperationalIntents: true,
+		Cells:                       cells,
+	}, "")
+	require.NoError(t, err)
+	op, err := repo.UpsertOperationalIntent(ctx, &scdmodels.OperationalIntent{
+		ID:             dssmodels.ID(uuid.New().String()),
+		Manager:        "uss1",
+		Version:        1,
+		State:          scdmodels.OperationalIntentStateAccepted,
+		StartTime:      &start,
+		EndTime:        &end,
+		USSBaseURL:     "https://uss1.example.com",
+		SubscriptionID: sub.ID,
+		Cells:          cells,
+	}, "")
+	require.NoError(t, err)
+	constraint, err := repo.UpsertConstraint(ctx, &scdmodels.Constraint{
+		ID:         dssmodels.ID(uuid.New().String()),
+		Manager:    "uss1",
+		Type:       scdmodels.ConstraintTypeRestriction,
+		StartTime:  &start,
+		EndTime:    &end,
+		USSBaseURL: "https://uss1.example.com",
+		Cells:      cells,
+	})
+	require.NoError(t, err)
+
+	fakeClock.Advance(time.Minute)
+	op.Version++
+	op, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	_, err = repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	_, err = repo.SearchOperationalIntents(ctx, volume, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	_, err = repo.SearchOperationalIntents(ctx, volume, true, scdmodels.OperationalIntentFilter{
+		States:   []scdmodels.OperationalIntentState{scdmodels.OperationalIntentStateAccepted},
+		Managers: []dssmodels.Manager{"uss1"},
+	})
+	require.NoError(t, err)
+	_, err = repo.SearchOperationalIntentReferences(ctx, volume, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	_, err = repo.GetOperationalIntentCells(ctx, op.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.StreamOperationalIntents(ctx, volume, false, scdmodels.OperationalIntentFilter{}, func(*scdmodels.OperationalIntent) error {
+		return nil
+	}))
+	_, err = repo.GetDependentOperationalIntents(ctx, sub.ID)
+	require.NoError(t, err)
+	if store.supports(v320) {
+		_, err = repo.GetFullOperationalIntentByOVN(ctx, op.OVN)
+		require.NoError(t, err)
+	}
+	_, err = repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	_, err = repo.SearchSubscriptions(ctx, volume, scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
+	require.NoError(t, err)
+	_, err = repo.IncrementNotificationIndices(ctx, []dssmodels.ID{sub.ID})
+	require.NoError(t, err)
+	_, err = repo.NotifySubscriptions(ctx, volume, scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
+	require.NoError(t, err)
+	_, err = repo.ListExpiringSubscriptions(ctx, start, end)
+	require.NoError(t, err)
+	_, err = repo.ListSubscriptionsByManager(ctx, sub.Manager, start)
+	require.NoError(t, err)
+	_, err = repo.GetConstraint(ctx, constraint.ID)
+	require.NoError(t, err)
+	_, err = repo.SearchConstraints(ctx, volume, scdmodels.ConstraintFilter{})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteConstraint(ctx, constraint.ID))
+	require.NoError(t, repo.DeleteOperationalIntent(ctx, op.ID))
+	require.NoError(t, repo.DeleteSubscription(ctx, sub.ID))
+
+	statements := recorder.Statements()
+	require.NotEmpty(t, statements)
+	require.NoError(t, store.db.CheckPlans(ctx, statements, *explainAnalyze, planExpectations))
+}
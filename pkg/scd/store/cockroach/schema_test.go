@@ -0,0 +1,72 @@
+package cockroach
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/geo"
+	dsssql "github.com/interuss/dss/pkg/sql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnsBySchema(t *testing.T) {
+	const (
+		constraintBase = "id,owner,version,url,altitude_lower,altitude_upper,starts_at,ends_at,cells,updated_at"
+		operationBase  = "id,owner,version,url,altitude_lower,altitude_upper,starts_at,ends_at,subscription_id,updated_at,state"
+	)
+	for _, c := range []struct {
+		schema      string
+		constraints string
+		operations  string
+	}{
+		{"3.0.0", constraintBase, operationBase + ",cells"},
+		{"3.7.0", constraintBase, operationBase + ",cells"},
+		{"3.8.0", constraintBase + ",type", operationBase + ",cells"},
+		{"3.10.0", constraintBase + ",type,ovn", operationBase + ",cells,ovn"},
+		{"3.12.0", constraintBase + ",type,ovn", operationBase + ",cells,volumes,ovn"},
+		{"3.13.0", constraintBase + ",type,altitude_reference,ovn", operationBase + ",altitude_reference,cells,volumes,ovn"},
+	} {
+		r := &repo{schema: *semver.New(c.schema)}
+		require.Equal(t, c.constraints, r.constraintFields(false), c.schema)
+		require.Equal(t, c.operations, r.operationFields("", true), c.schema)
+	}
+}
+
+func TestUpsertBySchema(t *testing.T) {
+	var (
+		columns = dsssql.Columns{{Name: "id", Value: "id"}}
+		cells   = s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)}
+	)
+
+	query, args := (&repo{schema: *semver.New("3.0.0")}).upsert("scd_subscriptions", columns, cells)
+	require.True(t, strings.HasPrefix(strings.TrimSpace(query), "UPSERT INTO"))
+	require.Equal(t, []interface{}{"id"}, args)
+
+	// From 3.1.0, entities are partitioned by region.
+	query, args = (&repo{schema: *semver.New("3.1.0")}).upsert("scd_subscriptions", columns, cells)
+	require.Contains(t, query, "ON CONFLICT (id) DO UPDATE SET")
+	require.Len(t, args, 2)
+
+	// From 3.15.0, entities are labelled with their jurisdiction.
+	js, err := geo.ParseJurisdictions("ch:45.8,5.9,47.8,10.5")
+	require.NoError(t, err)
+	query, args = (&repo{schema: *semver.New("3.15.0"), jurisdictions: js}).upsert("scd_subscriptions", columns, cells)
+	require.Contains(t, query, "jurisdiction")
+	require.Equal(t, "ch", args[len(args)-1])
+}
+
+func TestSupports(t *testing.T) {
+	r := &repo{schema: *semver.New("3.10.0")}
+	require.True(t, r.supports(v310))
+	require.True(t, r.supports(v390))
+	require.True(t, r.supports(v3100))
+	require.False(t, r.supports(v3110))
+	require.False(t, r.supports(v3120))
+
+	// Patch releases hold the tables and columns of their minor version.
+	r.schema = *semver.New("3.11.1")
+	require.True(t, r.supports(v3110))
+	require.False(t, r.supports(v3120))
+}
@@ -0,0 +1,174 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	dsssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/stacktrace"
+	"github.com/lib/pq"
+)
+
+// SpatialIndex selects the operational intents covering any of a set of
+// cells. The layouts it relies on are kept up to date by every write
+// regardless of the SpatialIndex in use, unless excluded with
+// Store.SetDualWrites, so that operators may switch between them to compare
+// their latencies.
+type SpatialIndex interface {
+	// Name identifies the index, e.g. in the --scd_spatial_index flag.
+	Name() string
+	// Covering returns the condition of a WHERE clause over scd_operations
+	// holding for the operations covering any of the cells bound to
+	// placeholder, an INT64[] placeholder such as $1.
+	Covering(placeholder string) string
+}
+
+// InvertedIndex looks operational intents up in the inverted index of the
+// cells column of scd_operations.
+type InvertedIndex struct{}
+
+// Name implements SpatialIndex.
+func (InvertedIndex) Name() string {
+	return "inverted"
+}
+
+// Covering implements SpatialIndex.
+func (InvertedIndex) Covering(placeholder string) string {
+	return fmt.Sprintf("scd_operations.cells && %s", placeholder)
+}
+
+// CellsTableIndex looks operational intents up in cells_scd_operations,
+// whose primary key orders the operations by cell.
+type CellsTableIndex struct{}
+
+// Name implements SpatialIndex.
+func (CellsTableIndex) Name() string {
+	return "cells_table"
+}
+
+// Covering implements SpatialIndex.
+func (CellsTableIndex) Covering(placeholder string) string {
+	return fmt.Sprintf(`scd_operations.id IN (
+			SELECT
+				operation_id
+			FROM
+				cells_scd_operations
+			WHERE
+				cell_id = ANY(%s))`, placeholder)
+}
+
+// ShapeIndex is a SpatialIndex also able to select operational intents by
+// their exact footprint, when the footprint searched is known beyond its
+// covering.
+type ShapeIndex interface {
+	SpatialIndex
+	// Intersecting returns the condition of a WHERE clause over
+	// scd_operations holding for the operations whose footprint intersects
+	// the WKT bound to the footprint placeholder, or, for the operations
+	// without a footprint, covering any of the cells bound to the cells
+	// placeholder.
+	Intersecting(cells, footprint string) string
+}
+
+// GeographyIndex looks operational intents up in the inverted index of the
+// footprint column of scd_operations, selecting those whose exact footprint
+// intersects the footprint searched rather than those sharing a cell with
+// it. Comparing its results with those of the cell indexes cross-validates
+// the S2 coverings. Operations written before schema 3.6.0, and searches
+// whose footprint is only known by its covering, fall back to cells.
+type GeographyIndex struct{}
+
+// Name implements SpatialIndex.
+func (GeographyIndex) Name() string {
+	return "geography"
+}
+
+// Covering implements SpatialIndex.
+func (GeographyIndex) Covering(placeholder string) string {
+	return InvertedIndex{}.Covering(placeholder)
+}
+
+// Intersecting implements ShapeIndex.
+func (GeographyIndex) Intersecting(cells, footprint string) string {
+	return fmt.Sprintf(`(
+			ST_Intersects(scd_operations.footprint, ST_GeogFromText(%[2]s))
+		OR
+			(scd_operations.footprint IS NULL AND scd_operations.cells && %[1]s))`, cells, footprint)
+}
+
+// SpatialIndexes are the available SpatialIndex implementations by name.
+var SpatialIndexes = map[string]SpatialIndex{
+	InvertedIndex{}.Name():   InvertedIndex{},
+	CellsTableIndex{}.Name(): CellsTableIndex{},
+	GeographyIndex{}.Name():  GeographyIndex{},
+}
+
+// UseSpatialIndex makes s select operational intents by cell with the
+// SpatialIndex named name.
+func (s *Store) UseSpatialIndex(name string) error {
+	index, ok := SpatialIndexes[name]
+	if !ok {
+		return stacktrace.NewError("Unknown spatial index %s", name)
+	}
+	if _, ok := index.(CellsTableIndex); ok && !s.supports(v340) {
+		return stacktrace.NewError("Spatial index %s requires strategic conflict detection schema %s", name, v340)
+	}
+	if _, ok := index.(GeographyIndex); ok && !s.supports(v360) {
+		return stacktrace.NewError("Spatial index %s requires strategic conflict detection schema %s", name, v360)
+	}
+	if layout, ok := readLayout(index); ok && !s.dualWritten()[layout] {
+		return stacktrace.NewError("Spatial index %s reads layout %s, which is not written", name, layout)
+	}
+	s.index = index
+	return nil
+}
+
+// indexOperationalIntentCells makes cells_scd_operations list exactly cids
+// for the operation id.
+func indexOperationalIntentCells(ctx context.Context, q dsssql.Queryable, id dssmodels.ID, cids []int64) error {
+	const (
+		deleteQuery = `
+			DELETE FROM
+				cells_scd_operations
+			WHERE
+				operation_id = $1
+			AND
+				NOT (cell_id = ANY($2))`
+		insertQuery = `
+			UPSERT INTO
+				cells_scd_operations
+				(cell_id, operation_id)
+			SELECT
+				unnest($2::INT64[]), $1`
+	)
+	for _, query := range []string{deleteQuery, insertQuery} {
+		if _, err := q.ExecContext(ctx, query, id, pq.Int64Array(cids)); err != nil {
+			return stacktrace.Propagate(err, "Error in query: %s", query)
+		}
+	}
+	return nil
+}
+
+// storeFootprint sets the footprint column of the row id of table to the
+// exact shape of footprint, or to NULL if footprint is only known by its
+// covering.
+func storeFootprint(ctx context.Context, q dsssql.Queryable, table string, id dssmodels.ID, footprint dssmodels.Geometry) error {
+	wkt, err := dssmodels.FootprintWKT(footprint)
+	if err != nil {
+		return stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Invalid footprint")
+	}
+	query := fmt.Sprintf(`
+		UPDATE
+			%s
+		SET
+			footprint = ST_GeogFromText($2)
+		WHERE
+			id = $1`, table)
+	if _, err := q.ExecContext(ctx, query, id, sql.NullString{String: wkt, Valid: wkt != ""}); err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return nil
+}
@@ -3,12 +3,23 @@ package cockroach
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
-	"github.com/cockroachdb/cockroach-go/crdb"
 	"github.com/coreos/go-semver/semver"
+	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/cockroach"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/idempotency"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
 	dsssql "github.com/interuss/dss/pkg/sql"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
 	"github.com/jonboulle/clockwork"
 	"go.uber.org/zap"
@@ -21,10 +32,55 @@ const (
 
 var (
 	// DefaultClock is what is used as the Store's clock, returned from Dial.
+	// The clock determines the update time of entities, from which their
+	// OVNs are derived before schema 3.10.0, and which entities are expired.
 	DefaultClock = clockwork.NewRealClock()
 
+	// SupportedSchemas is the range of schema versions the store supports,
+	// whose maximum is raised with every migration.
+	SupportedSchemas = cockroach.SchemaRange{Min: *semver.New("3.0.0"), Max: *semver.New("3.15.0")}
+
 	// DatabaseName is the name of database storing strategic conflict detection data.
 	DatabaseName = "scd"
+
+	// v310 introduced the region column holding the S2 face of entities.
+	v310 = *semver.New("3.1.0")
+	// v320 introduced the scd_operation_versions table resolving OVNs.
+	v320 = *semver.New("3.2.0")
+	// v330 introduced the scd_quarantined_operations table.
+	v330 = *semver.New("3.3.0")
+	// v340 introduced the cells_scd_operations table indexing operations by
+	// cell.
+	v340 = *semver.New("3.4.0")
+	// v350 introduced the (ends_at, starts_at) indexes pre-filtering
+	// searches by time.
+	v350 = *semver.New("3.5.0")
+	// v360 introduced the footprint geography columns of scd_operations and
+	// scd_constraints.
+	v360 = *semver.New("3.6.0")
+	// v380 introduced the type column of scd_constraints.
+	v380 = *semver.New("3.8.0")
+	// v390 introduced the scd_constraint_versions table, and kept the
+	// versions of operational intents after their deletion.
+	v390 = *semver.New("3.9.0")
+	// v3100 introduced the ovn columns of scd_operations, scd_subscriptions
+	// and scd_constraints, holding OVNs generated by the transactions
+	// writing the entities.
+	v3100 = *semver.New("3.10.0")
+	// v3110 widened the notification_index column of scd_subscriptions to
+	// INT8.
+	v3110 = *semver.New("3.11.0")
+	// v3120 introduced the volumes columns of scd_operations and
+	// scd_operation_versions, and the scd_operation_volumes table.
+	v3120 = *semver.New("3.12.0")
+	// v3130 introduced the altitude_reference columns of scd_operations,
+	// scd_constraints and their versions.
+	v3130 = *semver.New("3.13.0")
+	// v3140 introduced the scd_expiry_scans table.
+	v3140 = *semver.New("3.14.0")
+	// v3150 introduced the jurisdiction columns of scd_operations,
+	// scd_subscriptions and scd_constraints.
+	v3150 = *semver.New("3.15.0")
 )
 
 // repo is an implementation of repos.Repo using
@@ -33,27 +89,64 @@ type repo struct {
 	q      dsssql.Queryable
 	logger *zap.Logger
 	clock  clockwork.Clock
+	// schema is the version of the database schema, which determines the
+	// tables and columns used; see supports.
+	schema semver.Version
+	// dualWrites are the secondary layouts written along with the entity
+	// tables.
+	dualWrites map[Layout]bool
+	// index selects the operational intents covering cells.
+	index SpatialIndex
+	// jurisdictions determine the jurisdiction written with entities.
+	jurisdictions geo.Jurisdictions
 }
 
 // Store is an implementation of an scd.Store using
 // a CockroachDB database.
 type Store struct {
-	db     *cockroach.DB
-	logger *zap.Logger
-	clock  clockwork.Clock
+	db       *cockroach.DB
+	logger   *zap.Logger
+	clock    clockwork.Clock
+	recorder *summary.Recorder
+	schema   semver.Version
+	// dualWrites are the secondary layouts set by SetDualWrites, all of
+	// those held by the schema if nil.
+	dualWrites    map[Layout]bool
+	index         SpatialIndex
+	jurisdictions geo.Jurisdictions
 }
 
-// NewStore returns a Store instance connected to a cockroach instance via db.
-func NewStore(ctx context.Context, db *cockroach.DB, logger *zap.Logger) (*Store, error) {
+// supports returns whether the schema of s is at least v, the version which
+// introduced the tables or columns about to be used.
+func (s *Store) supports(v semver.Version) bool {
+	return !s.schema.LessThan(v)
+}
+
+// supports returns whether the schema of s is at least v, the version which
+// introduced the tables or columns about to be used.
+func (s *repo) supports(v semver.Version) bool {
+	return !s.schema.LessThan(v)
+}
+
+// NewStore returns a Store instance connected to a cockroach instance via db,
+// recording the statistics of its transactions to recorder.
+func NewStore(ctx context.Context, db *cockroach.DB, logger *zap.Logger, recorder *summary.Recorder) (*Store, error) {
 	store := &Store{
-		db:     db,
-		logger: logger,
-		clock:  DefaultClock,
+		db:       db,
+		logger:   logger,
+		clock:    DefaultClock,
+		recorder: recorder,
+		index:    InvertedIndex{},
 	}
 
 	if err := store.CheckCurrentMajorSchemaVersion(ctx); err != nil {
 		return nil, stacktrace.Propagate(err, "Strategic conflict detection schema version check failed")
 	}
+	vs, err := store.GetVersion(ctx)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to get database schema version for strategic conflict detection")
+	}
+	store.schema = *vs
 
 	return store, nil
 }
@@ -75,31 +168,279 @@ func (s *Store) CheckCurrentMajorSchemaVersion(ctx context.Context) error {
 	return nil
 }
 
+// newRepo returns a repo running its queries with q.
+func (s *Store) newRepo(q dsssql.Queryable) *repo {
+	return &repo{
+		q:             dsssql.Traced(q),
+		logger:        s.logger,
+		clock:         s.clock,
+		schema:        s.schema,
+		dualWrites:    s.dualWritten(),
+		index:         s.index,
+		jurisdictions: s.jurisdictions,
+	}
+}
+
+// SetJurisdictions makes s write the jurisdiction of entities among js.
+func (s *Store) SetJurisdictions(js geo.Jurisdictions) error {
+	if len(js) > 0 && !s.supports(v3150) {
+		return stacktrace.NewError("Jurisdictions require strategic conflict detection schema %s", v3150)
+	}
+	s.jurisdictions = js
+	return nil
+}
+
 // Interact implements store.Interactor interface.
 func (s *Store) Interact(_ context.Context) (repos.Repository, error) {
-	return &repo{
-		q:      s.db,
-		logger: s.logger,
-		clock:  s.clock,
-	}, nil
+	return s.newRepo(s.db), nil
 }
 
 // Transact implements store.Transactor interface.
 func (s *Store) Transact(ctx context.Context, f func(context.Context, repos.Repository) error) error {
-	return crdb.ExecuteTx(ctx, s.db.DB, nil /* nil txopts */, func(tx *sql.Tx) error {
-		return f(ctx, &repo{
-			q:      tx,
-			logger: s.logger,
-			clock:  s.clock,
-		})
+	ctx, span := tracing.StartSpan(ctx, "scd.Transact")
+	defer span.End()
+
+	attempts := 0
+	defer func() { s.recorder.RecordTransaction(attempts) }()
+	return s.db.ExecuteTx(ctx, func(tx *sql.Tx) error {
+		attempts++
+		if err := f(ctx, s.newRepo(tx)); err != nil {
+			return err
+		}
+		// The response to a call with an idempotency key is recorded along
+		// with its changes.
+		return idempotency.RecordInTx(ctx, tx)
 	})
 }
 
+// InteractAsOf implements store.HistoricalInteractor interface.
+func (s *Store) InteractAsOf(ctx context.Context, t time.Time, f func(context.Context, repos.Repository) error) error {
+	tx, err := s.db.BeginAsOf(ctx, t)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error starting historical query as of %s", t)
+	}
+	// Nothing is ever written in tx, so there is nothing to commit.
+	defer func() { _ = tx.Rollback() }()
+
+	return f(ctx, s.newRepo(tx))
+}
+
+// upsert returns the statement inserting the values of columns into table,
+// or updating the row with the same id, and its arguments. If the table has
+// region and jurisdiction columns, those of cells are written as well, and
+// the conflict on id is resolved explicitly rather than with UPSERT so that
+// the statement does not depend on id being the primary key, which it is not
+// once the table is partitioned by jurisdiction.
+func (s *repo) upsert(table string, columns dsssql.Columns, cells s2.CellUnion) (string, []interface{}) {
+	if !s.supports(v310) {
+		return fmt.Sprintf(`
+		UPSERT INTO
+		  %s
+		  (%s)
+		VALUES
+			(%s)`, table, columns.Names(""), columns.Placeholders(0)), columns.Values()
+	}
+
+	columns = s.withRegion(columns, cells)
+	return fmt.Sprintf(`
+		INSERT INTO
+		  %[1]s
+		  (%[2]s)
+		VALUES
+			(%[3]s)
+		ON CONFLICT (id) DO UPDATE SET
+			(%[2]s) = (%[4]s)`, table, columns.Names(""), columns.Placeholders(0), columns.Names("excluded.")), columns.Values()
+}
+
+// withRegion returns columns with the region of cells and, if the schema
+// holds it, their jurisdiction.
+func (s *repo) withRegion(columns dsssql.Columns, cells s2.CellUnion) dsssql.Columns {
+	columns = columns.With("region", geo.RegionOf(cells))
+	if s.supports(v3150) {
+		columns = columns.With("jurisdiction", s.jurisdictions.Of(cells))
+	}
+	return columns
+}
+
+// conditionalWrite returns the statement writing the values of columns into
+// table and its arguments, like upsert, but only if the row id, which must
+// be the first of columns, is at the version previous: if previous is empty,
+// the row is inserted unless it exists and, otherwise, it is updated unless
+// it changed since previous was read. The statement affects no row if the
+// condition does not hold.
+func (s *repo) conditionalWrite(ctx context.Context, table string, id dssmodels.ID, columns dsssql.Columns, cells s2.CellUnion, previous scdmodels.OVN) (string, []interface{}, error) {
+	if s.supports(v310) {
+		columns = s.withRegion(columns, cells)
+	}
+	if s.supports(v3100) {
+		ovn, err := s.newOVN(ctx, id, previous)
+		if err != nil {
+			return "", nil, err
+		}
+		columns = columns.With("ovn", ovn)
+	}
+	if previous.Empty() {
+		return fmt.Sprintf(`
+		INSERT INTO
+		  %s
+		  (%s)
+		VALUES
+			(%s)
+		ON CONFLICT (id) DO NOTHING`, table, columns.Names(""), columns.Placeholders(0)), columns.Values(), nil
+	}
+
+	condition, args, err := s.versionCondition(ctx, table, id, previous, columns.Values())
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf(`
+		UPDATE
+		  %s
+		SET
+		  (%s) = (%s)
+		WHERE
+			id = $1
+		AND
+			%s`, table, columns.Names(""), columns.Placeholders(0), condition), args, nil
+}
+
+// versionCondition returns the condition of a WHERE clause holding if the
+// row id of table has not changed since it was at the version previous,
+// provided that it still is, and args followed by the arguments of the
+// condition.
+func (s *repo) versionCondition(ctx context.Context, table string, id dssmodels.ID, previous scdmodels.OVN, args []interface{}) (string, []interface{}, error) {
+	columns := "updated_at, NULL::STRING"
+	if s.supports(v3100) {
+		columns = "updated_at, ovn"
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			%s
+		WHERE
+			id = $1`, columns, table)
+	var (
+		updatedAt time.Time
+		stored    sql.NullString
+	)
+	switch err := s.q.QueryRowContext(ctx, query, id).Scan(&updatedAt, &stored); {
+	case err == sql.ErrNoRows:
+		return "", nil, stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s does not exist at version %s", id, previous)
+	case err != nil:
+		return "", nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	if current := storedOVN(stored, updatedAt, id); current != previous {
+		return "", nil, stacktrace.Propagate(
+			stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "Version %s of %s is not current", previous, id),
+			"Current version is %s", current)
+	}
+
+	args = append(args, updatedAt)
+	condition := fmt.Sprintf("updated_at = $%d", len(args))
+	if s.supports(v3100) {
+		args = append(args, stored)
+		condition += fmt.Sprintf(" AND ovn IS NOT DISTINCT FROM $%d::STRING", len(args))
+	}
+	return condition, args, nil
+}
+
+// newOVN returns the OVN of the version of the entity id about to be
+// written following the version previous, empty if the entity is new. It
+// derives from the logical timestamp of the cluster at which the
+// transaction of s commits rather than from the clock of this instance.
+// Transactions writing the same entity conflict, so their timestamps differ,
+// and reading the timestamp makes the transaction retry rather than commit
+// later. Outside of a transaction, the timestamp is that of the statement
+// reading it, which precedes the write.
+func (s *repo) newOVN(ctx context.Context, id dssmodels.ID, previous scdmodels.OVN) (scdmodels.OVN, error) {
+	const query = `SELECT cluster_logical_timestamp()::STRING`
+	var timestamp string
+	if err := s.q.QueryRowContext(ctx, query).Scan(&timestamp); err != nil {
+		return "", stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	return scdmodels.NewOVN(id.String(), timestamp, previous), nil
+}
+
+// storedOVN returns the OVN of the entity id, either stored in its ovn
+// column or, for the versions written before schema 3.10.0, derived from
+// its update time.
+func storedOVN(stored sql.NullString, updatedAt time.Time, id dssmodels.ID) scdmodels.OVN {
+	if stored.Valid {
+		return scdmodels.OVN(stored.String)
+	}
+	return scdmodels.NewOVNFromTime(updatedAt, id.String())
+}
+
+// writeConflict returns the error reporting that the statement returned by
+// conditionalWrite for the entity id of kind affected no row.
+func writeConflict(kind string, id dssmodels.ID, previous scdmodels.OVN) error {
+	if previous.Empty() {
+		return stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s %s already exists", kind, id)
+	}
+	// The row changed between the version check and the write.
+	return stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s %s changed concurrently from version %s", kind, id, previous)
+}
+
+// restrictToTimeRange restricts query to the rows whose time range, in the
+// starts_at and ends_at columns prefixed by prefix, intersects [start, end],
+// either bound being open if nil, and returns the restricted query with its
+// arguments.  Unlike COALESCE, the predicates are plain ranges, so that the
+// (ends_at, starts_at) indexes narrow the rows down before their cells are
+// compared.
+func restrictToTimeRange(query string, args []interface{}, prefix string, start, end *time.Time) (string, []interface{}) {
+	if start != nil {
+		args = append(args, *start)
+		query += fmt.Sprintf(`
+		AND
+			(%[1]sends_at >= $%[2]d OR %[1]sends_at IS NULL)`, prefix, len(args))
+	}
+	if end != nil {
+		args = append(args, *end)
+		query += fmt.Sprintf(`
+		AND
+			(%[1]sstarts_at <= $%[2]d OR %[1]sstarts_at IS NULL)`, prefix, len(args))
+	}
+	return query, args
+}
+
+// Capabilities implements store.Store interface. The versions of constraints
+// are kept starting with schema 3.9.0, OVNs are sequenced starting with
+// schema 3.10.0, and expiry scans are persisted starting with schema 3.14.0.
+func (s *Store) Capabilities() scdstore.Capabilities {
+	return scdstore.Capabilities{
+		Pagination:    true,
+		History:       s.supports(v390),
+		FollowerReads: s.db.FollowerReads(),
+		SequencedOVNs: s.supports(v3100),
+		ExpiryScans:   s.supports(v3140),
+	}
+}
+
 // Close closes the underlying DB connection.
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// StorageFootprint returns the approximate storage consumed by each manager
+// in the SCD tables.
+func (s *Store) StorageFootprint(ctx context.Context) ([]cockroach.Footprint, error) {
+	return s.db.StorageFootprint(ctx, DatabaseName, []cockroach.FootprintTable{
+		{Name: "scd_operations", OwnerColumn: "owner", OwnerIndex: "owner_idx"},
+		{Name: "scd_subscriptions", OwnerColumn: "owner", OwnerIndex: "owner_idx"},
+		{Name: "scd_constraints", OwnerColumn: "owner", OwnerIndex: "owner_idx"},
+	})
+}
+
+// EntityDensity returns the number of operational intents and constraints
+// active at now by region and by manager.
+func (s *Store) EntityDensity(ctx context.Context, now time.Time) ([]cockroach.Density, error) {
+	return s.db.EntityDensity(ctx, []cockroach.DensityTable{
+		{Name: "scd_operations", Kind: events.KindOperationalIntent},
+		{Name: "scd_constraints", Kind: events.KindConstraint},
+	}, now)
+}
+
 // GetVersion returns the Version string for the Database.
 // If the DB was is not bootstrapped using the schema manager we throw and error
 func (s *Store) GetVersion(ctx context.Context) (*semver.Version, error) {
@@ -0,0 +1,714 @@
+package cockroach
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/cockroach"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/ids"
+	"github.com/interuss/dss/pkg/logging"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storeURI  = flag.String("store-uri", "", "URI pointing to a Cockroach node")
+	fakeClock = clockwork.NewFakeClock()
+	cells     = s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)}
+)
+
+func setUpStore(ctx context.Context, t testing.TB) (*Store, func()) {
+	if len(*storeURI) == 0 {
+		t.Skip()
+	}
+	// Reset the clock for every test.
+	fakeClock = clockwork.NewFakeClock()
+
+	cdb, err := cockroach.Dial(*storeURI, cockroach.PoolParameters{})
+	require.NoError(t, err)
+	store := &Store{
+		db:       cdb,
+		logger:   logging.Logger,
+		clock:    fakeClock,
+		recorder: summary.NewRecorder(fakeClock),
+	}
+	vs, err := store.GetVersion(ctx)
+	require.NoError(t, err)
+	store.schema = *vs
+
+	return store, func() {
+		require.NoError(t, CleanUp(ctx, store))
+		require.NoError(t, store.Close())
+	}
+}
+
+// CleanUp deletes all entities from the store, useful for testing.
+func CleanUp(ctx context.Context, s *Store) error {
+	const query = `
+	DELETE FROM scd_operations WHERE id IS NOT NULL;
+	DELETE FROM scd_constraints WHERE id IS NOT NULL;
+	DELETE FROM scd_subscriptions WHERE id IS NOT NULL;`
+
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	// The versions of entities outlive them starting with schema 3.9.0.
+	if s.supports(v390) {
+		_, err := s.db.ExecContext(ctx, `
+		DELETE FROM scd_operation_versions WHERE ovn IS NOT NULL;
+		DELETE FROM scd_constraint_versions WHERE ovn IS NOT NULL;`)
+		return err
+	}
+	return nil
+}
+
+func insertOperationalIntent(ctx context.Context, t testing.TB, s *Store, start, end time.Time) *scdmodels.OperationalIntent {
+	repo, err := s.Interact(ctx)
+	require.NoError(t, err)
+
+	sub, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:                          dssmodels.ID(uuid.New().String()),
+		Manager:                     "uss1",
+		StartTime:                   &start,
+		EndTime:                     &end,
+		USSBaseURL:                  "https://uss1.example.com",
+		NotifyForOperationalIntents: true,
+		ImplicitSubscription:        true,
+		Cells:                       cells,
+	}, "")
+	require.NoError(t, err)
+
+	op, err := repo.UpsertOperationalIntent(ctx, &scdmodels.OperationalIntent{
+		ID:             dssmodels.ID(uuid.New().String()),
+		Manager:        "uss1",
+		Version:        1,
+		State:          scdmodels.OperationalIntentStateAccepted,
+		StartTime:      &start,
+		EndTime:        &end,
+		USSBaseURL:     "https://uss1.example.com",
+		SubscriptionID: sub.ID,
+		Cells:          cells,
+	}, "")
+	require.NoError(t, err)
+	return op
+}
+
+func TestOVNDerivesFromClock(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if store.supports(v3100) {
+		t.Skip("OVNs are sequenced starting with schema 3.10.0")
+	}
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	require.Equal(t, scdmodels.NewOVNFromTime(fakeClock.Now(), op.ID.String()), op.OVN)
+
+	fakeClock.Advance(time.Minute)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	op.Version++
+	op, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	require.Equal(t, scdmodels.NewOVNFromTime(fakeClock.Now(), op.ID.String()), op.OVN)
+}
+
+func TestSequencedOVNs(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if !store.supports(v3100) {
+		t.Skip("Requires schema 3.10.0")
+	}
+
+	// The clock does not advance between the writes, which yielded the same
+	// OVN when derived from it.
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	first := op.OVN
+	op.Version++
+	op, err = repo.UpsertOperationalIntent(ctx, op, first)
+	require.NoError(t, err)
+	require.NotEqual(t, first, op.OVN)
+	require.NotEqual(t, scdmodels.NewOVNFromTime(fakeClock.Now(), op.ID.String()), op.OVN)
+
+	got, err := repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.Equal(t, op.OVN, got.OVN)
+	_, err = repo.UpsertOperationalIntent(ctx, op, first)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+
+	sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+	updated, err := repo.UpsertSubscription(ctx, sub, sub.Version)
+	require.NoError(t, err)
+	require.NotEqual(t, sub.Version, updated.Version)
+	_, err = repo.UpsertSubscription(ctx, sub, sub.Version)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+}
+
+func TestUpsertOperationalIntentRequiresCurrentOVN(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	_, err = repo.UpsertOperationalIntent(ctx, op, "")
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+
+	fakeClock.Advance(time.Minute)
+	stale := op.OVN
+	_, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	_, err = repo.UpsertOperationalIntent(ctx, op, stale)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+}
+
+func TestGetFullOperationalIntentByOVN(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if !store.supports(v320) {
+		t.Skip("Requires schema 3.2.0")
+	}
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	fakeClock.Advance(time.Minute)
+	first := op.OVN
+	op.Version++
+	op, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+
+	got, err := repo.GetFullOperationalIntentByOVN(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, first, got.OVN)
+	require.Equal(t, op.Version-1, got.Version)
+	require.Equal(t, op.Cells, got.Cells)
+	got, err = repo.GetFullOperationalIntentByOVN(ctx, op.OVN)
+	require.NoError(t, err)
+	require.Equal(t, op.Version, got.Version)
+	got, err = repo.GetFullOperationalIntentByOVN(ctx, "unknown-ovn-of-an-operation")
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestEntityHistory(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if !store.supports(v390) {
+		t.Skip("Requires schema 3.9.0")
+	}
+
+	start := fakeClock.Now()
+	op := insertOperationalIntent(ctx, t, store, start, start.Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	fakeClock.Advance(time.Minute)
+	op.Version++
+	op, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteOperationalIntent(ctx, op.ID))
+
+	// The versions outlive the operational intent.
+	versions, err := repo.ListOperationalIntentVersions(ctx, op.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, op.Version-1, versions[0].Version)
+	require.True(t, versions[0].UpdatedAt.Equal(start))
+	require.Equal(t, op.OVN, versions[1].OVN)
+	got, err := repo.GetFullOperationalIntentByOVN(ctx, op.OVN)
+	require.NoError(t, err)
+	require.Equal(t, op.Version, got.Version)
+
+	constraint, err := repo.UpsertConstraint(ctx, &scdmodels.Constraint{
+		ID:         dssmodels.ID(uuid.New().String()),
+		Manager:    "uss1",
+		Version:    1,
+		StartTime:  &start,
+		EndTime:    op.EndTime,
+		USSBaseURL: "https://uss1.example.com",
+		Cells:      cells,
+	})
+	require.NoError(t, err)
+	fakeClock.Advance(time.Minute)
+	constraint.Version++
+	constraint, err = repo.UpsertConstraint(ctx, constraint)
+	require.NoError(t, err)
+	constraintVersions, err := repo.ListConstraintVersions(ctx, constraint.ID)
+	require.NoError(t, err)
+	require.Len(t, constraintVersions, 2)
+	require.Equal(t, constraint.OVN, constraintVersions[1].OVN)
+
+	// Only the current version of the constraint is left, the operational
+	// intent having been deleted.
+	_, err = store.PurgeVersions(ctx, fakeClock.Now().Add(time.Second))
+	require.NoError(t, err)
+	versions, err = repo.ListOperationalIntentVersions(ctx, op.ID)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+	constraintVersions, err = repo.ListConstraintVersions(ctx, constraint.ID)
+	require.NoError(t, err)
+	require.Len(t, constraintVersions, 1)
+	require.Equal(t, constraint.OVN, constraintVersions[0].OVN)
+}
+
+func TestTransferOperationalIntentManager(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	sub, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:         dssmodels.ID(uuid.New().String()),
+		Manager:    "uss2",
+		StartTime:  op.StartTime,
+		EndTime:    op.EndTime,
+		USSBaseURL: "https://uss2.example.com",
+		Cells:      cells,
+	}, "")
+	require.NoError(t, err)
+	transfer := scdmodels.ManagerTransfer{
+		From:           "uss1",
+		To:             "uss2",
+		USSBaseURL:     "https://uss2.example.com",
+		SubscriptionID: sub.ID,
+	}
+
+	_, err = repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, scdmodels.ManagerTransfer{
+		From:           "uss3",
+		To:             "uss2",
+		USSBaseURL:     "https://uss2.example.com",
+		SubscriptionID: sub.ID,
+	})
+	require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+
+	fakeClock.Advance(time.Minute)
+	transferred, err := repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, transfer)
+	require.NoError(t, err)
+	require.Equal(t, dssmodels.Manager("uss2"), transferred.Manager)
+	require.Equal(t, sub.ID, transferred.SubscriptionID)
+	require.Equal(t, op.Version+1, transferred.Version)
+	require.NotEqual(t, op.OVN, transferred.OVN)
+	if !store.supports(v3100) {
+		require.Equal(t, scdmodels.NewOVNFromTime(fakeClock.Now(), op.ID.String()), transferred.OVN)
+	}
+
+	_, err = repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, transfer)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+}
+
+func TestIncrementNotificationIndices(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+		start                = fakeClock.Now()
+		end                  = start.Add(time.Hour)
+	)
+	defer tearDownStore()
+
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	var ids []dssmodels.ID
+	for i := 0; i < 20; i++ {
+		sub, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:                          dssmodels.ID(uuid.New().String()),
+			Manager:                     "uss1",
+			StartTime:                   &start,
+			EndTime:                     &end,
+			USSBaseURL:                  "https://uss1.example.com",
+			NotifyForOperationalIntents: true,
+			Cells:                       cells,
+		}, "")
+		require.NoError(t, err)
+		ids = append(ids, sub.ID)
+	}
+	// Give every Subscription a distinct index, so that mismatching them
+	// would show.
+	for i, id := range ids {
+		for k := 0; k < i; k++ {
+			_, err := repo.IncrementNotificationIndices(ctx, []dssmodels.ID{id})
+			require.NoError(t, err)
+		}
+	}
+
+	indices, err := repo.IncrementNotificationIndices(ctx, ids)
+	require.NoError(t, err)
+	require.Len(t, indices, len(ids))
+	for i, id := range ids {
+		sub, err := repo.GetSubscription(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, sub.NotificationIndex, indices[i])
+		require.Equal(t, i+1, indices[i])
+	}
+
+	_, err = repo.IncrementNotificationIndices(ctx, []dssmodels.ID{dssmodels.ID(uuid.New().String())})
+	require.Error(t, err)
+}
+
+func TestCellsTableIndex(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if !store.supports(v340) {
+		t.Skip("Requires schema 3.4.0")
+	}
+	require.NoError(t, store.UseSpatialIndex(CellsTableIndex{}.Name()))
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	ops, err := repo.SearchOperationalIntents(ctx, &dssmodels.Volume4D{
+		SpatialVolume: &dssmodels.Volume3D{
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return cells, nil
+			}),
+		},
+	}, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, op.ID, ops[0].ID)
+
+	require.Error(t, store.UseSpatialIndex("no_such_index"))
+}
+
+func TestGeographyIndex(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	if !store.supports(v360) {
+		t.Skip("Requires schema 3.6.0")
+	}
+	require.NoError(t, store.UseSpatialIndex(GeographyIndex{}.Name()))
+
+	// An operation without footprint is selected through its cells.
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	search := func(footprint dssmodels.Geometry) []*scdmodels.OperationalIntent {
+		ops, err := repo.SearchOperationalIntents(ctx, &dssmodels.Volume4D{
+			SpatialVolume: &dssmodels.Volume3D{Footprint: footprint},
+		}, false, scdmodels.OperationalIntentFilter{})
+		require.NoError(t, err)
+		return ops
+	}
+	near := &dssmodels.GeoCircle{Center: dssmodels.LatLngPoint{Lat: 46.2, Lng: 6.1}, RadiusMeter: 50}
+	ops := search(near)
+	require.Len(t, ops, 1)
+	require.Equal(t, op.ID, ops[0].ID)
+
+	// Once its footprint is stored, only searches intersecting it select it,
+	// even where they share cells.
+	op.Footprint = near
+	op.Cells = cells
+	_, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	require.Len(t, search(near), 1)
+	require.Empty(t, search(&dssmodels.GeoCircle{Center: dssmodels.LatLngPoint{Lat: 46.2, Lng: 6.101}, RadiusMeter: 10}))
+
+	require.NoError(t, store.UseSpatialIndex(InvertedIndex{}.Name()))
+	repo, err = store.Interact(ctx)
+	require.NoError(t, err)
+	require.Len(t, search(&dssmodels.GeoCircle{Center: dssmodels.LatLngPoint{Lat: 46.2, Lng: 6.101}, RadiusMeter: 10}), 1)
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	violations, err := store.CheckIntegrity(ctx, 0)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	// Simulate an operational intent written without cells.
+	_, err = store.db.ExecContext(ctx, `UPDATE scd_operations SET cells = ARRAY[]::INT64[] WHERE id = $1`, op.ID)
+	require.NoError(t, err)
+	violations, err = store.CheckIntegrity(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, []IntegrityViolation{{
+		ID:        op.ID,
+		Manager:   op.Manager,
+		Violation: ViolationNoCells,
+	}}, violations)
+
+	if !store.supports(v330) {
+		return
+	}
+	defer func() {
+		_, err := store.db.ExecContext(ctx, `DELETE FROM scd_quarantined_operations WHERE id = $1`, op.ID)
+		require.NoError(t, err)
+	}()
+
+	// Operational intents fixed since they were checked stay in place.
+	_, err = store.db.ExecContext(ctx, `UPDATE scd_operations SET cells = $2 WHERE id = $1`, op.ID, pq.Int64Array{int64(cells[0])})
+	require.NoError(t, err)
+	quarantined, err := store.Quarantine(ctx, violations[0])
+	require.NoError(t, err)
+	require.False(t, quarantined)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+
+	_, err = store.db.ExecContext(ctx, `UPDATE scd_operations SET cells = ARRAY[]::INT64[] WHERE id = $1`, op.ID)
+	require.NoError(t, err)
+	quarantined, err = store.Quarantine(ctx, violations[0])
+	require.NoError(t, err)
+	require.True(t, quarantined)
+	violations, err = store.CheckIntegrity(ctx, 0)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+}
+
+func TestSearchExcludesOperationalIntentsExpiredByClock(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	v4d := &dssmodels.Volume4D{
+		SpatialVolume: &dssmodels.Volume3D{
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return cells, nil
+			}),
+		},
+	}
+
+	ops, err := repo.SearchOperationalIntents(ctx, v4d, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Equal(t, op.ID, ops[0].ID)
+
+	fakeClock.Advance(2 * time.Hour)
+	ops, err = repo.SearchOperationalIntents(ctx, v4d, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+
+	ops, err = repo.SearchOperationalIntents(ctx, v4d, true, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+}
+
+func TestSearchOperationalIntentReferences(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+
+	op := insertOperationalIntent(ctx, t, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	v4d := &dssmodels.Volume4D{
+		SpatialVolume: &dssmodels.Volume3D{
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return cells, nil
+			}),
+		},
+	}
+
+	refs, err := repo.SearchOperationalIntentReferences(ctx, v4d, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	require.Equal(t, op.ID, refs[0].ID)
+	require.Equal(t, op.OVN, refs[0].OVN)
+	require.Nil(t, refs[0].Cells)
+
+	opCells, err := repo.GetOperationalIntentCells(ctx, op.ID)
+	require.NoError(t, err)
+	require.Equal(t, op.Cells, opCells)
+
+	opCells, err = repo.GetOperationalIntentCells(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.Nil(t, opCells)
+}
+
+// BenchmarkUpsertSubscription compares the insert throughput of random and
+// time-ordered IDs, with a plain and a hash-sharded primary key; see
+// build/deploy/db_schemas/README.md. The primary key of scd_subscriptions is
+// left plain.
+func BenchmarkUpsertSubscription(b *testing.B) {
+	for _, buckets := range []int{0, 8} {
+		for _, version := range []ids.Version{ids.V4, ids.V7} {
+			b.Run(fmt.Sprintf("buckets=%d/%s", buckets, version), func(b *testing.B) {
+				var (
+					ctx                  = context.Background()
+					store, tearDownStore = setUpStore(ctx, b)
+					start                = fakeClock.Now()
+					end                  = start.Add(time.Hour)
+				)
+				defer tearDownStore()
+				_, err := store.db.ShardPrimaryKey(ctx, DatabaseName, "scd_subscriptions", buckets)
+				require.NoError(b, err)
+				repo, err := store.Interact(ctx)
+				require.NoError(b, err)
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						id, err := ids.New(version, time.Now())
+						require.NoError(b, err)
+						_, err = repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+							ID:                          dssmodels.ID(id.String()),
+							Manager:                     "uss1",
+							StartTime:                   &start,
+							EndTime:                     &end,
+							USSBaseURL:                  "https://uss1.example.com",
+							NotifyForOperationalIntents: true,
+							Cells:                       cells,
+						}, "")
+						require.NoError(b, err)
+					}
+				})
+			})
+		}
+	}
+	if len(*storeURI) > 0 {
+		ctx := context.Background()
+		store, tearDownStore := setUpStore(ctx, b)
+		defer tearDownStore()
+		_, err := store.db.ShardPrimaryKey(ctx, DatabaseName, "scd_subscriptions", 0)
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkSearchOperationalIntents compares the search latency of the
+// spatial indexes, reporting the 99th percentile besides the mean; see
+// build/deploy/db_schemas/README.md.
+func BenchmarkSearchOperationalIntents(b *testing.B) {
+	for name := range SpatialIndexes {
+		b.Run(name, func(b *testing.B) {
+			var (
+				ctx                  = context.Background()
+				store, tearDownStore = setUpStore(ctx, b)
+			)
+			defer tearDownStore()
+			if err := store.UseSpatialIndex(name); err != nil {
+				b.Skip(err)
+			}
+			for i := 0; i < 100; i++ {
+				insertOperationalIntent(ctx, b, store, fakeClock.Now(), fakeClock.Now().Add(time.Hour))
+			}
+			repo, err := store.Interact(ctx)
+			require.NoError(b, err)
+			v4d := &dssmodels.Volume4D{
+				SpatialVolume: &dssmodels.Volume3D{
+					Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+						return cells, nil
+					}),
+				},
+			}
+
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				_, err := repo.SearchOperationalIntents(ctx, v4d, false, scdmodels.OperationalIntentFilter{})
+				latencies[i] = time.Since(start)
+				require.NoError(b, err)
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns/op")
+		})
+	}
+}
+
+func TestSearchQueryPlans(t *testing.T) {
+	var (
+		ctx                  = context.Background()
+		store, tearDownStore = setUpStore(ctx, t)
+	)
+	defer tearDownStore()
+	vs, err := store.GetVersion(ctx)
+	require.NoError(t, err)
+	if vs.Compare(v350) < 0 {
+		t.Skip("Requires schema 3.5.0")
+	}
+
+	start := fakeClock.Now()
+	end := start.Add(time.Hour)
+	v4d := &dssmodels.Volume4D{
+		StartTime: &start,
+		EndTime:   &end,
+		SpatialVolume: &dssmodels.Volume3D{
+			Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+				return cells, nil
+			}),
+		},
+	}
+	repo := store.newRepo(store.db)
+	explain := func(query string, args []interface{}) string {
+		rows, err := store.db.QueryContext(ctx, "EXPLAIN "+query, args...)
+		require.NoError(t, err)
+		defer rows.Close()
+		var plan []string
+		for rows.Next() {
+			var line string
+			require.NoError(t, rows.Scan(&line))
+			plan = append(plan, line)
+		}
+		require.NoError(t, rows.Err())
+		return strings.Join(plan, "\n")
+	}
+
+	query, args, err := repo.searchConstraintsQuery(ctx, v4d, scdmodels.ConstraintFilter{})
+	require.NoError(t, err)
+	require.NotContains(t, explain(query, args), "FULL SCAN")
+
+	query, args, err = repo.searchOperationalIntentsQuery(ctx, repo.operationFields("scd_operations.", true), v4d, false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.NotContains(t, explain(query, args), "FULL SCAN")
+}
+
+func TestSupportedSchemasIncludeLatestMigration(t *testing.T) {
+	latest, err := cockroach.LatestSchemaVersion("../../../../build/deploy/db_schemas/scd")
+	require.NoError(t, err)
+	require.Equal(t, *latest, SupportedSchemas.Max)
+}
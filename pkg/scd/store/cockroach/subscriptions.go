@@ -2,10 +2,11 @@ package cockroach
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/interuss/dss/pkg/cockroach"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	dsssql "github.com/interuss/dss/pkg/sql"
@@ -15,39 +16,41 @@ import (
 	"github.com/lib/pq"
 )
 
-var (
-	subscriptionFieldsWithIndices   [12]string
-	subscriptionFieldsWithPrefix    string
-	subscriptionFieldsWithoutPrefix string
-)
-
-// TODO Update database schema and fields below.
-func init() {
-	subscriptionFieldsWithIndices[0] = "id"
-	subscriptionFieldsWithIndices[1] = "owner"
-	subscriptionFieldsWithIndices[2] = "version"
-	subscriptionFieldsWithIndices[3] = "url"
-	subscriptionFieldsWithIndices[4] = "notification_index"
-	subscriptionFieldsWithIndices[5] = "notify_for_operations"
-	subscriptionFieldsWithIndices[6] = "notify_for_constraints"
-	subscriptionFieldsWithIndices[7] = "implicit"
-	subscriptionFieldsWithIndices[8] = "starts_at"
-	subscriptionFieldsWithIndices[9] = "ends_at"
-	subscriptionFieldsWithIndices[10] = "cells"
-	subscriptionFieldsWithIndices[11] = "updated_at"
-
-	subscriptionFieldsWithoutPrefix = strings.Join(
-		subscriptionFieldsWithIndices[:], ",",
-	)
+// subscriptionRow holds the columns of a Subscription row which are not read
+// directly into the Subscription.
+type subscriptionRow struct {
+	version   int
+	cells     pq.Int64Array
+	updatedAt time.Time
+	ovn       sql.NullString
+}
 
-	withPrefix := make([]string, 12)
-	for idx, field := range subscriptionFieldsWithIndices {
-		withPrefix[idx] = "scd_subscriptions." + field
+// subscriptionColumns returns the columns read into s and row, followed by
+// the ovn column if the schema holds it.
+func (c *repo) subscriptionColumns(s *scdmodels.Subscription, row *subscriptionRow) dsssql.Columns {
+	columns := dsssql.Columns{
+		{Name: "id", Value: &s.ID},
+		{Name: "owner", Value: &s.Manager},
+		{Name: "version", Value: &row.version},
+		{Name: "url", Value: &s.USSBaseURL},
+		{Name: "notification_index", Value: &s.NotificationIndex},
+		{Name: "notify_for_operations", Value: &s.NotifyForOperationalIntents},
+		{Name: "notify_for_constraints", Value: &s.NotifyForConstraints},
+		{Name: "implicit", Value: &s.ImplicitSubscription},
+		{Name: "starts_at", Value: &s.StartTime},
+		{Name: "ends_at", Value: &s.EndTime},
+		{Name: "cells", Value: &row.cells},
+		{Name: "updated_at", Value: &row.updatedAt},
 	}
+	if c.supports(v3100) {
+		columns = columns.With("ovn", &row.ovn)
+	}
+	return columns
+}
 
-	subscriptionFieldsWithPrefix = strings.Join(
-		withPrefix[:], ",",
-	)
+// subscriptionFields returns the columns read into Subscriptions.
+func (c *repo) subscriptionFields() string {
+	return c.subscriptionColumns(new(scdmodels.Subscription), new(subscriptionRow)).Names("scd_subscriptions.")
 }
 
 func (c *repo) fetchCellsForSubscription(ctx context.Context, q dsssql.Queryable, id dssmodels.ID) (s2.CellUnion, error) {
@@ -93,35 +96,16 @@ func (c *repo) fetchSubscriptions(ctx context.Context, q dsssql.Queryable, query
 	defer rows.Close()
 
 	var payload []*scdmodels.Subscription
-	cids := pq.Int64Array{}
 	for rows.Next() {
 		var (
-			s         = new(scdmodels.Subscription)
-			updatedAt time.Time
-			version   int
+			s   = new(scdmodels.Subscription)
+			row subscriptionRow
 		)
-		err = rows.Scan(
-			&s.ID,
-			&s.Manager,
-			&version,
-			&s.USSBaseURL,
-			&s.NotificationIndex,
-			&s.NotifyForOperationalIntents,
-			&s.NotifyForConstraints,
-			&s.ImplicitSubscription,
-			&s.StartTime,
-			&s.EndTime,
-			&cids,
-			&updatedAt,
-		)
-		if err != nil {
+		if err := rows.Scan(c.subscriptionColumns(s, &row).Values()...); err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning Subscription row")
 		}
-		s.Version = scdmodels.NewOVNFromTime(updatedAt, s.ID.String())
-		if err != nil {
-			return nil, stacktrace.Propagate(err, "Error generating Subscription version")
-		}
-		s.SetCells(cids)
+		s.Version = storedOVN(row.ovn, row.updatedAt, s.ID)
+		s.SetCells(row.cells)
 		payload = append(payload, s)
 	}
 	if err = rows.Err(); err != nil {
@@ -153,7 +137,7 @@ func (c *repo) fetchSubscriptionByID(ctx context.Context, q dsssql.Queryable, id
 			FROM
 				scd_subscriptions
 			WHERE
-				id = $1`, subscriptionFieldsWithPrefix)
+				id = $1`, c.subscriptionFields())
 	)
 	result, err := c.fetchSubscription(ctx, q, query, id)
 	if err != nil {
@@ -169,26 +153,7 @@ func (c *repo) fetchSubscriptionByID(ctx context.Context, q dsssql.Queryable, id
 	return result, nil
 }
 
-func (c *repo) pushSubscription(ctx context.Context, q dsssql.Queryable, s *scdmodels.Subscription) (*scdmodels.Subscription, error) {
-	var (
-		upsertQuery = fmt.Sprintf(`
-		WITH v AS (
-			SELECT
-				version
-			FROM
-				scd_subscriptions
-			WHERE
-				id = $1
-		)
-		UPSERT INTO
-		  scd_subscriptions
-		  (%s)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, transaction_timestamp())
-		RETURNING
-			%s`, subscriptionFieldsWithoutPrefix, subscriptionFieldsWithPrefix)
-	)
-
+func (c *repo) pushSubscription(ctx context.Context, q dsssql.Queryable, s *scdmodels.Subscription, previous scdmodels.OVN) (*scdmodels.Subscription, error) {
 	cids := make([]int64, len(s.Cells))
 	clevels := make([]int, len(s.Cells))
 
@@ -197,23 +162,41 @@ func (c *repo) pushSubscription(ctx context.Context, q dsssql.Queryable, s *scdm
 		clevels[i] = cell.Level()
 	}
 
-	s, err := c.fetchSubscription(ctx, q, upsertQuery,
-		s.ID,
-		s.Manager,
-		0,
-		s.USSBaseURL,
-		s.NotificationIndex,
-		s.NotifyForOperationalIntents,
-		s.NotifyForConstraints,
-		s.ImplicitSubscription,
-		s.StartTime,
-		s.EndTime,
-		pq.Int64Array(cids))
+	upsertQuery, args, err := c.conditionalWrite(ctx, "scd_subscriptions", s.ID, dsssql.Columns{
+		{Name: "id", Value: s.ID},
+		{Name: "owner", Value: s.Manager},
+		{Name: "version", Value: 0},
+		{Name: "url", Value: s.USSBaseURL},
+		{Name: "notification_index", Value: s.NotificationIndex},
+		{Name: "notify_for_operations", Value: s.NotifyForOperationalIntents},
+		{Name: "notify_for_constraints", Value: s.NotifyForConstraints},
+		{Name: "implicit", Value: s.ImplicitSubscription},
+		{Name: "starts_at", Value: s.StartTime},
+		{Name: "ends_at", Value: s.EndTime},
+		{Name: "cells", Value: pq.Int64Array(cids)},
+		{Name: "updated_at", Value: c.clock.Now()},
+	}, s.Cells, previous)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error checking version of Subscription")
+	}
+	upsertQuery = `
+		WITH v AS (
+			SELECT
+				version
+			FROM
+				scd_subscriptions
+			WHERE
+				id = $1
+		)` + upsertQuery + fmt.Sprintf(`
+		RETURNING
+			%s`, c.subscriptionFields())
+	id := s.ID
+	s, err = c.fetchSubscription(ctx, q, upsertQuery, args...)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Error fetching Subscription from upsert query")
 	}
 	if s == nil {
-		return nil, stacktrace.NewError("Upsert query did not return a Subscription")
+		return nil, writeConflict("Subscription", id, previous)
 	}
 
 	return s, nil
@@ -231,8 +214,8 @@ func (c *repo) GetSubscription(ctx context.Context, id dssmodels.ID) (*scdmodels
 }
 
 // Implements repos.Subscription.UpsertSubscription
-func (c *repo) UpsertSubscription(ctx context.Context, s *scdmodels.Subscription) (*scdmodels.Subscription, error) {
-	newSubscription, err := c.pushSubscription(ctx, c.q, s)
+func (c *repo) UpsertSubscription(ctx context.Context, s *scdmodels.Subscription, previous scdmodels.OVN) (*scdmodels.Subscription, error) {
+	newSubscription, err := c.pushSubscription(ctx, c.q, s, previous)
 	if err != nil {
 		return nil, err // No need to Propagate this error as this stack layer does not add useful information
 	}
@@ -268,30 +251,61 @@ func (c *repo) DeleteSubscription(ctx context.Context, id dssmodels.ID) error {
 }
 
 // Implements SubscriptionStore.SearchSubscriptions
-func (c *repo) SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D) ([]*scdmodels.Subscription, error) {
-	var (
-		query = fmt.Sprintf(`
+func (c *repo) SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error) {
+	query, args, err := c.subscriptionsInVolume(fmt.Sprintf(`
 			SELECT
 				%s
 			FROM
 				scd_subscriptions
-				WHERE
-					cells && $1
-				AND
-					COALESCE(starts_at <= $3, true)
-				AND
-					COALESCE(ends_at >= $2, true)`, subscriptionFieldsWithPrefix)
-	)
+				WHERE`, c.subscriptionFields()), v4d, filter)
+	if err != nil || query == "" {
+		return nil, err
+	}
+	subscriptions, err := c.fetchSubscriptions(ctx, c.q, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to fetch Subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// Implements scd.repos.Subscription.NotifySubscriptions
+//
+// The Subscriptions are searched and their indices incremented by a single
+// UPDATE statement returning them, rather than by a search followed by
+// IncrementNotificationIndices.
+func (c *repo) NotifySubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error) {
+	query, args, err := c.subscriptionsInVolume(fmt.Sprintf(`
+			UPDATE scd_subscriptions
+			SET notification_index = %s
+			WHERE`, cockroach.IncrementNotificationIndex(c.supports(v3110))), v4d, filter)
+	if err != nil || query == "" {
+		return nil, err
+	}
+	query += fmt.Sprintf(`
+			RETURNING
+				%s`, c.subscriptionFields())
+	subscriptions, err := c.fetchSubscriptions(ctx, c.q, query, args...)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to notify Subscriptions")
+	}
+
+	return subscriptions, nil
+}
 
+// subscriptionsInVolume returns statement, ending with the WHERE keyword,
+// followed by the conditions selecting the Subscriptions in v4d passing
+// filter, and its arguments, or an empty statement if v4d covers no cells.
+func (c *repo) subscriptionsInVolume(statement string, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) (string, []interface{}, error) {
 	// TODO: Lazily calculate & cache spatial covering so that it is only ever
 	// computed once on a particular Volume4D
 	cells, err := v4d.CalculateSpatialCovering()
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
+		return "", nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
 	}
 
 	if len(cells) == 0 {
-		return nil, nil
+		return "", nil, nil
 	}
 
 	cids := make([]int64, len(cells))
@@ -299,22 +313,77 @@ func (c *repo) SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D)
 		cids[i] = int64(cell)
 	}
 
-	subscriptions, err := c.fetchSubscriptions(
-		ctx, c.q, query, pq.Array(cids), v4d.StartTime, v4d.EndTime)
+	query := statement + `
+					cells && $1`
+	args := []interface{}{pq.Array(cids)}
+	query, args = restrictToTimeRange(query, args, "", v4d.StartTime, v4d.EndTime)
+	if filter.NotifyForOperationalIntents {
+		query += " AND notify_for_operations"
+	}
+	if filter.NotifyForConstraints {
+		query += " AND notify_for_constraints"
+	}
+	if c.supports(v310) {
+		query, args = cockroach.RestrictToRegions(query, args, "region", cells)
+	}
+	return query, args, nil
+}
+
+// Implements scd.repos.Subscription.ListExpiringSubscriptions
+func (c *repo) ListExpiringSubscriptions(ctx context.Context, after, until time.Time) ([]*scdmodels.Subscription, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_subscriptions
+		WHERE
+			ends_at > $1
+		AND
+			ends_at <= $2
+		ORDER BY
+			ends_at`, c.subscriptionFields())
+
+	subscriptions, err := c.fetchSubscriptions(ctx, c.q, query, after, until)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Unable to fetch Subscriptions")
+		return nil, stacktrace.Propagate(err, "Unable to fetch expiring Subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// Implements scd.repos.Subscription.ListSubscriptionsByManager
+func (c *repo) ListSubscriptionsByManager(ctx context.Context, manager dssmodels.Manager, after time.Time) ([]*scdmodels.Subscription, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			scd_subscriptions
+		WHERE
+			owner = $1
+		AND
+			(ends_at IS NULL OR ends_at > $2)
+		ORDER BY
+			starts_at`, c.subscriptionFields())
+
+	subscriptions, err := c.fetchSubscriptions(ctx, c.q, query, manager, after)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Unable to fetch Subscriptions of %s", manager)
 	}
 
 	return subscriptions, nil
 }
 
 // Implements scd.repos.Subscription.IncrementNotificationIndices
+//
+// The indices are incremented by a single statement however many
+// Subscriptions are notified. Since CockroachDB returns the updated rows in
+// no particular order, they are matched to subscriptionIds by ID.
 func (c *repo) IncrementNotificationIndices(ctx context.Context, subscriptionIds []dssmodels.ID) ([]int, error) {
-	var updateQuery = `
+	var updateQuery = fmt.Sprintf(`
 			UPDATE scd_subscriptions
-			SET notification_index = notification_index + 1
+			SET notification_index = %s
 			WHERE id = ANY($1)
-			RETURNING notification_index`
+			RETURNING id, notification_index`, cockroach.IncrementNotificationIndex(c.supports(v3110)))
 
 	ids := make([]string, len(subscriptionIds))
 	for i, id := range subscriptionIds {
@@ -327,24 +396,93 @@ func (c *repo) IncrementNotificationIndices(ctx context.Context, subscriptionIds
 	}
 	defer rows.Close()
 
-	var indices []int
+	updated := make(map[dssmodels.ID]int, len(subscriptionIds))
 	for rows.Next() {
-		var notificationIndex int
-		err := rows.Scan(&notificationIndex)
+		var (
+			id                string
+			notificationIndex int
+		)
+		err := rows.Scan(&id, &notificationIndex)
 		if err != nil {
 			return nil, stacktrace.Propagate(err, "Error scanning notification index row")
 		}
-		indices = append(indices, notificationIndex)
+		updated[dssmodels.ID(id)] = notificationIndex
 	}
 	if err := rows.Err(); err != nil {
 		return nil, stacktrace.Propagate(err, "Error in rows query result")
 	}
 
-	if len(indices) != len(subscriptionIds) {
-		return nil, stacktrace.NewError(
-			"Expected %d notification_index results when incrementing but got %d instead",
-			len(subscriptionIds), len(indices))
+	indices := make([]int, len(subscriptionIds))
+	for i, id := range subscriptionIds {
+		notificationIndex, ok := updated[id]
+		if !ok {
+			return nil, stacktrace.NewError(
+				"Expected notification_index result for Subscription %s when incrementing but got none", id)
+		}
+		indices[i] = notificationIndex
 	}
 
 	return indices, nil
 }
+
+// Implements scd.repos.Subscription.GetSubscriptionDependencies
+func (c *repo) GetSubscriptionDependencies(ctx context.Context, id dssmodels.ID) (*scdmodels.SubscriptionDependencies, error) {
+	const query = `
+		SELECT
+			(SELECT owner FROM scd_subscriptions WHERE id = $1),
+			ARRAY(
+				SELECT
+					id::STRING
+				FROM
+					scd_operations
+				WHERE
+					subscription_id = $1
+				ORDER BY
+					id
+			)`
+
+	var (
+		manager    sql.NullString
+		dependents pq.StringArray
+	)
+	if err := c.q.QueryRowContext(ctx, query, id).Scan(&manager, &dependents); err != nil {
+		return nil, stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	deps := &scdmodels.SubscriptionDependencies{
+		SubscriptionID:              id,
+		Exists:                      manager.Valid,
+		Manager:                     dssmodels.Manager(manager.String),
+		DependentOperationalIntents: make([]dssmodels.ID, len(dependents)),
+	}
+	for i, opID := range dependents {
+		deps.DependentOperationalIntents[i] = dssmodels.ID(opID)
+	}
+	return deps, nil
+}
+
+// Implements scd.repos.Subscription.ResetNotificationIndex
+func (c *repo) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) error {
+	const (
+		query = `
+		UPDATE
+			scd_subscriptions
+		SET
+			notification_index = 0
+		WHERE
+			id = $1`
+	)
+
+	res, err := c.q.ExecContext(ctx, query, id)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error in query: %s", query)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return stacktrace.Propagate(err, "Could not get RowsAffected")
+	}
+	if rows == 0 {
+		return stacktrace.NewError("Attempted to reset the notification index of non-existent Subscription")
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/cache"
+	"github.com/interuss/dss/pkg/events"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+)
+
+const (
+	// constraintCacheLevel is the level of the S2 cells by which the
+	// Constraints are cached.
+	constraintCacheLevel = 10
+	// constraintCacheBucket is the duration of the time buckets by which the
+	// Constraints are cached.
+	constraintCacheBucket = time.Hour
+	// maxConstraintCacheKeys is the largest number of cache entries a search
+	// is served from; larger searches bypass the cache.
+	maxConstraintCacheKeys = 64
+)
+
+// ConstraintCache is a Store caching the results of the searches for
+// Constraints by S2 cell at level constraintCacheLevel and by time bucket of
+// constraintCacheBucket. Only the searches made outside of transactions are
+// served from the cache: the transactions writing based on the Constraints
+// they find need their current state. The entries are invalidated by the writes of
+// Constraints through the ConstraintCache and, when it is subscribed to their
+// changefeed as an events.Sink, by the writes of other DSS instances. The
+// entries expire after a TTL bounding the staleness of the results with
+// respect to the writes missed otherwise.
+type ConstraintCache struct {
+	Store
+	cache *cache.Cache
+}
+
+// NewConstraintCache returns a ConstraintCache over s whose entries expire
+// after ttl.
+func NewConstraintCache(s Store, ttl time.Duration) *ConstraintCache {
+	return &ConstraintCache{
+		Store: s,
+		cache: cache.New(ttl, clockwork.NewRealClock()),
+	}
+}
+
+// Interact implements Interactor.
+func (c *ConstraintCache) Interact(ctx context.Context) (repos.Repository, error) {
+	r, err := c.Store.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedRepo{Repository: r, cache: c, immediate: true}, nil
+}
+
+// Transact implements Transactor. Constraints are searched without the cache
+// in the transaction, and those it writes are invalidated once it ends.
+func (c *ConstraintCache) Transact(ctx context.Context, f func(context.Context, repos.Repository) error) error {
+	var written s2.CellUnion
+	defer func() { c.invalidate(written) }()
+	return c.Store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		cr := &cachedRepo{Repository: r, cache: c}
+		defer func() { written = append(written, cr.written...) }()
+		return f(ctx, cr)
+	})
+}
+
+// invalidate removes the cache entries of the cells.
+func (c *ConstraintCache) invalidate(cells s2.CellUnion) {
+	if len(cells) == 0 {
+		return
+	}
+	tokens := parentTokens(cells)
+	c.cache.Invalidate(func(key string, _ interface{}) bool {
+		return tokens[key[:strings.Index(key, "/")]]
+	})
+}
+
+// Publish implements events.Sink, invalidating the cache entries of the
+// Constraints changed, including by other DSS instances. Deletions only
+// identify the Constraint deleted, so the entries holding it are found by
+// their content.
+func (c *ConstraintCache) Publish(_ context.Context, e *events.Event) error {
+	if e.Kind != events.KindConstraint {
+		return nil
+	}
+	var cells s2.CellUnion
+	for _, token := range e.Cells {
+		cells = append(cells, s2.CellIDFromToken(token))
+	}
+	tokens := parentTokens(cells)
+	id := dssmodels.ID(e.ID)
+	c.cache.Invalidate(func(key string, value interface{}) bool {
+		if tokens[key[:strings.Index(key, "/")]] {
+			return true
+		}
+		for _, constraint := range value.([]*scdmodels.Constraint) {
+			if constraint.ID == id {
+				return true
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// parentTokens returns the tokens of the parents of the cells at the level
+// of the cache entries.
+func parentTokens(cells s2.CellUnion) map[string]bool {
+	tokens := map[string]bool{}
+	for _, cell := range cells {
+		tokens[cell.Parent(constraintCacheLevel).ToToken()] = true
+	}
+	return tokens
+}
+
+// cachedRepo is a repos.Repository searching Constraints through a
+// ConstraintCache.
+type cachedRepo struct {
+	repos.Repository
+	cache *ConstraintCache
+	// immediate is set outside of transactions, where searches are served
+	// from the cache and writes invalidate it as soon as they happen.
+	immediate bool
+	// written are the cells of the Constraints written through the repo.
+	written s2.CellUnion
+}
+
+// SearchConstraints implements repos.Constraint. The cache entries hold the
+// Constraints of every type, filtered once read.
+func (r *cachedRepo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) ([]*scdmodels.Constraint, error) {
+	if !r.immediate || v4d.StartTime == nil || v4d.EndTime == nil ||
+		dssmodels.SearchOrderFromContext(ctx) == dssmodels.SearchOrderRelevance {
+		return r.Repository.SearchConstraints(ctx, v4d, filter)
+	}
+	cells, err := v4d.CalculateSpatialCovering()
+	if err != nil || len(cells) == 0 {
+		return r.Repository.SearchConstraints(ctx, v4d, filter)
+	}
+
+	var (
+		parents  []s2.CellID
+		queried  = map[s2.CellID]bool{}
+		seen     = map[s2.CellID]bool{}
+		first    = v4d.StartTime.Truncate(constraintCacheBucket)
+		nBuckets = int(v4d.EndTime.Sub(first)/constraintCacheBucket) + 1
+	)
+	for _, cell := range cells {
+		queried[cell] = true
+		parent := cell.Parent(constraintCacheLevel)
+		if !seen[parent] {
+			seen[parent] = true
+			parents = append(parents, parent)
+		}
+	}
+	if nBuckets <= 0 || len(parents)*nBuckets > maxConstraintCacheKeys {
+		return r.Repository.SearchConstraints(ctx, v4d, filter)
+	}
+
+	var (
+		result []*scdmodels.Constraint
+		found  = map[dssmodels.ID]bool{}
+	)
+	for _, parent := range parents {
+		for i := 0; i < nBuckets; i++ {
+			constraints, err := r.bucket(ctx, parent, first.Add(time.Duration(i)*constraintCacheBucket))
+			if err != nil {
+				return nil, err
+			}
+			for _, constraint := range constraints {
+				if found[constraint.ID] || !filter.Matches(constraint) || !overlaps(constraint, v4d, queried) {
+					continue
+				}
+				found[constraint.ID] = true
+				// Callers may modify the Constraints they get, such as
+				// redacting their OVNs, so they get copies.
+				c := *constraint
+				result = append(result, &c)
+			}
+		}
+	}
+	return result, nil
+}
+
+// bucket returns the Constraints in parent during the time bucket starting
+// at start.
+func (r *cachedRepo) bucket(ctx context.Context, parent s2.CellID, start time.Time) ([]*scdmodels.Constraint, error) {
+	key := fmt.Sprintf("%s/%d", parent.ToToken(), start.Unix())
+	v, err := r.cache.cache.Get(key, func() (interface{}, error) {
+		end := start.Add(constraintCacheBucket)
+		return r.Repository.SearchConstraints(ctx, &dssmodels.Volume4D{
+			StartTime: &start,
+			EndTime:   &end,
+			SpatialVolume: &dssmodels.Volume3D{
+				Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
+					cells := s2.CellUnion{parent}
+					geo.Levelify(&cells)
+					return cells, nil
+				}),
+			},
+		}, scdmodels.ConstraintFilter{})
+	})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error searching Constraints in cell %s", parent.ToToken())
+	}
+	return v.([]*scdmodels.Constraint), nil
+}
+
+// overlaps returns whether constraint intersects the cells and the time
+// range of v4d.
+func overlaps(constraint *scdmodels.Constraint, v4d *dssmodels.Volume4D, cells map[s2.CellID]bool) bool {
+	if constraint.EndTime != nil && constraint.EndTime.Before(*v4d.StartTime) {
+		return false
+	}
+	if constraint.StartTime != nil && constraint.StartTime.After(*v4d.EndTime) {
+		return false
+	}
+	for _, cell := range constraint.Cells {
+		if cells[cell] {
+			return true
+		}
+	}
+	return false
+}
+
+// UpsertConstraint implements repos.Constraint.
+func (r *cachedRepo) UpsertConstraint(ctx context.Context, constraint *scdmodels.Constraint) (*scdmodels.Constraint, error) {
+	previous := r.previousCells(ctx, constraint.ID)
+	result, err := r.Repository.UpsertConstraint(ctx, constraint)
+	if err != nil {
+		return nil, err
+	}
+	r.wrote(previous)
+	r.wrote(constraint.Cells)
+	return result, nil
+}
+
+// DeleteConstraint implements repos.Constraint.
+func (r *cachedRepo) DeleteConstraint(ctx context.Context, id dssmodels.ID) error {
+	cells := r.previousCells(ctx, id)
+	if err := r.Repository.DeleteConstraint(ctx, id); err != nil {
+		return err
+	}
+	r.wrote(cells)
+	return nil
+}
+
+// previousCells returns the cells of the Constraint identified by id before
+// it is written, so that the entries it is cached in get invalidated.
+func (r *cachedRepo) previousCells(ctx context.Context, id dssmodels.ID) s2.CellUnion {
+	old, err := r.Repository.GetConstraint(ctx, id)
+	if err != nil || old == nil {
+		return nil
+	}
+	return old.Cells
+}
+
+// wrote invalidates the cache entries of the cells of a Constraint written,
+// immediately outside of transactions and once they end otherwise.
+func (r *cachedRepo) wrote(cells s2.CellUnion) {
+	if r.immediate {
+		r.cache.invalidate(cells)
+		return
+	}
+	r.written = append(r.written, cells...)
+}
@@ -0,0 +1,133 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/interuss/dss/pkg/events"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraintCache(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		clock  = clockwork.NewFakeClock()
+		inner  = memory.NewStore(clock)
+		store  = scdstore.NewConstraintCache(inner, time.Hour)
+		start  = clock.Now()
+		end    = start.Add(time.Hour)
+		extent = &dssmodels.Volume4D{
+			StartTime: &start,
+			EndTime:   &end,
+			SpatialVolume: &dssmodels.Volume3D{
+				Footprint: &dssmodels.GeoCircle{
+					Center:      dssmodels.LatLngPoint{Lat: 46.2, Lng: 6.1},
+					RadiusMeter: 100,
+				},
+			},
+		}
+	)
+	cells, err := extent.CalculateSpatialCovering()
+	require.NoError(t, err)
+	constraint := func() *scdmodels.Constraint {
+		return &scdmodels.Constraint{
+			ID:         dssmodels.ID(uuid.New().String()),
+			Manager:    "uss1",
+			Type:       scdmodels.ConstraintTypeRestriction,
+			Version:    1,
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss1.example.com",
+			Cells:      cells,
+		}
+	}
+	search := func() []*scdmodels.Constraint {
+		r, err := store.Interact(ctx)
+		require.NoError(t, err)
+		result, err := r.SearchConstraints(ctx, extent, scdmodels.ConstraintFilter{})
+		require.NoError(t, err)
+		return result
+	}
+	searchInTransaction := func() []*scdmodels.Constraint {
+		var result []*scdmodels.Constraint
+		require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+			var err error
+			result, err = r.SearchConstraints(ctx, extent, scdmodels.ConstraintFilter{})
+			return err
+		}))
+		return result
+	}
+
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		_, err := r.UpsertConstraint(ctx, constraint())
+		require.NoError(t, err)
+		// Constraints written in a transaction are visible to its searches.
+		found, err := r.SearchConstraints(ctx, extent, scdmodels.ConstraintFilter{})
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		return nil
+	}))
+	require.Len(t, search(), 1)
+
+	// Writes bypassing the cache are not visible until the entries expire.
+	r, err := inner.Interact(ctx)
+	require.NoError(t, err)
+	bypassing, err := r.UpsertConstraint(ctx, constraint())
+	require.NoError(t, err)
+	require.Len(t, search(), 1)
+	// Transactions never search the cache.
+	require.Len(t, searchInTransaction(), 2)
+
+	// Unless their changes are published to the cache.
+	var tokens []string
+	for _, cell := range bypassing.Cells {
+		tokens = append(tokens, cell.ToToken())
+	}
+	require.NoError(t, store.Publish(ctx, &events.Event{
+		Kind: events.KindConstraint, Op: events.OperationUpsert, ID: bypassing.ID.String(), Cells: tokens,
+	}))
+	require.Len(t, search(), 2)
+	require.NoError(t, r.DeleteConstraint(ctx, bypassing.ID))
+	require.Len(t, search(), 2)
+	require.NoError(t, store.Publish(ctx, &events.Event{
+		Kind: events.KindConstraint, Op: events.OperationDelete, ID: bypassing.ID.String(),
+	}))
+	require.Len(t, search(), 1)
+	_, err = r.UpsertConstraint(ctx, bypassing)
+	require.NoError(t, err)
+	require.NoError(t, store.Publish(ctx, &events.Event{
+		Kind: events.KindConstraint, Op: events.OperationUpsert, ID: bypassing.ID.String(), Cells: tokens,
+	}))
+
+	// Writes through the cache invalidate its entries.
+	r, err = store.Interact(ctx)
+	require.NoError(t, err)
+	c, err := r.UpsertConstraint(ctx, constraint())
+	require.NoError(t, err)
+	require.Len(t, search(), 3)
+	require.NoError(t, r.DeleteConstraint(ctx, c.ID))
+	require.Len(t, search(), 2)
+
+	// Searches outside of the cached time range find nothing.
+	later, evenLater := end.Add(time.Hour), end.Add(2*time.Hour)
+	found, err := r.SearchConstraints(ctx, &dssmodels.Volume4D{
+		StartTime:     &later,
+		EndTime:       &evenLater,
+		SpatialVolume: extent.SpatialVolume,
+	}, scdmodels.ConstraintFilter{})
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	// Cached entries are filtered by type.
+	found, err = r.SearchConstraints(ctx, extent, scdmodels.ConstraintFilter{Types: []scdmodels.ConstraintType{scdmodels.ConstraintTypeAdvisory}})
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
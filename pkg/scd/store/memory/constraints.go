@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+)
+
+func copyConstraint(c *scdmodels.Constraint) *scdmodels.Constraint {
+	result := *c
+	result.Cells = copyCells(c.Cells)
+	return &result
+}
+
+// putConstraint stores c, replacing any Constraint with the same ID, and
+// keeps it as the version identified by its OVN. r.s must be locked.
+func (r *repo) putConstraint(c *scdmodels.Constraint) {
+	old, existed := r.s.constraints[c.ID]
+	if existed {
+		r.s.constraintCells.Remove(old.ID.String(), old.Cells)
+	}
+	oldVersion, versioned := r.s.constraintVersions[c.OVN]
+	r.s.constraints[c.ID] = c
+	r.s.constraintCells.Add(c.ID.String(), c.Cells)
+	r.s.constraintVersions[c.OVN] = c
+	r.onRollback(func() {
+		r.s.constraintCells.Remove(c.ID.String(), c.Cells)
+		delete(r.s.constraints, c.ID)
+		delete(r.s.constraintVersions, c.OVN)
+		if existed {
+			r.s.constraints[old.ID] = old
+			r.s.constraintCells.Add(old.ID.String(), old.Cells)
+		}
+		if versioned {
+			r.s.constraintVersions[c.OVN] = oldVersion
+		}
+	})
+}
+
+// Implements scd.repos.Constraint.GetConstraint
+func (r *repo) GetConstraint(_ context.Context, id dssmodels.ID) (*scdmodels.Constraint, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	c, ok := r.s.constraints[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyConstraint(c), nil
+}
+
+// Implements scd.repos.Constraint.UpsertConstraint
+func (r *repo) UpsertConstraint(_ context.Context, s *scdmodels.Constraint) (*scdmodels.Constraint, error) {
+	for _, cell := range s.Cells {
+		if err := geo.ValidateCell(cell); err != nil {
+			return nil, stacktrace.Propagate(err, "Error validating cell")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	stored := copyConstraint(s)
+	// UssAvailability is not persisted by the CockroachDB store either.
+	stored.UssAvailability = ""
+	stored.UpdatedAt = r.now()
+	stored.OVN = newOVN(stored.ID, stored.UpdatedAt, "")
+	r.putConstraint(stored)
+	return copyConstraint(stored), nil
+}
+
+// Implements scd.repos.Constraint.DeleteConstraint
+func (r *repo) DeleteConstraint(_ context.Context, id dssmodels.ID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.constraints[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	r.s.constraintCells.Remove(id.String(), old.Cells)
+	delete(r.s.constraints, id)
+	r.onRollback(func() {
+		r.s.constraints[id] = old
+		r.s.constraintCells.Add(id.String(), old.Cells)
+	})
+	return nil
+}
+
+// Implements scd.repos.Constraint.ListConstraintVersions
+func (r *repo) ListConstraintVersions(_ context.Context, id dssmodels.ID) ([]*scdmodels.Constraint, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	versions := []*scdmodels.Constraint{}
+	for _, c := range r.s.constraintVersions {
+		if c.ID == id {
+			versions = append(versions, copyConstraint(c))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].UpdatedAt.Before(versions[j].UpdatedAt)
+	})
+	return versions, nil
+}
+
+// Implements scd.repos.Constraint.SearchConstraints
+func (r *repo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) ([]*scdmodels.Constraint, error) {
+	cells, err := v4d.CalculateSpatialCovering()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
+	}
+	if len(cells) == 0 {
+		return []*scdmodels.Constraint{}, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*scdmodels.Constraint
+	for _, id := range r.s.constraintCells.Intersecting(cells) {
+		c := r.s.constraints[dssmodels.ID(id)]
+		if filter.Matches(c) && overlaps(c.StartTime, c.EndTime, v4d.StartTime, v4d.EndTime) {
+			result = append(result, copyConstraint(c))
+		}
+	}
+	if dssmodels.SearchOrderFromContext(ctx) == dssmodels.SearchOrderRelevance {
+		now := r.s.clock.Now()
+		sort.SliceStable(result, func(i, j int) bool {
+			return dssmodels.TemporalDistance(now, result[i].StartTime, result[i].EndTime) <
+				dssmodels.TemporalDistance(now, result[j].StartTime, result[j].EndTime)
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,306 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+)
+
+func copyOperationalIntent(op *scdmodels.OperationalIntent) *scdmodels.OperationalIntent {
+	result := *op
+	result.Cells = copyCells(op.Cells)
+	result.Volumes = append([]*dssmodels.Volume4D(nil), op.Volumes...)
+	result.OffNominalVolumes = append([]*dssmodels.Volume4D(nil), op.OffNominalVolumes...)
+	return &result
+}
+
+// putOperationalIntent stores op, replacing any OperationalIntent with the
+// same ID, and keeps it as the version identified by its OVN. r.s must be
+// locked.
+func (r *repo) putOperationalIntent(op *scdmodels.OperationalIntent) {
+	old, existed := r.s.operations[op.ID]
+	if existed {
+		r.s.operationCells.Remove(old.ID.String(), old.Cells)
+	}
+	oldVersion, versioned := r.s.operationVersions[op.OVN]
+	r.s.operations[op.ID] = op
+	r.s.operationCells.Add(op.ID.String(), op.Cells)
+	r.s.operationVersions[op.OVN] = op
+	r.onRollback(func() {
+		r.s.operationCells.Remove(op.ID.String(), op.Cells)
+		delete(r.s.operations, op.ID)
+		delete(r.s.operationVersions, op.OVN)
+		if existed {
+			r.s.operations[old.ID] = old
+			r.s.operationCells.Add(old.ID.String(), old.Cells)
+		}
+		if versioned {
+			r.s.operationVersions[op.OVN] = oldVersion
+		}
+	})
+}
+
+// removeOperationalIntent deletes the OperationalIntent identified by id,
+// whose versions are kept. r.s must be locked.
+func (r *repo) removeOperationalIntent(id dssmodels.ID) {
+	old, ok := r.s.operations[id]
+	if !ok {
+		return
+	}
+	r.s.operationCells.Remove(id.String(), old.Cells)
+	delete(r.s.operations, id)
+	r.onRollback(func() {
+		r.s.operations[id] = old
+		r.s.operationCells.Add(id.String(), old.Cells)
+	})
+}
+
+// GetOperationalIntent implements repos.OperationalIntent.GetOperationalIntent.
+func (r *repo) GetOperationalIntent(_ context.Context, id dssmodels.ID) (*scdmodels.OperationalIntent, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	op, ok := r.s.operations[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyOperationalIntent(op), nil
+}
+
+// GetFullOperationalIntentByOVN implements repos.OperationalIntent.GetFullOperationalIntentByOVN.
+func (r *repo) GetFullOperationalIntentByOVN(_ context.Context, ovn scdmodels.OVN) (*scdmodels.OperationalIntent, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	op, ok := r.s.operationVersions[ovn]
+	if !ok {
+		return nil, nil
+	}
+	return copyOperationalIntent(op), nil
+}
+
+// ListOperationalIntentVersions implements repos.OperationalIntent.ListOperationalIntentVersions.
+func (r *repo) ListOperationalIntentVersions(_ context.Context, id dssmodels.ID) ([]*scdmodels.OperationalIntent, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	versions := []*scdmodels.OperationalIntent{}
+	for _, op := range r.s.operationVersions {
+		if op.ID == id {
+			versions = append(versions, copyOperationalIntent(op))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].UpdatedAt.Before(versions[j].UpdatedAt)
+	})
+	return versions, nil
+}
+
+// DeleteOperationalIntent implements repos.OperationalIntent.DeleteOperationalIntent.
+func (r *repo) DeleteOperationalIntent(_ context.Context, id dssmodels.ID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.s.operations[id]; !ok {
+		return stacktrace.NewError("Could not delete Operation that does not exist")
+	}
+	r.removeOperationalIntent(id)
+	return nil
+}
+
+// UpsertOperationalIntent implements repos.OperationalIntent.UpsertOperationalIntent.
+func (r *repo) UpsertOperationalIntent(_ context.Context, operation *scdmodels.OperationalIntent, previous scdmodels.OVN) (*scdmodels.OperationalIntent, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var current scdmodels.OVN
+	if old, ok := r.s.operations[operation.ID]; ok {
+		current = old.OVN
+	}
+	if err := checkVersion("Operation", operation.ID, current, previous); err != nil {
+		return nil, err
+	}
+	if _, ok := r.s.subscriptions[operation.SubscriptionID]; !ok {
+		return nil, stacktrace.NewError("Subscription %s of Operation %s does not exist", operation.SubscriptionID, operation.ID)
+	}
+	stored := copyOperationalIntent(operation)
+	stored.UpdatedAt = r.now()
+	stored.OVN = newOVN(stored.ID, stored.UpdatedAt, current)
+	r.putOperationalIntent(stored)
+	return copyOperationalIntent(stored), nil
+}
+
+// TransferOperationalIntentManager implements repos.OperationalIntent.TransferOperationalIntentManager.
+func (r *repo) TransferOperationalIntentManager(_ context.Context, id dssmodels.ID, previous scdmodels.OVN, transfer scdmodels.ManagerTransfer) (*scdmodels.OperationalIntent, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	old, ok := r.s.operations[id]
+	if !ok {
+		return nil, stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s does not exist at version %s", id, previous)
+	}
+	if err := checkVersion("Operation", id, old.OVN, previous); err != nil {
+		return nil, err
+	}
+	if old.Manager != transfer.From {
+		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Operation %s is not managed by %s", id, transfer.From)
+	}
+	if sub, ok := r.s.subscriptions[transfer.SubscriptionID]; !ok || sub.Manager != transfer.To {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription %s of %s does not exist", transfer.SubscriptionID, transfer.To)
+	}
+	stored := copyOperationalIntent(old)
+	stored.Manager = transfer.To
+	stored.USSBaseURL = transfer.USSBaseURL
+	stored.SubscriptionID = transfer.SubscriptionID
+	stored.Version++
+	stored.UpdatedAt = r.now()
+	stored.OVN = newOVN(stored.ID, stored.UpdatedAt, old.OVN)
+	r.putOperationalIntent(stored)
+	return copyOperationalIntent(stored), nil
+}
+
+// SearchOperationalIntents implements repos.OperationalIntent.SearchOperationalIntents.
+func (r *repo) SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error) {
+	if v4d.SpatialVolume == nil || v4d.SpatialVolume.Footprint == nil {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing geospatial footprint for query")
+	}
+	cells, err := v4d.SpatialVolume.Footprint.CalculateCovering()
+	if err != nil {
+		return nil, stacktrace.PropagateWithCode(err, dsserr.BadRequest, "Failed to calculate footprint covering")
+	}
+	if len(cells) == 0 {
+		return nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Missing cell IDs for query")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		now    = r.s.clock.Now()
+		lo, hi = v4d.SpatialVolume.AltitudeLo, v4d.SpatialVolume.AltitudeHi
+		result []*scdmodels.OperationalIntent
+	)
+	for _, id := range r.s.operationCells.Intersecting(cells) {
+		op := r.s.operations[dssmodels.ID(id)]
+		if op.AltitudeUpper != nil && lo != nil && *op.AltitudeUpper < *lo {
+			continue
+		}
+		if op.AltitudeLower != nil && hi != nil && *op.AltitudeLower > *hi {
+			continue
+		}
+		if !overlaps(op.StartTime, op.EndTime, v4d.StartTime, v4d.EndTime) || !filter.Matches(op) {
+			continue
+		}
+		// Like the SQL comparison of the CockroachDB store, an unknown end
+		// time counts as expired.
+		if !includeExpired && (op.EndTime == nil || op.EndTime.Before(now)) {
+			continue
+		}
+		// The bounds of op span its volumes, which may not all intersect v4d.
+		intersects, err := op.VolumesIntersect(v4d)
+		if err != nil {
+			return nil, stacktrace.Propagate(err, "Error intersecting volumes of OperationalIntent %s", op.ID)
+		}
+		if !intersects {
+			continue
+		}
+		result = append(result, copyOperationalIntent(op))
+	}
+	if dssmodels.SearchOrderFromContext(ctx) == dssmodels.SearchOrderRelevance {
+		sort.SliceStable(result, func(i, j int) bool {
+			return dssmodels.TemporalDistance(now, result[i].StartTime, result[i].EndTime) <
+				dssmodels.TemporalDistance(now, result[j].StartTime, result[j].EndTime)
+		})
+	}
+	return result, nil
+}
+
+// SearchOperationalIntentReferences implements repos.OperationalIntent.SearchOperationalIntentReferences.
+func (r *repo) SearchOperationalIntentReferences(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) ([]*scdmodels.OperationalIntent, error) {
+	ops, err := r.SearchOperationalIntents(ctx, v4d, includeExpired, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		op.Cells = nil
+	}
+	return ops, nil
+}
+
+// GetOperationalIntentCells implements repos.OperationalIntent.GetOperationalIntentCells.
+func (r *repo) GetOperationalIntentCells(_ context.Context, id dssmodels.ID) (s2.CellUnion, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	op, ok := r.s.operations[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyCells(op.Cells), nil
+}
+
+// StreamOperationalIntents implements repos.OperationalIntent.StreamOperationalIntents.
+// Since the operations are in memory already, they are searched all at once.
+func (r *repo) StreamOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter, f func(*scdmodels.OperationalIntent) error) error {
+	ops, err := r.SearchOperationalIntents(ctx, v4d, includeExpired, filter)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := f(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDependentOperationalIntents implements repos.OperationalIntent.GetDependentOperationalIntents.
+func (r *repo) GetDependentOperationalIntents(_ context.Context, subscriptionID dssmodels.ID) ([]dssmodels.ID, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.dependentOperationalIntents(subscriptionID), nil
+}
+
+// GetOperationalIntentDependencies implements repos.OperationalIntent.GetOperationalIntentDependencies.
+func (r *repo) GetOperationalIntentDependencies(_ context.Context, id dssmodels.ID) (*scdmodels.OperationalIntentDependencies, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	op, ok := r.s.operations[id]
+	if !ok {
+		return nil, nil
+	}
+	deps := &scdmodels.OperationalIntentDependencies{
+		OperationalIntentID:   id,
+		Manager:               op.Manager,
+		SubscriptionID:        op.SubscriptionID,
+		NotifiedSubscriptions: []dssmodels.ID{},
+	}
+	_, deps.SubscriptionExists = r.s.subscriptions[op.SubscriptionID]
+	for _, subID := range r.s.subscriptionCells.Intersecting(op.Cells) {
+		sub := r.s.subscriptions[dssmodels.ID(subID)]
+		if sub.NotifyForOperationalIntents && overlaps(sub.StartTime, sub.EndTime, op.StartTime, op.EndTime) {
+			deps.NotifiedSubscriptions = append(deps.NotifiedSubscriptions, sub.ID)
+		}
+	}
+	sortIDs(deps.NotifiedSubscriptions)
+	return deps, nil
+}
+
+// dependentOperationalIntents returns the IDs of the OperationalIntents
+// depending on the Subscription identified by subscriptionID. r.s must be
+// locked.
+func (r *repo) dependentOperationalIntents(subscriptionID dssmodels.ID) []dssmodels.ID {
+	var result []dssmodels.ID
+	for id, op := range r.s.operations {
+		if op.SubscriptionID == subscriptionID {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,187 @@
+// Package memory implements the strategic conflict detection store in
+// process memory, so that the DSS can be run and its handlers tested without
+// a CockroachDB cluster. Nothing is persisted: the contents of a Store are
+// lost when the process exits.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/geo"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+)
+
+// Store is an implementation of store.Store keeping entities in memory and
+// indexing them by S2 cell. Transactions are serialized.
+type Store struct {
+	clock clockwork.Clock
+
+	mu                 sync.Mutex
+	operations         map[dssmodels.ID]*scdmodels.OperationalIntent
+	operationCells     *geo.CellIndex
+	operationVersions  map[scdmodels.OVN]*scdmodels.OperationalIntent
+	subscriptions      map[dssmodels.ID]*scdmodels.Subscription
+	subscriptionCells  *geo.CellIndex
+	constraints        map[dssmodels.ID]*scdmodels.Constraint
+	constraintCells    *geo.CellIndex
+	constraintVersions map[scdmodels.OVN]*scdmodels.Constraint
+	lastUpdate         time.Time
+	scannedUntil       time.Time
+}
+
+// NewStore returns an empty Store using clock to timestamp and expire
+// entities.
+func NewStore(clock clockwork.Clock) *Store {
+	return &Store{
+		clock:              clock,
+		operations:         map[dssmodels.ID]*scdmodels.OperationalIntent{},
+		operationCells:     geo.NewCellIndex(),
+		operationVersions:  map[scdmodels.OVN]*scdmodels.OperationalIntent{},
+		subscriptions:      map[dssmodels.ID]*scdmodels.Subscription{},
+		subscriptionCells:  geo.NewCellIndex(),
+		constraints:        map[dssmodels.ID]*scdmodels.Constraint{},
+		constraintCells:    geo.NewCellIndex(),
+		constraintVersions: map[scdmodels.OVN]*scdmodels.Constraint{},
+	}
+}
+
+// repo is an implementation of repos.Repository operating on the entities of
+// s. Outside of transactions, every call locks s; within a transaction, s is
+// locked for the duration of the transaction and every change registers its
+// inverse in undo.
+type repo struct {
+	s    *Store
+	lock sync.Locker
+	undo *[]func()
+}
+
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// Interact implements store.Interactor interface.
+func (s *Store) Interact(_ context.Context) (repos.Repository, error) {
+	return &repo{s: s, lock: &s.mu}, nil
+}
+
+// Transact implements store.Transactor interface. It runs f with s locked,
+// reverting the changes f made if it fails.
+func (s *Store) Transact(ctx context.Context, f func(context.Context, repos.Repository) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var undo []func()
+	defer func() {
+		if err != nil {
+			rollback(undo)
+		}
+	}()
+	defer dsserr.RecoverPanic(&err)
+	return f(ctx, &repo{s: s, lock: noLock{}, undo: &undo})
+}
+
+func rollback(undo []func()) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		undo[i]()
+	}
+}
+
+// Capabilities implements store.Store interface. Searches are served from
+// memory all at once, every version of the entities is kept, and OVNs are
+// sequenced by newOVN.
+func (s *Store) Capabilities() scdstore.Capabilities {
+	return scdstore.Capabilities{History: true, SequencedOVNs: true, ExpiryScans: true}
+}
+
+// ClaimExpiryScan implements store.ExpiryScanLedger interface. The only
+// instance using s always holds the lease.
+func (s *Store) ClaimExpiryScan(_ context.Context, _ string, _, until, _ time.Time) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	after := s.scannedUntil
+	if until.After(s.scannedUntil) {
+		s.scannedUntil = until
+	}
+	return after, true, nil
+}
+
+// Close implements store.Store interface.
+func (s *Store) Close() error {
+	return nil
+}
+
+// onRollback registers f to be called if the transaction of r fails.
+func (r *repo) onRollback(f func()) {
+	if r.undo != nil {
+		*r.undo = append(*r.undo, f)
+	}
+}
+
+// now returns the current time of the clock of r.s for use as the update
+// time of an entity, ensuring successive updates get distinct times. r.s
+// must be locked.
+func (r *repo) now() time.Time {
+	now := r.s.clock.Now()
+	if !now.After(r.s.lastUpdate) {
+		now = r.s.lastUpdate.Add(time.Microsecond)
+	}
+	r.s.lastUpdate = now
+	return now
+}
+
+// newOVN returns the OVN of the version of the entity id written at
+// updatedAt following the version previous. Since no two writes to a Store
+// share their update time, it stands for the logical timestamp of the
+// cluster of the CockroachDB store.
+func newOVN(id dssmodels.ID, updatedAt time.Time, previous scdmodels.OVN) scdmodels.OVN {
+	return scdmodels.NewOVN(id.String(), updatedAt.Format(time.RFC3339Nano), previous)
+}
+
+// overlaps returns true if the time range [start, end] of an entity overlaps
+// [earliest, latest], any of which may be unbounded.
+func overlaps(start, end, earliest, latest *time.Time) bool {
+	if end != nil && earliest != nil && end.Before(*earliest) {
+		return false
+	}
+	if start != nil && latest != nil && start.After(*latest) {
+		return false
+	}
+	return true
+}
+
+// checkVersion returns an error with the VersionMismatch code unless the
+// entity id of kind, whose current version is current or empty if it does
+// not exist, is at the version previous.
+func checkVersion(kind string, id dssmodels.ID, current scdmodels.OVN, previous scdmodels.OVN) error {
+	switch {
+	case previous.Empty() && !current.Empty():
+		return stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s %s already exists", kind, id)
+	case current.Empty() && !previous.Empty():
+		return stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "%s %s does not exist at version %s", kind, id, previous)
+	case current != previous:
+		return stacktrace.Propagate(
+			stacktrace.NewErrorWithCode(dsserr.VersionMismatch, "Version %s of %s is not current", previous, id),
+			"Current version is %s", current)
+	}
+	return nil
+}
+
+func copyCells(cells s2.CellUnion) s2.CellUnion {
+	return append(s2.CellUnion{}, cells...)
+}
+
+// sortIDs sorts ids, in the order the CockroachDB store returns them.
+func sortIDs(ids []dssmodels.ID) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
@@ -0,0 +1,627 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// Ensure the structs conform to the interfaces
+	_ scdstore.Store   = &Store{}
+	_ repos.Repository = &repo{}
+
+	footprint = &dssmodels.GeoCircle{
+		Center:      dssmodels.LatLngPoint{Lat: 37.4, Lng: -122.1},
+		RadiusMeter: 100,
+	}
+)
+
+func volume(start, end time.Time) *dssmodels.Volume4D {
+	return &dssmodels.Volume4D{
+		StartTime:     &start,
+		EndTime:       &end,
+		SpatialVolume: &dssmodels.Volume3D{Footprint: footprint},
+	}
+}
+
+func insertOperationalIntent(ctx context.Context, t *testing.T, r repos.Repository, start, end time.Time) *scdmodels.OperationalIntent {
+	cells, err := footprint.CalculateCovering()
+	require.NoError(t, err)
+
+	sub, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:                          dssmodels.ID(uuid.New().String()),
+		Manager:                     "uss1",
+		StartTime:                   &start,
+		EndTime:                     &end,
+		USSBaseURL:                  "https://uss1.example.com",
+		NotifyForOperationalIntents: true,
+		ImplicitSubscription:        true,
+		Cells:                       cells,
+	}, "")
+	require.NoError(t, err)
+
+	op, err := r.UpsertOperationalIntent(ctx, &scdmodels.OperationalIntent{
+		ID:             dssmodels.ID(uuid.New().String()),
+		Manager:        "uss1",
+		Version:        1,
+		State:          scdmodels.OperationalIntentStateAccepted,
+		StartTime:      &start,
+		EndTime:        &end,
+		USSBaseURL:     "https://uss1.example.com",
+		SubscriptionID: sub.ID,
+		Cells:          cells,
+	}, "")
+	require.NoError(t, err)
+	return op
+}
+
+func TestSearchOperationalIntents(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	require.Equal(t, scdmodels.NewOVN(op.ID.String(), op.UpdatedAt.Format(time.RFC3339Nano), ""), op.OVN)
+
+	ops, err := repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start.Add(2*time.Hour), start.Add(3*time.Hour)), true, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{
+		States: []scdmodels.OperationalIntentState{scdmodels.OperationalIntentStateAccepted},
+	})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{
+		Managers: []dssmodels.Manager{"uss2"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+
+	var streamed []*scdmodels.OperationalIntent
+	require.NoError(t, repo.StreamOperationalIntents(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{}, func(op *scdmodels.OperationalIntent) error {
+		streamed = append(streamed, op)
+		return nil
+	}))
+	require.Len(t, streamed, 1)
+
+	// Expired operational intents are only found on request.
+	clock.Advance(2 * time.Hour)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), true, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+}
+
+func TestSearchOperationalIntentsByVolume(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	// The operational intent flies over the footprint twice, spanning the
+	// hour in between without occupying it.
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(3*time.Hour))
+	op.SetExtents([]*dssmodels.Volume4D{
+		volume(start, start.Add(time.Hour)),
+		volume(start.Add(2*time.Hour), start.Add(3*time.Hour)),
+	})
+	op, err = repo.UpsertOperationalIntent(ctx, op, op.OVN)
+	require.NoError(t, err)
+	require.Len(t, op.Volumes, 2)
+
+	ops, err := repo.SearchOperationalIntents(ctx, volume(start.Add(2*time.Hour), start.Add(3*time.Hour)), false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	require.Len(t, ops[0].Volumes, 2)
+	ops, err = repo.SearchOperationalIntents(ctx, volume(start.Add(75*time.Minute), start.Add(105*time.Minute)), false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+}
+
+func TestSearchOperationalIntentReferences(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+
+	refs, err := repo.SearchOperationalIntentReferences(ctx, volume(start, start.Add(time.Hour)), false, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	require.Equal(t, op.ID, refs[0].ID)
+	require.Equal(t, op.OVN, refs[0].OVN)
+	require.Nil(t, refs[0].Cells)
+
+	cells, err := repo.GetOperationalIntentCells(ctx, op.ID)
+	require.NoError(t, err)
+	require.Equal(t, op.Cells, cells)
+
+	cells, err = repo.GetOperationalIntentCells(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.Nil(t, cells)
+}
+
+func TestSearchConstraintsByType(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	cells, err := footprint.CalculateCovering()
+	require.NoError(t, err)
+
+	for _, ct := range []scdmodels.ConstraintType{scdmodels.ConstraintTypeRestriction, scdmodels.ConstraintTypeAdvisory} {
+		_, err := repo.UpsertConstraint(ctx, &scdmodels.Constraint{
+			ID:         dssmodels.ID(uuid.New().String()),
+			Manager:    "uss1",
+			Type:       ct,
+			Version:    1,
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss1.example.com",
+			Cells:      cells,
+		})
+		require.NoError(t, err)
+	}
+
+	constraints, err := repo.SearchConstraints(ctx, volume(start, end), scdmodels.ConstraintFilter{})
+	require.NoError(t, err)
+	require.Len(t, constraints, 2)
+	constraints, err = repo.SearchConstraints(ctx, volume(start, end), scdmodels.ConstraintFilter{
+		Types: []scdmodels.ConstraintType{scdmodels.ConstraintTypeAdvisory},
+	})
+	require.NoError(t, err)
+	require.Len(t, constraints, 1)
+	require.Equal(t, scdmodels.ConstraintTypeAdvisory, constraints[0].Type)
+}
+
+func TestUpsertSubscriptionRequiresCurrentVersion(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+
+	_, err = repo.UpsertSubscription(ctx, sub, "")
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+	// The clock does not advance between the writes, whose OVNs differ
+	// nonetheless.
+	updated, err := repo.UpsertSubscription(ctx, sub, sub.Version)
+	require.NoError(t, err)
+	require.NotEqual(t, sub.Version, updated.Version)
+	_, err = repo.UpsertSubscription(ctx, sub, sub.Version)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+	_, err = repo.UpsertOperationalIntent(ctx, op, "stale-ovn-of-the-operation")
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+}
+
+func TestSearchSubscriptionsByNotifications(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	cells, err := footprint.CalculateCovering()
+	require.NoError(t, err)
+
+	for _, notifyForOperationalIntents := range []bool{false, true} {
+		_, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:                          dssmodels.ID(uuid.New().String()),
+			Manager:                     "uss1",
+			StartTime:                   &start,
+			EndTime:                     &end,
+			USSBaseURL:                  "https://uss1.example.com",
+			NotifyForOperationalIntents: notifyForOperationalIntents,
+			NotifyForConstraints:        true,
+			Cells:                       cells,
+		}, "")
+		require.NoError(t, err)
+	}
+
+	subs, err := repo.SearchSubscriptions(ctx, volume(start, end), scdmodels.SubscriptionFilter{})
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	subs, err = repo.SearchSubscriptions(ctx, volume(start, end), scdmodels.SubscriptionFilter{NotifyForConstraints: true})
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	subs, err = repo.SearchSubscriptions(ctx, volume(start, end), scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	require.True(t, subs[0].NotifyForOperationalIntents)
+}
+
+func TestNotifySubscriptions(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, end)
+	subs, err := repo.NotifySubscriptions(ctx, volume(start, end), scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	require.Equal(t, op.SubscriptionID, subs[0].ID)
+	require.Equal(t, 1, subs[0].NotificationIndex)
+	sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+	require.Equal(t, 1, sub.NotificationIndex)
+
+	subs, err = repo.NotifySubscriptions(ctx, volume(end.Add(time.Hour), end.Add(2*time.Hour)), scdmodels.SubscriptionFilter{})
+	require.NoError(t, err)
+	require.Empty(t, subs)
+}
+
+func TestResetNotificationIndex(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	indices, err := repo.IncrementNotificationIndices(ctx, []dssmodels.ID{op.SubscriptionID})
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, indices)
+	sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.ResetNotificationIndex(ctx, sub.ID))
+	reset, err := repo.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0, reset.NotificationIndex)
+	require.Equal(t, sub.Version, reset.Version)
+
+	require.Error(t, repo.ResetNotificationIndex(ctx, dssmodels.ID(uuid.New().String())))
+}
+
+func TestGetFullOperationalIntentByOVN(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	clock.Advance(time.Minute)
+	activated := *op
+	activated.State = scdmodels.OperationalIntentStateActivated
+	updated, err := repo.UpsertOperationalIntent(ctx, &activated, op.OVN)
+	require.NoError(t, err)
+
+	// Superseded versions are still resolved.
+	got, err := repo.GetFullOperationalIntentByOVN(ctx, op.OVN)
+	require.NoError(t, err)
+	require.Equal(t, scdmodels.OperationalIntentStateAccepted, got.State)
+	got, err = repo.GetFullOperationalIntentByOVN(ctx, updated.OVN)
+	require.NoError(t, err)
+	require.Equal(t, scdmodels.OperationalIntentStateActivated, got.State)
+
+	// Versions outlive the operation.
+	require.NoError(t, repo.DeleteOperationalIntent(ctx, op.ID))
+	got, err = repo.GetFullOperationalIntentByOVN(ctx, op.OVN)
+	require.NoError(t, err)
+	require.Equal(t, scdmodels.OperationalIntentStateAccepted, got.State)
+	got, err = repo.GetFullOperationalIntentByOVN(ctx, "unknown-ovn-of-an-operation")
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestListVersions(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	clock.Advance(time.Minute)
+	activated := *op
+	activated.State = scdmodels.OperationalIntentStateActivated
+	activated.Version++
+	updated, err := repo.UpsertOperationalIntent(ctx, &activated, op.OVN)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteOperationalIntent(ctx, op.ID))
+
+	versions, err := repo.ListOperationalIntentVersions(ctx, op.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, op.OVN, versions[0].OVN)
+	require.True(t, versions[0].UpdatedAt.Before(versions[1].UpdatedAt))
+	require.Equal(t, updated.OVN, versions[1].OVN)
+	require.Equal(t, scdmodels.OperationalIntentStateActivated, versions[1].State)
+	versions, err = repo.ListOperationalIntentVersions(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	cells, err := footprint.CalculateCovering()
+	require.NoError(t, err)
+	end := start.Add(time.Hour)
+	constraint, err := repo.UpsertConstraint(ctx, &scdmodels.Constraint{
+		ID:         dssmodels.ID(uuid.New().String()),
+		Manager:    "uss1",
+		Version:    1,
+		StartTime:  &start,
+		EndTime:    &end,
+		USSBaseURL: "https://uss1.example.com",
+		Cells:      cells,
+	})
+	require.NoError(t, err)
+	clock.Advance(time.Minute)
+	constraint.Version++
+	updatedConstraint, err := repo.UpsertConstraint(ctx, constraint)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteConstraint(ctx, constraint.ID))
+
+	constraints, err := repo.ListConstraintVersions(ctx, constraint.ID)
+	require.NoError(t, err)
+	require.Len(t, constraints, 2)
+	require.Equal(t, constraint.OVN, constraints[0].OVN)
+	require.Equal(t, updatedConstraint.OVN, constraints[1].OVN)
+	require.Equal(t, updatedConstraint.Version, constraints[1].Version)
+}
+
+func TestTransferOperationalIntentManager(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	sub, err := repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:         dssmodels.ID(uuid.New().String()),
+		Manager:    "uss2",
+		StartTime:  &start,
+		EndTime:    op.EndTime,
+		USSBaseURL: "https://uss2.example.com",
+		Cells:      op.Cells,
+	}, "")
+	require.NoError(t, err)
+	transfer := scdmodels.ManagerTransfer{
+		From:           "uss1",
+		To:             "uss2",
+		USSBaseURL:     "https://uss2.example.com",
+		SubscriptionID: sub.ID,
+	}
+
+	_, err = repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, scdmodels.ManagerTransfer{
+		From:           "uss3",
+		To:             "uss2",
+		USSBaseURL:     "https://uss2.example.com",
+		SubscriptionID: sub.ID,
+	})
+	require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+	_, err = repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, scdmodels.ManagerTransfer{
+		From:           "uss1",
+		To:             "uss2",
+		USSBaseURL:     "https://uss2.example.com",
+		SubscriptionID: op.SubscriptionID,
+	})
+	require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+	clock.Advance(time.Minute)
+	transferred, err := repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, transfer)
+	require.NoError(t, err)
+	require.Equal(t, dssmodels.Manager("uss2"), transferred.Manager)
+	require.Equal(t, "https://uss2.example.com", transferred.USSBaseURL)
+	require.Equal(t, sub.ID, transferred.SubscriptionID)
+	require.Equal(t, op.Version+1, transferred.Version)
+	require.NotEqual(t, op.OVN, transferred.OVN)
+	require.Equal(t, op.Cells, transferred.Cells)
+
+	// The transfer consumed the OVN.
+	_, err = repo.TransferOperationalIntentManager(ctx, op.ID, op.OVN, transfer)
+	require.Equal(t, dsserr.VersionMismatch, stacktrace.GetCode(err))
+
+	// The former manager may delete its subscription without affecting the
+	// operation.
+	require.NoError(t, repo.DeleteSubscription(ctx, op.SubscriptionID))
+	got, err := repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.Equal(t, transferred.OVN, got.OVN)
+}
+
+func TestDeleteSubscriptionDeletesDependentOperationalIntents(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+	ids, err := repo.GetDependentOperationalIntents(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+	require.Equal(t, []dssmodels.ID{op.ID}, ids)
+
+	require.NoError(t, repo.DeleteSubscription(ctx, op.SubscriptionID))
+	got, err := repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.Error(t, repo.DeleteSubscription(ctx, op.SubscriptionID))
+}
+
+func TestGetDependencies(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	op := insertOperationalIntent(ctx, t, repo, start, end)
+	subDeps, err := repo.GetSubscriptionDependencies(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+	require.True(t, subDeps.Exists)
+	require.Equal(t, dssmodels.Manager("uss1"), subDeps.Manager)
+	require.Equal(t, []dssmodels.ID{op.ID}, subDeps.DependentOperationalIntents)
+
+	// A later subscription of another manager is not notified of op.
+	cells, err := footprint.CalculateCovering()
+	require.NoError(t, err)
+	later := end.Add(time.Hour)
+	_, err = repo.UpsertSubscription(ctx, &scdmodels.Subscription{
+		ID:                          dssmodels.ID(uuid.New().String()),
+		Manager:                     "uss2",
+		StartTime:                   &later,
+		EndTime:                     &later,
+		USSBaseURL:                  "https://uss2.example.com",
+		NotifyForOperationalIntents: true,
+		Cells:                       cells,
+	}, "")
+	require.NoError(t, err)
+
+	opDeps, err := repo.GetOperationalIntentDependencies(ctx, op.ID)
+	require.NoError(t, err)
+	require.Equal(t, &scdmodels.OperationalIntentDependencies{
+		OperationalIntentID:   op.ID,
+		Manager:               "uss1",
+		SubscriptionID:        op.SubscriptionID,
+		SubscriptionExists:    true,
+		NotifiedSubscriptions: []dssmodels.ID{op.SubscriptionID},
+	}, opDeps)
+
+	opDeps, err = repo.GetOperationalIntentDependencies(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.Nil(t, opDeps)
+
+	subDeps, err = repo.GetSubscriptionDependencies(ctx, dssmodels.ID(uuid.New().String()))
+	require.NoError(t, err)
+	require.False(t, subDeps.Exists)
+	require.Empty(t, subDeps.DependentOperationalIntents)
+}
+
+func TestTransactRollsBack(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+		fail  = errors.New("fail")
+		op    *scdmodels.OperationalIntent
+	)
+
+	err := store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		op = insertOperationalIntent(ctx, t, r, start, start.Add(time.Hour))
+		return fail
+	})
+	require.Equal(t, fail, err)
+
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	sub, err := repo.GetSubscription(ctx, op.SubscriptionID)
+	require.NoError(t, err)
+	require.Nil(t, sub)
+	ops, err := repo.SearchOperationalIntents(ctx, volume(start, start.Add(time.Hour)), true, scdmodels.OperationalIntentFilter{})
+	require.NoError(t, err)
+	require.Empty(t, ops)
+
+	// Panics are rolled back like errors, and returned as such.
+	err = store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		op = insertOperationalIntent(ctx, t, r, start, start.Add(time.Hour))
+		panic("bug")
+	})
+	var p *dsserr.Panic
+	require.True(t, errors.As(err, &p))
+	require.Equal(t, "bug", p.Value)
+	got, err = repo.GetOperationalIntent(ctx, op.ID)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestListSubscriptionsByManager(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = NewStore(clock)
+		start = clock.Now()
+	)
+	repo, err := store.Interact(ctx)
+	require.NoError(t, err)
+
+	later := insertOperationalIntent(ctx, t, repo, start.Add(time.Hour), start.Add(2*time.Hour))
+	// Ended by the time of the listing.
+	insertOperationalIntent(ctx, t, repo, start, start.Add(time.Minute))
+	current := insertOperationalIntent(ctx, t, repo, start, start.Add(time.Hour))
+
+	subs, err := repo.ListSubscriptionsByManager(ctx, "uss1", start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	require.Equal(t, current.SubscriptionID, subs[0].ID)
+	require.Equal(t, later.SubscriptionID, subs[1].ID)
+
+	subs, err = repo.ListSubscriptionsByManager(ctx, "uss2", start)
+	require.NoError(t, err)
+	require.Empty(t, subs)
+}
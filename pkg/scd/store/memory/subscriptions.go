@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/stacktrace"
+)
+
+func copySubscription(sub *scdmodels.Subscription) *scdmodels.Subscription {
+	result := *sub
+	result.Cells = copyCells(sub.Cells)
+	return &result
+}
+
+// putSubscription stores sub, replacing any Subscription with the same ID.
+// r.s must be locked.
+func (r *repo) putSubscription(sub *scdmodels.Subscription) {
+	old, existed := r.s.subscriptions[sub.ID]
+	if existed {
+		r.s.subscriptionCells.Remove(old.ID.String(), old.Cells)
+	}
+	r.s.subscriptions[sub.ID] = sub
+	r.s.subscriptionCells.Add(sub.ID.String(), sub.Cells)
+	r.onRollback(func() {
+		r.s.subscriptionCells.Remove(sub.ID.String(), sub.Cells)
+		delete(r.s.subscriptions, sub.ID)
+		if existed {
+			r.s.subscriptions[old.ID] = old
+			r.s.subscriptionCells.Add(old.ID.String(), old.Cells)
+		}
+	})
+}
+
+// removeSubscription deletes the Subscription identified by id along with
+// the OperationalIntents depending on it, as the foreign key of the
+// CockroachDB store does. r.s must be locked.
+func (r *repo) removeSubscription(id dssmodels.ID) {
+	old, ok := r.s.subscriptions[id]
+	if !ok {
+		return
+	}
+	for _, opID := range r.dependentOperationalIntents(id) {
+		r.removeOperationalIntent(opID)
+	}
+	r.s.subscriptionCells.Remove(id.String(), old.Cells)
+	delete(r.s.subscriptions, id)
+	r.onRollback(func() {
+		r.s.subscriptions[id] = old
+		r.s.subscriptionCells.Add(id.String(), old.Cells)
+	})
+}
+
+// GetSubscription returns the subscription identified by "id".
+func (r *repo) GetSubscription(_ context.Context, id dssmodels.ID) (*scdmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sub, ok := r.s.subscriptions[id]
+	if !ok {
+		return nil, nil
+	}
+	return copySubscription(sub), nil
+}
+
+// Implements repos.Subscription.UpsertSubscription
+func (r *repo) UpsertSubscription(_ context.Context, s *scdmodels.Subscription, previous scdmodels.OVN) (*scdmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var current scdmodels.OVN
+	if old, ok := r.s.subscriptions[s.ID]; ok {
+		current = old.Version
+	}
+	if err := checkVersion("Subscription", s.ID, current, previous); err != nil {
+		return nil, err
+	}
+	stored := copySubscription(s)
+	stored.Version = newOVN(stored.ID, r.now(), current)
+	r.putSubscription(stored)
+	return copySubscription(stored), nil
+}
+
+// DeleteSubscription deletes the subscription identified by "id".
+func (r *repo) DeleteSubscription(_ context.Context, id dssmodels.ID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.s.subscriptions[id]; !ok {
+		return stacktrace.NewError("Attempted to delete non-existent Subscription")
+	}
+	r.removeSubscription(id)
+	return nil
+}
+
+// Implements scd.repos.Subscription.GetSubscriptionDependencies
+func (r *repo) GetSubscriptionDependencies(_ context.Context, id dssmodels.ID) (*scdmodels.SubscriptionDependencies, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	deps := &scdmodels.SubscriptionDependencies{
+		SubscriptionID:              id,
+		DependentOperationalIntents: append([]dssmodels.ID{}, r.dependentOperationalIntents(id)...),
+	}
+	if sub, ok := r.s.subscriptions[id]; ok {
+		deps.Exists, deps.Manager = true, sub.Manager
+	}
+	sortIDs(deps.DependentOperationalIntents)
+	return deps, nil
+}
+
+// Implements SubscriptionStore.SearchSubscriptions
+func (r *repo) SearchSubscriptions(_ context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error) {
+	cells, err := v4d.CalculateSpatialCovering()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
+	}
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*scdmodels.Subscription
+	for _, id := range r.s.subscriptionCells.Intersecting(cells) {
+		sub := r.s.subscriptions[dssmodels.ID(id)]
+		if filter.Matches(sub) && overlaps(sub.StartTime, sub.EndTime, v4d.StartTime, v4d.EndTime) {
+			result = append(result, copySubscription(sub))
+		}
+	}
+	return result, nil
+}
+
+// Implements scd.repos.Subscription.ListExpiringSubscriptions
+func (r *repo) ListExpiringSubscriptions(_ context.Context, after, until time.Time) ([]*scdmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*scdmodels.Subscription
+	for _, sub := range r.s.subscriptions {
+		if sub.EndTime != nil && sub.EndTime.After(after) && !sub.EndTime.After(until) {
+			result = append(result, copySubscription(sub))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EndTime.Before(*result[j].EndTime) })
+	return result, nil
+}
+
+// Implements scd.repos.Subscription.ListSubscriptionsByManager
+func (r *repo) ListSubscriptionsByManager(_ context.Context, manager dssmodels.Manager, after time.Time) ([]*scdmodels.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*scdmodels.Subscription
+	for _, sub := range r.s.subscriptions {
+		if sub.Manager == manager && (sub.EndTime == nil || sub.EndTime.After(after)) {
+			result = append(result, copySubscription(sub))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartTime == nil || result[j].StartTime == nil {
+			return result[i].StartTime == nil && result[j].StartTime != nil
+		}
+		return result[i].StartTime.Before(*result[j].StartTime)
+	})
+	return result, nil
+}
+
+// Implements scd.repos.Subscription.IncrementNotificationIndices
+func (r *repo) IncrementNotificationIndices(_ context.Context, subscriptionIds []dssmodels.ID) ([]int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, id := range subscriptionIds {
+		if _, ok := r.s.subscriptions[id]; !ok {
+			return nil, stacktrace.NewError("Subscription %s does not exist", id)
+		}
+	}
+	indices := make([]int, len(subscriptionIds))
+	for i, id := range subscriptionIds {
+		updated := copySubscription(r.s.subscriptions[id])
+		updated.NotificationIndex++
+		r.putSubscription(updated)
+		indices[i] = updated.NotificationIndex
+	}
+	return indices, nil
+}
+
+// Implements scd.repos.Subscription.NotifySubscriptions
+func (r *repo) NotifySubscriptions(_ context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) ([]*scdmodels.Subscription, error) {
+	cells, err := v4d.CalculateSpatialCovering()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Could not calculate spatial covering")
+	}
+	if len(cells) == 0 {
+		return nil, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var result []*scdmodels.Subscription
+	for _, id := range r.s.subscriptionCells.Intersecting(cells) {
+		sub := r.s.subscriptions[dssmodels.ID(id)]
+		if filter.Matches(sub) && overlaps(sub.StartTime, sub.EndTime, v4d.StartTime, v4d.EndTime) {
+			updated := copySubscription(sub)
+			updated.NotificationIndex++
+			r.putSubscription(updated)
+			result = append(result, copySubscription(updated))
+		}
+	}
+	return result, nil
+}
+
+// Implements scd.repos.Subscription.ResetNotificationIndex
+func (r *repo) ResetNotificationIndex(_ context.Context, id dssmodels.ID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sub, ok := r.s.subscriptions[id]
+	if !ok {
+		return stacktrace.NewError("Attempted to reset the notification index of non-existent Subscription")
+	}
+	updated := copySubscription(sub)
+	updated.NotificationIndex = 0
+	r.putSubscription(updated)
+	return nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/interuss/dss/pkg/scd/repos"
 )
@@ -12,10 +13,35 @@ type Store interface {
 	Interactor
 	Transactor
 
+	// Capabilities reports the optional features the store supports.
+	Capabilities() Capabilities
+
 	// Close closes the store and releases all of its resources.
 	Close() error
 }
 
+// Capabilities are the optional features of a Store, which vary between
+// backends and, for a given backend, between schema versions. Callers check
+// them to degrade gracefully rather than fail on a Store lacking a feature.
+type Capabilities struct {
+	// Pagination is true if the results of the Stream methods of the
+	// repositories are read from the store as they are consumed, rather than
+	// all at once.
+	Pagination bool `json:"pagination"`
+	// History is true if the superseded and deleted versions of operational
+	// intents and constraints are kept, to be listed by ID.
+	History bool `json:"history"`
+	// FollowerReads is true if the background scans of the store are served
+	// by follower reads rather than by the leaseholders of the data.
+	FollowerReads bool `json:"follower_reads"`
+	// SequencedOVNs is true if the OVNs of entities are generated by the
+	// transactions writing them, so that no two versions of an entity share
+	// an OVN, rather than derived from the second of their update time.
+	SequencedOVNs bool `json:"sequenced_ovns"`
+	// ExpiryScans is true if the Store is an ExpiryScanLedger.
+	ExpiryScans bool `json:"expiry_scans"`
+}
+
 // Interactor provides means to get hold of a repos.Repository instance *without* any
 // isolation/atomicity guarantees.
 type Interactor interface {
@@ -30,3 +56,25 @@ type Transactor interface {
 	// isolation/atomicity.
 	Transact(ctx context.Context, f func(context.Context, repos.Repository) error) error
 }
+
+// HistoricalInteractor provides means to get hold of a read-only
+// repos.Repository instance reflecting the state of the store at a past
+// point in time.
+type HistoricalInteractor interface {
+	// InteractAsOf executes f and provides a repos.Repository instance
+	// reading the state of the store as of t.
+	InteractAsOf(ctx context.Context, t time.Time, f func(context.Context, repos.Repository) error) error
+}
+
+// ExpiryScanLedger persists the progress of the scans for Subscriptions
+// about to expire, and elects the one instance of the pool scanning at a
+// time, so that every Subscription is notified once however many instances
+// run and restart.
+type ExpiryScanLedger interface {
+	// ClaimExpiryScan makes holder the instance scanning until leaseEnd,
+	// unless another instance holds a lease past now, and records that the
+	// Subscriptions expiring until "until" are being notified. It returns
+	// the end of the window previously notified, and false if another
+	// instance holds the lease.
+	ClaimExpiryScan(ctx context.Context, holder string, now, until, leaseEnd time.Time) (time.Time, bool, error)
+}
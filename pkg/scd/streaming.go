@@ -0,0 +1,74 @@
+package scd
+
+import (
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/tracing"
+	"github.com/interuss/stacktrace"
+	"google.golang.org/grpc"
+)
+
+// StreamingServiceDesc describes the server-streaming variants of the
+// searches of Server, served over gRPC only since they are not part of the
+// ASTM API. Each response message is a single entity, sent as it is read
+// from the store, so that large results are never held in memory at once.
+// Register Server with it through grpc.Server.RegisterService.
+var StreamingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scdpb.UTMAPIUSSDSSAndUSSUSSStreamingService",
+	HandlerType: (*StreamingServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamOperationalIntentReferences",
+			Handler:       streamOperationalIntentReferencesHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/scd/streaming.go",
+}
+
+// StreamingServer is the server of StreamingServiceDesc.
+type StreamingServer interface {
+	// StreamOperationalIntentReferences sends the results of the query req
+	// on stream, one scdpb.OperationalIntentReference per message.
+	StreamOperationalIntentReferences(req *scdpb.QueryOperationalIntentReferencesRequest, stream grpc.ServerStream) error
+}
+
+func streamOperationalIntentReferencesHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &scdpb.QueryOperationalIntentReferencesRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(StreamingServer).StreamOperationalIntentReferences(req, stream)
+}
+
+// StreamOperationalIntentReferences implements StreamingServer. Unlike
+// QueryOperationalIntentReferences, the search is not run in a transaction,
+// which could not be retried once results have been sent.
+func (a *Server) StreamOperationalIntentReferences(req *scdpb.QueryOperationalIntentReferencesRequest, stream grpc.ServerStream) error {
+	ctx, span := tracing.StartSpan(stream.Context(), "scd.StreamOperationalIntentReferences")
+	defer span.End()
+
+	vol4, manager, filter, err := parseOperationalIntentQuery(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	r, err := a.Store.Interact(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to interact with store")
+	}
+	return r.StreamOperationalIntents(ctx, vol4, dssmodels.IncludeExpiredFromContext(ctx), filter, func(op *scdmodels.OperationalIntent) error {
+		p, err := op.ToProto()
+		if err != nil {
+			return stacktrace.Propagate(err, "Could not convert OperationalIntent model to proto")
+		}
+		if op.Manager != manager {
+			p.Ovn = scdmodels.NoOvnPhrase
+		}
+		if err := stream.SendMsg(p); err != nil {
+			return stacktrace.Propagate(err, "Error sending OperationalIntent")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,241 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/interuss/dss/pkg/events"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"go.uber.org/zap"
+)
+
+const (
+	// ExpiryNoticeScope is the scope granted by the access tokens of the
+	// expiry notices POSTed by CallbackExpiryNotifier.
+	ExpiryNoticeScope = "dss.notify_subscription_expiry"
+	// expiryTokenDuration is how long the access tokens of expiry notices
+	// are valid.
+	expiryTokenDuration = 5 * time.Minute
+	// ExpiryScanLease is how long the instance scanning for expiring
+	// Subscriptions remains the only one to, unless it scans again.
+	ExpiryScanLease = 3 * time.Minute
+)
+
+// ExpiryNotice is the body of the expiry notices POSTed by
+// CallbackExpiryNotifier.
+type ExpiryNotice struct {
+	SubscriptionID string    `json:"subscription_id"`
+	Version        string    `json:"version"`
+	EndTime        time.Time `json:"time_end"`
+}
+
+// ExpiryNotifier notifies the USS managing a Subscription that it is about to
+// expire.
+type ExpiryNotifier interface {
+	NotifyExpiry(ctx context.Context, sub *scdmodels.Subscription) error
+}
+
+// ExpiryCallbacks configures the delivery of expiry notices to the USSs
+// having opted into them, read from a JSON file by LoadExpiryCallbacks.
+type ExpiryCallbacks struct {
+	// Issuer identifies the DSS pool in the access tokens of the notices.
+	Issuer string `json:"issuer"`
+	// KeyFile is the path of the PEM-encoded RSA private key signing the
+	// access tokens of the notices, whose public key the pool operator
+	// distributes to the USSs.
+	KeyFile string `json:"key_file"`
+	// URLs are the URLs to which the notices of the Subscriptions of each
+	// manager are POSTed, by manager. The Subscriptions of other managers
+	// are not notified.
+	URLs map[string]string `json:"urls"`
+}
+
+// LoadExpiryCallbacks returns the CallbackExpiryNotifier configured by the
+// ExpiryCallbacks in the JSON file at path.
+func LoadExpiryCallbacks(path string, client *http.Client, clock clockwork.Clock) (*CallbackExpiryNotifier, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading expiry callbacks file %s", path)
+	}
+	var callbacks ExpiryCallbacks
+	if err := json.Unmarshal(b, &callbacks); err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing expiry callbacks file %s", path)
+	}
+	if callbacks.Issuer == "" {
+		return nil, stacktrace.NewError("Missing issuer in expiry callbacks file %s", path)
+	}
+	for manager, u := range callbacks.URLs {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return nil, stacktrace.NewError("Invalid expiry callback URL of %s: expected an https URL, got %q", manager, u)
+		}
+	}
+	b, err = ioutil.ReadFile(callbacks.KeyFile)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error reading private key file %s", callbacks.KeyFile)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error parsing private key %s", callbacks.KeyFile)
+	}
+	return &CallbackExpiryNotifier{
+		Client: client,
+		URLs:   callbacks.URLs,
+		Issuer: callbacks.Issuer,
+		Key:    key,
+		Clock:  clock,
+	}, nil
+}
+
+// CallbackExpiryNotifier POSTs an ExpiryNotice to the URL at which the
+// managing USS opted into them, authorized by an access token signed by Key
+// granting ExpiryNoticeScope. Notices answered with a non-2xx status fail.
+type CallbackExpiryNotifier struct {
+	Client *http.Client
+	// URLs are the URLs receiving the notices, by manager.
+	URLs   map[string]string
+	Issuer string
+	Key    *rsa.PrivateKey
+	Clock  clockwork.Clock
+}
+
+// NotifyExpiry implements ExpiryNotifier.
+func (n *CallbackExpiryNotifier) NotifyExpiry(ctx context.Context, sub *scdmodels.Subscription) error {
+	callback, ok := n.URLs[sub.Manager.String()]
+	if !ok {
+		return nil
+	}
+	body, err := json.Marshal(&ExpiryNotice{
+		SubscriptionID: sub.ID.String(),
+		Version:        sub.Version.String(),
+		EndTime:        *sub.EndTime,
+	})
+	if err != nil {
+		return stacktrace.Propagate(err, "Error encoding expiry notice")
+	}
+	token, err := n.token(callback)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return stacktrace.Propagate(err, "Error creating expiry notice request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return stacktrace.Propagate(err, "Error delivering expiry notice to %s", callback)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return stacktrace.NewError("Expiry notice rejected by %s with status %d", callback, resp.StatusCode)
+	}
+	return nil
+}
+
+// token returns an access token for the expiry notices POSTed to callback,
+// whose audience is its host.
+func (n *CallbackExpiryNotifier) token(callback string) (string, error) {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error parsing expiry callback URL %s", callback)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"aud":   u.Hostname(),
+		"scope": ExpiryNoticeScope,
+		"iss":   n.Issuer,
+		"sub":   n.Issuer,
+		"exp":   n.Clock.Now().Add(expiryTokenDuration).Unix(),
+	}).SignedString(n.Key)
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Error signing expiry notice access token")
+	}
+	return token, nil
+}
+
+// EventExpiryNotifier publishes an events.OperationExpiring Event to Sink.
+type EventExpiryNotifier struct {
+	Sink events.Sink
+}
+
+// NotifyExpiry implements ExpiryNotifier.
+func (n *EventExpiryNotifier) NotifyExpiry(ctx context.Context, sub *scdmodels.Subscription) error {
+	return n.Sink.Publish(ctx, &events.Event{
+		Kind:      "scd.subscription",
+		Op:        events.OperationExpiring,
+		ID:        sub.ID.String(),
+		Time:      time.Now().UTC(),
+		Manager:   sub.Manager.String(),
+		Version:   sub.Version.String(),
+		StartTime: sub.StartTime,
+		EndTime:   sub.EndTime,
+	})
+}
+
+// ExpiryScanner notifies, through Notifier, the USSs managing the explicit
+// Subscriptions of Store about to expire within Notice.  Implicit
+// Subscriptions follow the operational intents depending on them and are
+// not notified.  The instances of a pool share Ledger, which elects the one
+// of them scanning at a time and persists the progress of the scans.
+type ExpiryScanner struct {
+	Store    scdstore.Store
+	Ledger   scdstore.ExpiryScanLedger
+	Notifier ExpiryNotifier
+	Notice   time.Duration
+	// Holder identifies the instance of the pool running the scanner.
+	Holder string
+	Clock  clockwork.Clock
+	Logger *zap.Logger
+}
+
+// Scan notifies the Subscriptions expiring between the end of the last scan
+// of the pool and Notice from now, unless another instance holds the lease
+// of Ledger.  Scans must be repeated within ExpiryScanLease to keep it; a
+// Subscription whose notice fails is not notified again.
+func (s *ExpiryScanner) Scan(ctx context.Context) error {
+	now := s.Clock.Now()
+	until := now.Add(s.Notice)
+	after, ok, err := s.Ledger.ClaimExpiryScan(ctx, s.Holder, now, until, now.Add(ExpiryScanLease))
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to claim expiry scan")
+	}
+	if !ok {
+		return nil
+	}
+	if after.Before(now) {
+		after = now
+	}
+	if !until.After(after) {
+		return nil
+	}
+
+	r, err := s.Store.Interact(ctx)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to interact with store")
+	}
+	subs, err := r.ListExpiringSubscriptions(ctx, after, until)
+	if err != nil {
+		return stacktrace.Propagate(err, "Unable to list expiring Subscriptions")
+	}
+
+	for _, sub := range subs {
+		if sub.ImplicitSubscription {
+			continue
+		}
+		if err := s.Notifier.NotifyExpiry(ctx, sub); err != nil {
+			s.Logger.Warn("Failed to notify Subscription expiry",
+				zap.String("id", sub.ID.String()), zap.String("manager", sub.Manager.String()), zap.Error(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package scd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recordingExpiryNotifier struct {
+	notified []dssmodels.ID
+}
+
+func (n *recordingExpiryNotifier) NotifyExpiry(_ context.Context, sub *scdmodels.Subscription) error {
+	n.notified = append(n.notified, sub.ID)
+	return nil
+}
+
+func TestExpiryScanner(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		clock    = clockwork.NewFakeClock()
+		store    = scdmemory.NewStore(clock)
+		notifier = &recordingExpiryNotifier{}
+		scanner  = &ExpiryScanner{
+			Store:    store,
+			Ledger:   store,
+			Notifier: notifier,
+			Notice:   10 * time.Minute,
+			Clock:    clock,
+			Logger:   zap.NewNop(),
+		}
+		start = clock.Now()
+		ids   []dssmodels.ID
+	)
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		for _, sub := range []struct {
+			duration time.Duration
+			implicit bool
+		}{
+			{5 * time.Minute, false},
+			{15 * time.Minute, false},
+			{5 * time.Minute, true},
+			{time.Hour, false},
+		} {
+			end := start.Add(sub.duration)
+			created, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+				ID:                   dssmodels.ID(uuid.New().String()),
+				Manager:              "uss1",
+				StartTime:            &start,
+				EndTime:              &end,
+				USSBaseURL:           "https://uss1.example.com",
+				ImplicitSubscription: sub.implicit,
+			}, "")
+			require.NoError(t, err)
+			ids = append(ids, created.ID)
+		}
+		return nil
+	}))
+
+	require.NoError(t, scanner.Scan(ctx))
+	require.Equal(t, []dssmodels.ID{ids[0]}, notifier.notified)
+
+	// Subscriptions are notified once, however often they are scanned.
+	clock.Advance(time.Minute)
+	require.NoError(t, scanner.Scan(ctx))
+	require.Equal(t, []dssmodels.ID{ids[0]}, notifier.notified)
+
+	clock.Advance(5 * time.Minute)
+	require.NoError(t, scanner.Scan(ctx))
+	require.Equal(t, []dssmodels.ID{ids[0], ids[1]}, notifier.notified)
+}
+
+// leaseLedger grants the lease of expiry scans like the cockroach store.
+type leaseLedger struct {
+	scannedUntil, leaseEnd time.Time
+	holder                 string
+}
+
+func (l *leaseLedger) ClaimExpiryScan(_ context.Context, holder string, now, until, leaseEnd time.Time) (time.Time, bool, error) {
+	if l.holder != holder && now.Before(l.leaseEnd) {
+		return time.Time{}, false, nil
+	}
+	after := l.scannedUntil
+	if until.After(after) {
+		l.scannedUntil = until
+	}
+	l.holder, l.leaseEnd = holder, leaseEnd
+	return after, true, nil
+}
+
+func TestExpiryScannerLease(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		clock    = clockwork.NewFakeClock()
+		store    = scdmemory.NewStore(clock)
+		ledger   = &leaseLedger{}
+		notifier = &recordingExpiryNotifier{}
+		scanner  = func(holder string) *ExpiryScanner {
+			return &ExpiryScanner{
+				Store:    store,
+				Ledger:   ledger,
+				Notifier: notifier,
+				Notice:   10 * time.Minute,
+				Holder:   holder,
+				Clock:    clock,
+				Logger:   zap.NewNop(),
+			}
+		}
+		start = clock.Now()
+		end   = start.Add(5 * time.Minute)
+	)
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		_, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:         dssmodels.ID(uuid.New().String()),
+			Manager:    "uss1",
+			StartTime:  &start,
+			EndTime:    &end,
+			USSBaseURL: "https://uss1.example.com",
+		}, "")
+		return err
+	}))
+
+	// Only the instance holding the lease notifies.
+	require.NoError(t, scanner("dss-a").Scan(ctx))
+	require.NoError(t, scanner("dss-b").Scan(ctx))
+	require.Len(t, notifier.notified, 1)
+	require.Equal(t, "dss-a", ledger.holder)
+
+	// Another instance takes over once the lease expires, resuming from
+	// the end of the last scan.
+	clock.Advance(ExpiryScanLease)
+	require.NoError(t, scanner("dss-b").Scan(ctx))
+	require.Len(t, notifier.notified, 1)
+	require.Equal(t, "dss-b", ledger.holder)
+}
+
+func TestCallbackExpiryNotifier(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		clock    = clockwork.NewFakeClockAt(time.Now())
+		end      = clock.Now().Add(time.Minute)
+		received = make(chan *http.Request, 1)
+	)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer server.Close()
+	notifier := &CallbackExpiryNotifier{
+		Client: server.Client(),
+		URLs:   map[string]string{"uss1": server.URL + "/expiry_notices"},
+		Issuer: "dss.example.com",
+		Key:    key,
+		Clock:  clock,
+	}
+	sub := &scdmodels.Subscription{
+		ID:      dssmodels.ID(uuid.New().String()),
+		Manager: "uss1",
+		EndTime: &end,
+		Version: scdmodels.NewOVNFromTime(clock.Now(), "uss1"),
+	}
+
+	require.NoError(t, notifier.NotifyExpiry(ctx, sub))
+	r := <-received
+	require.Equal(t, "/expiry_notices", r.URL.Path)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), claims, func(*jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, ExpiryNoticeScope, claims["scope"])
+	require.Equal(t, "dss.example.com", claims["iss"])
+	require.Equal(t, "127.0.0.1", claims["aud"])
+
+	// The Subscriptions of the USSs which did not opt in are not notified.
+	sub.Manager = "uss2"
+	require.NoError(t, notifier.NotifyExpiry(ctx, sub))
+	require.Empty(t, received)
+}
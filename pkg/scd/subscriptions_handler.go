@@ -3,14 +3,15 @@ package scd
 import (
 	"context"
 
-	"github.com/golang/geo/s2"
 	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	"github.com/interuss/dss/pkg/auth"
 	dsserr "github.com/interuss/dss/pkg/errors"
 	"github.com/interuss/dss/pkg/geo"
+	"github.com/interuss/dss/pkg/idempotency"
 	dssmodels "github.com/interuss/dss/pkg/models"
 	scdmodels "github.com/interuss/dss/pkg/scd/models"
 	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/dss/pkg/tracing"
 	"github.com/interuss/stacktrace"
 	"github.com/jonboulle/clockwork"
 )
@@ -30,6 +31,9 @@ func (a *Server) UpdateSubscription(ctx context.Context, req *scdpb.UpdateSubscr
 
 // PutSubscription creates a single subscription.
 func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, version string, params *scdpb.PutSubscriptionParameters) (*scdpb.PutSubscriptionResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.PutSubscription")
+	defer span.End()
+
 	// Retrieve Subscription ID
 	id, err := dssmodels.IDFromString(subscriptionid)
 
@@ -43,6 +47,12 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 		return nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "Missing owner from context")
 	}
 
+	if version == "" {
+		if err := a.IDs.Claim(ctx, id, dssmodels.Owner(manager)); err != nil {
+			return nil, err // No need to Propagate this error as this stack layer does not add useful information
+		}
+	}
+
 	if !a.EnableHTTP {
 		err = scdmodels.ValidateUSSBaseURL(params.UssBaseUrl)
 		if err != nil {
@@ -97,7 +107,7 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 		}
 
 		// Validate and perhaps correct StartTime and EndTime.
-		if err := subreq.AdjustTimeRange(DefaultClock.Now(), old); err != nil {
+		if err := subreq.AdjustTimeRange(DefaultClock.Now(), old, a.Limits); err != nil {
 			return stacktrace.Propagate(err, "Error adjusting time range of Subscription")
 		}
 
@@ -144,8 +154,12 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 			}
 		}
 
+		if err := a.Limits.Check(subreq.Cells, subreq.StartTime, subreq.EndTime, subreq.AltitudeLo, subreq.AltitudeHi); err != nil {
+			return stacktrace.Propagate(err, "Subscription exceeds limits")
+		}
+
 		// Store Subscription model
-		sub, err := r.UpsertSubscription(ctx, subreq)
+		sub, err := r.UpsertSubscription(ctx, subreq, subreq.Version)
 		if err != nil {
 			return stacktrace.Propagate(err, "Could not upsert Subscription into repo")
 		}
@@ -156,17 +170,7 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 		// Find relevant Operations
 		var relevantOperations []*scdmodels.OperationalIntent
 		if len(sub.Cells) > 0 {
-			ops, err := r.SearchOperationalIntents(ctx, &dssmodels.Volume4D{
-				StartTime: sub.StartTime,
-				EndTime:   sub.EndTime,
-				SpatialVolume: &dssmodels.Volume3D{
-					AltitudeLo: sub.AltitudeLo,
-					AltitudeHi: sub.AltitudeHi,
-					Footprint: dssmodels.GeometryFunc(func() (s2.CellUnion, error) {
-						return sub.Cells, nil
-					}),
-				},
-			})
+			ops, err := r.SearchOperationalIntentReferences(ctx, sub.Volume4D(), dssmodels.IncludeExpiredFromContext(ctx), scdmodels.OperationalIntentFilter{})
 			if err != nil {
 				return stacktrace.Propagate(err, "Could not search Operations in repo")
 			}
@@ -195,7 +199,7 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 
 		if sub.NotifyForConstraints {
 			// Query relevant Constraints
-			constraints, err := r.SearchConstraints(ctx, extents)
+			constraints, err := r.SearchConstraints(ctx, extents, scdmodels.ConstraintFilter{})
 			if err != nil {
 				return stacktrace.Propagate(err, "Could not search Constraints in repo")
 			}
@@ -213,6 +217,7 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 			}
 		}
 
+		idempotency.Respond(ctx, result)
 		return nil
 	}
 
@@ -227,6 +232,9 @@ func (a *Server) PutSubscription(ctx context.Context, subscriptionid string, ver
 
 // GetSubscription returns a single subscription for the given ID.
 func (a *Server) GetSubscription(ctx context.Context, req *scdpb.GetSubscriptionRequest) (*scdpb.GetSubscriptionResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.GetSubscription")
+	defer span.End()
+
 	// Retrieve Subscription ID
 	id, err := dssmodels.IDFromString(req.GetSubscriptionid())
 	if err != nil {
@@ -287,6 +295,9 @@ func (a *Server) GetSubscription(ctx context.Context, req *scdpb.GetSubscription
 
 // QuerySubscriptions queries existing subscriptions in the given bounds.
 func (a *Server) QuerySubscriptions(ctx context.Context, req *scdpb.QuerySubscriptionsRequest) (*scdpb.QuerySubscriptionsResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.QuerySubscriptions")
+	defer span.End()
+
 	// Retrieve the area of interest parameter
 	aoi := req.GetParams().AreaOfInterest
 	if aoi == nil {
@@ -308,7 +319,7 @@ func (a *Server) QuerySubscriptions(ctx context.Context, req *scdpb.QuerySubscri
 	var response *scdpb.QuerySubscriptionsResponse
 	action := func(ctx context.Context, r repos.Repository) (err error) {
 		// Perform search query on Store
-		subs, err := r.SearchSubscriptions(ctx, vol4)
+		subs, err := r.SearchSubscriptions(ctx, vol4, scdmodels.SubscriptionFilter{})
 		if err != nil {
 			return stacktrace.Propagate(err, "Error searching Subscriptions in repo")
 		}
@@ -344,6 +355,9 @@ func (a *Server) QuerySubscriptions(ctx context.Context, req *scdpb.QuerySubscri
 
 // DeleteSubscription deletes a single subscription for a given ID.
 func (a *Server) DeleteSubscription(ctx context.Context, req *scdpb.DeleteSubscriptionRequest) (*scdpb.DeleteSubscriptionResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "scd.DeleteSubscription")
+	defer span.End()
+
 	// Retrieve Subscription ID
 	id, err := dssmodels.IDFromString(req.GetSubscriptionid())
 	if err != nil {
@@ -0,0 +1,250 @@
+package scd
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdstore "github.com/interuss/dss/pkg/scd/store"
+)
+
+// NewTimeoutStore returns a Store whose repositories bound each call to the
+// repositories of s with the timeout of the operation of the call.
+func NewTimeoutStore(s scdstore.Store, timeouts dssmodels.Timeouts) scdstore.Store {
+	return &timeoutStore{Store: s, timeouts: timeouts}
+}
+
+type timeoutStore struct {
+	scdstore.Store
+	timeouts dssmodels.Timeouts
+}
+
+// Interact implements scdstore.Interactor.
+func (s *timeoutStore) Interact(ctx context.Context) (repos.Repository, error) {
+	repo, err := s.Store.Interact(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutRepo{Repository: repo, timeouts: s.timeouts}, nil
+}
+
+// Transact implements scdstore.Transactor.
+func (s *timeoutStore) Transact(ctx context.Context, f func(context.Context, repos.Repository) error) error {
+	return s.Store.Transact(ctx, func(ctx context.Context, repo repos.Repository) error {
+		return f(ctx, &timeoutRepo{Repository: repo, timeouts: s.timeouts})
+	})
+}
+
+type timeoutRepo struct {
+	repos.Repository
+	timeouts dssmodels.Timeouts
+}
+
+func (r *timeoutRepo) GetOperationalIntent(ctx context.Context, id dssmodels.ID) (op *scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		op, err = r.Repository.GetOperationalIntent(ctx, id)
+		return err
+	})
+	return op, err
+}
+
+func (r *timeoutRepo) DeleteOperationalIntent(ctx context.Context, id dssmodels.ID) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationDelete, func(ctx context.Context) error {
+		return r.Repository.DeleteOperationalIntent(ctx, id)
+	})
+}
+
+func (r *timeoutRepo) UpsertOperationalIntent(ctx context.Context, operation *scdmodels.OperationalIntent, previous scdmodels.OVN) (upserted *scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		upserted, err = r.Repository.UpsertOperationalIntent(ctx, operation, previous)
+		return err
+	})
+	return upserted, err
+}
+
+func (r *timeoutRepo) TransferOperationalIntentManager(ctx context.Context, id dssmodels.ID, previous scdmodels.OVN, transfer scdmodels.ManagerTransfer) (op *scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		op, err = r.Repository.TransferOperationalIntentManager(ctx, id, previous, transfer)
+		return err
+	})
+	return op, err
+}
+
+func (r *timeoutRepo) SearchOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) (ops []*scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		ops, err = r.Repository.SearchOperationalIntents(ctx, v4d, includeExpired, filter)
+		return err
+	})
+	return ops, err
+}
+
+func (r *timeoutRepo) SearchOperationalIntentReferences(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter) (ops []*scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		ops, err = r.Repository.SearchOperationalIntentReferences(ctx, v4d, includeExpired, filter)
+		return err
+	})
+	return ops, err
+}
+
+func (r *timeoutRepo) GetOperationalIntentCells(ctx context.Context, id dssmodels.ID) (cells s2.CellUnion, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		cells, err = r.Repository.GetOperationalIntentCells(ctx, id)
+		return err
+	})
+	return cells, err
+}
+
+func (r *timeoutRepo) StreamOperationalIntents(ctx context.Context, v4d *dssmodels.Volume4D, includeExpired bool, filter scdmodels.OperationalIntentFilter, f func(*scdmodels.OperationalIntent) error) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		return r.Repository.StreamOperationalIntents(ctx, v4d, includeExpired, filter, f)
+	})
+}
+
+func (r *timeoutRepo) GetFullOperationalIntentByOVN(ctx context.Context, ovn scdmodels.OVN) (op *scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		op, err = r.Repository.GetFullOperationalIntentByOVN(ctx, ovn)
+		return err
+	})
+	return op, err
+}
+
+func (r *timeoutRepo) ListOperationalIntentVersions(ctx context.Context, id dssmodels.ID) (ops []*scdmodels.OperationalIntent, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		ops, err = r.Repository.ListOperationalIntentVersions(ctx, id)
+		return err
+	})
+	return ops, err
+}
+
+func (r *timeoutRepo) GetDependentOperationalIntents(ctx context.Context, subscriptionID dssmodels.ID) (ids []dssmodels.ID, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		ids, err = r.Repository.GetDependentOperationalIntents(ctx, subscriptionID)
+		return err
+	})
+	return ids, err
+}
+
+func (r *timeoutRepo) GetOperationalIntentDependencies(ctx context.Context, id dssmodels.ID) (deps *scdmodels.OperationalIntentDependencies, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		deps, err = r.Repository.GetOperationalIntentDependencies(ctx, id)
+		return err
+	})
+	return deps, err
+}
+
+func (r *timeoutRepo) SearchSubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) (subs []*scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.SearchSubscriptions(ctx, v4d, filter)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) GetSubscription(ctx context.Context, id dssmodels.ID) (sub *scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		sub, err = r.Repository.GetSubscription(ctx, id)
+		return err
+	})
+	return sub, err
+}
+
+func (r *timeoutRepo) UpsertSubscription(ctx context.Context, sub *scdmodels.Subscription, previous scdmodels.OVN) (upserted *scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		upserted, err = r.Repository.UpsertSubscription(ctx, sub, previous)
+		return err
+	})
+	return upserted, err
+}
+
+func (r *timeoutRepo) DeleteSubscription(ctx context.Context, id dssmodels.ID) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationDelete, func(ctx context.Context) error {
+		return r.Repository.DeleteSubscription(ctx, id)
+	})
+}
+
+func (r *timeoutRepo) IncrementNotificationIndices(ctx context.Context, subscriptionIds []dssmodels.ID) (indices []int, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		indices, err = r.Repository.IncrementNotificationIndices(ctx, subscriptionIds)
+		return err
+	})
+	return indices, err
+}
+
+func (r *timeoutRepo) NotifySubscriptions(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.SubscriptionFilter) (subs []*scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		subs, err = r.Repository.NotifySubscriptions(ctx, v4d, filter)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) ResetNotificationIndex(ctx context.Context, id dssmodels.ID) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		return r.Repository.ResetNotificationIndex(ctx, id)
+	})
+}
+
+func (r *timeoutRepo) GetSubscriptionDependencies(ctx context.Context, id dssmodels.ID) (deps *scdmodels.SubscriptionDependencies, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		deps, err = r.Repository.GetSubscriptionDependencies(ctx, id)
+		return err
+	})
+	return deps, err
+}
+
+func (r *timeoutRepo) ListExpiringSubscriptions(ctx context.Context, after, until time.Time) (subs []*scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.ListExpiringSubscriptions(ctx, after, until)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) ListSubscriptionsByManager(ctx context.Context, manager dssmodels.Manager, after time.Time) (subs []*scdmodels.Subscription, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		subs, err = r.Repository.ListSubscriptionsByManager(ctx, manager, after)
+		return err
+	})
+	return subs, err
+}
+
+func (r *timeoutRepo) SearchConstraints(ctx context.Context, v4d *dssmodels.Volume4D, filter scdmodels.ConstraintFilter) (constraints []*scdmodels.Constraint, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		constraints, err = r.Repository.SearchConstraints(ctx, v4d, filter)
+		return err
+	})
+	return constraints, err
+}
+
+func (r *timeoutRepo) GetConstraint(ctx context.Context, id dssmodels.ID) (constraint *scdmodels.Constraint, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		constraint, err = r.Repository.GetConstraint(ctx, id)
+		return err
+	})
+	return constraint, err
+}
+
+func (r *timeoutRepo) UpsertConstraint(ctx context.Context, constraint *scdmodels.Constraint) (upserted *scdmodels.Constraint, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationUpsert, func(ctx context.Context) error {
+		upserted, err = r.Repository.UpsertConstraint(ctx, constraint)
+		return err
+	})
+	return upserted, err
+}
+
+func (r *timeoutRepo) DeleteConstraint(ctx context.Context, id dssmodels.ID) error {
+	return r.timeouts.Bound(ctx, dssmodels.OperationDelete, func(ctx context.Context) error {
+		return r.Repository.DeleteConstraint(ctx, id)
+	})
+}
+
+func (r *timeoutRepo) ListConstraintVersions(ctx context.Context, id dssmodels.ID) (constraints []*scdmodels.Constraint, err error) {
+	err = r.timeouts.Bound(ctx, dssmodels.OperationSearch, func(ctx context.Context) error {
+		constraints, err = r.Repository.ListConstraintVersions(ctx, id)
+		return err
+	})
+	return constraints, err
+}
@@ -0,0 +1,90 @@
+package scd
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/geo/s2"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	"github.com/interuss/stacktrace"
+)
+
+// TransferOperationalIntent hands the OperationalIntent identified by id off
+// as described by transfer, provided that its current OVN is previous, as an
+// update of the OperationalIntent through the API would: the Subscription of
+// the new manager must cover the OperationalIntent unless it is implicit,
+// in which case it is fitted to it, the implicit Subscription of the former
+// manager is shrunk or removed, and the notification indices of the
+// Subscriptions interested in the OperationalIntent are incremented. It
+// returns the OperationalIntent with its new OVN and those Subscriptions. It
+// must be called from within a transaction of r.
+func TransferOperationalIntent(ctx context.Context, r repos.Repository, id dssmodels.ID, previous scdmodels.OVN, transfer scdmodels.ManagerTransfer) (*scdmodels.OperationalIntent, []*scdmodels.Subscription, error) {
+	old, err := r.GetOperationalIntent(ctx, id)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Unable to get OperationalIntent from repo")
+	}
+	if old == nil {
+		return nil, nil, stacktrace.NewErrorWithCode(dsserr.NotFound, "OperationalIntent %s not found", id)
+	}
+	if old.Manager != transfer.From {
+		return nil, nil, stacktrace.NewErrorWithCode(dsserr.PermissionDenied, "OperationalIntent %s is not managed by %s", id, transfer.From)
+	}
+
+	sub, err := r.GetSubscription(ctx, transfer.SubscriptionID)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Unable to get Subscription of new manager")
+	}
+	if sub == nil || sub.Manager != transfer.To {
+		return nil, nil, stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription %s of %s does not exist", transfer.SubscriptionID, transfer.To)
+	}
+	// Implicit Subscriptions are fitted to their dependent OperationalIntents
+	// once the OperationalIntent is transferred below.
+	if !sub.ImplicitSubscription {
+		if err := checkSubscriptionCovers(sub, old.StartTime, old.EndTime, old.Cells); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	op, err := r.TransferOperationalIntentManager(ctx, id, previous, transfer)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to transfer OperationalIntent in repo")
+	}
+
+	// Fit the implicit Subscriptions affected by the transfer, removing the
+	// one of the former manager if it no longer supports any OperationalIntent
+	if err := fitImplicitSubscription(ctx, r, sub.ID); err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to update implicit Subscription")
+	}
+	if old.SubscriptionID != sub.ID {
+		if err := fitImplicitSubscription(ctx, r, old.SubscriptionID); err != nil {
+			return nil, nil, stacktrace.Propagate(err, "Failed to update previous implicit Subscription")
+		}
+	}
+
+	// Increment notification indices for Subscriptions that need to be
+	// notified of the new manager and OVN
+	subs, err := r.NotifySubscriptions(ctx, op.Volume4D(), scdmodels.SubscriptionFilter{NotifyForOperationalIntents: true})
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Unable to notify Subscriptions in repo")
+	}
+	return op, subs, nil
+}
+
+// checkSubscriptionCovers returns an error with the errors.BadRequest code
+// unless the explicit Subscription sub covers an OperationalIntent from start
+// to end over cells.
+func checkSubscriptionCovers(sub *scdmodels.Subscription, start, end *time.Time, cells s2.CellUnion) error {
+	if sub.StartTime != nil && start != nil && sub.StartTime.After(*start) {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription does not begin until after the OperationalIntent starts")
+	}
+	if sub.EndTime != nil && end != nil && sub.EndTime.Before(*end) {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription ends before the OperationalIntent ends")
+	}
+	if !sub.Cells.Contains(cells) {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Subscription does not cover entire spatial area of the OperationalIntent")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package scd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/google/uuid"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	dssmodels "github.com/interuss/dss/pkg/models"
+	scdmodels "github.com/interuss/dss/pkg/scd/models"
+	"github.com/interuss/dss/pkg/scd/repos"
+	scdmemory "github.com/interuss/dss/pkg/scd/store/memory"
+	"github.com/interuss/stacktrace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferOperationalIntent(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clock = clockwork.NewFakeClock()
+		store = scdmemory.NewStore(clock)
+		start = clock.Now()
+		end   = start.Add(time.Hour)
+		cells = s2.CellUnion{s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)}
+	)
+	newSubscription := func(r repos.Repository, manager dssmodels.Manager, end time.Time, implicit bool) *scdmodels.Subscription {
+		sub, err := r.UpsertSubscription(ctx, &scdmodels.Subscription{
+			ID:                          dssmodels.ID(uuid.New().String()),
+			Manager:                     manager,
+			StartTime:                   &start,
+			EndTime:                     &end,
+			USSBaseURL:                  "https://" + manager.String() + ".example.com",
+			NotifyForOperationalIntents: true,
+			ImplicitSubscription:        implicit,
+			Cells:                       cells,
+		}, "")
+		require.NoError(t, err)
+		return sub
+	}
+
+	require.NoError(t, store.Transact(ctx, func(ctx context.Context, r repos.Repository) error {
+		implicit := newSubscription(r, "uss1", end, true)
+		op, err := r.UpsertOperationalIntent(ctx, &scdmodels.OperationalIntent{
+			ID:             dssmodels.ID(uuid.New().String()),
+			Manager:        "uss1",
+			Version:        1,
+			State:          scdmodels.OperationalIntentStateAccepted,
+			StartTime:      &start,
+			EndTime:        &end,
+			USSBaseURL:     "https://uss1.example.com",
+			SubscriptionID: implicit.ID,
+			Cells:          cells,
+		}, "")
+		require.NoError(t, err)
+		observer := newSubscription(r, "uss3", end, false)
+		short := newSubscription(r, "uss2", start.Add(time.Minute), false)
+		covering := newSubscription(r, "uss2", end, false)
+		transfer := func(from dssmodels.Manager, sub *scdmodels.Subscription) (*scdmodels.OperationalIntent, []*scdmodels.Subscription, error) {
+			return TransferOperationalIntent(ctx, r, op.ID, op.OVN, scdmodels.ManagerTransfer{
+				From:           from,
+				To:             "uss2",
+				USSBaseURL:     "https://uss2.example.com",
+				SubscriptionID: sub.ID,
+			})
+		}
+
+		_, _, err = transfer("uss3", covering)
+		require.Equal(t, dsserr.PermissionDenied, stacktrace.GetCode(err))
+		_, _, err = transfer("uss1", short)
+		require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+		_, _, err = transfer("uss1", observer)
+		require.Equal(t, dsserr.BadRequest, stacktrace.GetCode(err))
+
+		transferred, subs, err := transfer("uss1", covering)
+		require.NoError(t, err)
+		require.Equal(t, dssmodels.Manager("uss2"), transferred.Manager)
+		require.Equal(t, covering.ID, transferred.SubscriptionID)
+
+		// The subscribers are notified as of an update.
+		notified := map[dssmodels.ID]int{}
+		for _, sub := range subs {
+			notified[sub.ID] = sub.NotificationIndex
+		}
+		require.Equal(t, observer.NotificationIndex+1, notified[observer.ID])
+
+		// The implicit subscription of the former manager went away with its
+		// last operational intent.
+		got, err := r.GetSubscription(ctx, implicit.ID)
+		require.NoError(t, err)
+		require.Nil(t, got)
+		return nil
+	}))
+}
@@ -0,0 +1,57 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Column is a column of a statement along with the argument written to it or
+// the destination it is scanned into, so that the column lists of statements
+// are derived from their arguments and scan destinations instead of being
+// maintained alongside them.
+type Column struct {
+	Name string
+	// Value is the argument written to the column, or a pointer to the
+	// destination the column is scanned into.
+	Value interface{}
+}
+
+// Columns are the columns of a statement, in order.
+type Columns []Column
+
+// With returns cs followed by the column name holding value, leaving cs
+// untouched.
+func (cs Columns) With(name string, value interface{}) Columns {
+	return append(cs[:len(cs):len(cs)], Column{Name: name, Value: value})
+}
+
+// Names returns the names of cs prefixed with prefix, e.g. the name of their
+// table followed by a dot, separated by commas.
+func (cs Columns) Names(prefix string) string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = prefix + c.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Values returns the values of cs, to be passed as the arguments of a
+// statement or to Scan.
+func (cs Columns) Values() []interface{} {
+	values := make([]interface{}, len(cs))
+	for i, c := range cs {
+		values[i] = c.Value
+	}
+	return values
+}
+
+// Placeholders returns the placeholders of the values of cs passed as the
+// arguments of a statement following its first n arguments, separated by
+// commas: "$<n+1>, $<n+2>, ...".
+func (cs Columns) Placeholders(n int) string {
+	placeholders := make([]string, len(cs))
+	for i := range cs {
+		placeholders[i] = fmt.Sprintf("$%d", n+i+1)
+	}
+	return strings.Join(placeholders, ", ")
+}
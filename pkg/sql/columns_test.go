@@ -0,0 +1,26 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumns(t *testing.T) {
+	var (
+		id      string
+		version int
+		columns = Columns{{Name: "id", Value: &id}, {Name: "version", Value: &version}}
+		ovn     = columns.With("ovn", "ovn")
+	)
+
+	require.Equal(t, "id,version", columns.Names(""))
+	require.Equal(t, "t.id,t.version,t.ovn", ovn.Names("t."))
+	require.Equal(t, []interface{}{&id, &version}, columns.Values())
+	require.Equal(t, "$3, $4, $5", ovn.Placeholders(2))
+
+	// With does not share the columns it returns with other calls.
+	other := columns.With("cells", nil)
+	require.Equal(t, "ovn", ovn[2].Name)
+	require.Equal(t, "cells", other[2].Name)
+}
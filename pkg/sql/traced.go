@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/interuss/dss/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedQueryable records a span for every statement executed on q.
+type tracedQueryable struct {
+	q Queryable
+}
+
+// Traced returns a Queryable recording a span for every statement issued
+// against q, annotated with the statement and its SQL operation.
+func Traced(q Queryable) Queryable {
+	if _, ok := q.(*tracedQueryable); ok {
+		return q
+	}
+	return &tracedQueryable{q: q}
+}
+
+func (t *tracedQueryable) startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	op := operationName(query)
+	return tracing.StartSpan(ctx, "sql."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String("cockroachdb"),
+			semconv.DBOperationKey.String(op),
+			semconv.DBStatementKey.String(query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedQueryable) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.startSpan(ctx, query)
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (t *tracedQueryable) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.startSpan(ctx, query)
+	row := t.q.QueryRowContext(ctx, query, args...)
+	// Errors are only surfaced to the caller on Scan.
+	span.End()
+	return row
+}
+
+func (t *tracedQueryable) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.startSpan(ctx, query)
+	result, err := t.q.ExecContext(ctx, query, args...)
+	if err == nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+// operationName returns the SQL operation (e.g. SELECT, UPSERT) of query.
+func operationName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeQueryable answers every statement with err, and Exec with result
+// otherwise.
+type fakeQueryable struct {
+	result sql.Result
+	err    error
+}
+
+func (f *fakeQueryable) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, f.err
+}
+
+func (f *fakeQueryable) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func (f *fakeQueryable) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.result, nil
+}
+
+type rowsAffected int64
+
+func (r rowsAffected) LastInsertId() (int64, error) { return 0, errors.New("unsupported") }
+func (r rowsAffected) RowsAffected() (int64, error) { return int64(r), nil }
+
+// recordSpans makes the global tracer provider record the spans ended until
+// the test completes.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func attributes(span *sdktrace.SpanSnapshot) map[attribute.Key]attribute.Value {
+	result := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+func TestTraced(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		exporter = recordSpans(t)
+		query    = `
+			UPSERT INTO scd_operations (id) VALUES ($1)`
+	)
+
+	_, err := Traced(&fakeQueryable{result: rowsAffected(2)}).ExecContext(ctx, query, "id")
+	require.NoError(t, err)
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "sql.UPSERT", spans[0].Name)
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+	require.Equal(t, codes.Unset, spans[0].StatusCode)
+	attrs := attributes(spans[0])
+	require.Equal(t, "UPSERT", attrs["db.operation"].AsString())
+	require.Equal(t, query, attrs["db.statement"].AsString())
+	require.Equal(t, int64(2), attrs["db.rows_affected"].AsInt64())
+
+	// Failed statements mark their spans as errors, but for the absence of
+	// rows, which is an expected outcome.
+	exporter.Reset()
+	boom := errors.New("boom")
+	_, err = Traced(&fakeQueryable{err: boom}).QueryContext(ctx, "SELECT 1")
+	require.Equal(t, boom, err)
+	_, err = Traced(&fakeQueryable{err: sql.ErrNoRows}).QueryContext(ctx, "SELECT 1")
+	require.Equal(t, sql.ErrNoRows, err)
+	spans = exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "sql.SELECT", spans[0].Name)
+	require.Equal(t, codes.Error, spans[0].StatusCode)
+	require.Equal(t, "boom", spans[0].StatusMessage)
+	require.Equal(t, codes.Unset, spans[1].StatusCode)
+}
+
+func TestTracedIsIdempotent(t *testing.T) {
+	q := Traced(&fakeQueryable{})
+	require.Equal(t, q, Traced(q))
+}
+
+func TestOperationName(t *testing.T) {
+	require.Equal(t, "SELECT", operationName("\n\t\tselect * FROM t"))
+	require.Equal(t, "WITH", operationName("WITH v AS (SELECT 1) SELECT * FROM v"))
+	require.Equal(t, "UNKNOWN", operationName("  "))
+}
@@ -0,0 +1,70 @@
+package summary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/interuss/dss/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Interceptor returns a grpc.UnaryServerInterceptor that records every API
+// call to r. It must be installed outside of the error interceptor so that
+// the codes it observes are the ones returned to clients.
+func Interceptor(r *Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		record(ctx, r, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns a grpc.StreamServerInterceptor that records every
+// stream to r like Interceptor does for unary calls.
+func StreamInterceptor(r *Recorder) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		record(ss.Context(), r, info.FullMethod, err)
+		return err
+	}
+}
+
+// record records to r the call to fullMethod which returned err.
+func record(ctx context.Context, r *Recorder, fullMethod string, err error) {
+	var manager string
+	if caller, ok := grpc_ctxtags.Extract(ctx).Values()[logging.CallerTag]; ok {
+		manager = fmt.Sprint(caller)
+	}
+	var errorCode string
+	if code := status.Code(err); code != codes.OK {
+		errorCode = code.String()
+	}
+	created, ended := entityKinds(fullMethod)
+	r.RecordCall(manager, created, ended, errorCode)
+}
+
+// entityKinds derives the kinds of entities created and ended by the gRPC
+// method fullMethod, e.g. "/ridpb.Service/CreateSubscription" creates a
+// "ridpb.Subscription".
+func entityKinds(fullMethod string) (created string, ended string) {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	pkg := parts[0]
+	if i := strings.Index(pkg, "."); i >= 0 {
+		pkg = pkg[:i]
+	}
+	method := parts[1]
+	switch {
+	case strings.HasPrefix(method, "Create"):
+		return pkg + "." + strings.TrimPrefix(method, "Create"), ""
+	case strings.HasPrefix(method, "Delete"):
+		return "", pkg + "." + strings.TrimPrefix(method, "Delete")
+	}
+	return "", ""
+}
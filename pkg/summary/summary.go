@@ -0,0 +1,330 @@
+// Package summary accumulates operational statistics of a DSS instance and
+// periodically condenses them into a Summary for pool operators.
+package summary
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/interuss/dss/pkg/hotspot"
+	"github.com/jonboulle/clockwork"
+)
+
+const (
+	// topErrorCodesCount is the number of error codes reported in a Summary.
+	topErrorCodesCount = 5
+	// topHotspotsCount is the number of write hotspots reported in a
+	// Summary.
+	topHotspotsCount = 5
+)
+
+// Default is the Recorder used by the DSS components that do not have a
+// Recorder injected.
+var Default = NewRecorder(clockwork.NewRealClock())
+
+// ErrorCodeCount is the number of calls that failed with Code.
+type ErrorCodeCount struct {
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+// CompressionCount is the number of responses compressed with an encoding,
+// and their total size before and after compression.
+type CompressionCount struct {
+	Responses       int64 `json:"responses"`
+	RawBytes        int64 `json:"raw_bytes"`
+	CompressedBytes int64 `json:"compressed_bytes"`
+}
+
+// Summary condenses the activity of a DSS instance over [Start, End).
+type Summary struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Region is the region of the database of the DSS instance, if any.
+	Region string `json:"region,omitempty"`
+
+	// Calls is the total number of API calls handled.
+	Calls int64 `json:"calls"`
+	// Created, Ended and GarbageCollected count entities by kind.
+	Created          map[string]int64 `json:"created"`
+	Ended            map[string]int64 `json:"ended"`
+	GarbageCollected map[string]int64 `json:"garbage_collected"`
+	// CallsPerManager counts API calls by the manager issuing them.
+	CallsPerManager map[string]int64 `json:"calls_per_manager"`
+	// DeprecatedCalls counts the calls to deprecated API methods by method,
+	// then by the manager issuing them.
+	DeprecatedCalls map[string]map[string]int64 `json:"deprecated_calls"`
+	// IntegrityViolations counts the stored entities found failing an
+	// integrity check, by violation.
+	IntegrityViolations map[string]int64 `json:"integrity_violations"`
+	// TelemetryRejections counts the calls rejected for carrying fields
+	// resembling telemetry, by API method.
+	TelemetryRejections map[string]int64 `json:"telemetry_rejections"`
+	// Timeouts counts the repository calls which exceeded their deadline, by
+	// operation.
+	Timeouts map[string]int64 `json:"timeouts"`
+	// PoolDivergences counts the canary entities of the pool checker not read
+	// back as written, by the base URL of the DSS instance reading them.
+	PoolDivergences map[string]int64 `json:"pool_divergences"`
+	// Compression counts the compressed responses, by encoding.
+	Compression map[string]CompressionCount `json:"compression"`
+	// ShedCalls counts the calls rejected while the database connection
+	// pools were saturated, by API method.
+	ShedCalls map[string]int64 `json:"shed_calls"`
+
+	// Transactions is the number of database transactions executed, and
+	// Retries the number of additional attempts required to commit them.
+	Transactions int64   `json:"transactions"`
+	Retries      int64   `json:"retries"`
+	RetryRate    float64 `json:"retry_rate"`
+
+	// TopErrorCodes lists the most frequent error codes, most frequent first.
+	TopErrorCodes []ErrorCodeCount `json:"top_error_codes"`
+	// WriteHotspots lists the cells most written to over the window of the
+	// hotspot tracker ending at End, if any, most writes first.
+	WriteHotspots []hotspot.Hotspot `json:"write_hotspots,omitempty"`
+}
+
+type counters struct {
+	start            time.Time
+	calls            int64
+	created          map[string]int64
+	ended            map[string]int64
+	garbageCollected map[string]int64
+	callsPerManager  map[string]int64
+	deprecatedCalls  map[string]map[string]int64
+	violations       map[string]int64
+	telemetry        map[string]int64
+	timeouts         map[string]int64
+	divergences      map[string]int64
+	compression      map[string]CompressionCount
+	shed             map[string]int64
+	errorCodes       map[string]int64
+	transactions     int64
+	retries          int64
+}
+
+func newCounters(start time.Time) *counters {
+	return &counters{
+		start:            start,
+		created:          map[string]int64{},
+		ended:            map[string]int64{},
+		garbageCollected: map[string]int64{},
+		callsPerManager:  map[string]int64{},
+		deprecatedCalls:  map[string]map[string]int64{},
+		violations:       map[string]int64{},
+		telemetry:        map[string]int64{},
+		timeouts:         map[string]int64{},
+		divergences:      map[string]int64{},
+		compression:      map[string]CompressionCount{},
+		shed:             map[string]int64{},
+		errorCodes:       map[string]int64{},
+	}
+}
+
+// Recorder accumulates statistics for the current reporting period. It is
+// safe for concurrent use.
+type Recorder struct {
+	clock clockwork.Clock
+
+	mu       sync.Mutex
+	region   string
+	hotspots *hotspot.Tracker
+	current  *counters
+	last     *Summary
+}
+
+// NewRecorder returns a Recorder whose first reporting period starts now.
+func NewRecorder(clock clockwork.Clock) *Recorder {
+	return &Recorder{
+		clock:   clock,
+		current: newCounters(clock.Now()),
+	}
+}
+
+// SetRegion tags the Summaries with region.
+func (r *Recorder) SetRegion(region string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.region = region
+}
+
+// SetHotspots reports the top write hotspots of tracker in the Summaries.
+func (r *Recorder) SetHotspots(tracker *hotspot.Tracker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hotspots = tracker
+}
+
+// RecordCall records an API call issued by manager. created and ended are
+// the kinds of entity the call created or ended, if any; errorCode is empty
+// for successful calls.
+func (r *Recorder) RecordCall(manager string, created string, ended string, errorCode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current.calls++
+	if manager != "" {
+		r.current.callsPerManager[manager]++
+	}
+	if errorCode != "" {
+		r.current.errorCodes[errorCode]++
+		return
+	}
+	if created != "" {
+		r.current.created[created]++
+	}
+	if ended != "" {
+		r.current.ended[ended]++
+	}
+}
+
+// RecordDeprecatedCall records a call to the deprecated API method
+// fullMethod issued by manager.
+func (r *Recorder) RecordDeprecatedCall(fullMethod string, manager string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls, ok := r.current.deprecatedCalls[fullMethod]
+	if !ok {
+		calls = map[string]int64{}
+		r.current.deprecatedCalls[fullMethod] = calls
+	}
+	calls[manager]++
+}
+
+// RecordGarbageCollected records that n entities of kind were removed by
+// garbage collection.
+func (r *Recorder) RecordGarbageCollected(kind string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.garbageCollected[kind] += int64(n)
+}
+
+// RecordIntegrityViolations records that n stored entities were found
+// failing an integrity check with violation.
+func (r *Recorder) RecordIntegrityViolations(violation string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.violations[violation] += int64(n)
+}
+
+// RecordTelemetryRejection records a call to the API method fullMethod
+// rejected for carrying fields resembling telemetry.
+func (r *Recorder) RecordTelemetryRejection(fullMethod string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.telemetry[fullMethod]++
+}
+
+// RecordTimeout records a repository call of operation which exceeded its
+// deadline.
+func (r *Recorder) RecordTimeout(operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.timeouts[operation]++
+}
+
+// RecordPoolDivergence records a canary entity of the pool checker not read
+// back as written through the DSS instance at peer.
+func (r *Recorder) RecordPoolDivergence(peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.divergences[peer]++
+}
+
+// RecordCompression records a response of raw bytes compressed to
+// compressed bytes with encoding.
+func (r *Recorder) RecordCompression(encoding string, raw, compressed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.current.compression[encoding]
+	c.Responses++
+	c.RawBytes += raw
+	c.CompressedBytes += compressed
+	r.current.compression[encoding] = c
+}
+
+// RecordShedCall records a call to the API method fullMethod rejected while
+// the database connection pools were saturated.
+func (r *Recorder) RecordShedCall(fullMethod string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.shed[fullMethod]++
+}
+
+// RecordTransaction records a database transaction that took attempts
+// attempts to complete.
+func (r *Recorder) RecordTransaction(attempts int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.transactions++
+	if attempts > 1 {
+		r.current.retries += int64(attempts - 1)
+	}
+}
+
+// Rotate closes the current reporting period, starts a new one and returns
+// the Summary of the closed period.
+func (r *Recorder) Rotate() *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	s := r.current.summarize(now)
+	s.Region = r.region
+	if r.hotspots != nil {
+		s.WriteHotspots = r.hotspots.Top(topHotspotsCount)
+	}
+	r.current = newCounters(now)
+	r.last = s
+	return s
+}
+
+// Last returns the Summary of the most recently closed reporting period, or
+// nil if no period has been closed yet.
+func (r *Recorder) Last() *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (c *counters) summarize(end time.Time) *Summary {
+	s := &Summary{
+		Start:            c.start,
+		End:              end,
+		Calls:            c.calls,
+		Created:          c.created,
+		Ended:            c.ended,
+		GarbageCollected: c.garbageCollected,
+		CallsPerManager:  c.callsPerManager,
+		DeprecatedCalls:  c.deprecatedCalls,
+		Transactions:     c.transactions,
+		Retries:          c.retries,
+
+		IntegrityViolations: c.violations,
+		TelemetryRejections: c.telemetry,
+		Timeouts:            c.timeouts,
+		PoolDivergences:     c.divergences,
+		Compression:         c.compression,
+		ShedCalls:           c.shed,
+	}
+	if c.transactions > 0 {
+		s.RetryRate = float64(c.retries) / float64(c.transactions)
+	}
+
+	for code, count := range c.errorCodes {
+		s.TopErrorCodes = append(s.TopErrorCodes, ErrorCodeCount{Code: code, Count: count})
+	}
+	sort.Slice(s.TopErrorCodes, func(i, j int) bool {
+		if s.TopErrorCodes[i].Count != s.TopErrorCodes[j].Count {
+			return s.TopErrorCodes[i].Count > s.TopErrorCodes[j].Count
+		}
+		return s.TopErrorCodes[i].Code < s.TopErrorCodes[j].Code
+	})
+	if len(s.TopErrorCodes) > topErrorCodesCount {
+		s.TopErrorCodes = s.TopErrorCodes[:topErrorCodesCount]
+	}
+	return s
+}
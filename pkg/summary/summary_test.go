@@ -0,0 +1,91 @@
+package summary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+	"github.com/interuss/dss/pkg/hotspot"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderRotate(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	r := NewRecorder(clock)
+	require.Nil(t, r.Last())
+
+	r.RecordCall("uss1", "ridpb.Subscription", "", "")
+	r.RecordCall("uss1", "", "ridpb.Subscription", "")
+	r.RecordCall("uss2", "", "", "NotFound")
+	r.RecordCall("uss2", "", "", "NotFound")
+	r.RecordCall("uss2", "ridpb.Subscription", "", "Aborted")
+	r.RecordDeprecatedCall("/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions", "uss1")
+	r.RecordDeprecatedCall("/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions", "uss1")
+	r.RecordGarbageCollected("ridpb.IdentificationServiceArea", 3)
+	r.RecordIntegrityViolations("missing_subscription", 2)
+	r.RecordTelemetryRejection("/scdpb.UTMAPIUSSDSSAndUSSUSSService/CreateOperationalIntentReference")
+	r.RecordTimeout("search")
+	r.RecordPoolDivergence("https://dss.uss2.example.com")
+	r.RecordCompression("gzip", 400000, 30000)
+	r.RecordCompression("gzip", 100000, 10000)
+	r.RecordShedCall("/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas")
+	r.RecordTransaction(1)
+	r.RecordTransaction(3)
+
+	clock.Advance(24 * time.Hour)
+	s := r.Rotate()
+
+	require.Equal(t, int64(5), s.Calls)
+	require.Equal(t, map[string]int64{"ridpb.Subscription": 1}, s.Created)
+	require.Equal(t, map[string]int64{"ridpb.Subscription": 1}, s.Ended)
+	require.Equal(t, map[string]int64{"ridpb.IdentificationServiceArea": 3}, s.GarbageCollected)
+	require.Equal(t, map[string]int64{"missing_subscription": 2}, s.IntegrityViolations)
+	require.Equal(t, map[string]int64{"/scdpb.UTMAPIUSSDSSAndUSSUSSService/CreateOperationalIntentReference": 1}, s.TelemetryRejections)
+	require.Equal(t, map[string]int64{"search": 1}, s.Timeouts)
+	require.Equal(t, map[string]int64{"https://dss.uss2.example.com": 1}, s.PoolDivergences)
+	require.Equal(t, map[string]CompressionCount{"gzip": {Responses: 2, RawBytes: 500000, CompressedBytes: 40000}}, s.Compression)
+	require.Equal(t, map[string]int64{"/ridpb.DiscoveryAndSynchronizationService/SearchIdentificationServiceAreas": 1}, s.ShedCalls)
+	require.Equal(t, map[string]int64{"uss1": 2, "uss2": 3}, s.CallsPerManager)
+	require.Equal(t, map[string]map[string]int64{
+		"/ridpb.DiscoveryAndSynchronizationService/SearchSubscriptions": {"uss1": 2},
+	}, s.DeprecatedCalls)
+	require.Equal(t, int64(2), s.Transactions)
+	require.Equal(t, int64(2), s.Retries)
+	require.Equal(t, 1.0, s.RetryRate)
+	require.Equal(t, []ErrorCodeCount{{"NotFound", 2}, {"Aborted", 1}}, s.TopErrorCodes)
+	require.Equal(t, 24*time.Hour, s.End.Sub(s.Start))
+	require.Equal(t, s, r.Last())
+
+	require.Equal(t, int64(0), r.Rotate().Calls)
+}
+
+func TestRecorderHotspots(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	r := NewRecorder(clock)
+	require.Empty(t, r.Rotate().WriteHotspots)
+
+	tracker := hotspot.NewTracker(clock, hotspot.DefaultLevel, time.Hour)
+	r.SetHotspots(tracker)
+	cell := s2.CellIDFromLatLng(s2.LatLngFromDegrees(46.2, 6.1)).Parent(13)
+	tracker.Record(hotspot.KindOperationalIntent, "op1", "uss1", s2.CellUnion{cell})
+	clock.Advance(time.Minute)
+
+	s := r.Rotate()
+	require.Len(t, s.WriteHotspots, 1)
+	require.Equal(t, cell.Parent(hotspot.DefaultLevel).ToToken(), s.WriteHotspots[0].Cell)
+}
+
+func TestEntityKinds(t *testing.T) {
+	created, ended := entityKinds("/ridpb.DiscoveryAndSynchronizationService/CreateIdentificationServiceArea")
+	require.Equal(t, "ridpb.IdentificationServiceArea", created)
+	require.Empty(t, ended)
+
+	created, ended = entityKinds("/scdpb.UTMAPIUSSDSSAndUSSUSSService/DeleteOperationalIntentReference")
+	require.Empty(t, created)
+	require.Equal(t, "scdpb.OperationalIntentReference", ended)
+
+	created, ended = entityKinds("/auxpb.DSSAuxService/GetVersion")
+	require.Empty(t, created)
+	require.Empty(t, ended)
+}
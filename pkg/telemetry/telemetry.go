@@ -0,0 +1,176 @@
+// Package telemetry keeps operational telemetry out of the DSS. The DSS
+// coordinates the intents of USSs and must never receive, let alone store,
+// the positions of their aircraft, which USSs exchange directly. Requests
+// carrying anything resembling telemetry are rejected by design rather than
+// having the offending fields silently dropped.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/interceptors"
+	"github.com/interuss/dss/pkg/logging"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/interuss/stacktrace"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Reason is the errdetails.ErrorInfo reason of the errors rejecting
+// requests carrying telemetry.
+const Reason = "TELEMETRY_REJECTED"
+
+// fieldPattern matches the names of the fields resembling telemetry.
+var fieldPattern = regexp.MustCompile(`(?i)telemetry|position|velocity|speed|heading|track`)
+
+// messages are the messages of the USS to USS APIs carrying telemetry.
+var messages = map[protoreflect.FullName]bool{}
+
+func init() {
+	for _, m := range []proto.Message{
+		&scdpb.GetOperationalIntentTelemetryResponse{},
+		&scdpb.OperationalIntentPositions{},
+		&scdpb.Position{},
+		&scdpb.PositionRecord{},
+		&scdpb.VehicleTelemetry{},
+		&scdpb.Velocity{},
+		&ridpb.RIDAircraftPosition{},
+		&ridpb.RIDAircraftState{},
+		&ridpb.RIDRecentAircraftPosition{},
+	} {
+		messages[m.ProtoReflect().Descriptor().FullName()] = true
+	}
+}
+
+// IsTelemetryField returns whether a field named name resembles telemetry.
+func IsTelemetryField(name string) bool {
+	return fieldPattern.MatchString(name)
+}
+
+// Violation is a field of a request found to resemble telemetry.
+type Violation struct {
+	// Field is the path of the field from the request, e.g.
+	// "params.extents[0].telemetry", or of the message holding it if it is
+	// unknown to the API, e.g. "params.extents[0].#17".
+	Field       string
+	Description string
+}
+
+// Check returns the first field of m resembling telemetry, or nil if there
+// is none. Fields unknown to the API are reported as well: their content
+// cannot be told apart from telemetry.
+func Check(m proto.Message) *Violation {
+	return check(m.ProtoReflect(), "")
+}
+
+func check(m protoreflect.Message, path string) *Violation {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	d := m.Descriptor()
+	if messages[d.FullName()] {
+		return &Violation{Field: path, Description: fmt.Sprintf("%s is telemetry", d.FullName())}
+	}
+	if unknown := m.GetUnknown(); len(unknown) > 0 {
+		number, _, _ := protowire.ConsumeTag(unknown)
+		return &Violation{
+			Field:       join(fmt.Sprintf("#%d", number)),
+			Description: fmt.Sprintf("Field %d is unknown to %s and may carry telemetry", number, d.FullName()),
+		}
+	}
+
+	var violation *Violation
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if IsTelemetryField(name) {
+			violation = &Violation{Field: join(name), Description: fmt.Sprintf("Field %s resembles telemetry", name)}
+			return false
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len() && violation == nil; i++ {
+				violation = check(list.Get(i).Message(), fmt.Sprintf("%s[%d]", join(name), i))
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				violation = check(v.Message(), fmt.Sprintf("%s[%v]", join(name), k.Interface()))
+				return violation == nil
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			violation = check(v.Message(), join(name))
+		}
+		return violation == nil
+	})
+	return violation
+}
+
+// Err returns the error rejecting a request carrying v, detailing the
+// offending field for clients to act upon.
+func (v *Violation) Err() error {
+	message := fmt.Sprintf("The DSS does not accept telemetry: %s", v.Description)
+	p, err := dsserr.MakeStatusProto(codes.InvalidArgument, message, &errdetails.ErrorInfo{
+		Reason:   Reason,
+		Domain:   dsserr.ErrorDomain,
+		Metadata: map[string]string{"field": v.Field},
+	}, &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: v.Field, Description: v.Description}},
+	})
+	if err != nil {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "%s", message)
+	}
+	return status.ErrorProto(p)
+}
+
+// Interceptor returns a grpc.UnaryServerInterceptor rejecting the requests
+// carrying fields resembling telemetry and recording them to r.
+func Interceptor(r *summary.Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := reject(ctx, r, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a grpc.StreamServerInterceptor rejecting the
+// requests received by streams like Interceptor does.
+func StreamInterceptor(r *summary.Recorder) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, interceptors.CheckReceived(ss, func(req interface{}) error {
+			return reject(ss.Context(), r, info.FullMethod, req)
+		}))
+	}
+}
+
+// reject returns the error rejecting req, a request to method, if it carries
+// fields resembling telemetry, recording it to r.
+func reject(ctx context.Context, r *summary.Recorder, method string, req interface{}) error {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	v := Check(m)
+	if v == nil {
+		return nil
+	}
+	r.RecordTelemetryRejection(method)
+	logging.WithValuesFromContext(ctx, logging.Logger).Warn("Rejected request carrying telemetry",
+		zap.String("method", method), zap.String("field", v.Field))
+	return v.Err()
+}
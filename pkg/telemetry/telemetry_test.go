@@ -0,0 +1,195 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/interuss/dss/pkg/api/v1/auxpb"
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
+	"github.com/interuss/dss/pkg/summary"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var services = []protoreflect.FileDescriptor{
+	auxpb.File_pkg_api_v1_auxpb_aux_service_proto,
+	ridpb.File_pkg_api_v1_ridpb_rid_proto,
+	scdpb.File_pkg_api_v1_scdpb_scd_proto,
+}
+
+// forEachMethod calls f with the full name and the request message type of
+// every method served by the DSS.
+func forEachMethod(t *testing.T, f func(fullMethod string, input protoreflect.MessageType)) {
+	for _, file := range services {
+		for i := 0; i < file.Services().Len(); i++ {
+			service := file.Services().Get(i)
+			for j := 0; j < service.Methods().Len(); j++ {
+				method := service.Methods().Get(j)
+				input, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+				require.NoError(t, err)
+				f("/"+string(service.FullName())+"/"+string(method.Name()), input)
+			}
+		}
+	}
+}
+
+// TestAPIFreeOfTelemetry guards the design of the API: none of the
+// requests served by the DSS may have a field resembling telemetry, nor
+// reach a message carrying telemetry.
+func TestAPIFreeOfTelemetry(t *testing.T) {
+	var walk func(d protoreflect.MessageDescriptor, path string, seen map[protoreflect.FullName]bool)
+	walk = func(d protoreflect.MessageDescriptor, path string, seen map[protoreflect.FullName]bool) {
+		require.False(t, messages[d.FullName()], "%s reaches telemetry message %s", path, d.FullName())
+		if seen[d.FullName()] {
+			return
+		}
+		seen[d.FullName()] = true
+		for i := 0; i < d.Fields().Len(); i++ {
+			fd := d.Fields().Get(i)
+			require.False(t, IsTelemetryField(string(fd.Name())), "%s.%s resembles telemetry", path, fd.Name())
+			if fd.Message() != nil {
+				walk(fd.Message(), path+"."+string(fd.Name()), seen)
+			}
+		}
+	}
+	forEachMethod(t, func(fullMethod string, input protoreflect.MessageType) {
+		walk(input.Descriptor(), fullMethod, map[protoreflect.FullName]bool{})
+	})
+}
+
+// TestInterceptorExtendedPayloads probes every method with requests
+// extended with random fields unknown to the API.
+func TestInterceptorExtendedPayloads(t *testing.T) {
+	var (
+		r           = summary.NewRecorder(clockwork.NewFakeClock())
+		interceptor = Interceptor(r)
+		rng         = rand.New(rand.NewSource(42))
+		telemetry   = &scdpb.VehicleTelemetry{Position: &scdpb.Position{Latitude: 46.2, Longitude: 6.1}}
+		rejections  int64
+	)
+	encodedTelemetry, err := proto.Marshal(telemetry)
+	require.NoError(t, err)
+
+	forEachMethod(t, func(fullMethod string, input protoreflect.MessageType) {
+		info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+		handled := false
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			handled = true
+			return nil, nil
+		}
+
+		// Plain requests go through.
+		_, err := interceptor(context.Background(), input.New().Interface(), info, handler)
+		require.NoError(t, err)
+		require.True(t, handled, fullMethod)
+
+		for i := 0; i < 20; i++ {
+			number := protowire.Number(1000 + rng.Intn(1000))
+			var extension []byte
+			switch rng.Intn(3) {
+			case 0:
+				extension = protowire.AppendTag(extension, number, protowire.VarintType)
+				extension = protowire.AppendVarint(extension, rng.Uint64())
+			case 1:
+				extension = protowire.AppendTag(extension, number, protowire.Fixed64Type)
+				extension = protowire.AppendFixed64(extension, rng.Uint64())
+			default:
+				extension = protowire.AppendTag(extension, number, protowire.BytesType)
+				extension = protowire.AppendBytes(extension, encodedTelemetry)
+			}
+			req := input.New().Interface()
+			require.NoError(t, proto.Unmarshal(extension, req))
+
+			handled = false
+			_, err := interceptor(context.Background(), req, info, handler)
+			require.False(t, handled, fullMethod)
+			s, ok := status.FromError(err)
+			require.True(t, ok)
+			require.Equal(t, codes.InvalidArgument, s.Code())
+			require.Equal(t, Reason, s.Details()[0].(*errdetails.ErrorInfo).Reason)
+			rejections++
+		}
+	})
+	require.Equal(t, rejections, sumValues(r.Rotate().TelemetryRejections))
+}
+
+func TestCheckNested(t *testing.T) {
+	req := &scdpb.CreateOperationalIntentReferenceRequest{
+		Params: &scdpb.PutOperationalIntentReferenceParameters{Extents: []*scdpb.Volume4D{{}, {}}},
+	}
+	require.Nil(t, Check(req))
+
+	unknown := protowire.AppendTag(nil, 99, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 1)
+	req.Params.Extents[1].ProtoReflect().SetUnknown(unknown)
+	v := Check(req)
+	require.NotNil(t, v)
+	require.Equal(t, "params.extents[1].#99", v.Field)
+
+	// Telemetry is rejected wherever it appears.
+	v = Check(&scdpb.PositionRecord{Telemetry: &scdpb.VehicleTelemetry{}})
+	require.NotNil(t, v)
+	require.Equal(t, "", v.Field)
+	v = Check(&ridpb.RIDFlight{RecentPositions: []*ridpb.RIDRecentAircraftPosition{{}}})
+	require.NotNil(t, v)
+	require.Equal(t, "recent_positions", v.Field)
+}
+
+// requestStream receives req, then io.EOF.
+type requestStream struct {
+	grpc.ServerStream
+	req proto.Message
+}
+
+func (s *requestStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *requestStream) RecvMsg(m interface{}) error {
+	if s.req == nil {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.req)
+	s.req = nil
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	var (
+		r           = summary.NewRecorder(clockwork.NewFakeClock())
+		interceptor = StreamInterceptor(r)
+		info        = &grpc.StreamServerInfo{FullMethod: "/ridpb.DiscoveryAndSynchronizationStreamingService/StreamIdentificationServiceAreas"}
+	)
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		return ss.RecvMsg(&ridpb.SearchIdentificationServiceAreasRequest{})
+	}
+
+	req := &ridpb.SearchIdentificationServiceAreasRequest{Area: "46.2,6.1,46.3,6.1,46.3,6.2"}
+	require.NoError(t, interceptor(nil, &requestStream{req: req}, info, handler))
+
+	unknown := protowire.AppendTag(nil, 99, protowire.VarintType)
+	unknown = protowire.AppendVarint(unknown, 1)
+	req.ProtoReflect().SetUnknown(unknown)
+	err := interceptor(nil, &requestStream{req: req}, info, handler)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, map[string]int64{info.FullMethod: 1}, r.Rotate().TelemetryRejections)
+}
+
+func sumValues(m map[string]int64) int64 {
+	var sum int64
+	for _, v := range m {
+		sum += v
+	}
+	return sum
+}
@@ -0,0 +1,54 @@
+// Package tracing provides OpenTelemetry tracing for the DSS.
+package tracing
+
+import (
+	"context"
+
+	"github.com/interuss/stacktrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/interuss/dss"
+
+// Configure installs a global tracer provider exporting spans via OTLP/gRPC
+// to "endpoint", attributing them to "serviceName" and, if not empty, to the
+// cloud "region" of the database. The returned function flushes pending
+// spans and must be called on shutdown.
+func Configure(ctx context.Context, endpoint string, serviceName string, region string) (func(context.Context) error, error) {
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(
+		otlpgrpc.WithInsecure(),
+		otlpgrpc.WithEndpoint(endpoint),
+	))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Error creating OTLP exporter for %s", endpoint)
+	}
+
+	attributes := []attribute.KeyValue{semconv.ServiceNameKey.String(serviceName)}
+	if region != "" {
+		attributes = append(attributes, semconv.CloudRegionKey.String(region))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(attributes...)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a span named "name" as a child of the span in ctx, if any.
+// If tracing has not been configured, the returned span is a no-op.
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
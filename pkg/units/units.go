@@ -0,0 +1,116 @@
+// Package units parses the altitudes of the API, which carry a unit and a
+// vertical reference, so that the models only ever hold meters, and converts
+// them back to the unit they were submitted in.
+package units
+
+import (
+	"math"
+	"strings"
+
+	"github.com/interuss/stacktrace"
+)
+
+// Unit is a unit of length of the API.
+type Unit string
+
+// Units of the API.
+const (
+	Meters Unit = "M"
+	Feet   Unit = "FT"
+)
+
+// metersPerFoot is the length of the international foot.
+const metersPerFoot = 0.3048
+
+// ParseUnit returns the Unit named s, case-insensitively.
+func ParseUnit(s string) (Unit, error) {
+	switch u := Unit(strings.ToUpper(s)); u {
+	case Meters, Feet:
+		return u, nil
+	}
+	return "", stacktrace.NewError("Unsupported unit %q; expected %s or %s", s, Meters, Feet)
+}
+
+// ToMeters converts v, in u, to meters.
+func (u Unit) ToMeters(v float64) float64 {
+	if u == Feet {
+		return v * metersPerFoot
+	}
+	return v
+}
+
+// FromMeters converts v, in meters, to u.
+func (u Unit) FromMeters(v float64) float64 {
+	if u == Feet {
+		return v / metersPerFoot
+	}
+	return v
+}
+
+func (u Unit) String() string {
+	return string(u)
+}
+
+// Reference is a vertical reference of the API.
+type Reference string
+
+// References of the API.
+const (
+	// W84 altitudes are heights above the WGS84 ellipsoid, which the models
+	// hold.
+	W84 Reference = "W84"
+	// EGM96 altitudes are heights above the EGM96 geoid.
+	EGM96 Reference = "EGM96"
+	// SPS altitudes are pressure altitudes under the standard pressure
+	// setting. The DSS has no access to the actual atmospheric pressure, so
+	// they are taken as heights above mean sea level, i.e. the EGM96 geoid,
+	// as they are in the standard atmosphere.
+	SPS Reference = "SPS"
+)
+
+// ParseReference returns the Reference named s, case-insensitively.
+func ParseReference(s string) (Reference, error) {
+	switch r := Reference(strings.ToUpper(s)); r {
+	case W84, EGM96, SPS:
+		return r, nil
+	}
+	return "", stacktrace.NewError("Unsupported altitude reference %q; expected %s, %s or %s", s, W84, EGM96, SPS)
+}
+
+func (r Reference) String() string {
+	return string(r)
+}
+
+// Altitude is an altitude as submitted through the API.
+type Altitude struct {
+	Value     float64
+	Unit      Unit
+	Reference Reference
+}
+
+// ParseAltitude validates the value, unit and reference of an altitude of
+// the API.
+func ParseAltitude(value float64, unit, reference string) (*Altitude, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, stacktrace.NewError("Altitude must be a finite number")
+	}
+	u, err := ParseUnit(unit)
+	if err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	r, err := ParseReference(reference)
+	if err != nil {
+		return nil, err // No need to Propagate this error as this stack layer does not add useful information
+	}
+	return &Altitude{Value: value, Unit: u, Reference: r}, nil
+}
+
+// Meters returns the value of a in meters, relative to its reference.
+func (a *Altitude) Meters() float64 {
+	return a.Unit.ToMeters(a.Value)
+}
+
+// WGS84Meters returns the Altitude of meters above the WGS84 ellipsoid.
+func WGS84Meters(meters float64) *Altitude {
+	return &Altitude{Value: meters, Unit: Meters, Reference: W84}
+}
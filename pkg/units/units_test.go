@@ -0,0 +1,36 @@
+package units
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAltitude(t *testing.T) {
+	a, err := ParseAltitude(400, "ft", "w84")
+	require.NoError(t, err)
+	require.Equal(t, &Altitude{Value: 400, Unit: Feet, Reference: W84}, a)
+	require.InDelta(t, 121.92, a.Meters(), 1e-9)
+	require.InDelta(t, 400, a.Unit.FromMeters(a.Meters()), 1e-9)
+
+	a, err = ParseAltitude(120, "M", "SPS")
+	require.NoError(t, err)
+	require.Equal(t, 120.0, a.Meters())
+	require.Equal(t, SPS, a.Reference)
+
+	for _, c := range []struct {
+		value           float64
+		unit, reference string
+	}{
+		{100, "", "W84"},
+		{100, "NM", "W84"},
+		{100, "M", ""},
+		{100, "M", "AGL"},
+		{math.NaN(), "M", "W84"},
+		{math.Inf(1), "M", "W84"},
+	} {
+		_, err := ParseAltitude(c.value, c.unit, c.reference)
+		require.Error(t, err, "%v %q %q", c.value, c.unit, c.reference)
+	}
+}
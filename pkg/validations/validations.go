@@ -2,10 +2,16 @@ package validations
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 
+	"github.com/interuss/dss/pkg/api/v1/ridpb"
+	"github.com/interuss/dss/pkg/api/v1/scdpb"
 	dsserr "github.com/interuss/dss/pkg/errors"
+	"github.com/interuss/dss/pkg/flags"
+	"github.com/interuss/dss/pkg/interceptors"
 	"github.com/interuss/stacktrace"
 	"google.golang.org/grpc"
 )
@@ -22,9 +28,23 @@ func ValidationInterceptor(ctx context.Context, req interface{}, info *grpc.Unar
 	if err := ValidateUUID(req); err != nil {
 		return nil, err
 	}
+	if err := ValidateNewID(req); err != nil {
+		return nil, err
+	}
 	return handler(ctx, req)
 }
 
+// StreamValidationInterceptor is a grpc stream Interceptor validating the
+// requests received by streams like ValidationInterceptor does.
+func StreamValidationInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, interceptors.CheckReceived(ss, func(req interface{}) error {
+		if err := ValidateUUID(req); err != nil {
+			return err
+		}
+		return ValidateNewID(req)
+	}))
+}
+
 // ValidateUUID contains the UUID validation check.
 func ValidateUUID(req interface{}) error {
 	r, ok := req.(ReqWithID)
@@ -35,5 +55,84 @@ func ValidateUUID(req interface{}) error {
 	if _, err := uuid.Parse(r.GetId()); err != nil {
 		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid UUID format")
 	}
+	// uuid.Parse also accepts UUIDs enclosed in braces, prefixed with
+	// urn:uuid: or without hyphens, none of which are 36 characters long.
+	if flags.StrictUUIDs.Enabled() && len(r.GetId()) != 36 {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "UUID not in canonical form")
+	}
+	return nil
+}
+
+// IDValidator checks that the ID of an entity being created, already known to
+// be a UUID, is in the format required by the deployment.
+type IDValidator func(id uuid.UUID) error
+
+// IDValidators are the checks applied by ValidateNewID, set up at startup.
+var IDValidators []IDValidator
+
+// RequireVersions returns an IDValidator rejecting the UUIDs which are not
+// RFC 4122 UUIDs of one of versions.
+func RequireVersions(versions ...uuid.Version) IDValidator {
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = fmt.Sprintf("%d", v)
+	}
+	expected := strings.Join(names, " or ")
+	return func(id uuid.UUID) error {
+		if id.Variant() == uuid.RFC4122 {
+			for _, v := range versions {
+				if id.Version() == v {
+					return nil
+				}
+			}
+		}
+		return stacktrace.NewErrorWithCode(dsserr.InvalidID, "ID %s is not a version %s UUID", id, expected)
+	}
+}
+
+// RequirePrefix returns an IDValidator rejecting the UUIDs whose canonical
+// form does not start with prefix, reserving a namespace of IDs to the
+// entities of the deployment.
+func RequirePrefix(prefix string) IDValidator {
+	prefix = strings.ToLower(prefix)
+	return func(id uuid.UUID) error {
+		if !strings.HasPrefix(id.String(), prefix) {
+			return stacktrace.NewErrorWithCode(dsserr.InvalidID, "ID %s is not in namespace %s", id, prefix)
+		}
+		return nil
+	}
+}
+
+// ValidateNewID applies IDValidators to the ID of the entity created by req,
+// if any. The IDs of existing entities are not checked, so that entities
+// created before a validator was set up may still be read and deleted.
+func ValidateNewID(req interface{}) error {
+	if len(IDValidators) == 0 {
+		return nil
+	}
+	var s string
+	switch r := req.(type) {
+	case *ridpb.CreateIdentificationServiceAreaRequest:
+		s = r.GetId()
+	case *ridpb.CreateSubscriptionRequest:
+		s = r.GetId()
+	case *scdpb.CreateOperationalIntentReferenceRequest:
+		s = r.GetEntityid()
+	case *scdpb.CreateConstraintReferenceRequest:
+		s = r.GetEntityid()
+	case *scdpb.CreateSubscriptionRequest:
+		s = r.GetSubscriptionid()
+	default:
+		return nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return stacktrace.NewErrorWithCode(dsserr.BadRequest, "Invalid UUID format")
+	}
+	for _, validate := range IDValidators {
+		if err := validate(id); err != nil {
+			return err
+		}
+	}
 	return nil
 }